@@ -1,8 +1,10 @@
 package blockchain
 
 import (
+	"sync"
 	"sync/atomic"
 
+	"github.com/btcboost/copernicus/conf"
 	"github.com/btcboost/copernicus/consensus"
 	"github.com/btcboost/copernicus/container"
 	"github.com/btcboost/copernicus/core"
@@ -38,6 +40,8 @@ var (
 	GImporting       atomic.Value
 	GMaxTipAge       int64
 	GMemPool         *mempool.TxMempool
+	GStemPool        *mempool.TxMempool // Dandelion++ stem transactions, hidden until fluffed
+	GOrphanPool      *mempool.OrphanPool
 	GCoinsTip        *utxo.CoinsViewCache
 	GBlockTree       *BlockTreeDB
 	GMinRelayTxFee   utils.FeeRate
@@ -98,5 +102,28 @@ func init() {
 	GMaxTipAge = consensus.DefaultMaxTipAge
 	GMinRelayTxFee.SataoshisPerK = int64(DefaultMinRelayTxFee)
 	GMemPool = mempool.NewTxMempool()
+	GStemPool = mempool.NewTxMempool()
+	GOrphanPool = mempool.NewOrphanPool(conf.AppConf.MaxOrphanTxs, mempool.DefaultMaxOrphanPoolSize)
 	GWarningCache = NewWarnBitsCache(VersionBitsNumBits)
 }
+
+// blockIndexLock guards the writes to GChainState.MapBlockIndex and
+// GIndexBestHeader against the reads of LookupBlockIndex and BestHeader,
+// which run outside of the chain code.
+var blockIndexLock sync.RWMutex
+
+// LookupBlockIndex returns the index of the block of hash, or nil when the
+// block is unknown.  It may be called from any goroutine.
+func LookupBlockIndex(hash *utils.Hash) *core.BlockIndex {
+	blockIndexLock.RLock()
+	defer blockIndexLock.RUnlock()
+	return GChainState.MapBlockIndex.Data[*hash]
+}
+
+// BestHeader returns the index of the best header seen so far, or nil before
+// the block index is loaded.  It may be called from any goroutine.
+func BestHeader() *core.BlockIndex {
+	blockIndexLock.RLock()
+	defer blockIndexLock.RUnlock()
+	return GIndexBestHeader
+}
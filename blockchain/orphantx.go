@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// MisbehaviorFunc is called when a transaction relayed by the peer identified
+// by tag is found invalid; howMuch is the DoS score of the rejection.
+type MisbehaviorFunc func(tag int64, howMuch int, reason string)
+
+// acceptToMemoryPool is AcceptToMemoryPool, replaced by the tests which have
+// no chain to validate the transactions against.
+var acceptToMemoryPool = AcceptToMemoryPool
+
+// orphansAccepted holds the handlers of the orphans accepted into the memPool
+// once a connected block confirmed their parents.
+var orphansAccepted struct {
+	sync.Mutex
+	handlers []func(txs []*core.Tx)
+}
+
+// SubscribeOrphansAccepted registers handler to be called with the orphans
+// accepted into the memPool when a block is connected.  No peer relays these,
+// the handler is expected to announce them.  It is called from the chain code
+// and must not block.
+func SubscribeOrphansAccepted(handler func(txs []*core.Tx)) {
+	orphansAccepted.Lock()
+	orphansAccepted.handlers = append(orphansAccepted.handlers, handler)
+	orphansAccepted.Unlock()
+}
+
+// ProcessTransaction is the entry point for loose transactions received from
+// peers or RPC. The tx is accepted into the memPool, or stored into the orphan
+// pool when some of its inputs are missing. When the tx is accepted, all the
+// orphans depending on it are processed again. It returns all transactions
+// accepted into the memPool by this call, in the order of acceptance.
+// limitFree applies the rate limit of the free transactions to tx.
+func ProcessTransaction(params *msg.BitcoinParams, tx *core.Tx, limitFree bool, tag int64,
+	misbehaving MisbehaviorFunc) ([]*core.Tx, error) {
+
+	txid := tx.TxHash()
+	if GOrphanPool.HaveOrphan(txid) {
+		return nil, fmt.Errorf("already have orphan transaction %s", txid.ToString())
+	}
+
+	var state core.ValidationState
+	missingInputs := false
+	if acceptToMemoryPool(params, GMemPool, &state, tx, limitFree, &missingInputs, nil, false, 0) {
+		accepted := []*core.Tx{tx}
+		accepted = append(accepted, ProcessOrphans(params, tx, misbehaving)...)
+		return accepted, nil
+	}
+
+	if missingInputs {
+		err := GOrphanPool.AddOrphan(tx, tag)
+		if err != nil {
+			logs.Debug("not keeping orphan tx %s: %v", txid.ToString(), err)
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if dos, ok := state.IsInvalidDumpDos(); ok && dos > 0 && misbehaving != nil {
+		misbehaving(tag, dos, state.GetRejectReason())
+	}
+	return nil, fmt.Errorf("transaction %s rejected: %s", txid.ToString(), state.FormatStateMessage())
+}
+
+// ProcessOrphans try to accept the orphans which spend the outputs of the
+// parent tx, which was just accepted into memPool or confirmed by a block, and
+// recursively the orphans depending on each newly accepted orphan. Invalid
+// orphans are removed from the orphan pool, and the peers that sent them are
+// reported to the misbehaving hook.
+func ProcessOrphans(params *msg.BitcoinParams, parent *core.Tx, misbehaving MisbehaviorFunc) []*core.Tx {
+	accepted := make([]*core.Tx, 0)
+	workQueue := []*core.Tx{parent}
+	for len(workQueue) > 0 {
+		processing := workQueue[0]
+		workQueue = workQueue[1:]
+
+		for _, orphan := range GOrphanPool.OrphansSpending(processing) {
+			var state core.ValidationState
+			missingInputs := false
+			if acceptToMemoryPool(params, GMemPool, &state, orphan.Tx, true, &missingInputs, nil, false, 0) {
+				logs.Debug("accepted orphan tx %s", orphan.Tx.Hash.ToString())
+				GOrphanPool.RemoveOrphanSelf(orphan.Tx)
+				accepted = append(accepted, orphan.Tx)
+				workQueue = append(workQueue, orphan.Tx)
+				continue
+			}
+			if missingInputs {
+				// still waiting for other parents.
+				continue
+			}
+
+			if dos, ok := state.IsInvalidDumpDos(); ok && dos > 0 && misbehaving != nil {
+				misbehaving(orphan.Tag, dos, state.GetRejectReason())
+			}
+			logs.Debug("removed invalid orphan tx %s: %s", orphan.Tx.Hash.ToString(), state.FormatStateMessage())
+			GOrphanPool.RemoveOrphan(orphan.Tx)
+		}
+	}
+	return accepted
+}
+
+// ProcessOrphansForBlock drop the orphans included in or conflicting with the
+// block, then try to accept the orphans spending the block's outputs.
+func ProcessOrphansForBlock(params *msg.BitcoinParams, block *core.Block) []*core.Tx {
+	GOrphanPool.RemoveOrphansForBlock(block.Txs)
+	accepted := make([]*core.Tx, 0)
+	for _, tx := range block.Txs {
+		accepted = append(accepted, ProcessOrphans(params, tx, nil)...)
+	}
+	return accepted
+}
+
+// processOrphansForConnectedBlock processes the orphans of the block which
+// was just connected, and notifies the subscribers of the accepted ones.
+func processOrphansForConnectedBlock(params *msg.BitcoinParams, block *core.Block) {
+	accepted := ProcessOrphansForBlock(params, block)
+	if len(accepted) == 0 {
+		return
+	}
+	orphansAccepted.Lock()
+	handlers := orphansAccepted.handlers
+	orphansAccepted.Unlock()
+	for _, handler := range handlers {
+		handler(accepted)
+	}
+}
+
+// HaveOrphanTx return whether the orphan pool contains the hash.
+func HaveOrphanTx(hash utils.Hash) bool {
+	return GOrphanPool.HaveOrphan(hash)
+}
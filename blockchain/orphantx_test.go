@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// createTestTx returns a transaction spending the output prevIndex of
+// prevHash.
+func createTestTx(prevHash utils.Hash, prevIndex uint32) *core.Tx {
+	tx := core.NewTx()
+	tx.Ins = []*core.TxIn{core.NewTxIn(core.NewOutPoint(prevHash, prevIndex), []byte{core.OP_11})}
+	tx.Outs = []*core.TxOut{core.NewTxOut(10000, []byte{core.OP_11, core.OP_EQUAL})}
+	tx.Hash = tx.TxHash()
+	return tx
+}
+
+// acceptKnownParents replaces the memPool acceptance with one taking the
+// transactions whose parent is in known, which the accepted transactions are
+// added to.  It returns the function restoring the memPool acceptance.
+func acceptKnownParents(known map[utils.Hash]struct{}) func() {
+	accept := acceptToMemoryPool
+	acceptToMemoryPool = func(params *msg.BitcoinParams, pool *mempool.TxMempool, state *core.ValidationState,
+		tx *core.Tx, limitFree bool, missingInputs *bool, txnReplaced *list.List,
+		overrideMempoolLimit bool, absurdFee utils.Amount) bool {
+
+		if _, ok := known[tx.Ins[0].PreviousOutPoint.Hash]; !ok {
+			*missingInputs = true
+			return false
+		}
+		known[tx.Hash] = struct{}{}
+		return true
+	}
+	return func() {
+		acceptToMemoryPool = accept
+	}
+}
+
+func TestOrphansAcceptedForConnectedBlock(t *testing.T) {
+	orphanPool := GOrphanPool
+	handlers := orphansAccepted.handlers
+	defer func() {
+		GOrphanPool = orphanPool
+		orphansAccepted.handlers = handlers
+	}()
+	GOrphanPool = mempool.NewOrphanPool(10, mempool.DefaultMaxOrphanPoolSize)
+
+	// The parent is confirmed by the block, the child and the grandchild
+	// are orphans, the unrelated orphan still misses its parent.
+	parent := createTestTx(utils.HashOne, 0)
+	child := createTestTx(parent.Hash, 0)
+	grandChild := createTestTx(child.Hash, 0)
+	unrelated := createTestTx(utils.HashOne, 1)
+	for _, tx := range []*core.Tx{grandChild, child, unrelated} {
+		if err := GOrphanPool.AddOrphan(tx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restore := acceptKnownParents(map[utils.Hash]struct{}{parent.Hash: {}})
+	defer restore()
+
+	var notified []*core.Tx
+	SubscribeOrphansAccepted(func(txs []*core.Tx) {
+		notified = append(notified, txs...)
+	})
+	block := &core.Block{Txs: []*core.Tx{parent}}
+	processOrphansForConnectedBlock(&msg.RegressionNetParams, block)
+
+	if len(notified) != 2 || notified[0] != child || notified[1] != grandChild {
+		t.Fatalf("%d accepted orphans notified, want the child and the grandchild", len(notified))
+	}
+	if GOrphanPool.HaveOrphan(child.Hash) || GOrphanPool.HaveOrphan(grandChild.Hash) ||
+		!GOrphanPool.HaveOrphan(unrelated.Hash) {
+		t.Errorf("%d orphans left, want the unrelated one only", GOrphanPool.Count())
+	}
+
+	// A block letting no orphan in notifies nothing.
+	notified = nil
+	processOrphansForConnectedBlock(&msg.RegressionNetParams, &core.Block{Txs: []*core.Tx{createTestTx(utils.HashOne, 2)}})
+	if len(notified) != 0 {
+		t.Errorf("%d accepted orphans notified for an unrelated block", len(notified))
+	}
+}
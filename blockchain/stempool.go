@@ -0,0 +1,68 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+)
+
+// AcceptStemTransaction validates a transaction of the Dandelion++ stem and
+// keeps it into the stem pool, out of the memPool until it is fluffed. The
+// stem transactions may spend the outputs of the memPool transactions, but not
+// double spend them.  The stem transactions missing inputs are rejected rather
+// than kept as orphans.
+func AcceptStemTransaction(params *msg.BitcoinParams, tx *core.Tx, tag int64, misbehaving MisbehaviorFunc) error {
+	txid := tx.TxHash()
+	if GMemPool.Exists(txid) {
+		return fmt.Errorf("transaction %s already in memPool", txid.ToString())
+	}
+	if conflict := memPoolConflict(tx); conflict != nil {
+		conflictID := conflict.TxHash()
+		return fmt.Errorf("stem transaction %s double spends memPool transaction %s",
+			txid.ToString(), conflictID.ToString())
+	}
+
+	var state core.ValidationState
+	missingInputs := false
+	if AcceptToMemoryPool(params, GStemPool, &state, tx, true, &missingInputs, nil, false, 0) {
+		return nil
+	}
+	if missingInputs {
+		return fmt.Errorf("stem transaction %s has missing inputs", txid.ToString())
+	}
+	if dos, ok := state.IsInvalidDumpDos(); ok && dos > 0 && misbehaving != nil {
+		misbehaving(tag, dos, state.GetRejectReason())
+	}
+	return fmt.Errorf("stem transaction %s rejected: %s", txid.ToString(), state.FormatStateMessage())
+}
+
+// memPoolConflict returns the memPool transaction spending an input of tx,
+// nil when there is none.
+func memPoolConflict(tx *core.Tx) *core.Tx {
+	GMemPool.RLock()
+	defer GMemPool.RUnlock()
+	for _, txin := range tx.Ins {
+		if entry := GMemPool.NextTx[*txin.PreviousOutPoint]; entry != nil {
+			return entry.Tx
+		}
+	}
+	return nil
+}
+
+// RemoveStemTransaction removes the transaction, and those spending it, from
+// the stem pool.
+func RemoveStemTransaction(tx *core.Tx) {
+	GStemPool.Lock()
+	GStemPool.RemoveTxRecursive(tx, mempool.UNKNOWN)
+	GStemPool.Unlock()
+}
+
+// FluffStemTransaction moves the stem transaction into the memPool, to be
+// announced to all the peers. It returns the transactions accepted into the
+// memPool, like ProcessTransaction.
+func FluffStemTransaction(params *msg.BitcoinParams, tx *core.Tx) ([]*core.Tx, error) {
+	RemoveStemTransaction(tx)
+	return ProcessTransaction(params, tx, false, 0, nil)
+}
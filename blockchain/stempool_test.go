@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestStemTransactionMemPoolConflict(t *testing.T) {
+	memPool := GMemPool
+	defer func() {
+		GMemPool = memPool
+	}()
+	GMemPool = mempool.NewTxMempool()
+
+	memPoolTx := createTestTx(utils.HashOne, 0)
+	entry := &mempool.TxEntry{Tx: memPoolTx}
+	GMemPool.PoolData[memPoolTx.Hash] = entry
+	GMemPool.NextTx[*memPoolTx.Ins[0].PreviousOutPoint] = entry
+
+	// A child of the memPool tx spends its output, it doesn't conflict.
+	if conflict := memPoolConflict(createTestTx(memPoolTx.Hash, 0)); conflict != nil {
+		t.Errorf("child of a memPool tx conflicts with %s", conflict.Hash.ToString())
+	}
+	if conflict := memPoolConflict(createTestTx(utils.HashOne, 1)); conflict != nil {
+		t.Errorf("unrelated tx conflicts with %s", conflict.Hash.ToString())
+	}
+
+	// A double spend of the memPool tx is rejected before its validation,
+	// and the peer isn't punished: it may not have seen the memPool tx.
+	doubleSpend := createTestTx(utils.HashOne, 0)
+	doubleSpend.Outs[0].Value = 9000
+	doubleSpend.Hash = utils.Hash{}
+	doubleSpend.Hash = doubleSpend.TxHash()
+	misbehaving := func(tag int64, howMuch int, reason string) {
+		t.Errorf("peer %d punished by %d for %s", tag, howMuch, reason)
+	}
+	for _, tx := range []*core.Tx{memPoolTx, doubleSpend} {
+		if err := AcceptStemTransaction(&msg.RegressionNetParams, tx, 1, misbehaving); err == nil {
+			t.Errorf("stem tx %s accepted", tx.Hash.ToString())
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package blockchain
+
+import "sync"
+
+// tipChange broadcasts changes of the active chain tip.  Waiters receive the
+// current channel, which is closed and replaced on every change, so that any
+// number of them can be woken at once.
+var tipChange = struct {
+	sync.Mutex
+	c chan struct{}
+}{c: make(chan struct{})}
+
+// TipChanged returns a channel that is closed the next time the tip of the
+// active chain changes.  Callers should fetch the channel before inspecting
+// the tip so that no change goes unnoticed.
+func TipChanged() <-chan struct{} {
+	tipChange.Lock()
+	defer tipChange.Unlock()
+
+	return tipChange.c
+}
+
+// notifyTipChanged wakes everyone waiting on TipChanged.
+func notifyTipChanged() {
+	tipChange.Lock()
+	close(tipChange.c)
+	tipChange.c = make(chan struct{})
+	tipChange.Unlock()
+}
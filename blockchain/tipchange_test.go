@@ -0,0 +1,32 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTipChanged(t *testing.T) {
+	first := TipChanged()
+	select {
+	case <-first:
+		t.Fatal("TipChanged: channel closed before the tip changed")
+	default:
+	}
+
+	notifyTipChanged()
+	select {
+	case <-first:
+	case <-time.After(time.Second):
+		t.Fatal("TipChanged: channel not closed after the tip changed")
+	}
+
+	second := TipChanged()
+	if second == first {
+		t.Fatal("TipChanged: channel not replaced after the tip changed")
+	}
+	select {
+	case <-second:
+		t.Fatal("TipChanged: new channel closed before the next change")
+	default:
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"bytes"
 	"container/list"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -66,7 +68,6 @@ var (
 	gTimeIndex         int64
 	gTimeCallbacks     int64
 	gTimeTotal         int64
-	gMinRelayTxFee     = utils.NewFeeRate(int64(DefaultMinRelayTxFee))
 	GRequestShutdown   atomic.Value
 	GDumpMemPoolLater  atomic.Value
 	gLastFlush         int
@@ -1713,8 +1714,11 @@ func ConnectTip(param *msg.BitcoinParams, state *core.ValidationState, indexNew
 		float64(nTime5-nTime4)*0.001, float64(gTimeChainState)*0.000001)
 	// Remove conflicting transactions from the mempool.;
 	GMemPool.RemoveTxSelf(blockConnecting.Txs)
+	GStemPool.RemoveTxSelf(blockConnecting.Txs)
 	// Update chainActive & related variables.
 	UpdateTip(param, indexNew)
+	// The block may confirm parents of some orphans, try them again.
+	processOrphansForConnectedBlock(param, &blockConnecting)
 	nTime6 := utils.GetMicrosTime()
 	gTimePostConnect += nTime6 - nTime1
 	gTimeTotal += nTime6 - nTime1
@@ -2155,7 +2159,7 @@ func UpdateTip(param *msg.BitcoinParams, pindexNew *core.BlockIndex) {
 	// New best block
 	//GMemPool.AddTransactionsUpdated(1)
 
-	//	TODO !!! add Parallel Programming boost::condition_variable
+	notifyTipChanged()
 	warningMessages := make([]string, 0)
 	if !IsInitialBlockDownload() {
 		nUpgraded := 0
@@ -2666,7 +2670,6 @@ func AddToBlockIndex(pblkHeader *core.BlockHeader) *core.BlockIndex {
 	// to avoid miners withholding blocks but broadcasting headers, to get a
 	// competitive advantage.
 	indexNew.SequenceID = 0
-	GChainState.MapBlockIndex.Data[hash] = indexNew
 	indexNew.BlockHash = hash
 
 	if miPrev, ok := GChainState.MapBlockIndex.Data[pblkHeader.HashPrevBlock]; ok {
@@ -2684,9 +2687,13 @@ func AddToBlockIndex(pblkHeader *core.BlockHeader) *core.BlockIndex {
 	}
 
 	indexNew.RaiseValidity(core.BlockValidTree)
+	// The index is only published once complete.
+	blockIndexLock.Lock()
+	GChainState.MapBlockIndex.Data[hash] = indexNew
 	if GIndexBestHeader == nil || GIndexBestHeader.ChainWork.Cmp(&indexNew.ChainWork) < 0 {
 		GIndexBestHeader = indexNew
 	}
+	blockIndexLock.Unlock()
 
 	gSetDirtyBlockIndex.AddItem(indexNew)
 	return indexNew
@@ -3777,7 +3784,7 @@ func AcceptToMemoryPoolWorker(params *msg.BitcoinParams, pool *mempool.TxMempool
 
 	// dummy backed store
 	backed := utxo.CoinsViewCache{}
-	view := utxo.CoinsViewCache{}
+	view := utxo.CoinsViewCache{CacheCoins: make(utxo.CacheCoins)}
 	view.Base = &backed
 
 	var valueIn utils.Amount
@@ -3785,8 +3792,15 @@ func AcceptToMemoryPoolWorker(params *msg.BitcoinParams, pool *mempool.TxMempool
 	func() {
 		pool.Lock()
 		defer pool.Unlock()
-		//viewMemPool := mempool.NewCoinsViewMemPool(GCoinsTip, pool)
-		//view.Base = viewMemPool
+		pools := []*mempool.TxMempool{pool}
+		// The stem transactions may spend the outputs of the memPool
+		// transactions.
+		if pool == GStemPool {
+			GMemPool.RLock()
+			defer GMemPool.RUnlock()
+			pools = append(pools, GMemPool)
+		}
+		view.Base = mempool.NewCoinsViewMemPool(GCoinsTip, pools...)
 
 		// Do we already have it?
 		length := len(ptx.Outs)
@@ -3857,13 +3871,11 @@ func AcceptToMemoryPoolWorker(params *msg.BitcoinParams, pool *mempool.TxMempool
 	valueOut := ptx.GetValueOut()
 	fees := int64(valueIn) - valueOut
 	// nModifiedFees includes any fee deltas from PrioritiseTransaction
-	modifiedFees := fees
-	//priorityDummy := float64(0)
-	//pool.ApplyDeltas(txid, priorityDummy, modifiedFees)
+	_, feeDelta := pool.ApplyDeltas(txid)
+	modifiedFees := fees + feeDelta
 
 	var inChainInputValue utils.Amount
 	priority := view.GetPriority(ptx, uint32(GChainActive.Height()), &inChainInputValue)
-	_ = priority
 	// Keep track of transactions that spend a coinbase, which we re-scan
 	// during reorgs to ensure COINBASE_MATURITY is still met.
 	spendsCoinbase := false
@@ -3876,6 +3888,7 @@ func AcceptToMemoryPoolWorker(params *msg.BitcoinParams, pool *mempool.TxMempool
 	}
 
 	entry := mempool.NewTxentry(tx, fees, acceptTime, GChainActive.Height()+1, lp, sigOpsCount, spendsCoinbase)
+	entry.SetStartingPriority(priority, GChainActive.Height(), inChainInputValue)
 	size := entry.TxSize
 
 	// Check that the transaction doesn't have an excessive number of
@@ -3889,8 +3902,17 @@ func AcceptToMemoryPoolWorker(params *msg.BitcoinParams, pool *mempool.TxMempool
 		return
 	}
 
+	maxMempool := utils.GetArg("-maxmempool", int64(policy.DefaultMaxMemPoolSize)) * 1000000
+	mempoolMinFee := pool.GetMinFee(maxMempool)
+	mempoolRejectFee := mempoolMinFee.GetFee(size)
+	if mempoolRejectFee > 0 && modifiedFees < mempoolRejectFee {
+		ret = state.Dos(0, false, core.RejectInsufficientFee, "mempool min fee not met",
+			false, fmt.Sprintf("%d < %d", fees, mempoolRejectFee))
+		return
+	}
+
 	//relaypriority := utils.GetBoolArg("-relaypriority", consensus.DefaultRelayPriority)
-	minFeeRate := gMinRelayTxFee.GetFee(size)
+	minFeeRate := GMinRelayTxFee.GetFee(size)
 	//allow := mempool.AllowFree(entry.GetPriority(uint(GChainActive.Height() + 1)))
 	//if relaypriority && modifiedFees < minFeeRate && !allow {
 	// Require that free transactions have sufficient priority to be
@@ -4496,179 +4518,164 @@ func AcceptToMemoryPoolWithTime(params *msg.BitcoinParams, mpool *mempool.TxMemp
 	return res
 }
 
-// LoadMempool Load the mempool from disk
-func LoadMempool(params *msg.BitcoinParams) bool {
+// MempoolFileName is the name of the file the memPool is dumped into.
+const MempoolFileName = "mempool.dat"
+
+// LoadMempool loads the memPool dumped into dataDir by DumpMempool.  The
+// transactions older than -mempoolexpiry are skipped, and the fee deltas are
+// applied whether or not their transactions are accepted again.  A missing
+// dump is not an error.
+func LoadMempool(params *msg.BitcoinParams, dataDir string) error {
 	expiryTimeout := (utils.GetArg("-mempoolexpiry", consensus.DefaultMemPoolExpiry)) * 60 * 60
 
-	fileStr, err := os.OpenFile(conf.GetDataPath()+"/mempool.dat", os.O_RDONLY, 0666)
+	file, err := os.Open(filepath.Join(dataDir, MempoolFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		fmt.Println("Failed to open mempool file from disk. Continuing anyway")
-		return false
+		return err
 	}
-	defer fileStr.Close()
-
-	now := time.Now() // todo C++:nMockTime
-	var count int
-	var failed int
-	var skipped int
+	defer file.Close()
+	r := bufio.NewReader(file)
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Failed to deserialize mempool data on disk:", err, ". Continuing anyway.")
-		}
-	}()
-
-	// read version firstly
-	version, err := utils.BinarySerializer.Uint32(fileStr, binary.LittleEndian)
+	version, err := utils.BinarySerializer.Uint32(r, binary.LittleEndian)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	if version != consensus.MemPoolDumpVersion {
-		return false
+		return fmt.Errorf("unknown mempool dump version %d", version)
 	}
 
-	num, err := utils.ReadVarInt(fileStr)
+	num, err := utils.ReadVarInt(r)
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	//var priorityDummy float64
-	for num > 0 {
-		num--
-		txPoolInfo, err := mempool.DeserializeInfo(fileStr)
+	now := time.Now().Unix()
+	var count, failed, skipped int
+	for ; num > 0; num-- {
+		txPoolInfo, err := mempool.DeserializeInfo(r)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		amountDelta := txPoolInfo.FeeDelta
-		if amountDelta != 0 {
-			//hashA := txPoolInfo.Tx.TxHash()
-			//GMemPool.PrioritiseTransaction(txPoolInfo.Tx.TxHash(), hashA.ToString(), priorityDummy, amountDelta)
+		if txPoolInfo.FeeDelta != 0 {
+			hash := txPoolInfo.Tx.TxHash()
+			if err := GMemPool.PrioritiseTransaction(hash, 0, txPoolInfo.FeeDelta); err != nil {
+				logs.Error("can't apply the fee delta of %s: %v", hash.ToString(), err)
+			}
 		}
 
+		if txPoolInfo.Time+expiryTimeout <= now {
+			skipped++
+			continue
+		}
 		vs := &core.ValidationState{}
-		if txPoolInfo.Time+expiryTimeout > int64(now.Second()) {
-			// todo LOCK(cs_main)
-
-			AcceptToMemoryPoolWithTime(params, GMemPool, vs, txPoolInfo.Tx, true, nil,
-				txPoolInfo.Time, nil, false, 0)
-
-			if vs.IsValid() {
-				count++
-			} else {
-				failed++
-			}
+		AcceptToMemoryPoolWithTime(params, GMemPool, vs, txPoolInfo.Tx, true, nil,
+			txPoolInfo.Time, nil, false, 0)
+		if vs.IsValid() {
+			count++
 		} else {
-			// timeout
-			skipped++
+			failed++
 		}
 
-		if ShutdownRequested() { // get shutdown signal
-			return false
+		if ShutdownRequested() {
+			return errors.New("loading the mempool interrupted by the shutdown")
 		}
+	}
 
-		size, err := utils.ReadVarInt(fileStr)
+	// the deltas of the transactions not in the memPool
+	size, err := utils.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < size; i++ {
+		var hash utils.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return err
+		}
+		amount, err := utils.BinarySerializer.Uint64(r, binary.LittleEndian)
 		if err != nil {
-			panic(err)
+			return err
 		}
-
-		var hash utils.Hash
-		mapDeltas := make(map[utils.Hash]utils.Amount)
-		for i := uint64(0); i < size; i++ {
-			_, err = io.ReadFull(fileStr, hash[:])
-			if err != nil {
-				panic(err)
-			}
-
-			amount, err := utils.BinarySerializer.Uint64(fileStr, binary.LittleEndian)
-			if err != nil {
-				panic(err)
-			}
-
-			mapDeltas[hash] = utils.Amount(amount)
+		if err := GMemPool.PrioritiseTransaction(hash, 0, int64(amount)); err != nil {
+			logs.Error("can't apply the fee delta of %s: %v", hash.ToString(), err)
 		}
-
-		//for hash, amount := range mapDeltas {
-		//GMemPool.PrioritiseTransaction(hash, hash.ToString(), priorityDummy, int64(amount))
-		//}
 	}
 
-	logs.Debug("Imported mempool transactions from disk: %d successes, %d failed, %d expired", count, failed, skipped)
-	return true
+	logs.Info("Imported mempool transactions from disk: %d successes, %d failed, %d expired", count, failed, skipped)
+	return nil
 }
 
-// DumpMempool Dump the mempool to disk
-func DumpMempool() {
-	start := time.Now().Second()
+// DumpMempool dumps the memPool and the fee deltas into dataDir, for
+// LoadMempool to load them at the next start.  The dump replaces the
+// previous one only once it is complete.
+func DumpMempool(dataDir string) error {
+	start := time.Now()
 
-	mapDeltas := make(map[utils.Hash]utils.Amount)
-	var info []*mempool.TxMempoolInfo
-	{
-		mapDeltas = make(map[utils.Hash]utils.Amount, len(GMemPool.PoolData))
-		GMemPool.Lock()
-		//for hash, feeDelta := range GMemPool.MapDeltas {
-		//	mapDeltas[hash] = feeDelta.Fee // todo confirm feeDelta.Fee or feedelta.PriorityDelta
-		//}
-		info = GMemPool.InfoAll()
-		GMemPool.Unlock()
+	deltas := GMemPool.GetDeltas()
+	mapDeltas := make(map[utils.Hash]utils.Amount, len(deltas))
+	for hash, delta := range deltas {
+		mapDeltas[hash] = utils.Amount(delta.FeeDelta)
 	}
+	info := GMemPool.InfoAll()
 
-	mid := time.Now().Second()
-
-	defer func() {
-		if r := recover(); r != nil {
-			logs.Debug("Failed to dump mempool:", r, " . Continuing anyway.")
-		}
-	}()
+	mid := time.Now()
 
-	fileStr, err := os.OpenFile(conf.GetDataPath()+"/mempool.dat.new", os.O_WRONLY, 0666)
+	path := filepath.Join(dataDir, MempoolFileName)
+	file, err := os.OpenFile(path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer fileStr.Close() // guarantee closing the opened file
-
-	err = utils.BinarySerializer.PutUint32(fileStr, binary.LittleEndian, uint32(consensus.MemPoolDumpVersion))
-	if err != nil {
-		panic(err)
+	w := bufio.NewWriter(file)
+	if err := writeMempool(w, info, mapDeltas); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
 	}
+	if err := os.Rename(path+".new", path); err != nil {
+		return err
+	}
+
+	logs.Debug("Dumped mempool: %v to copy, %v to dump", mid.Sub(start), time.Since(mid))
+	return nil
+}
 
-	err = utils.WriteVarInt(fileStr, uint64(len(info)))
+// writeMempool writes the memPool entries, then the fee deltas of the
+// transactions which are not in the memPool.
+func writeMempool(w io.Writer, info []*mempool.TxMempoolInfo, mapDeltas map[utils.Hash]utils.Amount) error {
+	err := utils.BinarySerializer.PutUint32(w, binary.LittleEndian, uint32(consensus.MemPoolDumpVersion))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	if err := utils.WriteVarInt(w, uint64(len(info))); err != nil {
+		return err
+	}
 	for _, item := range info {
-		err = item.Serialize(fileStr)
-		if err != nil {
-			panic(err)
+		if err := item.Serialize(w); err != nil {
+			return err
 		}
 		delete(mapDeltas, item.Tx.TxHash())
 	}
 
-	// write the size
-	err = utils.WriteVarInt(fileStr, uint64(len(mapDeltas)))
-	if err != nil {
-		panic(err)
+	if err := utils.WriteVarInt(w, uint64(len(mapDeltas))); err != nil {
+		return err
 	}
-	// write all members one by one within loop
 	for hash, amount := range mapDeltas {
-		_, err = fileStr.Write(hash.GetCloneBytes())
-		if err != nil {
-			panic(err)
+		if _, err := w.Write(hash[:]); err != nil {
+			return err
 		}
-
-		err = utils.BinarySerializer.PutUint64(fileStr, binary.LittleEndian, uint64(amount))
-		if err != nil {
-			panic(err)
+		if err := utils.BinarySerializer.PutUint64(w, binary.LittleEndian, uint64(amount)); err != nil {
+			return err
 		}
 	}
-
-	err = os.Rename(conf.GetDataPath()+"/mempool.dat.new", conf.GetDataPath()+"/mempool.dat")
-	if err != nil {
-		panic(err)
-	}
-	last := time.Now().Second()
-	logs.Debug("Dumped mempool: %ds to copy, %ds to dump\n", mid-start, last-mid)
+	return nil
 }
 
 // GuessVerificationProgress Guess how far we are in the verification process at the given block index
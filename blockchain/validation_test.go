@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestDumpLoadMempool(t *testing.T) {
+	memPool := GMemPool
+	defer func() {
+		GMemPool = memPool
+	}()
+	dataDir, err := ioutil.TempDir("", "mempooldump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	// Nothing was dumped yet.
+	GMemPool = mempool.NewTxMempool()
+	if err := LoadMempool(&msg.RegressionNetParams, dataDir); err != nil {
+		t.Fatalf("load without a dump: %v", err)
+	}
+
+	// The fee delta of a tx not in the memPool yet survives the restart, and
+	// a second dump replaces the first one.
+	hash := *utils.GetRandHash()
+	for _, delta := range []int64{5000, -2000} {
+		if err := GMemPool.PrioritiseTransaction(hash, 0, delta); err != nil {
+			t.Fatal(err)
+		}
+		if err := DumpMempool(dataDir); err != nil {
+			t.Fatalf("dump: %v", err)
+		}
+	}
+	GMemPool = mempool.NewTxMempool()
+	if err := LoadMempool(&msg.RegressionNetParams, dataDir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	deltas := GMemPool.GetDeltas()
+	if len(deltas) != 1 || deltas[hash].FeeDelta != 3000 {
+		t.Errorf("loaded fee deltas %v, want 3000 for %s", deltas, hash.ToString())
+	}
+}
@@ -40,6 +40,47 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "addpeeraddress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addpeeraddress", "1.2.3.4", 8333)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddPeerAddressCmd("1.2.3.4", 8333, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addpeeraddress","params":["1.2.3.4",8333],"id":1}`,
+			unmarshalled: &btcjson.AddPeerAddressCmd{
+				Address: "1.2.3.4",
+				Port:    8333,
+				Tried:   btcjson.Bool(false),
+			},
+		},
+		{
+			name: "addpeeraddress optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addpeeraddress", "1.2.3.4", 8333, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddPeerAddressCmd("1.2.3.4", 8333, btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addpeeraddress","params":["1.2.3.4",8333,true],"id":1}`,
+			unmarshalled: &btcjson.AddPeerAddressCmd{
+				Address: "1.2.3.4",
+				Port:    8333,
+				Tried:   btcjson.Bool(true),
+			},
+		},
+		{
+			name: "clearbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("clearbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewClearBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"clearbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ClearBannedCmd{},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -102,6 +143,49 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "generate",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generate", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateCmd(1, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generate","params":[1],"id":1}`,
+			unmarshalled: &btcjson.GenerateCmd{
+				NumBlocks: 1,
+				MaxTries:  btcjson.Uint64(1000000),
+			},
+		},
+		{
+			name: "generate optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generate", 1, 500)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateCmd(1, btcjson.Uint64(500))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generate","params":[1,500],"id":1}`,
+			unmarshalled: &btcjson.GenerateCmd{
+				NumBlocks: 1,
+				MaxTries:  btcjson.Uint64(500),
+			},
+		},
+		{
+			name: "generatetoaddress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetoaddress", 101, "1Address")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateToAddressCmd(101, "1Address", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetoaddress","params":[101,"1Address"],"id":1}`,
+			unmarshalled: &btcjson.GenerateToAddressCmd{
+				NumBlocks: 101,
+				Address:   "1Address",
+				MaxTries:  btcjson.Uint64(1000000),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -385,6 +469,48 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetInfoCmd{},
 		},
+		{
+			name: "getmempoolancestors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolancestors optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempooldescendants",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldescendants", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDescendantsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -398,6 +524,17 @@ func TestChainSvrCmds(t *testing.T) {
 				TxID: "txhash",
 			},
 		},
+		{
+			name: "getmempoolfeehistogram",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolfeehistogram")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolFeeHistogramCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getmempoolfeehistogram","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolFeeHistogramCmd{},
+		},
 		{
 			name: "getmempoolinfo",
 			newCmd: func() (interface{}, error) {
@@ -484,6 +621,32 @@ func TestChainSvrCmds(t *testing.T) {
 				Height: btcjson.Int(123),
 			},
 		},
+		{
+			name: "getnodeaddresses",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getnodeaddresses")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetNodeAddressesCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getnodeaddresses","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetNodeAddressesCmd{
+				Count: btcjson.Int32(1),
+			},
+		},
+		{
+			name: "getnodeaddresses optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getnodeaddresses", 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetNodeAddressesCmd(btcjson.Int32(10))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getnodeaddresses","params":[10],"id":1}`,
+			unmarshalled: &btcjson.GetNodeAddressesCmd{
+				Count: btcjson.Int32(10),
+			},
+		},
 		{
 			name: "getpeerinfo",
 			newCmd: func() (interface{}, error) {
@@ -685,6 +848,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListBannedCmd{},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -709,6 +883,21 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "0123", 0.0, 10000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("0123", 0.0, 10000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["0123",0,10000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				TxID:          "0123",
+				PriorityDelta: 0.0,
+				FeeDelta:      10000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -889,6 +1078,51 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: btcjson.Bool(false),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.0/8", btcjson.SBAdd)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.0/8", btcjson.SBAdd, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "10.0.0.0/8",
+				Command:  btcjson.SBAdd,
+				BanTime:  btcjson.Int64(0),
+				Absolute: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.1", btcjson.SBAdd, 1700000000, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.1", btcjson.SBAdd, btcjson.Int64(1700000000), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.1","add",1700000000,true],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "10.0.0.1",
+				Command:  btcjson.SBAdd,
+				BanTime:  btcjson.Int64(1700000000),
+				Absolute: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "setcoinbasecommitments",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setcoinbasecommitments", []string{"0123", "4567"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetCoinbaseCommitmentsCmd([]string{"0123", "4567"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setcoinbasecommitments","params":[["0123","4567"]],"id":1}`,
+			unmarshalled: &btcjson.SetCoinbaseCommitmentsCmd{
+				Commitments: []string{"0123", "4567"},
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -34,9 +34,7 @@ type GetBlockHeaderVerboseResult struct {
 type GetBlockVerboseResult struct {
 	Hash          string        `json:"hash"`
 	Confirmations uint64        `json:"confirmations"`
-	StrippedSize  int32         `json:"strippedsize"`
 	Size          int32         `json:"size"`
-	Weight        int32         `json:"weight"`
 	Height        int64         `json:"height"`
 	Version       int32         `json:"version"`
 	VersionHex    string        `json:"versionHex"`
@@ -118,6 +116,23 @@ type GetBlockChainInfoResult struct {
 	Bip9SoftForks        map[string]*Bip9SoftForkDescription `json:"bip9_softforks"`
 }
 
+// GetBestBlockResult models the data from the getbestblock command.
+//
+// NOTE: This is a btcsuite extension.
+type GetBestBlockResult struct {
+	Hash   string `json:"hash"`
+	Height int32  `json:"height"`
+}
+
+// GetChainTipsResult models the data of each tip returned by the getchaintips
+// command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
 // GetBlockTemplateResultTx models the transactions field of the
 // getblocktemplate command.
 type GetBlockTemplateResultTx struct {
@@ -128,6 +143,9 @@ type GetBlockTemplateResultTx struct {
 	Fee     int64  `json:"fee"`
 	SigOps  int64  `json:"sigops"`
 	Weight  int64  `json:"weight"`
+
+	// Strategy is only set when requested with showstrategy.
+	Strategy string `json:"strategy,omitempty"`
 }
 
 // GetBlockTemplateResultAux models the coinbaseaux field of the
@@ -199,6 +217,15 @@ type GetMempoolEntryResult struct {
 	Depends          []string `json:"depends"`
 }
 
+// GetMempoolFeeHistogramResult models a bucket of the data returned from the
+// getmempoolfeehistogram command.  Buckets are ordered by descending fee rate,
+// and Size is the total size of the transactions paying at least FeeRate but
+// less than the fee rate of the previous bucket.
+type GetMempoolFeeHistogramResult struct {
+	FeeRate float64 `json:"feerate"`
+	Size    int64   `json:"size"`
+}
+
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
@@ -246,27 +273,32 @@ type GetNetworkInfoResult struct {
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
-	ID             int32   `json:"id"`
-	Addr           string  `json:"addr"`
-	AddrLocal      string  `json:"addrlocal,omitempty"`
-	Services       string  `json:"services"`
-	RelayTxes      bool    `json:"relaytxes"`
-	LastSend       int64   `json:"lastsend"`
-	LastRecv       int64   `json:"lastrecv"`
-	BytesSent      uint64  `json:"bytessent"`
-	BytesRecv      uint64  `json:"bytesrecv"`
-	ConnTime       int64   `json:"conntime"`
-	TimeOffset     int64   `json:"timeoffset"`
-	PingTime       float64 `json:"pingtime"`
-	PingWait       float64 `json:"pingwait,omitempty"`
-	Version        uint32  `json:"version"`
-	SubVer         string  `json:"subver"`
-	Inbound        bool    `json:"inbound"`
-	StartingHeight int32   `json:"startingheight"`
-	CurrentHeight  int32   `json:"currentheight,omitempty"`
-	BanScore       int32   `json:"banscore"`
-	FeeFilter      int64   `json:"feefilter"`
-	SyncNode       bool    `json:"syncnode"`
+	ID              int32             `json:"id"`
+	Addr            string            `json:"addr"`
+	AddrLocal       string            `json:"addrlocal,omitempty"`
+	Services        string            `json:"services"`
+	RelayTxes       bool              `json:"relaytxes"`
+	LastSend        int64             `json:"lastsend"`
+	LastRecv        int64             `json:"lastrecv"`
+	BytesSent       uint64            `json:"bytessent"`
+	BytesRecv       uint64            `json:"bytesrecv"`
+	ConnTime        int64             `json:"conntime"`
+	TimeOffset      int64             `json:"timeoffset"`
+	PingTime        float64           `json:"pingtime"`
+	PingWait        float64           `json:"pingwait,omitempty"`
+	Version         uint32            `json:"version"`
+	SubVer          string            `json:"subver"`
+	Inbound         bool              `json:"inbound"`
+	StartingHeight  int32             `json:"startingheight"`
+	CurrentHeight   int32             `json:"currentheight,omitempty"`
+	BanScore        int32             `json:"banscore"`
+	FeeFilter       int64             `json:"feefilter"`
+	SyncNode        bool              `json:"syncnode"`
+	MappedAS        uint32            `json:"mapped_as,omitempty"`
+	ConnectionType  string            `json:"connection_type"`
+	Permissions     []string          `json:"permissions"`
+	BytesSentPerMsg map[string]uint64 `json:"bytessent_per_msg"`
+	BytesRecvPerMsg map[string]uint64 `json:"bytesrecv_per_msg"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -303,11 +335,78 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// GetTxOutSetInfoResult models the data from the gettxoutsetinfo command.
+type GetTxOutSetInfoResult struct {
+	Height         int32   `json:"height"`
+	BestBlock      string  `json:"bestblock"`
+	Transactions   int64   `json:"transactions"`
+	TxOuts         int64   `json:"txouts"`
+	BogoSize       int64   `json:"bogosize"`
+	HashSerialized string  `json:"hash_serialized"`
+	DiskSize       int64   `json:"disk_size"`
+	TotalAmount    float64 `json:"total_amount"`
+}
+
+// UTXOResult models an unspent output of the getutxos REST query.
+type UTXOResult struct {
+	Height       uint32             `json:"height"`
+	Value        float64            `json:"value"`
+	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
+// GetUTXOsResult models the data returned from the getutxos REST query.
+// Bitmap holds one character per queried outpoint, '1' if it is unspent and
+// '0' otherwise.
+type GetUTXOsResult struct {
+	ChainHeight  int32        `json:"chainHeight"`
+	ChainTipHash string       `json:"chaintipHash"`
+	Bitmap       string       `json:"bitmap"`
+	UTXOs        []UTXOResult `json:"utxos"`
+}
+
+// AddPeerAddressResult models the data returned from the addpeeraddress
+// command.
+type AddPeerAddressResult struct {
+	Success bool `json:"success"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv  uint64             `json:"totalbytesrecv"`
+	TotalBytesSent  uint64             `json:"totalbytessent"`
+	TimeMillis      int64              `json:"timemillis"`
+	UploadTarget    UploadTargetResult `json:"uploadtarget"`
+	InboundEvicted  uint64             `json:"inboundevicted"`
+	InboundRejected uint64             `json:"inboundrejected"`
+}
+
+// UploadTargetResult models the upload target returned from the getnettotals
+// command.
+type UploadTargetResult struct {
+	Timeframe             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks bool   `json:"serve_historical_blocks"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"`
+}
+
+// GetNodeAddressesResult models the data of an address returned from the
+// getnodeaddresses command.
+type GetNodeAddressesResult struct {
+	Time     int64  `json:"time"`
+	Services uint64 `json:"services"`
+	Address  string `json:"address"`
+	Port     uint16 `json:"port"`
+}
+
+// ListBannedResult models the data of a ban returned from the listbanned
+// command.
+type ListBannedResult struct {
+	Address     string `json:"address"`
+	BannedUntil int64  `json:"banned_until"`
+	BanCreated  int64  `json:"ban_created"`
+	BanReason   string `json:"ban_reason"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
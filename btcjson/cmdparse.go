@@ -104,6 +104,69 @@ func populateDefaults(numParams int, info *methodInfo, rv reflect.Value) {
 	}
 }
 
+// unmarshalParam unmarshals the passed parameter into the struct field at
+// index i.
+func unmarshalParam(param json.RawMessage, i int, rt reflect.Type, rv reflect.Value) error {
+	rvf := rv.Field(i)
+	// Unmarshal the parameter into the struct field.
+	concreteVal := rvf.Addr().Interface()
+	if err := json.Unmarshal(param, &concreteVal); err != nil {
+		// The most common error is the wrong type, so
+		// explicitly detect that error and make it nicer.
+		fieldName := strings.ToLower(rt.Field(i).Name)
+		if jerr, ok := err.(*json.UnmarshalTypeError); ok {
+			str := fmt.Sprintf("parameter #%d '%s' must "+
+				"be type %v (got %v)", i+1, fieldName,
+				jerr.Type, jerr.Value)
+			return makeError(ErrInvalidType, str)
+		}
+
+		// Fallback to showing the underlying error.
+		str := fmt.Sprintf("parameter #%d '%s' failed to "+
+			"unmarshal: %v", i+1, fieldName, err)
+		return makeError(ErrInvalidType, str)
+	}
+
+	return nil
+}
+
+// unmarshalNamedParams unmarshals parameters passed by name into the struct
+// fields with the same lowercased name.  Required fields must be present,
+// missing optional fields get their default value, and names which do not
+// belong to any field are rejected.
+func unmarshalNamedParams(params map[string]json.RawMessage, info *methodInfo, rt reflect.Type, rv reflect.Value) error {
+	known := make(map[string]struct{}, info.maxParams)
+	for i := 0; i < info.maxParams; i++ {
+		fieldName := strings.ToLower(rt.Field(i).Name)
+		known[fieldName] = struct{}{}
+		param, ok := params[fieldName]
+		if !ok {
+			if i < info.numReqParams {
+				str := fmt.Sprintf("missing required parameter "+
+					"'%s'", fieldName)
+				return makeError(ErrNumParams, str)
+			}
+			if defaultVal, ok := info.defaults[i]; ok {
+				rv.Field(i).Set(defaultVal)
+			}
+			continue
+		}
+
+		if err := unmarshalParam(param, i, rt, rv); err != nil {
+			return err
+		}
+	}
+
+	for name := range params {
+		if _, ok := known[name]; !ok {
+			str := fmt.Sprintf("unknown parameter '%s'", name)
+			return makeError(ErrNumParams, str)
+		}
+	}
+
+	return nil
+}
+
 // UnmarshalCmd unmarshals a JSON-RPC request into a suitable concrete command
 // so long as the method type contained within the marshalled request is
 // registered.
@@ -120,6 +183,15 @@ func UnmarshalCmd(r *Request) (interface{}, error) {
 	rvp := reflect.New(rt)
 	rv := rvp.Elem()
 
+	// Parameters passed by name are matched against the lowercased names of
+	// the struct fields.
+	if r.NamedParams != nil {
+		if err := unmarshalNamedParams(r.NamedParams, &info, rt, rv); err != nil {
+			return nil, err
+		}
+		return rvp.Interface(), nil
+	}
+
 	// Ensure the number of parameters are correct.
 	numParams := len(r.Params)
 	if err := checkNumParams(numParams, &info); err != nil {
@@ -129,24 +201,8 @@ func UnmarshalCmd(r *Request) (interface{}, error) {
 	// Loop through each of the struct fields and unmarshal the associated
 	// parameter into them.
 	for i := 0; i < numParams; i++ {
-		rvf := rv.Field(i)
-		// Unmarshal the parameter into the struct field.
-		concreteVal := rvf.Addr().Interface()
-		if err := json.Unmarshal(r.Params[i], &concreteVal); err != nil {
-			// The most common error is the wrong type, so
-			// explicitly detect that error and make it nicer.
-			fieldName := strings.ToLower(rt.Field(i).Name)
-			if jerr, ok := err.(*json.UnmarshalTypeError); ok {
-				str := fmt.Sprintf("parameter #%d '%s' must "+
-					"be type %v (got %v)", i+1, fieldName,
-					jerr.Type, jerr.Value)
-				return nil, makeError(ErrInvalidType, str)
-			}
-
-			// Fallback to showing the underlying error.
-			str := fmt.Sprintf("parameter #%d '%s' failed to "+
-				"unmarshal: %v", i+1, fieldName, err)
-			return nil, makeError(ErrInvalidType, str)
+		if err := unmarshalParam(r.Params[i], i, rt, rv); err != nil {
+			return nil, err
 		}
 	}
 
@@ -498,6 +498,43 @@ func TestUnmarshalCmdErrors(t *testing.T) {
 			},
 			err: btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
 		},
+		{
+			name: "missing required named parameter",
+			request: btcjson.Request{
+				Jsonrpc: "2.0",
+				Method:  "getblock",
+				NamedParams: map[string]json.RawMessage{
+					"verbose": []byte("false"),
+				},
+				ID: nil,
+			},
+			err: btcjson.Error{ErrorCode: btcjson.ErrNumParams},
+		},
+		{
+			name: "unknown named parameter",
+			request: btcjson.Request{
+				Jsonrpc: "2.0",
+				Method:  "getblock",
+				NamedParams: map[string]json.RawMessage{
+					"hash":  []byte(`"123"`),
+					"bogus": []byte("1"),
+				},
+				ID: nil,
+			},
+			err: btcjson.Error{ErrorCode: btcjson.ErrNumParams},
+		},
+		{
+			name: "invalid type for a named parameter",
+			request: btcjson.Request{
+				Jsonrpc: "2.0",
+				Method:  "getblock",
+				NamedParams: map[string]json.RawMessage{
+					"hash": []byte("1"),
+				},
+				ID: nil,
+			},
+			err: btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -517,3 +554,27 @@ func TestUnmarshalCmdErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestUnmarshalCmdNamedParams ensures parameters passed by name are assigned
+// to the matching fields and missing optional ones get their defaults.
+func TestUnmarshalCmdNamedParams(t *testing.T) {
+	t.Parallel()
+
+	var request btcjson.Request
+	marshalled := `{"jsonrpc":"2.0","method":"getblock","params":{"verbosetx":true,"hash":"123"},"id":1}`
+	if err := json.Unmarshal([]byte(marshalled), &request); err != nil {
+		t.Fatalf("unexpected error unmarshalling request: %v", err)
+	}
+	cmd, err := btcjson.UnmarshalCmd(&request)
+	if err != nil {
+		t.Fatalf("unexpected error unmarshalling command: %v", err)
+	}
+	want := &btcjson.GetBlockCmd{
+		Hash:      "123",
+		Verbose:   btcjson.Bool(true),
+		VerboseTx: btcjson.Bool(true),
+	}
+	if !reflect.DeepEqual(cmd, want) {
+		t.Errorf("unexpected command - got %+v, want %+v", cmd, want)
+	}
+}
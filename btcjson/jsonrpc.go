@@ -5,6 +5,7 @@
 package btcjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -71,6 +72,57 @@ type Request struct {
 	Method  string            `json:"method"`
 	Params  []json.RawMessage `json:"params"`
 	ID      interface{}       `json:"id"`
+
+	// NamedParams holds the parameters of a request which passed them by
+	// name in a JSON object instead of by position.  It is nil otherwise.
+	NamedParams map[string]json.RawMessage `json:"-"`
+
+	// hasID records whether an unmarshalled request carried an id member,
+	// which is what tells JSON-RPC 2.0 calls and notifications apart.
+	hasID bool
+}
+
+// UnmarshalJSON unmarshals a raw JSON-RPC request.  The params member may be
+// either an array of positional parameters or an object of named ones.
+//
+// This is part of the json.Unmarshaler interface.
+func (r *Request) UnmarshalJSON(b []byte) error {
+	type request Request
+	aux := struct {
+		*request
+		Params json.RawMessage `json:"params"`
+	}{request: (*request)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	_, r.hasID = members["id"]
+
+	r.Params = nil
+	r.NamedParams = nil
+	params := bytes.TrimSpace(aux.Params)
+	switch {
+	case len(params) == 0 || bytes.Equal(params, []byte("null")):
+	case params[0] == '{':
+		return json.Unmarshal(params, &r.NamedParams)
+	default:
+		return json.Unmarshal(params, &r.Params)
+	}
+	return nil
+}
+
+// IsNotification returns whether the request is a notification, which is
+// processed without sending a response.  JSON-RPC 2.0 notifications are
+// requests without an id member while 1.0 ones have a null id.
+func (r *Request) IsNotification() bool {
+	if r.Jsonrpc == "2.0" {
+		return !r.hasID
+	}
+	return r.ID == nil
 }
 
 // NewRequest returns a new JSON-RPC 1.0 request object given the provided id,
@@ -148,3 +200,35 @@ func MarshalResponse(id interface{}, result interface{}, rpcErr *RPCError) ([]by
 	}
 	return json.Marshal(&response)
 }
+
+// Response2 is the general form of a JSON-RPC 2.0 response.  Unlike 1.0
+// responses, exactly one of the result and error members is present.
+type Response2 struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      *interface{}    `json:"id"`
+}
+
+// MarshalResponse2 marshals the passed id, result, and RPCError to a JSON-RPC
+// 2.0 response byte slice.  The result is omitted when rpcErr is not nil.
+func MarshalResponse2(id interface{}, result interface{}, rpcErr *RPCError) ([]byte, error) {
+	if !IsValidIDType(id) {
+		str := fmt.Sprintf("the id of type '%T' is invalid", id)
+		return nil, makeError(ErrInvalidType, str)
+	}
+
+	response := Response2{
+		Jsonrpc: "2.0",
+		Error:   rpcErr,
+		ID:      &id,
+	}
+	if rpcErr == nil {
+		marshalledResult, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		response.Result = marshalledResult
+	}
+	return json.Marshal(&response)
+}
@@ -98,6 +98,113 @@ func TestMarshalResponse(t *testing.T) {
 	}
 }
 
+// TestMarshalResponse2 ensures the MarshalResponse2 function only includes
+// one of the result and error members.
+func TestMarshalResponse2(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		id       interface{}
+		result   interface{}
+		jsonErr  *btcjson.RPCError
+		expected []byte
+	}{
+		{
+			name:     "ordinary bool result with no error",
+			id:       1,
+			result:   true,
+			expected: []byte(`{"jsonrpc":"2.0","result":true,"id":1}`),
+		},
+		{
+			name:     "null result with no error",
+			id:       "abc",
+			result:   nil,
+			expected: []byte(`{"jsonrpc":"2.0","result":null,"id":"abc"}`),
+		},
+		{
+			name:     "error with null id",
+			id:       nil,
+			jsonErr:  btcjson.ErrRPCInvalidRequest,
+			expected: []byte(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request"},"id":null}`),
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		marshalled, err := btcjson.MarshalResponse2(test.id, test.result, test.jsonErr)
+		if err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(marshalled, test.expected) {
+			t.Errorf("Test #%d (%s) mismatched result - got %s, "+
+				"want %s", i, test.name, marshalled,
+				test.expected)
+		}
+	}
+}
+
+// TestRequestUnmarshal ensures requests with positional and named parameters
+// unmarshal as expected and notifications are detected.
+func TestRequestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		marshalled   string
+		params       int
+		namedParams  int
+		notification bool
+	}{
+		{
+			name:       "1.0 request",
+			marshalled: `{"jsonrpc":"1.0","method":"getblockhash","params":[1],"id":1}`,
+			params:     1,
+		},
+		{
+			name:         "1.0 notification",
+			marshalled:   `{"jsonrpc":"1.0","method":"getblockhash","params":[1],"id":null}`,
+			params:       1,
+			notification: true,
+		},
+		{
+			name:        "2.0 request with named params",
+			marshalled:  `{"jsonrpc":"2.0","method":"getblockhash","params":{"index":1},"id":null}`,
+			namedParams: 1,
+		},
+		{
+			name:         "2.0 notification",
+			marshalled:   `{"jsonrpc":"2.0","method":"getblockcount"}`,
+			notification: true,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		var request btcjson.Request
+		if err := json.Unmarshal([]byte(test.marshalled), &request); err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if len(request.Params) != test.params ||
+			len(request.NamedParams) != test.namedParams {
+
+			t.Errorf("Test #%d (%s) mismatched params - got %d "+
+				"positional and %d named", i, test.name,
+				len(request.Params), len(request.NamedParams))
+		}
+		if request.IsNotification() != test.notification {
+			t.Errorf("Test #%d (%s) mismatched notification - got "+
+				"%v, want %v", i, test.name,
+				request.IsNotification(), test.notification)
+		}
+	}
+}
+
 // TestMiscErrors tests a few error conditions not covered elsewhere.
 func TestMiscErrors(t *testing.T) {
 	t.Parallel()
@@ -2,8 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/rpcclient"
+	"github.com/peterh/liner"
 )
 
 const (
@@ -18,18 +18,15 @@ const (
 	listCmdMessage  = "Specify -l to list available commands"
 )
 
-// commandUsage display the usage for a specific command.
-func commandUsage(method string) {
+// commandUsage returns the usage for a specific command.
+func commandUsage(method string) string {
 	usage, err := btcjson.MethodUsageText(method)
 	if err != nil {
 		// This should never happen since the method was already checked
 		// before calling this function, but be safe.
-		fmt.Fprintln(os.Stderr, "Failed to obtain command usage:", err)
-		return
+		return fmt.Sprintf("Failed to obtain command usage: %v", err)
 	}
-
-	fmt.Fprintln(os.Stderr, "Usage:")
-	fmt.Fprintf(os.Stderr, "  %s\n", usage)
+	return fmt.Sprintf("Usage:\n  %s", usage)
 }
 
 // usage displays the general usage when the help flag is not displayed and
@@ -51,36 +48,47 @@ func main() {
 	if err != nil {
 		os.Exit(1)
 	}
-	if len(args) < 1 {
+	if len(args) < 1 && !cfg.Interactive {
 		usage("No command specified")
 		os.Exit(1)
 	}
 
-	// Ensure the specified method identifies a valid registered command and
-	// is one of the usable types.
-	method := args[0]
-	usageFlags, err := btcjson.MethodUsageFlags(method)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unrecognized command '%s'\n", method)
-		fmt.Fprintln(os.Stderr, listCmdMessage)
+	// The standard input is shared by the password, the parameters read
+	// from it and the commands of a non-interactive shell.
+	bio := bufio.NewReader(os.Stdin)
+	if cfg.StdinRPCPass {
+		cfg.RPCPassword, err = readRPCPassword(bio)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the RPC password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.RPCUser == "" && cfg.RPCCookie == "" {
+		fmt.Fprintln(os.Stderr, "No RPC user or cookie file specified")
+		fmt.Fprintln(os.Stderr, showHelpMessage)
 		os.Exit(1)
 	}
-	if usageFlags&unusableFlags != 0 {
-		fmt.Fprintf(os.Stderr, "The '%s' command can only be used via "+
-			"websockets\n", method)
-		fmt.Fprintln(os.Stderr, listCmdMessage)
+
+	client, err := newRPCClient(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	defer client.Shutdown()
+
+	if cfg.Interactive {
+		if err := runShell(client, cfg, bio); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Convert remaining command line args to a slice of interface values
-	// to be passed along as parameters to new command creation function.
-	//
 	// Since some commands, such as submitblock, can involve data which is
 	// too large for the Operating System to allow as a normal command line
 	// parameter, support using '-' as an argument to allow the argument
 	// to be read from a stdin pipe.
-	bio := bufio.NewReader(os.Stdin)
-	params := make([]interface{}, 0, len(args[1:]))
+	params := make([]string, 0, len(args[1:]))
 	for _, arg := range args[1:] {
 		if arg == "-" {
 			param, err := bio.ReadString('\n')
@@ -102,6 +110,57 @@ func main() {
 		params = append(params, arg)
 	}
 
+	if err := runCommand(client, cfg.Format, args[0], params); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// readRPCPassword reads the RPC password from the first line of the standard
+// input, prompting for it without echo when the input is a terminal.
+func readRPCPassword(bio *bufio.Reader) (string, error) {
+	if isTerminal(os.Stdin) {
+		line := liner.NewLiner()
+		defer line.Close()
+		return line.PasswordPrompt("RPC password: ")
+	}
+	pass, err := bio.ReadString('\n')
+	if err != nil && (err != io.EOF || len(pass) == 0) {
+		return "", err
+	}
+	return strings.TrimRight(pass, "\r\n"), nil
+}
+
+// isTerminal returns whether f is a terminal rather than a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runCommand sends the method with its parameters to the RPC server and
+// prints the result in the given format.  The error returned is ready to be
+// shown to the user, with the usage of the command when the parameters are
+// wrong.
+func runCommand(client *rpcclient.Client, format, method string, args []string) error {
+	// Ensure the specified method identifies a valid registered command and
+	// is one of the usable types.
+	usageFlags, err := btcjson.MethodUsageFlags(method)
+	if err != nil {
+		return fmt.Errorf("Unrecognized command '%s'\n%s", method,
+			listCmdMessage)
+	}
+	if usageFlags&unusableFlags != 0 {
+		return fmt.Errorf("The '%s' command can only be used via "+
+			"websockets\n%s", method, listCmdMessage)
+	}
+
+	// Convert the args to a slice of interface values to be passed along
+	// as parameters to new command creation function.
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		params[i] = arg
+	}
+
 	// Attempt to create the appropriate command using the arguments
 	// provided by the user.
 	cmd, err := btcjson.NewCmd(method, params...)
@@ -111,57 +170,22 @@ func main() {
 		// NewCmd function is only supposed to return errors of that
 		// type.
 		if jerr, ok := err.(btcjson.Error); ok {
-			fmt.Fprintf(os.Stderr, "%s command: %v (code: %s)\n",
-				method, err, jerr.ErrorCode)
-			commandUsage(method)
-			os.Exit(1)
+			return fmt.Errorf("%s command: %v (code: %s)\n%s",
+				method, err, jerr.ErrorCode, commandUsage(method))
 		}
 
 		// The error is not a btcjson.Error and this really should not
 		// happen.  Nevertheless, fallback to just showing the error
 		// if it should happen due to a bug in the package.
-		fmt.Fprintf(os.Stderr, "%s command: %v\n", method, err)
-		commandUsage(method)
-		os.Exit(1)
-	}
-
-	// Marshal the command into a JSON-RPC byte slice in preparation for
-	// sending it to the RPC server.
-	marshalledJSON, err := btcjson.MarshalCmd(1, cmd)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return fmt.Errorf("%s command: %v\n%s", method, err,
+			commandUsage(method))
 	}
 
 	// Send the JSON-RPC request to the server using the user-specified
 	// connection configuration.
-	result, err := sendPostRequest(marshalledJSON, cfg)
+	result, err := client.SendCmd(cmd)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
-
-	// Choose how to display the result based on its type.
-	strResult := string(result)
-	if strings.HasPrefix(strResult, "{") || strings.HasPrefix(strResult, "[") {
-		var dst bytes.Buffer
-		if err := json.Indent(&dst, result, "", "  "); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to format result: %v",
-				err)
-			os.Exit(1)
-		}
-		fmt.Println(dst.String())
-
-	} else if strings.HasPrefix(strResult, `"`) {
-		var str string
-		if err := json.Unmarshal(result, &str); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to unmarshal result: %v",
-				err)
-			os.Exit(1)
-		}
-		fmt.Println(str)
-
-	} else if strResult != "null" {
-		fmt.Println(strResult)
+		return err
 	}
+	return printResult(os.Stdout, result, format)
 }
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/btcboost/copernicus/btcjson"
 	"github.com/btcboost/copernicus/utils"
@@ -99,6 +100,7 @@ type config struct {
 	RPCPassword   string `short:"P" long:"rpcpass" default-mask:"-" description:"RPC password"`
 	RPCServer     string `short:"s" long:"rpcserver" description:"RPC server to connect to"`
 	RPCCert       string `short:"c" long:"rpccert" description:"RPC server certificate chain for validation"`
+	RPCCookie     string `long:"rpccookie" description:"Authenticate with the cookie file the node writes its generated credentials to when no RPC user is set"`
 	NoTLS         bool   `long:"notls" description:"Disable TLS"`
 	Proxy         string `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyUser     string `long:"proxyuser" description:"Username for proxy server"`
@@ -107,6 +109,12 @@ type config struct {
 	SimNet        bool   `long:"simnet" description:"Connect to the simulation test network"`
 	TLSSkipVerify bool   `long:"skipverify" description:"Do not verify tls certificates (not recommended!)"`
 	Wallet        bool   `long:"wallet" description:"Connect to wallet"`
+
+	Interactive  bool          `short:"i" long:"interactive" description:"Start an interactive shell sending the commands typed in"`
+	Wait         bool          `long:"wait" description:"Retry until the RPC server can be reached"`
+	WaitTimeout  time.Duration `long:"waittimeout" description:"Give up waiting for the RPC server after this duration, none by default"`
+	Format       string        `short:"f" long:"format" description:"Output format of the results: raw, pretty or table"`
+	StdinRPCPass bool          `long:"stdinrpcpass" description:"Read the RPC password from the first line of standard input, prompting for it on a terminal"`
 }
 
 // normalizeAddress returns addr with the passed default port appended if
@@ -173,6 +181,7 @@ func loadConfig() (*config, []string, error) {
 		ConfigFile: defaultConfigFile,
 		RPCServer:  defaultRPCServer,
 		RPCCert:    defaultRPCCertFile,
+		Format:     formatPretty,
 	}
 
 	// Pre-parse the command line options to see if an alternative config
@@ -262,6 +271,14 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if !validFormat(cfg.Format) {
+		err := fmt.Errorf("%s: unknown output format %q -- choose one "+
+			"of %s", "loadConfig", cfg.Format,
+			strings.Join(outputFormats, ", "))
+		fmt.Fprintln(os.Stderr, err)
+		return nil, nil, err
+	}
+
 	// Override the RPC certificate if the --wallet flag was specified and
 	// the user did not specify one.
 	if cfg.Wallet && cfg.RPCCert == defaultRPCCertFile {
@@ -270,6 +287,9 @@ func loadConfig() (*config, []string, error) {
 
 	// Handle environment variable expansion in the RPC certificate path.
 	cfg.RPCCert = cleanAndExpandPath(cfg.RPCCert)
+	if cfg.RPCCookie != "" {
+		cfg.RPCCookie = cleanAndExpandPath(cfg.RPCCookie)
+	}
 
 	// Add default port to RPC server based on --testnet and --wallet flags
 	// if needed.
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// The output formats of the results.
+const (
+	// formatRaw prints results the way the server sent them.
+	formatRaw = "raw"
+
+	// formatPretty indents objects and arrays, and prints strings without
+	// their quotes.
+	formatPretty = "pretty"
+
+	// formatTable prints lists of objects as a table with a column per
+	// field, and objects as a table of their fields.
+	formatTable = "table"
+)
+
+// outputFormats are the names of the supported output formats.
+var outputFormats = []string{formatRaw, formatPretty, formatTable}
+
+// validFormat returns whether format names a supported output format.
+func validFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// printResult writes the result of a command to w in the given format.
+// Results which have no table form, such as numbers, are printed pretty by
+// the table format.
+func printResult(w io.Writer, result json.RawMessage, format string) error {
+	result = bytes.TrimSpace(result)
+	if len(result) == 0 || string(result) == "null" {
+		return nil
+	}
+
+	switch format {
+	case formatRaw:
+		_, err := fmt.Fprintln(w, string(result))
+		return err
+
+	case formatTable:
+		ok, err := printTable(w, result)
+		if ok || err != nil {
+			return err
+		}
+	}
+	return printPretty(w, result)
+}
+
+// printPretty writes result indented, or unquoted for strings.
+func printPretty(w io.Writer, result json.RawMessage) error {
+	switch result[0] {
+	case '{', '[':
+		var dst bytes.Buffer
+		if err := json.Indent(&dst, result, "", "  "); err != nil {
+			return fmt.Errorf("failed to format result: %v", err)
+		}
+		_, err := fmt.Fprintln(w, dst.String())
+		return err
+
+	case '"':
+		var str string
+		if err := json.Unmarshal(result, &str); err != nil {
+			return fmt.Errorf("failed to unmarshal result: %v", err)
+		}
+		_, err := fmt.Fprintln(w, str)
+		return err
+	}
+	_, err := fmt.Fprintln(w, string(result))
+	return err
+}
+
+// printTable writes result as a table, and returns false when it has no
+// table form.
+//
+// A list of objects has a row per object and a column per field.  An object
+// of objects, such as the verbose getrawmempool result, has a row per member
+// with the member name in the first column.  Any other object has a row per
+// field.  A list of other values has a row per value.
+func printTable(w io.Writer, result json.RawMessage) (bool, error) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	switch result[0] {
+	case '[':
+		var rows []json.RawMessage
+		if err := json.Unmarshal(result, &rows); err != nil {
+			return false, err
+		}
+		if len(rows) == 0 {
+			return true, nil
+		}
+		if !allObjects(rows) {
+			for _, row := range rows {
+				fmt.Fprintln(tw, cellText(row))
+			}
+			return true, tw.Flush()
+		}
+		if err := writeObjectRows(tw, nil, rows); err != nil {
+			return false, err
+		}
+		return true, tw.Flush()
+
+	case '{':
+		names, values, err := orderedFields(result)
+		if err != nil {
+			return false, err
+		}
+		if len(values) > 0 && allObjects(values) {
+			if err := writeObjectRows(tw, names, values); err != nil {
+				return false, err
+			}
+			return true, tw.Flush()
+		}
+		for i, name := range names {
+			fmt.Fprintf(tw, "%s\t%s\n", name, cellText(values[i]))
+		}
+		return true, tw.Flush()
+	}
+	return false, nil
+}
+
+// writeObjectRows writes a header of the union of the fields of the objects,
+// in the order they first appear, and a row per object.  When keys is set,
+// the rows start with the key of their object.
+func writeObjectRows(tw io.Writer, keys []string, objects []json.RawMessage) error {
+	var columns []string
+	seen := make(map[string]bool)
+	rows := make([]map[string]json.RawMessage, len(objects))
+	for i, object := range objects {
+		names, values, err := orderedFields(object)
+		if err != nil {
+			return err
+		}
+		rows[i] = make(map[string]json.RawMessage, len(names))
+		for j, name := range names {
+			rows[i][name] = values[j]
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+
+	header := columns
+	if keys != nil {
+		header = append([]string{""}, columns...)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i, row := range rows {
+		cells := make([]string, 0, len(header))
+		if keys != nil {
+			cells = append(cells, keys[i])
+		}
+		for _, column := range columns {
+			cells = append(cells, cellText(row[column]))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return nil
+}
+
+// orderedFields returns the names and values of the fields of a JSON object
+// in the order the server sent them.
+func orderedFields(object json.RawMessage) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	var values []json.RawMessage
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		name, ok := token.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected object key %v", token)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+	return names, values, nil
+}
+
+// allObjects returns whether all the values are JSON objects.
+func allObjects(values []json.RawMessage) bool {
+	for _, value := range values {
+		value = bytes.TrimSpace(value)
+		if len(value) == 0 || value[0] != '{' {
+			return false
+		}
+	}
+	return true
+}
+
+// cellText returns the text of a value in a table cell: strings unquoted,
+// missing values empty and compact JSON for anything else.
+func cellText(value json.RawMessage) string {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	if value[0] == '"' {
+		var str string
+		if json.Unmarshal(value, &str) == nil {
+			return strings.NewReplacer("\t", " ", "\n", " ").Replace(str)
+		}
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, value) != nil {
+		return string(value)
+	}
+	return compact.String()
+}
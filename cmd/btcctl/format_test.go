@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPrintResult(t *testing.T) {
+	tests := []struct {
+		result string
+		format string
+		output string
+	}{
+		// Nothing is printed for empty results.
+		{"", formatPretty, ""},
+		{"null", formatTable, ""},
+
+		{`{"a": 1}`, formatRaw, "{\"a\": 1}\n"},
+		{`"text"`, formatRaw, "\"text\"\n"},
+
+		{`"text"`, formatPretty, "text\n"},
+		{"42", formatPretty, "42\n"},
+		{`{"a":1,"b":[1,2]}`, formatPretty, "{\n  \"a\": 1,\n  \"b\": [\n    1,\n    2\n  ]\n}\n"},
+
+		// Results without a table form are printed pretty.
+		{"42", formatTable, "42\n"},
+		{`"text"`, formatTable, "text\n"},
+		{" true ", formatTable, "true\n"},
+	}
+	for _, test := range tests {
+		var w bytes.Buffer
+		if err := printResult(&w, json.RawMessage(test.result), test.format); err != nil {
+			t.Errorf("%s as %s: %v", test.result, test.format, err)
+			continue
+		}
+		if w.String() != test.output {
+			t.Errorf("%s as %s: printed %q, want %q", test.result, test.format, w.String(), test.output)
+		}
+	}
+
+	var w bytes.Buffer
+	if err := printResult(&w, json.RawMessage("{bad"), formatPretty); err == nil {
+		t.Error("malformed result printed")
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		output string
+	}{
+		{
+			"empty list",
+			"[]",
+			"",
+		},
+		{
+			"list of values",
+			`["a", 1, null, {"x":1}, [1, 2]]`,
+			"a\n1\n\n{\"x\":1}\n[1,2]\n",
+		},
+		{
+			// The columns are the union of the fields in the order
+			// they first appear.
+			"list of objects",
+			`[{"addr":"1.2.3.4","id":1},{"id":22,"inbound":true,"addr":"5.6.7.8:8333"}]`,
+			"addr          id  inbound\n" +
+				"1.2.3.4       1   \n" +
+				"5.6.7.8:8333  22  true\n",
+		},
+		{
+			"object of objects",
+			`{"aa":{"size":250,"fee":0.1},"b":{"size":1000,"fee":0.02,"depends":["aa"]}}`,
+			"    size  fee   depends\n" +
+				"aa  250   0.1   \n" +
+				"b   1000  0.02  [\"aa\"]\n",
+		},
+		{
+			// Fields are kept in the order of the server.
+			"object",
+			`{"chain":"main","blocks":100,"pruned":false,"softforks":[{"id":"csv"}],"note":"a\tb\nc"}`,
+			"chain      main\n" +
+				"blocks     100\n" +
+				"pruned     false\n" +
+				"softforks  [{\"id\":\"csv\"}]\n" +
+				"note       a b c\n",
+		},
+		{
+			"empty object",
+			"{}",
+			"",
+		},
+	}
+	for _, test := range tests {
+		var w bytes.Buffer
+		if err := printResult(&w, json.RawMessage(test.result), formatTable); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if w.String() != test.output {
+			t.Errorf("%s: printed\n%q, want\n%q", test.name, w.String(), test.output)
+		}
+	}
+}
+
+func TestCellText(t *testing.T) {
+	tests := []struct {
+		value string
+		text  string
+	}{
+		{"", ""},
+		{"null", ""},
+		{`"abc"`, "abc"},
+		{`"a\tb\nc"`, "a b c"},
+		{"1.5", "1.5"},
+		{`{ "a" : [ 1, 2 ] }`, `{"a":[1,2]}`},
+		{"{bad", "{bad"},
+	}
+	for _, test := range tests {
+		if text := cellText(json.RawMessage(test.value)); text != test.text {
+			t.Errorf("%s: cell %q, want %q", test.value, text, test.text)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+func TestWaitRetries(t *testing.T) {
+	saved := waitRetryInterval
+	defer func() {
+		waitRetryInterval = saved
+	}()
+	waitRetryInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "btcctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookiePath := filepath.Join(dir, ".cookie")
+
+	// The node warms up: it answers 503 twice before the block count.
+	var unavailable, posts int32 = 2, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		if atomic.AddInt32(&unavailable, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result":100,"error":null,"id":1}`))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name    string
+		wait    bool
+		timeout time.Duration
+		cookie  bool
+		success bool
+	}{
+		{"no wait", false, 0, true, false},
+		{"wait", true, 0, true, true},
+		{"cookie not written yet", true, 0, false, true},
+		{"wait timeout", true, 15 * time.Millisecond, true, false},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&unavailable, 2)
+		os.Remove(cookiePath)
+		if test.cookie {
+			if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:secret"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			time.AfterFunc(30*time.Millisecond, func() {
+				ioutil.WriteFile(cookiePath, []byte("__cookie__:secret"), 0600)
+			})
+		}
+		client, err := newRPCClient(&config{
+			RPCServer:   host,
+			RPCCookie:   cookiePath,
+			NoTLS:       true,
+			Wait:        test.wait,
+			WaitTimeout: test.timeout,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := client.SendCmd(btcjson.NewGetBlockCountCmd())
+		client.Shutdown()
+		if success := err == nil && string(result) == "100"; success != test.success {
+			t.Errorf("%s: got %s, %v", test.name, result, err)
+		}
+	}
+
+	// A request which reached the node is not sent again, even with --wait.
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	defer broken.Close()
+	client, err := newRPCClient(&config{
+		RPCServer: strings.TrimPrefix(broken.URL, "http://"),
+		RPCCookie: cookiePath,
+		NoTLS:     true,
+		Wait:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+	atomic.StoreInt32(&posts, 0)
+	if _, err := client.SendCmd(btcjson.NewSendRawTransactionCmd("00", nil)); err == nil {
+		t.Error("command on a broken connection succeeded")
+	}
+	if n := atomic.LoadInt32(&posts); n != 1 {
+		t.Errorf("command on a broken connection sent %d times", n)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/rpcclient"
+	"github.com/peterh/liner"
+)
+
+const (
+	// shellPrompt is the prompt of the interactive shell.
+	shellPrompt = "btcctl> "
+
+	// historyFileName is the name of the file in the btcctl home directory
+	// the commands of the interactive shell are saved to.
+	historyFileName = "history"
+)
+
+// shellCommands are the commands the interactive shell handles itself.
+var shellCommands = []string{"exit", "format", "quit"}
+
+// runShell reads commands from the standard input and runs them until the
+// user exits.  On a terminal, commands are edited with tab completion of the
+// methods and of their parameters, and kept in a history across sessions.
+// Otherwise they are read line by line from bio, so that a shell can be
+// scripted.
+func runShell(client *rpcclient.Client, cfg *config, bio *bufio.Reader) error {
+	var readLine func() (string, error)
+	if isTerminal(os.Stdin) {
+		line := liner.NewLiner()
+		defer line.Close()
+		line.SetCtrlCAborts(true)
+		line.SetTabCompletionStyle(liner.TabPrints)
+		line.SetWordCompleter(completeWord)
+
+		historyPath := filepath.Join(btcctlHomeDir, historyFileName)
+		if f, err := os.Open(historyPath); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+		defer func() {
+			if err := saveHistory(line, historyPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save the history: %v\n", err)
+			}
+		}()
+
+		fmt.Printf("Sending commands to %s, type exit to quit.\n", cfg.RPCServer)
+		readLine = func() (string, error) {
+			for {
+				input, err := line.Prompt(shellPrompt)
+				if err == liner.ErrPromptAborted {
+					// Ctrl-C drops the line being typed.
+					continue
+				}
+				if err == nil && strings.TrimSpace(input) != "" {
+					line.AppendHistory(input)
+				}
+				return input, err
+			}
+		}
+	} else {
+		readLine = func() (string, error) {
+			input, err := bio.ReadString('\n')
+			if err == io.EOF && len(input) > 0 {
+				err = nil
+			}
+			return input, err
+		}
+	}
+
+	format := cfg.Format
+	for {
+		input, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+
+		case "format":
+			if len(args) == 1 {
+				fmt.Println(format)
+			} else if !validFormat(args[1]) {
+				fmt.Fprintf(os.Stderr, "Unknown output format %q, "+
+					"choose one of %s\n", args[1],
+					strings.Join(outputFormats, ", "))
+			} else {
+				format = args[1]
+			}
+			continue
+		}
+
+		if err := runCommand(client, format, args[0], args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// saveHistory writes the history of the shell to path.
+func saveHistory(line *liner.State, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := line.WriteHistory(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// splitArgs splits a command line into its arguments the way a POSIX shell
+// does: arguments are separated by blanks, single quotes keep everything
+// they enclose, double quotes keep everything but backslash escapes, and a
+// backslash outside quotes escapes the next character.  JSON parameters thus
+// need to be quoted, such as '{"mode":"template"}'.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg bytes.Buffer
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// completeWord completes the word of the line being typed before the cursor
+// at pos: the method for the first word, and the values known for the
+// parameter being typed otherwise.
+func completeWord(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndexAny(head, " \t") + 1
+	word := head[start:]
+
+	// Nothing is completed inside a quoted parameter.
+	args, err := splitArgs(head[:start])
+	if err != nil {
+		return head, nil, tail
+	}
+
+	var candidates []string
+	if len(args) == 0 {
+		candidates = append(usableMethods(), shellCommands...)
+	} else {
+		candidates = paramValues(args[0], len(args)-1)
+	}
+
+	var completions []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			completions = append(completions, candidate+" ")
+		}
+	}
+	return head[:start], completions, tail
+}
+
+// usableMethods returns the registered methods usable from this utility.
+func usableMethods() []string {
+	var methods []string
+	for _, method := range btcjson.RegisteredCmdMethods() {
+		flags, err := btcjson.MethodUsageFlags(method)
+		if err != nil || flags&unusableFlags != 0 {
+			continue
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// paramValues returns the values known for the parameter at index of the
+// method: method names for help, the choices of parameters listing them in
+// their usage such as "add|remove|onetry", and true and false for booleans.
+func paramValues(method string, index int) []string {
+	switch method {
+	case "help":
+		if index == 0 {
+			return usableMethods()
+		}
+		return nil
+	case "format":
+		if index == 0 {
+			return outputFormats
+		}
+		return nil
+	}
+
+	usage, err := btcjson.MethodUsageText(method)
+	if err != nil {
+		return nil
+	}
+	params := usageParams(usage)
+	if index >= len(params) {
+		return nil
+	}
+
+	param := params[index]
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		// An optional parameter shown with its default value.
+		switch param[i+1:] {
+		case "true", "false":
+			return []string{"true", "false"}
+		}
+		return nil
+	}
+	if strings.HasPrefix(param, `"`) && strings.Contains(param, "|") {
+		return strings.Split(strings.Trim(param, `"`), "|")
+	}
+	return nil
+}
+
+// usageParams splits the one-line usage of a method into the usage of its
+// parameters, the optional ones included.
+func usageParams(usage string) []string {
+	var params []string
+	var param bytes.Buffer
+	depth := 0
+	inString := false
+	flush := func() {
+		if param.Len() > 0 {
+			params = append(params, param.String())
+			param.Reset()
+		}
+	}
+
+	for _, r := range usage {
+		switch {
+		case inString:
+			param.WriteRune(r)
+			if r == '"' {
+				inString = false
+			}
+		case r == '"':
+			inString = true
+			param.WriteRune(r)
+		case r == '[' || r == '{':
+			depth++
+			param.WriteRune(r)
+		case r == ']' || r == '}':
+			depth--
+			param.WriteRune(r)
+		case depth == 0 && (r == ' ' || r == '(' || r == ')'):
+			// Parentheses enclose the optional parameters.
+			flush()
+		default:
+			param.WriteRune(r)
+		}
+	}
+	flush()
+
+	// The first word is the method itself.
+	if len(params) > 0 {
+		params = params[1:]
+	}
+	return params
+}
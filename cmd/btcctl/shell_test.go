@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"", nil},
+		{" \t\n", nil},
+		{"getblockcount", []string{"getblockcount"}},
+		{"  getblock  abc\ttrue \n", []string{"getblock", "abc", "true"}},
+		{`getblocktemplate '{"mode":"template"}'`, []string{"getblocktemplate", `{"mode":"template"}`}},
+		{`a "b c" d`, []string{"a", "b c", "d"}},
+		{`a "x\"y" 'x\y'`, []string{"a", `x"y`, `x\y`}},
+		{`a "x\ny" "x\\y"`, []string{"a", `x\ny`, `x\y`}},
+		{`a\ b c`, []string{"a b", "c"}},
+		{`a '' ""`, []string{"a", "", ""}},
+		{`a"b"'c'`, []string{"abc"}},
+	}
+	for _, test := range tests {
+		args, err := splitArgs(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q split into %q, want %q", test.line, args, test.args)
+		}
+	}
+
+	for _, line := range []string{`a 'b`, `a "b`, `a\`, `a "b\"`} {
+		if args, err := splitArgs(line); err == nil {
+			t.Errorf("%q split into %q", line, args)
+		}
+	}
+}
+
+func TestUsageParams(t *testing.T) {
+	tests := []struct {
+		usage  string
+		params []string
+	}{
+		{"stop", []string{}},
+		{`help ("command")`, []string{`"command"`}},
+		{`getblock "hash" (verbose=true verbosetx=false)`,
+			[]string{`"hash"`, "verbose=true", "verbosetx=false"}},
+		{`setban "subnet" "add|remove" (bantime=0 absolute=false)`,
+			[]string{`"subnet"`, `"add|remove"`, "bantime=0", "absolute=false"}},
+		{`createrawtransaction [{"txid":"value","vout":n},...] {"address":amount,...} (locktime)`,
+			[]string{`[{"txid":"value","vout":n},...]`, `{"address":amount,...}`, "locktime"}},
+		{`sendmany "fromaccount" {"address":amount,...} (minconf=1 "comment")`,
+			[]string{`"fromaccount"`, `{"address":amount,...}`, "minconf=1", `"comment"`}},
+		{`method "a (b) c"`, []string{`"a (b) c"`}},
+	}
+	for _, test := range tests {
+		if params := usageParams(test.usage); !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s: params %q, want %q", test.usage, params, test.params)
+		}
+	}
+}
+
+func TestParamValues(t *testing.T) {
+	tests := []struct {
+		method string
+		index  int
+		values []string
+	}{
+		{"addnode", 1, []string{"add", "remove", "onetry"}},
+		{"addnode", 0, nil},
+		{"addnode", 2, nil},
+		{"setban", 1, []string{"add", "remove"}},
+		{"setban", 3, []string{"true", "false"}},
+		{"setban", 2, nil},
+		{"getblock", 1, []string{"true", "false"}},
+		{"format", 0, outputFormats},
+		{"format", 1, nil},
+		{"unknownmethod", 0, nil},
+	}
+	for _, test := range tests {
+		if values := paramValues(test.method, test.index); !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%s parameter %d: values %q, want %q", test.method, test.index, values, test.values)
+		}
+	}
+
+	if methods := paramValues("help", 0); !reflect.DeepEqual(methods, usableMethods()) {
+		t.Errorf("help completes %d methods, want %d", len(methods), len(usableMethods()))
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	tests := []struct {
+		line        string
+		pos         int
+		head        string
+		completions []string
+		tail        string
+	}{
+		{"getblockc", 9, "", []string{"getblockchaininfo ", "getblockcount "}, ""},
+		{"qu", 2, "", []string{"quit "}, ""},
+		{"addnode 1.2.3.4 o", 17, "addnode 1.2.3.4 ", []string{"onetry "}, ""},
+		{"addnode 1.2.3.4 ", 16, "addnode 1.2.3.4 ", []string{"add ", "remove ", "onetry "}, ""},
+		{"format t", 8, "format ", []string{"table "}, ""},
+		{"getblock abc f", 14, "getblock abc ", []string{"false "}, ""},
+		{"getblockc x", 9, "", []string{"getblockchaininfo ", "getblockcount "}, " x"},
+		{"addnode x", 9, "addnode ", nil, ""},
+		{`getblock "a b`, 13, `getblock "a b`, nil, ""},
+	}
+	for _, test := range tests {
+		head, completions, tail := completeWord(test.line, test.pos)
+		sort.Strings(completions)
+		sort.Strings(test.completions)
+		if head != test.head || tail != test.tail || !reflect.DeepEqual(completions, test.completions) {
+			t.Errorf("%q at %d: completed to %q, %q, %q, want %q, %q, %q", test.line, test.pos,
+				head, completions, tail, test.head, test.completions, test.tail)
+		}
+	}
+}
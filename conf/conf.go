@@ -1,14 +1,19 @@
 package conf
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/astaxie/beego/config"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/socks"
 	"github.com/btcboost/copernicus/utils"
+	"github.com/jessevdk/go-flags"
 )
 
 var AppConf *AppConfig
@@ -19,12 +24,13 @@ const (
 
 type AppConfig struct {
 	DataDir            string        `short:"b" long:"datadir" description:"Directory to store data"`
-	ShowVersion        bool          `short:"v" long:"version" description:"Display version in"`
+	ShowVersion        bool          `short:"v" long:"version" description:"Display version information and exit"`
 	NoPeerBloomFilters bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	MaxPeers           int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
 	DisableBanning     bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration        time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold       uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	MaxUploadTarget    uint64        `long:"maxuploadtarget" description:"Try to keep the bytes sent to the peers under the given target, in MiB per 24h -- Historical blocks are no longer served once it is nearly reached, except to peers with the download permission -- 0 for no limit"`
 
 	Listeners []string `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 
@@ -42,24 +48,36 @@ type AppConfig struct {
 	oniondial func(string, string, time.Duration) (net.Conn, error)
 	dial      func(string, string, time.Duration) (net.Conn, error)
 
-	LogModule []string
+	LogModule []string `long:"logmodule" description:"Add a module whose log messages are written to the log"`
+
+	// ChainParams are the parameters of the network selected with
+	// --testnet, --regtest or --simnet, the main network by default.
+	ChainParams *msg.BitcoinParams `no-flag:"true"`
 
 	ConfigFile           string   `short:"C" long:"configfile" description:"Path to configuration file"`
 	LogDir               string   `long:"logdir" description:"Directory to log output."`
 	AddPeers             []string `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	ConnectPeers         []string `long:"connect" description:"Connect only to the specified peers at startup"`
-	Whitelists           []string `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	Whitelists           []string `long:"whitelist" description:"Give permissions to the peers connecting from an IP network or IP.  Format: '[<permissions>@]<IP network>' (eg. relay,noban@192.168.1.0/24 or ::1); the permissions are noban, relay, forcerelay, mempool, download, addr and all, noban,mempool,relay,download when left out"`
+	Whitebinds           []string `long:"whitebind" description:"Listen on an interface/port and give permissions to the peers connecting to it.  Format: '<permissions>@<interface/port>' (eg. mempool@127.0.0.1:8333)"`
+	ASMap                string   `long:"asmap" description:"File mapping the IP addresses to the autonomous system announcing them, which groups the peers by AS rather than by IP prefix (relative to the data dir)"`
 	RPCUser              string   `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string   `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string   `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCLimitPass         string   `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
-	RPCListeners         []string `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
+	RPCAuth              []string `long:"rpcauth" description:"Username and salted HMAC-SHA256 of the password for RPC connections.  Format: '<user>:<salt>$<hash>'"`
+	RPCWhitelist         []string `long:"rpcwhitelist" description:"Only allow the user to call the listed RPC methods.  Format: '<user>:<method>,<method>'"`
+	RPCBlacklist         []string `long:"rpcblacklist" description:"Deny the user calls to the listed RPC methods.  Format: '<user>:<method>,<method>'"`
+	RPCCookieFile        string   `long:"rpccookiefile" description:"Location of the RPC authentication cookie (default: data dir/.cookie)"`
+	RPCListeners         []string `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334, regtest: 18445, simnet: 18556)"`
 	RPCCert              string   `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string   `long:"rpckey" description:"File containing the certificate key"`
 	RPCMaxClients        int      `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxWebsockets     int      `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int      `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCQuirks            bool     `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
+	Rest                 bool     `long:"rest" description:"Accept public REST requests on the restlisten interface/port -- NOTE: The REST interface is unauthenticated"`
+	RESTListen           string   `long:"restlisten" description:"Interface/port to accept REST requests on (default: 127.0.0.1 port: 8332, testnet: 18332, regtest: 18443, simnet: 18557)"`
 	DisableRPC           bool     `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableTLS           bool     `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
 	ExternalIPs          []string `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
@@ -69,61 +87,475 @@ type AppConfig struct {
 	OnionProxy           string   `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyUser       string   `long:"onionuser" description:"Username for onion proxy server"`
 	OnionProxyPass       string   `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
-	AddCheckpoints       []string `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	DisableCheckpoints   bool     `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
-	DbType               string   `long:"dbtype" description:"Database backend to use for the Block Chain"`
-	Profile              string   `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
+	Profile              string   `long:"profile" description:"Serve the HTTP profiles of the runtime on the given port of localhost -- NOTE port must be between 1024 and 65535"`
 	CPUProfile           string   `long:"cpuprofile" description:"Write CPU profile to the specified file"`
-	DebugLevel           string   `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
-	Upnp                 bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	DebugLevel           string   `short:"d" long:"debuglevel" description:"Logging level {emergency, alert, critical, error, warn, notice, info, debug}"`
 	MinRelayTxFee        float64  `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
 	FreeTxRelayLimit     float64  `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
-	NoRelayPriority      bool     `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	MaxOrphanTxs         int      `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	NoFeeFilter          bool     `long:"nofeefilter" description:"Do not send feefilter messages to tell peers the minimum fee rate of transactions to announce"`
 	Generate             bool     `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	MiningAddrs          []string `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	CoinbaseTag          string   `long:"coinbasetag" description:"Operator tag to end the coinbase signature script of generated blocks with"`
+	CoinbasePayouts      []string `long:"coinbasepayout" description:"Add an <address>:<weight> output sharing the reward of generated blocks by weight -- Replaces the mining address when set"`
+	StratumListeners     []string `long:"stratumlisten" description:"Add an interface/port to accept stratum mining clients on -- NOTE: Blocks found by stratum clients pay to the miningaddr addresses"`
+	StratumDifficulty    float64  `long:"stratumdifficulty" description:"Share difficulty stratum clients start at before it is adjusted to their hash rate"`
 	BlockMinSize         uint32   `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32   `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockMinWeight       uint32   `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
 	BlockMaxWeight       uint32   `long:"blockmaxweight" description:"Maximum block weight to be used when creating a block"`
 	BlockPrioritySize    uint32   `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	BlockStrategy        string   `long:"blockstrategy" description:"Strategy selecting the transactions of a block: ancestorfeerate, ancestorfee, feerate or priority"`
 	UserAgentComments    []string `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
-	SigCacheMaxSize      uint     `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	BlocksOnly           bool     `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	Dandelion            bool     `long:"dandelion" description:"Relay the local transactions, and those of the peers' stems, along a random stem of Dandelion peers before they are announced to all the peers, which hides where they come from"`
 	TxIndex              bool     `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool     `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	Prune                uint64   `long:"prune" description:"Prune old blocks to keep the block files below the given size in MiB -- 0 disables pruning, 1 allows pruning manually, automatic pruning needs at least 550 -- NOTE: Incompatible with the transaction and address indexes"`
 	AddrIndex            bool     `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool     `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	RelayNonStd          bool     `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool     `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 }
 
+const (
+	defaultConfigFilename       = "copernicus.conf"
+	defaultLogLevel             = "debug"
+	defaultMaxPeers             = 125
+	defaultBanDuration          = time.Hour * 24
+	defaultRPCMaxClients        = 10
+	defaultRPCMaxWebsockets     = 25
+	defaultRPCMaxConcurrentReqs = 20
+	defaultRPCCertFilename      = "rpc.cert"
+	defaultRPCKeyFilename       = "rpc.key"
+	defaultMinRelayTxFee        = 0.00001
+	defaultProxyPort            = "9050"
+
+	// minPruneTarget is the smallest size in MiB of the block files which
+	// can be kept when pruning automatically.
+	minPruneTarget = 550
+)
+
+// logLevels are the levels accepted by --debuglevel.
+var logLevels = []string{"emergency", "alert", "critical", "error", "warn",
+	"notice", "info", "debug"}
+
 func init() {
-	_, err := config.NewConfig("ini", "init.conf")
+	cfg := defaultConfig()
+	cfg.setNetDefaults(&mainNetParams)
+	AppConf = &cfg
+}
+
+// defaultConfig returns a config with the defaults which are the same on all
+// the networks.
+func defaultConfig() AppConfig {
+	cfg := AppConfig{
+		DataDir:              GetDataPath(),
+		MaxPeers:             defaultMaxPeers,
+		BanDuration:          defaultBanDuration,
+		BanThreshold:         uint32(DefaultBanScoreThreshold),
+		RPCMaxClients:        defaultRPCMaxClients,
+		RPCMaxWebsockets:     defaultRPCMaxWebsockets,
+		RPCMaxConcurrentReqs: defaultRPCMaxConcurrentReqs,
+		DebugLevel:           defaultLogLevel,
+		MinRelayTxFee:        defaultMinRelayTxFee,
+		MaxOrphanTxs:         DefaultMaxOrphanTransactions,
+		TxIndex:              DefaultTxIndex,
+	}
+	cfg.dial = net.DialTimeout
+	cfg.oniondial = net.DialTimeout
+	cfg.lookup = net.LookupIP
+	return cfg
+}
+
+// setNetDefaults selects the network of params and fills in the options left
+// unset which default to a value of the network.
+func (cfg *AppConfig) setNetDefaults(params *netParams) {
+	cfg.ChainParams = params.BitcoinParams
+	cfg.DataDir = netDataDir(cfg.DataDir, params)
+	if cfg.LogDir == "" {
+		cfg.LogDir = cfg.DataDir
+	}
+	if len(cfg.Listeners) == 0 && len(cfg.Whitebinds) == 0 && !cfg.DisableListen {
+		cfg.Listeners = []string{net.JoinHostPort("", params.DefaultPort)}
+	}
+	if len(cfg.RPCListeners) == 0 {
+		cfg.RPCListeners = []string{net.JoinHostPort("127.0.0.1", params.rpcPort)}
+	}
+	if cfg.RESTListen == "" {
+		cfg.RESTListen = net.JoinHostPort("127.0.0.1", params.restPort)
+	}
+	if cfg.RPCCert == "" {
+		cfg.RPCCert = filepath.Join(cfg.DataDir, defaultRPCCertFilename)
+	}
+	if cfg.RPCKey == "" {
+		cfg.RPCKey = filepath.Join(cfg.DataDir, defaultRPCKeyFilename)
+	}
+	if cfg.ASMap != "" && !filepath.IsAbs(cfg.ASMap) {
+		cfg.ASMap = filepath.Join(cfg.DataDir, cfg.ASMap)
+	}
+	cfg.Listeners = normalizeAddresses(cfg.Listeners, params.DefaultPort)
+	cfg.Whitebinds = normalizeWhitebinds(cfg.Whitebinds, params.DefaultPort)
+	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners, params.rpcPort)
+	cfg.RESTListen = normalizeAddress(cfg.RESTListen, params.restPort)
+
+	// Non-standard transactions are relayed on the networks asking for it,
+	// unless the operator decided otherwise.
+	switch {
+	case cfg.RejectNonStd:
+		cfg.RelayNonStd = false
+	case !cfg.RelayNonStd:
+		cfg.RelayNonStd = params.RelayNonStdTxs
+	}
+}
+
+// LoadConfig initializes and parses the config using a config file and
+// command line options.
+//
+// The configuration proceeds as follows:
+//  1. Start with a default config with sane settings
+//  2. Pre-parse the command line to check for an alternative config file
+//  3. Load configuration file overwriting defaults with any specified options
+//  4. Parse CLI options and overwrite/add any specified options
+//  5. Fill in the defaults of the selected network and validate the options
+//
+// The above results in functioning properly without any config settings
+// while still allowing the user to override settings with config files and
+// command line options.  Command line options always take precedence.
+//
+// When --help is given, the returned error is a *flags.Error of type
+// flags.ErrHelp holding the usage.  When --version is given, the config is
+// returned as soon as the command line is parsed.
+func LoadConfig(args []string) (*AppConfig, error) {
+	cfg := defaultConfig()
+
+	// Pre-parse the command line options to see if an alternative config
+	// file, data directory or the version flag was specified.  Any errors
+	// aside from the help message error can be ignored here since they
+	// will be caught by the final parse below.
+	preCfg := cfg
+	preParser := flags.NewParser(&preCfg, flags.HelpFlag)
+	if _, err := preParser.ParseArgs(args); err != nil {
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			return nil, err
+		}
+	}
+	if preCfg.ShowVersion {
+		return &preCfg, nil
+	}
+
+	// A missing config file is only an error when it was given explicitly.
+	configFile := preCfg.ConfigFile
+	if configFile == "" {
+		configFile = filepath.Join(preCfg.DataDir, defaultConfigFilename)
+	}
+	parser := flags.NewParser(&cfg, flags.HelpFlag)
+	err := flags.NewIniParser(parser).ParseFile(configFile)
 	if err != nil {
-		fmt.Println(err)
-	}
-	// todo unable to pass in unit test
-	// if appConf != nil {
-	// 	contentTimeout := appConf.String("Timeout::connectTimeout")
-	// 	log.Info("read conf timeout is  %s", contentTimeout)
-	// 	logDir := appConf.String("Log::dir")
-	// 	log.Info("logger dir is %s", logDir)
-	// 	logLevel := appConf.String("Log::level")
-	// 	log.Info("logger dir is %s", logLevel)
-	// }
-	AppConf = loadConfig()
-}
-
-func loadConfig() *AppConfig {
-	appConfig := AppConfig{
-		ShowVersion:        true,
-		NoPeerBloomFilters: true,
-		DataDir:            GetDataPath(),
-	}
-	appConfig.dial = net.DialTimeout
-	appConfig.lookup = net.LookupIP
-	return &appConfig
+		if _, ok := err.(*os.PathError); !ok || preCfg.ConfigFile != "" {
+			return nil, fmt.Errorf("error parsing config file %s: %v", configFile, err)
+		}
+	}
+
+	// Parse command line options again to ensure they take precedence.
+	remainingArgs, err := parser.ParseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(remainingArgs) > 0 {
+		return nil, fmt.Errorf("invalid arguments %q -- all the options "+
+			"start with --", remainingArgs)
+	}
+
+	// Multiple networks can't be selected simultaneously.
+	params := &mainNetParams
+	numNets := 0
+	if cfg.TestNet3 {
+		numNets++
+		params = &testNet3Params
+	}
+	if cfg.RegressionTest {
+		numNets++
+		params = &regressionNetParams
+	}
+	if cfg.SimNet {
+		numNets++
+		params = &simNetParams
+	}
+	if numNets > 1 {
+		return nil, errors.New("the testnet, regtest and simnet options " +
+			"can't be used together -- choose one of the three")
+	}
+
+	// Connecting only to the given peers or through a proxy discloses
+	// nothing about the node, so it doesn't listen unless asked to.
+	if (len(cfg.ConnectPeers) > 0 || cfg.Proxy != "") && len(cfg.Listeners) == 0 && len(cfg.Whitebinds) == 0 {
+		cfg.DisableListen = true
+	}
+	if len(cfg.ConnectPeers) > 0 {
+		cfg.DisableDNSSeed = true
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	cfg.setNetDefaults(params)
+	if cfg.DisableTLS {
+		if err := checkLocalListeners(cfg.RPCListeners); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.setDialers()
+	return &cfg, nil
+}
+
+// setDialers routes the connections and the host name lookups through the
+// SOCKS5 proxies given by the proxy and onion options.  The lookups go
+// through the proxy too, so that no host name leaks outside of it.
+func (cfg *AppConfig) setDialers() {
+	if cfg.Proxy != "" {
+		cfg.Proxy = normalizeAddress(cfg.Proxy, defaultProxyPort)
+		proxy := &socks.Proxy{
+			Address:      cfg.Proxy,
+			Username:     cfg.ProxyUser,
+			Password:     cfg.ProxyPass,
+			TorIsolation: cfg.TorIsolation,
+		}
+		cfg.dial = proxy.Dial
+		cfg.oniondial = proxy.Dial
+		cfg.lookup = proxy.LookupIP
+	}
+
+	// The onion proxy only reaches the hidden services, the other
+	// connections keep going through the proxy, if any.
+	if cfg.OnionProxy != "" {
+		cfg.OnionProxy = normalizeAddress(cfg.OnionProxy, defaultProxyPort)
+		onionProxy := &socks.Proxy{
+			Address:      cfg.OnionProxy,
+			Username:     cfg.OnionProxyUser,
+			Password:     cfg.OnionProxyPass,
+			TorIsolation: cfg.TorIsolation,
+		}
+		cfg.oniondial = onionProxy.Dial
+	}
+
+	if cfg.NoOnion {
+		cfg.oniondial = func(string, string, time.Duration) (net.Conn, error) {
+			return nil, errors.New("tor has been disabled")
+		}
+	}
+}
+
+// OnionReachable returns whether the node can connect to the tor hidden
+// services, through the proxy or the onion proxy.
+func (cfg *AppConfig) OnionReachable() bool {
+	return !cfg.NoOnion && (cfg.Proxy != "" || cfg.OnionProxy != "")
+}
+
+// validate checks the options are within their range and that no options
+// conflicting with each other were given.
+func (cfg *AppConfig) validate() error {
+	if cfg.MaxPeers < 0 {
+		return fmt.Errorf("the maxpeers option may not be less than 0 "+
+			"-- parsed [%d]", cfg.MaxPeers)
+	}
+	if cfg.BanDuration < time.Second {
+		return fmt.Errorf("the banduration option may not be less than "+
+			"1s -- parsed [%v]", cfg.BanDuration)
+	}
+	if !validLogLevel(cfg.DebugLevel) {
+		return fmt.Errorf("the debuglevel option %q is not a log level "+
+			"-- choose one of %s", cfg.DebugLevel, strings.Join(logLevels, ", "))
+	}
+	if cfg.Profile != "" {
+		port, err := strconv.Atoi(cfg.Profile)
+		if err != nil || port < 1024 || port > 65535 {
+			return fmt.Errorf("the profile port must be between 1024 and "+
+				"65535 -- parsed [%s]", cfg.Profile)
+		}
+	}
+	if cfg.MinRelayTxFee < 0 {
+		return fmt.Errorf("the minrelaytxfee option may not be negative "+
+			"-- parsed [%v]", cfg.MinRelayTxFee)
+	}
+	if cfg.FreeTxRelayLimit < 0 {
+		return fmt.Errorf("the limitfreerelay option may not be negative "+
+			"-- parsed [%v]", cfg.FreeTxRelayLimit)
+	}
+	if cfg.MaxOrphanTxs < 0 {
+		return fmt.Errorf("the maxorphantx option may not be less than 0 "+
+			"-- parsed [%d]", cfg.MaxOrphanTxs)
+	}
+	if cfg.BlockMaxSize != 0 && cfg.BlockMinSize > cfg.BlockMaxSize {
+		return fmt.Errorf("the blockminsize option [%d] may not be more "+
+			"than blockmaxsize [%d]", cfg.BlockMinSize, cfg.BlockMaxSize)
+	}
+
+	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
+		return errors.New("the addpeer and connect options can't be used " +
+			"together -- connect already restricts the peers to the given ones")
+	}
+	if cfg.RelayNonStd && cfg.RejectNonStd {
+		return errors.New("the rejectnonstd and relaynonstd options " +
+			"can't be used together -- choose only one")
+	}
+	if cfg.TxIndex && cfg.DropTxIndex {
+		return errors.New("the txindex and droptxindex options can't be " +
+			"used together -- the index would be dropped and rebuilt")
+	}
+	if cfg.AddrIndex && cfg.DropAddrIndex {
+		return errors.New("the addrindex and dropaddrindex options can't " +
+			"be used together -- the index would be dropped and rebuilt")
+	}
+	if cfg.Prune != 0 {
+		if cfg.Prune != 1 && cfg.Prune < minPruneTarget {
+			return fmt.Errorf("the prune option must be 0, 1 or at least "+
+				"%d MiB -- parsed [%d]", minPruneTarget, cfg.Prune)
+		}
+		if cfg.TxIndex {
+			return errors.New("the prune and txindex options can't be " +
+				"used together -- the index needs all the blocks")
+		}
+		if cfg.AddrIndex {
+			return errors.New("the prune and addrindex options can't be " +
+				"used together -- the index needs all the blocks")
+		}
+	}
+
+	if cfg.NoOnion && cfg.OnionProxy != "" {
+		return errors.New("the noonion and onion options can't be used " +
+			"together -- choose only one")
+	}
+	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
+		return errors.New("the torisolation option requires either the " +
+			"proxy or the onion option")
+	}
+
+	if cfg.RPCUser != "" && cfg.RPCUser == cfg.RPCLimitUser {
+		return errors.New("the rpcuser and rpclimituser options may not " +
+			"be the same user")
+	}
+	if cfg.RPCMaxConcurrentReqs < 0 {
+		return fmt.Errorf("the rpcmaxconcurrentreqs option may not be "+
+			"less than 0 -- parsed [%d]", cfg.RPCMaxConcurrentReqs)
+	}
+	return nil
+}
+
+// InitAppConfig loads the config from the config file and the command line
+// arguments args, then makes it the config of the application: AppConf, the
+// active network in msg.ActiveNetParams and the -name arguments read through
+// utils.GetArg.  It also creates the data directory of the network.
+func InitAppConfig(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	AppConf = cfg
+	if cfg.ShowVersion {
+		return nil
+	}
+
+	msg.ActiveNetParams = cfg.ChainParams
+	exportArgs(cfg)
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+		return fmt.Errorf("unable to create the data directory %s: %v",
+			cfg.DataDir, err)
+	}
+	return nil
+}
+
+// exportArgs publishes the options the validation and mining code reads with
+// utils.GetArg under their Bitcoin Core names.  Options left to their
+// default are not published, so that the code keeps its own defaults.
+func exportArgs(cfg *AppConfig) {
+	var args []string
+	if cfg.BlockMaxSize != 0 {
+		args = append(args, fmt.Sprintf("-blockmaxsize=%d", cfg.BlockMaxSize))
+	}
+	if cfg.BlockPrioritySize != 0 {
+		args = append(args, fmt.Sprintf("-blockprioritysize=%d", cfg.BlockPrioritySize))
+	}
+	if cfg.FreeTxRelayLimit != 0 {
+		args = append(args, fmt.Sprintf("-limitfreerelay=%d", int64(cfg.FreeTxRelayLimit)))
+	}
+	if cfg.TxIndex {
+		args = append(args, "-txindex=1")
+	}
+	if cfg.Prune != 0 {
+		args = append(args, fmt.Sprintf("-prune=%d", cfg.Prune))
+	}
+	utils.ParseParameters(len(args), args)
+}
+
+// validLogLevel returns whether level is one of logLevels.
+func validLogLevel(level string) bool {
+	level = strings.ToLower(level)
+	for _, l := range logLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAddress returns addr with defaultPort added when it has no port.
+func normalizeAddress(addr, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, defaultPort)
+	}
+	return addr
+}
+
+// normalizeAddresses returns addrs with defaultPort added to the addresses
+// without a port, and duplicates removed.
+func normalizeAddresses(addrs []string, defaultPort string) []string {
+	result := make([]string, 0, len(addrs))
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		addr = normalizeAddress(addr, defaultPort)
+		if !seen[addr] {
+			seen[addr] = true
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// normalizeWhitebinds adds the default port to the addresses of the
+// whitebinds, which are of the form <permissions>@<address>.  The permissions
+// are checked by the p2p package.
+func normalizeWhitebinds(whitebinds []string, defaultPort string) []string {
+	result := make([]string, 0, len(whitebinds))
+	for _, whitebind := range whitebinds {
+		if i := strings.LastIndex(whitebind, "@"); i >= 0 {
+			whitebind = whitebind[:i+1] + normalizeAddress(whitebind[i+1:], defaultPort)
+		}
+		result = append(result, whitebind)
+	}
+	return result
+}
+
+// checkLocalListeners returns an error unless all the listeners are bound to
+// the loopback interface, which is the only place the RPC server may go
+// without TLS.
+func checkLocalListeners(listeners []string) error {
+	for _, addr := range listeners {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("the rpclisten address %s is invalid: %v", addr, err)
+		}
+		if host == "localhost" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return fmt.Errorf("the notls option may only be used when the "+
+				"RPC server listens on localhost -- %s is not", addr)
+		}
+	}
+	return nil
 }
 
 func GetDataPath() string {
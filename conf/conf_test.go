@@ -1,76 +1,188 @@
 package conf
 
 import (
-	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
-	"github.com/spf13/viper"
+	"github.com/btcboost/copernicus/net/msg"
 )
 
-var confData = []byte(`
-GoVersion: 1.9.2
-Version: 1.0.0
-BuildDate: 20180428
-Service:
-  Address: 10.0.0.0/8
-HTTP:
-  Host: 127.0.0.1
-  Port: 8080
-  Mode: test
-RPC:
-  Host: 127.0.0.1
-  Port: 9552
-Log:
-  Format: json
-`)
-
-func TestInitConfig(t *testing.T) {
-	//Convey("Given config file", t, func() {
-	//	filename := fmt.Sprintf("conf_test%04d.yml", rand.Intn(9999))
-	//	ioutil.WriteFile(filename, confData, 0664)
-	//
-	//	Convey("When init configuration", func() {
-	//		config := initConfig()
-	//
-	//		Convey("Configuration should resemble default configuration", func() {
-	//			expected := &Configuration{}
-	//			expected.Service.Address = "10.0.0.0/8"
-	//			expected.HTTP.Host = "127.0.0.1"
-	//			expected.HTTP.Port = 8080
-	//			expected.HTTP.Mode = "test"
-	//			expected.Log.Format = "json"
-	//			//expected.Log.Level = "info"
-	//			expected.GoVersion = "1.9.2"
-	//			expected.Version = "1.0.0"
-	//			expected.BuildDate = "20180428"
-	//			expected.RPC.Host = "127.0.0.1"
-	//			expected.RPC.Port = 9552
-	//			So(config, ShouldResemble, expected)
-	//		})
-	//	})
-	//
-	//	v := viper.GetString("HTTP.Host")
-	//	fmt.Println(v)
-	//
-	//	Reset(func() {
-	//		os.Remove(filename)
-	//	})
-	//})
+func tempDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
 }
 
-func TestSetDefault(t *testing.T) {
-	viper.SetDefault("test2", 100)
-	if viper.GetInt("test2") != 100 {
-		t.Error("set default error")
+func TestLoadConfigNetworks(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	tests := []struct {
+		args         []string
+		params       *msg.BitcoinParams
+		dataDir      string
+		listeners    []string
+		rpcListeners []string
+	}{
+		{nil, &msg.MainNetParams, dataDir, []string{":8333"}, []string{"127.0.0.1:8334"}},
+		{[]string{"--testnet"}, &msg.TestNet3Params, filepath.Join(dataDir, "testnet3"),
+			[]string{":18333"}, []string{"127.0.0.1:18334"}},
+		{[]string{"--regtest"}, &msg.RegressionNetParams, filepath.Join(dataDir, "regtest"),
+			[]string{":18444"}, []string{"127.0.0.1:18445"}},
+		{[]string{"--simnet", "--listen=127.0.0.1", "--rpclisten=::1"}, &msg.SimNetParams,
+			filepath.Join(dataDir, "simnet"), []string{"127.0.0.1:18555"}, []string{"[::1]:18556"}},
+	}
+	for _, test := range tests {
+		cfg, err := LoadConfig(append([]string{"--datadir=" + dataDir}, test.args...))
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+			continue
+		}
+		if cfg.ChainParams != test.params {
+			t.Errorf("%v: network %s, want %s", test.args, cfg.ChainParams.Name, test.params.Name)
+		}
+		if cfg.DataDir != test.dataDir {
+			t.Errorf("%v: data directory %s, want %s", test.args, cfg.DataDir, test.dataDir)
+		}
+		if !reflect.DeepEqual(cfg.Listeners, test.listeners) {
+			t.Errorf("%v: listeners %v, want %v", test.args, cfg.Listeners, test.listeners)
+		}
+		if !reflect.DeepEqual(cfg.RPCListeners, test.rpcListeners) {
+			t.Errorf("%v: RPC listeners %v, want %v", test.args, cfg.RPCListeners, test.rpcListeners)
+		}
+		if cfg.RelayNonStd != test.params.RelayNonStdTxs {
+			t.Errorf("%v: relaynonstd %v, want the default of the network", test.args, cfg.RelayNonStd)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
+	content := []byte("[Application Options]\nmaxpeers=8\nrpcuser=alice\ntestnet=1\n")
+	if err := ioutil.WriteFile(filepath.Join(dataDir, defaultConfigFilename), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command line takes precedence over the config file of the data
+	// directory.
+	cfg, err := LoadConfig([]string{"--datadir=" + dataDir, "--maxpeers=9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxPeers != 9 || cfg.RPCUser != "alice" || cfg.ChainParams != &msg.TestNet3Params {
+		t.Errorf("maxpeers %d, rpcuser %q, network %s, want 9, alice and testnet3",
+			cfg.MaxPeers, cfg.RPCUser, cfg.ChainParams.Name)
+	}
+
+	// A missing config file is only an error when it was given.
+	_, err = LoadConfig([]string{"--datadir=" + dataDir, "--configfile=" + filepath.Join(dataDir, "missing.conf")})
+	if err == nil {
+		t.Error("missing config file accepted")
 	}
+}
 
-	viper.SetDefault("rpc.user", "qshuai")
-	if viper.GetString("rpc.user") != "qshuai" {
-		t.Error("set default error")
+func TestLoadConfigErrors(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	tests := [][]string{
+		{"--testnet", "--regtest"},
+		{"--prune=550", "--txindex"},
+		{"--prune=550", "--addrindex"},
+		{"--prune=100"},
+		{"--txindex", "--droptxindex"},
+		{"--relaynonstd", "--rejectnonstd"},
+		{"--addpeer=10.0.0.1", "--connect=10.0.0.2"},
+		{"--notls", "--rpclisten=0.0.0.0"},
+		{"--banduration=500ms"},
+		{"--debuglevel=loud"},
+		{"--profile=80"},
+		{"--rpcuser=bob", "--rpclimituser=bob"},
+		{"--torisolation"},
+		{"--unknownoption"},
+		{"nonflag"},
+	}
+	for _, args := range tests {
+		if _, err := LoadConfig(append([]string{"--datadir=" + dataDir}, args...)); err == nil {
+			t.Errorf("%v: no error", args)
+		}
 	}
-	fmt.Println(viper.GetString("rpc.user"))
+}
 
-	viper.SetDefault("Log.Level", "debug")
+func TestLoadConfigASMap(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
 
-	fmt.Println(viper.GetString("Log.Level"))
+	// A relative asmap is read from the data directory of the network.
+	cfg, err := LoadConfig([]string{"--datadir=" + dataDir, "--regtest", "--asmap=ip_asn.map"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dataDir, "regtest", "ip_asn.map"); cfg.ASMap != want {
+		t.Errorf("asmap %s, want %s", cfg.ASMap, want)
+	}
+	absolute := filepath.Join(dataDir, "other.map")
+	cfg, err = LoadConfig([]string{"--datadir=" + dataDir, "--asmap=" + absolute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ASMap != absolute {
+		t.Errorf("asmap %s, want %s", cfg.ASMap, absolute)
+	}
+}
+
+func TestLoadConfigWhitebind(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	// The whitebinds get the default port of the network, and take the
+	// place of the default listener.
+	cfg, err := LoadConfig([]string{"--datadir=" + dataDir, "--regtest",
+		"--whitebind=relay,noban@127.0.0.1", "--whitebind=all@[::1]:1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"relay,noban@127.0.0.1:18444", "all@[::1]:1234"}
+	if !reflect.DeepEqual(cfg.Whitebinds, want) {
+		t.Errorf("whitebinds %v, want %v", cfg.Whitebinds, want)
+	}
+	if len(cfg.Listeners) != 0 {
+		t.Errorf("listeners %v, want none", cfg.Listeners)
+	}
+}
+
+func TestLoadConfigProxy(t *testing.T) {
+	dataDir := tempDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	// The proxies get the default port of tor, and the node stops listening
+	// behind the proxy.
+	cfg, err := LoadConfig([]string{"--datadir=" + dataDir, "--proxy=127.0.0.1",
+		"--onion=[::1]:9150", "--torisolation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Proxy != "127.0.0.1:9050" || cfg.OnionProxy != "[::1]:9150" {
+		t.Errorf("proxies %s and %s", cfg.Proxy, cfg.OnionProxy)
+	}
+	if !cfg.DisableListen || !cfg.OnionReachable() {
+		t.Errorf("listening %v, onion reachable %v", !cfg.DisableListen, cfg.OnionReachable())
+	}
+
+	cfg, err = LoadConfig([]string{"--datadir=" + dataDir, "--proxy=127.0.0.1", "--noonion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OnionReachable() {
+		t.Error("onion reachable with noonion")
+	}
+	if _, err := cfg.oniondial("tcp", "expyuzz4wqqyqhjn.onion:8333", 0); err == nil {
+		t.Error("onion dialed with noonion")
+	}
 }
@@ -27,6 +27,10 @@ const (
 
 	DefaultAcceptDataCarrier = true
 
+	// DefaultMaxOrphanTransactions Default for -maxorphantx, maximum number of
+	// orphan transactions kept in memory
+	DefaultMaxOrphanTransactions = 100
+
 	// MaxOpReturnRelay bytes (+1 for OP_RETURN, +2 for the pushdata opcodes)
 	MaxOpReturnRelay uint = 83
 )
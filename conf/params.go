@@ -0,0 +1,49 @@
+package conf
+
+import (
+	"path/filepath"
+
+	"github.com/btcboost/copernicus/net/msg"
+)
+
+// netParams pairs the parameters of a network with the ports the local
+// servers listen on by default when running on it.
+type netParams struct {
+	*msg.BitcoinParams
+	rpcPort  string
+	restPort string
+}
+
+var mainNetParams = netParams{
+	BitcoinParams: &msg.MainNetParams,
+	rpcPort:       "8334",
+	restPort:      "8332",
+}
+
+var testNet3Params = netParams{
+	BitcoinParams: &msg.TestNet3Params,
+	rpcPort:       "18334",
+	restPort:      "18332",
+}
+
+var regressionNetParams = netParams{
+	BitcoinParams: &msg.RegressionNetParams,
+	rpcPort:       "18445",
+	restPort:      "18443",
+}
+
+var simNetParams = netParams{
+	BitcoinParams: &msg.SimNetParams,
+	rpcPort:       "18556",
+	restPort:      "18557",
+}
+
+// netDataDir returns the directory the data of the network is stored in
+// below dataDir.  The main network keeps its data in dataDir itself, so that
+// the data of existing nodes stays where it is.
+func netDataDir(dataDir string, params *netParams) string {
+	if params.BitcoinParams == mainNetParams.BitcoinParams {
+		return dataDir
+	}
+	return filepath.Join(dataDir, params.Name)
+}
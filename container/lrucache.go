@@ -40,17 +40,17 @@ func (lru *LRUCache) Add(k, v interface{}) error {
 	}
 	if element, exist := lru.cacheMap[k]; exist {
 		lru.dataList.MoveToFront(element)
-		element.Value = v
+		element.Value.(*KeyValue).Value = v
 		return nil
 	}
-	node := lru.dataList.PushFront(v)
+	node := lru.dataList.PushFront(&KeyValue{Key: k, Value: v})
 	lru.cacheMap[k] = node
 	if lru.dataList.Len() > lru.Length {
 		lastElement := lru.dataList.Back()
 		if lastElement == nil {
 			return nil
 		}
-		delete(lru.cacheMap, k)
+		delete(lru.cacheMap, lastElement.Value.(*KeyValue).Key)
 		lru.dataList.Remove(lastElement)
 
 	}
@@ -66,7 +66,7 @@ func (lru *LRUCache) Get(k interface{}) (interface{}, bool, error) {
 	}
 	if element, exist := lru.cacheMap[k]; exist {
 		lru.dataList.MoveToFront(element)
-		return element.Value, true, nil
+		return element.Value.(*KeyValue).Value, true, nil
 	}
 	return nil, false, nil
 }
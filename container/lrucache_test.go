@@ -0,0 +1,36 @@
+package container
+
+import (
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	lru := NewLRUCache(2)
+	lru.Add(1, "one")
+	lru.Add(2, "two")
+	if _, ok, _ := lru.Get(1); !ok {
+		t.Errorf("Get(1) failed, expected it in the cache")
+	}
+	lru.Add(3, "three")
+	if lru.Size() != 2 {
+		t.Errorf("get lru size failed, Got %d, expected 2", lru.Size())
+	}
+	if lru.Exists(2) {
+		t.Errorf("the least recently used key 2 was not evicted")
+	}
+	if !lru.Exists(1) || !lru.Exists(3) {
+		t.Errorf("the keys 1 and 3 should be in the cache")
+	}
+	value, ok, err := lru.Get(3)
+	if err != nil || !ok || value.(string) != "three" {
+		t.Errorf("Get(3) failed, Got %v, expected three", value)
+	}
+	lru.Add(1, "uno")
+	value, _, _ = lru.Get(1)
+	if value.(string) != "uno" {
+		t.Errorf("Get(1) failed, Got %v, expected uno", value)
+	}
+	if !lru.Remove(1) || lru.Exists(1) {
+		t.Errorf("Remove(1) failed")
+	}
+}
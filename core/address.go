@@ -135,3 +135,25 @@ func AddressFromScriptHash(script []byte) (*Address, error) {
 	return address, err
 
 }
+
+// ScriptPubKey returns the standard output script paying to the address: a
+// pay-to-pubkey-hash script for key addresses and a pay-to-script-hash script
+// for script addresses.
+func (address *Address) ScriptPubKey() ([]byte, error) {
+	script := Script{}
+	switch address.version {
+	case PublicKeyToAddress, PublicKeyToAddressInTest:
+		script.PushOpCode(OP_DUP)
+		script.PushOpCode(OP_HASH160)
+		script.PushData(address.hash160[:])
+		script.PushOpCode(OP_EQUALVERIFY)
+		script.PushOpCode(OP_CHECKSIG)
+	case ScriptToAddress, ScriptToAddressInTest:
+		script.PushOpCode(OP_HASH160)
+		script.PushData(address.hash160[:])
+		script.PushOpCode(OP_EQUAL)
+	default:
+		return nil, errors.Errorf("unsupported address version %d", address.version)
+	}
+	return script.GetScriptByte(), nil
+}
@@ -107,3 +107,29 @@ func TestPrivateKeyFromHex(t *testing.T) {
 	//	t.Error(err.Error())
 	//}
 }
+
+func TestAddressScriptPubKey(t *testing.T) {
+	address, err := AddressFromString("1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := address.ScriptPubKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(script) != "76a9149a1c78a507689f6f54b847ad1cef1e614ee23f1e88ac" {
+		t.Errorf("unexpected P2PKH script %x", script)
+	}
+
+	address, err = AddressFromHash160(address.hash160[:], ScriptToAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err = address.ScriptPubKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(script) != "a9149a1c78a507689f6f54b847ad1cef1e614ee23f1e87" {
+		t.Errorf("unexpected P2SH script %x", script)
+	}
+}
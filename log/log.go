@@ -12,7 +12,14 @@ import (
 )
 
 func init() {
-	initLogger(conf.GetDataPath(), "debug") // todo configure via config file
+	initLogger(conf.GetDataPath(), "debug")
+}
+
+// Init writes the log to the directory dir at the level strLevel, replacing
+// the log set up before the configuration was loaded.
+func Init(dir, strLevel string) error {
+	logs.GetBeeLogger().DelLogger(logs.AdapterFile)
+	return initLogger(dir, strLevel)
 }
 
 type logConfig struct {
@@ -5,18 +5,30 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	httpprof "net/http/pprof"
 	"os"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/conf"
+	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/database"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/mining"
 	"github.com/btcboost/copernicus/net/msg"
 	"github.com/btcboost/copernicus/net/p2p"
+	"github.com/btcboost/copernicus/net/protocol"
 	"github.com/btcboost/copernicus/rpc"
 	"github.com/btcboost/copernicus/utils"
+	"github.com/jessevdk/go-flags"
 
-	_ "github.com/btcboost/copernicus/log"
+	"github.com/btcboost/copernicus/log"
 )
 
 func init() {
@@ -30,19 +42,102 @@ func btcMain() error {
 }
 
 func main() {
-	logs.Info("application is running")
-	startBitcoin()
-	rpcServer, err := setupRPCServer()
+	if err := conf.InitAppConfig(os.Args[1:]); err != nil {
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			fmt.Println(err)
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "Use copernicus --help to show the options")
+		os.Exit(1)
+	}
+	if conf.AppConf.ShowVersion {
+		fmt.Println("copernicus version", protocol.Copernicus)
+		os.Exit(0)
+	}
+	if err := log.Init(conf.AppConf.LogDir, conf.AppConf.DebugLevel); err != nil {
+		panic(err)
+	}
+	logs.Info("application is running on %s", msg.ActiveNetParams.Name)
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		panic(err)
+	}
+	defer stopProfiling()
+	if err := setupPolicy(); err != nil {
+		panic(err)
+	}
+	if err := blockchain.LoadMempool(msg.ActiveNetParams, conf.GetDataPath()); err != nil {
+		logs.Error("failed to load the mempool: %v, continuing anyway", err)
+	}
+	// Dumped once the peers stopped adding to the memPool.
+	defer func() {
+		if err := blockchain.DumpMempool(conf.GetDataPath()); err != nil {
+			logs.Error("failed to dump the mempool: %v", err)
+		}
+	}()
+	peerManager, peerDB, err := startBitcoin()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		logs.Info("gracefully shutting down the server ....")
+		peerManager.Stop()
+		peerManager.WaitForShutdown()
+		peerDB.Close()
+		logs.Info("server shutdown complete")
+	}()
+	if err := setupCoinbase(); err != nil {
+		panic(err)
+	}
+	if conf.AppConf.BlockStrategy != "" {
+		if err := mining.SetStrategy(conf.AppConf.BlockStrategy); err != nil {
+			panic(err)
+		}
+	}
+	cpuMiner, err := setupCPUMiner()
 	if err != nil {
 		panic(err)
 	}
-	rpcServer.Start()
+	rpcServer, err := setupRPCServer(cpuMiner, peerManager)
+	if err != nil {
+		panic(err)
+	}
+	// There is no RPC server with --norpc.
+	if rpcServer != nil {
+		rpcServer.Start()
+		defer rpcServer.Stop()
+	}
+	if conf.AppConf.Rest {
+		restServer := rpc.NewRestServer(conf.AppConf.RESTListen)
+		if err := restServer.Start(); err != nil {
+			panic(err)
+		}
+		defer restServer.Stop()
+	}
+	if conf.AppConf.Generate {
+		if err := cpuMiner.Start(); err != nil {
+			panic(err)
+		}
+	}
+	stratumServer, err := setupStratumServer()
+	if err != nil {
+		panic(err)
+	}
+	if stratumServer != nil {
+		if err := stratumServer.Start(); err != nil {
+			panic(err)
+		}
+		defer stratumServer.Stop()
+	}
 	if err := btcMain(); err != nil {
 		os.Exit(1)
 	}
 }
 
-func startBitcoin() error {
+// startBitcoin opens the peer database and starts the peer manager.  The
+// database must be closed once the peer manager is stopped.
+func startBitcoin() (*p2p.PeerManager, *database.DBWrapper, error) {
 	path := conf.AppConf.DataDir + "/peer"
 	exists := utils.PathExists(path)
 	if !exists {
@@ -55,29 +150,155 @@ func startBitcoin() error {
 	})
 	if err != nil {
 		fmt.Println("InitDB:", err.Error())
-		return err
+		return nil, nil, err
 	}
-	defer db.Close()
 	fmt.Println("InitDB finish")
-	peerManager, err := p2p.NewPeerManager(conf.AppConf.Listeners, *db, msg.ActiveNetParams)
+	peerManager, err := p2p.NewPeerManager(conf.AppConf.Listeners, db, msg.ActiveNetParams)
 	if err != nil {
 		fmt.Printf("unable to start server on %v:%v \n", conf.AppConf.Listeners, err)
-		return err
+		db.Close()
+		return nil, nil, err
 	}
 	fmt.Println("PeerManager Init")
-	//defer func() {
-	//	fmt.Println("gracefully shutting down the server ....")
-	//	peerManager.Stop()
-	//	peerManager.WaitForShutdown()
-	//	fmt.Println("server shutdown complete")
-	//}()
-
 	peerManager.Start()
+	return peerManager, db, nil
+}
+
+// startProfiling serves the HTTP profiles of the runtime with --profile and
+// writes a CPU profile with --cpuprofile.  The returned function stops the CPU
+// profile.
+func startProfiling() (func(), error) {
+	if conf.AppConf.Profile != "" {
+		listenAddr := net.JoinHostPort("127.0.0.1", conf.AppConf.Profile)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", httpprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", httpprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", httpprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", httpprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", httpprof.Trace)
+		mux.Handle("/", http.RedirectHandler("/debug/pprof/", http.StatusSeeOther))
+		go func() {
+			logs.Info("Profile server listening on %s", listenAddr)
+			logs.Error("Profile server: %v", http.ListenAndServe(listenAddr, mux))
+		}()
+	}
+
+	if conf.AppConf.CPUProfile == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(conf.AppConf.CPUProfile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the CPU profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to start the CPU profile: %v", err)
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}, nil
+}
+
+// setupPolicy applies the --minrelaytxfee and --maxorphantx options to the
+// relay policy.
+func setupPolicy() error {
+	minRelayTxFee, err := utils.NewAmount(conf.AppConf.MinRelayTxFee)
+	if err != nil {
+		return fmt.Errorf("invalid minrelaytxfee: %v", err)
+	}
+	blockchain.GMinRelayTxFee.SataoshisPerK = int64(minRelayTxFee)
+	blockchain.GOrphanPool = mempool.NewOrphanPool(conf.AppConf.MaxOrphanTxs,
+		mempool.DefaultMaxOrphanPoolSize)
 	return nil
 }
 
-func setupRPCServer() (*rpc.Server, error) {
-	if !conf.CFG.DisableRPC {
+// miningScripts returns the output scripts of the addresses given with
+// --miningaddr.
+func miningScripts() ([][]byte, error) {
+	coinbaseScripts := make([][]byte, 0, len(conf.AppConf.MiningAddrs))
+	for _, str := range conf.AppConf.MiningAddrs {
+		addr, err := core.AddressFromString(str)
+		if err != nil {
+			return nil, fmt.Errorf("mining address '%s' failed to decode: %v", str, err)
+		}
+		script, err := addr.ScriptPubKey()
+		if err != nil {
+			return nil, fmt.Errorf("mining address '%s' is not supported: %v", str, err)
+		}
+		coinbaseScripts = append(coinbaseScripts, script)
+	}
+	return coinbaseScripts, nil
+}
+
+// setupCoinbase applies the --coinbasetag and --coinbasepayout options to the
+// coinbase of generated blocks.
+func setupCoinbase() error {
+	if err := mining.SetCoinbaseFlag(conf.AppConf.CoinbaseTag); err != nil {
+		return err
+	}
+	payouts := make([]mining.CoinbasePayout, 0, len(conf.AppConf.CoinbasePayouts))
+	for _, str := range conf.AppConf.CoinbasePayouts {
+		fields := strings.SplitN(str, ":", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("coinbase payout '%s' is not of the form <address>:<weight>", str)
+		}
+		weight, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("coinbase payout '%s' has an invalid weight: %v", str, err)
+		}
+		addr, err := core.AddressFromString(fields[0])
+		if err != nil {
+			return fmt.Errorf("coinbase payout address '%s' failed to decode: %v", fields[0], err)
+		}
+		script, err := addr.ScriptPubKey()
+		if err != nil {
+			return fmt.Errorf("coinbase payout address '%s' is not supported: %v", fields[0], err)
+		}
+		payouts = append(payouts, mining.CoinbasePayout{Script: script, Weight: uint32(weight)})
+	}
+	return mining.SetCoinbasePayouts(payouts)
+}
+
+// setupCPUMiner creates the CPU miner paying to the addresses given with
+// --miningaddr, or to the coinbase payouts.
+func setupCPUMiner() (*mining.CPUMiner, error) {
+	coinbaseScripts, err := miningScripts()
+	if err != nil {
+		return nil, err
+	}
+	if conf.AppConf.Generate && len(coinbaseScripts) == 0 && len(mining.CoinbasePayouts()) == 0 {
+		return nil, errors.New("the generate flag is set, but there are no mining " +
+			"addresses or coinbase payouts specified")
+	}
+	return mining.NewCPUMiner(msg.ActiveNetParams, coinbaseScripts), nil
+}
+
+// setupStratumServer creates the stratum server when --stratumlisten is
+// given.  It pays to the addresses given with --miningaddr, or to the coinbase
+// payouts.
+func setupStratumServer() (*mining.StratumServer, error) {
+	if len(conf.AppConf.StratumListeners) == 0 {
+		return nil, nil
+	}
+	coinbaseScripts, err := miningScripts()
+	if err != nil {
+		return nil, err
+	}
+	if len(coinbaseScripts) == 0 && len(mining.CoinbasePayouts()) == 0 {
+		return nil, errors.New("the stratumlisten option is set, but there are " +
+			"no mining addresses or coinbase payouts specified")
+	}
+	return mining.NewStratumServer(&mining.StratumConfig{
+		ChainParams:     msg.ActiveNetParams,
+		Listeners:       conf.AppConf.StratumListeners,
+		CoinbaseScripts: coinbaseScripts,
+		Difficulty:      conf.AppConf.StratumDifficulty,
+	}), nil
+}
+
+func setupRPCServer(cpuMiner *mining.CPUMiner, peerManager *p2p.PeerManager) (*rpc.Server, error) {
+	if !conf.AppConf.DisableRPC {
 		// Setup listeners for the configured RPC listen addresses and
 		// TLS settings.
 		rpcListeners, err := rpc.SetupRPCListeners()
@@ -90,9 +311,10 @@ func setupRPCServer() (*rpc.Server, error) {
 
 		rpcServer, err := rpc.NewServer(&rpc.ServerConfig{
 			Listeners: rpcListeners,
+			CPUMiner:  cpuMiner,
+			ConnMgr:   rpc.NewConnManager(peerManager),
 			// todo open
 			//StartupTime: s.startupTime,
-			//ConnMgr: &rpcConnManager{&s},
 			//SyncMgr:     &rpcSyncMgr{&s, s.syncManager},
 			//TimeSource:  s.timeSource,
 			//Chain:       s.chain,
@@ -100,7 +322,6 @@ func setupRPCServer() (*rpc.Server, error) {
 			//DB:          db,
 			//TxMemPool:   s.txMemPool,
 			//Generator:   blockTemplateGenerator,
-			//CPUMiner:    s.cpuMiner,
 			//TxIndex:     s.txIndex,
 			//AddrIndex:   s.addrIndex,
 		})
@@ -0,0 +1,67 @@
+package mempool
+
+import (
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
+	"github.com/btcboost/copernicus/utxo"
+)
+
+// CoinsViewMemPool is a view of the coins of Base, and of the outputs of the
+// transactions in Pools, which the transactions entering a pool may spend.
+// It is read only.  The caller holds the locks of the pools while it uses the
+// view.
+type CoinsViewMemPool struct {
+	Base  utxo.CoinsView
+	Pools []*TxMempool
+}
+
+// NewCoinsViewMemPool returns a view of the coins of base and of the outputs
+// of the transactions in pools.
+func NewCoinsViewMemPool(base utxo.CoinsView, pools ...*TxMempool) *CoinsViewMemPool {
+	return &CoinsViewMemPool{Base: base, Pools: pools}
+}
+
+// GetCoin looks the outpoint up in the pools first, a transaction in a pool
+// never conflicts with the coins of Base.
+func (view *CoinsViewMemPool) GetCoin(point *core.OutPoint, coin *utxo.Coin) bool {
+	for _, pool := range view.Pools {
+		entry, ok := pool.PoolData[point.Hash]
+		if !ok {
+			continue
+		}
+		if int(point.Index) >= len(entry.Tx.Outs) {
+			return false
+		}
+		*coin = *utxo.NewCoin(entry.Tx.Outs[point.Index], MEMPOOL_HEIGHT, false)
+		return true
+	}
+	if view.Base == nil {
+		return false
+	}
+	return view.Base.GetCoin(point, coin)
+}
+
+func (view *CoinsViewMemPool) HaveCoin(point *core.OutPoint) bool {
+	for _, pool := range view.Pools {
+		if entry, ok := pool.PoolData[point.Hash]; ok {
+			return int(point.Index) < len(entry.Tx.Outs)
+		}
+	}
+	return view.Base != nil && view.Base.HaveCoin(point)
+}
+
+func (view *CoinsViewMemPool) GetBestBlock() utils.Hash {
+	if view.Base == nil {
+		return utils.Hash{}
+	}
+	return view.Base.GetBestBlock()
+}
+
+// BatchWrite refuses the writes, the view is read only.
+func (view *CoinsViewMemPool) BatchWrite(coinsMap utxo.CacheCoins, hash *utils.Hash) bool {
+	return false
+}
+
+func (view *CoinsViewMemPool) EstimateSize() uint64 {
+	return 0
+}
@@ -0,0 +1,82 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
+	"github.com/btcboost/copernicus/utxo"
+)
+
+// testCoinsView is a chain state holding the coins of coins.
+type testCoinsView map[core.OutPoint]*utxo.Coin
+
+func (view testCoinsView) GetCoin(point *core.OutPoint, coin *utxo.Coin) bool {
+	c, ok := view[*point]
+	if ok {
+		*coin = *c
+	}
+	return ok
+}
+
+func (view testCoinsView) HaveCoin(point *core.OutPoint) bool {
+	_, ok := view[*point]
+	return ok
+}
+
+func (view testCoinsView) GetBestBlock() utils.Hash {
+	return utils.HashOne
+}
+
+func (view testCoinsView) BatchWrite(coinsMap utxo.CacheCoins, hash *utils.Hash) bool {
+	return false
+}
+
+func (view testCoinsView) EstimateSize() uint64 {
+	return 0
+}
+
+func TestCoinsViewMemPool(t *testing.T) {
+	confirmed := core.NewOutPoint(utils.HashOne, 0)
+	base := testCoinsView{*confirmed: utxo.NewCoin(core.NewTxOut(5000, []byte{core.OP_TRUE}), 10, false)}
+
+	// The stem pool tx spends the memPool tx, which spends a confirmed coin.
+	memPool := NewTxMempool()
+	memPoolTx := createOrphanTx(utils.HashOne, 0, 2)
+	memPool.PoolData[memPoolTx.Hash] = &TxEntry{Tx: memPoolTx}
+	stemPool := NewTxMempool()
+	stemTx := createOrphanTx(memPoolTx.Hash, 0, 1)
+	stemPool.PoolData[stemTx.Hash] = &TxEntry{Tx: stemTx}
+
+	tests := []struct {
+		name     string
+		view     *CoinsViewMemPool
+		outPoint *core.OutPoint
+		height   uint32
+		have     bool
+	}{
+		{"confirmed coin", NewCoinsViewMemPool(base, memPool), confirmed, 10, true},
+		{"unknown coin", NewCoinsViewMemPool(base, memPool), core.NewOutPoint(utils.HashOne, 1), 0, false},
+		{"memPool output", NewCoinsViewMemPool(base, memPool), core.NewOutPoint(memPoolTx.Hash, 1), MEMPOOL_HEIGHT, true},
+		{"missing memPool output", NewCoinsViewMemPool(base, memPool), core.NewOutPoint(memPoolTx.Hash, 2), 0, false},
+		{"memPool output seen by the stem", NewCoinsViewMemPool(base, stemPool, memPool),
+			core.NewOutPoint(memPoolTx.Hash, 0), MEMPOOL_HEIGHT, true},
+		{"stem output", NewCoinsViewMemPool(base, stemPool, memPool), core.NewOutPoint(stemTx.Hash, 0), MEMPOOL_HEIGHT, true},
+		{"stem output hidden from the memPool", NewCoinsViewMemPool(base, memPool),
+			core.NewOutPoint(stemTx.Hash, 0), 0, false},
+		{"without chain state", NewCoinsViewMemPool(nil, memPool), confirmed, 0, false},
+	}
+	for _, test := range tests {
+		if have := test.view.HaveCoin(test.outPoint); have != test.have {
+			t.Errorf("%s: have coin %v, want %v", test.name, have, test.have)
+		}
+		coin := utxo.NewEmptyCoin()
+		if found := test.view.GetCoin(test.outPoint, coin); found != test.have {
+			t.Errorf("%s: coin found %v, want %v", test.name, found, test.have)
+			continue
+		}
+		if test.have && coin.GetHeight() != test.height {
+			t.Errorf("%s: coin of height %d, want %d", test.name, coin.GetHeight(), test.height)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package mempool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
+)
+
+const (
+	// DefaultMaxOrphanPoolSize maximum sum of all orphan transaction sizes in bytes
+	DefaultMaxOrphanPoolSize = 5 * 1000000
+	// MaxOrphanTxSize the largest orphan transaction we are willing to keep.
+	// Ignoring large transactions prevents a peer from filling the orphan pool
+	// with a few maximum size transactions.
+	MaxOrphanTxSize = 100000
+	// OrphanTxExpireTime expiration time for orphan transactions
+	OrphanTxExpireTime = 20 * time.Minute
+	// OrphanTxExpireInterval minimum amount of time in between scans of the
+	// orphan pool to evict expired transactions
+	OrphanTxExpireInterval = 5 * time.Minute
+)
+
+// OrphanTx is a transaction whose inputs are not all available in the main
+// chain or the memPool yet.
+type OrphanTx struct {
+	Tx *core.Tx
+	// Tag identifies the peer which sent this orphan, it is used to remove
+	// all orphans of a peer together when it disconnects or misbehaves.
+	Tag        int64
+	Expiration time.Time
+	size       int
+}
+
+// OrphanPool is safe for concurrent write And read access.
+type OrphanPool struct {
+	sync.RWMutex
+	// orphans store the orphan transaction by txid
+	orphans map[utils.Hash]*OrphanTx
+	// orphansByPrev key is a missing outpoint, value is all orphans spending it.
+	orphansByPrev map[core.OutPoint]map[utils.Hash]*OrphanTx
+	// totalSize sum of all orphan's serialize size
+	totalSize      int
+	maxCount       int
+	maxSize        int
+	nextExpireScan time.Time
+}
+
+func NewOrphanPool(maxCount, maxSize int) *OrphanPool {
+	return &OrphanPool{
+		orphans:        make(map[utils.Hash]*OrphanTx),
+		orphansByPrev:  make(map[core.OutPoint]map[utils.Hash]*OrphanTx),
+		maxCount:       maxCount,
+		maxSize:        maxSize,
+		nextExpireScan: time.Now().Add(OrphanTxExpireInterval),
+	}
+}
+
+// AddOrphan add the tx to the orphan pool, the oldest entries are expired and
+// random entries are evicted when the pool is over its count or size limits.
+// A non-nil error is returned when the tx is refused.
+func (o *OrphanPool) AddOrphan(tx *core.Tx, tag int64) error {
+	o.Lock()
+	defer o.Unlock()
+
+	tx.TxHash()
+	if _, ok := o.orphans[tx.Hash]; ok {
+		return nil
+	}
+
+	size := tx.SerializeSize()
+	if size > MaxOrphanTxSize {
+		return fmt.Errorf("orphan transaction size of %d bytes is larger than max allowed size of %d bytes",
+			size, MaxOrphanTxSize)
+	}
+	if o.maxCount <= 0 {
+		return fmt.Errorf("orphan transaction %s refused, the orphan pool is disabled", tx.Hash.ToString())
+	}
+
+	o.limitOrphans(time.Now(), o.maxCount-1, o.maxSize-size)
+
+	otx := &OrphanTx{
+		Tx:         tx,
+		Tag:        tag,
+		Expiration: time.Now().Add(OrphanTxExpireTime),
+		size:       size,
+	}
+	o.orphans[tx.Hash] = otx
+	for _, txin := range tx.Ins {
+		if _, ok := o.orphansByPrev[*txin.PreviousOutPoint]; !ok {
+			o.orphansByPrev[*txin.PreviousOutPoint] = make(map[utils.Hash]*OrphanTx)
+		}
+		o.orphansByPrev[*txin.PreviousOutPoint][tx.Hash] = otx
+	}
+	o.totalSize += size
+
+	logs.Debug("stored orphan transaction %s (total: %d, size: %d)", tx.Hash.ToString(), len(o.orphans), o.totalSize)
+	return nil
+}
+
+// limitOrphans expire the timeout orphans, then randomly evict orphans until
+// the number of orphans is not more than maxCount and their sum size is not
+// more than maxSize.
+func (o *OrphanPool) limitOrphans(now time.Time, maxCount int, maxSize int) int {
+	removed := 0
+	if now.After(o.nextExpireScan) {
+		for _, otx := range o.orphans {
+			if now.After(otx.Expiration) {
+				removed += o.removeOrphan(otx.Tx, true)
+			}
+		}
+		o.nextExpireScan = now.Add(OrphanTxExpireInterval)
+		if removed > 0 {
+			logs.Debug("expired %d orphan transactions (%d remaining)", removed, len(o.orphans))
+		}
+	}
+
+	evicted := 0
+	for len(o.orphans) > 0 && (len(o.orphans) > maxCount || o.totalSize > maxSize) {
+		// Go's map iteration order is not a strong enough source of
+		// randomness, so pick the evicted orphan with an explicit random index.
+		target := utils.GetRandInt(len(o.orphans))
+		i := 0
+		for _, otx := range o.orphans {
+			if i == target {
+				o.removeOrphan(otx.Tx, false)
+				evicted++
+				break
+			}
+			i++
+		}
+	}
+	if evicted > 0 {
+		logs.Debug("orphan pool overflow, removed %d tx", evicted)
+	}
+	return removed + evicted
+}
+
+// removeOrphan remove the tx from the orphan pool, if removeRedeemers is set,
+// all the orphans which spend the tx's outputs are removed recursively.
+// Return the number of removed orphans.
+func (o *OrphanPool) removeOrphan(tx *core.Tx, removeRedeemers bool) int {
+	otx, ok := o.orphans[tx.Hash]
+	if !ok {
+		return 0
+	}
+
+	for _, txin := range otx.Tx.Ins {
+		orphans, ok := o.orphansByPrev[*txin.PreviousOutPoint]
+		if !ok {
+			continue
+		}
+		delete(orphans, tx.Hash)
+		if len(orphans) == 0 {
+			delete(o.orphansByPrev, *txin.PreviousOutPoint)
+		}
+	}
+	delete(o.orphans, tx.Hash)
+	o.totalSize -= otx.size
+	removed := 1
+
+	if removeRedeemers {
+		for i := range tx.Outs {
+			outPoint := core.OutPoint{Hash: tx.Hash, Index: uint32(i)}
+			for _, redeemer := range o.orphansByPrev[outPoint] {
+				removed += o.removeOrphan(redeemer.Tx, true)
+			}
+		}
+	}
+	return removed
+}
+
+// RemoveOrphan remove the tx and all orphans spending its outputs.
+func (o *OrphanPool) RemoveOrphan(tx *core.Tx) int {
+	o.Lock()
+	defer o.Unlock()
+	return o.removeOrphan(tx, true)
+}
+
+// RemoveOrphanSelf remove only the tx, the orphans spending its outputs are
+// kept, which is used when the tx has been accepted into memPool.
+func (o *OrphanPool) RemoveOrphanSelf(tx *core.Tx) int {
+	o.Lock()
+	defer o.Unlock()
+	return o.removeOrphan(tx, false)
+}
+
+// RemoveOrphansByTag remove all orphans sent by the peer identified by tag.
+// Return the number of removed orphans.
+func (o *OrphanPool) RemoveOrphansByTag(tag int64) int {
+	o.Lock()
+	defer o.Unlock()
+
+	removed := 0
+	for _, otx := range o.orphans {
+		if otx.Tag == tag {
+			removed += o.removeOrphan(otx.Tx, true)
+		}
+	}
+	return removed
+}
+
+// RemoveOrphansForBlock remove the orphans included in the block, and the
+// orphans double spending an input of the block's transactions; the latter
+// can never be valid any more.
+func (o *OrphanPool) RemoveOrphansForBlock(txs []*core.Tx) int {
+	o.Lock()
+	defer o.Unlock()
+
+	removed := 0
+	for _, tx := range txs {
+		removed += o.removeOrphan(tx, false)
+		if tx.IsCoinBase() {
+			continue
+		}
+		for _, txin := range tx.Ins {
+			for _, conflict := range o.orphansByPrev[*txin.PreviousOutPoint] {
+				removed += o.removeOrphan(conflict.Tx, true)
+			}
+		}
+	}
+	if removed > 0 {
+		logs.Debug("erased %d orphan tx included or conflicted by block", removed)
+	}
+	return removed
+}
+
+// OrphansSpending return all orphans which spend one of the tx's outputs.
+// The returned orphans are still in the pool, the caller should remove them
+// when they are accepted or rejected.
+func (o *OrphanPool) OrphansSpending(tx *core.Tx) []*OrphanTx {
+	o.RLock()
+	defer o.RUnlock()
+
+	seen := make(map[utils.Hash]struct{})
+	ret := make([]*OrphanTx, 0)
+	for i := range tx.Outs {
+		outPoint := core.OutPoint{Hash: tx.Hash, Index: uint32(i)}
+		for hash, otx := range o.orphansByPrev[outPoint] {
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			seen[hash] = struct{}{}
+			ret = append(ret, otx)
+		}
+	}
+	return ret
+}
+
+func (o *OrphanPool) HaveOrphan(hash utils.Hash) bool {
+	o.RLock()
+	defer o.RUnlock()
+	_, ok := o.orphans[hash]
+	return ok
+}
+
+func (o *OrphanPool) GetOrphan(hash utils.Hash) *OrphanTx {
+	o.RLock()
+	defer o.RUnlock()
+	return o.orphans[hash]
+}
+
+// Count return the number of orphans in the pool.
+func (o *OrphanPool) Count() int {
+	o.RLock()
+	defer o.RUnlock()
+	return len(o.orphans)
+}
+
+// TotalSize return the sum size of all orphans in the pool.
+func (o *OrphanPool) TotalSize() int {
+	o.RLock()
+	defer o.RUnlock()
+	return o.totalSize
+}
+
+// SetLimits change the pool's count and size limit, orphans exceeding the
+// new limits are evicted immediately.
+func (o *OrphanPool) SetLimits(maxCount, maxSize int) {
+	o.Lock()
+	defer o.Unlock()
+	o.maxCount = maxCount
+	o.maxSize = maxSize
+	o.limitOrphans(time.Now(), maxCount, maxSize)
+}
@@ -0,0 +1,138 @@
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func createOrphanTx(prevHash utils.Hash, prevIndex uint32, outs int) *core.Tx {
+	tx := core.NewTx()
+	tx.Ins = make([]*core.TxIn, 1)
+	tx.Ins[0] = core.NewTxIn(core.NewOutPoint(prevHash, prevIndex), []byte{core.OP_11})
+	tx.Outs = make([]*core.TxOut, outs)
+	for i := 0; i < outs; i++ {
+		tx.Outs[i] = core.NewTxOut(10000, []byte{core.OP_11, core.OP_EQUAL})
+	}
+	tx.Hash = tx.TxHash()
+	return tx
+}
+
+func TestOrphanPoolAddAndRemove(t *testing.T) {
+	pool := NewOrphanPool(10, DefaultMaxOrphanPoolSize)
+
+	parent := createOrphanTx(utils.HashOne, 0, 2)
+	child := createOrphanTx(parent.Hash, 0, 1)
+	grandChild := createOrphanTx(child.Hash, 0, 1)
+	for _, tx := range []*core.Tx{parent, child, grandChild} {
+		if err := pool.AddOrphan(tx, 1); err != nil {
+			t.Fatalf("add orphan failed : %v", err)
+		}
+	}
+	if pool.Count() != 3 {
+		t.Errorf("the orphan pool should have 3 element, actual number is : %d", pool.Count())
+	}
+	if !pool.HaveOrphan(child.Hash) {
+		t.Errorf("the orphan %s should be in pool", child.Hash.ToString())
+	}
+
+	spending := pool.OrphansSpending(parent)
+	if len(spending) != 1 || spending[0].Tx.Hash != child.Hash {
+		t.Errorf("the orphan spending parent should only be child")
+	}
+
+	// remove the parent, all its orphan descendants should be removed.
+	if removed := pool.RemoveOrphan(parent); removed != 3 {
+		t.Errorf("remove orphan should remove 3 tx, actual number is : %d", removed)
+	}
+	if pool.Count() != 0 || pool.TotalSize() != 0 {
+		t.Errorf("the orphan pool should be empty, count : %d, size : %d", pool.Count(), pool.TotalSize())
+	}
+	if len(pool.orphansByPrev) != 0 {
+		t.Errorf("the orphan pool prevout index should be empty, actual number is : %d", len(pool.orphansByPrev))
+	}
+}
+
+func TestOrphanPoolRemoveByTag(t *testing.T) {
+	pool := NewOrphanPool(10, DefaultMaxOrphanPoolSize)
+
+	for i := 0; i < 4; i++ {
+		tx := createOrphanTx(*utils.GetRandHash(), 0, 1)
+		if err := pool.AddOrphan(tx, int64(i%2)); err != nil {
+			t.Fatalf("add orphan failed : %v", err)
+		}
+	}
+	if removed := pool.RemoveOrphansByTag(1); removed != 2 {
+		t.Errorf("remove by tag should remove 2 tx, actual number is : %d", removed)
+	}
+	if pool.Count() != 2 {
+		t.Errorf("the orphan pool should have 2 element, actual number is : %d", pool.Count())
+	}
+}
+
+func TestOrphanPoolLimit(t *testing.T) {
+	pool := NewOrphanPool(5, DefaultMaxOrphanPoolSize)
+
+	for i := 0; i < 20; i++ {
+		tx := createOrphanTx(*utils.GetRandHash(), 0, 1)
+		if err := pool.AddOrphan(tx, 0); err != nil {
+			t.Fatalf("add orphan failed : %v", err)
+		}
+		if pool.Count() > 5 {
+			t.Fatalf("the orphan pool exceeds its count limit, actual number is : %d", pool.Count())
+		}
+	}
+
+	tx := createOrphanTx(*utils.GetRandHash(), 0, 1)
+	size := tx.SerializeSize()
+	pool.SetLimits(5, 2*size)
+	if pool.Count() > 2 {
+		t.Errorf("the orphan pool exceeds its size limit, actual number is : %d", pool.Count())
+	}
+
+	// expire all the orphans
+	pool.Lock()
+	removed := pool.limitOrphans(time.Now().Add(OrphanTxExpireTime+OrphanTxExpireInterval), 5, 2*size)
+	pool.Unlock()
+	if removed != 2 || pool.Count() != 0 {
+		t.Errorf("all orphans should be expired, removed : %d, remaining : %d", removed, pool.Count())
+	}
+}
+
+func TestOrphanPoolRemoveForBlock(t *testing.T) {
+	pool := NewOrphanPool(10, DefaultMaxOrphanPoolSize)
+
+	prevHash := *utils.GetRandHash()
+	orphan := createOrphanTx(prevHash, 0, 1)
+	conflict := createOrphanTx(prevHash, 1, 1)
+	conflict.Ins = append(conflict.Ins, core.NewTxIn(core.NewOutPoint(prevHash, 0), []byte{core.OP_12}))
+	conflict.Hash = utils.Hash{}
+	conflict.Hash = conflict.TxHash()
+	other := createOrphanTx(*utils.GetRandHash(), 0, 1)
+	for _, tx := range []*core.Tx{orphan, conflict, other} {
+		if err := pool.AddOrphan(tx, 0); err != nil {
+			t.Fatalf("add orphan failed : %v", err)
+		}
+	}
+
+	// the block contains orphan, so conflict double spends the block.
+	if removed := pool.RemoveOrphansForBlock([]*core.Tx{orphan}); removed != 2 {
+		t.Errorf("remove for block should remove 2 tx, actual number is : %d", removed)
+	}
+	if !pool.HaveOrphan(other.Hash) || pool.Count() != 1 {
+		t.Errorf("only the unrelated orphan should be kept, actual number is : %d", pool.Count())
+	}
+}
+
+func TestOrphanPoolRejectLargeTx(t *testing.T) {
+	pool := NewOrphanPool(10, DefaultMaxOrphanPoolSize)
+	tx := createOrphanTx(utils.HashOne, 0, 1)
+	tx.Outs[0] = core.NewTxOut(10000, make([]byte, MaxOrphanTxSize))
+	tx.Hash = utils.Hash{}
+	tx.Hash = tx.TxHash()
+	if err := pool.AddOrphan(tx, 0); err == nil {
+		t.Error("the orphan larger than MaxOrphanTxSize should be refused")
+	}
+}
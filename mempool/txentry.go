@@ -13,7 +13,10 @@ type TxEntry struct {
 	Tx     *core.Tx
 	TxSize int
 	// txFee tis transaction fee
-	TxFee    int64
+	TxFee int64
+	// feeDelta used for prioritisetransaction, it is added to the TxFee
+	// when calculate the ancestor and descendant fee.
+	feeDelta int64
 	TxHeight int
 	// sigOpCount sigop plus P2SH sigops count
 	SigOpCount int
@@ -29,6 +32,14 @@ type TxEntry struct {
 	lp core.LockPoints
 	// spendsCoinBase keep track of transactions that spend a coinBase
 	spendsCoinbase bool
+	// startingPriority the coin age priority of the tx when entering the memPool
+	startingPriority float64
+	// priorityHeight the chain height startingPriority was computed at
+	priorityHeight int
+	// inChainInputValue sum of the tx's inputs which are confirmed in the chain
+	inChainInputValue utils.Amount
+	// modifiedSize the tx size priority is computed with
+	modifiedSize int
 	//Statistics Information for every txentry with its ancestors And descend.
 	StatisInformation
 }
@@ -51,6 +62,28 @@ func (t *TxEntry) GetSigOpCountWithAncestors() int64 {
 	return t.SumSigOpCountWithAncestors
 }
 
+// GetModifiedFee return the tx fee with the fee delta of prioritisetransaction.
+func (t *TxEntry) GetModifiedFee() int64 {
+	return t.TxFee + t.feeDelta
+}
+
+func (t *TxEntry) GetFeeDelta() int64 {
+	return t.feeDelta
+}
+
+// UpdateFeeDelta set the new fee delta, and update the entry's own ancestor
+// and descendant fee with the change.
+func (t *TxEntry) UpdateFeeDelta(feeDelta int64) {
+	t.SumFeeWithDescendants += feeDelta - t.feeDelta
+	t.SumFeeWithAncestors += feeDelta - t.feeDelta
+	t.feeDelta = feeDelta
+}
+
+// GetTime return the local time when the tx entered the memPool.
+func (t *TxEntry) GetTime() int64 {
+	return t.time
+}
+
 func (t *TxEntry) GetUsageSize() int64 {
 	return int64(t.usageSize)
 }
@@ -67,6 +100,36 @@ func (t *TxEntry) GetSpendsCoinbase() bool {
 	return t.spendsCoinbase
 }
 
+// SetStartingPriority set the coin age priority the tx has at the chain
+// height, with inChainInputValue the value of its inputs confirmed by then.
+func (t *TxEntry) SetStartingPriority(priority float64, height int, inChainInputValue utils.Amount) {
+	t.startingPriority = priority
+	t.priorityHeight = height
+	t.inChainInputValue = inChainInputValue
+	t.modifiedSize = t.Tx.CalculateModifiedSize()
+}
+
+// GetStartingPriority return the priority of the tx when entering the memPool.
+func (t *TxEntry) GetStartingPriority() float64 {
+	return t.startingPriority
+}
+
+// GetPriority return the coin age priority of the tx at currentHeight: the
+// starting priority plus the age its confirmed inputs gained since then.
+func (t *TxEntry) GetPriority(currentHeight int) float64 {
+	if t.modifiedSize == 0 || currentHeight <= t.priorityHeight {
+		return t.startingPriority
+	}
+	deltaPriority := float64(currentHeight-t.priorityHeight) * float64(t.inChainInputValue) / float64(t.modifiedSize)
+	return t.startingPriority + deltaPriority
+}
+
+// AllowFree return whether a tx of the priority is high enough in priority to
+// be mined without paying a fee: one coin one day old per 250 bytes.
+func AllowFree(priority float64) bool {
+	return priority > float64(utils.COIN)*144/250
+}
+
 // UpdateParent update the tx's parent transaction.
 func (t *TxEntry) UpdateParent(parent *TxEntry, innerUsage *int64, add bool) {
 	if add {
@@ -141,9 +204,10 @@ func (t *TxEntry) GetFeeRate() *utils.FeeRate {
 
 func (t *TxEntry) GetInfo() *TxMempoolInfo {
 	return &TxMempoolInfo{
-		Tx:      t.Tx,
-		Time:    t.time,
-		FeeRate: *t.GetFeeRate(),
+		Tx:       t.Tx,
+		Time:     t.time,
+		FeeRate:  *t.GetFeeRate(),
+		FeeDelta: t.feeDelta,
 	}
 }
 
@@ -2,6 +2,7 @@ package mempool
 
 import (
 	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
 	"github.com/google/btree"
 	"testing"
 )
@@ -25,3 +26,31 @@ func TestGetTxFromMemPool(t *testing.T) {
 	}
 
 }
+
+func TestTxEntryPriority(t *testing.T) {
+	tx := core.NewTx()
+	tx.Outs = []*core.TxOut{core.NewTxOut(1000, []byte{core.OP_TRUE})}
+	entry := NewTxentry(tx, 0, 0, 11, core.LockPoints{}, 0, false)
+	entry.SetStartingPriority(100, 10, utils.Amount(utils.COIN))
+
+	if got := entry.GetStartingPriority(); got != 100 {
+		t.Errorf("starting priority %v, want 100", got)
+	}
+	if got := entry.GetPriority(10); got != 100 {
+		t.Errorf("priority at the entry height %v, want 100", got)
+	}
+	want := 100 + 2*float64(utils.COIN)/float64(tx.CalculateModifiedSize())
+	if got := entry.GetPriority(12); got != want {
+		t.Errorf("priority two blocks later %v, want %v", got, want)
+	}
+}
+
+func TestAllowFree(t *testing.T) {
+	threshold := float64(utils.COIN) * 144 / 250
+	if AllowFree(threshold) {
+		t.Error("priority at the threshold allowed free")
+	}
+	if !AllowFree(threshold + 1) {
+		t.Error("priority above the threshold not allowed free")
+	}
+}
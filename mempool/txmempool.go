@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/conf"
 	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/utils"
 	"github.com/btcboost/copernicus/utxo"
@@ -58,6 +61,25 @@ type TxMempool struct {
 	TotalTxSize uint64
 	//transactionsUpdated mempool update transaction total number when create mempool late.
 	TransactionsUpdated uint64
+	// mapDeltas store the priority and fee deltas set by prioritisetransaction,
+	// they are kept even if the transaction isn't in mempool yet.
+	mapDeltas map[utils.Hash]TxDelta
+	// rollingMinimumFeeRate the minimum fee rate (satoshi per KB) to enter the
+	// mempool, it is bumped when TrimToSize evicts transactions, and decays
+	// after the next block is connected.
+	rollingMinimumFeeRate        float64
+	lastRollingFeeUpdate         int64
+	blockSinceLastRollingFeeBump bool
+}
+
+// RollingFeeHalfLife the half life of the rolling minimum fee in seconds, it
+// is shortened when the mempool is far from full.
+const RollingFeeHalfLife = 60 * 60 * 12
+
+// TxDelta the priority and fee deltas of a transaction, the fee delta is in satoshi.
+type TxDelta struct {
+	PriorityDelta float64
+	FeeDelta      int64
 }
 
 func (m *TxMempool) GetCacheUsage() int64 {
@@ -72,6 +94,14 @@ func (m *TxMempool) GetCheckFrequency() float64 {
 	return m.checkFrequency
 }
 
+// GetTransactionsUpdated returns the sequence number of the mempool, which is
+// increased every time its transactions change.
+func (m *TxMempool) GetTransactionsUpdated() uint64 {
+	m.RLock()
+	defer m.RUnlock()
+	return m.TransactionsUpdated
+}
+
 func (m *TxMempool) GetCoin(outpoint *core.OutPoint) *utxo.Coin {
 	m.RLock()
 	defer m.RUnlock()
@@ -145,11 +175,11 @@ func (m *TxMempool) Check(coins *utxo.CoinsViewCache, bestHeight int) {
 		nCountCheck := int64(len(setAncestors)) + 1
 		nSizeCheck := int64(entry.TxSize)
 		nSigOpCheck := int64(entry.SigOpCount)
-		nFeesCheck := entry.TxFee
+		nFeesCheck := entry.GetModifiedFee()
 		for ancestorIt := range setAncestors {
 			nSizeCheck += int64(ancestorIt.TxSize)
 			nSigOpCheck += int64(ancestorIt.SigOpCount)
-			nFeesCheck += ancestorIt.TxFee
+			nFeesCheck += ancestorIt.GetModifiedFee()
 		}
 		if entry.SumTxCountWithAncestors != nCountCheck {
 			panic("the txentry's ancestors number is incorrect .")
@@ -253,6 +283,8 @@ func (m *TxMempool) RemoveTxSelf(txs []*core.Tx) {
 
 	// todo base on entries to set the new feerate for mempool.
 
+	m.lastRollingFeeUpdate = time.Now().Unix()
+	m.blockSinceLastRollingFeeBump = true
 	for _, tx := range txs {
 		if entry, ok := m.PoolData[tx.Hash]; ok {
 			stage := make(map[*TxEntry]struct{})
@@ -260,7 +292,87 @@ func (m *TxMempool) RemoveTxSelf(txs []*core.Tx) {
 			m.RemoveStaged(stage, true, BLOCK)
 		}
 		m.removeConflicts(tx)
+		m.clearPrioritisation(tx.Hash)
+	}
+}
+
+// PrioritiseTransaction accumulate the priority and fee deltas of the
+// transaction. The fee delta changes the transaction's modified fee, which
+// is used by block assembling and TrimToSize eviction; it is applied to the
+// entry in mempool now, or the entry added later. Nothing is changed when the
+// ancestors of the entry in mempool can't be calculated.
+func (m *TxMempool) PrioritiseTransaction(hash utils.Hash, priorityDelta float64, feeDelta int64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delta := m.mapDeltas[hash]
+	delta.PriorityDelta += priorityDelta
+	delta.FeeDelta += feeDelta
+
+	if entry, ok := m.PoolData[hash]; ok {
+		nNoLimit := uint64(math.MaxUint64)
+		ancestors, err := m.CalculateMemPoolAncestors(entry.Tx, nNoLimit, nNoLimit, nNoLimit, nNoLimit, false)
+		if err != nil {
+			logs.Error("PrioritiseTransaction: can't calculate the ancestors of %s: %v", hash.ToString(), err)
+			return err
+		}
+		descendants := make(map[*TxEntry]struct{})
+		m.CalculateDescendants(entry, descendants)
+
+		// the ancestor fee of the entry and its descendants will be changed,
+		// which is the sort key, so remove them from the sorted tree firstly.
+		for descendant := range descendants {
+			m.TxByAncestorFeeRateSort.Delete(EntryAncestorFeeRateSort(*descendant))
+		}
+
+		modifyFee := delta.FeeDelta - entry.feeDelta
+		entry.UpdateFeeDelta(delta.FeeDelta)
+		for ancestor := range ancestors {
+			ancestor.UpdateDescendantState(0, 0, modifyFee)
+		}
+		for descendant := range descendants {
+			if descendant != entry {
+				descendant.UpdateAncestorState(0, 0, 0, modifyFee)
+			}
+			m.TxByAncestorFeeRateSort.ReplaceOrInsert(EntryAncestorFeeRateSort(*descendant))
+		}
+		m.TransactionsUpdated++
 	}
+	m.mapDeltas[hash] = delta
+	logs.Info("PrioritiseTransaction: %s priority += %f, fee += %d", hash.ToString(), priorityDelta, feeDelta)
+	return nil
+}
+
+// ApplyDeltas return the priority and fee deltas of the transaction.
+func (m *TxMempool) ApplyDeltas(hash utils.Hash) (float64, int64) {
+	m.RLock()
+	defer m.RUnlock()
+
+	delta := m.mapDeltas[hash]
+	return delta.PriorityDelta, delta.FeeDelta
+}
+
+// ClearPrioritisation remove the deltas of the transaction.
+func (m *TxMempool) ClearPrioritisation(hash utils.Hash) {
+	m.Lock()
+	defer m.Unlock()
+	m.clearPrioritisation(hash)
+}
+
+func (m *TxMempool) clearPrioritisation(hash utils.Hash) {
+	delete(m.mapDeltas, hash)
+}
+
+// GetDeltas return a copy of all the deltas set by prioritisetransaction.
+func (m *TxMempool) GetDeltas() map[utils.Hash]TxDelta {
+	m.RLock()
+	defer m.RUnlock()
+
+	deltas := make(map[utils.Hash]TxDelta, len(m.mapDeltas))
+	for hash, delta := range m.mapDeltas {
+		deltas[hash] = delta
+	}
+	return deltas
 }
 
 // AddTx operator is safe for concurrent write And read access.
@@ -276,6 +388,12 @@ func (m *TxMempool) AddTx(txentry *TxEntry, limitAncestorCount uint64,
 		return err
 	}
 
+	// Apply the fee delta of prioritisetransaction before the entry is
+	// accounted into its ancestors' state.
+	if delta, ok := m.mapDeltas[txentry.Tx.Hash]; ok && delta.FeeDelta != 0 {
+		txentry.UpdateFeeDelta(delta.FeeDelta)
+	}
+
 	// insert new txEntry to the memPool; and update the memPool's memory consume.
 	m.timeSortData.ReplaceOrInsert(txentry)
 	m.PoolData[txentry.Tx.Hash] = txentry
@@ -335,7 +453,14 @@ func (m *TxMempool) TrimToSize(sizeLimit int64) []*core.OutPoint {
 		if rem.Tx.Hash != removeIt.Tx.Hash {
 			panic("the two element should have the same Txhash")
 		}
-		maxFeeRateRemove = utils.NewFeeRateWithSize(removeIt.SumFeeWithDescendants, removeIt.SumSizeWithDescendants).SataoshisPerK
+		// the package feerate of the removed tx plus the incremental relay fee
+		// is the new minimum fee rate to enter the mempool.
+		removed := utils.NewFeeRateWithSize(removeIt.SumFeeWithDescendants, removeIt.SumSizeWithDescendants).SataoshisPerK
+		removed += conf.GlobalValueInstance.GetIncrementalRelayFee().SataoshisPerK
+		m.trackPackageRemoved(removed)
+		if removed > maxFeeRateRemove {
+			maxFeeRateRemove = removed
+		}
 		stage := make(map[*TxEntry]struct{})
 		m.CalculateDescendants(&removeIt, stage)
 		nTxnRemoved += len(stage)
@@ -363,10 +488,58 @@ func (m *TxMempool) TrimToSize(sizeLimit int64) []*core.OutPoint {
 
 	}
 
-	logs.SetLogger("mempool", fmt.Sprintf("removed %d txn, rolling minimum fee bumped : %d", nTxnRemoved, maxFeeRateRemove))
+	if maxFeeRateRemove > 0 {
+		logs.Debug("mempool removed %d txn, rolling minimum fee bumped to %d", nTxnRemoved, maxFeeRateRemove)
+	}
 	return ret
 }
 
+// trackPackageRemoved bump the rolling minimum fee rate to the removed
+// package's fee rate when it is higher.
+func (m *TxMempool) trackPackageRemoved(rate int64) {
+	if float64(rate) > m.rollingMinimumFeeRate {
+		m.rollingMinimumFeeRate = float64(rate)
+		m.blockSinceLastRollingFeeBump = false
+	}
+}
+
+// GetMinFee return the minimum fee rate to get into the mempool, which may
+// be around the incremental relay fee rate or zero when the mempool isn't
+// full. The rolling minimum fee decays with the half life RollingFeeHalfLife,
+// which is shortened when the mempool usage is well below the sizeLimit.
+func (m *TxMempool) GetMinFee(sizeLimit int64) utils.FeeRate {
+	m.Lock()
+	defer m.Unlock()
+
+	incrementalRelayFee := conf.GlobalValueInstance.GetIncrementalRelayFee()
+	if !m.blockSinceLastRollingFeeBump || m.rollingMinimumFeeRate == 0 {
+		return utils.FeeRate{SataoshisPerK: int64(m.rollingMinimumFeeRate)}
+	}
+
+	now := time.Now().Unix()
+	if now > m.lastRollingFeeUpdate+10 {
+		halfLife := float64(RollingFeeHalfLife)
+		if m.cacheInnerUsage < sizeLimit/4 {
+			halfLife /= 4
+		} else if m.cacheInnerUsage < sizeLimit/2 {
+			halfLife /= 2
+		}
+
+		m.rollingMinimumFeeRate /= math.Pow(2.0, float64(now-m.lastRollingFeeUpdate)/halfLife)
+		m.lastRollingFeeUpdate = now
+
+		if m.rollingMinimumFeeRate < float64(incrementalRelayFee.SataoshisPerK)/2 {
+			m.rollingMinimumFeeRate = 0
+			return utils.FeeRate{SataoshisPerK: 0}
+		}
+	}
+
+	if int64(m.rollingMinimumFeeRate) > incrementalRelayFee.SataoshisPerK {
+		return utils.FeeRate{SataoshisPerK: int64(m.rollingMinimumFeeRate)}
+	}
+	return incrementalRelayFee
+}
+
 // Expire all transaction (and their dependencies) in the memPool older
 // than time. Return the number of removed transactions.
 func (m *TxMempool) Expire(time int64) int {
@@ -392,13 +565,20 @@ func (m *TxMempool) Expire(time int64) int {
 
 func (m *TxMempool) FindTx(hash utils.Hash) *core.Tx {
 	m.RLock()
-	m.RUnlock()
+	defer m.RUnlock()
 	if find, ok := m.PoolData[hash]; ok {
 		return find.Tx
 	}
 	return nil
 }
 
+// FindEntry return the memPool entry of the transaction, nil if not found.
+func (m *TxMempool) FindEntry(hash utils.Hash) *TxEntry {
+	m.RLock()
+	defer m.RUnlock()
+	return m.PoolData[hash]
+}
+
 func (m *TxMempool) Exists(hash utils.Hash) bool {
 	has := m.FindTx(hash)
 	return has != nil
@@ -439,7 +619,7 @@ func (m *TxMempool) updateForRemoveFromMempool(entriesToRemove map[*TxEntry]stru
 			m.CalculateDescendants(removeIt, setDescendants)
 			delete(setDescendants, removeIt)
 			modifySize := -removeIt.TxSize
-			modifyFee := -removeIt.TxFee
+			modifyFee := -removeIt.GetModifiedFee()
 			modifySigOps := -removeIt.SigOpCount
 
 			for dit := range setDescendants {
@@ -565,7 +745,7 @@ func (m *TxMempool) updateAncestorsOf(add bool, txentry *TxEntry, ancestors map[
 		updateCount = 1
 	}
 	updateSize := updateCount * txentry.TxSize
-	updateFee := int64(updateCount) * txentry.TxFee
+	updateFee := int64(updateCount) * txentry.GetModifiedFee()
 	// update each of ancestors transaction state;
 	for ancestorit := range ancestors {
 		//fmt.Println("ancestor hash : ", ancestorit.Tx.Hash.ToString())
@@ -580,7 +760,7 @@ func (m *TxMempool) UpdateEntryForAncestors(entry *TxEntry, setAncestors map[*Tx
 	updateSigOpsCount := 0
 
 	for ancestorIt := range setAncestors {
-		updateFee += ancestorIt.TxFee
+		updateFee += ancestorIt.GetModifiedFee()
 		updateSigOpsCount += ancestorIt.SigOpCount
 		updateSize += ancestorIt.TxSize
 	}
@@ -694,6 +874,54 @@ func (m *TxMempool) InfoAll() []*TxMempoolInfo {
 	return ret
 }
 
+// DefaultFeeHistogramBinSize the size in bytes of the first bucket of the
+// fee histogram, the following buckets grow by 10% each.
+const DefaultFeeHistogramBinSize = 100000
+
+// FeeHistogramBucket the total size of the transactions paying at least
+// FeeRate, and less than the FeeRate of the previous bucket.
+type FeeHistogramBucket struct {
+	// FeeRate in satoshi per byte
+	FeeRate float64
+	Size    int64
+}
+
+// GetFeeHistogram group the transactions by fee rate in descending order,
+// each bucket holds about binSize bytes of transactions, and the bin size
+// grows by 10% for each next bucket, so the low fee buckets are coarser.
+func (m *TxMempool) GetFeeHistogram(binSize int64) []FeeHistogramBucket {
+	m.RLock()
+	defer m.RUnlock()
+
+	sizeByRate := make(map[float64]int64)
+	for _, entry := range m.PoolData {
+		feeRate := float64(entry.TxFee) / float64(entry.TxSize)
+		sizeByRate[feeRate] += int64(entry.TxSize)
+	}
+	feeRates := make([]float64, 0, len(sizeByRate))
+	for feeRate := range sizeByRate {
+		feeRates = append(feeRates, feeRate)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(feeRates)))
+
+	ret := make([]FeeHistogramBucket, 0)
+	bin := float64(binSize)
+	cumSize := int64(0)
+	// overflow is the sum size exceeding the previous buckets' bin size, it
+	// is taken into account so the buckets don't drift from the bin size.
+	overflow := float64(0)
+	for i, feeRate := range feeRates {
+		cumSize += sizeByRate[feeRate]
+		if float64(cumSize)+overflow > bin || i == len(feeRates)-1 {
+			ret = append(ret, FeeHistogramBucket{FeeRate: feeRate, Size: cumSize})
+			overflow += float64(cumSize) - bin
+			cumSize = 0
+			bin *= 1.1
+		}
+	}
+	return ret
+}
+
 func (m *TxMempool) Size() int {
 	m.RLock()
 	defer m.RUnlock()
@@ -708,6 +936,7 @@ func NewTxMempool() *TxMempool {
 	t.timeSortData = *btree.New(32)
 	t.rootTx = make(map[utils.Hash]*TxEntry)
 	t.TxByAncestorFeeRateSort = *btree.New(32)
+	t.mapDeltas = make(map[utils.Hash]TxDelta)
 	return t
 }
 
@@ -2,6 +2,7 @@ package mempool
 
 import (
 	"fmt"
+	"github.com/btcboost/copernicus/conf"
 	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/utils"
 	"github.com/google/btree"
@@ -292,3 +293,102 @@ func TestTxMempoolTrimToSize(t *testing.T) {
 	}
 	fmt.Printf("============= end ============\n")
 }
+
+func TestTxMempoolPrioritiseTransaction(t *testing.T) {
+	testPool := NewTxMempool()
+	noLimit := uint64(math.MaxUint64)
+
+	set := createTx()
+	// the delta of the tx not in the pool is applied when the tx is added.
+	testPool.PrioritiseTransaction(set[1].Tx.Hash, 0, 3000)
+	for _, e := range set {
+		testPool.AddTx(e, noLimit, noLimit, noLimit, noLimit, true)
+	}
+	if set[1].GetModifiedFee() != set[1].TxFee+3000 {
+		t.Errorf("the modified fee should be %d, actual is : %d", set[1].TxFee+3000, set[1].GetModifiedFee())
+	}
+
+	// set[2] spends set[0], the delta should be accounted into both of them.
+	testPool.PrioritiseTransaction(set[2].Tx.Hash, 0, 1000)
+	testPool.PrioritiseTransaction(set[2].Tx.Hash, 0, 500)
+	if set[2].GetFeeDelta() != 1500 {
+		t.Errorf("the fee delta should be accumulated to 1500, actual is : %d", set[2].GetFeeDelta())
+	}
+	if set[2].SumFeeWithAncestors != set[0].TxFee+set[2].TxFee+1500 {
+		t.Errorf("the ancestor fee is error, actual is : %d", set[2].SumFeeWithAncestors)
+	}
+	if set[0].SumFeeWithDescendants != set[0].TxFee+set[2].TxFee+1500 {
+		t.Errorf("the descendant fee is error, actual is : %d", set[0].SumFeeWithDescendants)
+	}
+	if testPool.TxByAncestorFeeRateSort.Len() != len(set) {
+		t.Errorf("the sorted entry number should be %d, actual is : %d", len(set), testPool.TxByAncestorFeeRateSort.Len())
+	}
+
+	_, feeDelta := testPool.ApplyDeltas(set[2].Tx.Hash)
+	if feeDelta != 1500 {
+		t.Errorf("the applied fee delta should be 1500, actual is : %d", feeDelta)
+	}
+
+	testPool.RemoveTxSelf([]*core.Tx{set[1].Tx})
+	if _, ok := testPool.GetDeltas()[set[1].Tx.Hash]; ok {
+		t.Errorf("the delta of the tx %s included in block should be cleared", set[1].Tx.Hash.ToString())
+	}
+}
+
+func TestTxMempoolRollingMinFee(t *testing.T) {
+	testPool := NewTxMempool()
+	noLimit := uint64(math.MaxUint64)
+
+	set := createTx()
+	for _, e := range set {
+		testPool.AddTx(e, noLimit, noLimit, noLimit, noLimit, true)
+	}
+	sizeLimit := testPool.cacheInnerUsage
+	if fee := testPool.GetMinFee(sizeLimit); fee.GetFeePerK() != 0 {
+		t.Errorf("the min fee should be 0 before any eviction, actual is : %d", fee.GetFeePerK())
+	}
+
+	// the evicted package fee rate is 0, so the rolling fee is bumped to
+	// the incremental relay fee.
+	testPool.TrimToSize(1)
+	incrementalRelayFee := conf.GlobalValueInstance.GetIncrementalRelayFee()
+	if fee := testPool.GetMinFee(sizeLimit); fee.GetFeePerK() != incrementalRelayFee.GetFeePerK() {
+		t.Errorf("the min fee should be bumped to %d, actual is : %d", incrementalRelayFee.GetFeePerK(), fee.GetFeePerK())
+	}
+
+	// the rolling fee decays only after a block is connected.
+	testPool.RemoveTxSelf([]*core.Tx{})
+	testPool.lastRollingFeeUpdate -= 10 * RollingFeeHalfLife
+	if fee := testPool.GetMinFee(sizeLimit); fee.GetFeePerK() != 0 {
+		t.Errorf("the min fee should decay to 0, actual is : %d", fee.GetFeePerK())
+	}
+}
+
+func TestTxMempoolFeeHistogram(t *testing.T) {
+	testPool := NewTxMempool()
+	noLimit := uint64(math.MaxUint64)
+
+	testEntryHelp := NewTestMemPoolEntry()
+	set := createTx()
+	for i, e := range set {
+		entry := testEntryHelp.SetFee(utils.Amount(1000 * (i + 1))).FromTxToEntry(e.Tx)
+		testPool.AddTx(entry, noLimit, noLimit, noLimit, noLimit, true)
+	}
+
+	// every bucket holds one tx with bin size of 1 byte.
+	buckets := testPool.GetFeeHistogram(1)
+	if len(buckets) != len(set) {
+		t.Fatalf("the histogram should have %d buckets, actual number is : %d", len(set), len(buckets))
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].FeeRate >= buckets[i-1].FeeRate {
+			t.Errorf("the buckets should be in descending fee rate order, index : %d", i)
+		}
+	}
+
+	// a huge bin size groups all the tx into one bucket.
+	buckets = testPool.GetFeeHistogram(DefaultFeeHistogramBinSize)
+	if len(buckets) != 1 || buckets[0].Size != int64(testPool.TotalTxSize) {
+		t.Errorf("the histogram should have only one bucket of all the tx, actual buckets : %v", buckets)
+	}
+}
@@ -1,7 +1,185 @@
 package mining
 
-// todo define Coinbase Flag for miner or pool
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
 const (
-	CoinbaseFlag             = ""
 	maxCoinbaseScriptsigSize = 100
+
+	// MaxCoinbaseFlagSize is the longest coinbase flag which fits the
+	// signature script along with the pushes of the block height and of the
+	// largest extra nonce, which take up to 15 bytes.
+	MaxCoinbaseFlagSize = maxCoinbaseScriptsigSize - 15
+
+	// MaxCoinbaseCommitmentSize is the largest data a commitment output of
+	// the coinbase may carry, so that the output stays standard.
+	MaxCoinbaseCommitmentSize = int(core.MaxOpReturnRelay) - 3
 )
+
+// CoinbasePayout is an output of the coinbase which receives Weight parts of
+// the block reward out of the sum of the weights of all payouts.
+type CoinbasePayout struct {
+	Script []byte
+	Weight uint32
+}
+
+// coinbaseConfig holds how the node builds the coinbase of its blocks.
+var coinbaseConfig struct {
+	sync.RWMutex
+	flag        string
+	payouts     []CoinbasePayout
+	commitments [][]byte
+}
+
+// CoinbaseFlag returns the operator tag the coinbase signature script ends
+// with.
+func CoinbaseFlag() string {
+	coinbaseConfig.RLock()
+	defer coinbaseConfig.RUnlock()
+	return coinbaseConfig.flag
+}
+
+// SetCoinbaseFlag sets the operator tag the coinbase signature script ends
+// with.
+func SetCoinbaseFlag(flag string) error {
+	if len(flag) > MaxCoinbaseFlagSize {
+		return fmt.Errorf("coinbase flag length of %d is out of range (max: %d)",
+			len(flag), MaxCoinbaseFlagSize)
+	}
+	coinbaseConfig.Lock()
+	coinbaseConfig.flag = flag
+	coinbaseConfig.Unlock()
+	return nil
+}
+
+// CoinbasePayouts returns the payouts the reward of the blocks is split
+// between, nil when the reward goes to the single script the block is
+// created for.
+func CoinbasePayouts() []CoinbasePayout {
+	coinbaseConfig.RLock()
+	defer coinbaseConfig.RUnlock()
+	return coinbaseConfig.payouts
+}
+
+// SetCoinbasePayouts splits the reward of every block the node creates
+// between the payouts by their weight, instead of paying it all to the script
+// the block is created for.  No payouts restore the single output.
+func SetCoinbasePayouts(payouts []CoinbasePayout) error {
+	for _, payout := range payouts {
+		if payout.Weight == 0 {
+			return errors.New("coinbase payouts must have a positive weight")
+		}
+	}
+	coinbaseConfig.Lock()
+	coinbaseConfig.payouts = payouts
+	coinbaseConfig.Unlock()
+	return nil
+}
+
+// CoinbaseCommitments returns the data committed to by OP_RETURN outputs of
+// the coinbase.
+func CoinbaseCommitments() [][]byte {
+	coinbaseConfig.RLock()
+	defer coinbaseConfig.RUnlock()
+	return coinbaseConfig.commitments
+}
+
+// SetCoinbaseCommitments replaces the data the coinbase of new blocks commits
+// to, each in a zero value OP_RETURN output.
+func SetCoinbaseCommitments(commitments [][]byte) error {
+	for _, data := range commitments {
+		if len(data) > MaxCoinbaseCommitmentSize {
+			return fmt.Errorf("coinbase commitment length of %d is out of range (max: %d)",
+				len(data), MaxCoinbaseCommitmentSize)
+		}
+	}
+	coinbaseConfig.Lock()
+	coinbaseConfig.commitments = commitments
+	coinbaseConfig.Unlock()
+	return nil
+}
+
+// coinbaseOutputs returns the outputs of a coinbase paying value to
+// coinbaseScript, or split between the configured payouts, followed by the
+// commitment outputs.  Whatever the split by weight leaves over goes to the
+// first payout.
+func coinbaseOutputs(value utils.Amount, coinbaseScript []byte) []*core.TxOut {
+	payouts := CoinbasePayouts()
+	if len(payouts) == 0 {
+		payouts = []CoinbasePayout{{Script: coinbaseScript, Weight: 1}}
+	}
+	commitments := CoinbaseCommitments()
+
+	var totalWeight int64
+	for _, payout := range payouts {
+		totalWeight += int64(payout.Weight)
+	}
+	outs := make([]*core.TxOut, len(payouts), len(payouts)+len(commitments))
+	first := int64(value)
+	for i := 1; i < len(payouts); i++ {
+		// value * weight may overflow an int64
+		share := new(big.Int).Mul(big.NewInt(int64(value)), big.NewInt(int64(payouts[i].Weight)))
+		share.Div(share, big.NewInt(totalWeight))
+		outs[i] = core.NewTxOut(share.Int64(), payouts[i].Script)
+		first -= share.Int64()
+	}
+	outs[0] = core.NewTxOut(first, payouts[0].Script)
+
+	for _, data := range commitments {
+		script := core.Script{}
+		script.PushOpCode(core.OP_RETURN)
+		script.PushData(data)
+		outs = append(outs, core.NewTxOut(0, script.GetScriptByte()))
+	}
+	return outs
+}
+
+// standardCoinbaseScript returns a standard script suitable for use as the
+// signature script of the coinbase transaction of a new block. It starts with
+// the block height that is required by BIP34, followed by the extra nonce and
+// the coinbase flag.
+func standardCoinbaseScript(height int, extraNonce uint64) ([]byte, error) {
+	return coinbaseScript(height, core.NewCScriptNum(int64(extraNonce)).Serialize(), CoinbaseFlag())
+}
+
+// coinbaseScript returns a coinbase signature script made of the block height,
+// the extra nonce pushed as data and the coinbase flag. The extra nonce is
+// always the data right before the flag, which lets stratum jobs split the
+// coinbase around it.
+func coinbaseScript(height int, extraNonce []byte, flag string) ([]byte, error) {
+	sig := core.Script{}
+	sig.PushInt64(int64(height))
+	sig.PushData(extraNonce)
+	scriptBytes := append(sig.GetScriptByte(), []byte(flag)...)
+	if len(scriptBytes) > maxCoinbaseScriptsigSize {
+		return nil, fmt.Errorf("coinbase script length of %d is out of range (max: %d)",
+			len(scriptBytes), maxCoinbaseScriptsigSize)
+	}
+	return scriptBytes, nil
+}
+
+// UpdateExtraNonce replaces the signature script of the coinbase transaction
+// of the passed block with one containing the given extra nonce and
+// recalculates the merkle root of the block accordingly.
+func UpdateExtraNonce(block *core.Block, height int, extraNonce uint64) error {
+	scriptBytes, err := standardCoinbaseScript(height, extraNonce)
+	if err != nil {
+		return err
+	}
+	coinbaseTx := block.Txs[0]
+	coinbaseTx.Ins[0].Script = core.NewScriptRaw(scriptBytes)
+	// the cached hash is stale now that the input script changed
+	coinbaseTx.Hash = utils.HashZero
+	coinbaseTx.TxHash()
+
+	block.BlockHeader.MerkleRoot = msg.BlockMerkleRoot(block, nil)
+	return nil
+}
@@ -0,0 +1,139 @@
+package mining
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestStandardCoinbaseScript(t *testing.T) {
+	tests := []struct {
+		height     int
+		extraNonce uint64
+		want       string
+	}{
+		{1, 0, "5100"},
+		{16, 1, "600101"},
+		{1, 1000, "5102e803"},
+	}
+	for i, test := range tests {
+		script, err := standardCoinbaseScript(test.height, test.extraNonce)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if hex.EncodeToString(script) != test.want {
+			t.Errorf("test %d: got %x, want %s", i, script, test.want)
+		}
+	}
+}
+
+func TestUpdateExtraNonce(t *testing.T) {
+	coinbaseTx := core.NewTx()
+	coinbaseTx.Ins = []*core.TxIn{core.NewTxIn(&core.OutPoint{Hash: utils.HashZero, Index: 0xffffffff}, []byte{0x51, 0x00})}
+	coinbaseTx.Outs = []*core.TxOut{core.NewTxOut(5000000000, []byte{core.OP_TRUE})}
+	block := core.NewBlock()
+	block.Txs = []*core.Tx{coinbaseTx}
+
+	oldHash := coinbaseTx.TxHash()
+	if err := UpdateExtraNonce(block, 1, 7); err != nil {
+		t.Fatal(err)
+	}
+	newHash := coinbaseTx.TxHash()
+	if newHash.IsEqual(&oldHash) {
+		t.Error("coinbase hash did not change with the extra nonce")
+	}
+	if !block.BlockHeader.MerkleRoot.IsEqual(&newHash) {
+		t.Errorf("merkle root %s does not commit to the coinbase %s",
+			block.BlockHeader.MerkleRoot.ToString(), newHash.ToString())
+	}
+}
+
+func TestCoinbaseFlag(t *testing.T) {
+	defer SetCoinbaseFlag("")
+
+	if err := SetCoinbaseFlag("/copernicus/"); err != nil {
+		t.Fatal(err)
+	}
+	script, err := standardCoinbaseScript(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "5100" + hex.EncodeToString([]byte("/copernicus/")); hex.EncodeToString(script) != want {
+		t.Errorf("got %x, want %s", script, want)
+	}
+
+	// The longest flag still fits with the largest height and extra nonce.
+	if err := SetCoinbaseFlag(strings.Repeat("x", MaxCoinbaseFlagSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := standardCoinbaseScript(math.MaxInt32, math.MaxInt64); err != nil {
+		t.Errorf("longest flag: %v", err)
+	}
+	if err := SetCoinbaseFlag(strings.Repeat("x", MaxCoinbaseFlagSize+1)); err == nil {
+		t.Error("too long coinbase flag was accepted")
+	}
+}
+
+func TestCoinbaseOutputs(t *testing.T) {
+	defer SetCoinbasePayouts(nil)
+	defer SetCoinbaseCommitments(nil)
+
+	minerScript := []byte{core.OP_TRUE}
+	outs := coinbaseOutputs(5000000000, minerScript)
+	if len(outs) != 1 || outs[0].Value != 5000000000 || !bytes.Equal(outs[0].Script.GetScriptByte(), minerScript) {
+		t.Fatalf("without payouts the coinbase doesn't pay all to the miner script")
+	}
+
+	poolScript := []byte{core.OP_2}
+	partnerScript := []byte{core.OP_3}
+	err := SetCoinbasePayouts([]CoinbasePayout{
+		{Script: poolScript, Weight: 2},
+		{Script: partnerScript, Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCoinbaseCommitments([][]byte{{0xaa, 0xbb}}); err != nil {
+		t.Fatal(err)
+	}
+
+	outs = coinbaseOutputs(1000, minerScript)
+	if len(outs) != 3 {
+		t.Fatalf("got %d outputs, want 3", len(outs))
+	}
+	// the remainder of the split goes to the first payout
+	if outs[0].Value != 667 || !bytes.Equal(outs[0].Script.GetScriptByte(), poolScript) {
+		t.Errorf("pool output pays %d to %x", outs[0].Value, outs[0].Script.GetScriptByte())
+	}
+	if outs[1].Value != 333 || !bytes.Equal(outs[1].Script.GetScriptByte(), partnerScript) {
+		t.Errorf("partner output pays %d to %x", outs[1].Value, outs[1].Script.GetScriptByte())
+	}
+	if outs[2].Value != 0 || hex.EncodeToString(outs[2].Script.GetScriptByte()) != "6a02aabb" {
+		t.Errorf("commitment output pays %d to %x", outs[2].Value, outs[2].Script.GetScriptByte())
+	}
+
+	// large rewards and weights don't overflow
+	err = SetCoinbasePayouts([]CoinbasePayout{
+		{Script: poolScript, Weight: math.MaxUint32},
+		{Script: partnerScript, Weight: math.MaxUint32},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs = coinbaseOutputs(21000000*utils.Amount(utils.COIN), minerScript)
+	if outs[0].Value != outs[1].Value || outs[0].Value+outs[1].Value != 21000000*utils.COIN {
+		t.Errorf("even split paid %d and %d", outs[0].Value, outs[1].Value)
+	}
+
+	if err := SetCoinbasePayouts([]CoinbasePayout{{Script: poolScript}}); err == nil {
+		t.Error("payout without weight was accepted")
+	}
+	if err := SetCoinbaseCommitments([][]byte{make([]byte, MaxCoinbaseCommitmentSize+1)}); err == nil {
+		t.Error("too large commitment was accepted")
+	}
+}
@@ -0,0 +1,341 @@
+package mining
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+const (
+	// maxNonce is the maximum value a nonce can be in a block header.
+	maxNonce = ^uint32(0)
+
+	// nonceCheckInterval is the number of nonces a worker tries before it
+	// looks for a stop request or a stale chain tip.
+	nonceCheckInterval = 1 << 16
+
+	// staleCheckInterval is how often a worker checks whether the chain tip
+	// it is mining on has been replaced.
+	staleCheckInterval = 15 * time.Second
+)
+
+// defaultNumWorkers is the default number of goroutines grinding nonces.
+var defaultNumWorkers = uint32(runtime.NumCPU())
+
+// CPUMiner provides facilities for solving blocks (mining) using the CPU in a
+// concurrency-safe manner. It is mostly useful for regression and simulation
+// testing, where blocks must be produced on demand.
+//
+// The miner either runs continuously, paying the coinbase to one of its
+// configured scripts, or generates a discrete number of blocks on request.
+// Every template is solved by several goroutines, each rolling its own extra
+// nonce sequence in the coinbase so that no two of them hash the same header.
+type CPUMiner struct {
+	sync.Mutex
+	chainParams     *msg.BitcoinParams
+	coinbaseScripts [][]byte
+	numWorkers      uint32
+	started         bool
+	discreteMining  bool
+	wg              sync.WaitGroup
+	quit            chan struct{}
+}
+
+// NewCPUMiner returns a new CPU miner for the given network. coinbaseScripts
+// is the set of output scripts continuous mining pays to; it may be empty when
+// only discrete generation is used.
+func NewCPUMiner(params *msg.BitcoinParams, coinbaseScripts [][]byte) *CPUMiner {
+	return &CPUMiner{
+		chainParams:     params,
+		coinbaseScripts: coinbaseScripts,
+		numWorkers:      defaultNumWorkers,
+	}
+}
+
+// Start begins continuous mining. Calling it while the miner is already
+// running has no effect.
+func (m *CPUMiner) Start() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.started || m.discreteMining {
+		return nil
+	}
+	if len(m.coinbaseScripts) == 0 {
+		return errors.New("no mining addresses configured")
+	}
+
+	m.quit = make(chan struct{})
+	m.wg.Add(1)
+	go m.generateBlocks(m.quit)
+	m.started = true
+	logs.Info("CPU miner started")
+	return nil
+}
+
+// Stop gracefully stops continuous mining and waits for the workers to exit.
+// Calling it while the miner is not running has no effect.
+func (m *CPUMiner) Stop() {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.started {
+		return
+	}
+	close(m.quit)
+	m.wg.Wait()
+	m.started = false
+	logs.Info("CPU miner stopped")
+}
+
+// IsMining returns whether or not the miner is running continuously.
+func (m *CPUMiner) IsMining() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.started
+}
+
+// NumWorkers returns the number of goroutines used to solve a template.
+func (m *CPUMiner) NumWorkers() int32 {
+	return int32(atomic.LoadUint32(&m.numWorkers))
+}
+
+// SetNumWorkers sets the number of goroutines used to solve a template. A
+// negative value selects the number of available CPUs and zero stops
+// continuous mining. The new value applies from the next template on.
+func (m *CPUMiner) SetNumWorkers(numWorkers int32) {
+	if numWorkers == 0 {
+		m.Stop()
+		return
+	}
+	targetNumWorkers := uint32(numWorkers)
+	if numWorkers < 0 {
+		targetNumWorkers = defaultNumWorkers
+	}
+	atomic.StoreUint32(&m.numWorkers, targetNumWorkers)
+}
+
+// CoinbaseScript returns one of the configured coinbase scripts chosen at
+// random, or nil if none are configured.
+func (m *CPUMiner) CoinbaseScript() []byte {
+	if len(m.coinbaseScripts) == 0 {
+		return nil
+	}
+	return m.coinbaseScripts[rand.Intn(len(m.coinbaseScripts))]
+}
+
+// GenerateNBlocks mines n blocks paying to coinbaseScript and returns their
+// hashes. maxTries bounds the total number of nonces tried over all blocks;
+// zero means no bound. When the tries run out, the hashes of the blocks found
+// so far are returned.
+func (m *CPUMiner) GenerateNBlocks(n uint32, coinbaseScript []byte, maxTries uint64) ([]utils.Hash, error) {
+	m.Lock()
+	if m.started || m.discreteMining {
+		m.Unlock()
+		return nil, errors.New("server is already CPU mining; stop it " +
+			"before calling discrete `generate` commands")
+	}
+	m.discreteMining = true
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		m.discreteMining = false
+		m.Unlock()
+	}()
+
+	var remaining *int64
+	if maxTries != 0 {
+		tries := int64(maxTries)
+		remaining = &tries
+	}
+
+	blockHashes := make([]utils.Hash, 0, n)
+	for uint32(len(blockHashes)) < n {
+		template, height := m.newBlockTemplate(coinbaseScript)
+		block := m.solveBlock(template, height, remaining, nil)
+		if block == nil {
+			if remaining != nil && atomic.LoadInt64(remaining) <= 0 {
+				break
+			}
+			// The chain tip moved while solving, start over on the new one.
+			continue
+		}
+		if err := m.submitBlock(block); err != nil {
+			return blockHashes, err
+		}
+		blockHashes = append(blockHashes, *block.Hash)
+	}
+
+	return blockHashes, nil
+}
+
+// generateBlocks mines continuously until quit is closed, paying each block
+// to a randomly chosen configured coinbase script.
+//
+// This function MUST be run as a goroutine.
+func (m *CPUMiner) generateBlocks(quit chan struct{}) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		template, height := m.newBlockTemplate(m.CoinbaseScript())
+		block := m.solveBlock(template, height, nil, quit)
+		if block == nil {
+			continue
+		}
+		if err := m.submitBlock(block); err != nil {
+			logs.Error("CPU miner: %s", err)
+		}
+	}
+}
+
+// newBlockTemplate creates a template on top of the current tip and returns it
+// along with the height of the block being built.
+func (m *CPUMiner) newBlockTemplate(coinbaseScript []byte) (*BlockTemplate, int) {
+	ba := NewBlockAssembler(m.chainParams)
+	template := ba.CreateNewBlock(coinbaseScript)
+	return template, ba.height
+}
+
+// solveBlock searches for a nonce that satisfies the target of the template.
+// The search is spread over NumWorkers goroutines which each work on their
+// own copy of the block. It returns nil if remaining tries run out, the chain
+// tip moves, or quit is closed before a solution is found.
+func (m *CPUMiner) solveBlock(template *BlockTemplate, height int, remaining *int64,
+	quit <-chan struct{}) *core.Block {
+
+	numWorkers := atomic.LoadUint32(&m.numWorkers)
+	found := make(chan *core.Block)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := uint32(0); i < numWorkers; i++ {
+		wg.Add(1)
+		go m.solveWorker(copyBlock(template.Block), height, uint64(i), uint64(numWorkers),
+			remaining, found, stop, &wg)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var solved *core.Block
+	select {
+	case solved = <-found:
+	case <-done:
+	case <-quit:
+	}
+	close(stop)
+	<-done
+
+	return solved
+}
+
+// solveWorker grinds the nonce of block, moving to the next extra nonce of its
+// sequence (extraNonce, extraNonce+step, ...) each time the nonce range is
+// exhausted. A solved block is sent on found.
+//
+// This function MUST be run as a goroutine.
+func (m *CPUMiner) solveWorker(block *core.Block, height int, extraNonce, step uint64,
+	remaining *int64, found chan<- *core.Block, stop <-chan struct{}, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	pow := blockchain.Pow{}
+	header := &block.BlockHeader
+	lastStaleCheck := time.Now()
+	for {
+		if err := UpdateExtraNonce(block, height, extraNonce); err != nil {
+			logs.Error("CPU miner: %s", err)
+			return
+		}
+
+		for nonce := uint32(0); ; nonce++ {
+			if nonce%nonceCheckInterval == 0 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if time.Since(lastStaleCheck) >= staleCheckInterval {
+					if isStaleTip(&header.HashPrevBlock) {
+						return
+					}
+					lastStaleCheck = time.Now()
+				}
+			}
+			if remaining != nil && atomic.AddInt64(remaining, -1) < 0 {
+				return
+			}
+
+			header.Nonce = nonce
+			hash, _ := header.GetHash()
+			if pow.CheckProofOfWork(&hash, header.Bits, m.chainParams) {
+				block.Hash = &hash
+				select {
+				case found <- block:
+				case <-stop:
+				}
+				return
+			}
+			if nonce == maxNonce {
+				break
+			}
+		}
+		extraNonce += step
+	}
+}
+
+// submitBlock hands a solved block to the chain the same way blocks received
+// from peers are processed.
+func (m *CPUMiner) submitBlock(block *core.Block) error {
+	if isStaleTip(&block.BlockHeader.HashPrevBlock) {
+		return fmt.Errorf("generated block %s is stale", block.Hash.ToString())
+	}
+	if !blockchain.ProcessNewBlock(m.chainParams, block, true, nil) {
+		return fmt.Errorf("generated block %s was not accepted", block.Hash.ToString())
+	}
+
+	logs.Info("CPU miner: block %s submitted, coinbase value %d",
+		block.Hash.ToString(), block.Txs[0].Outs[0].Value)
+	return nil
+}
+
+// isStaleTip returns whether prevHash is no longer the hash of the active
+// chain tip.
+func isStaleTip(prevHash *utils.Hash) bool {
+	tip := blockchain.GChainActive.Tip()
+	if tip == nil {
+		return !prevHash.IsNull()
+	}
+	return !tip.GetBlockHash().IsEqual(prevHash)
+}
+
+// copyBlock returns a copy of block that shares every transaction except the
+// coinbase, which workers rewrite when rolling the extra nonce.
+func copyBlock(block *core.Block) *core.Block {
+	newBlock := core.NewBlock()
+	newBlock.BlockHeader = block.BlockHeader
+	newBlock.Txs = make([]*core.Tx, len(block.Txs))
+	copy(newBlock.Txs, block.Txs)
+	newBlock.Txs[0] = block.Txs[0].Copy()
+	return newBlock
+}
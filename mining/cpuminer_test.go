@@ -0,0 +1,54 @@
+package mining
+
+import (
+	"testing"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/net/msg"
+)
+
+func TestSolveBlockRegtest(t *testing.T) {
+	params := &msg.RegressionNetParams
+	miner := NewCPUMiner(params, nil)
+	miner.SetNumWorkers(2)
+
+	template := newTestTemplate(t, 2)
+	template.Block.BlockHeader.Bits = params.PowLimitBits
+	block := miner.solveBlock(template, 1, nil, nil)
+	if block == nil {
+		t.Fatal("no block solved on the regtest difficulty")
+	}
+	hash, _ := block.BlockHeader.GetHash()
+	if !block.Hash.IsEqual(&hash) {
+		t.Errorf("block hash %s, header hash %s", block.Hash.ToString(), hash.ToString())
+	}
+	pow := blockchain.Pow{}
+	if !pow.CheckProofOfWork(&hash, block.BlockHeader.Bits, params) {
+		t.Errorf("block %s doesn't meet its target", hash.ToString())
+	}
+	if merkleRoot := msg.BlockMerkleRoot(block, nil); !block.BlockHeader.MerkleRoot.IsEqual(&merkleRoot) {
+		t.Error("merkle root doesn't commit to the rolled coinbase")
+	}
+	// The workers solve copies, the template is left as it was.
+	if template.Block.BlockHeader.Nonce != 0 || template.Block.Txs[0] == block.Txs[0] {
+		t.Error("template modified by the workers")
+	}
+}
+
+func TestSolveBlockMaxTries(t *testing.T) {
+	params := &msg.RegressionNetParams
+	miner := NewCPUMiner(params, nil)
+	miner.SetNumWorkers(2)
+
+	// The mainnet difficulty can't be met within a thousand tries.
+	template := newTestTemplate(t, 0)
+	template.Block.BlockHeader.Bits = msg.MainNetParams.PowLimitBits
+	remaining := int64(1000)
+	block := miner.solveBlock(template, 1, &remaining, nil)
+	if block != nil {
+		t.Fatalf("block %s solved on the mainnet difficulty", block.Hash.ToString())
+	}
+	if remaining > 0 {
+		t.Errorf("gave up with %d tries remaining", remaining)
+	}
+}
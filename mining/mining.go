@@ -3,9 +3,11 @@ package mining
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/astaxie/beego/logs"
 	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/conf"
 	"github.com/btcboost/copernicus/consensus"
 	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/log"
@@ -41,6 +43,9 @@ type BlockTemplate struct {
 	Block         *core.Block
 	TxFees        []utils.Amount
 	TxSigOpsCount []int
+	// TxStrategies holds the name of the strategy which selected each
+	// transaction, empty for the coinbase.
+	TxStrategies []string
 }
 
 func newBlockTemplate() *BlockTemplate {
@@ -48,6 +53,7 @@ func newBlockTemplate() *BlockTemplate {
 		Block:         core.NewBlock(),
 		TxFees:        make([]utils.Amount, 0),
 		TxSigOpsCount: make([]int, 0),
+		TxStrategies:  make([]string, 0),
 	}
 }
 
@@ -56,6 +62,8 @@ type BlockAssembler struct {
 	bt                    *BlockTemplate
 	maxGeneratedBlockSize uint64
 	blockMinFeeRate       utils.FeeRate
+	blockPrioritySize     uint64
+	strategy              SelectionStrategy
 	blockSize             uint64
 	blockTx               uint64
 	blockSigOps           uint64
@@ -73,6 +81,7 @@ func NewBlockAssembler(params *msg.BitcoinParams) *BlockAssembler {
 	v := utils.GetArg("-blockmintxfee", int64(policy.DefaultBlockMinTxFee))
 	ba.blockMinFeeRate = *utils.NewFeeRate(v) // todo confirm
 	ba.maxGeneratedBlockSize = computeMaxGeneratedBlockSize()
+	ba.strategy = Strategy()
 	return ba
 }
 
@@ -87,9 +96,9 @@ func (ba *BlockAssembler) resetBlockAssembler() {
 	ba.fees = 0
 }
 
-func (ba *BlockAssembler) testPackage(packageSize uint64, packageSigOps int64, add *core.Tx) bool {
+func (ba *BlockAssembler) testPackage(packageSize uint64, packageSigOps int64, sizeLimit uint64) bool {
 	blockSizeWithPackage := ba.blockSize + packageSize
-	if blockSizeWithPackage >= ba.maxGeneratedBlockSize {
+	if blockSizeWithPackage >= sizeLimit {
 		return false
 	}
 	if ba.blockSigOps+uint64(packageSigOps) >= consensus.GetMaxBlockSigOpsCount(blockSizeWithPackage) {
@@ -98,8 +107,9 @@ func (ba *BlockAssembler) testPackage(packageSize uint64, packageSigOps int64, a
 	return true
 }
 
-func (ba *BlockAssembler) addToBlock(te *mempool.TxEntry) {
+func (ba *BlockAssembler) addToBlock(te *mempool.TxEntry, strategyName string) {
 	ba.bt.Block.Txs = append(ba.bt.Block.Txs, te.Tx)
+	ba.bt.TxStrategies = append(ba.bt.TxStrategies, strategyName)
 	ba.bt.TxFees = append(ba.bt.TxFees, utils.Amount(te.TxFee))
 	ba.bt.TxSigOpsCount = append(ba.bt.TxSigOpsCount, te.SigOpCount)
 	ba.blockSize += uint64(te.TxSize)
@@ -127,105 +137,157 @@ func computeMaxGeneratedBlockSize() uint64 {
 	return maxGeneratedBlockSize
 }
 
-// This transaction selection algorithm orders the mempool based on feerate of a
-// transaction including all unconfirmed ancestors. Since we don't remove
-// transactions from the mempool as we select them for block inclusion, we need
-// an alternate method of updating the feerate of a transaction with its
-// not-yet-selected ancestors as we go.
-func (ba *BlockAssembler) addPackageTxs() int {
-	descendantsUpdated := 0
-	pool := blockchain.GMemPool // todo use global variable
-	pool.RLock()
-	defer pool.RUnlock()
+// computeBlockPrioritySize returns the size of the high-priority area at the
+// start of the block, which is filled by coin age priority regardless of fees.
+// It defaults to the blockprioritysize option.
+func computeBlockPrioritySize(maxGeneratedBlockSize uint64) uint64 {
+	blockPrioritySize := uint64(utils.GetArg("-blockprioritysize", int64(conf.AppConf.BlockPrioritySize)))
+	if blockPrioritySize > maxGeneratedBlockSize {
+		blockPrioritySize = maxGeneratedBlockSize
+	}
+	return blockPrioritySize
+}
 
+// addTxs selects mempool transactions into the block in the order of the
+// strategy until the block reaches sizeLimit or the strategy accepts no more
+// transactions.  Since we don't remove transactions from the mempool as we
+// select them for block inclusion, the packages of the transactions left are
+// kept in an alternate set and updated as their ancestors get selected.
+//
+// This function MUST be called with the mempool locked for reads.
+func (ba *BlockAssembler) addTxs(s SelectionStrategy, sizeLimit uint64, deltas map[utils.Hash]mempool.TxDelta) int {
+	pool := blockchain.GMemPool // todo use global variable
 	consecutiveFailed := 0
 
-	var txSet *btree.BTree
-	switch strategy {
-	case sortByFee:
-		txSet = sortedByFeeWithAncestors()
-	case sortByFeeRate:
-		txSet = sortedByFeeRateWithAncestors()
+	txSet := btree.New(32)
+	items := make(map[*mempool.TxEntry]*packageItem)
+	for _, entry := range pool.PoolData {
+		if _, ok := ba.inBlock[entry.Tx.Hash]; ok {
+			continue
+		}
+		if s.SelectsAncestors() || ba.parentsInBlock(entry) {
+			ba.insertPackage(s, txSet, items, ba.newPackage(s, entry, deltas))
+		}
 	}
+	// Account for the transactions already selected by a previous pass.
+	descendantsUpdated := ba.updatePackagesForAdded(s, txSet, items, ba.inBlockEntries(pool), deltas)
 
-	//pendingTx := make(map[utils.Hash]mempool.TxEntry)
-	failedTx := make(map[utils.Hash]mempool.TxEntry)
 	for txSet.Len() > 0 {
 		// select the max value item, and delete it. select strategy is descent.
-		var entry mempool.TxEntry
-
-		switch strategy {
-		case sortByFee:
-			entry = mempool.TxEntry(txSet.Max().(EntryFeeSort))
-			txSet.DeleteMax()
-		case sortByFeeRate:
-			entry = mempool.TxEntry(txSet.Max().(EntryAncestorFeeRateSort))
-			txSet.DeleteMax()
-		}
-		// if inBlock has the item, continue next loop
-		if _, ok := ba.inBlock[entry.Tx.Hash]; ok {
-			continue
-		}
-		// if the item has failed in packing into the block, continue next loop
-		if _, ok := failedTx[entry.Tx.Hash]; ok {
+		item := txSet.DeleteMax().(*packageItem)
+		pkg := item.pkg
+		delete(items, pkg.Entry)
+
+		// skip the transactions already added as the ancestor of another
+		if _, ok := ba.inBlock[pkg.Entry.Tx.Hash]; ok {
 			continue
 		}
 
-		packageSize := entry.SumSizeWitAncestors
-		packageFee := entry.SumFeeWithAncestors
-		packageSigOps := entry.SumSigOpCountWithAncestors
-
-		// deal with several different mining strategies
-		isEnd := false
-		switch strategy {
-		case sortByFee:
-			// if the current fee lower than the specified min fee rate, stop loop directly.
-			// because the following after this item must be lower than this
-			if packageFee < ba.blockMinFeeRate.GetFee(int(packageSize)) {
-				isEnd = true
-			}
-		case sortByFeeRate:
-			currentFeeRate := utils.NewFeeRateWithSize(packageFee, packageSize)
-			if currentFeeRate.Less(ba.blockMinFeeRate) {
-				isEnd = true
-			}
-		}
-		if isEnd {
+		// if the current package isn't worth to be mined, stop loop directly.
+		// because the following after this item must be lower than this
+		if !s.Accept(pkg, &ba.blockMinFeeRate) {
 			break
 		}
 
-		if !ba.testPackage(uint64(packageSize), packageSigOps, nil) {
+		if !ba.testPackage(uint64(pkg.Size), pkg.SigOps, sizeLimit) {
 			consecutiveFailed++
 			if consecutiveFailed > maxConsecutiveFailures &&
-				ba.blockSize > ba.maxGeneratedBlockSize-1000 {
+				ba.blockSize+1000 > sizeLimit {
 				// Give up if we're close to full and haven't succeeded in a while.
 				break
 			}
 			continue
 		}
-		// add the ancestors of the current item to block
-		noLimit := uint64(math.MaxUint64)
-		ancestors, _ := pool.CalculateMemPoolAncestors(entry.Tx, noLimit, noLimit, noLimit, noLimit, false)
-		ba.onlyUnconfirmed(ancestors)
-		ancestors[&entry] = struct{}{} // add current item
-		if !ba.testPackageTransactions(ancestors) {
+
+		txs := map[*mempool.TxEntry]struct{}{pkg.Entry: {}}
+		if s.SelectsAncestors() {
+			// add the ancestors of the current item to block
+			noLimit := uint64(math.MaxUint64)
+			txs, _ = pool.CalculateMemPoolAncestors(pkg.Entry.Tx, noLimit, noLimit, noLimit, noLimit, false)
+			ba.onlyUnconfirmed(txs)
+			txs[pkg.Entry] = struct{}{} // add current item
+		}
+		if !ba.testPackageTransactions(txs) {
 			continue
 		}
 
 		// This transaction will make it in; reset the failed counter.
 		consecutiveFailed = 0
-		addset := make(map[utils.Hash]mempool.TxEntry)
-		for add := range ancestors {
-			ba.addToBlock(add)
-			addset[add.Tx.Hash] = *add
+		for _, add := range sortByAncestorCount(txs) {
+			ba.addToBlock(add, s.Name())
 		}
 
-		descendantsUpdated += ba.updatePackagesForAdded(txSet, ancestors)
+		descendantsUpdated += ba.updatePackagesForAdded(s, txSet, items, txs, deltas)
 	}
 	return descendantsUpdated
 }
 
-func (ba *BlockAssembler) CreateNewBlock() *BlockTemplate {
+// newPackage returns the package of entry as selected by the strategy.
+func (ba *BlockAssembler) newPackage(s SelectionStrategy, entry *mempool.TxEntry, deltas map[utils.Hash]mempool.TxDelta) *TxPackage {
+	pkg := &TxPackage{
+		Entry:    entry,
+		Size:     int64(entry.TxSize),
+		Fee:      entry.GetModifiedFee(),
+		SigOps:   int64(entry.SigOpCount),
+		Priority: entry.GetPriority(ba.height) + deltas[entry.Tx.Hash].PriorityDelta,
+	}
+	if s.SelectsAncestors() {
+		pkg.Size = entry.SumSizeWitAncestors
+		pkg.Fee = entry.SumFeeWithAncestors
+		pkg.SigOps = entry.SumSigOpCountWithAncestors
+	}
+	return pkg
+}
+
+func (ba *BlockAssembler) insertPackage(s SelectionStrategy, txSet *btree.BTree, items map[*mempool.TxEntry]*packageItem, pkg *TxPackage) {
+	item := &packageItem{pkg: pkg, score: s.Score(pkg)}
+	txSet.ReplaceOrInsert(item)
+	items[pkg.Entry] = item
+}
+
+// parentsInBlock returns whether all the mempool parents of entry are in the
+// block.
+func (ba *BlockAssembler) parentsInBlock(entry *mempool.TxEntry) bool {
+	for parent := range entry.ParentTx {
+		if _, ok := ba.inBlock[parent.Tx.Hash]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// inBlockEntries returns the mempool entries of the transactions in the block.
+func (ba *BlockAssembler) inBlockEntries(pool *mempool.TxMempool) map[*mempool.TxEntry]struct{} {
+	entries := make(map[*mempool.TxEntry]struct{}, len(ba.inBlock))
+	for hash := range ba.inBlock {
+		if entry, ok := pool.PoolData[hash]; ok {
+			entries[entry] = struct{}{}
+		}
+	}
+	return entries
+}
+
+// sortByAncestorCount returns the entries ordered so that every transaction
+// comes after its ancestors, as a transaction has more ancestors than any of
+// its parents.
+func sortByAncestorCount(entrySet map[*mempool.TxEntry]struct{}) []*mempool.TxEntry {
+	entries := make([]*mempool.TxEntry, 0, len(entrySet))
+	for entry := range entrySet {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].SumTxCountWithAncestors == entries[j].SumTxCountWithAncestors {
+			return entries[i].Tx.Hash.Cmp(&entries[j].Tx.Hash) < 0
+		}
+		return entries[i].SumTxCountWithAncestors < entries[j].SumTxCountWithAncestors
+	})
+	return entries
+}
+
+// CreateNewBlock assembles a new block template on top of the current chain tip
+// whose coinbase pays the block reward and fees to coinbaseScript, or splits
+// them between the configured coinbase payouts.
+func (ba *BlockAssembler) CreateNewBlock(coinbaseScript []byte) *BlockTemplate {
 	timeStart := utils.GetMockTimeInMicros()
 
 	ba.resetBlockAssembler()
@@ -237,6 +299,8 @@ func (ba *BlockAssembler) CreateNewBlock() *BlockTemplate {
 	ba.bt.TxFees = append(ba.bt.TxFees, -1)
 	ba.bt.TxSigOpsCount = make([]int, 0, 100000)
 	ba.bt.TxSigOpsCount = append(ba.bt.TxSigOpsCount, -1)
+	ba.bt.TxStrategies = make([]string, 0, 100000)
+	ba.bt.TxStrategies = append(ba.bt.TxStrategies, "")
 
 	// todo LOCK2(cs_main);
 	indexPrev := blockchain.GChainActive.Tip()
@@ -255,6 +319,7 @@ func (ba *BlockAssembler) CreateNewBlock() *BlockTemplate {
 	}
 	ba.bt.Block.BlockHeader.Time = uint32(utils.GetAdjustedTime())
 	ba.maxGeneratedBlockSize = computeMaxGeneratedBlockSize()
+	ba.blockPrioritySize = computeBlockPrioritySize(ba.maxGeneratedBlockSize)
 	if consensus.StandardLocktimeVerifyFlags&consensus.LocktimeMedianTimePast != 0 {
 		//ba.lockTimeCutoff = indexPrev.GetMedianTimePast() // todo fix
 		ba.lockTimeCutoff = 1
@@ -262,7 +327,17 @@ func (ba *BlockAssembler) CreateNewBlock() *BlockTemplate {
 		ba.lockTimeCutoff = int64(ba.bt.Block.BlockHeader.Time)
 	}
 
-	descendantsUpdated := ba.addPackageTxs()
+	// Fill the high-priority area first, then the rest of the block with the
+	// configured strategy.
+	pool := blockchain.GMemPool // todo use global variable
+	deltas := pool.GetDeltas()
+	pool.RLock()
+	descendantsUpdated := 0
+	if ba.blockPrioritySize > 0 {
+		descendantsUpdated += ba.addTxs(priorityStrategy{}, ba.blockPrioritySize, deltas)
+	}
+	descendantsUpdated += ba.addTxs(ba.strategy, ba.maxGeneratedBlockSize, deltas)
+	pool.RUnlock()
 
 	time1 := utils.GetMockTimeInMicros()
 
@@ -273,15 +348,15 @@ func (ba *BlockAssembler) CreateNewBlock() *BlockTemplate {
 	// Create coinbase transaction
 	coinbaseTx := core.NewTx()
 	coinbaseTx.Ins = make([]*core.TxIn, 1)
-	sig := core.Script{}
-	sig.PushInt64(int64(ba.height))
-	sig.PushOpCode(core.OP_0)
-	coinbaseTx.Ins[0] = core.NewTxIn(&core.OutPoint{Hash: utils.HashZero, Index: 0xffffffff}, sig.GetScriptByte())
-	coinbaseTx.Outs = make([]*core.TxOut, 1)
+	sig, err := standardCoinbaseScript(ba.height, 0)
+	if err != nil {
+		panic(fmt.Sprintf("CreateNewBlock(): %s", err))
+	}
+	coinbaseTx.Ins[0] = core.NewTxIn(&core.OutPoint{Hash: utils.HashZero, Index: 0xffffffff}, sig)
 
 	// value represents total reward(fee and block generate reward)
 	value := ba.fees + blockchain.GetBlockSubsidy(ba.height, ba.chainParams)
-	coinbaseTx.Outs[0] = core.NewTxOut(int64(value), []byte{core.OP_1})
+	coinbaseTx.Outs = coinbaseOutputs(value, coinbaseScript)
 	ba.bt.Block.Txs[0] = coinbaseTx
 	ba.bt.TxFees[0] = -1 * ba.fees // coinbase's fee item is equal to tx fee sum for negative value
 
@@ -342,37 +417,47 @@ func (ba *BlockAssembler) testPackageTransactions(entrySet map[*mempool.TxEntry]
 	return true
 }
 
-func (ba *BlockAssembler) updatePackagesForAdded(txSet *btree.BTree, alreadyAdded map[*mempool.TxEntry]struct{}) int {
+// updatePackagesForAdded removes the transactions just added to the block
+// from the packages of their descendants left in txSet.  Strategies which do
+// not select ancestors instead get the children whose parents are all in the
+// block now.
+func (ba *BlockAssembler) updatePackagesForAdded(s SelectionStrategy, txSet *btree.BTree,
+	items map[*mempool.TxEntry]*packageItem, alreadyAdded map[*mempool.TxEntry]struct{},
+	deltas map[utils.Hash]mempool.TxDelta) int {
+
 	descendantUpdate := 0
 	for entry := range alreadyAdded {
+		if !s.SelectsAncestors() {
+			for child := range entry.ChildTx {
+				if _, ok := items[child]; ok {
+					continue
+				}
+				if _, ok := ba.inBlock[child.Tx.Hash]; ok {
+					continue
+				}
+				if ba.parentsInBlock(child) {
+					descendantUpdate++
+					ba.insertPackage(s, txSet, items, ba.newPackage(s, child, deltas))
+				}
+			}
+			continue
+		}
+
 		descendants := make(map[*mempool.TxEntry]struct{})
 		blockchain.GMemPool.CalculateDescendants(entry, descendants) // todo use global variable
-		// Insert all descendants (not yet in block) into the modified set.
-		// use reflect function if there are so many strategies
 		for desc := range descendants {
-			descendantUpdate++
-			switch strategy {
-			case sortByFee:
-				item := EntryFeeSort(*desc)
-				// remove the old one
-				txSet.Delete(item)
-				// update origin data
-				desc.SumSizeWitAncestors -= entry.SumSizeWitAncestors
-				desc.SumFeeWithAncestors -= entry.SumFeeWithAncestors
-				desc.SumSigOpCountWithAncestors -= entry.SumSigOpCountWithAncestors
-				// insert the modified one
-				txSet.ReplaceOrInsert(item)
-			case sortByFeeRate:
-				item := EntryAncestorFeeRateSort(*desc)
-				// remove the old one
-				txSet.Delete(item)
-				// update origin data
-				desc.SumSizeWitAncestors -= entry.SumSizeWitAncestors
-				desc.SumFeeWithAncestors -= entry.SumFeeWithAncestors
-				desc.SumSigOpCountWithAncestors -= entry.SumSigOpCountWithAncestors
-				// insert the modified one
-				txSet.ReplaceOrInsert(item)
+			item, ok := items[desc]
+			if !ok || desc == entry {
+				continue
 			}
+			descendantUpdate++
+			// remove the old one, update its package and insert it again
+			txSet.Delete(item)
+			item.pkg.Size -= int64(entry.TxSize)
+			item.pkg.Fee -= entry.GetModifiedFee()
+			item.pkg.SigOps -= int64(entry.SigOpCount)
+			item.score = s.Score(item.pkg)
+			txSet.ReplaceOrInsert(item)
 		}
 	}
 	return descendantUpdate
@@ -1,9 +1,15 @@
 package mining
 
 import (
+	"math"
+	"testing"
+
+	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
 	"github.com/btcboost/copernicus/utils"
+	"github.com/google/btree"
 )
 
 type TestMemPoolEntry struct {
@@ -176,3 +182,191 @@ func createTx() []*mempool.TxEntry {
 //		t.Error("error sort by tx feerate")
 //	}
 //}
+
+// useTestMempool replaces the global mempool by one holding the entries of
+// createTx and returns them along with a function restoring the mempool.
+func useTestMempool(t *testing.T) ([]*mempool.TxEntry, func()) {
+	savedPool := blockchain.GMemPool
+	blockchain.GMemPool = mempool.NewTxMempool()
+	entries := createTx()
+	noLimit := uint64(math.MaxUint64)
+	for _, entry := range entries {
+		if err := blockchain.GMemPool.AddTx(entry, noLimit, noLimit, noLimit, noLimit, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entries, func() { blockchain.GMemPool = savedPool }
+}
+
+// newTestAssembler returns a block assembler ready to add transactions to a
+// block at height 1.
+func newTestAssembler() *BlockAssembler {
+	ba := NewBlockAssembler(&msg.RegressionNetParams)
+	ba.resetBlockAssembler()
+	ba.height = 1
+	ba.lockTimeCutoff = 1
+	return ba
+}
+
+// addTestTxs runs addTxs of s on the global mempool.
+func addTestTxs(ba *BlockAssembler, s SelectionStrategy, sizeLimit uint64) int {
+	blockchain.GMemPool.RLock()
+	defer blockchain.GMemPool.RUnlock()
+	return ba.addTxs(s, sizeLimit, nil)
+}
+
+// checkBlockTxs fails the test when the block of ba doesn't hold the entries,
+// in order, selected by the strategies.
+func checkBlockTxs(t *testing.T, ba *BlockAssembler, entries []*mempool.TxEntry, strategies []string) {
+	if len(ba.bt.Block.Txs) != len(entries) {
+		t.Fatalf("%d transactions in the block, want %d", len(ba.bt.Block.Txs), len(entries))
+	}
+	var fees utils.Amount
+	for i, entry := range entries {
+		if ba.bt.Block.Txs[i] != entry.Tx {
+			t.Errorf("transaction %d is %s, want %s", i, ba.bt.Block.Txs[i].Hash.ToString(),
+				entry.Tx.Hash.ToString())
+		}
+		if ba.bt.TxStrategies[i] != strategies[i] {
+			t.Errorf("transaction %d selected by %s, want %s", i, ba.bt.TxStrategies[i], strategies[i])
+		}
+		fees += utils.Amount(entry.TxFee)
+	}
+	if ba.fees != fees || ba.blockTx != uint64(len(entries)) {
+		t.Errorf("block of %d transactions with %d fees, want %d with %d", ba.blockTx, ba.fees,
+			len(entries), fees)
+	}
+}
+
+func TestNewPackage(t *testing.T) {
+	entries, restore := useTestMempool(t)
+	defer restore()
+	tx1, tx3, tx4 := entries[0], entries[2], entries[3]
+	tx4.SetStartingPriority(1000, 1, utils.Amount(utils.COIN))
+	deltas := map[utils.Hash]mempool.TxDelta{tx4.Tx.Hash: {PriorityDelta: 500}}
+
+	ba := newTestAssembler()
+	ba.height = 11
+	pkg := ba.newPackage(feeRateStrategy{}, tx4, deltas)
+	if pkg.Size != int64(tx4.TxSize) || pkg.Fee != tx4.TxFee || pkg.SigOps != int64(tx4.SigOpCount) {
+		t.Errorf("package of tx4 alone: %+v", pkg)
+	}
+	if want := tx4.GetPriority(11) + 500; pkg.Priority != want || pkg.Priority <= 1500 {
+		t.Errorf("package priority %v, want %v", pkg.Priority, want)
+	}
+
+	pkg = ba.newPackage(ancestorFeeRateStrategy{}, tx4, deltas)
+	size := int64(tx1.TxSize + tx3.TxSize + tx4.TxSize)
+	fee := tx1.TxFee + tx3.TxFee + tx4.TxFee
+	if pkg.Size != size || pkg.Fee != fee {
+		t.Errorf("package of tx4 with ancestors: size %d, fee %d, want %d, %d", pkg.Size, pkg.Fee, size, fee)
+	}
+}
+
+func TestAddTxsAncestorPackages(t *testing.T) {
+	entries, restore := useTestMempool(t)
+	defer restore()
+	tx1, tx2, tx3, tx4 := entries[0], entries[1], entries[2], entries[3]
+
+	// tx2 with its parent tx1 pays the most per byte, then tx3 and tx4
+	// once tx1 no longer counts for them.
+	ba := newTestAssembler()
+	updated := addTestTxs(ba, ancestorFeeRateStrategy{}, ba.maxGeneratedBlockSize)
+	name := ancestorFeeRateStrategy{}.Name()
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1, tx2, tx3, tx4}, []string{name, name, name, name})
+	// tx1 updates the packages of tx3 and tx4, tx3 the one of tx4.
+	if updated != 3 {
+		t.Errorf("%d descendant packages updated, want 3", updated)
+	}
+
+	// A size limit leaving room for tx1 and tx2 only.
+	ba = newTestAssembler()
+	sizeLimit := ba.blockSize + uint64(tx1.TxSize+tx2.TxSize) + 1
+	addTestTxs(ba, ancestorFeeRateStrategy{}, sizeLimit)
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1, tx2}, []string{name, name})
+}
+
+func TestAddTxsSingleTransactions(t *testing.T) {
+	entries, restore := useTestMempool(t)
+	defer restore()
+	tx1, tx2, tx3, tx4 := entries[0], entries[1], entries[2], entries[3]
+
+	// Only transactions whose parents are in the block are candidates, so
+	// tx1 comes first whatever its fee.
+	ba := newTestAssembler()
+	updated := addTestTxs(ba, feeRateStrategy{}, ba.maxGeneratedBlockSize)
+	name := feeRateStrategy{}.Name()
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1, tx2, tx3, tx4}, []string{name, name, name, name})
+	// tx1 makes tx2 and tx3 candidates, tx3 makes tx4 one.
+	if updated != 3 {
+		t.Errorf("%d children made candidates, want 3", updated)
+	}
+}
+
+func TestUpdatePackagesForAdded(t *testing.T) {
+	entries, restore := useTestMempool(t)
+	defer restore()
+	tx1, tx2, tx3, tx4 := entries[0], entries[1], entries[2], entries[3]
+
+	s := ancestorFeeRateStrategy{}
+	ba := newTestAssembler()
+	txSet := btree.New(32)
+	items := make(map[*mempool.TxEntry]*packageItem)
+	for _, entry := range []*mempool.TxEntry{tx2, tx3, tx4} {
+		ba.insertPackage(s, txSet, items, ba.newPackage(s, entry, nil))
+	}
+	before := *items[tx4].pkg
+
+	ba.addToBlock(tx1, s.Name())
+	added := map[*mempool.TxEntry]struct{}{tx1: {}}
+	if updated := ba.updatePackagesForAdded(s, txSet, items, added, nil); updated != 3 {
+		t.Errorf("%d descendant packages updated, want 3", updated)
+	}
+	pkg := items[tx4].pkg
+	if pkg.Size != before.Size-int64(tx1.TxSize) || pkg.Fee != before.Fee-tx1.TxFee ||
+		pkg.SigOps != before.SigOps-int64(tx1.SigOpCount) {
+		t.Errorf("package of tx4 %+v after adding tx1, was %+v", pkg, before)
+	}
+	if score := s.Score(pkg); items[tx4].score != score {
+		t.Errorf("score of tx4 %v, want %v", items[tx4].score, score)
+	}
+	// The set is still ordered by the updated scores.
+	if txSet.Len() != 3 || txSet.Max().(*packageItem) != items[maxScoreEntry(items)] {
+		t.Error("package set not reordered after the update")
+	}
+}
+
+// maxScoreEntry returns the entry of the package with the highest score.
+func maxScoreEntry(items map[*mempool.TxEntry]*packageItem) *mempool.TxEntry {
+	var best *mempool.TxEntry
+	for entry, item := range items {
+		if best == nil || item.score > items[best].score {
+			best = entry
+		}
+	}
+	return best
+}
+
+func TestAddTxsPriorityArea(t *testing.T) {
+	entries, restore := useTestMempool(t)
+	defer restore()
+	tx1, tx2, tx3, tx4 := entries[0], entries[1], entries[2], entries[3]
+	highPriority := float64(utils.COIN) * 144
+	tx1.SetStartingPriority(highPriority, 1, 0)
+	tx3.SetStartingPriority(highPriority*2, 1, 0)
+
+	// The high-priority area takes tx1 and tx3, the rest of the block is
+	// filled by fee.
+	ba := newTestAssembler()
+	addTestTxs(ba, priorityStrategy{}, ba.maxGeneratedBlockSize)
+	addTestTxs(ba, ancestorFeeRateStrategy{}, ba.maxGeneratedBlockSize)
+	priority, fee := priorityStrategy{}.Name(), ancestorFeeRateStrategy{}.Name()
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1, tx3, tx2, tx4}, []string{priority, priority, fee, fee})
+
+	// An area with room for tx1 only.
+	ba = newTestAssembler()
+	addTestTxs(ba, priorityStrategy{}, ba.blockSize+uint64(tx1.TxSize)+1)
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1}, []string{priority})
+	addTestTxs(ba, ancestorFeeRateStrategy{}, ba.maxGeneratedBlockSize)
+	checkBlockTxs(t, ba, []*mempool.TxEntry{tx1, tx2, tx3, tx4}, []string{priority, fee, fee, fee})
+}
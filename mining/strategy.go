@@ -1,76 +1,185 @@
 package mining
 
 import (
-	"github.com/astaxie/beego/logs"
-	"github.com/btcboost/copernicus/blockchain"
+	"fmt"
+	"sort"
+	"sync"
+
 	"github.com/btcboost/copernicus/mempool"
 	"github.com/btcboost/copernicus/utils"
 	"github.com/google/btree"
-	"github.com/spf13/viper"
 )
 
-type sortType int
+// TxPackage is a mempool transaction together with the transactions it is
+// selected with: its ancestors not in the block yet for strategies selecting
+// ancestors, or only itself otherwise.
+type TxPackage struct {
+	Entry *mempool.TxEntry
+	// Size, Fee and SigOps sum up all the transactions of the package, Fee
+	// including the deltas of prioritisetransaction.
+	Size   int64
+	Fee    int64
+	SigOps int64
+	// Priority is the coin age priority of Entry at the height of the block,
+	// including its priority delta.
+	Priority float64
+}
 
-const (
-	sortByFee sortType = 1 << iota
-	sortByFeeRate
-)
+// SelectionStrategy decides in which order the mempool transactions are
+// selected into a block template.
+type SelectionStrategy interface {
+	// Name returns the name the strategy is configured by and reported by
+	// getblocktemplate.
+	Name() string
+
+	// SelectsAncestors returns whether a transaction is selected together
+	// with its unconfirmed ancestors.  Otherwise it is only considered once
+	// all its mempool parents are in the block.
+	SelectsAncestors() bool
+
+	// Score returns the score of the package, packages of higher scores are
+	// selected first.
+	Score(pkg *TxPackage) float64
 
-const defaultSortStrategy = sortByFeeRate
+	// Accept returns whether the package is worth being in the block at
+	// all.  As packages are visited by descending score, the selection ends
+	// at the first package not accepted.
+	Accept(pkg *TxPackage, minFeeRate *utils.FeeRate) bool
+}
+
+// ancestorFeeRateStrategy selects by the fee rate of a transaction including
+// all its unconfirmed ancestors.
+type ancestorFeeRateStrategy struct{}
 
-var strategy sortType
+func (ancestorFeeRateStrategy) Name() string           { return "ancestorfeerate" }
+func (ancestorFeeRateStrategy) SelectsAncestors() bool { return true }
 
-var strategies = map[string]sortType{
-	"ancestorfee":     sortByFee,
-	"ancestorfeerate": sortByFeeRate,
+func (ancestorFeeRateStrategy) Score(pkg *TxPackage) float64 {
+	return packageFeeRate(pkg)
 }
 
-// EntryFeeSort TxEntry sorted by feeWithAncestors
-type EntryFeeSort mempool.TxEntry
+func (ancestorFeeRateStrategy) Accept(pkg *TxPackage, minFeeRate *utils.FeeRate) bool {
+	return !utils.NewFeeRateWithSize(pkg.Fee, pkg.Size).Less(*minFeeRate)
+}
+
+// ancestorFeeStrategy selects by the fee of a transaction including all its
+// unconfirmed ancestors, whatever their size.
+type ancestorFeeStrategy struct{}
+
+func (ancestorFeeStrategy) Name() string           { return "ancestorfee" }
+func (ancestorFeeStrategy) SelectsAncestors() bool { return true }
 
-func (e EntryFeeSort) Less(than btree.Item) bool {
-	t := than.(EntryFeeSort)
-	if e.SumFeeWithAncestors == t.SumFeeWithAncestors {
-		return e.Tx.Hash.Cmp(&t.Tx.Hash) > 0
+func (ancestorFeeStrategy) Score(pkg *TxPackage) float64 {
+	return float64(pkg.Fee)
+}
+
+func (ancestorFeeStrategy) Accept(pkg *TxPackage, minFeeRate *utils.FeeRate) bool {
+	return pkg.Fee >= minFeeRate.GetFee(int(pkg.Size))
+}
+
+// feeRateStrategy selects by the fee rate of each transaction alone.
+type feeRateStrategy struct{}
+
+func (feeRateStrategy) Name() string           { return "feerate" }
+func (feeRateStrategy) SelectsAncestors() bool { return false }
+
+func (feeRateStrategy) Score(pkg *TxPackage) float64 {
+	return packageFeeRate(pkg)
+}
+
+func (feeRateStrategy) Accept(pkg *TxPackage, minFeeRate *utils.FeeRate) bool {
+	return !utils.NewFeeRateWithSize(pkg.Fee, pkg.Size).Less(*minFeeRate)
+}
+
+// priorityStrategy selects by coin age priority, down to the priority which
+// allows a transaction to be mined for free.  It fills the high-priority area
+// of the block.
+type priorityStrategy struct{}
+
+func (priorityStrategy) Name() string           { return "priority" }
+func (priorityStrategy) SelectsAncestors() bool { return false }
+
+func (priorityStrategy) Score(pkg *TxPackage) float64 {
+	return pkg.Priority
+}
+
+func (priorityStrategy) Accept(pkg *TxPackage, minFeeRate *utils.FeeRate) bool {
+	return mempool.AllowFree(pkg.Priority)
+}
+
+// packageFeeRate returns the fee rate of the package in satoshis per 1000
+// bytes.
+func packageFeeRate(pkg *TxPackage) float64 {
+	if pkg.Size == 0 {
+		return 0
 	}
-	return e.SumFeeWithAncestors < than.(EntryFeeSort).SumFeeWithAncestors
+	return float64(pkg.Fee) * 1000 / float64(pkg.Size)
+}
+
+const defaultStrategy = "ancestorfeerate"
+
+var (
+	strategyLock sync.RWMutex
+	strategy     SelectionStrategy
+	strategies   = make(map[string]SelectionStrategy)
+)
+
+// RegisterStrategy makes the strategy available to SetStrategy by its name.
+func RegisterStrategy(s SelectionStrategy) {
+	strategyLock.Lock()
+	defer strategyLock.Unlock()
+	strategies[s.Name()] = s
 }
 
-func sortedByFeeWithAncestors() *btree.BTree {
-	b := btree.New(32)
-	for _, txEntry := range blockchain.GMemPool.PoolData { // todo use global variable
-		b.ReplaceOrInsert(EntryFeeSort(*txEntry))
+// SetStrategy sets the strategy block templates are assembled with.
+func SetStrategy(name string) error {
+	strategyLock.Lock()
+	defer strategyLock.Unlock()
+	s, ok := strategies[name]
+	if !ok {
+		return fmt.Errorf("unknown block selection strategy %s (available: %v)", name, strategyNames())
 	}
-	return b
+	strategy = s
+	return nil
 }
 
-// EntryAncestorFeeRateSort TxEntry sorted by feeRateWithAncestors
-type EntryAncestorFeeRateSort mempool.TxEntry
+// Strategy returns the strategy block templates are assembled with.
+func Strategy() SelectionStrategy {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+	return strategy
+}
 
-func (r EntryAncestorFeeRateSort) Less(than btree.Item) bool {
-	t := than.(EntryAncestorFeeRateSort)
-	b1 := utils.NewFeeRateWithSize((r).SumFeeWithAncestors, r.SumSizeWitAncestors).SataoshisPerK
-	b2 := utils.NewFeeRateWithSize(t.SumFeeWithAncestors, t.SumSizeWitAncestors).SataoshisPerK
-	if b1 == b2 {
-		return r.Tx.Hash.Cmp(&t.Tx.Hash) > 0
+// strategyNames returns the sorted names of the registered strategies.
+func strategyNames() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
 	}
-	return b1 < b2
+	sort.Strings(names)
+	return names
 }
 
-func sortedByFeeRateWithAncestors() *btree.BTree {
-	b := btree.New(32)
-	for _, txEntry := range blockchain.GMemPool.PoolData { // todo use global variable
-		b.ReplaceOrInsert(EntryAncestorFeeRateSort(*txEntry))
+// packageItem orders packages in a btree by the score their strategy gave
+// them.  The score is kept in the item so an item can be found and removed
+// after the package changed.
+type packageItem struct {
+	pkg   *TxPackage
+	score float64
+}
+
+func (p *packageItem) Less(than btree.Item) bool {
+	t := than.(*packageItem)
+	if p.score == t.score {
+		return p.pkg.Entry.Tx.Hash.Cmp(&t.pkg.Entry.Tx.Hash) > 0
 	}
-	return b
+	return p.score < t.score
 }
 
 func init() {
-	sortParam := viper.GetString("strategy")
-	ret, ok := strategies[sortParam]
-	if !ok {
-		logs.Error("the specified strategy< %s > is not exist, so use default strategy< %s >", sortParam, defaultSortStrategy)
-		strategy = defaultSortStrategy
-	}
-	strategy = ret
+	RegisterStrategy(ancestorFeeRateStrategy{})
+	RegisterStrategy(ancestorFeeStrategy{})
+	RegisterStrategy(feeRateStrategy{})
+	RegisterStrategy(priorityStrategy{})
+	strategy = strategies[defaultStrategy]
 }
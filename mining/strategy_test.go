@@ -0,0 +1,105 @@
+package mining
+
+import (
+	"testing"
+
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestStrategyAccept(t *testing.T) {
+	minFeeRate := utils.NewFeeRate(1000)
+	tests := []struct {
+		strategy SelectionStrategy
+		pkg      TxPackage
+		want     bool
+	}{
+		{ancestorFeeRateStrategy{}, TxPackage{Size: 250, Fee: 250}, true},
+		{ancestorFeeRateStrategy{}, TxPackage{Size: 250, Fee: 249}, false},
+		{ancestorFeeStrategy{}, TxPackage{Size: 250, Fee: 250}, true},
+		{ancestorFeeStrategy{}, TxPackage{Size: 250, Fee: 100}, false},
+		{feeRateStrategy{}, TxPackage{Size: 1000, Fee: 1000}, true},
+		{feeRateStrategy{}, TxPackage{Size: 1000, Fee: 0}, false},
+		{priorityStrategy{}, TxPackage{Priority: float64(utils.COIN) * 144}, true},
+		{priorityStrategy{}, TxPackage{Size: 1000, Fee: 100000, Priority: 1}, false},
+	}
+	for i, test := range tests {
+		if got := test.strategy.Accept(&test.pkg, minFeeRate); got != test.want {
+			t.Errorf("test %d (%s): accept %v, want %v", i, test.strategy.Name(), got, test.want)
+		}
+	}
+}
+
+func TestStrategyScore(t *testing.T) {
+	// A small package paying a high fee rate and a large one paying the
+	// higher fee.
+	small := &TxPackage{Size: 200, Fee: 2000, Priority: 10}
+	large := &TxPackage{Size: 2000, Fee: 5000, Priority: 20}
+
+	tests := []struct {
+		strategy SelectionStrategy
+		first    *TxPackage
+	}{
+		{ancestorFeeRateStrategy{}, small},
+		{feeRateStrategy{}, small},
+		{ancestorFeeStrategy{}, large},
+		{priorityStrategy{}, large},
+	}
+	for _, test := range tests {
+		other := small
+		if test.first == small {
+			other = large
+		}
+		if test.strategy.Score(test.first) <= test.strategy.Score(other) {
+			t.Errorf("%s: package scored lower than expected", test.strategy.Name())
+		}
+	}
+}
+
+func TestSetStrategy(t *testing.T) {
+	defer SetStrategy(defaultStrategy)
+
+	if Strategy().Name() != defaultStrategy {
+		t.Errorf("default strategy %s, want %s", Strategy().Name(), defaultStrategy)
+	}
+	for _, name := range []string{"ancestorfeerate", "ancestorfee", "feerate", "priority"} {
+		if err := SetStrategy(name); err != nil {
+			t.Errorf("SetStrategy(%s): %v", name, err)
+			continue
+		}
+		if Strategy().Name() != name {
+			t.Errorf("strategy %s, want %s", Strategy().Name(), name)
+		}
+	}
+	if err := SetStrategy("unknown"); err == nil {
+		t.Error("unknown strategy was set")
+	}
+	if Strategy().Name() != "priority" {
+		t.Errorf("failed SetStrategy changed the strategy to %s", Strategy().Name())
+	}
+}
+
+func TestSortByAncestorCount(t *testing.T) {
+	entries := createTx()
+	// ancestor counts as computed by the mempool: tx4 -> tx3 -> tx1 and
+	// tx2 -> tx1
+	entries[1].SumTxCountWithAncestors = 2
+	entries[2].SumTxCountWithAncestors = 2
+	entries[3].SumTxCountWithAncestors = 3
+
+	entrySet := make(map[*mempool.TxEntry]struct{})
+	for _, entry := range entries {
+		entrySet[entry] = struct{}{}
+	}
+	sorted := sortByAncestorCount(entrySet)
+	position := make(map[*mempool.TxEntry]int)
+	for i, entry := range sorted {
+		position[entry] = i
+	}
+	if position[entries[0]] != 0 {
+		t.Errorf("tx1 at position %d, want 0", position[entries[0]])
+	}
+	if position[entries[3]] < position[entries[2]] {
+		t.Error("tx4 sorted before its parent tx3")
+	}
+}
@@ -0,0 +1,675 @@
+package mining
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+const (
+	// DefaultStratumDifficulty is the share difficulty new stratum clients
+	// start at before vardiff adjusts it.
+	DefaultStratumDifficulty = 1024
+
+	// defaultShareInterval is the time between two shares of a client that
+	// vardiff aims for.
+	defaultShareInterval = 15 * time.Second
+
+	// vardiffRetargetInterval is how often the share difficulty of a
+	// client is adjusted.
+	vardiffRetargetInterval = 90 * time.Second
+
+	// vardiffMaxAdjustment bounds the factor by which a single retarget
+	// raises or lowers the share difficulty.
+	vardiffMaxAdjustment = 4
+
+	// stratumJobRefreshInterval is how often a new job is sent while the
+	// chain tip doesn't change, so that new mempool transactions get mined.
+	stratumJobRefreshInterval = 30 * time.Second
+
+	// maxStratumJobs is the number of jobs on the same chain tip shares are
+	// accepted for.  Older jobs are dropped together with the shares the
+	// clients submitted for them.
+	maxStratumJobs = 8
+
+	// stratumIdleTimeout is the time after which a client that sent
+	// nothing is disconnected.
+	stratumIdleTimeout = 10 * time.Minute
+
+	// maxStratumMessageSize is the largest message a client may send.
+	maxStratumMessageSize = 16 * 1024
+)
+
+// Stratum error codes as used by the common pool implementations.
+const (
+	stratumErrOther          = 20
+	stratumErrJobNotFound    = 21
+	stratumErrDuplicateShare = 22
+	stratumErrLowDifficulty  = 23
+	stratumErrUnauthorized   = 24
+	stratumErrNotSubscribed  = 25
+)
+
+// stratumError is the error member of a stratum reply, which encodes as
+// [code, message, null].
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string {
+	return e.message
+}
+
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+// stratumRequest is a message received from a stratum client.
+type stratumRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse is the reply to a stratum request.
+type stratumResponse struct {
+	ID     interface{}   `json:"id"`
+	Result interface{}   `json:"result"`
+	Error  *stratumError `json:"error"`
+}
+
+// stratumNotification is a message the server sends on its own.
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// StratumConfig is the configuration of a stratum server.
+type StratumConfig struct {
+	// ChainParams are the parameters of the network blocks are mined on.
+	ChainParams *msg.BitcoinParams
+
+	// Listeners are the addresses the server accepts clients on.
+	Listeners []string
+
+	// CoinbaseScripts are the output scripts blocks found by clients pay
+	// to, one of them chosen at random per job, unless coinbase payouts are
+	// configured.
+	CoinbaseScripts [][]byte
+
+	// Difficulty is the share difficulty new clients start at. Vardiff
+	// keeps the difficulty of each client between MinDifficulty and
+	// MaxDifficulty, where zero means no bound.
+	Difficulty    float64
+	MinDifficulty float64
+	MaxDifficulty float64
+
+	// ShareInterval is the time between two shares of a client that vardiff
+	// aims for.
+	ShareInterval time.Duration
+}
+
+// StratumServer lets mining hardware work on blocks of this node through the
+// stratum v1 protocol.
+//
+// Every job is a block template whose coinbase is split around the extra
+// nonce. The first part of the extra nonce is assigned by the server to each
+// connection and the second part is rolled by the client, so no two clients
+// ever hash the same header. Shares are checked against the difficulty of the
+// client, which is adjusted to the hash rate of the client, and shares which
+// also meet the network target are submitted as blocks.
+type StratumServer struct {
+	sync.Mutex
+	cfg         StratumConfig
+	listeners   []net.Listener
+	clients     map[*stratumClient]struct{}
+	jobs        map[string]*stratumJob
+	currentJob  *stratumJob
+	jobCounter  uint64
+	extraNonce1 uint32
+	started     int32
+	shutdown    int32
+	wg          sync.WaitGroup
+	quit        chan struct{}
+}
+
+// NewStratumServer returns a new stratum server using the passed
+// configuration. Zero values of Difficulty and ShareInterval are replaced by
+// their defaults.
+func NewStratumServer(cfg *StratumConfig) *StratumServer {
+	s := &StratumServer{
+		cfg:     *cfg,
+		clients: make(map[*stratumClient]struct{}),
+		jobs:    make(map[string]*stratumJob),
+		quit:    make(chan struct{}),
+	}
+	if s.cfg.Difficulty <= 0 {
+		s.cfg.Difficulty = DefaultStratumDifficulty
+	}
+	if s.cfg.ShareInterval <= 0 {
+		s.cfg.ShareInterval = defaultShareInterval
+	}
+	return s
+}
+
+// Start begins listening for stratum clients and building jobs.
+func (s *StratumServer) Start() error {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return nil
+	}
+	if len(s.cfg.CoinbaseScripts) == 0 && len(CoinbasePayouts()) == 0 {
+		return errors.New("stratum server requires at least one mining address or coinbase payout")
+	}
+
+	for _, addr := range s.cfg.Listeners {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range s.listeners {
+				l.Close()
+			}
+			return fmt.Errorf("unable to listen for stratum clients on %s: %v", addr, err)
+		}
+		s.listeners = append(s.listeners, listener)
+	}
+
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go s.acceptClients(listener)
+	}
+	s.wg.Add(1)
+	go s.jobHandler()
+	return nil
+}
+
+// Stop disconnects every client and waits for the server to finish.
+func (s *StratumServer) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		return
+	}
+	close(s.quit)
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.Lock()
+	for client := range s.clients {
+		client.conn.Close()
+	}
+	s.Unlock()
+	s.wg.Wait()
+	logs.Info("Stratum server stopped")
+}
+
+// acceptClients accepts clients on listener until it is closed.
+//
+// This function MUST be run as a goroutine.
+func (s *StratumServer) acceptClients(listener net.Listener) {
+	defer s.wg.Done()
+
+	logs.Info("Stratum server listening on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+			default:
+				logs.Error("Stratum server: can't accept connection: %v", err)
+			}
+			return
+		}
+
+		extraNonce1 := make([]byte, extraNonce1Size)
+		binary.BigEndian.PutUint32(extraNonce1, atomic.AddUint32(&s.extraNonce1, 1))
+		client := newStratumClient(s, conn, extraNonce1)
+
+		s.Lock()
+		select {
+		case <-s.quit:
+			// Stop already disconnected the other clients.
+			s.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.clients[client] = struct{}{}
+		s.Unlock()
+
+		s.wg.Add(1)
+		go client.handle()
+	}
+}
+
+// jobHandler builds a new job whenever the chain tip changes, and every
+// stratumJobRefreshInterval otherwise, and sends it to the clients.
+//
+// This function MUST be run as a goroutine.
+func (s *StratumServer) jobHandler() {
+	defer s.wg.Done()
+
+	for {
+		tipChanged := blockchain.TipChanged()
+		if err := s.updateJob(); err != nil {
+			logs.Error("Stratum server: can't create job: %v", err)
+		}
+
+		select {
+		case <-tipChanged:
+		case <-time.After(stratumJobRefreshInterval):
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// updateJob builds a job on the current chain tip and notifies the clients.
+// Jobs built on a previous tip are dropped as they can't produce valid blocks
+// anymore.
+func (s *StratumServer) updateJob() error {
+	var coinbaseScript []byte
+	if len(s.cfg.CoinbaseScripts) > 0 {
+		coinbaseScript = s.cfg.CoinbaseScripts[rand.Intn(len(s.cfg.CoinbaseScripts))]
+	}
+	ba := NewBlockAssembler(s.cfg.ChainParams)
+	template := ba.CreateNewBlock(coinbaseScript)
+
+	job, clients, err := s.addJob(template, ba.height)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		client.sendJob(job)
+	}
+	return nil
+}
+
+// addJob makes a job of template the current job and returns it together with
+// the clients to send it to.  Only the last maxStratumJobs jobs are kept.
+func (s *StratumServer) addJob(template *BlockTemplate, height int) (*stratumJob, []*stratumClient, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	cleanJobs := s.currentJob == nil ||
+		!s.currentJob.prevHash.IsEqual(&template.Block.BlockHeader.HashPrevBlock)
+	job, err := newStratumJob(strconv.FormatUint(s.jobCounter+1, 16), template, height, cleanJobs)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.jobCounter++
+	if cleanJobs {
+		s.jobs = make(map[string]*stratumJob)
+	} else if s.jobCounter > maxStratumJobs {
+		delete(s.jobs, strconv.FormatUint(s.jobCounter-maxStratumJobs, 16))
+	}
+	s.jobs[job.id] = job
+	s.currentJob = job
+	clients := make([]*stratumClient, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	return job, clients, nil
+}
+
+// job returns the job with the given id, or nil if it is unknown or stale.
+func (s *StratumServer) job(id string) *stratumJob {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.jobs[id]
+}
+
+// latestJob returns the job clients should currently work on.
+func (s *StratumServer) latestJob() *stratumJob {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.currentJob
+}
+
+// removeClient forgets a disconnected client.
+func (s *StratumServer) removeClient(client *stratumClient) {
+	s.Lock()
+	delete(s.clients, client)
+	s.Unlock()
+}
+
+// submitBlock hands a block found by a client to the chain.
+func (s *StratumServer) submitBlock(block *core.Block, worker string) {
+	if !blockchain.ProcessNewBlock(s.cfg.ChainParams, block, true, nil) {
+		logs.Warn("Stratum server: block %s found by %s was not accepted",
+			block.Hash.ToString(), worker)
+		return
+	}
+	logs.Info("Stratum server: block %s found by %s", block.Hash.ToString(), worker)
+}
+
+// stratumClient is a connection of a stratum client.
+type stratumClient struct {
+	sync.Mutex
+	server      *StratumServer
+	conn        net.Conn
+	writeMtx    sync.Mutex
+	extraNonce1 []byte
+	subscribed  bool
+	workers     map[string]struct{}
+
+	// submitted holds the shares of the client per job id, to refuse
+	// duplicates.
+	submitted map[string]map[string]struct{}
+
+	// difficulty is the share difficulty of the client.  Shares of jobs
+	// sent before the last change may still meet prevDifficulty only.
+	difficulty     float64
+	prevDifficulty float64
+	shares         int
+	lastRetarget   time.Time
+}
+
+func newStratumClient(s *StratumServer, conn net.Conn, extraNonce1 []byte) *stratumClient {
+	return &stratumClient{
+		server:         s,
+		conn:           conn,
+		extraNonce1:    extraNonce1,
+		workers:        make(map[string]struct{}),
+		submitted:      make(map[string]map[string]struct{}),
+		difficulty:     s.cfg.Difficulty,
+		prevDifficulty: s.cfg.Difficulty,
+		lastRetarget:   time.Now(),
+	}
+}
+
+// handle reads and answers the requests of the client until it disconnects.
+//
+// This function MUST be run as a goroutine.
+func (c *stratumClient) handle() {
+	defer c.server.wg.Done()
+	defer c.server.removeClient(c)
+	defer c.conn.Close()
+
+	logs.Debug("Stratum client connected from %s", c.conn.RemoteAddr())
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxStratumMessageSize)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				logs.Debug("Stratum client %s disconnected: %v", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var request stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			logs.Debug("Stratum client %s sent malformed message: %v", c.conn.RemoteAddr(), err)
+			return
+		}
+		result, err := c.handleRequest(&request)
+		reply := &stratumResponse{ID: request.ID, Result: result}
+		if err != nil {
+			reply.Result = nil
+			reply.Error = err
+		}
+		if !c.send(reply) {
+			return
+		}
+
+		// A new subscriber is given its difficulty and work right after
+		// the reply to its subscription.
+		if request.Method == "mining.subscribe" && err == nil {
+			if job := c.server.latestJob(); job != nil {
+				c.sendJob(job)
+			}
+		}
+	}
+}
+
+// handleRequest executes a request and returns its result.
+func (c *stratumClient) handleRequest(request *stratumRequest) (interface{}, *stratumError) {
+	switch request.Method {
+	case "mining.subscribe":
+		c.Lock()
+		c.subscribed = true
+		c.Unlock()
+		subscriptionID := hex.EncodeToString(c.extraNonce1)
+		return []interface{}{
+			[][]string{
+				{"mining.set_difficulty", subscriptionID},
+				{"mining.notify", subscriptionID},
+			},
+			hex.EncodeToString(c.extraNonce1),
+			extraNonce2Size,
+		}, nil
+
+	case "mining.authorize":
+		var worker string
+		if len(request.Params) < 1 || json.Unmarshal(request.Params[0], &worker) != nil {
+			return nil, &stratumError{stratumErrOther, "invalid worker name"}
+		}
+		c.Lock()
+		c.workers[worker] = struct{}{}
+		c.Unlock()
+		logs.Info("Stratum worker %s authorized from %s", worker, c.conn.RemoteAddr())
+		return true, nil
+
+	case "mining.extranonce.subscribe":
+		// The extra nonce of a connection never changes.
+		return true, nil
+
+	case "mining.submit":
+		return c.handleSubmit(request.Params)
+	}
+
+	return nil, &stratumError{stratumErrOther, "Method not found"}
+}
+
+// handleSubmit checks a share submitted as [worker, job id, extranonce2,
+// ntime, nonce] and submits it as a block if it meets the network target.
+func (c *stratumClient) handleSubmit(params []json.RawMessage) (interface{}, *stratumError) {
+	var args [5]string
+	if len(params) < len(args) {
+		return nil, &stratumError{stratumErrOther, "Invalid parameters"}
+	}
+	for i := range args {
+		if err := json.Unmarshal(params[i], &args[i]); err != nil {
+			return nil, &stratumError{stratumErrOther, "Invalid parameters"}
+		}
+	}
+	worker, jobID := args[0], args[1]
+
+	c.Lock()
+	subscribed := c.subscribed
+	_, authorized := c.workers[worker]
+	c.Unlock()
+	if !subscribed {
+		return nil, &stratumError{stratumErrNotSubscribed, "Not subscribed"}
+	}
+	if !authorized {
+		return nil, &stratumError{stratumErrUnauthorized, "Unauthorized worker"}
+	}
+
+	job := c.server.job(jobID)
+	if job == nil {
+		return nil, &stratumError{stratumErrJobNotFound, "Job not found"}
+	}
+
+	extraNonce2, err := hex.DecodeString(args[2])
+	if err != nil {
+		return nil, &stratumError{stratumErrOther, "Invalid extranonce2"}
+	}
+	ntime, err := strconv.ParseUint(args[3], 16, 32)
+	if err != nil {
+		return nil, &stratumError{stratumErrOther, "Invalid ntime"}
+	}
+	nonce, err := strconv.ParseUint(args[4], 16, 32)
+	if err != nil {
+		return nil, &stratumError{stratumErrOther, "Invalid nonce"}
+	}
+	if uint32(ntime) < job.time || int64(ntime) > utils.GetAdjustedTime()+maxFutureShareTime {
+		return nil, &stratumError{stratumErrOther, "ntime out of range"}
+	}
+
+	share := &stratumShare{
+		extraNonce1: c.extraNonce1,
+		extraNonce2: extraNonce2,
+		time:        uint32(ntime),
+		nonce:       uint32(nonce),
+	}
+	header, coinbaseTx, err := job.header(share)
+	if err != nil {
+		return nil, &stratumError{stratumErrOther, err.Error()}
+	}
+	hash, _ := header.GetHash()
+
+	c.Lock()
+	key := args[2] + ":" + args[3] + ":" + args[4]
+	if _, ok := c.submitted[jobID][key]; ok {
+		c.Unlock()
+		return nil, &stratumError{stratumErrDuplicateShare, "Duplicate share"}
+	}
+	difficulty := c.difficulty
+	if c.prevDifficulty < difficulty {
+		difficulty = c.prevDifficulty
+	}
+	if blockchain.HashToBig(&hash).Cmp(difficultyTarget(difficulty)) > 0 {
+		c.Unlock()
+		return nil, &stratumError{stratumErrLowDifficulty, "Low difficulty share"}
+	}
+	if c.submitted[jobID] == nil {
+		c.submitted[jobID] = make(map[string]struct{})
+	}
+	c.submitted[jobID][key] = struct{}{}
+	c.shares++
+	c.Unlock()
+
+	pow := blockchain.Pow{}
+	if pow.CheckProofOfWork(&hash, job.bits, c.server.cfg.ChainParams) {
+		c.server.submitBlock(job.block(header, coinbaseTx), worker)
+	}
+
+	if c.retarget(false) {
+		c.sendDifficulty()
+	}
+	return true, nil
+}
+
+// retarget adjusts the share difficulty to the rate of the shares since the
+// last adjustment and returns whether it changed.  Unless force is set,
+// nothing is done before vardiffRetargetInterval has passed.
+func (c *stratumClient) retarget(force bool) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	elapsed := time.Since(c.lastRetarget)
+	if !force && elapsed < vardiffRetargetInterval {
+		return false
+	}
+
+	// Without shares the real rate is unknown, so lower the difficulty as
+	// much as a single retarget allows.
+	factor := 1.0 / vardiffMaxAdjustment
+	if c.shares > 0 {
+		actual := elapsed / time.Duration(c.shares)
+		factor = float64(c.server.cfg.ShareInterval) / float64(actual)
+	}
+	if factor > vardiffMaxAdjustment {
+		factor = vardiffMaxAdjustment
+	} else if factor < 1.0/vardiffMaxAdjustment {
+		factor = 1.0 / vardiffMaxAdjustment
+	}
+
+	difficulty := c.difficulty * factor
+	if min := c.server.cfg.MinDifficulty; min > 0 && difficulty < min {
+		difficulty = min
+	}
+	if max := c.server.cfg.MaxDifficulty; max > 0 && difficulty > max {
+		difficulty = max
+	}
+	c.shares = 0
+	c.lastRetarget = time.Now()
+	if difficulty == c.difficulty {
+		return false
+	}
+	c.difficulty = difficulty
+	return true
+}
+
+// sendJob sends job to the client if it is subscribed, preceded by a new
+// difficulty if vardiff changed it.
+func (c *stratumClient) sendJob(job *stratumJob) {
+	c.Lock()
+	subscribed := c.subscribed
+	for id := range c.submitted {
+		if c.server.job(id) == nil {
+			delete(c.submitted, id)
+		}
+	}
+	c.Unlock()
+	if !subscribed {
+		return
+	}
+
+	// Clients that stopped submitting would otherwise keep a difficulty
+	// too high for them until their next share.
+	if time.Since(c.lastRetargetTime()) >= 2*vardiffRetargetInterval {
+		c.retarget(true)
+	}
+	c.sendDifficulty()
+
+	// From this job on, shares must meet the current difficulty.
+	c.Lock()
+	c.prevDifficulty = c.difficulty
+	c.Unlock()
+
+	c.send(&stratumNotification{Method: "mining.notify", Params: job.notifyParams()})
+}
+
+// sendDifficulty sends the current share difficulty to the client.
+func (c *stratumClient) sendDifficulty() {
+	c.Lock()
+	difficulty := c.difficulty
+	c.Unlock()
+	c.send(&stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{difficulty}})
+}
+
+// lastRetargetTime returns when the difficulty was last adjusted.
+func (c *stratumClient) lastRetargetTime() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lastRetarget
+}
+
+// send writes a message to the client and returns whether that succeeded.
+func (c *stratumClient) send(message interface{}) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logs.Error("Stratum server: can't marshal message: %v", err)
+		return false
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		logs.Debug("Stratum client %s: write failed: %v", c.conn.RemoteAddr(), err)
+		return false
+	}
+	return true
+}
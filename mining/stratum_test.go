@@ -0,0 +1,209 @@
+package mining
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// newTestTemplate returns a template at height 1 holding a coinbase and
+// numTxs other transactions.
+func newTestTemplate(t *testing.T, numTxs int) *BlockTemplate {
+	sig, err := standardCoinbaseScript(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbaseTx := core.NewTx()
+	coinbaseTx.Ins = []*core.TxIn{core.NewTxIn(&core.OutPoint{Hash: utils.HashZero, Index: 0xffffffff}, sig)}
+	coinbaseTx.Outs = []*core.TxOut{core.NewTxOut(5000000000, []byte{core.OP_TRUE})}
+
+	template := newBlockTemplate()
+	template.Block.Txs = []*core.Tx{coinbaseTx}
+	for i := 0; i < numTxs; i++ {
+		tx := core.NewTx()
+		prevOut := &core.OutPoint{Hash: utils.HashOne, Index: uint32(i)}
+		tx.Ins = []*core.TxIn{core.NewTxIn(prevOut, []byte{core.OP_TRUE})}
+		tx.Outs = []*core.TxOut{core.NewTxOut(int64(1000+i), []byte{core.OP_TRUE})}
+		template.Block.Txs = append(template.Block.Txs, tx)
+	}
+	template.Block.BlockHeader.Version = 0x20000000
+	template.Block.BlockHeader.Bits = 0x207fffff
+	template.Block.BlockHeader.Time = 1500000000
+	return template
+}
+
+func TestStratumJobShare(t *testing.T) {
+	for _, numTxs := range []int{0, 1, 2, 4} {
+		template := newTestTemplate(t, numTxs)
+		job, err := newStratumJob("1", template, 1, true)
+		if err != nil {
+			t.Fatalf("%d txs: %v", numTxs, err)
+		}
+
+		share := &stratumShare{
+			extraNonce1: []byte{0x01, 0x02, 0x03, 0x04},
+			extraNonce2: []byte{0xaa, 0xbb, 0xcc, 0xdd},
+			time:        1500000100,
+			nonce:       42,
+		}
+		header, coinbaseTx, err := job.header(share)
+		if err != nil {
+			t.Fatalf("%d txs: %v", numTxs, err)
+		}
+
+		// The rebuilt coinbase carries the extra nonce of the share in
+		// place of the original one.
+		wantScript, err := coinbaseScript(1, append(share.extraNonce1, share.extraNonce2...), CoinbaseFlag())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(coinbaseTx.Ins[0].Script.GetScriptByte(), wantScript) {
+			t.Errorf("%d txs: coinbase script %x, want %x", numTxs,
+				coinbaseTx.Ins[0].Script.GetScriptByte(), wantScript)
+		}
+
+		// The merkle root built from the branch matches the one of the
+		// full block.
+		block := job.block(header, coinbaseTx)
+		wantRoot := msg.BlockMerkleRoot(block, nil)
+		if !header.MerkleRoot.IsEqual(&wantRoot) {
+			t.Errorf("%d txs: merkle root %s, want %s", numTxs,
+				header.MerkleRoot.ToString(), wantRoot.ToString())
+		}
+		if header.Time != share.time || header.Nonce != share.nonce ||
+			header.Bits != job.bits || header.Version != job.version {
+			t.Errorf("%d txs: header %+v does not match the job and share", numTxs, header)
+		}
+		if len(block.Txs) != numTxs+1 {
+			t.Errorf("%d txs: block has %d transactions", numTxs, len(block.Txs))
+		}
+	}
+}
+
+func TestStratumJobBadExtraNonce(t *testing.T) {
+	job, err := newStratumJob("1", newTestTemplate(t, 1), 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := &stratumShare{
+		extraNonce1: []byte{0x01, 0x02, 0x03, 0x04},
+		extraNonce2: []byte{0xaa, 0xbb},
+	}
+	if _, _, err := job.header(share); err == nil {
+		t.Error("share with a short extranonce2 was accepted")
+	}
+}
+
+func TestStratumPrevHash(t *testing.T) {
+	var hash utils.Hash
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	want := "03020100070605040b0a09080f0e0d0c13121110171615141b1a19181f1e1d1c"
+	if got := stratumPrevHash(&hash); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDifficultyTarget(t *testing.T) {
+	if difficultyTarget(1).Cmp(diff1Target) != 0 {
+		t.Errorf("difficulty 1 target %x, want %x", difficultyTarget(1), diff1Target)
+	}
+	half := difficultyTarget(2)
+	if half.Lsh(half, 1).Cmp(diff1Target) != 0 {
+		t.Errorf("difficulty 2 target is not half of the difficulty 1 target")
+	}
+}
+
+func TestVardiffRetarget(t *testing.T) {
+	s := NewStratumServer(&StratumConfig{Difficulty: 64, MinDifficulty: 8, MaxDifficulty: 512})
+	tests := []struct {
+		shares  int
+		elapsed time.Duration
+		want    float64
+	}{
+		// on target
+		{6, 90 * time.Second, 64},
+		// twice as fast as wanted
+		{12, 90 * time.Second, 128},
+		// far too fast, bounded by the maximum adjustment
+		{600, 90 * time.Second, 256},
+		// no shares at all
+		{0, 90 * time.Second, 16},
+		// bounded by the maximum difficulty
+		{600, 90 * time.Second, 512},
+	}
+	for i, test := range tests {
+		c := newStratumClient(s, nil, nil)
+		if i == len(tests)-1 {
+			c.difficulty = 256
+		}
+		c.shares = test.shares
+		c.lastRetarget = time.Now().Add(-test.elapsed)
+		c.retarget(false)
+		// the elapsed time runs on while the test does, so allow for a
+		// small difference
+		if math.Abs(c.difficulty-test.want) > test.want/100 {
+			t.Errorf("test %d: difficulty %v, want %v", i, c.difficulty, test.want)
+		}
+	}
+
+	// Nothing changes before the retarget interval passed.
+	c := newStratumClient(s, nil, nil)
+	c.shares = 100
+	if c.retarget(false) || c.difficulty != 64 {
+		t.Errorf("difficulty changed to %v before the retarget interval", c.difficulty)
+	}
+}
+
+func TestStratumJobPruning(t *testing.T) {
+	s := NewStratumServer(&StratumConfig{})
+	c := newStratumClient(s, nil, nil)
+	s.clients[c] = struct{}{}
+
+	var ids []string
+	for i := 0; i < maxStratumJobs+2; i++ {
+		job, clients, err := s.addJob(newTestTemplate(t, 1), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 1 || clients[0] != c {
+			t.Fatalf("job %s sent to %v", job.id, clients)
+		}
+		if cleanJobs := i == 0; job.cleanJobs != cleanJobs {
+			t.Errorf("job %s: clean jobs %v, want %v", job.id, job.cleanJobs, cleanJobs)
+		}
+		ids = append(ids, job.id)
+		c.submitted[job.id] = map[string]struct{}{"share": {}}
+		c.sendJob(job)
+	}
+
+	// Only the latest jobs are kept, and the shares of the others are
+	// forgotten.
+	for i, id := range ids {
+		kept := i >= len(ids)-maxStratumJobs
+		if (s.job(id) != nil) != kept {
+			t.Errorf("job %s kept %v, want %v", id, s.job(id) != nil, kept)
+		}
+		if _, ok := c.submitted[id]; ok && !kept {
+			t.Errorf("shares of dropped job %s kept", id)
+		}
+	}
+
+	// A job on a new tip drops all the others.
+	template := newTestTemplate(t, 1)
+	template.Block.BlockHeader.HashPrevBlock = utils.HashOne
+	job, _, err := s.addJob(template, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendJob(job)
+	if !job.cleanJobs || len(s.jobs) != 1 || len(c.submitted) != 0 {
+		t.Errorf("%d jobs and the shares of %d jobs kept after a new tip", len(s.jobs), len(c.submitted))
+	}
+}
@@ -0,0 +1,190 @@
+package mining
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+const (
+	// extraNonce1Size is the size of the extra nonce part assigned by the
+	// server, unique to each stratum connection.
+	extraNonce1Size = 4
+
+	// extraNonce2Size is the size of the extra nonce part rolled by the
+	// stratum client.
+	extraNonce2Size = 4
+
+	// maxFutureShareTime is how far ahead of the local clock the time of a
+	// submitted share may be.
+	maxFutureShareTime = 2 * 60 * 60
+)
+
+// diff1Target is the target of a share of difficulty 1, the bitcoin pool
+// difficulty one target 0x00000000ffff0000...
+var diff1Target = blockchain.CompactToBig(0x1d00ffff)
+
+// stratumJob is a block template prepared for stratum clients. The coinbase
+// is split around the extra nonce into coinb1 and coinb2 so that a client
+// can build the coinbase of its choice and, with the merkle branch of the
+// coinbase, the merkle root of the block.
+type stratumJob struct {
+	id           string
+	template     *BlockTemplate
+	height       int
+	prevHash     utils.Hash
+	coinb1       []byte
+	coinb2       []byte
+	merkleBranch []utils.Hash
+	version      int32
+	bits         uint32
+	time         uint32
+	cleanJobs    bool
+}
+
+// newStratumJob prepares template, which was built for height, for stratum
+// clients. cleanJobs tells clients to drop their previous jobs, as it is set
+// when the template was built on a new chain tip.
+func newStratumJob(id string, template *BlockTemplate, height int, cleanJobs bool) (*stratumJob, error) {
+	block := template.Block
+
+	placeholder := make([]byte, extraNonce1Size+extraNonce2Size)
+	flag := CoinbaseFlag()
+	scriptBytes, err := coinbaseScript(height, placeholder, flag)
+	if err != nil {
+		return nil, err
+	}
+	coinbaseTx := block.Txs[0].Copy()
+	coinbaseTx.Ins[0].Script = core.NewScriptRaw(scriptBytes)
+	var buf bytes.Buffer
+	if err := coinbaseTx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	serialized := buf.Bytes()
+
+	// The coinbase serializes as its version, the input count, the null
+	// outpoint and the length of the script before the script itself, in
+	// which the extra nonce is the data right before the coinbase flag.
+	scriptOffset := 4 + utils.VarIntSerializeSize(1) + 36 +
+		utils.VarIntSerializeSize(uint64(len(scriptBytes)))
+	extraNonceOffset := scriptOffset + len(scriptBytes) - len(flag) - len(placeholder)
+
+	leaves := make([]utils.Hash, len(block.Txs))
+	for i, tx := range block.Txs {
+		leaves[i] = tx.TxHash()
+	}
+
+	job := &stratumJob{
+		id:           id,
+		template:     template,
+		height:       height,
+		prevHash:     block.BlockHeader.HashPrevBlock,
+		coinb1:       append([]byte(nil), serialized[:extraNonceOffset]...),
+		coinb2:       append([]byte(nil), serialized[extraNonceOffset+len(placeholder):]...),
+		merkleBranch: msg.ComputeMerkleBranch(leaves, 0),
+		version:      block.BlockHeader.Version,
+		bits:         block.BlockHeader.Bits,
+		time:         block.BlockHeader.Time,
+		cleanJobs:    cleanJobs,
+	}
+	return job, nil
+}
+
+// notifyParams returns the parameters of the mining.notify message
+// announcing the job.
+func (job *stratumJob) notifyParams() []interface{} {
+	branch := make([]string, len(job.merkleBranch))
+	for i := range job.merkleBranch {
+		branch[i] = hex.EncodeToString(job.merkleBranch[i][:])
+	}
+	return []interface{}{
+		job.id,
+		stratumPrevHash(&job.prevHash),
+		hex.EncodeToString(job.coinb1),
+		hex.EncodeToString(job.coinb2),
+		branch,
+		fmt.Sprintf("%08x", uint32(job.version)),
+		fmt.Sprintf("%08x", job.bits),
+		fmt.Sprintf("%08x", job.time),
+		job.cleanJobs,
+	}
+}
+
+// stratumPrevHash encodes the previous block hash the way stratum expects
+// it: the header bytes with each 32-bit word byte swapped.
+func stratumPrevHash(hash *utils.Hash) string {
+	var swapped [utils.Hash256Size]byte
+	for i := 0; i < utils.Hash256Size; i += 4 {
+		binary.BigEndian.PutUint32(swapped[i:], binary.LittleEndian.Uint32(hash[i:]))
+	}
+	return hex.EncodeToString(swapped[:])
+}
+
+// stratumShare is a solution submitted for a job.
+type stratumShare struct {
+	extraNonce1 []byte
+	extraNonce2 []byte
+	time        uint32
+	nonce       uint32
+}
+
+// coinbase rebuilds the coinbase transaction of the share.
+func (job *stratumJob) coinbase(share *stratumShare) (*core.Tx, error) {
+	serialized := make([]byte, 0, len(job.coinb1)+extraNonce1Size+extraNonce2Size+len(job.coinb2))
+	serialized = append(serialized, job.coinb1...)
+	serialized = append(serialized, share.extraNonce1...)
+	serialized = append(serialized, share.extraNonce2...)
+	serialized = append(serialized, job.coinb2...)
+	return core.DeserializeTx(bytes.NewReader(serialized))
+}
+
+// header returns the block header the share commits to along with the
+// coinbase it was built with.
+func (job *stratumJob) header(share *stratumShare) (*core.BlockHeader, *core.Tx, error) {
+	if len(share.extraNonce2) != extraNonce2Size {
+		return nil, nil, errors.New("incorrect size of extranonce2")
+	}
+	coinbaseTx, err := job.coinbase(share)
+	if err != nil {
+		return nil, nil, err
+	}
+	coinbaseHash := coinbaseTx.TxHash()
+
+	header := &core.BlockHeader{
+		Version:       job.version,
+		HashPrevBlock: job.prevHash,
+		MerkleRoot:    msg.ComputeMerkleRootFromBranch(&coinbaseHash, job.merkleBranch, 0),
+		Time:          share.time,
+		Bits:          job.bits,
+		Nonce:         share.nonce,
+	}
+	return header, coinbaseTx, nil
+}
+
+// block returns the full block of a share that solves the job.
+func (job *stratumJob) block(header *core.BlockHeader, coinbaseTx *core.Tx) *core.Block {
+	block := core.NewBlock()
+	block.BlockHeader = *header
+	block.Txs = make([]*core.Tx, len(job.template.Block.Txs))
+	copy(block.Txs, job.template.Block.Txs)
+	block.Txs[0] = coinbaseTx
+	hash, _ := header.GetHash()
+	block.Hash = &hash
+	return block
+}
+
+// difficultyTarget returns the target a share of the given difficulty must
+// not exceed.
+func difficultyTarget(difficulty float64) *big.Int {
+	target, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target),
+		big.NewFloat(difficulty)).Int(nil)
+	return target
+}
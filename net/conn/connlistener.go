@@ -6,12 +6,21 @@ import (
 )
 
 type ConnectListener struct {
-	Listeners       []net.Listener
-	OnAccept        func(conn net.Conn)
-	TargetOutbound  uint32
+	Listeners      []net.Listener
+	OnAccept       func(conn net.Conn)
+	TargetOutbound uint32
+	// TargetBlockRelay is the number of block-relay-only connections made
+	// on top of the TargetOutbound full relay ones.
+	TargetBlockRelay uint32
+	// FeelerInterval is how often a feeler connection is made once the
+	// full relay connections are all made.
+	FeelerInterval time.Duration
+	// Anchors are the addresses of the block-relay-only connections made
+	// first, those of the block-relay-only peers of the last run.
+	Anchors         []net.Addr
 	RetryDuration   time.Duration
 	OnConnection    func(request *ConnectRequest, conn net.Conn)
 	OnDisconnection func(request *ConnectRequest)
-	GetNewAddress   func() (net.Addr, error)
+	GetNewAddress   func(connType ConnectionType) (net.Addr, error)
 	Dial            func(addr net.Addr) (net.Conn, error)
 }
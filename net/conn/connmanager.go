@@ -11,10 +11,12 @@ import (
 )
 
 const (
-	maxRetryDuration      = time.Minute * 5
-	defaultRetryDuration  = time.Second * 5
-	defaultTargetOutbound = uint32(8)
-	maxFailedAttempts     = 25
+	maxRetryDuration        = time.Minute * 5
+	defaultRetryDuration    = time.Second * 5
+	defaultTargetOutbound   = uint32(8)
+	defaultTargetBlockRelay = uint32(2)
+	defaultFeelerInterval   = time.Minute * 2
+	maxFailedAttempts       = 25
 )
 
 type ConnectManager struct {
@@ -58,16 +60,19 @@ func (connectManager *ConnectManager) handleFailedConnect(connectRequest *Connec
 			connectManager.Connect(connectRequest)
 		})
 
-	} else if connectManager.listener.GetNewAddress != nil {
+	} else if connectManager.listener.GetNewAddress != nil && connectRequest.Type != Feeler {
+		// A failed feeler is not replaced, the next one tests another
+		// address.
+		connType := connectRequest.Type
 		connectManager.failedAttempts++
 		if connectManager.failedAttempts >= maxFailedAttempts {
 			logs.Debug("max failed connection attempts reached :[%d]--retrying connection in:%v",
 				maxFailedAttempts, connectManager.listener.RetryDuration)
 			time.AfterFunc(connectManager.listener.RetryDuration, func() {
-				connectManager.NewConnectRequest()
+				connectManager.NewConnectRequest(connType)
 			})
 		} else {
-			go connectManager.NewConnectRequest()
+			go connectManager.NewConnectRequest(connType)
 		}
 
 	}
@@ -121,17 +126,19 @@ func (connectManager *ConnectManager) listenHandler(listener net.Listener) {
 	logs.Trace("Listener handler done for %s", listener.Addr())
 }
 
-func (connectManager *ConnectManager) NewConnectRequest() {
+// NewConnectRequest makes an outbound connection of the type to an address
+// returned by GetNewAddress.
+func (connectManager *ConnectManager) NewConnectRequest(connType ConnectionType) {
 	//if atomic.LoadInt32(&connectManager.stop) != 0 {
 	//	return
 	//}
-	logs.Debug("NewConnectRequest ")
+	logs.Debug("NewConnectRequest %s", connType)
 	if connectManager.listener.GetNewAddress == nil {
 		return
 	}
-	connectRequest := &ConnectRequest{}
+	connectRequest := &ConnectRequest{Type: connType}
 	atomic.StoreUint64(&connectRequest.id, atomic.AddUint64(&connectManager.connRequestCount, 1))
-	address, err := connectManager.listener.GetNewAddress()
+	address, err := connectManager.listener.GetNewAddress(connType)
 	logs.Debug("NewConnectRequest :%s", address)
 	if err != nil {
 		connectManager.requests <- handleFailed{connectRequest, err}
@@ -141,11 +148,43 @@ func (connectManager *ConnectManager) NewConnectRequest() {
 	connectManager.Connect(connectRequest)
 }
 
+// target returns the number of connections of the type the connection
+// manager keeps, the connections of the other types aren't replaced.
+func (connectManager *ConnectManager) target(connType ConnectionType) uint32 {
+	switch connType {
+	case OutboundFullRelay:
+		return connectManager.listener.TargetOutbound
+	case BlockRelayOnly:
+		return connectManager.listener.TargetBlockRelay
+	}
+	return 0
+}
+
+// countConns returns the number of established connections of the type.
+func countConns(conns map[uint64]*ConnectRequest, connType ConnectionType) uint32 {
+	count := uint32(0)
+	for _, connectRequest := range conns {
+		if connectRequest.Type == connType {
+			count++
+		}
+	}
+	return count
+}
+
 func (connectManager *ConnectManager) connectHandler() {
 	conns := make(map[uint64]*ConnectRequest, connectManager.listener.TargetOutbound)
+	feelerTicker := time.NewTicker(connectManager.listener.FeelerInterval)
+	defer feelerTicker.Stop()
 out:
 	for {
 		select {
+		case <-feelerTicker.C:
+			// Feelers are only made once the full relay connections
+			// are all made, they would take their place otherwise.
+			if connectManager.listener.GetNewAddress != nil &&
+				countConns(conns, OutboundFullRelay) >= connectManager.listener.TargetOutbound {
+				go connectManager.NewConnectRequest(Feeler)
+			}
 		case request := <-connectManager.requests:
 			switch msg := request.(type) {
 			case handleConnected:
@@ -170,7 +209,8 @@ out:
 					if connectManager.listener.OnDisconnection != nil {
 						go connectManager.listener.OnDisconnection(connectRequest)
 					}
-					if uint32(len(conns)) < connectManager.listener.TargetOutbound && msg.retry {
+					if msg.retry && (connectRequest.Permanent ||
+						countConns(conns, connectRequest.Type) < connectManager.target(connectRequest.Type)) {
 						connectManager.handleFailedConnect(connectRequest)
 					}
 				} else {
@@ -207,9 +247,24 @@ func (connectManager *ConnectManager) Start() {
 			go connectManager.listenHandler(listener)
 		}
 	}
-	for i := atomic.LoadUint64(&connectManager.connRequestCount); i < uint64(connectManager.listener.TargetOutbound); i++ {
+	outbound := atomic.LoadUint64(&connectManager.connRequestCount)
+
+	// The anchors take the first block-relay-only slots.
+	blockRelay := uint32(0)
+	for _, address := range connectManager.listener.Anchors {
+		if blockRelay == connectManager.listener.TargetBlockRelay {
+			break
+		}
+		logs.Debug("Connecting to anchor %s", address)
+		go connectManager.Connect(&ConnectRequest{Address: address, Type: BlockRelayOnly})
+		blockRelay++
+	}
+	for ; blockRelay < connectManager.listener.TargetBlockRelay; blockRelay++ {
+		go connectManager.NewConnectRequest(BlockRelayOnly)
+	}
+	for i := outbound; i < uint64(connectManager.listener.TargetOutbound); i++ {
 		logs.Trace("Connection manager NewConnectRequest")
-		go connectManager.NewConnectRequest()
+		go connectManager.NewConnectRequest(OutboundFullRelay)
 	}
 
 }
@@ -242,6 +297,12 @@ func NewConnectManager(listener *ConnectListener) (*ConnectManager, error) {
 		listener.TargetOutbound = defaultTargetOutbound
 
 	}
+	if listener.TargetBlockRelay == 0 {
+		listener.TargetBlockRelay = defaultTargetBlockRelay
+	}
+	if listener.FeelerInterval <= 0 {
+		listener.FeelerInterval = defaultFeelerInterval
+	}
 	connectManager := ConnectManager{
 		listener: listener,
 		requests: make(chan interface{}),
@@ -0,0 +1,240 @@
+package conn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConnections records the addresses asked for and the connections made
+// by a connection manager.  The addresses it hands out are 10.0.t.n, t being
+// the connection type asked for.
+type testConnections struct {
+	lock      sync.Mutex
+	asked     map[ConnectionType]int
+	askTimes  map[ConnectionType][]time.Time
+	connected map[ConnectionType][]string
+	requests  []*ConnectRequest
+	// dial returns the error of dialing an address, nil to connect.
+	dial func(addr net.Addr) error
+	// connectedChan is sent the requests of the connections made.
+	connectedChan chan *ConnectRequest
+}
+
+func newTestConnections() *testConnections {
+	return &testConnections{
+		asked:         make(map[ConnectionType]int),
+		askTimes:      make(map[ConnectionType][]time.Time),
+		connected:     make(map[ConnectionType][]string),
+		connectedChan: make(chan *ConnectRequest, 100),
+	}
+}
+
+func (conns *testConnections) listener() *ConnectListener {
+	return &ConnectListener{
+		RetryDuration: time.Millisecond,
+		GetNewAddress: func(connType ConnectionType) (net.Addr, error) {
+			conns.lock.Lock()
+			defer conns.lock.Unlock()
+			conns.asked[connType]++
+			conns.askTimes[connType] = append(conns.askTimes[connType], time.Now())
+			ip := net.IPv4(10, 0, byte(connType), byte(conns.asked[connType]))
+			return &net.TCPAddr{IP: ip, Port: 8333}, nil
+		},
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			if conns.dial != nil {
+				if err := conns.dial(addr); err != nil {
+					return nil, err
+				}
+			}
+			local, remote := net.Pipe()
+			remote.Close()
+			return local, nil
+		},
+		OnConnection: func(request *ConnectRequest, conn net.Conn) {
+			conns.lock.Lock()
+			conns.connected[request.Type] = append(conns.connected[request.Type], request.Address.String())
+			conns.requests = append(conns.requests, request)
+			conns.lock.Unlock()
+			conns.connectedChan <- request
+		},
+	}
+}
+
+// waitConnections waits for n connections to be made.
+func (conns *testConnections) waitConnections(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-conns.connectedChan:
+		case <-time.After(time.Second):
+			t.Fatalf("%d connections made, want %d", i, n)
+		}
+	}
+}
+
+// expectNoConnection fails the test when a connection is made within wait.
+func (conns *testConnections) expectNoConnection(t *testing.T, wait time.Duration) {
+	select {
+	case request := <-conns.connectedChan:
+		t.Errorf("unexpected %s connection to %s", request.Type, request.Address)
+	case <-time.After(wait):
+	}
+}
+
+func (conns *testConnections) askedFor(connType ConnectionType) int {
+	conns.lock.Lock()
+	defer conns.lock.Unlock()
+	return conns.asked[connType]
+}
+
+func TestConnectManagerAnchors(t *testing.T) {
+	anchors := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 8333},
+		&net.TCPAddr{IP: net.ParseIP("2.2.2.2"), Port: 8333},
+		&net.TCPAddr{IP: net.ParseIP("3.3.3.3"), Port: 8333},
+	}
+	tests := []struct {
+		name       string
+		anchors    []net.Addr
+		blockRelay []string
+		askedFor   int
+	}{
+		{"no anchors", nil, []string{"10.0.1.1:8333", "10.0.1.2:8333"}, 2},
+		{"one anchor", anchors[:1], []string{"1.1.1.1:8333", "10.0.1.1:8333"}, 1},
+		// Only the first anchors fill the block-relay-only slots.
+		{"more anchors than slots", anchors, []string{"1.1.1.1:8333", "2.2.2.2:8333"}, 0},
+	}
+	for _, test := range tests {
+		conns := newTestConnections()
+		listener := conns.listener()
+		listener.TargetOutbound = 3
+		listener.TargetBlockRelay = 2
+		listener.FeelerInterval = time.Hour
+		listener.Anchors = test.anchors
+		connectManager, err := NewConnectManager(listener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectManager.Start()
+		conns.waitConnections(t, 5)
+		conns.expectNoConnection(t, 20*time.Millisecond)
+		connectManager.Stop()
+
+		conns.lock.Lock()
+		blockRelay := conns.connected[BlockRelayOnly]
+		conns.lock.Unlock()
+		if len(blockRelay) != 2 || !sameStrings(blockRelay, test.blockRelay) {
+			t.Errorf("%s: block-relay-only connections to %v, want %v", test.name, blockRelay, test.blockRelay)
+		}
+		if n := len(conns.connected[OutboundFullRelay]); n != 3 {
+			t.Errorf("%s: %d full relay connections, want 3", test.name, n)
+		}
+		if n := conns.askedFor(BlockRelayOnly); n != test.askedFor {
+			t.Errorf("%s: %d block-relay-only addresses asked for, want %d", test.name, n, test.askedFor)
+		}
+	}
+}
+
+// sameStrings returns whether a and b hold the same strings in any order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+		if counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConnectManagerReplaceBlockRelayOnly(t *testing.T) {
+	conns := newTestConnections()
+	listener := conns.listener()
+	listener.TargetOutbound = 1
+	listener.TargetBlockRelay = 1
+	listener.FeelerInterval = time.Hour
+	connectManager, err := NewConnectManager(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectManager.Start()
+	defer connectManager.Stop()
+	conns.waitConnections(t, 2)
+
+	// A lost block-relay-only connection is replaced by another one.
+	conns.lock.Lock()
+	var request *ConnectRequest
+	for _, r := range conns.requests {
+		if r.Type == BlockRelayOnly {
+			request = r
+		}
+	}
+	conns.lock.Unlock()
+	connectManager.Disconnect(request.ID())
+	conns.waitConnections(t, 1)
+	if n := conns.askedFor(BlockRelayOnly); n != 2 {
+		t.Errorf("%d block-relay-only addresses asked for, want 2", n)
+	}
+	if n := conns.askedFor(OutboundFullRelay); n != 1 {
+		t.Errorf("%d full relay addresses asked for, want 1", n)
+	}
+}
+
+func TestConnectManagerFeelers(t *testing.T) {
+	const feelerInterval = 20 * time.Millisecond
+	conns := newTestConnections()
+	fullRelay := make(chan struct{})
+	conns.dial = func(addr net.Addr) error {
+		switch ConnectionType(addr.(*net.TCPAddr).IP.To4()[2]) {
+		case OutboundFullRelay:
+			<-fullRelay
+		case Feeler:
+			return errors.New("feeler refused")
+		}
+		return nil
+	}
+	listener := conns.listener()
+	listener.TargetOutbound = 2
+	listener.TargetBlockRelay = 1
+	listener.FeelerInterval = feelerInterval
+	connectManager, err := NewConnectManager(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectManager.Start()
+	defer connectManager.Stop()
+
+	// No feeler is made until the full relay connections are all made.
+	conns.waitConnections(t, 1)
+	time.Sleep(5 * feelerInterval)
+	if n := conns.askedFor(Feeler); n != 0 {
+		t.Fatalf("%d feelers made before the full relay connections", n)
+	}
+	close(fullRelay)
+	conns.waitConnections(t, 2)
+	time.Sleep(10 * feelerInterval)
+
+	// A failed feeler isn't replaced, a feeler is only made on a tick.
+	conns.lock.Lock()
+	askTimes := conns.askTimes[Feeler]
+	conns.lock.Unlock()
+	if len(askTimes) < 2 || len(askTimes) > 11 {
+		t.Fatalf("%d feelers made in 10 feeler intervals", len(askTimes))
+	}
+	for i := 1; i < len(askTimes); i++ {
+		if gap := askTimes[i].Sub(askTimes[i-1]); gap < feelerInterval/2 {
+			t.Errorf("feeler %d made %v after the previous one", i, gap)
+		}
+	}
+	if n := conns.askedFor(OutboundFullRelay); n != 2 {
+		t.Errorf("%d full relay addresses asked for, want 2", n)
+	}
+}
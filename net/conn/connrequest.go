@@ -7,10 +7,46 @@ import (
 	"sync/atomic"
 )
 
+// ConnectionType tells what an outbound connection is made for.
+type ConnectionType uint8
+
+const (
+	// OutboundFullRelay connections relay blocks, transactions and
+	// addresses.
+	OutboundFullRelay ConnectionType = iota
+
+	// BlockRelayOnly connections relay blocks only, which makes them harder
+	// to infer from the relay of transactions and addresses.
+	BlockRelayOnly
+
+	// Feeler connections are closed after the handshake, they test an
+	// address of the new table before it is marked good.
+	Feeler
+
+	// Manual connections are made to the peers given by the user.
+	Manual
+)
+
+var connectionTypeStrings = map[ConnectionType]string{
+	OutboundFullRelay: "outbound-full-relay",
+	BlockRelayOnly:    "block-relay-only",
+	Feeler:            "feeler",
+	Manual:            "manual",
+}
+
+// String returns the name of the connection type, as shown by getpeerinfo.
+func (connType ConnectionType) String() string {
+	if str, ok := connectionTypeStrings[connType]; ok {
+		return str
+	}
+	return fmt.Sprintf("unknown connection type (%d)", uint8(connType))
+}
+
 type ConnectRequest struct {
 	id         uint64
 	Address    net.Addr
 	Permanent  bool
+	Type       ConnectionType
 	Conn       net.Conn
 	state      ConnectState
 	lock       sync.RWMutex
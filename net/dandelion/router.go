@@ -0,0 +1,165 @@
+// Package dandelion routes the transactions along the stem of the Dandelion++
+// protocol, which hides the node a transaction comes from: the transaction is
+// first relayed from peer to peer along a random path, the stem, and only
+// then diffused to all the peers, the fluff.
+package dandelion
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// EpochDuration is how long the stem routes and the role of the node
+	// are kept, changing them less often leaks less to the spies which
+	// watch the paths.
+	EpochDuration = 10 * time.Minute
+
+	// Destinations is the number of outbound peers the stem transactions
+	// are relayed to during an epoch.
+	Destinations = 2
+
+	// FluffProbability is the probability for the node to fluff, rather
+	// than relay, the stem transactions it receives during an epoch.
+	FluffProbability = 0.1
+
+	// EmbargoMin and EmbargoAverage are the minimum and the average extra
+	// time a stem transaction waits to show up from the fluff before the
+	// node fluffs it itself, in case a node of the stem dropped it.
+	EmbargoMin     = 10 * time.Second
+	EmbargoAverage = 20 * time.Second
+)
+
+// Local is the origin of the transactions submitted to the node itself.
+const Local int32 = -1
+
+// Router picks the stem destination of the transactions.  At each epoch, it
+// picks whether the node fluffs the stem transactions it receives, and up to
+// Destinations outbound peers among the Dandelion peers; each origin is then
+// routed to one of them for the whole epoch.
+type Router struct {
+	lock             sync.Mutex
+	rand             *rand.Rand
+	epoch            time.Duration
+	fluffProbability float64
+	epochEnd         time.Time
+	fluff            bool
+	candidates       map[int32]struct{}
+	destinations     []int32
+	routes           map[int32]int32
+}
+
+// NewRouter returns a router whose epochs last epoch, during which the node
+// fluffs the stem transactions it receives with fluffProbability.
+func NewRouter(epoch time.Duration, fluffProbability float64) *Router {
+	return &Router{
+		rand:             rand.New(rand.NewSource(time.Now().UnixNano())),
+		epoch:            epoch,
+		fluffProbability: fluffProbability,
+		candidates:       make(map[int32]struct{}),
+		routes:           make(map[int32]int32),
+	}
+}
+
+// AddPeer adds an outbound Dandelion peer, which may be picked as a stem
+// destination.
+func (router *Router) AddPeer(id int32) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	router.candidates[id] = struct{}{}
+}
+
+// RemovePeer removes a peer which disconnected, the origins routed to it are
+// routed again.
+func (router *Router) RemovePeer(id int32) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	delete(router.candidates, id)
+	delete(router.routes, id)
+	for i, destination := range router.destinations {
+		if destination == id {
+			router.destinations = append(router.destinations[:i], router.destinations[i+1:]...)
+			break
+		}
+	}
+	for from, to := range router.routes {
+		if to == id {
+			delete(router.routes, from)
+		}
+	}
+}
+
+// Route returns the peer the stem transactions of from are relayed to at
+// now.  ok is false when they must be fluffed, which happens when the node
+// fluffs during this epoch, for the transactions of the peers only, or when
+// there is no Dandelion peer to relay them to.
+func (router *Router) Route(now time.Time, from int32) (to int32, ok bool) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if !now.Before(router.epochEnd) {
+		router.newEpoch(now)
+	}
+	if from != Local && router.fluff {
+		return 0, false
+	}
+	if to, ok := router.routes[from]; ok {
+		return to, true
+	}
+	router.pickDestinations()
+	choices := make([]int32, 0, len(router.destinations))
+	for _, destination := range router.destinations {
+		if destination != from {
+			choices = append(choices, destination)
+		}
+	}
+	if len(choices) == 0 {
+		return 0, false
+	}
+	to = choices[router.rand.Intn(len(choices))]
+	router.routes[from] = to
+	return to, true
+}
+
+// newEpoch starts the epoch of now, with a new role and new destinations.
+// The caller must hold the lock.
+func (router *Router) newEpoch(now time.Time) {
+	router.epochEnd = now.Add(router.epoch)
+	router.fluff = router.rand.Float64() < router.fluffProbability
+	router.destinations = router.destinations[:0]
+	router.routes = make(map[int32]int32)
+	router.pickDestinations()
+}
+
+// pickDestinations picks random candidates until there are Destinations
+// destinations, it tops up the destinations of an epoch which started with
+// too few peers or lost some.  The caller must hold the lock.
+func (router *Router) pickDestinations() {
+	if len(router.destinations) >= Destinations {
+		return
+	}
+	picked := make(map[int32]struct{}, len(router.destinations))
+	for _, destination := range router.destinations {
+		picked[destination] = struct{}{}
+	}
+	others := make([]int32, 0, len(router.candidates))
+	for id := range router.candidates {
+		if _, ok := picked[id]; !ok {
+			others = append(others, id)
+		}
+	}
+	for _, i := range router.rand.Perm(len(others)) {
+		if len(router.destinations) >= Destinations {
+			break
+		}
+		router.destinations = append(router.destinations, others[i])
+	}
+}
+
+// Embargo returns the time at which a stem transaction received at now is
+// fluffed by the node, unless it shows up from the fluff before.
+func Embargo(now time.Time) time.Time {
+	delay := -math.Log1p(-rand.Float64()) * float64(EmbargoAverage)
+	return now.Add(EmbargoMin + time.Duration(delay))
+}
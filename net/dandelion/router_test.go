@@ -0,0 +1,132 @@
+package dandelion
+
+import (
+	"testing"
+	"time"
+)
+
+// node is an in-process peer of a test network, its outbound peers are the
+// candidates of its router.
+type node struct {
+	id     int32
+	router *Router
+}
+
+func newNode(id int32, fluffProbability float64, outbound ...int32) *node {
+	n := &node{id: id, router: NewRouter(EpochDuration, fluffProbability)}
+	for _, peer := range outbound {
+		n.router.AddPeer(peer)
+	}
+	return n
+}
+
+// stem relays a transaction submitted to the first node along the stem, and
+// returns the nodes it went through, the last one fluffed it.
+func stem(nodes map[int32]*node, first int32, now time.Time) []int32 {
+	path := []int32{first}
+	from, at := Local, first
+	for len(path) <= len(nodes) {
+		to, ok := nodes[at].router.Route(now, from)
+		if !ok {
+			break
+		}
+		path = append(path, to)
+		from, at = at, to
+	}
+	return path
+}
+
+func TestRouteStemPath(t *testing.T) {
+	// A line of relaying nodes ending with a node which always fluffs.
+	nodes := map[int32]*node{
+		0: newNode(0, 0, 1),
+		1: newNode(1, 0, 2),
+		2: newNode(2, 0, 3),
+		3: newNode(3, 1, 0),
+	}
+	path := stem(nodes, 0, time.Now())
+	want := []int32{0, 1, 2, 3}
+	if len(path) != len(want) {
+		t.Fatalf("stem path %v, want %v", path, want)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Fatalf("stem path %v, want %v", path, want)
+		}
+	}
+}
+
+func TestRouteLocalAlwaysStems(t *testing.T) {
+	n := newNode(0, 1, 1, 2, 3)
+	now := time.Now()
+	if _, ok := n.router.Route(now, Local); !ok {
+		t.Error("local transaction fluffed by a fluffing node")
+	}
+	if _, ok := n.router.Route(now, 7); ok {
+		t.Error("peer transaction relayed by a fluffing node")
+	}
+}
+
+func TestRouteNoPeers(t *testing.T) {
+	n := newNode(0, 0)
+	if _, ok := n.router.Route(time.Now(), Local); ok {
+		t.Error("transaction relayed without Dandelion peers")
+	}
+}
+
+func TestRoutePerEpoch(t *testing.T) {
+	n := newNode(0, 0, 1, 2, 3, 4, 5, 6, 7, 8)
+	now := time.Now()
+	routes := make(map[int32]int32)
+	destinations := make(map[int32]struct{})
+	for from := int32(100); from < 150; from++ {
+		to, ok := n.router.Route(now, from)
+		if !ok {
+			t.Fatalf("peer %d fluffed by a relaying node", from)
+		}
+		routes[from] = to
+		destinations[to] = struct{}{}
+	}
+	if len(destinations) > Destinations {
+		t.Errorf("%d destinations in an epoch, want at most %d", len(destinations), Destinations)
+	}
+	// The routes are kept for the whole epoch.
+	later := now.Add(EpochDuration / 2)
+	for from, want := range routes {
+		if to, _ := n.router.Route(later, from); to != want {
+			t.Errorf("peer %d routed to %d, then to %d in the same epoch", from, want, to)
+		}
+	}
+}
+
+func TestRouteRemovedPeer(t *testing.T) {
+	n := newNode(0, 0, 1, 2, 3)
+	now := time.Now()
+	to, ok := n.router.Route(now, Local)
+	if !ok {
+		t.Fatal("local transaction fluffed")
+	}
+	n.router.RemovePeer(to)
+	again, ok := n.router.Route(now, Local)
+	if !ok {
+		t.Fatal("local transaction fluffed after a destination disconnected")
+	}
+	if again == to {
+		t.Errorf("routed to the disconnected peer %d", to)
+	}
+	for _, id := range []int32{1, 2, 3} {
+		n.router.RemovePeer(id)
+	}
+	if _, ok := n.router.Route(now, Local); ok {
+		t.Error("transaction relayed after all the Dandelion peers disconnected")
+	}
+}
+
+func TestEmbargo(t *testing.T) {
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if embargo := Embargo(now); embargo.Before(now.Add(EmbargoMin)) {
+			t.Fatalf("embargo %v before the minimum %v", embargo.Sub(now), EmbargoMin)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package msg
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcboost/copernicus/net/protocol"
+	"github.com/pkg/errors"
+)
+
+// FeeFilterMessage implements the feefilter message of BIP133, which tells
+// the peer not to announce transactions with a fee rate below MinFee.
+type FeeFilterMessage struct {
+	// MinFee the minimum fee rate in satoshi per KB
+	MinFee int64
+}
+
+func (feeFilterMessage *FeeFilterMessage) BitcoinParse(reader io.Reader, pver uint32) error {
+	if pver < protocol.FeeFilterVersion {
+		str := fmt.Sprintf("feefilter message invalid for protocol version %d", pver)
+		return errors.New(str)
+	}
+	err := protocol.ReadElement(reader, &feeFilterMessage.MinFee)
+	return err
+}
+
+func (feeFilterMessage *FeeFilterMessage) BitcoinSerialize(w io.Writer, pver uint32) error {
+	if pver < protocol.FeeFilterVersion {
+		str := fmt.Sprintf("feefilter message invalid for protocol version %d", pver)
+		return errors.New(str)
+	}
+	err := protocol.WriteElement(w, feeFilterMessage.MinFee)
+	return err
+}
+
+func (feeFilterMessage *FeeFilterMessage) Command() string {
+	return CommandFeeFilter
+}
+
+func (feeFilterMessage *FeeFilterMessage) MaxPayloadLength(pver uint32) uint32 {
+	return 8
+}
+
+func NewFeeFilterMessage(minFee int64) *FeeFilterMessage {
+	return &FeeFilterMessage{MinFee: minFee}
+}
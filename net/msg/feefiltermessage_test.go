@@ -0,0 +1,42 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcboost/copernicus/net/protocol"
+)
+
+func TestFeeFilterMessage(t *testing.T) {
+	pver := protocol.BitcoinProtocolVersion
+
+	feeFilterMessage := NewFeeFilterMessage(123123)
+	if cmd := feeFilterMessage.Command(); cmd != "feefilter" {
+		t.Errorf("NewFeeFilterMessage: wrong command - got %v want feefilter", cmd)
+	}
+	if maxPayload := feeFilterMessage.MaxPayloadLength(pver); maxPayload != 8 {
+		t.Errorf("MaxPayloadLength: wrong max payload length - got %v, want 8", maxPayload)
+	}
+
+	var buf bytes.Buffer
+	if err := feeFilterMessage.BitcoinSerialize(&buf, pver); err != nil {
+		t.Fatalf("BitcoinSerialize: %v", err)
+	}
+	want := []byte{0xf3, 0xe0, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("BitcoinSerialize: wrong bytes - got %x, want %x", buf.Bytes(), want)
+	}
+
+	var readMessage FeeFilterMessage
+	if err := readMessage.BitcoinParse(bytes.NewReader(want), pver); err != nil {
+		t.Fatalf("BitcoinParse: %v", err)
+	}
+	if readMessage.MinFee != feeFilterMessage.MinFee {
+		t.Errorf("BitcoinParse: wrong fee - got %v, want %v", readMessage.MinFee, feeFilterMessage.MinFee)
+	}
+
+	// the message is invalid before the feefilter version.
+	if err := readMessage.BitcoinParse(bytes.NewReader(want), protocol.FeeFilterVersion-1); err == nil {
+		t.Error("BitcoinParse: feefilter should be refused before FeeFilterVersion")
+	}
+}
@@ -1,15 +1,66 @@
 package msg
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
 
+	"github.com/btcboost/copernicus/utils"
+)
+
+// GetDataMessage asks for the data of the inventory vectors, it is encoded
+// like the inv message.
 type GetDataMessage struct {
+	InventoryList []*InventoryVector
+}
+
+func (getDataMessage *GetDataMessage) AddInventoryVector(iv *InventoryVector) error {
+	if len(getDataMessage.InventoryList)+1 > MaxInventoryMessage {
+		str := fmt.Sprintf("too many invvect in message max %v", MaxInventoryMessage)
+		return errors.New(str)
+	}
+	getDataMessage.InventoryList = append(getDataMessage.InventoryList, iv)
+	return nil
 }
 
 func (getDataMessage *GetDataMessage) BitcoinSerialize(w io.Writer, size uint32) error {
+	count := len(getDataMessage.InventoryList)
+	if count > MaxInventoryMessage {
+		str := fmt.Sprintf("too many inventory in message %v", count)
+		return errors.New(str)
+	}
+	err := utils.WriteVarInt(w, uint64(count))
+	if err != nil {
+		return err
+	}
+	for _, iv := range getDataMessage.InventoryList {
+		err := WriteInvVect(w, iv)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (getDataMessage *GetDataMessage) BitcoinParse(reader io.Reader, size uint32) error {
+	count, err := utils.ReadVarInt(reader)
+	if err != nil {
+		return err
+	}
+	if count > MaxInventoryMessage {
+		str := fmt.Sprintf("too many inventory in message %v", count)
+		return errors.New(str)
+	}
+	inventoryList := make([]InventoryVector, count)
+	getDataMessage.InventoryList = make([]*InventoryVector, 0, count)
+	for i := uint64(0); i < count; i++ {
+		iv := &inventoryList[i]
+		err := ReadInventoryVector(reader, iv)
+		if err != nil {
+			return err
+		}
+		getDataMessage.AddInventoryVector(iv)
+	}
 	return nil
 }
 
@@ -18,5 +69,5 @@ func (getDataMessage *GetDataMessage) Command() string {
 }
 
 func (getDataMessage *GetDataMessage) MaxPayloadLength(size uint32) uint32 {
-	return 0
+	return MaxVarIntPayload + (MaxInventoryMessage + MaxInventoryPayload)
 }
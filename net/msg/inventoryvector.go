@@ -17,6 +17,9 @@ const (
 	InventoryTypeTx            protocol.InventoryType = 1
 	InventoryTypeBlock         protocol.InventoryType = 2
 	InventoryTypeFilteredBlock protocol.InventoryType = 3
+	// InventoryTypeDandelionTx announces a transaction of the Dandelion++
+	// stem, only the peer it is relayed to may ask for it.
+	InventoryTypeDandelionTx protocol.InventoryType = 5
 )
 
 type RelayInvVectMsg struct {
@@ -44,6 +47,8 @@ func InventoryTypeToString(inventoryType protocol.InventoryType) string {
 		return "msg_filtered_block"
 	case InventoryTypeTx:
 		return "msg_filtered_block"
+	case InventoryTypeDandelionTx:
+		return "msg_dandelion_tx"
 	}
 	return fmt.Sprintf("Unknown Inventory type (%d)", uint32(inventoryType))
 
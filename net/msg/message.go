@@ -39,6 +39,7 @@ const (
 	CommandMerkleBlock = "merkleblock"
 	CommandReject      = "reject"
 	CommandSendHeaders = "sendheaders"
+	CommandFeeFilter   = "feefilter"
 )
 
 type Message interface {
@@ -97,6 +98,8 @@ func MessageSummary(msg Message) string {
 		return LocatorSummary(msgType.BlockHashes, msgType.HashStop)
 	case *HeadersMessage:
 		return fmt.Sprintf("num %d", len(msgType.Blocks))
+	case *FeeFilterMessage:
+		return fmt.Sprintf("minfee %d", msgType.MinFee)
 	case *RejectMessage:
 		rejCommand := SanitizeString(msgType.Command(), CommandSize)
 		rejReason := SanitizeString(msgType.Reason, MaxRejectReasonLen)
@@ -145,6 +148,8 @@ func makeEmptyMessage(command string) (Message, error) {
 		message = &GetHeadersMessage{}
 	case CommandReject:
 		message = &RejectMessage{}
+	case CommandFeeFilter:
+		message = &FeeFilterMessage{}
 
 	default:
 		return nil, fmt.Errorf("unknown command %s", command)
@@ -3,17 +3,16 @@ package network
 import (
 	"container/list"
 	crand "crypto/rand"
-	"encoding/base32"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -43,12 +42,22 @@ const (
 	AddressPercent        = 23
 	AddressMax            = 2500
 	TriedBucketSize       = 256
+
+	// PeersFileName is the name of the file in the data directory the
+	// addresses are saved to.
+	PeersFileName = "peers.dat"
+
+	// JSONPeersFileName is the name of the JSON file the addresses were
+	// saved to by the earlier versions.
+	JSONPeersFileName = "p2p.json"
 )
 
 type NetAddressManager struct {
 	lock           sync.Mutex
 	peersFile      string
+	jsonPeersFile  string
 	lookupFunc     utils.LookupFunc
+	asMap          *ASMap
 	rand           *rand.Rand
 	key            [32]byte
 	addressIndex   *beegoUtils.BeeMap
@@ -147,7 +156,7 @@ func (addressManager *NetAddressManager) expireNew(bucket int) {
 func (addressManager *NetAddressManager) pickTried(bucket int) *list.Element {
 	var oldest *KnownAddress
 	var oldestElem *list.Element
-	for e := addressManager.addressTried[bucket].Front(); e != nil; e.Next() {
+	for e := addressManager.addressTried[bucket].Front(); e != nil; e = e.Next() {
 		knownAddress := e.Value.(*KnownAddress)
 		if oldest == nil || oldest.NetAddress.Timestamp.After(knownAddress.NetAddress.Timestamp) {
 			oldestElem = e
@@ -167,59 +176,49 @@ func (addressManager *NetAddressManager) getTriedBucket(netAddress *PeerAddress)
 	binary.LittleEndian.PutUint64(hashBuf[:], hash64)
 	dataSecond := []byte{}
 	dataSecond = append(dataSecond, addressManager.key[:]...)
-	dataSecond = append(dataSecond, netAddress.GroupKey()...)
+	dataSecond = append(dataSecond, addressManager.GroupKey(netAddress)...)
 	dataSecond = append(dataSecond, hashBuf[:]...)
 	hashSecond := crypto.DoubleSha256Bytes(dataSecond)
 	return int(binary.LittleEndian.Uint64(hashSecond) % TriedBucketCount)
 
 }
+
+// savePeers writes the addresses to the peers file, through a temporary file
+// so that a crash doesn't leave a truncated file behind.
 func (addressManager *NetAddressManager) savePeers() {
 	addressManager.lock.Lock()
 	defer addressManager.lock.Unlock()
-	serializedAddressManager := new(SerializedAddressManager)
-	serializedAddressManager.Version = SerialisationVersion
-	copy(serializedAddressManager.Key[:], addressManager.key[:])
-	serializedAddressManager.Addresses = make([]*SerializedKnownAddress, addressManager.addressIndex.Count())
-	i := 0
-	for k, v := range addressManager.addressIndex.Items() {
-		serializedKnownAddress := new(SerializedKnownAddress)
-		serializedKnownAddress.AddressString = k.(string)
-		valueAddress := v.(*KnownAddress)
-		serializedKnownAddress.TimeStamp = valueAddress.NetAddress.Timestamp.Unix()
-		serializedKnownAddress.Source = valueAddress.SrcAddress.NetAddressKey()
-		serializedKnownAddress.LastAttempt = valueAddress.LastAttempt.Unix()
-		serializedKnownAddress.LastSuccess = valueAddress.lastSuccess.Unix()
-		serializedAddressManager.Addresses[i] = serializedKnownAddress
-		i++
+	if err := addressManager.writePeers(); err != nil {
+		logs.Error("Failed to save file %s :%v", addressManager.peersFile, err)
 	}
-	for i := range addressManager.addressNew {
-		serializedAddressManager.NewBuckets[i] = make([]string, addressManager.addressNew[i].Count())
-		j := 0
-		for k := range addressManager.addressNew[i].Items() {
-			serializedAddressManager.NewBuckets[i][j] = k.(string)
-			j++
-		}
+}
+
+// writePeers writes the addresses to the peers file, the caller must hold
+// the lock.
+func (addressManager *NetAddressManager) writePeers() error {
+	content := &peersFileContent{
+		key:           addressManager.key,
+		asMapChecksum: addressManager.asMapChecksum(),
+		addresses:     make([]*KnownAddress, 0, addressManager.addressIndex.Count()),
+		newBuckets:    make([][]*KnownAddress, len(addressManager.addressNew)),
 	}
-	for i := range addressManager.addressTried {
-		serializedAddressManager.TriedBuckets[i] = make([]string, addressManager.addressTried[i].Len())
-		j := 0
-		for e := addressManager.addressTried[i].Front(); e != nil; e = e.Next() {
-			knownAddress := e.Value.(*KnownAddress)
-			serializedAddressManager.TriedBuckets[i][j] = knownAddress.NetAddress.NetAddressKey()
-			j++
+	for _, v := range addressManager.addressIndex.Items() {
+		content.addresses = append(content.addresses, v.(*KnownAddress))
+	}
+	for i := range addressManager.addressNew {
+		for _, v := range addressManager.addressNew[i].Items() {
+			content.newBuckets[i] = append(content.newBuckets[i], v.(*KnownAddress))
 		}
 	}
-	w, err := os.Create(addressManager.peersFile)
+	data, err := serializePeers(content)
 	if err != nil {
-		logs.Error("Error opening file %s :%v", addressManager.peersFile, err)
-		return
+		return err
 	}
-	newEncoder := json.NewEncoder(w)
-	defer w.Close()
-
-	if err := newEncoder.Encode(&serializedAddressManager); err != nil {
-		logs.Error("Failed to encode file %s :%v", addressManager.peersFile, err)
+	tmpFile := addressManager.peersFile + ".new"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
 	}
+	return os.Rename(tmpFile, addressManager.peersFile)
 }
 func (addressManager *NetAddressManager) addressHandler() {
 	dumpAddressTicker := time.NewTicker(DumpAddressInterval)
@@ -238,10 +237,178 @@ out:
 	addressManager.waitGroup.Done()
 	logs.Trace("address handler done ")
 }
+
+// loadPeers reads the addresses saved by a previous run.  The JSON file of
+// the earlier versions is read when there is no binary peers file yet, and
+// is converted to it.  A file which can't be read is left aside and the
+// address manager starts empty.
 func (addressManager *NetAddressManager) loadPeers() {
 	addressManager.lock.Lock()
 	defer addressManager.lock.Unlock()
 
+	peersFile := addressManager.peersFile
+	content, err := addressManager.readPeers()
+	if os.IsNotExist(err) {
+		peersFile = addressManager.jsonPeersFile
+		content, err = addressManager.readJSONPeers()
+		if os.IsNotExist(err) {
+			return
+		}
+	}
+	if err != nil {
+		logs.Error("Failed to parse file %s :%v", peersFile, err)
+		return
+	}
+
+	dropped := addressManager.rebuild(content)
+	logs.Info("Loaded %d addresses from file %s, dropped %d", addressManager.Numaddresses(),
+		peersFile, dropped)
+	if peersFile == addressManager.jsonPeersFile {
+		if err := addressManager.writePeers(); err != nil {
+			logs.Error("Failed to convert file %s :%v", peersFile, err)
+		}
+	}
+}
+
+// readPeers reads the binary peers file.
+func (addressManager *NetAddressManager) readPeers() (*peersFileContent, error) {
+	data, err := ioutil.ReadFile(addressManager.peersFile)
+	if err != nil {
+		return nil, err
+	}
+	return deserializePeers(data)
+}
+
+// readJSONPeers reads the JSON peers file of the earlier versions, the
+// addresses which can't be parsed are skipped.
+func (addressManager *NetAddressManager) readJSONPeers() (*peersFileContent, error) {
+	r, err := os.Open(addressManager.jsonPeersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var serializedAddressManager SerializedAddressManager
+	if err := json.NewDecoder(r).Decode(&serializedAddressManager); err != nil {
+		return nil, err
+	}
+	if serializedAddressManager.Version != SerialisationVersion {
+		return nil, fmt.Errorf("unknown version %d", serializedAddressManager.Version)
+	}
+
+	content := &peersFileContent{key: serializedAddressManager.Key}
+	knownAddresses := make(map[string]*KnownAddress, len(serializedAddressManager.Addresses))
+	for _, serializedKnownAddress := range serializedAddressManager.Addresses {
+		netAddress, err := addressManager.DeserializeNetAddress(serializedKnownAddress.AddressString)
+		if err != nil {
+			logs.Debug("skipping address %s :%v", serializedKnownAddress.AddressString, err)
+			continue
+		}
+		srcAddress, err := addressManager.DeserializeNetAddress(serializedKnownAddress.Source)
+		if err != nil {
+			srcAddress = netAddress
+		}
+		netAddress.Timestamp = time.Unix(serializedKnownAddress.TimeStamp, 0)
+		knownAddress := &KnownAddress{
+			NetAddress:  netAddress,
+			SrcAddress:  srcAddress,
+			attempts:    serializedKnownAddress.Attempts,
+			LastAttempt: time.Unix(serializedKnownAddress.LastAttempt, 0),
+			lastSuccess: time.Unix(serializedKnownAddress.LastSuccess, 0),
+		}
+		knownAddresses[serializedKnownAddress.AddressString] = knownAddress
+		content.addresses = append(content.addresses, knownAddress)
+	}
+	for _, bucket := range serializedAddressManager.TriedBuckets {
+		for _, key := range bucket {
+			if knownAddress, ok := knownAddresses[key]; ok {
+				knownAddress.tried = true
+			}
+		}
+	}
+	content.newBuckets = make([][]*KnownAddress, len(serializedAddressManager.NewBuckets))
+	for i, bucket := range serializedAddressManager.NewBuckets {
+		for _, key := range bucket {
+			if knownAddress, ok := knownAddresses[key]; ok {
+				content.newBuckets[i] = append(content.newBuckets[i], knownAddress)
+			}
+		}
+	}
+	return content, nil
+}
+
+// rebuild replaces the addresses with those of a peers file and returns how
+// many of them were dropped.  The tried addresses are put in the bucket
+// derived from the key of the file, and the new addresses in the buckets of
+// the file, unless its number of buckets or its asmap differs.  Unroutable and duplicate
+// addresses, tried addresses whose bucket is full and new addresses left in
+// no bucket are dropped.  The caller must hold the lock.
+func (addressManager *NetAddressManager) rebuild(content *peersFileContent) int {
+	addressManager.reset()
+	addressManager.key = content.key
+	addressManager.numNew = 0
+	addressManager.numTried = 0
+
+	dropped := 0
+	var newAddresses []*KnownAddress
+	for _, knownAddress := range content.addresses {
+		key := knownAddress.NetAddress.NetAddressKey()
+		if !knownAddress.NetAddress.IsRoutable() || addressManager.addressIndex.Check(key) {
+			dropped++
+			continue
+		}
+		knownAddress.refs = 0
+		if !knownAddress.tried {
+			addressManager.addressIndex.Set(key, knownAddress)
+			newAddresses = append(newAddresses, knownAddress)
+			continue
+		}
+		bucket := addressManager.getTriedBucket(knownAddress.NetAddress)
+		if addressManager.addressTried[bucket].Len() >= TriedBucketSize {
+			dropped++
+			continue
+		}
+		addressManager.addressIndex.Set(key, knownAddress)
+		addressManager.addressTried[bucket].PushBack(knownAddress)
+		addressManager.numTried++
+	}
+
+	addToBucket := func(bucket int, knownAddress *KnownAddress) {
+		key := knownAddress.NetAddress.NetAddressKey()
+		if knownAddress.refs >= BucketsPeerAddress ||
+			addressManager.addressNew[bucket].Count() >= NewBucketSize ||
+			addressManager.addressNew[bucket].Check(key) {
+			return
+		}
+		addressManager.addressNew[bucket].Set(key, knownAddress)
+		knownAddress.refs++
+	}
+	if len(content.newBuckets) == len(addressManager.addressNew) &&
+		content.asMapChecksum == addressManager.asMapChecksum() {
+		for i, bucket := range content.newBuckets {
+			for _, knownAddress := range bucket {
+				// Only the new addresses which were kept are in the index.
+				if knownAddress.tried || addressManager.find(knownAddress.NetAddress) != knownAddress {
+					continue
+				}
+				addToBucket(i, knownAddress)
+			}
+		}
+	} else {
+		for _, knownAddress := range newAddresses {
+			addToBucket(addressManager.getNewBucket(knownAddress.NetAddress, knownAddress.SrcAddress), knownAddress)
+		}
+	}
+
+	for _, knownAddress := range newAddresses {
+		if knownAddress.refs == 0 {
+			addressManager.addressIndex.Delete(knownAddress.NetAddress.NetAddressKey())
+			dropped++
+			continue
+		}
+		addressManager.numNew++
+	}
+	return dropped
 }
 
 func (addressManager *NetAddressManager) DeserializeNetAddress(addressString string) (*PeerAddress, error) {
@@ -256,16 +423,11 @@ func (addressManager *NetAddressManager) DeserializeNetAddress(addressString str
 	return addressManager.HostToNetAddress(host, uint16(port), protocol.SFNodeNetworkAsFullNode)
 }
 func (addressManager *NetAddressManager) HostToNetAddress(host string, port uint16, servicesFlag protocol.ServiceFlag) (*PeerAddress, error) {
-	var ip net.IP
-	if len(host) == 22 && host[16:] == ".onion" {
-		data, err := base32.StdEncoding.DecodeString(strings.ToUpper(host[:16]))
-		if err != nil {
-			return nil, err
-		}
-		prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
-		ip := net.IP(append(prefix, data...))
-		logs.Debug("%s", ip)
-	} else if ip = net.ParseIP(host); ip == nil {
+	if IsOnionHost(host) {
+		return NewPeerAddressOnion(host, port, servicesFlag)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
 		ips, err := addressManager.lookupFunc(host)
 		if err != nil {
 			return nil, err
@@ -282,8 +444,8 @@ func (addressManager *NetAddressManager) getNewBucket(netAddr, srcAddr *PeerAddr
 	// doublesha256(key + sourcegroup + int64(doublesha256(key + group + sourcegroup))%bucket_per_source_group) % num_new_buckets
 	dataFirst := []byte{}
 	dataFirst = append(dataFirst, addressManager.key[:]...)
-	dataFirst = append(dataFirst, []byte(netAddr.GroupKey())...)
-	dataFirst = append(dataFirst, []byte(srcAddr.GroupKey())...)
+	dataFirst = append(dataFirst, []byte(addressManager.GroupKey(netAddr))...)
+	dataFirst = append(dataFirst, []byte(addressManager.GroupKey(srcAddr))...)
 	hashFirst := crypto.DoubleSha256Bytes(dataFirst)
 	hash64 := binary.LittleEndian.Uint64(hashFirst)
 	hash64 %= NewBucketsPeerGroup
@@ -291,12 +453,43 @@ func (addressManager *NetAddressManager) getNewBucket(netAddr, srcAddr *PeerAddr
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	dataSecond := []byte{}
 	dataSecond = append(dataSecond, addressManager.key[:]...)
-	dataSecond = append(dataSecond, srcAddr.GroupKey()...)
+	dataSecond = append(dataSecond, addressManager.GroupKey(srcAddr)...)
 	dataSecond = append(dataSecond, hashbuf[:]...)
 	hashSecond := crypto.DoubleSha256Bytes(dataSecond)
 	return int(binary.LittleEndian.Uint64(hashSecond) % BucketCount)
 
 }
+
+// SetASMap makes the address manager group the addresses by the AS announcing
+// them according to asMap, rather than by IP prefix only.  It must be called
+// before Start, the addresses of a peers file saved with another asmap are
+// put in new buckets.
+func (addressManager *NetAddressManager) SetASMap(asMap *ASMap) {
+	addressManager.lock.Lock()
+	addressManager.asMap = asMap
+	addressManager.lock.Unlock()
+}
+
+// MappedAS returns the AS announcing the address, or 0 without asmap or when
+// the asmap doesn't map the address.
+func (addressManager *NetAddressManager) MappedAS(netAddress *PeerAddress) uint32 {
+	return netAddress.MappedAS(addressManager.asMap)
+}
+
+// GroupKey returns the key of the network group of the address, which the
+// buckets and the outbound peers are spread across: the AS announcing it
+// when the asmap maps it, its IP prefix otherwise.
+func (addressManager *NetAddressManager) GroupKey(netAddress *PeerAddress) string {
+	return netAddress.NetworkGroup(addressManager.asMap)
+}
+
+func (addressManager *NetAddressManager) asMapChecksum() [32]byte {
+	if addressManager.asMap == nil {
+		return [32]byte{}
+	}
+	return addressManager.asMap.Checksum()
+}
+
 func (addressManager *NetAddressManager) Start() {
 	if atomic.AddInt32(&addressManager.started, 1) != 1 {
 		return
@@ -318,8 +511,8 @@ func (addressManager *NetAddressManager) Stop() error {
 	return nil
 }
 func (addressManager *NetAddressManager) AddPeerAddresses(addresses []*PeerAddress, srcAddress *PeerAddress) {
-	//addressManager.lock.Unlock()
-	//defer addressManager.lock.Unlock()
+	addressManager.lock.Lock()
+	defer addressManager.lock.Unlock()
 	for _, peeraddress := range addresses {
 		addressManager.updateAddress(peeraddress, srcAddress)
 	}
@@ -346,6 +539,20 @@ func (addressManager *NetAddressManager) AddAddressByIP(addressIP string) error
 	addressManager.AddAddress(peerAddress, peerAddress)
 	return nil
 }
+
+// AddPeerAddress adds an address as if it advertised itself, and marks it
+// good when tried is set.  It returns whether the address is in the address
+// table afterwards, unroutable addresses are never added.
+func (addressManager *NetAddressManager) AddPeerAddress(peerAddress *PeerAddress, tried bool) bool {
+	addressManager.AddAddress(peerAddress, peerAddress)
+	if tried {
+		addressManager.MarkGood(peerAddress)
+	}
+	addressManager.lock.Lock()
+	defer addressManager.lock.Unlock()
+	return addressManager.find(peerAddress) != nil
+}
+
 func (addressManager *NetAddressManager) Numaddresses() int {
 	//addressManager.lock.Lock()
 	//defer addressManager.lock.Unlock()
@@ -373,9 +580,9 @@ func (addressManager *NetAddressManager) AddressCache() []*PeerAddress {
 		return nil
 	}
 	allAddress := make([]*PeerAddress, 0, addressIndexLen)
-	//for _, v := range addressManager.addressIndex {
-	//	allAddress = append(allAddress, v.NetAddress)
-	//}
+	for _, v := range addressManager.addressIndex.Items() {
+		allAddress = append(allAddress, v.(*KnownAddress).NetAddress)
+	}
 	numAddresses := addressIndexLen * AddressPercent / 100
 	if numAddresses > AddressMax {
 		numAddresses = AddressMax
@@ -399,6 +606,10 @@ func (addressManager *NetAddressManager) reset() {
 	}
 
 }
+
+// GetAddress returns an address to connect to, picked at random from the
+// new or the tried addresses, or nil when there are none.  Addresses which
+// failed or were attempted recently are less likely to be picked.
 func (addressManager *NetAddressManager) GetAddress() *KnownAddress {
 	addressManager.lock.Lock()
 	defer addressManager.lock.Unlock()
@@ -406,51 +617,74 @@ func (addressManager *NetAddressManager) GetAddress() *KnownAddress {
 		return nil
 	}
 	if addressManager.numTried > 0 && (addressManager.numNew == 0 || addressManager.rand.Intn(2) == 0) {
-		large := 1 << 30
-		factor := 1.0
-		for {
-			bucket := addressManager.rand.Intn(len(addressManager.addressTried))
-			if addressManager.addressTried[bucket].Len() == 0 {
-				continue
-			}
-			e := addressManager.addressTried[bucket].Front()
-			for i := addressManager.rand.Int63n(int64(addressManager.addressTried[bucket].Len())); i > 0; i-- {
-				e = e.Next()
-			}
-			knownAddress := e.Value.(*KnownAddress)
-			randVal := addressManager.rand.Intn(large)
-			if float64(randVal) < (factor * knownAddress.Chance() * float64(large)) {
-				logs.Trace("selected %v from tried bucket ", knownAddress.NetAddress.NetAddressKey())
-			}
-		}
-	} else {
-		large := 1 << 30
-		factor := 1.0
-		for {
-			bucket := addressManager.rand.Intn(len(addressManager.addressNew))
-			if addressManager.addressNew[bucket].Count() == 0 {
-				continue
-			}
-			var knownAddress *KnownAddress
-			nth := addressManager.rand.Intn(addressManager.addressNew[bucket].Count())
-			for _, value := range addressManager.addressNew[bucket].Items() {
-				if nth == 0 {
-					knownAddress = value.(*KnownAddress)
-				}
-				nth--
-			}
-			randval := addressManager.rand.Intn(large)
-			if float64(randval) < (factor * knownAddress.Chance() * float64(large)) {
-				logs.Trace("selected %v from new bucket", knownAddress.NetAddress.NetAddressKey())
-				return knownAddress
-			}
-			factor *= 1.2
+		return addressManager.pickTriedAddress()
+	}
+	return addressManager.pickNewAddress()
+}
 
-		}
+// GetNewTableAddress returns an address picked at random from the new
+// addresses, such as those tested by feeler connections before being marked
+// good, or nil when there are none.
+func (addressManager *NetAddressManager) GetNewTableAddress() *KnownAddress {
+	addressManager.lock.Lock()
+	defer addressManager.lock.Unlock()
+	if addressManager.numNew == 0 {
+		return nil
+	}
+	return addressManager.pickNewAddress()
+}
 
+// pickTriedAddress picks a tried address, there must be one.  The caller
+// must hold the lock.
+func (addressManager *NetAddressManager) pickTriedAddress() *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		bucket := addressManager.rand.Intn(len(addressManager.addressTried))
+		if addressManager.addressTried[bucket].Len() == 0 {
+			continue
+		}
+		e := addressManager.addressTried[bucket].Front()
+		for i := addressManager.rand.Int63n(int64(addressManager.addressTried[bucket].Len())); i > 0; i-- {
+			e = e.Next()
+		}
+		knownAddress := e.Value.(*KnownAddress)
+		randVal := addressManager.rand.Intn(large)
+		if float64(randVal) < (factor * knownAddress.Chance() * float64(large)) {
+			logs.Trace("selected %v from tried bucket ", knownAddress.NetAddress.NetAddressKey())
+			return knownAddress
+		}
+		factor *= 1.2
 	}
+}
 
+// pickNewAddress picks a new address, there must be one.  The caller must
+// hold the lock.
+func (addressManager *NetAddressManager) pickNewAddress() *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		bucket := addressManager.rand.Intn(len(addressManager.addressNew))
+		if addressManager.addressNew[bucket].Count() == 0 {
+			continue
+		}
+		var knownAddress *KnownAddress
+		nth := addressManager.rand.Intn(addressManager.addressNew[bucket].Count())
+		for _, value := range addressManager.addressNew[bucket].Items() {
+			if nth == 0 {
+				knownAddress = value.(*KnownAddress)
+			}
+			nth--
+		}
+		randval := addressManager.rand.Intn(large)
+		if float64(randval) < (factor * knownAddress.Chance() * float64(large)) {
+			logs.Trace("selected %v from new bucket", knownAddress.NetAddress.NetAddressKey())
+			return knownAddress
+		}
+		factor *= 1.2
+	}
 }
+
 func (addressManager *NetAddressManager) Attempt(peerAddress *PeerAddress) {
 	addressManager.lock.Lock()
 	defer addressManager.lock.Unlock()
@@ -491,7 +725,7 @@ func (addressManager *NetAddressManager) MarkGood(address *PeerAddress) {
 		return
 	}
 	addressKey := address.NetAddressKey()
-	oldBucket := 1
+	oldBucket := -1
 	for i := range addressManager.addressNew {
 		ok := addressManager.addressNew[i].Check(addressKey)
 		if ok {
@@ -585,7 +819,8 @@ func (addressManager *NetAddressManager) GetBestLocalAddress(remoteAddress *Peer
 }
 func NewNetAddressManager(dataDir string, lookupFunc utils.LookupFunc) *NetAddressManager {
 	addressManager := NetAddressManager{
-		peersFile:      filepath.Join(dataDir, "p2p.json"),
+		peersFile:      filepath.Join(dataDir, PeersFileName),
+		jsonPeersFile:  filepath.Join(dataDir, JSONPeersFileName),
 		lookupFunc:     lookupFunc,
 		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		quit:           make(chan struct{}),
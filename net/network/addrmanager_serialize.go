@@ -0,0 +1,265 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/btcboost/copernicus/crypto"
+	"github.com/btcboost/copernicus/net/protocol"
+)
+
+// SerializedAddressManager is the JSON form the address manager was saved in
+// before the binary peers file, it is only read to migrate the addresses.
+type SerializedAddressManager struct {
+	Version      int
+	Key          [32]byte
+	Addresses    []*SerializedKnownAddress
+	NewBuckets   [BucketCount][]string
+	TriedBuckets [TriedBucketCount][]string
+}
+
+// PeersFileVersion is the version of the binary peers file written by the
+// address manager, files of a later version are not read.
+const PeersFileVersion = 1
+
+// peersFileChecksumSize is the size of the double sha256 checksum ending the
+// binary peers file.
+const peersFileChecksumSize = 32
+
+// The binary peers file is made of, in order:
+//
+//   version      uint8
+//   key          [32]byte
+//   asmap        [32]byte, the checksum of the asmap the new addresses were
+//                put in their buckets with, zero without asmap
+//   new count    uint32
+//   tried count  uint32
+//   addresses    the new then the tried addresses, each made of:
+//                  timestamp    int64
+//                  services     uint64
+//                  ip, port     [16]byte, uint16 big endian
+//                  source       [16]byte, uint16 big endian
+//                  last attempt int64
+//                  last success int64
+//                  attempts     uint32
+//   bucket count uint32
+//   new buckets  for each bucket, its size as a uint32 followed by the
+//                indexes of its addresses among the new addresses as uint32
+//   checksum     [32]byte, the double sha256 of all of the above
+//
+// Integers are little endian unless told otherwise.  The tried buckets are
+// not stored, they are derived from the key.
+
+// peersFileContent is the content of a peers file, whichever its format.
+type peersFileContent struct {
+	key           [32]byte
+	asMapChecksum [32]byte
+	addresses     []*KnownAddress
+	newBuckets    [][]*KnownAddress
+}
+
+func writeIPPort(w io.Writer, ip net.IP, port uint16) error {
+	var buf [16]byte
+	if ip != nil {
+		copy(buf[:], ip.To16())
+	}
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, port)
+}
+
+func readIPPort(r io.Reader) (net.IP, uint16, error) {
+	var buf [16]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, 0, err
+	}
+	var port uint16
+	if err := binary.Read(r, binary.BigEndian, &port); err != nil {
+		return nil, 0, err
+	}
+	return net.IP(buf[:]), port, nil
+}
+
+func writeKnownAddress(w io.Writer, knownAddress *KnownAddress) error {
+	netAddress := knownAddress.NetAddress
+	err := binary.Write(w, binary.LittleEndian, netAddress.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint64(netAddress.ServicesFlag))
+	if err != nil {
+		return err
+	}
+	if err := writeIPPort(w, netAddress.IP, netAddress.Port); err != nil {
+		return err
+	}
+	srcAddress := knownAddress.SrcAddress
+	if srcAddress == nil {
+		srcAddress = netAddress
+	}
+	if err := writeIPPort(w, srcAddress.IP, srcAddress.Port); err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, [2]int64{
+		knownAddress.LastAttempt.Unix(),
+		knownAddress.lastSuccess.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, uint32(knownAddress.attempts))
+}
+
+func readKnownAddress(r io.Reader) (*KnownAddress, error) {
+	var timestamp int64
+	var services uint64
+	if err := binary.Read(r, binary.LittleEndian, &timestamp); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &services); err != nil {
+		return nil, err
+	}
+	ip, port, err := readIPPort(r)
+	if err != nil {
+		return nil, err
+	}
+	srcIP, srcPort, err := readIPPort(r)
+	if err != nil {
+		return nil, err
+	}
+	var times [2]int64
+	if err := binary.Read(r, binary.LittleEndian, &times); err != nil {
+		return nil, err
+	}
+	var attempts uint32
+	if err := binary.Read(r, binary.LittleEndian, &attempts); err != nil {
+		return nil, err
+	}
+	return &KnownAddress{
+		NetAddress: NewPeerAddressTimestamp(time.Unix(timestamp, 0),
+			protocol.ServiceFlag(services), ip, port),
+		SrcAddress:  NewPeerAddressIPPort(0, srcIP, srcPort),
+		attempts:    int(attempts),
+		LastAttempt: time.Unix(times[0], 0),
+		lastSuccess: time.Unix(times[1], 0),
+	}, nil
+}
+
+// serializePeers writes the addresses and the new buckets in the binary
+// format of the peers file.
+func serializePeers(content *peersFileContent) ([]byte, error) {
+	var newAddresses, triedAddresses []*KnownAddress
+	for _, knownAddress := range content.addresses {
+		if knownAddress.tried {
+			triedAddresses = append(triedAddresses, knownAddress)
+		} else {
+			newAddresses = append(newAddresses, knownAddress)
+		}
+	}
+	newIndexes := make(map[*KnownAddress]uint32, len(newAddresses))
+	for i, knownAddress := range newAddresses {
+		newIndexes[knownAddress] = uint32(i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(PeersFileVersion)
+	buf.Write(content.key[:])
+	buf.Write(content.asMapChecksum[:])
+	binary.Write(&buf, binary.LittleEndian, uint32(len(newAddresses)))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(triedAddresses)))
+	for _, knownAddress := range append(newAddresses, triedAddresses...) {
+		if err := writeKnownAddress(&buf, knownAddress); err != nil {
+			return nil, err
+		}
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(len(content.newBuckets)))
+	for _, bucket := range content.newBuckets {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(bucket)))
+		for _, knownAddress := range bucket {
+			index, ok := newIndexes[knownAddress]
+			if !ok {
+				return nil, fmt.Errorf("address %s of a new bucket is not a new address",
+					knownAddress.NetAddress.NetAddressKey())
+			}
+			binary.Write(&buf, binary.LittleEndian, index)
+		}
+	}
+	buf.Write(crypto.DoubleSha256Bytes(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// deserializePeers reads a binary peers file after checking its checksum and
+// version.  The indexes of the new buckets which don't refer to a new address
+// are skipped.
+func deserializePeers(data []byte) (*peersFileContent, error) {
+	if len(data) < 1+peersFileChecksumSize {
+		return nil, errors.New("peers file is truncated")
+	}
+	payload := data[:len(data)-peersFileChecksumSize]
+	checksum := data[len(data)-peersFileChecksumSize:]
+	if !bytes.Equal(crypto.DoubleSha256Bytes(payload), checksum) {
+		return nil, errors.New("peers file checksum mismatch")
+	}
+	if payload[0] > PeersFileVersion {
+		return nil, fmt.Errorf("peers file version %d is not supported, the latest is %d",
+			payload[0], PeersFileVersion)
+	}
+
+	r := bytes.NewReader(payload[1:])
+	content := new(peersFileContent)
+	if _, err := io.ReadFull(r, content.key[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, content.asMapChecksum[:]); err != nil {
+		return nil, err
+	}
+	var newCount, triedCount uint32
+	if err := binary.Read(r, binary.LittleEndian, &newCount); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &triedCount); err != nil {
+		return nil, err
+	}
+	// Don't trust the counts for the allocation, a corrupt file can't make
+	// more addresses than its size allows.
+	for i := uint64(0); i < uint64(newCount)+uint64(triedCount); i++ {
+		knownAddress, err := readKnownAddress(r)
+		if err != nil {
+			return nil, fmt.Errorf("can't read address %d: %v", i, err)
+		}
+		knownAddress.tried = i >= uint64(newCount)
+		content.addresses = append(content.addresses, knownAddress)
+	}
+
+	var bucketCount uint32
+	if err := binary.Read(r, binary.LittleEndian, &bucketCount); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < bucketCount; i++ {
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		var bucket []*KnownAddress
+		for j := uint32(0); j < size; j++ {
+			var index uint32
+			if err := binary.Read(r, binary.LittleEndian, &index); err != nil {
+				return nil, err
+			}
+			if index < newCount {
+				bucket = append(bucket, content.addresses[index])
+			}
+		}
+		content.newBuckets = append(content.newBuckets, bucket)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("peers file has %d unexpected trailing bytes", r.Len())
+	}
+	return content, nil
+}
@@ -0,0 +1,427 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/crypto"
+	"github.com/btcboost/copernicus/net/protocol"
+)
+
+// newTestAddressManager returns an address manager saving its addresses to a
+// temporary directory, the returned function removes it.
+func newTestAddressManager(t *testing.T) (*NetAddressManager, func()) {
+	dir, err := ioutil.TempDir("", "addrmanager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNetAddressManager(dir, nil), func() { os.RemoveAll(dir) }
+}
+
+func testPeerAddress(i int) *PeerAddress {
+	ip := net.IPv4(1, 2, byte(i>>8), byte(i))
+	return NewPeerAddressTimestamp(time.Unix(1500000000+int64(i), 0),
+		protocol.SFNodeNetworkAsFullNode, ip, 8333)
+}
+
+// addTestAddresses adds count addresses from a few sources and marks one
+// address in every tried good.
+func addTestAddresses(addressManager *NetAddressManager, count, tried int) {
+	for i := 0; i < count; i++ {
+		peerAddress := testPeerAddress(i)
+		srcAddress := NewPeerAddressIPPort(0, net.IPv4(5, byte(i%4), 0, 1), 8333)
+		addressManager.AddAddress(peerAddress, srcAddress)
+		if i%tried == 0 {
+			addressManager.MarkGood(peerAddress)
+		}
+	}
+}
+
+// newBucketKeys returns the sorted keys of the addresses of each new bucket.
+func newBucketKeys(addressManager *NetAddressManager) [][]string {
+	buckets := make([][]string, len(addressManager.addressNew))
+	for i, bucket := range addressManager.addressNew {
+		for key := range bucket.Items() {
+			buckets[i] = append(buckets[i], key.(string))
+		}
+		sort.Strings(buckets[i])
+	}
+	return buckets
+}
+
+// checkSameAddresses fails the test when the addresses of got and want or
+// their state differ.
+func checkSameAddresses(t *testing.T, got, want *NetAddressManager) {
+	if got.key != want.key {
+		t.Error("key not restored")
+	}
+	if got.Numaddresses() != want.Numaddresses() || got.numNew != want.numNew ||
+		got.numTried != want.numTried {
+		t.Fatalf("%d addresses, %d new, %d tried, want %d, %d, %d", got.Numaddresses(),
+			got.numNew, got.numTried, want.Numaddresses(), want.numNew, want.numTried)
+	}
+	for key, v := range want.addressIndex.Items() {
+		wantAddress := v.(*KnownAddress)
+		gotAddress := got.find(wantAddress.NetAddress)
+		if gotAddress == nil {
+			t.Errorf("%s not restored", key)
+			continue
+		}
+		if gotAddress.tried != wantAddress.tried || gotAddress.refs != wantAddress.refs ||
+			gotAddress.attempts != wantAddress.attempts ||
+			gotAddress.NetAddress.ServicesFlag != wantAddress.NetAddress.ServicesFlag ||
+			!gotAddress.NetAddress.Timestamp.Equal(wantAddress.NetAddress.Timestamp) ||
+			gotAddress.LastAttempt.Unix() != wantAddress.LastAttempt.Unix() ||
+			gotAddress.lastSuccess.Unix() != wantAddress.lastSuccess.Unix() ||
+			!gotAddress.SrcAddress.IP.Equal(wantAddress.SrcAddress.IP) {
+			t.Errorf("%s restored as %+v, want %+v", key, gotAddress, wantAddress)
+		}
+	}
+	gotBuckets, wantBuckets := newBucketKeys(got), newBucketKeys(want)
+	for i := range wantBuckets {
+		if fmt.Sprint(gotBuckets[i]) != fmt.Sprint(wantBuckets[i]) {
+			t.Errorf("new bucket %d restored as %v, want %v", i, gotBuckets[i], wantBuckets[i])
+		}
+	}
+	for i := range want.addressTried {
+		if got.addressTried[i].Len() != want.addressTried[i].Len() {
+			t.Errorf("tried bucket %d has %d addresses, want %d", i,
+				got.addressTried[i].Len(), want.addressTried[i].Len())
+		}
+	}
+}
+
+// reloadPeers reads the peers file of addressManager in a new address manager.
+func reloadPeers(addressManager *NetAddressManager, asMap *ASMap) *NetAddressManager {
+	loaded := NewNetAddressManager(filepath.Dir(addressManager.peersFile), nil)
+	loaded.SetASMap(asMap)
+	loaded.loadPeers()
+	return loaded
+}
+
+func TestPeersFileRoundTrip(t *testing.T) {
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+	addTestAddresses(addressManager, 200, 5)
+	addressManager.Attempt(testPeerAddress(1))
+	if addressManager.numTried == 0 || addressManager.numNew == 0 {
+		t.Fatalf("%d new and %d tried addresses", addressManager.numNew, addressManager.numTried)
+	}
+
+	addressManager.savePeers()
+	checkSameAddresses(t, reloadPeers(addressManager, nil), addressManager)
+
+	// The new buckets are kept with the same asmap.
+	asMapManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+	asMapManager.SetASMap(TestASMap())
+	addTestAddresses(asMapManager, 200, 5)
+	asMapManager.savePeers()
+	checkSameAddresses(t, reloadPeers(asMapManager, TestASMap()), asMapManager)
+}
+
+// testPeersContent returns the content of a peers file with count new
+// addresses, each in the bucket of its index.
+func testPeersContent(count int) *peersFileContent {
+	content := &peersFileContent{newBuckets: make([][]*KnownAddress, BucketCount)}
+	content.key[0] = 1
+	for i := 0; i < count; i++ {
+		knownAddress := &KnownAddress{
+			NetAddress:  testPeerAddress(i),
+			SrcAddress:  testPeerAddress(i),
+			LastAttempt: time.Unix(1500000000, 0),
+			lastSuccess: time.Unix(1500000000, 0),
+		}
+		content.addresses = append(content.addresses, knownAddress)
+		content.newBuckets[i] = append(content.newBuckets[i], knownAddress)
+	}
+	return content
+}
+
+// checksummed returns a peers file of the given payload with a valid
+// checksum.
+func checksummed(payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	return append(data, crypto.DoubleSha256Bytes(data)...)
+}
+
+func TestDeserializePeers(t *testing.T) {
+	content := testPeersContent(3)
+	content.asMapChecksum = TestASMap().Checksum()
+	content.addresses[2].tried = true
+	content.newBuckets[2] = nil
+	content.newBuckets[7] = []*KnownAddress{content.addresses[0], content.addresses[1]}
+	data, err := serializePeers(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != PeersFileVersion {
+		t.Errorf("peers file of version %d, want %d", data[0], PeersFileVersion)
+	}
+
+	decoded, err := deserializePeers(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.key != content.key || decoded.asMapChecksum != content.asMapChecksum {
+		t.Error("key or asmap checksum not restored")
+	}
+	if len(decoded.addresses) != 3 || decoded.addresses[0].tried || decoded.addresses[1].tried ||
+		!decoded.addresses[2].tried {
+		t.Fatalf("decoded addresses %v", decoded.addresses)
+	}
+	for i, knownAddress := range decoded.addresses {
+		if knownAddress.NetAddress.NetAddressKey() != testPeerAddress(i).NetAddressKey() {
+			t.Errorf("address %d decoded as %s", i, knownAddress.NetAddress.NetAddressKey())
+		}
+	}
+	if len(decoded.newBuckets) != BucketCount {
+		t.Fatalf("%d new buckets decoded", len(decoded.newBuckets))
+	}
+	bucketed := map[int][]*KnownAddress{
+		0: {decoded.addresses[0]},
+		1: {decoded.addresses[1]},
+		7: {decoded.addresses[0], decoded.addresses[1]},
+	}
+	for i, bucket := range decoded.newBuckets {
+		if fmt.Sprint(bucket) != fmt.Sprint(bucketed[i]) {
+			t.Errorf("new bucket %d decoded as %v, want %v", i, bucket, bucketed[i])
+		}
+	}
+
+	// A new bucket can't hold a tried address.
+	content.newBuckets[3] = []*KnownAddress{content.addresses[2]}
+	if _, err := serializePeers(content); err == nil {
+		t.Error("tried address serialized in a new bucket")
+	}
+}
+
+func TestDeserializePeersCorrupt(t *testing.T) {
+	content := testPeersContent(2)
+	data, err := serializePeers(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := data[:len(data)-peersFileChecksumSize]
+	// The addresses are followed by the bucket count and the size of each
+	// bucket, the first two holding an index.
+	addressesEnd := len(payload) - 4 - BucketCount*4 - 2*4
+
+	flipped := append([]byte{}, data...)
+	flipped[40] ^= 1
+	badIndex := append([]byte{}, payload...)
+	binary.LittleEndian.PutUint32(badIndex[addressesEnd+8:], 1000)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:peersFileChecksumSize]},
+		{"flipped bit", flipped},
+		{"bad checksum", append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^1)},
+		{"later version", checksummed([]byte{PeersFileVersion + 1}, payload[1:])},
+		{"trailing bytes", checksummed(payload, []byte{0})},
+		{"truncated key", checksummed(payload[:20])},
+		{"truncated addresses", checksummed(payload[:100])},
+		{"truncated buckets", checksummed(payload[:addressesEnd+10])},
+	}
+	for _, test := range tests {
+		if _, err := deserializePeers(test.data); err == nil {
+			t.Errorf("%s peers file accepted", test.name)
+		}
+	}
+
+	// An index out of the new addresses is skipped.
+	decoded, err := deserializePeers(checksummed(badIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.newBuckets[0]) != 0 || len(decoded.newBuckets[1]) != 1 {
+		t.Errorf("new buckets %v, %v", decoded.newBuckets[0], decoded.newBuckets[1])
+	}
+
+	// A corrupt file leaves the address manager empty.
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(addressManager.peersFile, flipped, 0600); err != nil {
+		t.Fatal(err)
+	}
+	addressManager.loadPeers()
+	if addressManager.Numaddresses() != 0 {
+		t.Errorf("%d addresses loaded from a corrupt file", addressManager.Numaddresses())
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+
+	content := testPeersContent(6)
+	unroutable := NewPeerAddressIPPort(0, net.ParseIP("10.0.0.1"), 8333)
+	content.addresses[1].NetAddress = unroutable
+	duplicate := &KnownAddress{NetAddress: testPeerAddress(0), SrcAddress: testPeerAddress(0)}
+	content.addresses = append(content.addresses, duplicate)
+	content.newBuckets[10] = append(content.newBuckets[10], duplicate)
+	// The address 2 is in no bucket, the address 3 is tried.
+	content.newBuckets[2] = nil
+	content.addresses[3].tried = true
+	content.newBuckets[3] = nil
+
+	addressManager.lock.Lock()
+	dropped := addressManager.rebuild(content)
+	addressManager.lock.Unlock()
+	if dropped != 3 {
+		t.Errorf("%d addresses dropped, want 3", dropped)
+	}
+	if addressManager.key != content.key {
+		t.Error("key of the file not used")
+	}
+	if addressManager.Numaddresses() != 4 || addressManager.numNew != 3 || addressManager.numTried != 1 {
+		t.Fatalf("%d addresses, %d new, %d tried", addressManager.Numaddresses(),
+			addressManager.numNew, addressManager.numTried)
+	}
+	for _, i := range []int{1, 2} {
+		if addressManager.find(content.addresses[i].NetAddress) != nil {
+			t.Errorf("address %d not dropped", i)
+		}
+	}
+	buckets := newBucketKeys(addressManager)
+	for _, i := range []int{0, 4, 5} {
+		key := testPeerAddress(i).NetAddressKey()
+		if len(buckets[i]) != 1 || buckets[i][0] != key {
+			t.Errorf("new bucket %d holds %v, want %s", i, buckets[i], key)
+		}
+	}
+	if len(buckets[10]) != 0 {
+		t.Errorf("duplicate address kept in new bucket 10")
+	}
+	bucket := addressManager.getTriedBucket(content.addresses[3].NetAddress)
+	if addressManager.addressTried[bucket].Len() != 1 {
+		t.Errorf("tried address not in its tried bucket %d", bucket)
+	}
+}
+
+func TestRebuildASMapChanged(t *testing.T) {
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+
+	// Saved without asmap, the buckets of the file are kept.
+	content := testPeersContent(4)
+	addressManager.lock.Lock()
+	addressManager.rebuild(content)
+	addressManager.lock.Unlock()
+	buckets := newBucketKeys(addressManager)
+	for i := 0; i < 4; i++ {
+		if len(buckets[i]) != 1 {
+			t.Errorf("new bucket %d of the file not kept: %v", i, buckets[i])
+		}
+	}
+
+	// Saved with an asmap the address manager doesn't use, or with another
+	// number of buckets, the new addresses are put in their buckets again.
+	content.asMapChecksum = TestASMap().Checksum()
+	shortContent := testPeersContent(4)
+	shortContent.newBuckets = shortContent.newBuckets[:BucketCount/2]
+	for _, changed := range []*peersFileContent{content, shortContent} {
+		addressManager.lock.Lock()
+		if dropped := addressManager.rebuild(changed); dropped != 0 {
+			t.Errorf("%d addresses dropped", dropped)
+		}
+		addressManager.lock.Unlock()
+		for _, knownAddress := range changed.addresses {
+			bucket := addressManager.getNewBucket(knownAddress.NetAddress, knownAddress.SrcAddress)
+			if !addressManager.addressNew[bucket].Check(knownAddress.NetAddress.NetAddressKey()) {
+				t.Errorf("%s not put in its new bucket %d", knownAddress.NetAddress.NetAddressKey(), bucket)
+			}
+		}
+	}
+}
+
+func TestJSONPeersMigration(t *testing.T) {
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+
+	serialized := SerializedAddressManager{Version: SerialisationVersion}
+	serialized.Key[0] = 1
+	for i := 0; i < 4; i++ {
+		key := testPeerAddress(i).NetAddressKey()
+		serialized.Addresses = append(serialized.Addresses, &SerializedKnownAddress{
+			AddressString: key,
+			Source:        "5.0.0.1:8333",
+			Attempts:      i,
+			TimeStamp:     1500000000,
+			LastAttempt:   1500000100,
+			LastSuccess:   1500000200,
+		})
+		if i == 3 {
+			serialized.TriedBuckets[0] = append(serialized.TriedBuckets[0], key)
+		} else {
+			serialized.NewBuckets[i] = append(serialized.NewBuckets[i], key)
+		}
+	}
+	serialized.Addresses = append(serialized.Addresses, &SerializedKnownAddress{AddressString: "bad"})
+	serialized.NewBuckets[5] = []string{"bad", "9.9.9.9:8333"}
+	data, err := json.Marshal(&serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(addressManager.jsonPeersFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addressManager.loadPeers()
+	if addressManager.key != serialized.Key {
+		t.Error("key of the JSON file not used")
+	}
+	if addressManager.Numaddresses() != 4 || addressManager.numNew != 3 || addressManager.numTried != 1 {
+		t.Fatalf("%d addresses, %d new, %d tried", addressManager.Numaddresses(),
+			addressManager.numNew, addressManager.numTried)
+	}
+	knownAddress := addressManager.find(testPeerAddress(2))
+	if knownAddress == nil || knownAddress.attempts != 2 || knownAddress.LastAttempt.Unix() != 1500000100 ||
+		knownAddress.lastSuccess.Unix() != 1500000200 || knownAddress.NetAddress.Timestamp.Unix() != 1500000000 ||
+		knownAddress.SrcAddress.NetAddressKey() != "5.0.0.1:8333" {
+		t.Errorf("address migrated as %+v", knownAddress)
+	}
+	if !addressManager.addressNew[2].Check(testPeerAddress(2).NetAddressKey()) {
+		t.Error("new bucket of the JSON file not kept")
+	}
+
+	// The binary peers file is written and read from then on.
+	if _, err := os.Stat(addressManager.peersFile); err != nil {
+		t.Fatalf("peers file not written: %v", err)
+	}
+	if err := os.Remove(addressManager.jsonPeersFile); err != nil {
+		t.Fatal(err)
+	}
+	checkSameAddresses(t, reloadPeers(addressManager, nil), addressManager)
+
+	// A JSON file of an unknown version is left aside.
+	other, cleanup := newTestAddressManager(t)
+	defer cleanup()
+	serialized.Version = SerialisationVersion + 1
+	data, err = json.Marshal(&serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(other.jsonPeersFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	other.loadPeers()
+	if other.Numaddresses() != 0 {
+		t.Errorf("%d addresses loaded from a JSON file of an unknown version", other.Numaddresses())
+	}
+	if _, err := os.Stat(other.peersFile); !os.IsNotExist(err) {
+		t.Errorf("peers file written from a JSON file of an unknown version: %v", err)
+	}
+}
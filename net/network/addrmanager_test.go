@@ -0,0 +1,39 @@
+package network
+
+import (
+	"testing"
+)
+
+func TestGetNewTableAddress(t *testing.T) {
+	addressManager, cleanup := newTestAddressManager(t)
+	defer cleanup()
+	if addressManager.GetNewTableAddress() != nil || addressManager.GetAddress() != nil {
+		t.Error("address picked from an empty address manager")
+	}
+
+	// Feelers only test the new addresses.
+	addTestAddresses(addressManager, 20, 2)
+	tried := 0
+	for i := 0; i < 100; i++ {
+		knownAddress := addressManager.GetNewTableAddress()
+		if knownAddress == nil || knownAddress.tried {
+			t.Fatalf("picked %+v from the new table", knownAddress)
+		}
+		if addressManager.GetAddress().tried {
+			tried++
+		}
+	}
+	if tried == 0 {
+		t.Error("no tried address picked")
+	}
+
+	for i := 0; i < 20; i++ {
+		addressManager.MarkGood(testPeerAddress(i))
+	}
+	if addressManager.numNew != 0 {
+		t.Fatalf("%d new addresses left", addressManager.numNew)
+	}
+	if knownAddress := addressManager.GetNewTableAddress(); knownAddress != nil {
+		t.Errorf("picked %+v from an empty new table", knownAddress)
+	}
+}
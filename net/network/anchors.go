@@ -0,0 +1,112 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/btcboost/copernicus/crypto"
+	"github.com/btcboost/copernicus/net/protocol"
+)
+
+// AnchorsFileName is the name of the file the addresses of the
+// block-relay-only peers are saved to on shutdown, they are connected to
+// first on the next start so that an attacker can't take all the outbound
+// slots of a restarting node.
+const AnchorsFileName = "anchors.dat"
+
+// anchorsFileVersion is the version of the anchors file.
+const anchorsFileVersion = 1
+
+// The anchors file is made of, in order:
+//
+//   version    uint8
+//   count      uint32
+//   addresses  each made of:
+//                timestamp  int64
+//                services   uint64
+//                ip, port   [16]byte, uint16 big endian
+//   checksum   [32]byte, the double sha256 of all of the above
+//
+// Integers are little endian unless told otherwise.
+
+// WriteAnchors saves the addresses to the anchors file path, through a
+// temporary file so that a crash doesn't leave a truncated file behind.
+func WriteAnchors(path string, addresses []*PeerAddress) error {
+	var buf bytes.Buffer
+	buf.WriteByte(anchorsFileVersion)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(addresses)))
+	for _, address := range addresses {
+		binary.Write(&buf, binary.LittleEndian, address.Timestamp.Unix())
+		binary.Write(&buf, binary.LittleEndian, uint64(address.ServicesFlag))
+		if err := writeIPPort(&buf, address.IP, address.Port); err != nil {
+			return err
+		}
+	}
+	buf.Write(crypto.DoubleSha256Bytes(buf.Bytes()))
+
+	tmpFile := path + ".new"
+	if err := ioutil.WriteFile(tmpFile, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+// ReadAnchors reads the addresses of the anchors file path and removes the
+// file, so that the same anchors aren't reused after a crash.
+func ReadAnchors(path string) ([]*PeerAddress, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return deserializeAnchors(data)
+}
+
+func deserializeAnchors(data []byte) ([]*PeerAddress, error) {
+	if len(data) < 1+peersFileChecksumSize {
+		return nil, errors.New("anchors file is truncated")
+	}
+	payload := data[:len(data)-peersFileChecksumSize]
+	checksum := data[len(data)-peersFileChecksumSize:]
+	if !bytes.Equal(crypto.DoubleSha256Bytes(payload), checksum) {
+		return nil, errors.New("anchors file checksum mismatch")
+	}
+	if payload[0] > anchorsFileVersion {
+		return nil, fmt.Errorf("anchors file version %d is not supported, the latest is %d",
+			payload[0], anchorsFileVersion)
+	}
+
+	r := bytes.NewReader(payload[1:])
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	var addresses []*PeerAddress
+	for i := uint32(0); i < count; i++ {
+		var timestamp int64
+		var services uint64
+		if err := binary.Read(r, binary.LittleEndian, &timestamp); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &services); err != nil {
+			return nil, err
+		}
+		ip, port, err := readIPPort(r)
+		if err != nil {
+			return nil, fmt.Errorf("can't read anchor %d: %v", i, err)
+		}
+		addresses = append(addresses, NewPeerAddressTimestamp(time.Unix(timestamp, 0),
+			protocol.ServiceFlag(services), ip, port))
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("anchors file has %d unexpected trailing bytes", r.Len())
+	}
+	return addresses, nil
+}
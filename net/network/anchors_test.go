@@ -0,0 +1,106 @@
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/net/protocol"
+)
+
+func TestAnchorsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anchors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, AnchorsFileName)
+
+	anchors := []*PeerAddress{
+		NewPeerAddressTimestamp(time.Unix(1500000000, 0), protocol.SFNodeNetworkAsFullNode,
+			net.ParseIP("1.2.3.4"), 8333),
+		NewPeerAddressTimestamp(time.Unix(1500000001, 0), 0, net.ParseIP("2001:db8::1"), 18333),
+	}
+	for _, addresses := range [][]*PeerAddress{anchors, nil} {
+		if err := WriteAnchors(path, addresses); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path + ".new"); !os.IsNotExist(err) {
+			t.Errorf("temporary anchors file left: %v", err)
+		}
+		read, err := ReadAnchors(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != len(addresses) {
+			t.Fatalf("%d anchors read, want %d", len(read), len(addresses))
+		}
+		for i, address := range addresses {
+			if read[i].NetAddressKey() != address.NetAddressKey() ||
+				read[i].ServicesFlag != address.ServicesFlag || !read[i].Timestamp.Equal(address.Timestamp) {
+				t.Errorf("anchor %d read as %+v, want %+v", i, read[i], address)
+			}
+		}
+
+		// The anchors are only used once.
+		if _, err := ReadAnchors(path); !os.IsNotExist(err) {
+			t.Errorf("anchors file read twice: %v", err)
+		}
+	}
+}
+
+func TestDeserializeAnchorsCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anchors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, AnchorsFileName)
+
+	anchors := []*PeerAddress{NewPeerAddressIPPort(0, net.ParseIP("1.2.3.4"), 8333)}
+	if err := WriteAnchors(path, anchors); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deserializeAnchors(data); err != nil {
+		t.Fatal(err)
+	}
+	payload := data[:len(data)-peersFileChecksumSize]
+
+	flipped := append([]byte{}, data...)
+	flipped[10] ^= 1
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:peersFileChecksumSize]},
+		{"flipped bit", flipped},
+		{"later version", checksummed([]byte{anchorsFileVersion + 1}, payload[1:])},
+		{"truncated count", checksummed(payload[:3])},
+		{"truncated anchor", checksummed(payload[:20])},
+		{"trailing bytes", checksummed(payload, []byte{0})},
+	}
+	for _, test := range tests {
+		if _, err := deserializeAnchors(test.data); err == nil {
+			t.Errorf("%s anchors file accepted", test.name)
+		}
+	}
+
+	// A corrupt file is removed all the same.
+	if err := ioutil.WriteFile(path, flipped, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadAnchors(path); err == nil {
+		t.Error("corrupt anchors file read")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupt anchors file not removed: %v", err)
+	}
+}
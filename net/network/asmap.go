@@ -0,0 +1,314 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"net"
+
+	"github.com/btcboost/copernicus/crypto"
+)
+
+// An ASMap is a compact map from IP addresses to the autonomous system (AS)
+// announcing them, in the format used by Bitcoin Core's -asmap files.
+//
+// The file is a program run against the 128 bits of an IPv6 address, IPv4
+// addresses being mapped in ::ffff:0:0/96.  The bits of the program are read
+// from the least significant bit of each byte.  Each instruction starts with
+// its type:
+//
+//	RETURN  0    followed by an AS number, the AS of the address
+//	JUMP    10   followed by an offset, skipped when the next bit of the
+//	             address is set
+//	MATCH   110  followed by up to 8 bits which the next bits of the address
+//	             must match, the default AS is returned otherwise
+//	DEFAULT 111  followed by an AS number, the new default AS
+//
+// The numbers are encoded with a variable length, see decodeBits.
+type ASMap struct {
+	data     []byte
+	checksum [32]byte
+}
+
+const (
+	asMapReturn uint32 = iota
+	asMapJump
+	asMapMatch
+	asMapDefault
+)
+
+// asMapInvalid is returned by decodeBits when the program ends in the middle
+// of a number.
+const asMapInvalid = 0xffffffff
+
+// The numbers of bits the numbers are encoded on, by instruction.
+var (
+	asMapTypeBitSizes  = []uint8{0, 0, 1}
+	asMapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asMapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asMapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// testASMapData maps 11.0.0.0/8 to AS 64500, 12.0.0.0/7 to AS 64501 and
+// 2a01:4f8::/32 to AS 64502, the other addresses are not mapped.
+var testASMapData = []byte{
+	0x8b, 0x8e, 0x62, 0x7f, 0x80, 0xfd, 0x01, 0xf6, 0x07, 0xd8, 0x1f, 0x60,
+	0x7f, 0x80, 0xfd, 0x01, 0xf6, 0x07, 0xd8, 0x1f, 0x60, 0x7f, 0x80, 0xfd,
+	0xc1, 0xf7, 0xff, 0xdf, 0xff, 0x63, 0x19, 0xb9, 0x96, 0xf7, 0xf3, 0x90,
+	0xf7, 0xcb, 0xfe, 0x0a, 0xfb, 0x43, 0xec, 0x4f, 0xbe, 0x37, 0xe4, 0xfd,
+	0x0a,
+}
+
+// NewASMap returns the map of an asmap file content after checking that it
+// maps every address.
+func NewASMap(data []byte) (*ASMap, error) {
+	asMap := &ASMap{data: data}
+	if !asMap.sanityCheck(128) {
+		return nil, errors.New("asmap is malformed")
+	}
+	copy(asMap.checksum[:], crypto.DoubleSha256Bytes(data))
+	return asMap, nil
+}
+
+// LoadASMap reads an asmap file, such as those generated by Bitcoin Core's
+// asmap tool.
+func LoadASMap(path string) (*ASMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	asMap, err := NewASMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return asMap, nil
+}
+
+// TestASMap returns a small map for tests, which maps 11.0.0.0/8 to AS 64500,
+// 12.0.0.0/7 to AS 64501 and 2a01:4f8::/32 to AS 64502.
+func TestASMap() *ASMap {
+	asMap, err := NewASMap(testASMapData)
+	if err != nil {
+		panic(err)
+	}
+	return asMap
+}
+
+// Checksum returns the double sha256 of the asmap file, which tells whether
+// the addresses were put in their buckets with the same map.
+func (asMap *ASMap) Checksum() [32]byte {
+	return asMap.checksum
+}
+
+// Lookup returns the AS announcing ip, or 0 when ip isn't mapped.
+func (asMap *ASMap) Lookup(ip net.IP) uint32 {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return 0
+	}
+	asn, ok := asMap.interpret(ip16)
+	if !ok {
+		return 0
+	}
+	return asn
+}
+
+func (asMap *ASMap) size() uint32 {
+	return uint32(len(asMap.data)) * 8
+}
+
+func (asMap *ASMap) bit(pos uint32) uint32 {
+	return uint32(asMap.data[pos/8]>>(pos%8)) & 1
+}
+
+// decodeBits reads a number at *pos.  The number is minval plus, for the
+// first size whose bit is unset, a mantissa of that size, plus 2^size for
+// each size before it whose bit is set.  The last size has no bit.
+func (asMap *ASMap) decodeBits(pos *uint32, minval uint32, bitSizes []uint8) uint32 {
+	val := minval
+	end := asMap.size()
+	for i, size := range bitSizes {
+		var bit uint32
+		if i+1 != len(bitSizes) {
+			if *pos == end {
+				break
+			}
+			bit = asMap.bit(*pos)
+			*pos++
+		}
+		if bit == 1 {
+			val += 1 << size
+			continue
+		}
+		for b := uint8(0); b < size; b++ {
+			if *pos == end {
+				return asMapInvalid
+			}
+			val += asMap.bit(*pos) << (size - 1 - b)
+			*pos++
+		}
+		return val
+	}
+	return asMapInvalid
+}
+
+func (asMap *ASMap) decodeType(pos *uint32) uint32 {
+	return asMap.decodeBits(pos, 0, asMapTypeBitSizes)
+}
+
+func (asMap *ASMap) decodeASN(pos *uint32) uint32 {
+	return asMap.decodeBits(pos, 1, asMapASNBitSizes)
+}
+
+func (asMap *ASMap) decodeMatch(pos *uint32) uint32 {
+	return asMap.decodeBits(pos, 2, asMapMatchBitSizes)
+}
+
+func (asMap *ASMap) decodeJump(pos *uint32) uint32 {
+	return asMap.decodeBits(pos, 17, asMapJumpBitSizes)
+}
+
+// interpret runs the program against the 16 bytes of ip, it fails on a
+// program which doesn't pass sanityCheck.
+func (asMap *ASMap) interpret(ip []byte) (uint32, bool) {
+	ipBit := func(i uint32) bool {
+		return ip[i/8]>>(7-i%8)&1 == 1
+	}
+	total := uint32(len(ip)) * 8
+	left := total
+	end := asMap.size()
+	var pos, defaultASN uint32
+	for pos != end {
+		switch asMap.decodeType(&pos) {
+		case asMapReturn:
+			asn := asMap.decodeASN(&pos)
+			return asn, asn != asMapInvalid
+		case asMapJump:
+			jump := asMap.decodeJump(&pos)
+			if jump == asMapInvalid || left == 0 || jump >= end-pos {
+				return 0, false
+			}
+			if ipBit(total - left) {
+				pos += jump
+			}
+			left--
+		case asMapMatch:
+			match := asMap.decodeMatch(&pos)
+			if match == asMapInvalid {
+				return 0, false
+			}
+			matchLen := uint32(bits.Len32(match)) - 1
+			if left < matchLen {
+				return 0, false
+			}
+			for i := uint32(0); i < matchLen; i++ {
+				if ipBit(total-left) != (match>>(matchLen-1-i)&1 == 1) {
+					return defaultASN, true
+				}
+				left--
+			}
+		case asMapDefault:
+			defaultASN = asMap.decodeASN(&pos)
+			if defaultASN == asMapInvalid {
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// sanityCheck returns whether every path of the program ends with a RETURN
+// without reading more than inputBits bits of the address, so that Lookup
+// can't fail.  It follows the checks of Bitcoin Core, which also rejects the
+// programs its tool doesn't generate: unreachable code, overlapping jumps and
+// more than 7 bits of padding.
+func (asMap *ASMap) sanityCheck(inputBits uint32) bool {
+	type jumpTarget struct {
+		pos  uint32
+		bits uint32
+	}
+	var jumps []jumpTarget
+	end := asMap.size()
+	left := inputBits
+	prevOpcode := asMapJump
+	hadIncompleteMatch := false
+	var pos uint32
+	for pos != end {
+		if len(jumps) > 0 && pos >= jumps[len(jumps)-1].pos {
+			// A jump lands in the middle of the previous instruction.
+			return false
+		}
+		switch asMap.decodeType(&pos) {
+		case asMapReturn:
+			if prevOpcode == asMapDefault {
+				return false
+			}
+			if asMap.decodeASN(&pos) == asMapInvalid {
+				return false
+			}
+			if len(jumps) == 0 {
+				if end-pos > 7 {
+					return false
+				}
+				for ; pos != end; pos++ {
+					if asMap.bit(pos) != 0 {
+						return false
+					}
+				}
+				return true
+			}
+			// Carry on as if the last jump was taken.
+			if pos != jumps[len(jumps)-1].pos {
+				return false
+			}
+			left = jumps[len(jumps)-1].bits
+			jumps = jumps[:len(jumps)-1]
+			prevOpcode = asMapJump
+		case asMapJump:
+			jump := asMap.decodeJump(&pos)
+			if jump == asMapInvalid || jump > end-pos || left == 0 {
+				return false
+			}
+			left--
+			target := pos + jump
+			if len(jumps) > 0 && target >= jumps[len(jumps)-1].pos {
+				return false
+			}
+			jumps = append(jumps, jumpTarget{pos: target, bits: left})
+			prevOpcode = asMapJump
+		case asMapMatch:
+			match := asMap.decodeMatch(&pos)
+			if match == asMapInvalid {
+				return false
+			}
+			matchLen := uint32(bits.Len32(match)) - 1
+			if prevOpcode != asMapMatch {
+				hadIncompleteMatch = false
+			}
+			if matchLen < 8 && hadIncompleteMatch {
+				return false
+			}
+			hadIncompleteMatch = matchLen < 8
+			if left < matchLen {
+				return false
+			}
+			left -= matchLen
+			prevOpcode = asMapMatch
+		case asMapDefault:
+			if prevOpcode == asMapDefault {
+				return false
+			}
+			if asMap.decodeASN(&pos) == asMapInvalid {
+				return false
+			}
+			prevOpcode = asMapDefault
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestASMapLookup(t *testing.T) {
+	asMap := TestASMap()
+	tests := []struct {
+		ip    string
+		asn   uint32
+		group string
+	}{
+		{"11.1.2.3", 64500, "as64500"},
+		{"12.5.0.1", 64501, "as64501"},
+		{"13.200.0.1", 64501, "as64501"},
+		{"14.0.0.1", 0, "14.0.0.0"},
+		{"2a01:4f8:1::1", 64502, "as64502"},
+		{"2a01:4f9::1", 0, "2a01:4f9::"},
+		// 6to4 and teredo addresses are looked up by their IPv4 address.
+		{"2002:0b01:0203::1", 64500, "as64500"},
+		{"2001:0:0:0:0:0:f3fe:fdfc", 64501, "as64501"},
+		// Unroutable addresses are never mapped.
+		{"10.0.0.1", 0, "unroutable"},
+	}
+	for _, test := range tests {
+		peerAddress := NewPeerAddressIPPort(0, net.ParseIP(test.ip), 8333)
+		if asn := peerAddress.MappedAS(asMap); asn != test.asn {
+			t.Errorf("%s: AS %d, want %d", test.ip, asn, test.asn)
+		}
+		if group := peerAddress.NetworkGroup(asMap); group != test.group {
+			t.Errorf("%s: group %s, want %s", test.ip, group, test.group)
+		}
+		if asn := peerAddress.MappedAS(nil); asn != 0 {
+			t.Errorf("%s: AS %d without asmap", test.ip, asn)
+		}
+	}
+}
+
+func TestASMapMalformed(t *testing.T) {
+	for i := range testASMapData {
+		if _, err := NewASMap(testASMapData[:i]); err == nil {
+			t.Errorf("asmap truncated to %d bytes accepted", i)
+		}
+	}
+	padded := append(append([]byte{}, testASMapData...), 0)
+	if _, err := NewASMap(padded); err == nil {
+		t.Error("asmap with a padding byte accepted")
+	}
+}
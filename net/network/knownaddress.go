@@ -24,7 +24,7 @@ func (knownAddress *KnownAddress) Chance() float64 {
 	if lastAttempt < 0 {
 		lastAttempt = 0
 	}
-	chance := .0
+	chance := 1.0
 	if lastAttempt < 10*time.Minute {
 		chance *= 0.01
 	}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"bytes"
 	"encoding/base32"
 	"encoding/binary"
 	"fmt"
@@ -11,7 +12,8 @@ import (
 	"time"
 
 	"github.com/btcboost/copernicus/net/protocol"
-	"github.com/btcsuite/go-socks/socks"
+	"github.com/btcboost/copernicus/net/socks"
+	"golang.org/x/crypto/sha3"
 )
 
 type HostToNetAddrFunc func(host string, port uint16, serviceFlag protocol.ServiceFlag) (*PeerAddress, error)
@@ -21,6 +23,10 @@ type PeerAddress struct {
 	ServicesFlag protocol.ServiceFlag
 	IP           net.IP
 	Port         uint16
+	// Host is the name of a peer no IP stands for: a version 3 Tor hidden
+	// service, or a host name the proxy resolved.  Such a peer is only
+	// dialed by name through the proxy, and its address is not routable.
+	Host string
 }
 type PeerAddressFunc func(remoteAddr *PeerAddress) *PeerAddress
 
@@ -43,6 +49,60 @@ func (peerAddress *PeerAddress) IsOnionCatTor() bool {
 	return OnionCatNet.Contains(peerAddress.IP)
 
 }
+
+// IsOnionHost returns whether host is the name of a Tor hidden service.
+func IsOnionHost(host string) bool {
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// OnionCatIP returns the address of the OnionCat range encoding the Tor
+// hidden service host, such as expyuzz4wqqyqhjn.onion.  Only the 16
+// characters names of the version 2 services fit in an address.
+func OnionCatIP(host string) (net.IP, error) {
+	if !IsOnionHost(host) || len(host) != 22 {
+		return nil, fmt.Errorf("%s is not a version 2 onion address", host)
+	}
+	data, err := base32.StdEncoding.DecodeString(strings.ToUpper(host[:16]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid onion address %s: %v", host, err)
+	}
+	prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+	return net.IP(append(prefix, data...)), nil
+}
+
+// IsOnionV3Host returns whether host is the name of a version 3 Tor hidden
+// service: the 56 characters encoding its public key, the checksum and the
+// version 3.
+func IsOnionV3Host(host string) bool {
+	if !IsOnionHost(host) || len(host) != 62 {
+		return false
+	}
+	data, err := base32.StdEncoding.DecodeString(strings.ToUpper(host[:56]))
+	if err != nil || data[34] != 3 {
+		return false
+	}
+	checksum := sha3.New256()
+	checksum.Write([]byte(".onion checksum"))
+	checksum.Write(data[:32])
+	checksum.Write(data[34:])
+	return bytes.Equal(checksum.Sum(nil)[:2], data[32:34])
+}
+
+// NewPeerAddressOnion returns the address of the Tor hidden service host.  A
+// version 2 service is encoded in the OnionCat range, a version 3 one is kept
+// by name.
+func NewPeerAddressOnion(host string, port uint16, serviceFlag protocol.ServiceFlag) (*PeerAddress, error) {
+	if IsOnionV3Host(host) {
+		peerAddress := NewPeerAddressIPPort(serviceFlag, nil, port)
+		peerAddress.Host = strings.ToLower(host)
+		return peerAddress, nil
+	}
+	ip, err := OnionCatIP(host)
+	if err != nil {
+		return nil, err
+	}
+	return NewPeerAddressIPPort(serviceFlag, ip, port), nil
+}
 func (peerAddress *PeerAddress) IsRFC2544() bool {
 	return rfc2544NeT.Contains(peerAddress.IP)
 }
@@ -77,7 +137,7 @@ func (peerAddress *PeerAddress) IsRFC4380() bool {
 	return rfc4380Net.Contains(peerAddress.IP)
 }
 func (peerAddress *PeerAddress) IsRFC4843() bool {
-	return rfc4380Net.Contains(peerAddress.IP)
+	return rfc4843Net.Contains(peerAddress.IP)
 }
 func (peerAddress *PeerAddress) IsRFC4862() bool {
 	return rfc4862Net.Contains(peerAddress.IP)
@@ -118,25 +178,17 @@ func (peerAddress *PeerAddress) IsRoutable() bool {
 		peerAddress.IsLocal() || (peerAddress.IsRFC4193() && !peerAddress.IsOnionCatTor()))
 }
 
-func (peerAddress *PeerAddress) GroupKey() string {
-	if peerAddress.IsLocal() {
-		return "local"
-	}
-	if !peerAddress.IsRoutable() {
-		return "unroutable"
-	}
+// linkedIPv4 returns the IPv4 address of an IPv4 address or of an IPv6 address
+// embedding one, or nil.
+func (peerAddress *PeerAddress) linkedIPv4() net.IP {
 	if peerAddress.IsIPv4() {
-		return peerAddress.IP.Mask(net.CIDRMask(16, 32)).String()
+		return peerAddress.IP.To4()
 	}
 	if peerAddress.IsRFC6145() || peerAddress.IsRFC6052() {
-		ip := peerAddress.IP[12:16]
-		return ip.Mask(net.CIDRMask(16, 32)).String()
+		return peerAddress.IP[12:16]
 	}
-
 	if peerAddress.IsRFC3964() {
-		ip := peerAddress.IP[2:6]
-		return ip.Mask(net.CIDRMask(16, 32)).String()
-
+		return peerAddress.IP[2:6]
 	}
 	if peerAddress.IsRFC4380() {
 		// teredo tunnels have the last 4 bytes as the v4 address XOR
@@ -145,6 +197,42 @@ func (peerAddress *PeerAddress) GroupKey() string {
 		for i, byte := range peerAddress.IP[12:16] {
 			ip[i] = byte ^ 0xff
 		}
+		return ip
+	}
+	return nil
+}
+
+// MappedAS returns the AS announcing the address according to asMap, or 0
+// when asMap is nil or doesn't map the address.  The IPv6 addresses embedding
+// an IPv4 address are looked up by that address, and tor addresses are never
+// mapped.
+func (peerAddress *PeerAddress) MappedAS(asMap *ASMap) uint32 {
+	if asMap == nil || !peerAddress.IsRoutable() || peerAddress.IsOnionCatTor() {
+		return 0
+	}
+	if ip := peerAddress.linkedIPv4(); ip != nil {
+		return asMap.Lookup(ip)
+	}
+	return asMap.Lookup(peerAddress.IP)
+}
+
+// NetworkGroup returns the key of the group of the address: its AS when asMap
+// maps it, its GroupKey otherwise.
+func (peerAddress *PeerAddress) NetworkGroup(asMap *ASMap) string {
+	if asn := peerAddress.MappedAS(asMap); asn != 0 {
+		return fmt.Sprintf("as%d", asn)
+	}
+	return peerAddress.GroupKey()
+}
+
+func (peerAddress *PeerAddress) GroupKey() string {
+	if peerAddress.IsLocal() {
+		return "local"
+	}
+	if !peerAddress.IsRoutable() {
+		return "unroutable"
+	}
+	if ip := peerAddress.linkedIPv4(); ip != nil {
 		return ip.Mask(net.CIDRMask(16, 32)).String()
 	}
 	if peerAddress.IsOnionCatTor() {
@@ -244,25 +332,30 @@ func NewPeerAddressWithNetAddr(address net.Addr, servicesFlag protocol.ServiceFl
 
 	}
 	if proxiedAddr, ok := address.(*socks.ProxiedAddr); ok {
-		ip := net.ParseIP(proxiedAddr.Host)
-		if ip == nil {
-
-			ip = net.ParseIP("0.0.0.0")
-		}
-		port := uint16(proxiedAddr.Port)
-		peerAddress := NewPeerAddressIPPort(servicesFlag, ip, port)
-		return peerAddress, nil
+		return newPeerAddressHost(proxiedAddr.Host, uint16(proxiedAddr.Port), servicesFlag)
 	}
 	host, portStr, err := net.SplitHostPort(address.String())
 	if err != nil {
 		return nil, err
 	}
-	ip := net.ParseIP(host)
 	port, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
 		return nil, err
 	}
-	peerAddress := NewPeerAddressIPPort(servicesFlag, ip, uint16(port))
+	return newPeerAddressHost(host, uint16(port), servicesFlag)
+}
+
+// newPeerAddressHost returns the address of the peer host, which is an IP, the
+// name of a Tor hidden service, or a host name kept as it is since only the
+// proxy resolves it.
+func newPeerAddressHost(host string, port uint16, servicesFlag protocol.ServiceFlag) (*PeerAddress, error) {
+	if IsOnionHost(host) {
+		return NewPeerAddressOnion(host, port, servicesFlag)
+	}
+	peerAddress := NewPeerAddressIPPort(servicesFlag, net.ParseIP(host), port)
+	if peerAddress.IP == nil {
+		peerAddress.Host = host
+	}
 	return peerAddress, nil
 }
 func (peerAddress *PeerAddress) NetAddressKey() string {
@@ -271,6 +364,9 @@ func (peerAddress *PeerAddress) NetAddressKey() string {
 }
 
 func (peerAddress *PeerAddress) IPString() string {
+	if peerAddress.Host != "" {
+		return peerAddress.Host
+	}
 	if peerAddress.IsOnionCatTor() {
 		base32String := base32.StdEncoding.EncodeToString(peerAddress.IP[6:])
 		return strings.ToLower(base32String) + ".onion"
@@ -0,0 +1,147 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/btcboost/copernicus/net/socks"
+)
+
+const onionV3Host = "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion"
+
+func TestOnionCatIP(t *testing.T) {
+	ip, err := OnionCatIP("expyuzz4wqqyqhjn.onion")
+	if err != nil {
+		t.Fatalf("OnionCatIP: %v", err)
+	}
+	peerAddress := NewPeerAddressIPPort(0, ip, 8333)
+	if !peerAddress.IsOnionCatTor() {
+		t.Errorf("%s not in the OnionCat range", ip)
+	}
+	if host := peerAddress.IPString(); host != "expyuzz4wqqyqhjn.onion" {
+		t.Errorf("onion address %s, want expyuzz4wqqyqhjn.onion", host)
+	}
+	if upper, err := OnionCatIP("EXPYUZZ4WQQYQHJN.ONION"); err != nil || !upper.Equal(ip) {
+		t.Errorf("upper case onion address gave %v, %v", upper, err)
+	}
+
+	invalid := []string{
+		"example.com",
+		"expyuzz4wqqyqhj.onion",
+		"expyuzz4wqqyqhj1.onion",
+		onionV3Host,
+	}
+	for _, host := range invalid {
+		if _, err := OnionCatIP(host); err == nil {
+			t.Errorf("%s accepted as an onion address", host)
+		}
+	}
+}
+
+func TestIsOnionV3Host(t *testing.T) {
+	if !IsOnionV3Host(onionV3Host) || !IsOnionV3Host(strings.ToUpper(onionV3Host)) {
+		t.Errorf("%s not a version 3 onion address", onionV3Host)
+	}
+	invalid := []string{
+		"expyuzz4wqqyqhjn.onion",
+		// The checksum doesn't match.
+		"qg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion",
+		// The version is 2.
+		"pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryc.onion",
+		"pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscry1.onion",
+		"pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.com",
+	}
+	for _, host := range invalid {
+		if IsOnionV3Host(host) {
+			t.Errorf("%s accepted as a version 3 onion address", host)
+		}
+	}
+}
+
+func TestNewPeerAddressOnion(t *testing.T) {
+	address := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8333}
+	peerAddress, err := NewPeerAddressWithNetAddr(address, 0)
+	if err != nil || peerAddress.IsOnionCatTor() {
+		t.Fatalf("TCP address gave %v, %v", peerAddress, err)
+	}
+
+	addressManager := NewNetAddressManager("", func(host string) ([]net.IP, error) {
+		t.Errorf("%s looked up", host)
+		return nil, nil
+	})
+	peerAddress, err = addressManager.HostToNetAddress("expyuzz4wqqyqhjn.onion", 8333, 0)
+	if err != nil {
+		t.Fatalf("HostToNetAddress: %v", err)
+	}
+	if key := peerAddress.NetAddressKey(); key != "expyuzz4wqqyqhjn.onion:8333" {
+		t.Errorf("address key %s, want expyuzz4wqqyqhjn.onion:8333", key)
+	}
+
+	// A version 3 service is kept by name, which no address stands for.
+	peerAddress, err = addressManager.HostToNetAddress(onionV3Host, 8333, 0)
+	if err != nil {
+		t.Fatalf("HostToNetAddress: %v", err)
+	}
+	if peerAddress.IP != nil || peerAddress.IsRoutable() {
+		t.Errorf("version 3 onion address has the IP %s", peerAddress.IP)
+	}
+	if key := peerAddress.NetAddressKey(); key != onionV3Host+":8333" {
+		t.Errorf("address key %s, want %s:8333", key, onionV3Host)
+	}
+	addressManager.AddAddress(peerAddress, NewPeerAddressIPPort(0, net.ParseIP("1.2.3.4"), 8333))
+	if n := addressManager.Numaddresses(); n != 0 {
+		t.Errorf("%d addresses stored, want the version 3 onion address left out", n)
+	}
+	peerAddress, err = NewPeerAddressWithNetAddr(testOnionAddr(onionV3Host+":8333"), 0)
+	if err != nil || peerAddress.NetAddressKey() != onionV3Host+":8333" {
+		t.Errorf("dialed version 3 onion address gave %v, %v", peerAddress, err)
+	}
+
+	invalid := "qg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion"
+	if _, err := addressManager.HostToNetAddress(invalid, 8333, 0); err == nil {
+		t.Errorf("%s accepted as an onion address", invalid)
+	}
+	if _, err := NewPeerAddressWithNetAddr(testOnionAddr(invalid+":8333"), 0); err == nil {
+		t.Errorf("dialed %s accepted as an onion address", invalid)
+	}
+}
+
+// testOnionAddr is the address of a peer dialed by name through the proxy.
+type testOnionAddr string
+
+func (addr testOnionAddr) Network() string { return "onion" }
+func (addr testOnionAddr) String() string  { return string(addr) }
+
+func TestNewPeerAddressProxied(t *testing.T) {
+	tests := []struct {
+		host string
+		key  string
+	}{
+		{"1.2.3.4", "1.2.3.4:8333"},
+		{"2001:db8::1", "[2001:db8::1]:8333"},
+		{"expyuzz4wqqyqhjn.onion", "expyuzz4wqqyqhjn.onion:8333"},
+		{onionV3Host, onionV3Host + ":8333"},
+		// A host name the proxy resolved is unknown to the node.
+		{"seed.example.com", "seed.example.com:8333"},
+	}
+	for _, test := range tests {
+		address := &socks.ProxiedAddr{Host: test.host, Port: 8333}
+		peerAddress, err := NewPeerAddressWithNetAddr(address, 0)
+		if err != nil {
+			t.Errorf("%s: %v", test.host, err)
+			continue
+		}
+		if key := peerAddress.NetAddressKey(); key != test.key {
+			t.Errorf("%s: address key %s, want %s", test.host, key, test.key)
+		}
+		if peerAddress.IP.IsUnspecified() {
+			t.Errorf("%s: recorded as %s", test.host, peerAddress.IP)
+		}
+	}
+
+	invalid := &socks.ProxiedAddr{Host: "expyuzz4wqqyqhj1.onion", Port: 8333}
+	if peerAddress, err := NewPeerAddressWithNetAddr(invalid, 0); err == nil {
+		t.Errorf("invalid onion address recorded as %s", peerAddress.NetAddressKey())
+	}
+}
@@ -0,0 +1,176 @@
+package p2p
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcboost/copernicus/consensus"
+	"github.com/btcboost/copernicus/net/msg"
+)
+
+const (
+	// UploadTargetTimeframe is the cycle the upload target is spent over.
+	UploadTargetTimeframe = 24 * time.Hour
+
+	// historicalBlockAge is how much older than the best header a block
+	// must be for its download to count as historical.
+	historicalBlockAge = 7 * 24 * time.Hour
+
+	// otherMessage counts the bytes of the messages which couldn't be
+	// decoded.
+	otherMessage = "*other*"
+)
+
+// messageBytes counts the bytes sent and received by a peer, by message
+// command.
+type messageBytes struct {
+	lock     sync.Mutex
+	sent     map[string]uint64
+	received map[string]uint64
+}
+
+func newMessageBytes() *messageBytes {
+	return &messageBytes{
+		sent:     make(map[string]uint64),
+		received: make(map[string]uint64),
+	}
+}
+
+// add counts n bytes of message to counts.
+func (messageBytes *messageBytes) add(counts map[string]uint64, message msg.Message, n int) {
+	command := otherMessage
+	if message != nil {
+		command = message.Command()
+	}
+	messageBytes.lock.Lock()
+	counts[command] += uint64(n)
+	messageBytes.lock.Unlock()
+}
+
+// snapshot returns copies of the counts of the bytes sent and received.
+func (messageBytes *messageBytes) snapshot() (map[string]uint64, map[string]uint64) {
+	messageBytes.lock.Lock()
+	defer messageBytes.lock.Unlock()
+	sent := make(map[string]uint64, len(messageBytes.sent))
+	for command, n := range messageBytes.sent {
+		sent[command] = n
+	}
+	received := make(map[string]uint64, len(messageBytes.received))
+	for command, n := range messageBytes.received {
+		received[command] = n
+	}
+	return sent, received
+}
+
+// UploadTargetStats is the state of the upload target, as shown by
+// getnettotals.
+type UploadTargetStats struct {
+	Timeframe             time.Duration
+	Target                uint64
+	TargetReached         bool
+	ServeHistoricalBlocks bool
+	BytesLeftInCycle      uint64
+	TimeLeftInCycle       time.Duration
+}
+
+// uploadTarget keeps the bytes sent to the peers under a target per cycle of
+// UploadTargetTimeframe, by refusing to serve historical blocks once the
+// bytes left in the cycle are only enough for the new blocks.
+type uploadTarget struct {
+	lock        sync.Mutex
+	target      uint64
+	cycleStart  time.Time
+	sentInCycle uint64
+}
+
+func newUploadTarget(target uint64) *uploadTarget {
+	return &uploadTarget{target: target}
+}
+
+// addSent counts n bytes sent at now, a new cycle starts when the last one is
+// over.
+func (uploadTarget *uploadTarget) addSent(now time.Time, n uint64) {
+	uploadTarget.lock.Lock()
+	defer uploadTarget.lock.Unlock()
+	if now.Sub(uploadTarget.cycleStart) > UploadTargetTimeframe {
+		uploadTarget.cycleStart = now
+		uploadTarget.sentInCycle = 0
+	}
+	uploadTarget.sentInCycle += n
+}
+
+// timeLeft returns the time left in the cycle at now.  The caller must hold
+// the lock.
+func (uploadTarget *uploadTarget) timeLeft(now time.Time) time.Duration {
+	if uploadTarget.target == 0 || uploadTarget.cycleStart.IsZero() {
+		return 0
+	}
+	left := uploadTarget.cycleStart.Add(UploadTargetTimeframe).Sub(now)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// reached returns whether the target is reached at now.  With historical,
+// the room for the blocks mined until the end of the cycle is kept, which
+// tells whether historical blocks may still be served.  The caller must hold
+// the lock.
+func (uploadTarget *uploadTarget) reached(now time.Time, historical bool) bool {
+	if uploadTarget.target == 0 {
+		return false
+	}
+	if historical {
+		buffer := uint64(uploadTarget.timeLeft(now)/(10*time.Minute)) * consensus.DefaultMaxBlockSize
+		return buffer >= uploadTarget.target || uploadTarget.sentInCycle >= uploadTarget.target-buffer
+	}
+	return uploadTarget.sentInCycle >= uploadTarget.target
+}
+
+// historicalBlocksLimited returns whether the historical blocks must no
+// longer be served at now.
+func (uploadTarget *uploadTarget) historicalBlocksLimited(now time.Time) bool {
+	uploadTarget.lock.Lock()
+	defer uploadTarget.lock.Unlock()
+	return uploadTarget.reached(now, true)
+}
+
+// stats returns the state of the upload target at now.
+func (uploadTarget *uploadTarget) stats(now time.Time) UploadTargetStats {
+	uploadTarget.lock.Lock()
+	defer uploadTarget.lock.Unlock()
+	stats := UploadTargetStats{
+		Timeframe:             UploadTargetTimeframe,
+		Target:                uploadTarget.target,
+		TargetReached:         uploadTarget.reached(now, false),
+		ServeHistoricalBlocks: !uploadTarget.reached(now, true),
+		TimeLeftInCycle:       uploadTarget.timeLeft(now),
+	}
+	if uploadTarget.target > uploadTarget.sentInCycle {
+		stats.BytesLeftInCycle = uploadTarget.target - uploadTarget.sentInCycle
+	}
+	return stats
+}
+
+// addBytesSent counts the bytes sent to a peer.
+func (peerManager *PeerManager) addBytesSent(n int) {
+	atomic.AddUint64(&peerManager.bytesSend, uint64(n))
+	peerManager.uploadTarget.addSent(time.Now(), uint64(n))
+}
+
+// addBytesReceived counts the bytes received from a peer.
+func (peerManager *PeerManager) addBytesReceived(n int) {
+	atomic.AddUint64(&peerManager.bytesReceived, uint64(n))
+}
+
+// NetTotals returns the bytes received from and sent to all the peers since
+// the peer manager was created.
+func (peerManager *PeerManager) NetTotals() (uint64, uint64) {
+	return atomic.LoadUint64(&peerManager.bytesReceived), atomic.LoadUint64(&peerManager.bytesSend)
+}
+
+// UploadTarget returns the state of the upload target.
+func (peerManager *PeerManager) UploadTarget() UploadTargetStats {
+	return peerManager.uploadTarget.stats(time.Now())
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/consensus"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestUploadTargetDisabled(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	uploadTarget := newUploadTarget(0)
+	uploadTarget.addSent(now, 1<<40)
+	stats := uploadTarget.stats(now)
+	if stats.TargetReached || !stats.ServeHistoricalBlocks || stats.BytesLeftInCycle != 0 ||
+		stats.TimeLeftInCycle != 0 || stats.Timeframe != UploadTargetTimeframe {
+		t.Errorf("stats without target %+v", stats)
+	}
+	if uploadTarget.historicalBlocksLimited(now) {
+		t.Error("historical blocks limited without target")
+	}
+}
+
+func TestUploadTarget(t *testing.T) {
+	// The room for the blocks of a day.
+	dayOfBlocks := uint64(UploadTargetTimeframe/(10*time.Minute)) * consensus.DefaultMaxBlockSize
+	target := dayOfBlocks + 1000
+	start := time.Unix(1500000000, 0)
+	uploadTarget := newUploadTarget(target)
+
+	// Nothing sent, no cycle has started.
+	stats := uploadTarget.stats(start)
+	if stats.TargetReached || !stats.ServeHistoricalBlocks || stats.BytesLeftInCycle != target ||
+		stats.TimeLeftInCycle != 0 {
+		t.Errorf("stats before any send %+v", stats)
+	}
+
+	uploadTarget.addSent(start, 500)
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		sent       uint64
+		timeLeft   time.Duration
+		reached    bool
+		historical bool
+	}{
+		// The bytes left are kept for the blocks until the end of the
+		// cycle.
+		{"start of cycle", 0, 0, UploadTargetTimeframe, false, false},
+		{"room for historical blocks", 0, 499, UploadTargetTimeframe, false, false},
+		{"no room for historical blocks", 0, 1, UploadTargetTimeframe, false, true},
+		// Less room is kept as the cycle goes on.
+		{"later in the cycle", 12 * time.Hour, 0, 12 * time.Hour, false, false},
+		{"nearly reached", 23*time.Hour + 55*time.Minute, dayOfBlocks - 1, 5 * time.Minute, false, false},
+		{"reached", 23*time.Hour + 55*time.Minute, 1, 5 * time.Minute, true, true},
+		{"end of cycle", UploadTargetTimeframe, 0, 0, true, true},
+	}
+	now := start
+	for _, test := range tests {
+		now = start.Add(test.elapsed)
+		uploadTarget.addSent(now, test.sent)
+		uploadTarget.lock.Lock()
+		timeLeft := uploadTarget.timeLeft(now)
+		reached := uploadTarget.reached(now, false)
+		historical := uploadTarget.reached(now, true)
+		uploadTarget.lock.Unlock()
+		if timeLeft != test.timeLeft || reached != test.reached || historical != test.historical {
+			t.Errorf("%s: time left %v, reached %v, historical limited %v, want %v, %v, %v", test.name,
+				timeLeft, reached, historical, test.timeLeft, test.reached, test.historical)
+		}
+		if limited := uploadTarget.historicalBlocksLimited(now); limited != test.historical {
+			t.Errorf("%s: historical blocks limited %v", test.name, limited)
+		}
+	}
+
+	stats = uploadTarget.stats(now)
+	if !stats.TargetReached || stats.ServeHistoricalBlocks || stats.BytesLeftInCycle != 0 ||
+		stats.TimeLeftInCycle != 0 || stats.Target != target {
+		t.Errorf("stats at the end of the cycle %+v", stats)
+	}
+
+	// A new cycle starts with the first send after the end of the last.
+	now = start.Add(UploadTargetTimeframe + time.Second)
+	uploadTarget.addSent(now, 10)
+	stats = uploadTarget.stats(now.Add(time.Hour))
+	if stats.TargetReached || stats.BytesLeftInCycle != target-10 ||
+		stats.TimeLeftInCycle != UploadTargetTimeframe-time.Hour {
+		t.Errorf("stats of the new cycle %+v", stats)
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	messageBytes := newMessageBytes()
+	messageBytes.add(messageBytes.sent, &msg.PingMessage{}, 32)
+	messageBytes.add(messageBytes.sent, &msg.PingMessage{}, 32)
+	messageBytes.add(messageBytes.received, &msg.PongMessage{}, 32)
+	messageBytes.add(messageBytes.received, nil, 7)
+
+	sent, received := messageBytes.snapshot()
+	if len(sent) != 1 || sent["ping"] != 64 {
+		t.Errorf("bytes sent %v", sent)
+	}
+	if len(received) != 2 || received["pong"] != 32 || received[otherMessage] != 7 {
+		t.Errorf("bytes received %v", received)
+	}
+
+	// The snapshot is a copy.
+	sent["ping"] = 0
+	if sent, _ := messageBytes.snapshot(); sent["ping"] != 64 {
+		t.Error("snapshot shares the counts")
+	}
+}
+
+func TestHistoricalBlockLimited(t *testing.T) {
+	mapBlockIndex := blockchain.GChainState.MapBlockIndex.Data
+	bestHeader := blockchain.GIndexBestHeader
+	defer func() {
+		blockchain.GChainState.MapBlockIndex.Data = mapBlockIndex
+		blockchain.GIndexBestHeader = bestHeader
+	}()
+
+	// blockIndex returns the index of a block mined ago with a hash ending
+	// in b.
+	now := time.Now()
+	blockIndex := func(b byte, ago time.Duration) *core.BlockIndex {
+		index := core.NewBlockIndex(&core.BlockHeader{Time: uint32(now.Add(-ago).Unix())})
+		index.BlockHash[0] = b
+		return index
+	}
+	historical := blockIndex(1, 30*24*time.Hour)
+	recent := blockIndex(2, time.Hour)
+	blockchain.GChainState.MapBlockIndex.Data = map[utils.Hash]*core.BlockIndex{
+		*historical.GetBlockHash(): historical,
+		*recent.GetBlockHash():     recent,
+	}
+	blockchain.GIndexBestHeader = blockIndex(3, 0)
+	unknown := blockIndex(4, 30*24*time.Hour)
+
+	// The upload target is reached.
+	peerManager := &PeerManager{uploadTarget: newUploadTarget(1)}
+	peerManager.uploadTarget.addSent(now, 1000)
+	whitelist, err := ParseWhitelist("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   PermissionFlags
+		block   *core.BlockIndex
+		limited bool
+	}{
+		{"historical block", 0, historical, true},
+		{"recent block", 0, recent, false},
+		{"unknown block", 0, unknown, false},
+		{"whitelisted peer", whitelist.Flags, historical, false},
+		{"download permission", PFDownload, historical, false},
+		{"relay permission", PFRelay, historical, true},
+	}
+	for _, test := range tests {
+		serverPeer := &ServerPeer{peerManager: peerManager, permissions: test.flags}
+		if limited := serverPeer.historicalBlockLimited(test.block.GetBlockHash()); limited != test.limited {
+			t.Errorf("%s: limited %v, want %v", test.name, limited, test.limited)
+		}
+	}
+}
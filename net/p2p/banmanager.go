@@ -0,0 +1,309 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/database"
+)
+
+// banKeyPrefix prefixes the keys of the bans stored in the peer database,
+// the rest of the key is the banned subnet.
+const banKeyPrefix = "b"
+
+// banEntrySize is the size of a serialized ban: the creation and expiry
+// times as unix seconds and the reason.
+const banEntrySize = 8 + 8 + 1
+
+// BanReason tells why a subnet was banned.
+type BanReason uint8
+
+const (
+	BanReasonUnknown BanReason = iota
+	BanReasonNodeMisbehaving
+	BanReasonManuallyAdded
+)
+
+var banReasonStrings = map[BanReason]string{
+	BanReasonUnknown:         "unknown",
+	BanReasonNodeMisbehaving: "node misbehaving",
+	BanReasonManuallyAdded:   "manually added",
+}
+
+func (reason BanReason) String() string {
+	if str, ok := banReasonStrings[reason]; ok {
+		return str
+	}
+	return fmt.Sprintf("unknown reason (%d)", uint8(reason))
+}
+
+// BanEntry is a ban of a subnet, single addresses are banned as a subnet of
+// one address.
+type BanEntry struct {
+	Subnet     *net.IPNet
+	CreateTime time.Time
+	BanUntil   time.Time
+	Reason     BanReason
+}
+
+// Expired returns whether the ban is over at now.
+func (entry *BanEntry) Expired(now time.Time) bool {
+	return !now.Before(entry.BanUntil)
+}
+
+func (entry *BanEntry) serialize() []byte {
+	buf := make([]byte, banEntrySize)
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(entry.CreateTime.Unix()))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(entry.BanUntil.Unix()))
+	buf[16] = byte(entry.Reason)
+	return buf
+}
+
+func deserializeBanEntry(subnet *net.IPNet, buf []byte) (*BanEntry, error) {
+	if len(buf) != banEntrySize {
+		return nil, fmt.Errorf("ban of %s has %d bytes, want %d", subnet, len(buf), banEntrySize)
+	}
+	return &BanEntry{
+		Subnet:     subnet,
+		CreateTime: time.Unix(int64(binary.LittleEndian.Uint64(buf[0:8])), 0),
+		BanUntil:   time.Unix(int64(binary.LittleEndian.Uint64(buf[8:16])), 0),
+		Reason:     BanReason(buf[16]),
+	}, nil
+}
+
+// ParseSubnet parses an address or a subnet in CIDR notation, an address is
+// returned as the subnet of that address only.
+func ParseSubnet(str string) (*net.IPNet, error) {
+	if strings.Contains(str, "/") {
+		_, subnet, err := net.ParseCIDR(str)
+		if err != nil {
+			return nil, err
+		}
+		return subnet, nil
+	}
+	ip := net.ParseIP(str)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", str)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// hostIP returns the IP address of an address string of the form host:port,
+// or nil when the host isn't an IP address.
+func hostIP(address string) net.IP {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return net.ParseIP(host)
+}
+
+// BanManager keeps the banned subnets, it is backed by the peer database so
+// that the bans outlive restarts.  Whitelisted addresses are never reported
+// as banned.
+type BanManager struct {
+	lock        sync.Mutex
+	db          *database.DBWrapper
+	banned      map[string]*BanEntry
+	whitelist   []*net.IPNet
+	banDuration time.Duration
+}
+
+// NewBanManager returns a ban manager storing its bans in db, which may be
+// nil to keep them in memory only, and loads the bans stored before.  Bans
+// last banDuration unless given an explicit expiry.
+func NewBanManager(db *database.DBWrapper, whitelist []*net.IPNet, banDuration time.Duration) (*BanManager, error) {
+	banManager := &BanManager{
+		db:          db,
+		banned:      make(map[string]*BanEntry),
+		whitelist:   whitelist,
+		banDuration: banDuration,
+	}
+	if err := banManager.load(); err != nil {
+		return nil, err
+	}
+	return banManager, nil
+}
+
+// load reads the bans from the database, dropping those which expired in the
+// meantime.
+func (banManager *BanManager) load() error {
+	if banManager.db == nil {
+		return nil
+	}
+	now := time.Now()
+	var expired [][]byte
+	iter := banManager.db.Iterator()
+	defer iter.Close()
+	for iter.Seek([]byte(banKeyPrefix)); iter.Valid(); iter.Next() {
+		key := iter.GetKey()
+		if !bytes.HasPrefix(key, []byte(banKeyPrefix)) {
+			break
+		}
+		subnet, err := ParseSubnet(string(key[len(banKeyPrefix):]))
+		if err != nil {
+			return fmt.Errorf("invalid banned subnet in the peer database: %v", err)
+		}
+		entry, err := deserializeBanEntry(subnet, iter.GetVal())
+		if err != nil {
+			return err
+		}
+		if entry.Expired(now) {
+			expired = append(expired, key)
+			continue
+		}
+		banManager.banned[subnet.String()] = entry
+	}
+	for _, key := range expired {
+		if err := banManager.db.Erase(key, false); err != nil {
+			return err
+		}
+	}
+	logs.Debug("loaded %d bans, %d expired bans removed", len(banManager.banned), len(expired))
+	return nil
+}
+
+// Ban bans subnet for the default ban duration.
+func (banManager *BanManager) Ban(subnet *net.IPNet, reason BanReason) error {
+	return banManager.BanUntil(subnet, time.Now().Add(banManager.banDuration), reason)
+}
+
+// BanUntil bans subnet until the given time, replacing any ban of the same
+// subnet.
+func (banManager *BanManager) BanUntil(subnet *net.IPNet, banUntil time.Time, reason BanReason) error {
+	entry := &BanEntry{
+		Subnet:     subnet,
+		CreateTime: time.Now(),
+		BanUntil:   banUntil,
+		Reason:     reason,
+	}
+	key := subnet.String()
+
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	if banManager.db != nil {
+		if err := banManager.db.Write([]byte(banKeyPrefix+key), entry.serialize(), true); err != nil {
+			return err
+		}
+	}
+	banManager.banned[key] = entry
+	logs.Info("banned %s until %s (%s)", key, banUntil, reason)
+	return nil
+}
+
+// Unban lifts the ban of subnet, which must be banned itself: unbanning an
+// address doesn't lift the ban of a subnet containing it.
+func (banManager *BanManager) Unban(subnet *net.IPNet) error {
+	key := subnet.String()
+
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	if _, ok := banManager.banned[key]; !ok {
+		return errors.New("subnet is not banned")
+	}
+	if banManager.db != nil {
+		if err := banManager.db.Erase([]byte(banKeyPrefix+key), true); err != nil {
+			return err
+		}
+	}
+	delete(banManager.banned, key)
+	logs.Info("unbanned %s", key)
+	return nil
+}
+
+// IsBanned returns whether ip is in a banned subnet and isn't whitelisted.
+func (banManager *BanManager) IsBanned(ip net.IP) bool {
+	if ip == nil || banManager.IsWhitelisted(ip) {
+		return false
+	}
+	now := time.Now()
+
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	for _, entry := range banManager.banned {
+		if !entry.Expired(now) && entry.Subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSubnetBanned returns whether subnet itself is banned.
+func (banManager *BanManager) IsSubnetBanned(subnet *net.IPNet) bool {
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	entry, ok := banManager.banned[subnet.String()]
+	return ok && !entry.Expired(time.Now())
+}
+
+// IsWhitelisted returns whether ip is in a whitelisted subnet.
+func (banManager *BanManager) IsWhitelisted(ip net.IP) bool {
+	for _, subnet := range banManager.whitelist {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the current bans sorted by subnet, the expired bans are
+// removed on the way.
+func (banManager *BanManager) List() []*BanEntry {
+	now := time.Now()
+
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	entries := make([]*BanEntry, 0, len(banManager.banned))
+	for key, entry := range banManager.banned {
+		if entry.Expired(now) {
+			banManager.remove(key)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Subnet.String() < entries[j].Subnet.String()
+	})
+	return entries
+}
+
+// Clear lifts all the bans.
+func (banManager *BanManager) Clear() error {
+	banManager.lock.Lock()
+	defer banManager.lock.Unlock()
+	if banManager.db != nil {
+		batch := database.NewBatchWrapper(banManager.db)
+		for key := range banManager.banned {
+			batch.Erase([]byte(banKeyPrefix + key))
+		}
+		if err := banManager.db.WriteBatch(batch, true); err != nil {
+			return err
+		}
+	}
+	banManager.banned = make(map[string]*BanEntry)
+	logs.Info("cleared all bans")
+	return nil
+}
+
+// remove drops the ban stored under key, failing to erase it from the
+// database only leaves it to be dropped on the next start.  The caller must
+// hold the lock.
+func (banManager *BanManager) remove(key string) {
+	delete(banManager.banned, key)
+	if banManager.db != nil {
+		if err := banManager.db.Erase([]byte(banKeyPrefix+key), false); err != nil {
+			logs.Warn("can't remove the expired ban of %s: %v", key, err)
+		}
+	}
+}
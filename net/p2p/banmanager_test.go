@@ -0,0 +1,261 @@
+package p2p
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/database"
+)
+
+// openTestDB opens a new peer database in a temporary directory, the
+// returned function removes it.
+func openTestDB(t *testing.T) (*database.DBWrapper, string, func()) {
+	dir, err := ioutil.TempDir("", "banmanager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := reopenTestDB(t, dir)
+	return db, dir, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// reopenTestDB opens the peer database in dir.
+func reopenTestDB(t *testing.T, dir string) *database.DBWrapper {
+	db, err := database.NewDBWrapper(&database.DBOption{FilePath: dir, CacheSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func mustParseSubnet(t *testing.T, str string) *net.IPNet {
+	subnet, err := ParseSubnet(str)
+	if err != nil {
+		t.Fatalf("%s: %v", str, err)
+	}
+	return subnet
+}
+
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		str    string
+		subnet string
+	}{
+		{"1.2.3.4", "1.2.3.4/32"},
+		{"::ffff:1.2.3.4", "1.2.3.4/32"},
+		{"1.2.3.4/24", "1.2.3.0/24"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+	}
+	for _, test := range tests {
+		if subnet := mustParseSubnet(t, test.str); subnet.String() != test.subnet {
+			t.Errorf("%s parsed as %s, want %s", test.str, subnet, test.subnet)
+		}
+	}
+	for _, str := range []string{"", "1.2.3", "1.2.3.4/33", "host.example", "1.2.3.4:8333"} {
+		if subnet, err := ParseSubnet(str); err == nil {
+			t.Errorf("%q parsed as %s", str, subnet)
+		}
+	}
+}
+
+func TestBanManagerBanUnban(t *testing.T) {
+	whitelist := []*net.IPNet{mustParseSubnet(t, "10.0.0.5")}
+	banManager, err := NewBanManager(nil, whitelist, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := mustParseSubnet(t, "1.2.3.4")
+	subnet := mustParseSubnet(t, "10.0.0.0/24")
+	if err := banManager.Ban(address, BanReasonNodeMisbehaving); err != nil {
+		t.Fatal(err)
+	}
+	if err := banManager.Ban(subnet, BanReasonManuallyAdded); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip     string
+		banned bool
+	}{
+		{"1.2.3.4", true},
+		{"::ffff:1.2.3.4", true},
+		{"1.2.3.5", false},
+		{"10.0.0.1", true},
+		{"10.0.0.255", true},
+		{"10.0.1.1", false},
+		// whitelisted within the banned subnet
+		{"10.0.0.5", false},
+		{"2001:db8::1", false},
+	}
+	for _, test := range tests {
+		if banned := banManager.IsBanned(net.ParseIP(test.ip)); banned != test.banned {
+			t.Errorf("%s banned %v, want %v", test.ip, banned, test.banned)
+		}
+	}
+	if banManager.IsBanned(nil) {
+		t.Error("nil address banned")
+	}
+	if !banManager.IsSubnetBanned(subnet) || banManager.IsSubnetBanned(mustParseSubnet(t, "10.0.0.1")) {
+		t.Error("IsSubnetBanned doesn't match the banned subnet only")
+	}
+
+	entries := banManager.List()
+	if len(entries) != 2 || entries[0].Subnet.String() != "1.2.3.4/32" ||
+		entries[1].Subnet.String() != "10.0.0.0/24" {
+		t.Fatalf("bans %v", entries)
+	}
+	if entries[0].Reason != BanReasonNodeMisbehaving || entries[1].Reason != BanReasonManuallyAdded {
+		t.Errorf("ban reasons %s, %s", entries[0].Reason, entries[1].Reason)
+	}
+	if until := time.Until(entries[0].BanUntil); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("banned for %v, want an hour", until)
+	}
+
+	// An address in a banned subnet can't be unbanned alone.
+	if err := banManager.Unban(mustParseSubnet(t, "10.0.0.1")); err == nil {
+		t.Error("unbanned an address not banned itself")
+	}
+	if err := banManager.Unban(subnet); err != nil {
+		t.Fatal(err)
+	}
+	if banManager.IsBanned(net.ParseIP("10.0.0.1")) {
+		t.Error("still banned after the unban")
+	}
+	if err := banManager.Unban(subnet); err == nil {
+		t.Error("unbanned twice")
+	}
+
+	if err := banManager.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if banManager.IsBanned(net.ParseIP("1.2.3.4")) || len(banManager.List()) != 0 {
+		t.Error("bans left after Clear")
+	}
+}
+
+func TestBanManagerExpiry(t *testing.T) {
+	banManager, err := NewBanManager(nil, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := mustParseSubnet(t, "1.2.3.4")
+	if err := banManager.BanUntil(expired, time.Now().Add(-time.Second), BanReasonManuallyAdded); err != nil {
+		t.Fatal(err)
+	}
+	if banManager.IsBanned(net.ParseIP("1.2.3.4")) || banManager.IsSubnetBanned(expired) {
+		t.Error("expired ban still in force")
+	}
+
+	// A new ban of the subnet replaces the expired one.
+	if err := banManager.BanUntil(expired, time.Now().Add(time.Minute), BanReasonManuallyAdded); err != nil {
+		t.Fatal(err)
+	}
+	if !banManager.IsBanned(net.ParseIP("1.2.3.4")) {
+		t.Error("renewed ban not in force")
+	}
+
+	entry := &BanEntry{BanUntil: time.Unix(1000, 0)}
+	if entry.Expired(time.Unix(999, 0)) || !entry.Expired(time.Unix(1000, 0)) {
+		t.Error("ban expiry not at BanUntil")
+	}
+
+	// List drops the expired bans.
+	other := mustParseSubnet(t, "5.6.7.8")
+	if err := banManager.BanUntil(other, time.Now().Add(-time.Second), BanReasonUnknown); err != nil {
+		t.Fatal(err)
+	}
+	if entries := banManager.List(); len(entries) != 1 || entries[0].Subnet.String() != "1.2.3.4/32" {
+		t.Errorf("bans %v", entries)
+	}
+	if _, ok := banManager.banned[other.String()]; ok {
+		t.Error("expired ban kept by List")
+	}
+}
+
+func TestBanManagerPersistence(t *testing.T) {
+	db, dir, cleanup := openTestDB(t)
+	defer cleanup()
+
+	banManager, err := NewBanManager(db, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	bans := []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32"}
+	for _, str := range bans {
+		if err := banManager.BanUntil(mustParseSubnet(t, str), until, BanReasonManuallyAdded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := banManager.BanUntil(mustParseSubnet(t, "5.6.7.8"), time.Now().Add(-time.Second),
+		BanReasonNodeMisbehaving); err != nil {
+		t.Fatal(err)
+	}
+	if err := banManager.Unban(mustParseSubnet(t, "10.0.0.0/8")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bans are read back after a restart, without the lifted and
+	// the expired ones.
+	db.Close()
+	db = reopenTestDB(t, dir)
+	banManager, err = NewBanManager(db, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := banManager.List()
+	if len(entries) != 2 {
+		t.Fatalf("%d bans loaded, want 2: %v", len(entries), entries)
+	}
+	for i, want := range []string{"1.2.3.4/32", "2001:db8::/32"} {
+		entry := entries[i]
+		if entry.Subnet.String() != want || !entry.BanUntil.Equal(until) ||
+			entry.Reason != BanReasonManuallyAdded {
+			t.Errorf("ban %d loaded as %s until %s (%s)", i, entry.Subnet, entry.BanUntil, entry.Reason)
+		}
+	}
+	if db.Exists([]byte(banKeyPrefix + "5.6.7.8/32")) {
+		t.Error("expired ban not erased from the database on load")
+	}
+
+	// Clear empties the database too.
+	if err := banManager.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = reopenTestDB(t, dir)
+	if banManager, err = NewBanManager(db, nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if entries := banManager.List(); len(entries) != 0 {
+		t.Errorf("bans %v loaded after Clear", entries)
+	}
+}
+
+func TestBanEntrySerialization(t *testing.T) {
+	subnet := mustParseSubnet(t, "1.2.3.0/24")
+	entry := &BanEntry{
+		Subnet:     subnet,
+		CreateTime: time.Unix(1500000000, 0),
+		BanUntil:   time.Unix(1500086400, 0),
+		Reason:     BanReasonNodeMisbehaving,
+	}
+	decoded, err := deserializeBanEntry(subnet, entry.serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.CreateTime.Equal(entry.CreateTime) || !decoded.BanUntil.Equal(entry.BanUntil) ||
+		decoded.Reason != entry.Reason || decoded.Subnet != subnet {
+		t.Errorf("decoded %+v, want %+v", decoded, entry)
+	}
+	if _, err := deserializeBanEntry(subnet, entry.serialize()[1:]); err == nil {
+		t.Error("short ban decoded")
+	}
+}
@@ -0,0 +1,172 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/dandelion"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/protocol"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// EmbargoTickInterval is how often the embargoes of the stem transactions
+// are checked.
+const EmbargoTickInterval = time.Second
+
+// stemTx is a transaction of the Dandelion++ stem, relayed to the peer to and
+// fluffed by the node at embargo unless it shows up in the memPool before.
+type stemTx struct {
+	tx      *core.Tx
+	to      int32
+	embargo time.Time
+}
+
+// stemPool tracks the stem transactions relayed by the node, the transactions
+// themselves are kept in blockchain.GStemPool.
+type stemPool struct {
+	lock sync.Mutex
+	txs  map[utils.Hash]*stemTx
+}
+
+func newStemPool() *stemPool {
+	return &stemPool{txs: make(map[utils.Hash]*stemTx)}
+}
+
+func (stemPool *stemPool) add(stem *stemTx) {
+	stemPool.lock.Lock()
+	stemPool.txs[stem.tx.TxHash()] = stem
+	stemPool.lock.Unlock()
+}
+
+// relayedTo returns the stem transaction of hash when it was relayed to the
+// peer to, the other peers mustn't learn about it.
+func (stemPool *stemPool) relayedTo(hash utils.Hash, to int32) *core.Tx {
+	stemPool.lock.Lock()
+	defer stemPool.lock.Unlock()
+	stem, ok := stemPool.txs[hash]
+	if !ok || stem.to != to {
+		return nil
+	}
+	return stem.tx
+}
+
+// expired removes and returns the stem transactions whose embargo is over at
+// now.
+func (stemPool *stemPool) expired(now time.Time) []*stemTx {
+	stemPool.lock.Lock()
+	defer stemPool.lock.Unlock()
+	var expired []*stemTx
+	for hash, stem := range stemPool.txs {
+		if !now.Before(stem.embargo) {
+			expired = append(expired, stem)
+			delete(stemPool.txs, hash)
+		}
+	}
+	return expired
+}
+
+// txPools accepts the transactions into the memPool and, with Dandelion, into
+// the stem pool.  The peer manager uses chainTxPools.
+type txPools interface {
+	processTransaction(tx *core.Tx, limitFree bool, from int32) ([]*core.Tx, error)
+	acceptStemTransaction(tx *core.Tx, from int32) error
+	fluffStemTransaction(tx *core.Tx) ([]*core.Tx, error)
+}
+
+// chainTxPools validates the transactions against the chain, the peers which
+// send invalid ones are reported to misbehaving.
+type chainTxPools struct {
+	chainParams *msg.BitcoinParams
+	misbehaving blockchain.MisbehaviorFunc
+}
+
+func (pools *chainTxPools) processTransaction(tx *core.Tx, limitFree bool, from int32) ([]*core.Tx, error) {
+	return blockchain.ProcessTransaction(pools.chainParams, tx, limitFree, int64(from), pools.misbehaving)
+}
+
+func (pools *chainTxPools) acceptStemTransaction(tx *core.Tx, from int32) error {
+	return blockchain.AcceptStemTransaction(pools.chainParams, tx, int64(from), pools.misbehaving)
+}
+
+func (pools *chainTxPools) fluffStemTransaction(tx *core.Tx) ([]*core.Tx, error) {
+	return blockchain.FluffStemTransaction(pools.chainParams, tx)
+}
+
+// isDandelionCandidate returns whether the peer may be picked as a stem
+// destination: an outbound peer relaying the transactions with the Dandelion
+// service.
+func (serverPeer *ServerPeer) isDandelionCandidate() bool {
+	return !serverPeer.Inbound && !serverPeer.isBlockRelayOnly() && !serverPeer.RelayTxDisabled() &&
+		serverPeer.GetServiceFlag()&protocol.SFNodeDandelion == protocol.SFNodeDandelion
+}
+
+// SubmitTransaction is the entry point of the transactions submitted to the
+// node itself.  With Dandelion, they are relayed along the stem, otherwise
+// they are accepted into the memPool and announced to all the peers.
+func (peerManager *PeerManager) SubmitTransaction(tx *core.Tx) error {
+	if peerManager.dandelion == nil {
+		return peerManager.fluffTransaction(tx, dandelion.Local)
+	}
+	return peerManager.stemTransaction(tx, dandelion.Local)
+}
+
+// fluffTransaction accepts the transaction from the peer identified by from
+// into the memPool, and announces it to all the peers.
+func (peerManager *PeerManager) fluffTransaction(tx *core.Tx, from int32) error {
+	limitFree := from != dandelion.Local
+	accepted, err := peerManager.txPools.processTransaction(tx, limitFree, from)
+	if err != nil {
+		return err
+	}
+	peerManager.RelayTransactions(accepted)
+	return nil
+}
+
+// stemTransaction relays the stem transaction from the peer identified by
+// from to its stem destination of the epoch, or fluffs it when there is none.
+func (peerManager *PeerManager) stemTransaction(tx *core.Tx, from int32) error {
+	now := time.Now()
+	to, ok := peerManager.dandelion.Route(now, from)
+	if !ok {
+		return peerManager.fluffTransaction(tx, from)
+	}
+	err := peerManager.txPools.acceptStemTransaction(tx, from)
+	if err != nil {
+		return err
+	}
+	peerManager.stemTxs.add(&stemTx{tx: tx, to: to, embargo: dandelion.Embargo(now)})
+
+	// A destination which disconnected meanwhile is left to the embargo.
+	serverPeer := peerManager.peerByID(to)
+	if serverPeer == nil {
+		return nil
+	}
+	hash := tx.TxHash()
+	serverPeer.QueueInventory(msg.NewInventoryVecror(msg.InventoryTypeDandelionTx, &hash))
+	return nil
+}
+
+// handleEmbargoTick fluffs the stem transactions whose embargo is over and
+// which didn't show up in the memPool, a node of their stem dropped them.
+func (peerManager *PeerManager) handleEmbargoTick(peerState *PeerState) {
+	for _, stem := range peerManager.stemTxs.expired(time.Now()) {
+		hash := stem.tx.TxHash()
+		if blockchain.GMemPool.Exists(hash) {
+			blockchain.RemoveStemTransaction(stem.tx)
+			continue
+		}
+		logs.Debug("embargo of stem tx %s over, fluffing it", hash.ToString())
+		accepted, err := peerManager.txPools.fluffStemTransaction(stem.tx)
+		if err != nil {
+			logs.Debug("stem tx %s not fluffed: %v", hash.ToString(), err)
+			continue
+		}
+		for _, tx := range accepted {
+			peerManager.handleRelayInventoryMsg(peerState, txRelayMessage(tx))
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package p2p
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/dandelion"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// testStemTx returns the i-th test transaction.
+func testStemTx(i int) *core.Tx {
+	tx := core.NewTx()
+	tx.LockTime = uint32(i)
+	return tx
+}
+
+// testTxPools accepts the transactions without validation, except those of
+// rejected.
+type testTxPools struct {
+	memPool  map[utils.Hash]int32
+	stemPool map[utils.Hash]int32
+	rejected map[utils.Hash]struct{}
+}
+
+func newTestTxPools() *testTxPools {
+	return &testTxPools{
+		memPool:  make(map[utils.Hash]int32),
+		stemPool: make(map[utils.Hash]int32),
+		rejected: make(map[utils.Hash]struct{}),
+	}
+}
+
+func (pools *testTxPools) processTransaction(tx *core.Tx, limitFree bool, from int32) ([]*core.Tx, error) {
+	if _, ok := pools.rejected[tx.TxHash()]; ok {
+		return nil, errors.New("rejected")
+	}
+	pools.memPool[tx.TxHash()] = from
+	return []*core.Tx{tx}, nil
+}
+
+func (pools *testTxPools) acceptStemTransaction(tx *core.Tx, from int32) error {
+	if _, ok := pools.rejected[tx.TxHash()]; ok {
+		return errors.New("rejected")
+	}
+	pools.stemPool[tx.TxHash()] = from
+	return nil
+}
+
+func (pools *testTxPools) fluffStemTransaction(tx *core.Tx) ([]*core.Tx, error) {
+	delete(pools.stemPool, tx.TxHash())
+	return pools.processTransaction(tx, false, dandelion.Local)
+}
+
+// testDandelion is a peer manager relaying the transactions with a router,
+// whose peer handler only answers the queries.
+type testDandelion struct {
+	peerManager *PeerManager
+	pools       *testTxPools
+	peerState   *PeerState
+}
+
+// newTestDandelion returns a peer manager relaying the transactions with
+// router, or without Dandelion when router is nil, to the connected peers
+// identified by ids.
+func newTestDandelion(router *dandelion.Router, ids ...int32) *testDandelion {
+	test := &testDandelion{
+		peerManager: &PeerManager{
+			chainParams:    &msg.RegressionNetParams,
+			dandelion:      router,
+			stemTxs:        newStemPool(),
+			query:          make(chan interface{}),
+			relayInventory: make(chan RelayMessage, 10),
+			quit:           make(chan struct{}),
+		},
+		pools: newTestTxPools(),
+		peerState: &PeerState{
+			inboundPeers:    make(map[int32]*ServerPeer),
+			outboundPeers:   make(map[int32]*ServerPeer),
+			persistentPeers: make(map[int32]*ServerPeer),
+			outboundGroups:  make(map[string]int),
+		},
+	}
+	test.peerManager.txPools = test.pools
+	for _, id := range ids {
+		serverPeer := newTestServerPeer(test.peerManager)
+		serverPeer.ID = id
+		test.peerState.outboundPeers[id] = serverPeer
+	}
+	go func() {
+		for {
+			select {
+			case query := <-test.peerManager.query:
+				test.peerManager.handleQuery(test.peerState, query)
+			case <-test.peerManager.quit:
+				return
+			}
+		}
+	}()
+	return test
+}
+
+func (test *testDandelion) stop() {
+	close(test.peerManager.quit)
+}
+
+// relayed returns the transactions announced to all the peers so far.
+func (test *testDandelion) relayed() []utils.Hash {
+	var hashes []utils.Hash
+	for {
+		select {
+		case relayMessage := <-test.peerManager.relayInventory:
+			hashes = append(hashes, *relayMessage.InventoryVector.Hash)
+		default:
+			return hashes
+		}
+	}
+}
+
+// newTestServerPeer returns a connected peer of peerManager whose sent
+// messages and announcements are left in its queues.
+func newTestServerPeer(peerManager *PeerManager) *ServerPeer {
+	serverPeer := NewServerPeer(peerManager, false)
+	serverPeer.Peer = newPeer(&PeerConfig{}, false)
+	atomic.StoreInt32(&serverPeer.connected, 1)
+	return serverPeer
+}
+
+// sentMessages returns the messages sent to the peer so far.
+func sentMessages(serverPeer *ServerPeer) []msg.Message {
+	var messages []msg.Message
+	for {
+		select {
+		case outMessage := <-serverPeer.OutputQueue:
+			messages = append(messages, outMessage.Message)
+		default:
+			return messages
+		}
+	}
+}
+
+// queuedInventory returns the inventory announced to the peer so far.
+func queuedInventory(serverPeer *ServerPeer) []*msg.InventoryVector {
+	var ivs []*msg.InventoryVector
+	for {
+		select {
+		case iv := <-serverPeer.outputInvChan:
+			ivs = append(ivs, iv)
+		default:
+			return ivs
+		}
+	}
+}
+
+func TestStemPoolEmbargo(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	stemPool := newStemPool()
+	for i := 0; i < 3; i++ {
+		stemPool.add(&stemTx{tx: testStemTx(i), to: 1, embargo: now.Add(time.Duration(i) * time.Minute)})
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		expired []int
+	}{
+		{"before the embargoes", -time.Second, nil},
+		{"at the first embargo", 0, []int{0}},
+		{"expired once", 0, nil},
+		{"after the others", 2*time.Minute + time.Second, []int{1, 2}},
+	}
+	for _, test := range tests {
+		expired := stemPool.expired(now.Add(test.elapsed))
+		if len(expired) != len(test.expired) {
+			t.Errorf("%s: %d stem txs expired, want %d", test.name, len(expired), len(test.expired))
+			continue
+		}
+		for _, i := range test.expired {
+			hash := testStemTx(i).TxHash()
+			found := false
+			for _, stem := range expired {
+				found = found || stem.tx.TxHash() == hash
+			}
+			if !found {
+				t.Errorf("%s: stem tx %d not expired", test.name, i)
+			}
+			// An expired stem tx is no longer served.
+			if stemPool.relayedTo(hash, 1) != nil {
+				t.Errorf("%s: expired stem tx %d still relayed", test.name, i)
+			}
+		}
+	}
+}
+
+func TestStemPoolRelayedTo(t *testing.T) {
+	stemPool := newStemPool()
+	tx := testStemTx(0)
+	stemPool.add(&stemTx{tx: tx, to: 7, embargo: time.Now().Add(time.Minute)})
+
+	tests := []struct {
+		name    string
+		tx      *core.Tx
+		to      int32
+		relayed bool
+	}{
+		{"destination", tx, 7, true},
+		{"other peer", tx, 8, false},
+		{"local", tx, dandelion.Local, false},
+		{"unknown tx", testStemTx(1), 7, false},
+	}
+	for _, test := range tests {
+		relayed := stemPool.relayedTo(test.tx.TxHash(), test.to)
+		if (relayed != nil) != test.relayed || relayed != nil && relayed != tx {
+			t.Errorf("%s: relayed %v, want %v", test.name, relayed, test.relayed)
+		}
+	}
+}
+
+func TestOnGetDataStemTx(t *testing.T) {
+	test := newTestDandelion(dandelion.NewRouter(dandelion.EpochDuration, 0))
+	defer test.stop()
+	destination := newTestServerPeer(test.peerManager)
+	other := newTestServerPeer(test.peerManager)
+	tx := testStemTx(0)
+	test.peerManager.stemTxs.add(&stemTx{tx: tx, to: destination.ID, embargo: time.Now().Add(time.Minute)})
+
+	hash := tx.TxHash()
+	getDataMessage := &msg.GetDataMessage{}
+	getDataMessage.AddInventoryVector(msg.NewInventoryVecror(msg.InventoryTypeDandelionTx, &hash))
+
+	// Only the destination of the stem tx gets it.
+	destination.OnGetData(destination.Peer, getDataMessage)
+	messages := sentMessages(destination)
+	if len(messages) != 1 {
+		t.Fatalf("%d messages sent to the destination, want 1", len(messages))
+	}
+	if txMessage, ok := messages[0].(*msg.TxMessage); !ok || txMessage.Tx != tx {
+		t.Errorf("destination sent %T", messages[0])
+	}
+
+	other.OnGetData(other.Peer, getDataMessage)
+	messages = sentMessages(other)
+	if len(messages) != 1 {
+		t.Fatalf("%d messages sent to another peer, want 1", len(messages))
+	}
+	notFound, ok := messages[0].(*msg.NotFoundMessage)
+	if !ok || len(notFound.InventoryList) != 1 || !notFound.InventoryList[0].Hash.IsEqual(&hash) {
+		t.Errorf("another peer sent %+v", messages[0])
+	}
+
+	// Nor is the stem tx served as a memPool tx.
+	getDataMessage = &msg.GetDataMessage{}
+	getDataMessage.AddInventoryVector(msg.NewInventoryVecror(msg.InventoryTypeTx, &hash))
+	destination.OnGetData(destination.Peer, getDataMessage)
+	messages = sentMessages(destination)
+	if len(messages) != 1 {
+		t.Fatalf("%d messages sent for a memPool tx, want 1", len(messages))
+	}
+	if _, ok := messages[0].(*msg.NotFoundMessage); !ok {
+		t.Errorf("stem tx served as a memPool tx: %T", messages[0])
+	}
+}
+
+func TestStemTransaction(t *testing.T) {
+	const (
+		from        = 3
+		destination = 7
+	)
+	tests := []struct {
+		name             string
+		fluffProbability float64
+		peers            []int32
+		from             int32
+		stemmed          bool
+	}{
+		{"no Dandelion peer", 0, nil, dandelion.Local, false},
+		{"local", 0, []int32{destination}, dandelion.Local, true},
+		{"relaying epoch", 0, []int32{destination}, from, true},
+		// The transactions of the node itself are stemmed in any epoch.
+		{"fluffing epoch", 1, []int32{destination}, from, false},
+		{"local in fluffing epoch", 1, []int32{destination}, dandelion.Local, true},
+		// A stem tx isn't sent back to where it came from.
+		{"only the origin", 0, []int32{from}, from, false},
+	}
+	for i, test := range tests {
+		router := dandelion.NewRouter(dandelion.EpochDuration, test.fluffProbability)
+		for _, id := range test.peers {
+			router.AddPeer(id)
+		}
+		dandelionTest := newTestDandelion(router, test.peers...)
+		tx := testStemTx(i)
+		hash := tx.TxHash()
+		if err := dandelionTest.peerManager.stemTransaction(tx, test.from); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+
+		_, stemmed := dandelionTest.pools.stemPool[hash]
+		relayed := dandelionTest.relayed()
+		if stemmed != test.stemmed || stemmed == (len(relayed) == 1) {
+			t.Errorf("%s: stemmed %v and relayed %d txs, want stemmed %v", test.name, stemmed,
+				len(relayed), test.stemmed)
+		}
+		if !stemmed {
+			if _, ok := dandelionTest.pools.memPool[hash]; !ok {
+				t.Errorf("%s: fluffed tx not in the memPool", test.name)
+			}
+			dandelionTest.stop()
+			continue
+		}
+
+		// The stem tx is announced to its destination only, which may
+		// then ask for it.
+		ivs := queuedInventory(dandelionTest.peerState.outboundPeers[destination])
+		if len(ivs) != 1 || ivs[0].Type != msg.InventoryTypeDandelionTx || !ivs[0].Hash.IsEqual(&hash) {
+			t.Errorf("%s: %+v announced to the destination", test.name, ivs)
+		}
+		if dandelionTest.peerManager.stemTxs.relayedTo(hash, destination) != tx {
+			t.Errorf("%s: stem tx not relayed to the destination", test.name)
+		}
+		dandelionTest.stop()
+	}
+}
+
+func TestStemTransactionRejected(t *testing.T) {
+	router := dandelion.NewRouter(dandelion.EpochDuration, 0)
+	router.AddPeer(7)
+	test := newTestDandelion(router, 7)
+	defer test.stop()
+
+	// A rejected stem tx is neither relayed nor fluffed.
+	tx := testStemTx(0)
+	test.pools.rejected[tx.TxHash()] = struct{}{}
+	if err := test.peerManager.stemTransaction(tx, dandelion.Local); err == nil {
+		t.Error("rejected stem tx relayed")
+	}
+	if len(test.peerManager.stemTxs.txs) != 0 || len(test.relayed()) != 0 ||
+		len(queuedInventory(test.peerState.outboundPeers[7])) != 0 {
+		t.Error("rejected stem tx announced")
+	}
+}
+
+func TestSubmitTransaction(t *testing.T) {
+	// Without Dandelion, the submitted transactions are fluffed at once.
+	test := newTestDandelion(nil)
+	defer test.stop()
+	tx := testStemTx(0)
+	if err := test.peerManager.SubmitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := test.pools.memPool[tx.TxHash()]; !ok || len(test.relayed()) != 1 {
+		t.Error("submitted tx not fluffed")
+	}
+}
+
+func TestHandleEmbargoTick(t *testing.T) {
+	memPool := blockchain.GMemPool
+	defer func() {
+		blockchain.GMemPool = memPool
+	}()
+	blockchain.GMemPool = mempool.NewTxMempool()
+
+	test := newTestDandelion(dandelion.NewRouter(dandelion.EpochDuration, 0), 1)
+	defer test.stop()
+	serverPeer := test.peerState.outboundPeers[1]
+	now := time.Now()
+	stems := []struct {
+		name     string
+		embargo  time.Time
+		memPool  bool
+		rejected bool
+		fluffed  bool
+	}{
+		{"under embargo", now.Add(time.Hour), false, false, false},
+		// The stem tx showed up from the fluff, it isn't fluffed again.
+		{"in the memPool", now.Add(-time.Second), true, false, false},
+		{"dropped by the stem", now.Add(-time.Second), false, false, true},
+		{"no longer valid", now.Add(-time.Second), false, true, false},
+	}
+	for i, stem := range stems {
+		tx := testStemTx(i)
+		if stem.memPool {
+			blockchain.GMemPool.PoolData[tx.TxHash()] = &mempool.TxEntry{Tx: tx}
+		}
+		if stem.rejected {
+			test.pools.rejected[tx.TxHash()] = struct{}{}
+		}
+		test.pools.stemPool[tx.TxHash()] = 1
+		test.peerManager.stemTxs.add(&stemTx{tx: tx, to: 1, embargo: stem.embargo})
+	}
+
+	test.peerManager.handleEmbargoTick(test.peerState)
+	announced := make(map[utils.Hash]struct{})
+	for _, iv := range queuedInventory(serverPeer) {
+		announced[*iv.Hash] = struct{}{}
+	}
+	for i, stem := range stems {
+		hash := testStemTx(i).TxHash()
+		_, inMemPool := test.pools.memPool[hash]
+		_, isAnnounced := announced[hash]
+		if inMemPool != stem.fluffed || isAnnounced != stem.fluffed {
+			t.Errorf("%s: fluffed %v, announced %v, want %v", stem.name, inMemPool, isAnnounced, stem.fluffed)
+		}
+		underEmbargo := test.peerManager.stemTxs.relayedTo(hash, 1) != nil
+		if underEmbargo != (i == 0) {
+			t.Errorf("%s: under embargo %v", stem.name, underEmbargo)
+		}
+	}
+	if len(announced) != 1 {
+		t.Errorf("%d txs announced after the embargo tick, want 1", len(announced))
+	}
+}
+
+func TestRelayTransactions(t *testing.T) {
+	test := newTestDandelion(nil)
+	txs := []*core.Tx{testStemTx(0), testStemTx(1)}
+	test.peerManager.RelayTransactions(txs)
+	relayed := test.relayed()
+	if len(relayed) != 2 || relayed[0] != txs[0].TxHash() || relayed[1] != txs[1].TxHash() {
+		t.Errorf("%d txs relayed, want 2", len(relayed))
+	}
+
+	// Once stopped, nothing drains the relayed inventory and the relay
+	// returns instead of blocking the chain code.
+	test.stop()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(test.peerManager.relayInventory)+1; i++ {
+			test.peerManager.RelayTransactions(txs)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("relay blocked after the peer manager stopped")
+	}
+}
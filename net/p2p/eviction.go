@@ -0,0 +1,178 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/crypto"
+)
+
+// The number of inbound peers protected from eviction by each criterion, an
+// attacker has to beat the honest peers on all of them to take their slots.
+const (
+	// evictProtectNetGroups peers of distinct network groups are protected,
+	// picked with a key the attacker doesn't know.
+	evictProtectNetGroups = 4
+
+	// evictProtectPing peers with the lowest ping are protected, which an
+	// attacker can't fake from far away.
+	evictProtectPing = 8
+
+	// evictProtectTx peers which last sent us a new transaction are
+	// protected.
+	evictProtectTx = 4
+
+	// evictProtectBlocks peers which last sent us a new block are protected.
+	evictProtectBlocks = 4
+)
+
+// EvictionStats counts the inbound peers evicted to make room for new ones,
+// and the new inbound peers rejected because no peer could be evicted.
+type EvictionStats struct {
+	Evicted  uint64
+	Rejected uint64
+}
+
+// evictionCandidate is the state of an inbound peer the eviction is based on.
+type evictionCandidate struct {
+	serverPeer    *ServerPeer
+	connected     time.Time
+	pingMicros    int64
+	lastTxTime    int64
+	lastBlockTime int64
+	group         string
+	keyedGroup    uint64
+}
+
+// evictionCandidates returns the inbound peers which may be evicted, those
+// with the noban permission and those already disconnecting are left out.
+func (peerManager *PeerManager) evictionCandidates(peerState *PeerState) []*evictionCandidate {
+	candidates := make([]*evictionCandidate, 0, len(peerState.inboundPeers))
+	for _, serverPeer := range peerState.inboundPeers {
+		if !serverPeer.Connected() || serverPeer.HasPermission(PFNoBan) {
+			continue
+		}
+		statsSnap := serverPeer.StatsSnapshot()
+		group := "unknown"
+		if address := serverPeer.GetNetAddress(); address != nil {
+			group = peerManager.netAddressManager.GroupKey(address)
+		}
+		candidates = append(candidates, &evictionCandidate{
+			serverPeer:    serverPeer,
+			connected:     statsSnap.ConnTime,
+			pingMicros:    statsSnap.LastPingMicros,
+			lastTxTime:    atomic.LoadInt64(&serverPeer.lastTxTime),
+			lastBlockTime: atomic.LoadInt64(&serverPeer.lastBlockTime),
+			group:         group,
+			keyedGroup:    peerManager.keyedGroup(group),
+		})
+	}
+	return candidates
+}
+
+// keyedGroup hashes a network group with the eviction key, so that the
+// groups protected from eviction can't be predicted.
+func (peerManager *PeerManager) keyedGroup(group string) uint64 {
+	data := make([]byte, 0, len(peerManager.evictionKey)+len(group))
+	data = append(data, peerManager.evictionKey[:]...)
+	data = append(data, group...)
+	return binary.LittleEndian.Uint64(crypto.DoubleSha256Bytes(data))
+}
+
+// protectPeers sorts the candidates by less and returns them without the
+// first n, which are protected from eviction.
+func protectPeers(candidates []*evictionCandidate, n int, less func(a, b *evictionCandidate) bool) []*evictionCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[n:]
+}
+
+// selectPeerToEvict picks the peer to evict among the candidates, or nil
+// when all of them are protected.  Peers are protected, in order, for their
+// network group, their ping, the transactions and the blocks they sent us
+// last, and half of those left for their uptime.  The youngest peer of the
+// network group with the most peers left is evicted, which makes room without
+// reducing the diversity of the peers.
+func selectPeerToEvict(candidates []*evictionCandidate) *evictionCandidate {
+	candidates = append([]*evictionCandidate(nil), candidates...)
+	candidates = protectPeers(candidates, evictProtectNetGroups, func(a, b *evictionCandidate) bool {
+		return a.keyedGroup > b.keyedGroup
+	})
+	candidates = protectPeers(candidates, evictProtectPing, func(a, b *evictionCandidate) bool {
+		// Peers which didn't answer a ping yet come last.
+		if (a.pingMicros == 0) != (b.pingMicros == 0) {
+			return b.pingMicros == 0
+		}
+		return a.pingMicros < b.pingMicros
+	})
+	candidates = protectPeers(candidates, evictProtectTx, func(a, b *evictionCandidate) bool {
+		if a.lastTxTime != b.lastTxTime {
+			return a.lastTxTime > b.lastTxTime
+		}
+		return a.connected.Before(b.connected)
+	})
+	candidates = protectPeers(candidates, evictProtectBlocks, func(a, b *evictionCandidate) bool {
+		if a.lastBlockTime != b.lastBlockTime {
+			return a.lastBlockTime > b.lastBlockTime
+		}
+		return a.connected.Before(b.connected)
+	})
+	candidates = protectPeers(candidates, len(candidates)/2, func(a, b *evictionCandidate) bool {
+		return a.connected.Before(b.connected)
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Group the candidates left, the youngest peer of each group comes
+	// first.
+	groups := make(map[string][]*evictionCandidate)
+	for _, candidate := range candidates {
+		groups[candidate.group] = append(groups[candidate.group], candidate)
+	}
+	var evictGroup []*evictionCandidate
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].connected.After(group[j].connected)
+		})
+		if len(group) > len(evictGroup) ||
+			(len(group) == len(evictGroup) && group[0].connected.After(evictGroup[0].connected)) {
+			evictGroup = group
+		}
+	}
+	return evictGroup[0]
+}
+
+// evictInboundPeer disconnects an inbound peer to make room for serverPeer
+// and returns whether one was found.  The evicted peer is removed from
+// peerState at once, so that it doesn't count against the max peers while
+// it disconnects.
+func (peerManager *PeerManager) evictInboundPeer(peerState *PeerState, serverPeer *ServerPeer) bool {
+	evict := selectPeerToEvict(peerManager.evictionCandidates(peerState))
+	if evict == nil {
+		atomic.AddUint64(&peerManager.evictionStats.Rejected, 1)
+		return false
+	}
+	atomic.AddUint64(&peerManager.evictionStats.Evicted, 1)
+	logs.Info("Evicting inbound p2p %s of group %s to make room for p2p %s",
+		evict.serverPeer, evict.group, serverPeer)
+	peerManager.removePeer(peerState, evict.serverPeer)
+	evict.serverPeer.Disconnect()
+	return true
+}
+
+// EvictionStats returns the counts of the inbound peers evicted and rejected
+// since the peer manager was created.
+func (peerManager *PeerManager) EvictionStats() EvictionStats {
+	return EvictionStats{
+		Evicted:  atomic.LoadUint64(&peerManager.evictionStats.Evicted),
+		Rejected: atomic.LoadUint64(&peerManager.evictionStats.Rejected),
+	}
+}
@@ -0,0 +1,161 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+// evictProtected is the number of candidates protected before the uptime.
+const evictProtected = evictProtectNetGroups + evictProtectPing + evictProtectTx + evictProtectBlocks
+
+// testEvictionCandidates returns unprotected candidates connected in order
+// followed by the candidates protected by, in order, their blocks, their
+// transactions, their ping and their network group.  The candidates not
+// protected by their ping have a slow one.
+func testEvictionCandidates(unprotected int) []*evictionCandidate {
+	total := unprotected + evictProtected
+	start := time.Now().Add(-time.Hour)
+	candidates := make([]*evictionCandidate, total)
+	for i := range candidates {
+		candidate := &evictionCandidate{
+			serverPeer: &ServerPeer{},
+			connected:  start.Add(time.Duration(i) * time.Second),
+			pingMicros: int64(1000 + i),
+			group:      "protected",
+			keyedGroup: uint64(i),
+		}
+		switch n := i - unprotected; {
+		case n < 0:
+			candidate.group = "unprotected"
+		case n < evictProtectBlocks:
+			candidate.lastBlockTime = int64(i + 1)
+		case n < evictProtectBlocks+evictProtectTx:
+			candidate.lastTxTime = int64(i + 1)
+		case n < evictProtectBlocks+evictProtectTx+evictProtectPing:
+			candidate.pingMicros = int64(i + 1)
+		}
+		candidates[i] = candidate
+	}
+	return candidates
+}
+
+func TestSelectPeerToEvictProtected(t *testing.T) {
+	if evict := selectPeerToEvict(nil); evict != nil {
+		t.Error("peer evicted without candidates")
+	}
+	for n := 1; n <= evictProtected; n++ {
+		if evict := selectPeerToEvict(testEvictionCandidates(0)[:n]); evict != nil {
+			t.Errorf("peer evicted among %d candidates", n)
+		}
+	}
+
+	// Half of the unprotected candidates are protected for their uptime.
+	tests := []struct {
+		unprotected int
+		evict       int
+	}{
+		{1, 0},
+		{2, 1},
+		{3, 2},
+		{10, 9},
+	}
+	for _, test := range tests {
+		candidates := testEvictionCandidates(test.unprotected)
+		evict := selectPeerToEvict(candidates)
+		if evict != candidates[test.evict] {
+			t.Errorf("%d unprotected candidates: evicted %v, want candidate %d", test.unprotected,
+				evict, test.evict)
+		}
+	}
+}
+
+func TestSelectPeerToEvictCriteria(t *testing.T) {
+	tests := []struct {
+		name      string
+		protected int
+		criterion func(candidate *evictionCandidate) bool
+		remove    func(candidates []*evictionCandidate, candidate *evictionCandidate)
+	}{
+		{
+			"network group",
+			evictProtectNetGroups,
+			func(candidate *evictionCandidate) bool {
+				return candidate.keyedGroup >= uint64(len(testEvictionCandidates(1))-evictProtectNetGroups)
+			},
+			func(candidates []*evictionCandidate, candidate *evictionCandidate) {
+				// Swap the keyed groups with the unprotected candidate.
+				candidates[0].keyedGroup, candidate.keyedGroup = candidate.keyedGroup, candidates[0].keyedGroup
+			},
+		},
+		{
+			// A peer which didn't answer a ping yet comes last.
+			"ping",
+			evictProtectPing,
+			func(candidate *evictionCandidate) bool { return candidate.pingMicros < 1000 },
+			func(candidates []*evictionCandidate, candidate *evictionCandidate) { candidate.pingMicros = 0 },
+		},
+		{
+			"transactions",
+			evictProtectTx,
+			func(candidate *evictionCandidate) bool { return candidate.lastTxTime != 0 },
+			func(candidates []*evictionCandidate, candidate *evictionCandidate) { candidate.lastTxTime = 0 },
+		},
+		{
+			"blocks",
+			evictProtectBlocks,
+			func(candidate *evictionCandidate) bool { return candidate.lastBlockTime != 0 },
+			func(candidates []*evictionCandidate, candidate *evictionCandidate) { candidate.lastBlockTime = 0 },
+		},
+	}
+	for _, test := range tests {
+		// Each protected candidate is evicted once its protection is
+		// removed, being younger than the unprotected candidate.
+		protected := 0
+		for i := range testEvictionCandidates(1) {
+			candidates := testEvictionCandidates(1)
+			candidate := candidates[i]
+			if !test.criterion(candidate) {
+				continue
+			}
+			protected++
+			test.remove(candidates, candidate)
+			if evict := selectPeerToEvict(candidates); evict != candidate {
+				t.Errorf("%s: evicted %v, want candidate %d", test.name, evict, i)
+			}
+		}
+		if protected != test.protected {
+			t.Errorf("%s: %d candidates protected, want %d", test.name, protected, test.protected)
+		}
+	}
+}
+
+func TestSelectPeerToEvictGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		evict  int
+	}{
+		// The first half of the unprotected candidates are protected for
+		// their uptime.
+		{"single group", []string{"a", "a", "a", "a", "a", "a", "a", "a"}, 7},
+		{"largest group", []string{"a", "a", "a", "a", "x", "x", "y", "z"}, 5},
+		{"largest group not youngest", []string{"a", "a", "a", "a", "x", "y", "y", "z"}, 6},
+		{"youngest of equal groups", []string{"a", "a", "a", "a", "x", "y", "y", "x"}, 7},
+		{"groups of one", []string{"a", "a", "a", "a", "x", "y", "z", "w"}, 7},
+	}
+	for _, test := range tests {
+		candidates := testEvictionCandidates(len(test.groups))
+		for i, group := range test.groups {
+			candidates[i].group = group
+		}
+		order := append([]*evictionCandidate(nil), candidates...)
+		if evict := selectPeerToEvict(candidates); evict != candidates[test.evict] {
+			t.Errorf("%s: evicted %v, want candidate %d", test.name, evict, test.evict)
+		}
+		for i := range order {
+			if candidates[i] != order[i] {
+				t.Fatalf("%s: candidates reordered", test.name)
+			}
+		}
+	}
+}
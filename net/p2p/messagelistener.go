@@ -37,4 +37,5 @@ type MessageListener struct {
 	OnVerAck      func(p *Peer, msg *msg.VersionACKMessage)
 	OnReject      func(p *Peer, msg msg.RejectMessage)
 	OnSendHeaders func(p *Peer, msg *msg.SendHeadersMessage)
+	OnFeeFilter   func(p *Peer, msg *msg.FeeFilterMessage)
 }
@@ -5,6 +5,7 @@ import (
 	"container/list"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net"
 	"strconv"
@@ -24,20 +25,26 @@ import (
 )
 
 const (
-	MaxInventoryTickleSize = 1000
-	StallResponseTimeout   = 30 * time.Second
-	StallTickInterval      = 15 * time.Second
-	IdleTimeout            = 5 * time.Minute
-	TrickleTimeout         = 10 * time.Second
-	PingInterval           = 2 * time.Minute
-	NegotiateTimeOut       = 30 * time.Second
-	OutPutBufferSize       = 50
+	StallResponseTimeout = 30 * time.Second
+	StallTickInterval    = 15 * time.Second
+	IdleTimeout          = 5 * time.Minute
+	PingInterval         = 2 * time.Minute
+	NegotiateTimeOut     = 30 * time.Second
+	OutPutBufferSize     = 50
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// PoissonNextSend return the time of the next event of a Poisson process with
+// the average interval, which makes the timing of the sent messages
+// unpredictable to the peers.
+func PoissonNextSend(now time.Time, average time.Duration) time.Time {
+	delay := -math.Log1p(-rand.Float64()) * float64(average)
+	return now.Add(time.Duration(delay))
+}
+
 type Peer struct {
 	Config           *PeerConfig
 	ID               int32
@@ -159,6 +166,68 @@ func (p *Peer) LastReceived() uint64 {
 	return atomic.LoadUint64(&p.bytesReceived)
 }
 
+// StatsSnap is a snapshot of the state and the statistics of a peer.
+type StatsSnap struct {
+	ID             int32
+	Addr           string
+	Services       protocol.ServiceFlag
+	LastSend       time.Time
+	LastRecv       time.Time
+	BytesSent      uint64
+	BytesRecv      uint64
+	ConnTime       time.Time
+	TimeOffset     int64
+	Version        uint32
+	UserAgent      string
+	Inbound        bool
+	StartingHeight int32
+	LastBlock      int32
+	LastPingNonce  uint64
+	LastPingTime   time.Time
+	LastPingMicros int64
+}
+
+// StatsSnapshot returns a snapshot of the state and the statistics of the
+// peer.
+func (p *Peer) StatsSnapshot() *StatsSnap {
+	p.BlockStatusMutex.RLock()
+	startingHeight := p.StartingHeight
+	lastBlock := p.LastBlock
+	timeOffset := p.TimeOffset
+	p.BlockStatusMutex.RUnlock()
+
+	p.PeerStatusMutex.Lock()
+	defer p.PeerStatusMutex.Unlock()
+	return &StatsSnap{
+		ID:             p.ID,
+		Addr:           p.AddressString,
+		Services:       p.ServiceFlag,
+		LastSend:       time.Unix(atomic.LoadInt64(&p.lastSent), 0),
+		LastRecv:       time.Unix(atomic.LoadInt64(&p.lastReceive), 0),
+		BytesSent:      atomic.LoadUint64(&p.bytesSent),
+		BytesRecv:      atomic.LoadUint64(&p.bytesReceived),
+		ConnTime:       p.ConnectedTime,
+		TimeOffset:     timeOffset,
+		Version:        p.ProtocolVersion,
+		UserAgent:      p.UserAgent,
+		Inbound:        p.Inbound,
+		StartingHeight: startingHeight,
+		LastBlock:      lastBlock,
+		LastPingNonce:  p.PingNonce,
+		LastPingTime:   p.PingTime,
+		LastPingMicros: p.PingMicros,
+	}
+}
+
+// LocalAddr returns the local address of the connection, or nil before the
+// peer is connected.
+func (p *Peer) LocalAddr() net.Addr {
+	if atomic.LoadInt32(&p.connected) == 0 || p.conn == nil {
+		return nil
+	}
+	return p.conn.LocalAddr()
+}
+
 func (p *Peer) LocalVersionMsg() (*msg.VersionMessage, error) {
 	var blockNumber int32
 	if p.Config.NewBlock != nil {
@@ -219,7 +288,6 @@ func (p *Peer) HandleRemoteVersionMessage(versionMessage *msg.VersionMessage) er
 	p.ProtocolVersion = container.MinUint32(p.ProtocolVersion, versionMessage.ProtocolVersion)
 	p.VersionKnown = true
 	logs.Debug("Negotiated protocol version %d for p2p %s", p.ProtocolVersion, p)
-	p.ID = atomic.AddInt32(&nodeCount, 1)
 	p.ServiceFlag = versionMessage.ServiceFlag
 	p.UserAgent = versionMessage.UserAgent
 	p.PeerStatusMutex.Unlock()
@@ -609,6 +677,10 @@ out:
 			p.HandlePingMessage(message)
 		case *msg.PongMessage:
 			p.HandlePongMessage(message)
+		case *msg.FeeFilterMessage:
+			if p.Config.Listener.OnFeeFilter != nil {
+				p.Config.Listener.OnFeeFilter(p, message)
+			}
 
 		default:
 			logs.Debug("Received unhandled message of type %v from %v", readMessage.Command(), p)
@@ -628,9 +700,9 @@ out:
 
 func (p *Peer) queueHandler() {
 	pendingMessages := list.New()
-	invSendQueue := list.New()
-	trickleTicker := time.NewTicker(TrickleTimeout)
-	defer trickleTicker.Stop()
+	var txInvQueue []*msg.InventoryVector
+	invTimer := time.NewTimer(p.nextInventoryBroadcast())
+	defer invTimer.Stop()
 	waiting := false
 	queuePacket := func(outMsg msg.OutMessage, list *list.List, waiting bool) bool {
 		if !waiting {
@@ -654,36 +726,37 @@ out:
 			val := pendingMessages.Remove(next)
 			p.SendQueue <- val.(msg.OutMessage)
 		case iv := <-p.outputInvChan:
-			if p.VersionKnown {
-				invSendQueue.PushBack(iv)
+			if !p.VersionKnown {
+				continue
 			}
-		case <-trickleTicker.C:
-			if atomic.LoadInt32(&p.disconnect) != 0 || invSendQueue.Len() == 0 {
+			if iv.Type == msg.InventoryTypeTx {
+				txInvQueue = append(txInvQueue, iv)
 				continue
 			}
-			inventoryMessage := msg.NewInventoryMessageSizeHint(uint(invSendQueue.Len()))
-			for e := invSendQueue.Front(); e != nil; e = invSendQueue.Front() {
-				iv := invSendQueue.Remove(e).(*msg.InventoryVector)
-				if p.knownInventory.Exists(iv) {
-					continue
-				}
-				inventoryMessage.AddInventoryVector(iv)
-				if len(inventoryMessage.InventoryList) >= MaxInventoryTickleSize {
-					waiting = queuePacket(
-						msg.OutMessage{Message: inventoryMessage},
-						pendingMessages, waiting,
-					)
-					inventoryMessage = msg.NewInventoryMessageSizeHint(uint(invSendQueue.Len()))
-				}
-				p.knownInventory.Add(iv, iv)
-
+			// The blocks aren't private, they are announced at once.
+			if p.isKnownInventory(iv) {
+				continue
 			}
-			if len(inventoryMessage.InventoryList) > 0 {
-				waiting = queuePacket(
-					msg.OutMessage{Message: inventoryMessage},
-					pendingMessages, waiting)
-
+			p.AddKnownInventory(iv)
+			inventoryMessage := msg.NewInventoryMessageSizeHint(1)
+			inventoryMessage.AddInventoryVector(iv)
+			waiting = queuePacket(msg.OutMessage{Message: inventoryMessage}, pendingMessages, waiting)
+		case <-invTimer.C:
+			invTimer.Reset(p.nextInventoryBroadcast())
+			if atomic.LoadInt32(&p.disconnect) != 0 || len(txInvQueue) == 0 {
+				continue
+			}
+			var batch []*msg.InventoryVector
+			batch, txInvQueue = p.nextTxInventory(txInvQueue)
+			if len(batch) == 0 {
+				continue
 			}
+			inventoryMessage := msg.NewInventoryMessageSizeHint(uint(len(batch)))
+			for _, iv := range batch {
+				inventoryMessage.AddInventoryVector(iv)
+				p.AddKnownInventory(iv)
+			}
+			waiting = queuePacket(msg.OutMessage{Message: inventoryMessage}, pendingMessages, waiting)
 		case <-p.quit:
 			break out
 		}
@@ -774,8 +847,11 @@ cleanup:
 	logs.Trace("p2p output handler done for %s", p)
 
 }
+
+// QueueInventory queues the inventory to be announced to the peer, the
+// blocks at once and the transactions in the next randomly timed batch.
 func (p *Peer) QueueInventory(inventoryVector *msg.InventoryVector) {
-	if p.knownInventory.Exists(inventoryVector) {
+	if p.isKnownInventory(inventoryVector) {
 		return
 	}
 	if !p.Connected() {
@@ -944,6 +1020,9 @@ func newPeer(peerConfig *PeerConfig, inbound bool) *Peer {
 		Config:          peerConfig,
 		ServiceFlag:     peerConfig.ServicesFlag,
 		ProtocolVersion: protocolVersion,
+		// The ID is given at once, the peer is tracked from its
+		// connection on.
+		ID: atomic.AddInt32(&nodeCount, 1),
 	}
 	return &perr
 }
@@ -24,4 +24,8 @@ type PeerConfig struct {
 	DisableRelayTx  bool
 	Listener        MessageListener
 	ChainParams     *msg.BitcoinParams
+
+	// OrderTxInventory orders the transactions of an announcement and drops
+	// those which mustn't be announced, it's optional.
+	OrderTxInventory func(ivs []*msg.InventoryVector) []*msg.InventoryVector
 }
@@ -1,9 +1,13 @@
 package p2p
 
 import (
+	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -12,21 +16,35 @@ import (
 	"github.com/astaxie/beego/logs"
 	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/conf"
+	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/database"
+	"github.com/btcboost/copernicus/mempool"
 	"github.com/btcboost/copernicus/net/conn"
+	"github.com/btcboost/copernicus/net/dandelion"
 	"github.com/btcboost/copernicus/net/msg"
 	"github.com/btcboost/copernicus/net/network"
 	"github.com/btcboost/copernicus/net/protocol"
+	"github.com/btcboost/copernicus/policy"
+	"github.com/btcboost/copernicus/utils"
 )
 
 const (
 	DefaultServices         = protocol.SFNodeNetworkAsFullNode | protocol.SFNodeBloomFilter
 	DefaultRequiredServices = protocol.SFNodeNetworkAsFullNode
+
+	// AvgFeeFilterBroadcastInterval average delay between feefilter broadcasts
+	AvgFeeFilterBroadcastInterval = 10 * time.Minute
+	// MaxFeeFilterChangeDelay maximum feefilter broadcast delay after a
+	// significant change of the mempool minimum fee
+	MaxFeeFilterChangeDelay = 5 * time.Minute
+	// FeeFilterTickInterval how often the peers' feefilter schedule is checked
+	FeeFilterTickInterval = 5 * time.Second
 )
 
 type PeerManager struct {
 	bytesReceived uint64
 	bytesSend     uint64
+	evictionStats EvictionStats
 	started       int32
 	shutdown      int32
 	shutdownSched int32
@@ -34,6 +52,8 @@ type PeerManager struct {
 	chainParams          *msg.BitcoinParams
 	netAddressManager    *network.NetAddressManager
 	connectManager       *conn.ConnectManager
+	banManager           *BanManager
+	whitelist            []*WhitelistEntry
 	BlockManager         *BlockManager
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *ServerPeer
@@ -51,6 +71,21 @@ type PeerManager struct {
 	//  storage      boltdb.DBBase
 	timeSource   *blockchain.MedianTime
 	servicesFlag protocol.ServiceFlag
+	// feeFilterRounder rounds the feefilter sent to peers, which avoids
+	// leaking the exact mempool minimum fee; only used by peerHandler.
+	feeFilterRounder *utils.FeeFilterRounder
+	// evictionKey keys the hashes of the network groups protected from
+	// eviction.
+	evictionKey [32]byte
+	// uploadTarget keeps the bytes sent under -maxuploadtarget.
+	uploadTarget *uploadTarget
+	// dandelion routes the stem transactions, it is nil unless -dandelion
+	// is set; stemTxs are the stem transactions relayed by the node.
+	dandelion *dandelion.Router
+	stemTxs   *stemPool
+	// txPools accepts the transactions relayed by the peers and submitted
+	// to the node.
+	txPools txPools
 
 	// txIndex   *indexers.TxIndex
 	// addrIndex *indexers.AddrIndex
@@ -61,17 +96,72 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
-func NewPeerManager(listenAddrs []string, db database.DBWrapper, bitcoinParam *msg.BitcoinParams) (*PeerManager, error) {
+type getPeersMsg struct {
+	reply chan []*ServerPeer
+}
+
+type getPeerByID struct {
+	id    int32
+	reply chan *ServerPeer
+}
+
+type disconnectSubnet struct {
+	subnet *net.IPNet
+}
+
+// NewPeerManager returns a peer manager listening on listenAddrs, which keeps
+// the banned subnets in the peer database db.
+func NewPeerManager(listenAddrs []string, db *database.DBWrapper, bitcoinParam *msg.BitcoinParams) (*PeerManager, error) {
 	services := DefaultServices
 	if conf.AppConf.NoPeerBloomFilters {
 		services &^= protocol.SFNodeBloomFilter
 	}
+	if conf.AppConf.Dandelion {
+		services |= protocol.SFNodeDandelion
+	}
+	whitelist := make([]*WhitelistEntry, 0, len(conf.AppConf.Whitelists))
+	var noBan []*net.IPNet
+	for _, str := range conf.AppConf.Whitelists {
+		entry, err := ParseWhitelist(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid whitelist %s: %v", str, err)
+		}
+		whitelist = append(whitelist, entry)
+		if entry.Flags.Has(PFNoBan) {
+			noBan = append(noBan, entry.Subnet)
+		}
+	}
+	whitebinds := make([]*WhitebindEntry, 0, len(conf.AppConf.Whitebinds))
+	for _, str := range conf.AppConf.Whitebinds {
+		entry, err := ParseWhitebind(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid whitebind %s: %v", str, err)
+		}
+		whitebinds = append(whitebinds, entry)
+	}
+	banManager, err := NewBanManager(db, noBan, conf.AppConf.BanDuration)
+	if err != nil {
+		return nil, err
+	}
 	netAddressManager := network.NewNetAddressManager(conf.AppConf.DataDir, conf.AppLookup)
-	var listeners []net.Listener
+	if conf.AppConf.ASMap != "" {
+		asMap, err := network.LoadASMap(conf.AppConf.ASMap)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the asmap: %v", err)
+		}
+		netAddressManager.SetASMap(asMap)
+		logs.Info("Using asmap %s to group the peers", conf.AppConf.ASMap)
+	}
+	listeners, err := initListeners(listenAddrs, whitebinds)
+	if err != nil {
+		return nil, err
+	}
 	var natListener network.NATInterface
 	peerManager := PeerManager{
 		chainParams:          bitcoinParam,
 		netAddressManager:    netAddressManager,
+		banManager:           banManager,
+		whitelist:            whitelist,
 		newPeers:             make(chan *ServerPeer, conf.AppConf.MaxPeers),
 		donePeers:            make(chan *ServerPeer, conf.AppConf.MaxPeers),
 		banPeers:             make(chan *ServerPeer, conf.AppConf.MaxPeers),
@@ -83,14 +173,27 @@ func NewPeerManager(listenAddrs []string, db database.DBWrapper, bitcoinParam *m
 		peerHeightsUpdate:    make(chan UpdatePeerHeightsMessage),
 		nat:                  natListener,
 		// storage:              db, todo:
-		timeSource:   blockchain.NewMedianTime(),
-		servicesFlag: protocol.ServiceFlag(services),
+		timeSource:       blockchain.NewMedianTime(),
+		servicesFlag:     protocol.ServiceFlag(services),
+		feeFilterRounder: utils.NewFeeFilterRounder(blockchain.GMinRelayTxFee, false),
+		uploadTarget:     newUploadTarget(conf.AppConf.MaxUploadTarget * 1024 * 1024),
+		stemTxs:          newStemPool(),
+	}
+	peerManager.txPools = &chainTxPools{chainParams: bitcoinParam, misbehaving: peerManager.Misbehaving}
+	if conf.AppConf.Dandelion {
+		peerManager.dandelion = dandelion.NewRouter(dandelion.EpochDuration, dandelion.FluffProbability)
+	}
+	if _, err := io.ReadFull(crand.Reader, peerManager.evictionKey[:]); err != nil {
+		return nil, err
 	}
 
 	connectListener := conn.ConnectListener{
 		Listeners:     listeners,
-		Dial:          conf.AppDial,
+		OnAccept:      peerManager.inboundPeerConnected,
+		OnConnection:  peerManager.outboundPeerConnected,
+		Dial:          peerManager.dial,
 		GetNewAddress: peerManager.newAddressFunc,
+		Anchors:       readAnchors(),
 	}
 
 	connectManager, err := conn.NewConnectManager(&connectListener)
@@ -101,22 +204,195 @@ func NewPeerManager(listenAddrs []string, db database.DBWrapper, bitcoinParam *m
 	return &peerManager, nil
 
 }
+
+// readAnchors returns the addresses of the anchors file, which is removed so
+// that the anchors aren't reused after a crash.
+func readAnchors() []net.Addr {
+	path := filepath.Join(conf.AppConf.DataDir, network.AnchorsFileName)
+	addresses, err := network.ReadAnchors(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logs.Warn("Can't read the anchors from %s: %v", path, err)
+		}
+		return nil
+	}
+	anchors := make([]net.Addr, 0, len(addresses))
+	for _, address := range addresses {
+		anchors = append(anchors, &net.TCPAddr{IP: address.IP, Port: int(address.Port)})
+	}
+	logs.Info("Loaded %d anchors from %s", len(anchors), path)
+	return anchors
+}
+
+// writeAnchors saves the addresses of the block-relay-only peers to the
+// anchors file, they are connected to first on the next start.
+func (peerManager *PeerManager) writeAnchors(peerState *PeerState) {
+	var addresses []*network.PeerAddress
+	for _, serverPeer := range peerState.outboundPeers {
+		if serverPeer.Connected() && serverPeer.isBlockRelayOnly() && serverPeer.PeerAddress != nil {
+			addresses = append(addresses, serverPeer.PeerAddress)
+		}
+	}
+	path := filepath.Join(conf.AppConf.DataDir, network.AnchorsFileName)
+	if err := network.WriteAnchors(path, addresses); err != nil {
+		logs.Warn("Can't write the anchors to %s: %v", path, err)
+		return
+	}
+	logs.Debug("Saved %d anchors to %s", len(addresses), path)
+}
+
+// initListeners listens on the addresses peers connect to and on the
+// whitebinds, whose peers are given the permissions of the whitebind.
+// Addresses which can't be listened on are skipped.
+func initListeners(listenAddrs []string, whitebinds []*WhitebindEntry) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(listenAddrs)+len(whitebinds))
+	for _, addr := range listenAddrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			logs.Warn("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, whitebind := range whitebinds {
+		listener, err := net.Listen("tcp", whitebind.Address)
+		if err != nil {
+			logs.Warn("Can't listen on whitebind %s: %v", whitebind.Address, err)
+			continue
+		}
+		listeners = append(listeners, &permissionListener{Listener: listener, flags: whitebind.Flags})
+	}
+	if len(listenAddrs)+len(whitebinds) > 0 && len(listeners) == 0 {
+		return nil, errors.New("no valid listen address")
+	}
+	return listeners, nil
+}
+
+// newPeerConfig returns the configuration of the peer of serverPeer, which
+// handles the messages of the peer.
+func (peerManager *PeerManager) newPeerConfig(serverPeer *ServerPeer) *PeerConfig {
+	return &PeerConfig{
+		Listener: MessageListener{
+			OnRead:        serverPeer.OnRead,
+			OnWrite:       serverPeer.OnWrite,
+			OnVersion:     serverPeer.OnVersion,
+			OnGetAddr:     serverPeer.OnGetAddr,
+			OnAddr:        serverPeer.OnAddr,
+			OnPing:        serverPeer.OnPing,
+			OnPong:        serverPeer.OnPong,
+			OnAlert:       serverPeer.OnAlert,
+			OnMemPool:     serverPeer.OnMemPool,
+			OnTx:          serverPeer.OnTx,
+			OnBlock:       serverPeer.OnBlock,
+			OnInv:         serverPeer.OnInv,
+			OnHeaders:     serverPeer.OnHeaders,
+			OnNotFound:    serverPeer.OnNotFound,
+			OnGetData:     serverPeer.OnGetData,
+			OnGetBlocks:   serverPeer.OnGetBlocks,
+			OnGetHeaders:  serverPeer.OnGetHeaders,
+			OnFilterAdd:   serverPeer.OnFilterAdd,
+			OnFilterClear: serverPeer.OnFilterClear,
+			OnFilterLoad:  serverPeer.OnFilterLoad,
+			OnMerkleBlock: serverPeer.OnMerkleBlock,
+			OnVerAck:      serverPeer.OnVerAck,
+			OnReject:      serverPeer.OnReject,
+			OnSendHeaders: serverPeer.OnSendHeaders,
+			OnFeeFilter:   serverPeer.OnFeeFilter,
+		},
+		HostToAddressFunc: peerManager.netAddressManager.HostToNetAddress,
+		BestAddress:       peerManager.netAddressManager.GetBestLocalAddress,
+		Proxy:             conf.AppConf.Proxy,
+		UserAgent:         "Copernicus",
+		UserAgentVersion:  protocol.Copernicus,
+		UserAgentComments: conf.AppConf.UserAgentComments,
+		ServicesFlag:      peerManager.servicesFlag,
+		DisableRelayTx:    conf.AppConf.BlocksOnly || serverPeer.isBlockRelayOnly(),
+		ChainParams:       peerManager.chainParams,
+		OrderTxInventory:  orderTxInventory,
+	}
+}
+
+// inboundPeerConnected is invoked by the connection manager when a peer
+// connects to us, the connections of banned addresses are closed right away
+// unless they have the noban permission.
+func (peerManager *PeerManager) inboundPeerConnected(conn net.Conn) {
+	permissions := peerManager.connPermissions(conn)
+	if !permissions.Has(PFNoBan) && peerManager.banManager.IsBanned(hostIP(conn.RemoteAddr().String())) {
+		logs.Debug("Rejecting the connection of banned %s", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	serverPeer := NewServerPeer(peerManager, false)
+	serverPeer.permissions = permissions
+	serverPeer.Peer = NewInboundPeer(peerManager.newPeerConfig(serverPeer))
+	serverPeer.Connect(conn)
+	peerManager.AddPeer(serverPeer)
+}
+
+// outboundPeerConnected is invoked by the connection manager when a
+// connection it dialed is established.
+func (peerManager *PeerManager) outboundPeerConnected(connectRequest *conn.ConnectRequest, netConn net.Conn) {
+	serverPeer := NewServerPeer(peerManager, connectRequest.Permanent)
+	serverPeer.connectRequest = connectRequest
+	peer, err := NewOutboundPeer(peerManager.newPeerConfig(serverPeer), connectRequest.Address.String())
+	if err != nil {
+		logs.Debug("Cannot create outbound p2p %s: %v", connectRequest.Address, err)
+		peerManager.connectManager.Disconnect(connectRequest.ID())
+		return
+	}
+	serverPeer.Peer = peer
+	serverPeer.Connect(netConn)
+	peerManager.AddPeer(serverPeer)
+}
+
+// dial connects to an outbound peer unless its address is banned.  The
+// attempt is recorded first, so that an address which can't be connected to
+// is tried less often.
+func (peerManager *PeerManager) dial(addr net.Addr) (net.Conn, error) {
+	if peerManager.banManager.IsBanned(hostIP(addr.String())) {
+		return nil, fmt.Errorf("%s is banned", addr)
+	}
+	if address, err := network.NewPeerAddressWithNetAddr(addr, 0); err == nil {
+		peerManager.netAddressManager.Attempt(address)
+	}
+	return conf.AppDial(addr)
+}
+
+// OutboundGroupCount returns the number of outbound peers in the network
+// group key, as returned by the GroupKey of the address manager.
 func (peerManager *PeerManager) OutboundGroupCount(key string) int {
 	replyChan := make(chan int)
 	peerManager.query <- getOutboundGroup{key: key, reply: replyChan}
 	return <-replyChan
 }
 
-func (peerManager *PeerManager) newAddressFunc() (net.Addr, error) {
+// newAddressFunc returns the address of a new outbound connection of the
+// type.  Feelers test the addresses of the new table, the other connections
+// are made to any known address.
+func (peerManager *PeerManager) newAddressFunc(connType conn.ConnectionType) (net.Addr, error) {
 	for tries := 0; tries < 100; tries++ {
-		address := peerManager.netAddressManager.GetAddress()
+		var address *network.KnownAddress
+		if connType == conn.Feeler {
+			address = peerManager.netAddressManager.GetNewTableAddress()
+		} else {
+			address = peerManager.netAddressManager.GetAddress()
+		}
 
 		logs.Debug(" newAddressFunc ")
 		if address == nil {
 			logs.Debug(" newAddressFunc address is nil")
 			break
 		}
-		key := peerManager.netAddressManager.GetAddress().NetAddress.NetAddressKey()
+		if peerManager.banManager.IsBanned(address.NetAddress.IP) {
+			continue
+		}
+		// The hidden services are only reachable through tor.
+		if address.NetAddress.IsOnionCatTor() && !conf.AppConf.OnionReachable() {
+			continue
+		}
+		// Only one outbound peer per network group, so that a single
+		// network or AS can't take all the outbound slots.
+		key := peerManager.netAddressManager.GroupKey(address.NetAddress)
 		if peerManager.OutboundGroupCount(key) != 0 {
 			logs.Debug("peerManager OutboundGroupCount :%s", key)
 			continue
@@ -129,7 +405,7 @@ func (peerManager *PeerManager) newAddressFunc() (net.Addr, error) {
 		// if tries < 50 && port != msg.ActiveNetParams.DefaultPort {
 		// 	continue
 		// }
-		addressString := peerManager.netAddressManager.GetAddress().NetAddress.NetAddressKey()
+		addressString := address.NetAddress.NetAddressKey()
 		logs.Debug("get address :%s", addressString)
 		return addrStringToNetAddr(addressString)
 
@@ -158,14 +434,13 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 
 	// Tor addresses cannot be resolved to an IP, so just return an onion
 	// address instead.
-	// if strings.HasSuffix(host, ".onion") {
-	// 	if cfg.NoOnion {
-	// 		return nil, errors.New("tor has been disabled")
-	// 	}
-	//
-	// 	return &onionAddr{addr: addr}, nil
-	// }
-	//
+	if network.IsOnionHost(host) {
+		if conf.AppConf.NoOnion {
+			return nil, errors.New("tor has been disabled")
+		}
+		return &onionAddr{addr: addr}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
 	ips, err := conf.AppLookup(host)
 	if err != nil {
@@ -181,14 +456,153 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 	}, nil
 }
 
+// onionAddr is the address of a tor hidden service, which is dialed
+// through the onion proxy rather than resolved.
+type onionAddr struct {
+	addr string
+}
+
+// String returns the onion address.
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) String() string {
+	return oa.addr
+}
+
+// Network returns "onion".
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) Network() string {
+	return "onion"
+}
+
+// Ensure onionAddr implements the net.Addr interface.
+var _ net.Addr = (*onionAddr)(nil)
+
 func (peerManager *PeerManager) BanPeer(serverPeer *ServerPeer) {
 	peerManager.banPeers <- serverPeer
 }
 
+// Ban bans subnet until banUntil and disconnects the peers in it.
+func (peerManager *PeerManager) Ban(subnet *net.IPNet, banUntil time.Time) error {
+	if err := peerManager.banManager.BanUntil(subnet, banUntil, BanReasonManuallyAdded); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&peerManager.started) == 0 {
+		return nil
+	}
+	select {
+	case peerManager.query <- disconnectSubnet{subnet: subnet}:
+	case <-peerManager.quit:
+	}
+	return nil
+}
+
+// Unban lifts the ban of subnet.
+func (peerManager *PeerManager) Unban(subnet *net.IPNet) error {
+	return peerManager.banManager.Unban(subnet)
+}
+
+// IsSubnetBanned returns whether subnet itself is banned.
+func (peerManager *PeerManager) IsSubnetBanned(subnet *net.IPNet) bool {
+	return peerManager.banManager.IsSubnetBanned(subnet)
+}
+
+// ListBanned returns the current bans.
+func (peerManager *PeerManager) ListBanned() []*BanEntry {
+	return peerManager.banManager.List()
+}
+
+// ClearBanned lifts all the bans.
+func (peerManager *PeerManager) ClearBanned() error {
+	return peerManager.banManager.Clear()
+}
+
+// ConnectedPeers returns the peers currently connected, none before the peer
+// manager is started.
+func (peerManager *PeerManager) ConnectedPeers() []*ServerPeer {
+	if atomic.LoadInt32(&peerManager.started) == 0 {
+		return nil
+	}
+	replyChan := make(chan []*ServerPeer)
+	select {
+	case peerManager.query <- getPeersMsg{reply: replyChan}:
+	case <-peerManager.quit:
+		return nil
+	}
+	return <-replyChan
+}
+
+// MappedAS returns the AS announcing the address according to the asmap, or
+// 0 without asmap or when it doesn't map the address.
+func (peerManager *PeerManager) MappedAS(peerAddress *network.PeerAddress) uint32 {
+	return peerManager.netAddressManager.MappedAS(peerAddress)
+}
+
+// NodeAddresses returns a random selection of the known addresses, as sent
+// to the peers asking for addresses.
+func (peerManager *PeerManager) NodeAddresses() []*network.PeerAddress {
+	return peerManager.netAddressManager.AddressCache()
+}
+
+// AddPeerAddress adds an address to the address table, as tried when tried is
+// set, and returns whether it is in the table.
+func (peerManager *PeerManager) AddPeerAddress(peerAddress *network.PeerAddress, tried bool) bool {
+	return peerManager.netAddressManager.AddPeerAddress(peerAddress, tried)
+}
+
 func (peerManager *PeerManager) AddPeer(serverPeer *ServerPeer) {
 	peerManager.newPeers <- serverPeer
 }
 
+// Misbehaving increase the ban score of the peer identified by tag, it is
+// the hook called when a transaction relayed by that peer turns out invalid,
+// including orphans which are validated long after they were received.
+func (peerManager *PeerManager) Misbehaving(tag int64, howMuch int, reason string) {
+	serverPeer := peerManager.peerByID(int32(tag))
+	if serverPeer == nil {
+		return
+	}
+	serverPeer.addBanScore(uint32(howMuch), 0, reason)
+}
+
+// peerByID returns the connected peer identified by id, or nil.  It must not
+// be called from peerHandler.
+func (peerManager *PeerManager) peerByID(id int32) *ServerPeer {
+	replyChan := make(chan *ServerPeer)
+	select {
+	case peerManager.query <- getPeerByID{id: id, reply: replyChan}:
+	case <-peerManager.quit:
+		return nil
+	}
+	return <-replyChan
+}
+
+// RelayTransactions announce the transactions newly accepted into memPool
+// to all connected peers.  Nothing is announced once the peer manager is
+// stopped.
+func (peerManager *PeerManager) RelayTransactions(txs []*core.Tx) {
+	for _, tx := range txs {
+		select {
+		case peerManager.relayInventory <- txRelayMessage(tx):
+		case <-peerManager.quit:
+			return
+		}
+	}
+}
+
+// txRelayMessage returns the relay message announcing a transaction of the
+// memPool.
+func txRelayMessage(tx *core.Tx) RelayMessage {
+	hash := tx.TxHash()
+	inventoryVector := msg.NewInventoryVecror(msg.InventoryTypeTx, &hash)
+	var data interface{} = tx
+	if entry := blockchain.GMemPool.FindEntry(hash); entry != nil {
+		data = entry
+	}
+	return RelayMessage{InventoryVector: inventoryVector, Data: data}
+}
+
 func (peerManager *PeerManager) Stop() error {
 	if atomic.AddInt32(&peerManager.shutdown, 1) != 1 {
 		logs.Info("PeerManager is already in the process of shutting down")
@@ -207,6 +621,9 @@ func (peerManager *PeerManager) Start() {
 		return
 	}
 	logs.Trace("starting server")
+	// The orphans a new block lets into the memPool came from no peer, they
+	// are announced like the transactions submitted to the node.
+	blockchain.SubscribeOrphansAccepted(peerManager.RelayTransactions)
 	peerManager.waitGroup.Add(1)
 	go peerManager.peerHandler()
 	if peerManager.nat != nil {
@@ -218,6 +635,7 @@ func (peerManager *PeerManager) Start() {
 }
 
 func (peerManager *PeerManager) peerHandler() {
+	defer peerManager.waitGroup.Done()
 	peerManager.netAddressManager.Start()
 	peerManager.BlockManager.Start()
 	logs.Trace("Starting p2p handler")
@@ -225,7 +643,6 @@ func (peerManager *PeerManager) peerHandler() {
 		inboundPeers:    make(map[int32]*ServerPeer),
 		persistentPeers: make(map[int32]*ServerPeer),
 		outboundPeers:   make(map[int32]*ServerPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 	if !conf.AppConf.DisableDNSSeed {
@@ -237,12 +654,29 @@ func (peerManager *PeerManager) peerHandler() {
 	}
 	go peerManager.connectManager.Start()
 
+	feeFilterTicker := time.NewTicker(FeeFilterTickInterval)
+	defer feeFilterTicker.Stop()
+	embargoTicker := time.NewTicker(EmbargoTickInterval)
+	defer embargoTicker.Stop()
 out:
 	for {
 		select {
 		case peer := <-peerManager.newPeers:
 			peerManager.handleAddPeerMsg(peerState, peer)
+		case peer := <-peerManager.donePeers:
+			peerManager.handleDonePeerMsg(peerState, peer)
+		case peer := <-peerManager.banPeers:
+			peerManager.handleBanPeerMsg(peerState, peer)
+		case relayMessage := <-peerManager.relayInventory:
+			peerManager.handleRelayInventoryMsg(peerState, relayMessage)
+		case queryMessage := <-peerManager.query:
+			peerManager.handleQuery(peerState, queryMessage)
+		case <-feeFilterTicker.C:
+			peerManager.handleFeeFilterTick(peerState)
+		case <-embargoTicker.C:
+			peerManager.handleEmbargoTick(peerState)
 		case <-peerManager.quit:
+			peerManager.writeAnchors(peerState)
 			peerState.forAllPeers(func(serverPeer *ServerPeer) {
 				logs.Trace("Shutdown p2p %s", serverPeer)
 				serverPeer.Disconnect()
@@ -276,22 +710,18 @@ func (peerManager *PeerManager) handleAddPeerMsg(peerState *PeerState, serverPee
 		serverPeer.Disconnect()
 		return false
 	}
-	if banEnd, ok := peerState.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			logs.Debug("Peer %s is banned for another %s - disconnecting",
-				host, banEnd.String())
-			serverPeer.Disconnect()
-			return false
-		}
-
-		logs.Info("Peer %s is no longer banned", host)
-		delete(peerState.banned, host)
+	if !serverPeer.HasPermission(PFNoBan) && peerManager.banManager.IsBanned(net.ParseIP(host)) {
+		logs.Debug("Peer %s is banned - disconnecting", host)
+		serverPeer.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if peerState.Count() >= conf.AppConf.MaxPeers {
+	// Limit max number of total peers, a new inbound peer takes the slot
+	// of an inbound peer evicted for it when there is one.
+	if peerState.Count() >= conf.AppConf.MaxPeers &&
+		!(serverPeer.Inbound && peerManager.evictInboundPeer(peerState, serverPeer)) {
 		logs.Info("Max peers reached [%d] - disconnecting p2p %s",
 			conf.AppConf.MaxPeers, serverPeer)
 		serverPeer.Disconnect()
@@ -305,23 +735,158 @@ func (peerManager *PeerManager) handleAddPeerMsg(peerState *PeerState, serverPee
 	if serverPeer.Inbound {
 		peerState.inboundPeers[serverPeer.ID] = serverPeer
 	} else {
-		peerState.outboundGroups[serverPeer.PeerAddress.GroupKey()]++
+		peerState.outboundGroups[peerManager.netAddressManager.GroupKey(serverPeer.PeerAddress)]++
 		if serverPeer.persistent {
 			peerState.persistentPeers[serverPeer.ID] = serverPeer
 		} else {
 			peerState.outboundPeers[serverPeer.ID] = serverPeer
 		}
 	}
+	go peerManager.peerDoneHandler(serverPeer)
 
 	return true
 }
-func (peerManager *PeerManager) upnpUpdateThread() {
 
+// handleBanPeerMsg bans the address of a misbehaving peer for the ban
+// duration, unless it has the noban permission.
+func (peerManager *PeerManager) handleBanPeerMsg(peerState *PeerState, serverPeer *ServerPeer) {
+	ip := hostIP(serverPeer.AddressString)
+	if ip == nil {
+		logs.Debug("can't ban p2p %s without an IP address", serverPeer)
+		return
+	}
+	if serverPeer.HasPermission(PFNoBan) || peerManager.banManager.IsWhitelisted(ip) {
+		logs.Debug("not banning whitelisted p2p %s", serverPeer)
+		return
+	}
+	subnet, err := ParseSubnet(ip.String())
+	if err != nil {
+		logs.Error("can't ban p2p %s: %v", serverPeer, err)
+		return
+	}
+	if err := peerManager.banManager.Ban(subnet, BanReasonNodeMisbehaving); err != nil {
+		logs.Error("can't ban p2p %s: %v", serverPeer, err)
+	}
+}
+
+func (peerManager *PeerManager) peerDoneHandler(serverPeer *ServerPeer) {
+	serverPeer.WaitForDisconnect()
+	select {
+	case peerManager.donePeers <- serverPeer:
+	case <-peerManager.quit:
+	}
 }
 
-// func (s *PeerManager) inboundPeerConnected(conn net.Conn) {
-// 	sp := NewServerPeer(s, false)
-// 	sp.Peer = p2p.NewInboundPeer(InitPe(sp))
-// 	sp.AssociateConnection(conn)
-// 	go s.peerDoneHandler(sp)
-// }
+func (peerManager *PeerManager) handleDonePeerMsg(peerState *PeerState, serverPeer *ServerPeer) {
+	peerManager.removePeer(peerState, serverPeer)
+	if peerManager.dandelion != nil {
+		peerManager.dandelion.RemovePeer(serverPeer.ID)
+	}
+
+	// Let the connection manager replace the outbound connection.
+	if serverPeer.connectRequest != nil {
+		go peerManager.connectManager.Disconnect(serverPeer.connectRequest.ID())
+	}
+
+	// The orphans of a disconnected peer are dropped, their parents are
+	// unlikely to be sent by anybody else.
+	removed := blockchain.GOrphanPool.RemoveOrphansByTag(int64(serverPeer.ID))
+	if removed > 0 {
+		logs.Debug("removed %d orphans of p2p %s", removed, serverPeer)
+	}
+}
+
+// removePeer removes the peer from peerState, it does nothing when the peer
+// was removed already.
+func (peerManager *PeerManager) removePeer(peerState *PeerState, serverPeer *ServerPeer) {
+	var list map[int32]*ServerPeer
+	if serverPeer.persistent {
+		list = peerState.persistentPeers
+	} else if serverPeer.Inbound {
+		list = peerState.inboundPeers
+	} else {
+		list = peerState.outboundPeers
+	}
+	if _, ok := list[serverPeer.ID]; ok {
+		if !serverPeer.Inbound && serverPeer.PeerAddress != nil {
+			peerState.outboundGroups[peerManager.netAddressManager.GroupKey(serverPeer.PeerAddress)]--
+		}
+		delete(list, serverPeer.ID)
+		logs.Debug("Removed p2p %s", serverPeer)
+	}
+}
+
+func (peerManager *PeerManager) handleRelayInventoryMsg(peerState *PeerState, relayMessage RelayMessage) {
+	peerState.forAllPeers(func(serverPeer *ServerPeer) {
+		if !serverPeer.Connected() {
+			return
+		}
+		if relayMessage.InventoryVector.Type == msg.InventoryTypeTx {
+			if serverPeer.RelayTxDisabled() {
+				return
+			}
+			// Don't announce the tx whose fee rate is below the peer's
+			// feefilter (BIP133).
+			entry, ok := relayMessage.Data.(*mempool.TxEntry)
+			if ok {
+				feeFilter := serverPeer.FeeFilter()
+				if feeFilter > 0 && entry.GetFeeRate().GetFeePerK() < feeFilter {
+					return
+				}
+			}
+		}
+		serverPeer.QueueInventory(relayMessage.InventoryVector)
+	})
+}
+
+// handleFeeFilterTick send the rounded mempool minimum fee to the peers whose
+// feefilter broadcast is due.
+func (peerManager *PeerManager) handleFeeFilterTick(peerState *PeerState) {
+	if conf.AppConf.NoFeeFilter {
+		return
+	}
+	maxMempool := utils.GetArg("-maxmempool", int64(policy.DefaultMaxMemPoolSize)) * 1000000
+	minFee := blockchain.GMemPool.GetMinFee(maxMempool)
+	currentFilter := minFee.GetFeePerK()
+	now := time.Now()
+	peerState.forAllPeers(func(serverPeer *ServerPeer) {
+		if !serverPeer.Connected() {
+			return
+		}
+		serverPeer.maybeSendFeeFilter(now, currentFilter, peerManager.feeFilterRounder)
+	})
+}
+
+func (peerManager *PeerManager) handleQuery(peerState *PeerState, queryMessage interface{}) {
+	switch message := queryMessage.(type) {
+	case getOutboundGroup:
+		message.reply <- peerState.outboundGroups[message.key]
+	case getPeersMsg:
+		peers := make([]*ServerPeer, 0, peerState.Count())
+		peerState.forAllPeers(func(serverPeer *ServerPeer) {
+			if serverPeer.Connected() {
+				peers = append(peers, serverPeer)
+			}
+		})
+		message.reply <- peers
+	case getPeerByID:
+		var found *ServerPeer
+		peerState.forAllPeers(func(serverPeer *ServerPeer) {
+			if serverPeer.ID == message.id {
+				found = serverPeer
+			}
+		})
+		message.reply <- found
+	case disconnectSubnet:
+		peerState.forAllPeers(func(serverPeer *ServerPeer) {
+			if ip := hostIP(serverPeer.AddressString); ip != nil && message.subnet.Contains(ip) &&
+				!serverPeer.HasPermission(PFNoBan) && !peerManager.banManager.IsWhitelisted(ip) {
+				logs.Info("Disconnecting banned p2p %s", serverPeer)
+				serverPeer.Disconnect()
+			}
+		})
+	}
+}
+func (peerManager *PeerManager) upnpUpdateThread() {
+	defer peerManager.waitGroup.Done()
+}
@@ -1,12 +1,9 @@
 package p2p
 
-import "time"
-
 type PeerState struct {
 	inboundPeers    map[int32]*ServerPeer
 	outboundPeers   map[int32]*ServerPeer
 	persistentPeers map[int32]*ServerPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -0,0 +1,219 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PermissionFlags are the permissions given to the peers of a whitelisted
+// subnet or connecting to a whitebind listener.
+type PermissionFlags uint32
+
+const (
+	// PFNoBan peers are never banned, disconnected for misbehaving or
+	// evicted, it implies PFDownload.
+	PFNoBan PermissionFlags = 1 << iota
+
+	// PFRelay peers may relay transactions even when the node is in
+	// blocksonly mode.
+	PFRelay
+
+	// PFForceRelay peers have their transactions relayed even when they
+	// are already in the mempool, and accepted without the rate limit of
+	// the free transactions.  It implies PFRelay.
+	PFForceRelay
+
+	// PFMempool peers may send the BIP35 mempool message even when bloom
+	// filtering is disabled.
+	PFMempool
+
+	// PFDownload peers may download blocks even when the upload target is
+	// reached.
+	PFDownload
+
+	// PFAddr peers are answered every getaddr message they send, rather
+	// than only the first one.
+	PFAddr
+
+	// PFImplicit are the permissions of a whitelist entry without flags,
+	// which keeps the meaning of whitelists before the flags were added.
+	PFImplicit = PFNoBan | PFMempool | PFRelay | PFDownload
+
+	// PFAll are all the permissions.
+	PFAll = PFNoBan | PFRelay | PFForceRelay | PFMempool | PFDownload | PFAddr
+)
+
+// permissionNames are the names of the permissions, in the order they are
+// shown.
+var permissionNames = []struct {
+	flag PermissionFlags
+	name string
+}{
+	{PFNoBan, "noban"},
+	{PFRelay, "relay"},
+	{PFForceRelay, "forcerelay"},
+	{PFMempool, "mempool"},
+	{PFDownload, "download"},
+	{PFAddr, "addr"},
+}
+
+// Has returns whether all the permissions of flag are given.
+func (flags PermissionFlags) Has(flag PermissionFlags) bool {
+	return flags&flag == flag
+}
+
+// Strings returns the names of the permissions, as shown by getpeerinfo.
+func (flags PermissionFlags) Strings() []string {
+	names := make([]string, 0, len(permissionNames))
+	for _, permission := range permissionNames {
+		if flags.Has(permission.flag) {
+			names = append(names, permission.name)
+		}
+	}
+	return names
+}
+
+func (flags PermissionFlags) String() string {
+	return strings.Join(flags.Strings(), ",")
+}
+
+// parsePermissionFlags parses a comma separated list of permission names, in
+// which "all" stands for all the permissions.
+func parsePermissionFlags(str string) (PermissionFlags, error) {
+	var flags PermissionFlags
+	for _, name := range strings.Split(str, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			flags |= PFAll
+			continue
+		}
+		found := false
+		for _, permission := range permissionNames {
+			if permission.name == name {
+				flags |= permission.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown permission %q", name)
+		}
+	}
+	if flags.Has(PFNoBan) {
+		flags |= PFDownload
+	}
+	if flags.Has(PFForceRelay) {
+		flags |= PFRelay
+	}
+	return flags, nil
+}
+
+// splitPermissions splits a string of the form [<permissions>@]<value> into
+// its permissions and its value, ok is false when there are no permissions.
+func splitPermissions(str string) (flags PermissionFlags, value string, ok bool, err error) {
+	i := strings.LastIndex(str, "@")
+	if i < 0 {
+		return 0, str, false, nil
+	}
+	flags, err = parsePermissionFlags(str[:i])
+	if err != nil {
+		return 0, "", false, err
+	}
+	return flags, str[i+1:], true, nil
+}
+
+// WhitelistEntry gives permissions to the peers connecting from a subnet.
+type WhitelistEntry struct {
+	Subnet *net.IPNet
+	Flags  PermissionFlags
+}
+
+// ParseWhitelist parses a whitelist of the form [<permissions>@]<subnet>, such
+// as relay,noban@10.0.0.0/8.  A whitelist without permissions is given
+// PFImplicit.
+func ParseWhitelist(str string) (*WhitelistEntry, error) {
+	flags, value, ok, err := splitPermissions(str)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		flags = PFImplicit
+	}
+	subnet, err := ParseSubnet(value)
+	if err != nil {
+		return nil, err
+	}
+	return &WhitelistEntry{Subnet: subnet, Flags: flags}, nil
+}
+
+// WhitebindEntry gives permissions to the peers connecting to a listen
+// address.
+type WhitebindEntry struct {
+	Address string
+	Flags   PermissionFlags
+}
+
+// ParseWhitebind parses a whitebind of the form <permissions>@<host:port>,
+// such as mempool@127.0.0.1:8333.
+func ParseWhitebind(str string) (*WhitebindEntry, error) {
+	flags, value, ok, err := splitPermissions(str)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("whitebind %q has no permissions, use <permissions>@<address>", str)
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		return nil, err
+	}
+	return &WhitebindEntry{Address: value, Flags: flags}, nil
+}
+
+// permissionListener is a listener whose connections carry the permissions
+// of its whitebind.
+type permissionListener struct {
+	net.Listener
+	flags PermissionFlags
+}
+
+// permissionConn is a connection accepted by a permissionListener.
+type permissionConn struct {
+	net.Conn
+	flags PermissionFlags
+}
+
+func (listener *permissionListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &permissionConn{Conn: conn, flags: listener.flags}, nil
+}
+
+// whitelistPermissions returns the permissions of the whitelists ip is in.
+func (peerManager *PeerManager) whitelistPermissions(ip net.IP) PermissionFlags {
+	var flags PermissionFlags
+	if ip == nil {
+		return flags
+	}
+	for _, entry := range peerManager.whitelist {
+		if entry.Subnet.Contains(ip) {
+			flags |= entry.Flags
+		}
+	}
+	return flags
+}
+
+// connPermissions returns the permissions of an inbound connection, those of
+// the whitelists of its address and of the whitebind it was accepted on.
+func (peerManager *PeerManager) connPermissions(conn net.Conn) PermissionFlags {
+	flags := peerManager.whitelistPermissions(hostIP(conn.RemoteAddr().String()))
+	if whitebound, ok := conn.(*permissionConn); ok {
+		flags |= whitebound.flags
+	}
+	return flags
+}
@@ -0,0 +1,204 @@
+package p2p
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPermissionFlagsStrings(t *testing.T) {
+	tests := []struct {
+		flags PermissionFlags
+		names []string
+	}{
+		{0, []string{}},
+		{PFNoBan, []string{"noban"}},
+		{PFAddr | PFRelay, []string{"relay", "addr"}},
+		{PFImplicit, []string{"noban", "relay", "mempool", "download"}},
+		{PFAll, []string{"noban", "relay", "forcerelay", "mempool", "download", "addr"}},
+	}
+	for _, test := range tests {
+		if names := test.flags.Strings(); !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%#x: names %q, want %q", uint32(test.flags), names, test.names)
+		}
+	}
+	if str := (PFForceRelay | PFMempool).String(); str != "forcerelay,mempool" {
+		t.Errorf("permissions shown as %q", str)
+	}
+}
+
+func TestParsePermissionFlags(t *testing.T) {
+	tests := []struct {
+		str   string
+		flags PermissionFlags
+	}{
+		{"", 0},
+		{"relay", PFRelay},
+		{"mempool, addr", PFMempool | PFAddr},
+		{"relay,relay,", PFRelay},
+		{"all", PFAll},
+		{"all,noban", PFAll},
+		// noban implies download and forcerelay implies relay.
+		{"noban", PFNoBan | PFDownload},
+		{"forcerelay", PFForceRelay | PFRelay},
+		{"download", PFDownload},
+	}
+	for _, test := range tests {
+		flags, err := parsePermissionFlags(test.str)
+		if err != nil {
+			t.Errorf("%q: %v", test.str, err)
+			continue
+		}
+		if flags != test.flags {
+			t.Errorf("%q parsed as %s, want %s", test.str, flags, test.flags)
+		}
+	}
+	for _, str := range []string{"bloomfilter", "relay,nobans", "Relay", "relay;mempool"} {
+		if flags, err := parsePermissionFlags(str); err == nil {
+			t.Errorf("%q parsed as %s", str, flags)
+		}
+	}
+}
+
+func TestParseWhitelist(t *testing.T) {
+	tests := []struct {
+		str    string
+		subnet string
+		flags  PermissionFlags
+	}{
+		// A whitelist without permissions keeps the implicit ones.
+		{"10.0.0.0/8", "10.0.0.0/8", PFImplicit},
+		{"1.2.3.4", "1.2.3.4/32", PFImplicit},
+		{"relay,noban@10.1.2.3/16", "10.1.0.0/16", PFRelay | PFNoBan | PFDownload},
+		{"@2001:db8::/32", "2001:db8::/32", 0},
+		{"addr@::1", "::1/128", PFAddr},
+	}
+	for _, test := range tests {
+		entry, err := ParseWhitelist(test.str)
+		if err != nil {
+			t.Errorf("%s: %v", test.str, err)
+			continue
+		}
+		if entry.Subnet.String() != test.subnet || entry.Flags != test.flags {
+			t.Errorf("%s parsed as %s with %s, want %s with %s", test.str, entry.Subnet, entry.Flags,
+				test.subnet, test.flags)
+		}
+	}
+	for _, str := range []string{"", "relay@", "bad@10.0.0.0/8", "10.0.0.0/33", "relay@host.example"} {
+		if entry, err := ParseWhitelist(str); err == nil {
+			t.Errorf("%q parsed as %+v", str, entry)
+		}
+	}
+}
+
+func TestParseWhitebind(t *testing.T) {
+	tests := []struct {
+		str     string
+		address string
+		flags   PermissionFlags
+	}{
+		{"mempool@127.0.0.1:8333", "127.0.0.1:8333", PFMempool},
+		{"noban,addr@[::1]:18333", "[::1]:18333", PFNoBan | PFDownload | PFAddr},
+		{"@:8333", ":8333", 0},
+	}
+	for _, test := range tests {
+		entry, err := ParseWhitebind(test.str)
+		if err != nil {
+			t.Errorf("%s: %v", test.str, err)
+			continue
+		}
+		if entry.Address != test.address || entry.Flags != test.flags {
+			t.Errorf("%s parsed as %s with %s, want %s with %s", test.str, entry.Address, entry.Flags,
+				test.address, test.flags)
+		}
+	}
+	for _, str := range []string{"127.0.0.1:8333", "relay@127.0.0.1", "bad@127.0.0.1:8333"} {
+		if entry, err := ParseWhitebind(str); err == nil {
+			t.Errorf("%q parsed as %+v", str, entry)
+		}
+	}
+}
+
+// testConn is a connection from a remote address.
+type testConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (conn *testConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+func TestConnPermissions(t *testing.T) {
+	var whitelist []*WhitelistEntry
+	for _, str := range []string{"relay@10.0.0.0/8", "mempool@10.1.0.0/16", "::1"} {
+		entry, err := ParseWhitelist(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		whitelist = append(whitelist, entry)
+	}
+	peerManager := &PeerManager{whitelist: whitelist}
+
+	tests := []struct {
+		address   string
+		whitebind PermissionFlags
+		flags     PermissionFlags
+	}{
+		{"1.2.3.4:8333", 0, 0},
+		{"10.2.0.1:8333", 0, PFRelay},
+		// The permissions of all the matching whitelists are given.
+		{"10.1.0.1:8333", 0, PFRelay | PFMempool},
+		{"[::1]:8333", 0, PFImplicit},
+		{"[::ffff:10.2.0.1]:8333", 0, PFRelay},
+		// The whitebind permissions add to those of the whitelists.
+		{"1.2.3.4:8333", PFAddr, PFAddr},
+		{"10.2.0.1:8333", PFNoBan | PFDownload, PFRelay | PFNoBan | PFDownload},
+	}
+	for _, test := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", test.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conn net.Conn = &testConn{remoteAddr: addr}
+		if test.whitebind != 0 {
+			conn = &permissionConn{Conn: conn, flags: test.whitebind}
+		}
+		flags := peerManager.connPermissions(conn)
+		if flags != test.flags {
+			t.Errorf("%s with whitebind %s: permissions %s, want %s", test.address, test.whitebind,
+				flags, test.flags)
+		}
+
+		serverPeer := &ServerPeer{permissions: flags}
+		for _, permission := range permissionNames {
+			if has := serverPeer.HasPermission(permission.flag); has != test.flags.Has(permission.flag) {
+				t.Errorf("%s: has permission %s %v", test.address, permission.name, has)
+			}
+		}
+	}
+	if flags := peerManager.whitelistPermissions(nil); flags != 0 {
+		t.Errorf("permissions %s without an address", flags)
+	}
+}
+
+func TestPermissionFlagsHas(t *testing.T) {
+	flags := PFNoBan | PFDownload | PFRelay
+	tests := []struct {
+		flag PermissionFlags
+		has  bool
+	}{
+		{PFNoBan, true},
+		{PFRelay, true},
+		{PFNoBan | PFRelay, true},
+		{PFMempool, false},
+		{PFRelay | PFMempool, false},
+		{PFImplicit, false},
+		{0, true},
+	}
+	for _, test := range tests {
+		if has := flags.Has(test.flag); has != test.has {
+			t.Errorf("%s has %s: %v, want %v", flags, test.flag, has, test.has)
+		}
+	}
+}
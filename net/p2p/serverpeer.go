@@ -2,12 +2,16 @@ package p2p
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/net/conn"
 
 	"github.com/btcboost/copernicus/conf"
 	"github.com/btcboost/copernicus/container"
+	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/net/network"
 	"github.com/btcboost/copernicus/net/protocol"
 
@@ -17,7 +21,27 @@ import (
 
 type ServerPeer struct {
 	*Peer
-	feeFilter       int64
+	// feeFilter the minimum fee rate of the transactions announced to the
+	// peer, set by the peer's feefilter message; accessed atomically.
+	feeFilter int64
+	// lastTxTime and lastBlockTime are the times, in unix nanoseconds, the
+	// peer last sent us a new transaction and a new block we asked for, which
+	// protects it from eviction; accessed atomically.
+	lastTxTime    int64
+	lastBlockTime int64
+	// lastSentFeeFilter and nextSendFeeFilter schedule the feefilter sent to
+	// the peer, only accessed by the peerHandler goroutine.
+	lastSentFeeFilter int64
+	nextSendFeeFilter time.Time
+
+	// permissions are given to inbound peers by the whitelists and the
+	// whitebinds, they are set before the peer connects.
+	permissions PermissionFlags
+	// sentAddresses is set once the peer was answered a getaddr.
+	sentAddresses bool
+	// messageBytes counts the bytes sent and received by message command.
+	messageBytes *messageBytes
+
 	connectRequest  *conn.ConnectRequest
 	peerManager     *PeerManager
 	persistent      bool
@@ -28,6 +52,9 @@ type ServerPeer struct {
 	requestQueue    []*msg.InventoryVector
 	requestedTxns   map[utils.Hash]struct{}
 	requestedBlocks map[utils.Hash]struct{}
+	// requestedStemTxns are the Dandelion++ stem transactions asked to
+	// the peer, which are relayed along the stem once received.
+	requestedStemTxns map[utils.Hash]struct{}
 	//filter          *bloom.Filter
 	knownAddress   map[string]struct{}
 	banScore       container.DynamicBanScore
@@ -38,12 +65,14 @@ type ServerPeer struct {
 
 func NewServerPeer(peerManager *PeerManager, isPersistent bool) *ServerPeer {
 	serverPeer := ServerPeer{
-		peerManager:     peerManager,
-		persistent:      isPersistent,
-		requestedTxns:   make(map[utils.Hash]struct{}),
-		requestedBlocks: make(map[utils.Hash]struct{}),
+		peerManager:       peerManager,
+		persistent:        isPersistent,
+		requestedTxns:     make(map[utils.Hash]struct{}),
+		requestedBlocks:   make(map[utils.Hash]struct{}),
+		requestedStemTxns: make(map[utils.Hash]struct{}),
 		//	filter:          bloom.LoadFilter(nil),
 		knownAddress:   make(map[string]struct{}),
+		messageBytes:   newMessageBytes(),
 		quit:           make(chan struct{}),
 		txProcessed:    make(chan struct{}, 1),
 		blockProcessed: make(chan struct{}, 1),
@@ -77,9 +106,50 @@ func (serverPeer *ServerPeer) SetDisableRelayTx(disable bool) {
 	serverPeer.disableRelayTx = disable
 }
 
+// HasPermission returns whether the peer was given the permissions of flag.
+func (serverPeer *ServerPeer) HasPermission(flag PermissionFlags) bool {
+	return serverPeer.permissions.Has(flag)
+}
+
+// Permissions returns the permissions of the peer.
+func (serverPeer *ServerPeer) Permissions() PermissionFlags {
+	return serverPeer.permissions
+}
+
+// ConnectionType returns the type of the connection to the peer, as shown by
+// getpeerinfo.
+func (serverPeer *ServerPeer) ConnectionType() string {
+	if serverPeer.Inbound {
+		return "inbound"
+	}
+	if serverPeer.persistent {
+		return conn.Manual.String()
+	}
+	if serverPeer.connectRequest == nil {
+		return conn.OutboundFullRelay.String()
+	}
+	return serverPeer.connectRequest.Type.String()
+}
+
+// isConnectionType returns whether the peer is an outbound peer of the
+// connection type.
+func (serverPeer *ServerPeer) isConnectionType(connType conn.ConnectionType) bool {
+	return !serverPeer.Inbound && serverPeer.connectRequest != nil &&
+		serverPeer.connectRequest.Type == connType
+}
+
+// isBlockRelayOnly returns whether the peer is a block-relay-only peer, to
+// which neither transactions nor addresses are relayed.
+func (serverPeer *ServerPeer) isBlockRelayOnly() bool {
+	return serverPeer.isConnectionType(conn.BlockRelayOnly)
+}
+
 func (serverPeer *ServerPeer) pushAddressMessage(peerAddresses []*network.PeerAddress) {
+	if serverPeer.isBlockRelayOnly() {
+		return
+	}
 	addresses := make([]*network.PeerAddress, 0, len(peerAddresses))
-	for _, address := range addresses {
+	for _, address := range peerAddresses {
 		if !serverPeer.addressKnown(address) {
 			addresses = append(addresses, address)
 		}
@@ -113,6 +183,11 @@ func (serverPeer *ServerPeer) addBanScore(persistent, transient uint32, reason s
 		logs.Warn("misbehaving p2p %s :%s -- ban scote increased to %d",
 			serverPeer, reason, score)
 		if score > conf.AppConf.BanThreshold {
+			if serverPeer.HasPermission(PFNoBan) ||
+				serverPeer.peerManager.banManager.IsWhitelisted(hostIP(serverPeer.AddressString)) {
+				logs.Warn("not banning whitelisted p2p %s", serverPeer)
+				return
+			}
 			logs.Warn("misbehaving p2p %s --banning and isconnecting ", serverPeer)
 			serverPeer.peerManager.BanPeer(serverPeer)
 			serverPeer.Disconnect()
@@ -122,9 +197,22 @@ func (serverPeer *ServerPeer) addBanScore(persistent, transient uint32, reason s
 }
 func (serverPeer *ServerPeer) OnVersion(p *Peer, versionMessage *msg.VersionMessage) {
 	serverPeer.peerManager.timeSource.AddTimeSample(serverPeer.AddressString, versionMessage.Timestamp)
-	serverPeer.peerManager.BlockManager.NewPeer(serverPeer)
-	serverPeer.SetDisableRelayTx(versionMessage.DisableRelayTx)
-	if conf.AppConf.SimNet {
+
+	// A feeler is only made to learn whether the address is reachable.
+	if serverPeer.isConnectionType(conn.Feeler) {
+		logs.Debug("Feeler connection to %s completed, disconnecting", serverPeer)
+		serverPeer.peerManager.netAddressManager.MarkGood(serverPeer.GetNetAddress())
+		serverPeer.Disconnect()
+		return
+	}
+	if blockManager := serverPeer.peerManager.BlockManager; blockManager != nil {
+		blockManager.NewPeer(serverPeer)
+	}
+	serverPeer.SetDisableRelayTx(versionMessage.DisableRelayTx || serverPeer.isBlockRelayOnly())
+	if router := serverPeer.peerManager.dandelion; router != nil && serverPeer.isDandelionCandidate() {
+		router.AddPeer(serverPeer.ID)
+	}
+	if !conf.AppConf.SimNet {
 		netAddressManager := serverPeer.peerManager.netAddressManager
 		if !serverPeer.Inbound {
 			if !conf.AppConf.DisableListen {
@@ -136,25 +224,54 @@ func (serverPeer *ServerPeer) OnVersion(p *Peer, versionMessage *msg.VersionMess
 				}
 			}
 			hatTimestamp := serverPeer.ProtocolVersion >= protocol.PeerAddressTimeVersion
-			if netAddressManager.NeedMoreAddresses() && hatTimestamp {
+			if netAddressManager.NeedMoreAddresses() && hatTimestamp && !serverPeer.isBlockRelayOnly() {
 				serverPeer.SendMessage(msg.NewGetAddressMessage(), nil)
 			}
 			netAddressManager.MarkGood(serverPeer.GetNetAddress())
 		}
 	}
-	serverPeer.peerManager.AddPeer(serverPeer)
-
 }
 
+// OnRead is invoked when a peer reads a message, the bytes read are counted
+// by message command.
 func (serverPeer *ServerPeer) OnRead(p *Peer, bytesRead int, message msg.Message, err error) {
-
+	serverPeer.messageBytes.add(serverPeer.messageBytes.received, message, bytesRead)
+	serverPeer.peerManager.addBytesReceived(bytesRead)
 }
+
+// OnWrite is invoked when a peer writes a message, the bytes written are
+// counted by message command and against the upload target.
 func (serverPeer *ServerPeer) OnWrite(p *Peer, bytesWritten int, message msg.Message, err error) {
+	serverPeer.messageBytes.add(serverPeer.messageBytes.sent, message, bytesWritten)
+	serverPeer.peerManager.addBytesSent(bytesWritten)
+}
 
+// BytesPerMessage returns the bytes sent to and received from the peer, by
+// message command.
+func (serverPeer *ServerPeer) BytesPerMessage() (sent map[string]uint64, received map[string]uint64) {
+	return serverPeer.messageBytes.snapshot()
 }
 
+// OnGetAddr is invoked when a peer receives a getaddr message.  Only inbound
+// peers are answered, once per connection, so that the known addresses can't
+// be used to fingerprint the node; peers with the addr permission are always
+// answered.
 func (serverPeer *ServerPeer) OnGetAddr(p *Peer, msg *msg.GetAddressMessage) {
-
+	if conf.AppConf.SimNet {
+		return
+	}
+	if !serverPeer.HasPermission(PFAddr) {
+		if !serverPeer.Inbound {
+			logs.Debug("Ignoring getaddr request from outbound p2p %v", serverPeer)
+			return
+		}
+		if serverPeer.sentAddresses {
+			logs.Debug("Ignoring repeated getaddr request from p2p %v", serverPeer)
+			return
+		}
+	}
+	serverPeer.sentAddresses = true
+	serverPeer.pushAddressMessage(serverPeer.peerManager.netAddressManager.AddressCache())
 }
 func (serverPeer *ServerPeer) OnAddr(p *Peer, msg *msg.AddressMessage) {
 
@@ -171,13 +288,20 @@ func (serverPeer *ServerPeer) OnAlert(p *Peer, msg *msg.AlertMessage) {
 
 }
 
+// OnMemPool is invoked when a peer receives a BIP35 mempool message, which is
+// only answered when bloom filtering is enabled or the peer has the mempool
+// permission.
 func (serverPeer *ServerPeer) OnMemPool(p *Peer, msg *msg.MempoolMessage) {
-	if serverPeer.peerManager.servicesFlag&protocol.SFNodeBloomFilter != protocol.SFNodeBloomFilter {
-		logs.Debug("p2p %v sent mempool request with bloom filtering disable --disconnecting", serverPeer)
-		serverPeer.Disconnect()
-		return
+	// A peer with the mempool permission may ask for the mempool as often as
+	// it likes.
+	if !serverPeer.HasPermission(PFMempool) {
+		if serverPeer.peerManager.servicesFlag&protocol.SFNodeBloomFilter != protocol.SFNodeBloomFilter {
+			logs.Debug("p2p %v sent mempool request with bloom filtering disable --disconnecting", serverPeer)
+			serverPeer.Disconnect()
+			return
+		}
+		serverPeer.addBanScore(0, 33, "mempool")
 	}
-	serverPeer.addBanScore(0, 33, "mempool")
 	//txMempool :=serverPeer.peerManager.txMemPool
 	//txDescs :=txMempool.TxDescs()
 	//inventoryMessage :=msg.NewInventoryMessageSizeHint(uint(len(txDescs)))
@@ -191,15 +315,151 @@ func (serverPeer *ServerPeer) OnMemPool(p *Peer, msg *msg.MempoolMessage) {
 	//}
 
 }
-func (serverPeer *ServerPeer) OnTx(p *Peer, msg *msg.TxMessage) {
 
+// OnTx is invoked when a peer receives a tx message.  In blocksonly mode the
+// transactions are only accepted from the peers with the relay permission,
+// and those of the peers with the forcerelay permission are relayed even when
+// they are in the mempool already.
+func (serverPeer *ServerPeer) OnTx(p *Peer, txMessage *msg.TxMessage) {
+	if (conf.AppConf.BlocksOnly && !serverPeer.HasPermission(PFRelay)) || serverPeer.isBlockRelayOnly() {
+		logs.Trace("ignoring tx %v from %v - blocksonly enabled", txMessage.Tx.TxHash(), serverPeer)
+		return
+	}
+	tx := txMessage.Tx
+	txHash := tx.TxHash()
+	serverPeer.AddKnownInventory(msg.NewInventoryVecror(msg.InventoryTypeTx, &txHash))
+	delete(serverPeer.requestedTxns, txHash)
+
+	peerManager := serverPeer.peerManager
+	if _, ok := serverPeer.requestedStemTxns[txHash]; ok {
+		delete(serverPeer.requestedStemTxns, txHash)
+		if err := peerManager.stemTransaction(tx, serverPeer.ID); err != nil {
+			logs.Debug("stem tx %s from %s not relayed: %v", txHash.ToString(), serverPeer, err)
+		}
+		return
+	}
+	forceRelay := serverPeer.HasPermission(PFForceRelay)
+	accepted, err := peerManager.txPools.processTransaction(tx, !forceRelay, serverPeer.ID)
+	if err != nil {
+		logs.Debug("tx %s from %s not accepted: %v", txHash.ToString(), serverPeer, err)
+		if forceRelay && blockchain.GMemPool.FindEntry(txHash) != nil {
+			logs.Debug("Force relaying tx %s from p2p %s", txHash.ToString(), serverPeer)
+			peerManager.RelayTransactions([]*core.Tx{tx})
+		}
+		return
+	}
+	if len(accepted) > 0 {
+		atomic.StoreInt64(&serverPeer.lastTxTime, time.Now().UnixNano())
+	}
+	peerManager.RelayTransactions(accepted)
+}
+
+// OnFeeFilter is invoked when a peer receives a feefilter message, the peer
+// doesn't want the announcement of transactions below the fee rate.
+func (serverPeer *ServerPeer) OnFeeFilter(p *Peer, feeFilterMessage *msg.FeeFilterMessage) {
+	if !utils.MoneyRange(feeFilterMessage.MinFee) {
+		logs.Debug("peer %v sent an invalid feefilter '%d' -- disconnecting", serverPeer, feeFilterMessage.MinFee)
+		serverPeer.Disconnect()
+		return
+	}
+	atomic.StoreInt64(&serverPeer.feeFilter, feeFilterMessage.MinFee)
+}
+
+// FeeFilter return the feefilter received from the peer, in satoshi per KB.
+func (serverPeer *ServerPeer) FeeFilter() int64 {
+	return atomic.LoadInt64(&serverPeer.feeFilter)
 }
-func (serverPeer *ServerPeer) OnBlock(p *Peer, msg *msg.BlockMessage, buf []byte) {
 
+// BanScore returns the current ban score of the peer.
+func (serverPeer *ServerPeer) BanScore() uint32 {
+	return serverPeer.banScore.Int()
 }
 
-func (serverPeer *ServerPeer) OnInv(p *Peer, msg *msg.InventoryMessage) {
+// maybeSendFeeFilter send the rounded currentFilter to the peer when the
+// broadcast is due. The broadcast is rescheduled sooner when currentFilter
+// changed a lot since the last sent one.
+func (serverPeer *ServerPeer) maybeSendFeeFilter(now time.Time, currentFilter int64, rounder *utils.FeeFilterRounder) {
+	if serverPeer.ProtocolVersion < protocol.FeeFilterVersion {
+		return
+	}
+
+	if now.After(serverPeer.nextSendFeeFilter) {
+		filterToSend := rounder.Round(currentFilter)
+		// the filter is never below the min relay fee.
+		if filterToSend < blockchain.GMinRelayTxFee.GetFeePerK() {
+			filterToSend = blockchain.GMinRelayTxFee.GetFeePerK()
+		}
+		if filterToSend != serverPeer.lastSentFeeFilter {
+			serverPeer.SendMessage(msg.NewFeeFilterMessage(filterToSend), nil)
+			serverPeer.lastSentFeeFilter = filterToSend
+		}
+		serverPeer.nextSendFeeFilter = PoissonNextSend(now, AvgFeeFilterBroadcastInterval)
+		return
+	}
+
+	lastSent := serverPeer.lastSentFeeFilter
+	if now.Add(MaxFeeFilterChangeDelay).Before(serverPeer.nextSendFeeFilter) &&
+		(currentFilter < 3*lastSent/4 || currentFilter > 4*lastSent/3) {
+		delay := time.Duration(utils.GetRandInt(int(MaxFeeFilterChangeDelay/time.Millisecond))) * time.Millisecond
+		serverPeer.nextSendFeeFilter = now.Add(delay)
+	}
+}
+
+// OnBlock is invoked when a peer receives a block message.  Only the blocks
+// asked for in OnInv are processed, a peer giving us a new block is protected
+// from eviction for a while.
+func (serverPeer *ServerPeer) OnBlock(p *Peer, blockMessage *msg.BlockMessage, buf []byte) {
+	hash, err := blockMessage.Block.BlockHeader.GetHash()
+	if err != nil {
+		return
+	}
+	if _, ok := serverPeer.requestedBlocks[hash]; !ok {
+		logs.Debug("unrequested block %s from %s ignored", hash.ToString(), serverPeer)
+		return
+	}
+	delete(serverPeer.requestedBlocks, hash)
+	serverPeer.AddKnownInventory(msg.NewInventoryVecror(msg.InventoryTypeBlock, &hash))
+
+	var newBlock bool
+	if !blockchain.ProcessNewBlock(serverPeer.peerManager.chainParams, blockMessage.Block, true, &newBlock) {
+		logs.Debug("block %s from %s not accepted", hash.ToString(), serverPeer)
+		return
+	}
+	if newBlock {
+		atomic.StoreInt64(&serverPeer.lastBlockTime, time.Now().UnixNano())
+	}
+}
 
+// OnInv is invoked when a peer receives an inv message, the transactions and
+// blocks it announced are known to it and won't be announced back.  The
+// blocks we don't have are asked for, and with Dandelion, the stem
+// transactions relayed by the peer.
+func (serverPeer *ServerPeer) OnInv(p *Peer, inventoryMessage *msg.InventoryMessage) {
+	getDataMessage := &msg.GetDataMessage{}
+	for _, iv := range inventoryMessage.InventoryList {
+		switch iv.Type {
+		case msg.InventoryTypeTx:
+			serverPeer.AddKnownInventory(iv)
+		case msg.InventoryTypeBlock:
+			serverPeer.AddKnownInventory(iv)
+			if _, ok := serverPeer.requestedBlocks[*iv.Hash]; ok ||
+				blockchain.LookupBlockIndex(iv.Hash) != nil {
+				continue
+			}
+			serverPeer.requestedBlocks[*iv.Hash] = struct{}{}
+			getDataMessage.AddInventoryVector(iv)
+		case msg.InventoryTypeDandelionTx:
+			if serverPeer.peerManager.dandelion == nil || conf.AppConf.BlocksOnly ||
+				blockchain.GMemPool.Exists(*iv.Hash) || blockchain.GStemPool.Exists(*iv.Hash) {
+				continue
+			}
+			serverPeer.requestedStemTxns[*iv.Hash] = struct{}{}
+			getDataMessage.AddInventoryVector(iv)
+		}
+	}
+	if len(getDataMessage.InventoryList) > 0 {
+		serverPeer.SendMessage(getDataMessage, nil)
+	}
 }
 
 func (serverPeer *ServerPeer) OnHeaders(p *Peer, msg *msg.HeadersMessage) {
@@ -209,8 +469,54 @@ func (serverPeer *ServerPeer) OnNotFound(p *Peer, msg *msg.NotFoundMessage) {
 
 }
 
-func (serverPeer *ServerPeer) OnGetData(p *Peer, msg *msg.GetDataMessage) {
+// OnGetData is invoked when a peer receives a getdata message.  Once the
+// upload target is reached, the peers asking for historical blocks are
+// disconnected unless they have the download permission.  The transactions
+// are served from the memPool only, a stem transaction is only served to the
+// peer it was relayed to.
+func (serverPeer *ServerPeer) OnGetData(p *Peer, getDataMessage *msg.GetDataMessage) {
+	notFound := &msg.NotFoundMessage{}
+	for _, iv := range getDataMessage.InventoryList {
+		switch iv.Type {
+		case msg.InventoryTypeTx:
+			if tx := blockchain.GMemPool.FindTx(*iv.Hash); tx != nil {
+				serverPeer.SendMessage(&msg.TxMessage{Tx: tx}, nil)
+			} else {
+				notFound.InventoryList = append(notFound.InventoryList, iv)
+			}
+		case msg.InventoryTypeDandelionTx:
+			if tx := serverPeer.peerManager.stemTxs.relayedTo(*iv.Hash, serverPeer.ID); tx != nil {
+				serverPeer.SendMessage(&msg.TxMessage{Tx: tx}, nil)
+			} else {
+				notFound.InventoryList = append(notFound.InventoryList, iv)
+			}
+		case msg.InventoryTypeBlock, msg.InventoryTypeFilteredBlock:
+			if serverPeer.historicalBlockLimited(iv.Hash) {
+				logs.Info("historical block serving limit reached, disconnecting p2p %s", serverPeer)
+				serverPeer.Disconnect()
+				return
+			}
+			// todo: serve the requested block
+		}
+	}
+	if len(notFound.InventoryList) > 0 {
+		serverPeer.SendMessage(notFound, nil)
+	}
+}
 
+// historicalBlockLimited returns whether the block of hash is a historical
+// block the peer may no longer download because of the upload target.
+func (serverPeer *ServerPeer) historicalBlockLimited(hash *utils.Hash) bool {
+	if serverPeer.HasPermission(PFDownload) ||
+		!serverPeer.peerManager.uploadTarget.historicalBlocksLimited(time.Now()) {
+		return false
+	}
+	blockIndex := blockchain.LookupBlockIndex(hash)
+	bestHeader := blockchain.BestHeader()
+	if blockIndex == nil || bestHeader == nil {
+		return false
+	}
+	return int64(blockIndex.GetBlockTime()) <= int64(bestHeader.GetBlockTime())-int64(historicalBlockAge/time.Second)
 }
 
 func (serverPeer *ServerPeer) OnGetBlocks(p *Peer, msg *msg.GetBlocksMessage) {
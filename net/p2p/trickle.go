@@ -0,0 +1,131 @@
+package p2p
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/protocol"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// The transactions are announced to a peer in batches at the times of a
+// Poisson process, so a spy connected to many peers can't tell from the
+// timing which one a transaction came from first.  The outbound peers, which
+// we picked ourselves, get the transactions sooner than the inbound ones.
+const (
+	// InventoryBroadcastInterval is the average interval between the
+	// transaction announcements to an inbound peer.
+	InventoryBroadcastInterval = 5 * time.Second
+
+	// OutboundInventoryBroadcastInterval is the average interval between
+	// the transaction announcements to an outbound peer.
+	OutboundInventoryBroadcastInterval = 2 * time.Second
+
+	// InventoryBroadcastMax is the most transactions announced in a batch,
+	// 7 transactions per second of InventoryBroadcastInterval, the rest
+	// wait for the next batch.
+	InventoryBroadcastMax = 7 * int(InventoryBroadcastInterval/time.Second)
+)
+
+// inventoryKey identifies an inventory vector in the known inventory of a
+// peer, by value rather than by pointer.
+type inventoryKey struct {
+	invType protocol.InventoryType
+	hash    utils.Hash
+}
+
+func newInventoryKey(iv *msg.InventoryVector) inventoryKey {
+	key := inventoryKey{invType: iv.Type}
+	if iv.Hash != nil {
+		key.hash = *iv.Hash
+	}
+	return key
+}
+
+// AddKnownInventory marks the inventory as known to the peer, it won't be
+// announced to it.
+func (p *Peer) AddKnownInventory(iv *msg.InventoryVector) {
+	p.knownInventory.Add(newInventoryKey(iv), struct{}{})
+}
+
+// isKnownInventory returns whether the inventory is known to the peer.
+func (p *Peer) isKnownInventory(iv *msg.InventoryVector) bool {
+	return p.knownInventory.Exists(newInventoryKey(iv))
+}
+
+// nextInventoryBroadcast returns the delay until the next transaction
+// announcement to the peer.
+func (p *Peer) nextInventoryBroadcast() time.Duration {
+	interval := OutboundInventoryBroadcastInterval
+	if p.Inbound {
+		interval = InventoryBroadcastInterval
+	}
+	now := time.Now()
+	return PoissonNextSend(now, interval).Sub(now)
+}
+
+// nextTxInventory picks the transactions of the next announcement from the
+// queue and returns them with the ones left for later.  The transactions
+// known to the peer are dropped, the others are ordered by OrderTxInventory
+// and at most InventoryBroadcastMax of them are announced.
+func (p *Peer) nextTxInventory(queue []*msg.InventoryVector) ([]*msg.InventoryVector, []*msg.InventoryVector) {
+	pending := make([]*msg.InventoryVector, 0, len(queue))
+	seen := make(map[inventoryKey]struct{}, len(queue))
+	for _, iv := range queue {
+		key := newInventoryKey(iv)
+		if _, ok := seen[key]; ok || p.knownInventory.Exists(key) {
+			continue
+		}
+		seen[key] = struct{}{}
+		pending = append(pending, iv)
+	}
+	if p.Config.OrderTxInventory != nil {
+		pending = p.Config.OrderTxInventory(pending)
+	}
+	if len(pending) <= InventoryBroadcastMax {
+		return pending, nil
+	}
+	return pending[:InventoryBroadcastMax], pending[InventoryBroadcastMax:]
+}
+
+// orderTxInventory orders the transactions to announce so that the parents
+// come before their children, those with fewer ancestors first, and then by
+// decreasing fee rate.  The transactions no longer in the mempool are dropped.
+func orderTxInventory(ivs []*msg.InventoryVector) []*msg.InventoryVector {
+	type txInventory struct {
+		iv        *msg.InventoryVector
+		ancestors int64
+		feePerK   int64
+	}
+	txs := make([]txInventory, 0, len(ivs))
+	for _, iv := range ivs {
+		if iv.Hash == nil {
+			continue
+		}
+		entry := blockchain.GMemPool.FindEntry(*iv.Hash)
+		if entry == nil {
+			continue
+		}
+		txs = append(txs, txInventory{
+			iv:        iv,
+			ancestors: entry.SumTxCountWithAncestors,
+			feePerK:   entry.GetFeeRate().GetFeePerK(),
+		})
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].ancestors != txs[j].ancestors {
+			return txs[i].ancestors < txs[j].ancestors
+		}
+		if txs[i].feePerK != txs[j].feePerK {
+			return txs[i].feePerK > txs[j].feePerK
+		}
+		return txs[i].iv.Hash.Cmp(txs[j].iv.Hash) < 0
+	})
+	ordered := make([]*msg.InventoryVector, len(txs))
+	for i, tx := range txs {
+		ordered[i] = tx.iv
+	}
+	return ordered
+}
@@ -0,0 +1,182 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/protocol"
+	"github.com/btcboost/copernicus/utils"
+)
+
+// testTxInventory returns the inventory vector of the i-th test transaction.
+func testTxInventory(i int) *msg.InventoryVector {
+	var hash utils.Hash
+	hash[0] = byte(i)
+	hash[1] = byte(i >> 8)
+	return msg.NewInventoryVecror(msg.InventoryTypeTx, &hash)
+}
+
+func TestNextInventoryBroadcast(t *testing.T) {
+	const samples = 10000
+	tests := []struct {
+		inbound  bool
+		interval time.Duration
+	}{
+		{false, OutboundInventoryBroadcastInterval},
+		{true, InventoryBroadcastInterval},
+	}
+	for _, test := range tests {
+		peer := newPeer(&PeerConfig{}, test.inbound)
+		var total time.Duration
+		delays := make(map[time.Duration]struct{})
+		for i := 0; i < samples; i++ {
+			delay := peer.nextInventoryBroadcast()
+			if delay < 0 {
+				t.Fatalf("inbound %v: negative delay %v", test.inbound, delay)
+			}
+			total += delay
+			delays[delay] = struct{}{}
+		}
+		// The delays of a Poisson process average to its interval, the
+		// standard deviation of the average is a hundredth of it here.
+		average := total / samples
+		if average < test.interval*9/10 || average > test.interval*11/10 {
+			t.Errorf("inbound %v: average delay %v, want about %v", test.inbound, average, test.interval)
+		}
+		if len(delays) < samples/2 {
+			t.Errorf("inbound %v: %d different delays in %d", test.inbound, len(delays), samples)
+		}
+	}
+}
+
+func TestNextTxInventory(t *testing.T) {
+	peer := newPeer(&PeerConfig{}, true)
+	other := newPeer(&PeerConfig{}, true)
+
+	var queue []*msg.InventoryVector
+	for i := 0; i < 2*InventoryBroadcastMax+10; i++ {
+		queue = append(queue, testTxInventory(i))
+	}
+	// The queued duplicates and the transactions known to the peer are
+	// dropped.
+	queue = append(queue, testTxInventory(0), testTxInventory(1))
+	for i := 0; i < 5; i++ {
+		peer.AddKnownInventory(testTxInventory(i))
+	}
+
+	batch, rest := peer.nextTxInventory(queue)
+	if len(batch) != InventoryBroadcastMax || len(rest) != InventoryBroadcastMax+5 {
+		t.Fatalf("%d transactions announced, %d left, want %d and %d", len(batch), len(rest),
+			InventoryBroadcastMax, InventoryBroadcastMax+5)
+	}
+	if !batch[0].Hash.IsEqual(testTxInventory(5).Hash) {
+		t.Errorf("first announced %s, want %s", batch[0].Hash, testTxInventory(5).Hash)
+	}
+	seen := make(map[inventoryKey]struct{})
+	for _, iv := range append(batch, rest...) {
+		key := newInventoryKey(iv)
+		if _, ok := seen[key]; ok {
+			t.Errorf("%s queued twice", iv.Hash)
+		}
+		seen[key] = struct{}{}
+		if peer.isKnownInventory(iv) {
+			t.Errorf("known %s queued", iv.Hash)
+		}
+	}
+
+	// The rest go in the next batches.
+	batch, rest = peer.nextTxInventory(rest)
+	if len(batch) != InventoryBroadcastMax || len(rest) != 5 {
+		t.Errorf("%d transactions announced next, %d left", len(batch), len(rest))
+	}
+	batch, rest = peer.nextTxInventory(rest)
+	if len(batch) != 5 || rest != nil {
+		t.Errorf("%d transactions announced last, %d left", len(batch), len(rest))
+	}
+
+	// Each peer has its own known inventory.
+	batch, _ = other.nextTxInventory(queue[:10])
+	if len(batch) != 10 {
+		t.Errorf("%d transactions announced to another peer, want 10", len(batch))
+	}
+
+	// The known inventory of a peer is bounded, the oldest is forgotten.
+	for i := 0; i < protocol.MaxKnownInventory; i++ {
+		other.AddKnownInventory(testTxInventory(1000 + i))
+	}
+	other.AddKnownInventory(testTxInventory(0))
+	if other.isKnownInventory(testTxInventory(1000)) || !other.isKnownInventory(testTxInventory(1001)) ||
+		!other.isKnownInventory(testTxInventory(0)) {
+		t.Error("known inventory not bounded")
+	}
+}
+
+func TestNextTxInventoryOrdered(t *testing.T) {
+	// The batch is taken from the ordered transactions.
+	reverse := func(ivs []*msg.InventoryVector) []*msg.InventoryVector {
+		reversed := make([]*msg.InventoryVector, 0, len(ivs))
+		for i := len(ivs) - 1; i >= 0; i-- {
+			reversed = append(reversed, ivs[i])
+		}
+		return reversed
+	}
+	peer := newPeer(&PeerConfig{OrderTxInventory: reverse}, false)
+	var queue []*msg.InventoryVector
+	for i := 0; i < InventoryBroadcastMax+1; i++ {
+		queue = append(queue, testTxInventory(i))
+	}
+	batch, rest := peer.nextTxInventory(queue)
+	if len(batch) != InventoryBroadcastMax || len(rest) != 1 {
+		t.Fatalf("%d transactions announced, %d left", len(batch), len(rest))
+	}
+	if !batch[0].Hash.IsEqual(testTxInventory(InventoryBroadcastMax).Hash) ||
+		!rest[0].Hash.IsEqual(testTxInventory(0).Hash) {
+		t.Errorf("announced %s first and left %s", batch[0].Hash, rest[0].Hash)
+	}
+}
+
+func TestOrderTxInventory(t *testing.T) {
+	memPool := blockchain.GMemPool
+	defer func() {
+		blockchain.GMemPool = memPool
+	}()
+	blockchain.GMemPool = mempool.NewTxMempool()
+
+	tests := []struct {
+		ancestors int64
+		fee       int64
+	}{
+		{3, 0},
+		{2, 100000},
+		{1, 1000},
+		{1, 2000},
+		{1, 5000},
+		{1, 2000},
+	}
+	var queue []*msg.InventoryVector
+	for i, test := range tests {
+		iv := testTxInventory(i)
+		entry := &mempool.TxEntry{TxSize: 1000, TxFee: test.fee}
+		entry.SumTxCountWithAncestors = test.ancestors
+		blockchain.GMemPool.PoolData[*iv.Hash] = entry
+		queue = append(queue, iv)
+	}
+	// The transactions no longer in the mempool are dropped.
+	queue = append(queue, testTxInventory(len(tests)), &msg.InventoryVector{Type: msg.InventoryTypeTx})
+
+	// The parents come first, then the higher fee rates, the ties are
+	// broken by hash.
+	want := []int{4, 3, 5, 2, 1, 0}
+	ordered := orderTxInventory(queue)
+	if len(ordered) != len(want) {
+		t.Fatalf("%d transactions ordered, want %d", len(ordered), len(want))
+	}
+	for i, iv := range ordered {
+		if !iv.Hash.IsEqual(testTxInventory(want[i]).Hash) {
+			t.Errorf("transaction %d is %s, want %s", i, iv.Hash, testTxInventory(want[i]).Hash)
+		}
+	}
+}
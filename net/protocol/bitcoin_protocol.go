@@ -8,15 +8,17 @@ import (
 const MaxMessagePayload = 1024 * 1024 * 32
 const (
 	Copernicus                    = "0.16.0"
-	BitcoinProtocolVersion uint32 = 70012
+	BitcoinProtocolVersion uint32 = 70013
 	PeerAddressTimeVersion uint32 = 31402
 	MaxUserAgentLen               = 256
 	MultipleAddressVersion uint32 = 209
-	MaxProtocolVersion     uint32 = 70012
+	MaxProtocolVersion     uint32 = 70013
 	RejectVersion          uint32 = 70002
 	Bip0037Version         uint32 = 70001
 	Bip0031Version         uint32 = 60000
 	Bip0111Version         uint32 = 70011
+	// FeeFilterVersion the protocol version which adds the feefilter message of BIP133
+	FeeFilterVersion uint32 = 70013
 
 	MaxKnownInventory = 1000
 )
@@ -26,6 +28,10 @@ const (
 	SFNodeBloomFilter
 )
 
+// SFNodeDandelion is the service of the nodes which relay the stem
+// transactions of Dandelion++.
+const SFNodeDandelion = 1 << 24
+
 // InventoryType represents the allowed types of inventory vectors.  See InvVect.
 type InventoryType uint32
 
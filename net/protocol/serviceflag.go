@@ -12,11 +12,13 @@ func (f ServiceFlag) ToString() string {
 		SFNodeNetworkAsFullNode,
 		SFNodeGetUtxo,
 		SFNodeBloomFilter,
+		SFNodeDandelion,
 	}
 	var sfStrings = map[ServiceFlag]string{
 		SFNodeNetworkAsFullNode: "SFNodeNetwork",
 		SFNodeBloomFilter:       "SFNodeBloom",
 		SFNodeGetUtxo:           "SFNodeGetUTXO",
+		SFNodeDandelion:         "SFNodeDandelion",
 	}
 	if f == 0 {
 		return "0x0"
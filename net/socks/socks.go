@@ -0,0 +1,271 @@
+// Package socks dials connections through a SOCKS5 proxy such as Tor.  It
+// depends on nothing of the node, so the command line tools may use it too.
+package socks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The values of the SOCKS5 protocol (RFC 1928), with the username and
+// password authentication (RFC 1929) and the RESOLVE command of Tor.
+const (
+	socksVersion         = 0x05
+	socksUserPassVersion = 0x01
+
+	socksAuthNone         = 0x00
+	socksAuthUserPass     = 0x02
+	socksAuthNoAcceptable = 0xff
+
+	socksCmdConnect    = 0x01
+	socksCmdTorResolve = 0xf0
+
+	socksAddressIPv4   = 0x01
+	socksAddressDomain = 0x03
+	socksAddressIPv6   = 0x04
+)
+
+// LookupTimeout is how long a host name resolution through the proxy may
+// take.
+const LookupTimeout = 30 * time.Second
+
+// Proxy dials connections through a SOCKS5 proxy such as Tor, without
+// authentication or with a username and a password.  The host names are sent
+// to the proxy, which resolves them, so the node never looks them up itself.
+type Proxy struct {
+	Address  string
+	Username string
+	Password string
+
+	// TorIsolation authenticates every connection with random
+	// credentials, which Tor isolates onto a circuit of their own.
+	TorIsolation bool
+}
+
+// ProxiedAddr is the address a connection made through a proxy was asked
+// for, which may be a host name the node never resolved.
+type ProxiedAddr struct {
+	Host string
+	Port int
+}
+
+// Network returns the network of the address, which is always tcp.
+func (proxiedAddr *ProxiedAddr) Network() string {
+	return "tcp"
+}
+
+func (proxiedAddr *ProxiedAddr) String() string {
+	return net.JoinHostPort(proxiedAddr.Host, strconv.Itoa(proxiedAddr.Port))
+}
+
+// proxiedConn is a connection made through a proxy, its remote address is the
+// address asked to the proxy rather than the address of the proxy.
+type proxiedConn struct {
+	net.Conn
+	remoteAddr *ProxiedAddr
+}
+
+func (conn *proxiedConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+// Dial connects to address through the proxy, within timeout when it isn't
+// zero.  The network must be a tcp network, or onion for the Tor addresses.
+// It has the signature of net.DialTimeout.
+func (proxy *Proxy) Dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "onion":
+	default:
+		return nil, fmt.Errorf("network %s not supported by the SOCKS5 proxy", network)
+	}
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s: %v", portString, err)
+	}
+	conn, err := proxy.open(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := socksRequest(conn, socksCmdConnect, host, uint16(port)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &proxiedConn{Conn: conn, remoteAddr: &ProxiedAddr{Host: host, Port: int(port)}}, nil
+}
+
+// LookupIP resolves host through the proxy with the RESOLVE command of Tor.
+// It has the signature of net.LookupIP.
+func (proxy *Proxy) LookupIP(host string) ([]net.IP, error) {
+	conn, err := proxy.open(LookupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip, err := socksRequest(conn, socksCmdTorResolve, host, 0)
+	if err != nil {
+		return nil, err
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("no address found for %s through the proxy", host)
+	}
+	return []net.IP{ip}, nil
+}
+
+// open connects and authenticates to the proxy.
+func (proxy *Proxy) open(timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxy.Address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := proxy.authenticate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// credentials returns the username and the password of a new connection,
+// random ones with TorIsolation.
+func (proxy *Proxy) credentials() (string, string, error) {
+	if !proxy.TorIsolation {
+		return proxy.Username, proxy.Password, nil
+	}
+	var random [16]byte
+	if _, err := io.ReadFull(rand.Reader, random[:]); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(random[:8]), hex.EncodeToString(random[8:]), nil
+}
+
+// authenticate negotiates the authentication method with the proxy, the
+// username and password method is offered when there are credentials.
+func (proxy *Proxy) authenticate(conn net.Conn) error {
+	username, password, err := proxy.credentials()
+	if err != nil {
+		return err
+	}
+	if len(username) > 255 || len(password) > 255 {
+		return errors.New("SOCKS5 username or password longer than 255 bytes")
+	}
+	methods := []byte{socksAuthNone}
+	if username != "" || password != "" {
+		methods = append(methods, socksAuthUserPass)
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("proxy replied with SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case socksAuthNone:
+		return nil
+	case socksAuthUserPass:
+		if len(methods) == 1 {
+			break
+		}
+		request := []byte{socksUserPassVersion, byte(len(username))}
+		request = append(request, username...)
+		request = append(request, byte(len(password)))
+		request = append(request, password...)
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("SOCKS5 proxy authentication failed")
+		}
+		return nil
+	case socksAuthNoAcceptable:
+		return errors.New("no authentication method accepted by the SOCKS5 proxy")
+	}
+	return fmt.Errorf("SOCKS5 proxy picked the authentication method %d which wasn't offered", reply[1])
+}
+
+// socksRequest sends the command for host and port to the proxy, and returns
+// the bound address of the reply, the resolved address of a RESOLVE command.
+// The host names are sent as such, for the proxy to resolve.
+func socksRequest(conn net.Conn, command byte, host string, port uint16) (net.IP, error) {
+	request := []byte{socksVersion, command, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(request, socksAddressIPv4)
+			request = append(request, ip4...)
+		} else {
+			request = append(request, socksAddressIPv6)
+			request = append(request, ip.To16()...)
+		}
+	} else {
+		if len(host) == 0 || len(host) > 255 {
+			return nil, fmt.Errorf("invalid host name %q", host)
+		}
+		request = append(request, socksAddressDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, err
+	}
+	if reply[0] != socksVersion {
+		return nil, fmt.Errorf("proxy replied with SOCKS version %d", reply[0])
+	}
+	if reply[1] != TorSucceeded {
+		if err, ok := torStatusErrors[reply[1]]; ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("SOCKS5 proxy failed with status %d", reply[1])
+	}
+	var address []byte
+	switch reply[3] {
+	case socksAddressIPv4:
+		address = make([]byte, net.IPv4len)
+	case socksAddressIPv6:
+		address = make([]byte, net.IPv6len)
+	case socksAddressDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		address = make([]byte, length[0])
+	default:
+		return nil, fmt.Errorf("SOCKS5 proxy replied with address type %d", reply[3])
+	}
+	if _, err := io.ReadFull(conn, address); err != nil {
+		return nil, err
+	}
+	var boundPort [2]byte
+	if _, err := io.ReadFull(conn, boundPort[:]); err != nil {
+		return nil, err
+	}
+	if reply[3] == socksAddressDomain {
+		return nil, nil
+	}
+	return net.IP(address), nil
+}
@@ -0,0 +1,282 @@
+package socks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socksServer is an in-process SOCKS5 proxy which answers the connect
+// requests itself, echoing the data sent through the connections.
+type socksServer struct {
+	listener net.Listener
+	username string
+	password string
+	status   byte
+	resolved net.IP
+
+	lock     sync.Mutex
+	hosts    []string
+	logins   []string
+	commands []byte
+}
+
+func newSocksServer(t *testing.T) *socksServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &socksServer{listener: listener, status: TorSucceeded}
+	go server.serve()
+	return server
+}
+
+func (server *socksServer) Close() {
+	server.listener.Close()
+}
+
+func (server *socksServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *socksServer) handle(conn net.Conn) {
+	defer conn.Close()
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil || header[0] != socksVersion {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(socksAuthNone)
+	if server.username != "" {
+		method = socksAuthNoAcceptable
+		if bytes.IndexByte(methods, socksAuthUserPass) >= 0 {
+			method = socksAuthUserPass
+		}
+	}
+	conn.Write([]byte{socksVersion, method})
+	switch method {
+	case socksAuthNoAcceptable:
+		return
+	case socksAuthUserPass:
+		username, password, ok := readUserPass(conn)
+		if !ok {
+			return
+		}
+		server.lock.Lock()
+		server.logins = append(server.logins, username+":"+password)
+		server.lock.Unlock()
+		if server.username != "*" && (username != server.username || password != server.password) {
+			conn.Write([]byte{socksUserPassVersion, 0x01})
+			return
+		}
+		conn.Write([]byte{socksUserPassVersion, 0x00})
+	}
+
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return
+	}
+	var host string
+	switch request[3] {
+	case socksAddressIPv4, socksAddressIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddressIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = ip.String()
+	case socksAddressDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return
+	}
+	server.lock.Lock()
+	server.hosts = append(server.hosts, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))))
+	server.commands = append(server.commands, request[1])
+	server.lock.Unlock()
+
+	bound := net.IPv4(127, 0, 0, 1).To4()
+	if request[1] == socksCmdTorResolve && server.resolved != nil {
+		bound = server.resolved.To4()
+	}
+	reply := append([]byte{socksVersion, server.status, 0x00, socksAddressIPv4}, bound...)
+	conn.Write(append(reply, 0x00, 0x00))
+	if server.status != TorSucceeded || request[1] != socksCmdConnect {
+		return
+	}
+	io.Copy(conn, conn)
+}
+
+func readUserPass(conn net.Conn) (string, string, bool) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil || header[0] != socksUserPassVersion {
+		return "", "", false
+	}
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return "", "", false
+	}
+	var length [1]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return "", "", false
+	}
+	password := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return "", "", false
+	}
+	return string(username), string(password), true
+}
+
+// echo checks data goes through the connection.
+func echo(t *testing.T, conn net.Conn) {
+	message := []byte("version")
+	if _, err := conn.Write(message); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	received := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(received, message) {
+		t.Fatalf("received %q, want %q", received, message)
+	}
+}
+
+func TestProxyDialNoAuth(t *testing.T) {
+	server := newSocksServer(t)
+	defer server.Close()
+	proxy := &Proxy{Address: server.listener.Addr().String()}
+
+	tests := []string{
+		"expyuzz4wqqyqhjn.onion:8333",
+		"seed.example.com:8333",
+		"10.1.2.3:18333",
+		"[2001:db8::1]:8333",
+	}
+	for _, address := range tests {
+		conn, err := proxy.Dial("tcp", address, 5*time.Second)
+		if err != nil {
+			t.Fatalf("%s: dial: %v", address, err)
+		}
+		echo(t, conn)
+		if remote := conn.RemoteAddr().String(); remote != address {
+			t.Errorf("%s: remote address %s", address, remote)
+		}
+		conn.Close()
+	}
+	// The host names reach the proxy unresolved.
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for i, address := range tests {
+		if server.hosts[i] != address {
+			t.Errorf("proxy asked for %s, want %s", server.hosts[i], address)
+		}
+	}
+	if len(server.logins) != 0 {
+		t.Errorf("credentials sent without any: %v", server.logins)
+	}
+}
+
+func TestProxyDialUserPass(t *testing.T) {
+	server := newSocksServer(t)
+	defer server.Close()
+	server.username, server.password = "user", "secret"
+	address := server.listener.Addr().String()
+
+	proxy := &Proxy{Address: address, Username: "user", Password: "secret"}
+	conn, err := proxy.Dial("tcp", "10.1.2.3:8333", 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	echo(t, conn)
+	conn.Close()
+
+	proxy = &Proxy{Address: address, Username: "user", Password: "wrong"}
+	if _, err := proxy.Dial("tcp", "10.1.2.3:8333", 5*time.Second); err == nil {
+		t.Error("dial with a wrong password succeeded")
+	}
+	proxy = &Proxy{Address: address}
+	if _, err := proxy.Dial("tcp", "10.1.2.3:8333", 5*time.Second); err == nil {
+		t.Error("dial without credentials succeeded")
+	}
+}
+
+func TestProxyTorIsolation(t *testing.T) {
+	server := newSocksServer(t)
+	defer server.Close()
+	server.username = "*"
+	proxy := &Proxy{Address: server.listener.Addr().String(), TorIsolation: true}
+	for i := 0; i < 2; i++ {
+		conn, err := proxy.Dial("tcp", "expyuzz4wqqyqhjn.onion:8333", 5*time.Second)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.Close()
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if len(server.logins) != 2 || server.logins[0] == server.logins[1] {
+		t.Errorf("connections not isolated, credentials %v", server.logins)
+	}
+}
+
+func TestProxyDialFailure(t *testing.T) {
+	server := newSocksServer(t)
+	defer server.Close()
+	server.status = TorConnectionRefused
+	proxy := &Proxy{Address: server.listener.Addr().String()}
+	_, err := proxy.Dial("tcp", "10.1.2.3:8333", 5*time.Second)
+	if err != torStatusErrors[TorConnectionRefused] {
+		t.Errorf("dial error %v, want %v", err, torStatusErrors[TorConnectionRefused])
+	}
+	if _, err := proxy.Dial("udp", "10.1.2.3:8333", 5*time.Second); err == nil {
+		t.Error("udp dial through the proxy succeeded")
+	}
+}
+
+func TestProxyLookupIP(t *testing.T) {
+	server := newSocksServer(t)
+	defer server.Close()
+	server.resolved = net.IPv4(93, 184, 216, 34)
+	proxy := &Proxy{Address: server.listener.Addr().String()}
+	ips, err := proxy.LookupIP("seed.example.com")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(server.resolved) {
+		t.Errorf("resolved %v, want %v", ips, server.resolved)
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.commands[0] != socksCmdTorResolve || server.hosts[0] != "seed.example.com:0" {
+		t.Errorf("proxy got command %#x for %s", server.commands[0], server.hosts[0])
+	}
+}
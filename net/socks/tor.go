@@ -1,4 +1,4 @@
-package conn
+package socks
 
 import "github.com/pkg/errors"
 
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"sort"
 
 	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/btcjson"
 	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
 	"github.com/btcboost/copernicus/net/msg"
 	"github.com/btcboost/copernicus/policy"
 	"github.com/btcboost/copernicus/utils"
@@ -15,23 +18,25 @@ import (
 )
 
 var blockchainHandlers = map[string]commandHandler{
-	"getblockchaininfo":     handleGetBlockChainInfo,
-	"getbestblockhash":      handleGetBestBlockHash, // complete
-	"getblockcount":         handleGetBlockCount,    // complete
-	"getblock":              handleGetBlock,
-	"getblockhash":          handleGetBlockHash,   // complete
-	"getblockheader":        handleGetblockheader, // complete
-	"getchaintips":          handleGetChainTips,
-	"getdifficulty":         handleGetDifficulty, //complete
-	"getmempoolancestors":   handleGetMempoolAncestors,
-	"getmempooldescendants": handleGetMempoolDescendants,
-	"getmempoolinfo":        handleGetMempoolInfo, // complete
-	"getrawmempool":         handleGetRawMempool,
-	"gettxout":              handleGetTxOut,
-	"gettxoutsetinfo":       handleGetTxoutSetInfo,
-	"pruneblockchain":       handlePruneBlockChain, //complete
-	"verifychain":           handleVerifyChain,     //complete
-	"preciousblock":         handlePreciousblock,   //complete
+	"getblockchaininfo":      handleGetBlockChainInfo,
+	"getbestblockhash":       handleGetBestBlockHash, // complete
+	"getblockcount":          handleGetBlockCount,    // complete
+	"getblock":               handleGetBlock,
+	"getblockhash":           handleGetBlockHash,   // complete
+	"getblockheader":         handleGetblockheader, // complete
+	"getchaintips":           handleGetChainTips,
+	"getdifficulty":          handleGetDifficulty, //complete
+	"getmempoolancestors":    handleGetMempoolAncestors,
+	"getmempooldescendants":  handleGetMempoolDescendants,
+	"getmempoolentry":        handleGetMempoolEntry,
+	"getmempoolfeehistogram": handleGetMempoolFeeHistogram,
+	"getmempoolinfo":         handleGetMempoolInfo, // complete
+	"getrawmempool":          handleGetRawMempool,
+	"gettxout":               handleGetTxOut,
+	"gettxoutsetinfo":        handleGetTxoutSetInfo,
+	"pruneblockchain":        handlePruneBlockChain, //complete
+	"verifychain":            handleVerifyChain,     //complete
+	"preciousblock":          handlePreciousblock,   //complete
 
 	/*not shown in help*/
 	"invalidateblock":    handlInvalidateBlock,
@@ -42,115 +47,33 @@ var blockchainHandlers = map[string]commandHandler{
 }
 
 func handleGetBlockChainInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/*
-		// Obtain a snapshot of the current best known blockchain state. We'll
-		// populate the response to this call primarily from this snapshot.
-		params := s.cfg.ChainParams
-		chain := s.cfg.Chain
-		chainSnapshot := chain.BestSnapshot()
-
-		chainInfo := &btcjson.GetBlockChainInfoResult{
-			Chain:         params.Name,
-			Blocks:        chainSnapshot.Height,
-			Headers:       chainSnapshot.Height,
-			BestBlockHash: chainSnapshot.Hash.String(),
-			Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
-			MedianTime:    chainSnapshot.MedianTime.Unix(),
-			Pruned:        false,
-			Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
-		}
-
-		// Next, populate the response with information describing the current
-		// status of soft-forks deployed via the super-majority block
-		// signalling mechanism.
-		height := chainSnapshot.Height
-		chainInfo.SoftForks = []*btcjson.SoftForkDescription{
-			{
-				ID:      "bip34",
-				Version: 2,
-				Reject: struct {
-					Status bool `json:"status"`
-				}{
-					Status: height >= params.BIP0034Height,
-				},
-			},
-			{
-				ID:      "bip66",f
-				Version: 3,
-				Reject: struct {
-					Status bool `json:"status"`
-				}{
-					Status: height >= params.BIP0066Height,
-				},
-			},
-			{
-				ID:      "bip65",
-				Version: 4,
-				Reject: struct {
-					Status bool `json:"status"`
-				}{
-					Status: height >= params.BIP0065Height,
-				},
-			},
-		}
-
-		// Finally, query the BIP0009 version bits state for all currently
-		// defined BIP0009 soft-fork deployments.
-		for deployment, deploymentDetails := range params.Deployments {
-			// Map the integer deployment ID into a human readable
-			// fork-name.
-			var forkName string
-			switch deployment {
-			case chaincfg.DeploymentTestDummy:
-				forkName = "dummy"
-
-			case chaincfg.DeploymentCSV:
-				forkName = "csv"
-
-			case chaincfg.DeploymentSegwit:
-				forkName = "segwit"
-
-			default:
-				return nil, &btcjson.RPCError{
-					Code: btcjson.ErrRPCInternal.Code,
-					Message: fmt.Sprintf("Unknown deployment %v "+
-						"detected", deployment),
-				}
-			}
-
-			// Query the chain for the current status of the deployment as
-			// identified by its deployment ID.
-			deploymentStatus, err := chain.ThresholdState(uint32(deployment))
-			if err != nil {
-				context := "Failed to obtain deployment status"
-				return nil, internalRPCError(err.Error(), context)
-			}
+	return getChainInfo(), nil
+}
 
-			// Attempt to convert the current deployment status into a
-			// human readable string. If the status is unrecognized, then a
-			// non-nil error is returned.
-			statusString, err := softForkStatus(deploymentStatus)
-			if err != nil {
-				return nil, &btcjson.RPCError{
-					Code: btcjson.ErrRPCInternal.Code,
-					Message: fmt.Sprintf("unknown deployment status: %v",
-						deploymentStatus),
-				}
-			}
+// getChainInfo returns the state of the active chain.
+func getChainInfo() *btcjson.GetBlockChainInfoResult {
+	tip := blockchain.GChainActive.Tip()
+	headers := blockchain.GChainActive.Height()
+	if blockchain.GIndexBestHeader != nil {
+		headers = blockchain.GIndexBestHeader.Height
+	}
 
-			// Finally, populate the soft-fork description with all the
-			// information gathered above.
-			chainInfo.Bip9SoftForks[forkName] = &btcjson.Bip9SoftForkDescription{
-				Status:    strings.ToLower(statusString),
-				Bit:       deploymentDetails.BitNumber,
-				StartTime: int64(deploymentDetails.StartTime),
-				Timeout:   int64(deploymentDetails.ExpireTime),
-			}
-		}
+	chainInfo := &btcjson.GetBlockChainInfoResult{
+		Chain:         msg.ActiveNetParams.Name,
+		Blocks:        int32(blockchain.GChainActive.Height()),
+		Headers:       int32(headers),
+		Difficulty:    getDifficulty(tip),
+		Pruned:        blockchain.GPruneMode,
+		SoftForks:     make([]*btcjson.SoftForkDescription, 0),
+		Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
+	}
+	if tip != nil {
+		chainInfo.BestBlockHash = tip.GetBlockHash().ToString()
+		chainInfo.MedianTime = tip.GetMedianTimePast()
+		chainInfo.ChainWork = tip.ChainWork.Text(16)
+	}
 
-		return chainInfo, nil
-	*/
-	return nil, nil
+	return chainInfo
 }
 
 func handleGetBestBlockHash(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -279,108 +202,103 @@ func handleGetBlockCount(s *Server, cmd interface{}, closeChan <-chan struct{})
 //}
 
 func handleGetBlock(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/*
-		c := cmd.(*btcjson.GetBlockCmd)
+	c := cmd.(*btcjson.GetBlockCmd)
 
-		// Load the raw block bytes from the database.
-		hash, err := chainhash.NewHashFromStr(c.Hash)
-		if err != nil {
-			return nil, rpcDecodeHexError(c.Hash)
-		}
-		var blkBytes []byte
-		err = s.cfg.DB.View(func(dbTx database.Tx) error {
-			var err error
-			blkBytes, err = dbTx.FetchBlock(hash)
-			return err
-		})
-		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCBlockNotFound,
-				Message: "Block not found",
-			}
-		}
-
-		// When the verbose flag isn't set, simply return the serialized block
-		// as a hex-encoded string.
-		if c.Verbose != nil && !*c.Verbose {
-			return hex.EncodeToString(blkBytes), nil
+	hash, err := utils.GetHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	blockIndex := blockchain.GChainActive.FetchBlockIndexByHash(hash)
+	if blockIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
 		}
+	}
+	block, err := readBlock(blockIndex)
+	if err != nil {
+		return nil, err
+	}
 
-		// The verbose flag is set, so generate the JSON object and return it.
-
-		// Deserialize the block.
-		blk, err := btcutil.NewBlockFromBytes(blkBytes)
-		if err != nil {
-			context := "Failed to deserialize block"
+	// When the verbose flag isn't set, simply return the serialized block
+	// as a hex-encoded string.
+	if c.Verbose != nil && !*c.Verbose {
+		var blockBuf bytes.Buffer
+		if err := block.Serialize(&blockBuf); err != nil {
+			context := "Failed to serialize block"
 			return nil, internalRPCError(err.Error(), context)
 		}
+		return hex.EncodeToString(blockBuf.Bytes()), nil
+	}
 
-		// Get the block height from chain.
-		blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
-		if err != nil {
-			context := "Failed to obtain block height"
-			return nil, internalRPCError(err.Error(), context)
-		}
-		blk.SetHeight(blockHeight)
-		best := s.cfg.Chain.BestSnapshot()
+	return blockToJSON(block, blockIndex, c.VerboseTx != nil && *c.VerboseTx)
+}
 
-		// Get next block hash unless there are none.
-		var nextHashString string
-		if blockHeight < best.Height {
-			nextHash, err := s.cfg.Chain.BlockHashByHeight(blockHeight + 1)
-			if err != nil {
-				context := "No next block"
-				return nil, internalRPCError(err.Error(), context)
-			}
-			nextHashString = nextHash.String()
+// readBlock reads the block of the passed index from disk.
+func readBlock(blockIndex *core.BlockIndex) (*core.Block, error) {
+	block := core.NewBlock()
+	if !blockchain.ReadBlockFromDisk(block, blockIndex, msg.ActiveNetParams) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Can't read block from disk",
 		}
+	}
+	return block, nil
+}
 
-		params := s.cfg.ChainParams
-		blockHeader := &blk.MsgBlock().Header
-		blockReply := btcjson.GetBlockVerboseResult{
-			Hash:          c.Hash,
-			Version:       blockHeader.Version,
-			VersionHex:    fmt.Sprintf("%08x", blockHeader.Version),
-			MerkleRoot:    blockHeader.MerkleRoot.String(),
-			PreviousHash:  blockHeader.PrevBlock.String(),
-			Nonce:         blockHeader.Nonce,
-			Time:          blockHeader.Timestamp.Unix(),
-			Confirmations: uint64(1 + best.Height - blockHeight),
-			Height:        int64(blockHeight),
-			Size:          int32(len(blkBytes)),
-			StrippedSize:  int32(blk.MsgBlock().SerializeSizeStripped()),
-			Weight:        int32(blockchain.GetBlockWeight(blk)),
-			Bits:          strconv.FormatInt(int64(blockHeader.Bits), 16),
-			Difficulty:    getDifficultyRatio(blockHeader.Bits, params),
-			NextHash:      nextHashString,
-		}
+// blockToJSON converts the passed block to a JSON object.  The transactions
+// are included in full when txDetails is set and by id otherwise.
+func blockToJSON(block *core.Block, blockIndex *core.BlockIndex, txDetails bool) (*btcjson.GetBlockVerboseResult, error) {
+	confirmations := -1
+	// Only report confirmations if the block is on the main chain
+	if blockchain.GChainActive.Contains(blockIndex) {
+		confirmations = blockchain.GChainActive.Height() - blockIndex.Height + 1
+	}
 
-		if c.VerboseTx == nil || !*c.VerboseTx {
-			transactions := blk.Transactions()
-			txNames := make([]string, len(transactions))
-			for i, tx := range transactions {
-				txNames[i] = tx.Hash().String()
-			}
+	var nextblockhash string
+	next := blockchain.GChainActive.Next(blockIndex)
+	if next != nil {
+		nextblockhash = next.BlockHash.ToString()
+	}
 
-			blockReply.Tx = txNames
-		} else {
-			txns := blk.Transactions()
-			rawTxns := make([]btcjson.TxRawResult, len(txns))
-			for i, tx := range txns {
-				rawTxn, err := createTxRawResult(params, tx.MsgTx(),
-					tx.Hash().String(), blockHeader, hash.String(),
-					blockHeight, best.Height)
-				if err != nil {
-					return nil, err
-				}
-				rawTxns[i] = *rawTxn
-			}
-			blockReply.RawTx = rawTxns
-		}
+	header := &block.BlockHeader
+	size := block.SerializeSize()
+	blockReply := &btcjson.GetBlockVerboseResult{
+		Hash:          blockIndex.GetBlockHash().ToString(),
+		Confirmations: uint64(confirmations),
+		Size:          int32(size),
+		Height:        int64(blockIndex.Height),
+		Version:       header.Version,
+		VersionHex:    fmt.Sprintf("%08x", header.Version),
+		MerkleRoot:    header.MerkleRoot.ToString(),
+		Time:          int64(header.Time),
+		Nonce:         header.Nonce,
+		Bits:          fmt.Sprintf("%08x", header.Bits),
+		Difficulty:    getDifficulty(blockIndex),
+		PreviousHash:  header.HashPrevBlock.ToString(),
+		NextHash:      nextblockhash,
+	}
 
+	if !txDetails {
+		txNames := make([]string, len(block.Txs))
+		for i, tx := range block.Txs {
+			txHash := tx.TxHash()
+			txNames[i] = txHash.ToString()
+		}
+		blockReply.Tx = txNames
 		return blockReply, nil
-	*/
-	return nil, nil
+	}
+
+	rawTxns := make([]btcjson.TxRawResult, len(block.Txs))
+	for i, tx := range block.Txs {
+		rawTxn, err := createTxRawResult(tx, blockIndex.GetBlockHash(), msg.ActiveNetParams)
+		if err != nil {
+			return nil, err
+		}
+		rawTxns[i] = *rawTxn
+	}
+	blockReply.RawTx = rawTxns
+	return blockReply, nil
 }
 
 func handleGetBlockHash(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -428,7 +346,12 @@ func handleGetblockheader(s *Server, cmd interface{}, closeChan <-chan struct{})
 		return hex.EncodeToString(headerBuf.Bytes()), nil
 	}
 
-	//best := s.cfg.Chain.BestSnapshot()
+	return blockHeaderToJSON(blockIndex), nil
+}
+
+// blockHeaderToJSON converts the header of the passed block index to a JSON
+// object.
+func blockHeaderToJSON(blockIndex *core.BlockIndex) *btcjson.GetBlockHeaderVerboseResult {
 	best := blockchain.GChainActive.Tip()
 	confirmations := -1
 	// Only report confirmations if the block is on the main chain
@@ -447,8 +370,8 @@ func handleGetblockheader(s *Server, cmd interface{}, closeChan <-chan struct{})
 		nextblockhash = next.BlockHash.ToString()
 	}
 
-	blockHeaderReply := btcjson.GetBlockHeaderVerboseResult{
-		Hash:          c.Hash,
+	return &btcjson.GetBlockHeaderVerboseResult{
+		Hash:          blockIndex.GetBlockHash().ToString(),
 		Confirmations: uint64(confirmations),
 		Height:        int32(blockIndex.Height),
 		Version:       blockIndex.Header.Version,
@@ -463,7 +386,6 @@ func handleGetblockheader(s *Server, cmd interface{}, closeChan <-chan struct{})
 		PreviousHash:  previousblockhash,
 		NextHash:      nextblockhash,
 	}
-	return blockHeaderReply, nil
 }
 
 func handleGetChainTips(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -501,25 +423,144 @@ func handleGetDifficulty(s *Server, cmd interface{}, closeChan <-chan struct{})
 	return getDifficulty(best), nil
 }
 
+// mempoolEntryToJSON must be called with the mempool locked.
+func mempoolEntryToJSON(pool *mempool.TxMempool, entry *mempool.TxEntry) *btcjson.GetMempoolEntryResult {
+	depends := make([]string, 0)
+	for _, txIn := range entry.Tx.Ins {
+		if _, ok := pool.PoolData[txIn.PreviousOutPoint.Hash]; ok {
+			depends = append(depends, txIn.PreviousOutPoint.Hash.ToString())
+		}
+	}
+	sort.Strings(depends)
+
+	return &btcjson.GetMempoolEntryResult{
+		Size:             int32(entry.TxSize),
+		Fee:              utils.Amount(entry.TxFee).ToBTC(),
+		ModifiedFee:      utils.Amount(entry.GetModifiedFee()).ToBTC(),
+		Time:             entry.GetTime(),
+		Height:           int64(entry.TxHeight),
+		StartingPriority: entry.GetStartingPriority(),
+		CurrentPriority:  entry.GetPriority(blockchain.GChainActive.Height()),
+		DescendantCount:  entry.SumTxCountWithDescendants,
+		DescendantSize:   entry.SumSizeWithDescendants,
+		DescendantFees:   utils.Amount(entry.SumFeeWithDescendants).ToBTC(),
+		AncestorCount:    entry.SumTxCountWithAncestors,
+		AncestorSize:     entry.SumSizeWitAncestors,
+		AncestorFees:     utils.Amount(entry.SumFeeWithAncestors).ToBTC(),
+		Depends:          depends,
+	}
+}
+
+// mempoolEntriesToJSON return the txids of the entries, or the map of txid
+// to the entry's detail when verbose.
+func mempoolEntriesToJSON(pool *mempool.TxMempool, entries map[*mempool.TxEntry]struct{}, verbose bool) interface{} {
+	if verbose {
+		ret := make(map[string]*btcjson.GetMempoolEntryResult, len(entries))
+		for entry := range entries {
+			ret[entry.Tx.Hash.ToString()] = mempoolEntryToJSON(pool, entry)
+		}
+		return ret
+	}
+
+	ret := make([]string, 0, len(entries))
+	for entry := range entries {
+		ret = append(ret, entry.Tx.Hash.ToString())
+	}
+	return ret
+}
+
+func getMempoolEntry(pool *mempool.TxMempool, txID string) (*mempool.TxEntry, error) {
+	hash, err := utils.GetHashFromStr(txID)
+	if err != nil {
+		return nil, rpcDecodeHexError(txID)
+	}
+	entry, ok := pool.PoolData[*hash]
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Transaction not in mempool",
+		}
+	}
+	return entry, nil
+}
+
 func handleGetMempoolAncestors(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	c := cmd.(*btcjson.GetMempoolAncestorsCmd)
+	pool := blockchain.GMemPool
+	pool.RLock()
+	defer pool.RUnlock()
+
+	entry, err := getMempoolEntry(pool, c.TxID)
+	if err != nil {
+		return nil, err
+	}
+	noLimit := uint64(math.MaxUint64)
+	ancestors, err := pool.CalculateMemPoolAncestors(entry.Tx, noLimit, noLimit, noLimit, noLimit, false)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to calculate ancestors")
+	}
+	return mempoolEntriesToJSON(pool, ancestors, *c.Verbose), nil
 }
 
 func handleGetMempoolDescendants(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	c := cmd.(*btcjson.GetMempoolDescendantsCmd)
+	pool := blockchain.GMemPool
+	pool.RLock()
+	defer pool.RUnlock()
+
+	entry, err := getMempoolEntry(pool, c.TxID)
+	if err != nil {
+		return nil, err
+	}
+	descendants := make(map[*mempool.TxEntry]struct{})
+	pool.CalculateDescendants(entry, descendants)
+	// CalculateDescendants includes the entry itself
+	delete(descendants, entry)
+	return mempoolEntriesToJSON(pool, descendants, *c.Verbose), nil
+}
+
+func handleGetMempoolEntry(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+	pool := blockchain.GMemPool
+	pool.RLock()
+	defer pool.RUnlock()
+
+	entry, err := getMempoolEntry(pool, c.TxID)
+	if err != nil {
+		return nil, err
+	}
+	return mempoolEntryToJSON(pool, entry), nil
+}
+
+func handleGetMempoolFeeHistogram(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	buckets := blockchain.GMemPool.GetFeeHistogram(mempool.DefaultFeeHistogramBinSize)
+	ret := make([]btcjson.GetMempoolFeeHistogramResult, len(buckets))
+	for i, bucket := range buckets {
+		ret[i] = btcjson.GetMempoolFeeHistogramResult{
+			FeeRate: bucket.FeeRate,
+			Size:    bucket.Size,
+		}
+	}
+	return ret, nil
 }
 
 func handleGetMempoolInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	maxMempool := utils.GetArg("-maxmempool", int64(policy.DefaultMaxMemPoolSize))
+	return getMempoolInfo(), nil
+}
+
+// getMempoolInfo returns the size and fee state of the mempool.
+func getMempoolInfo() *btcjson.GetMempoolInfoResult {
+	maxMempool := utils.GetArg("-maxmempool", int64(policy.DefaultMaxMemPoolSize)) * 1000000
+	minFee := blockchain.GMemPool.GetMinFee(maxMempool)
 	ret := &btcjson.GetMempoolInfoResult{
-		Size:       len(blockchain.GMemPool.PoolData),
-		Bytes:      blockchain.GMemPool.TotalTxSize,
-		Usage:      blockchain.GMemPool.GetCacheUsage(),
-		MaxMempool: maxMempool,
-		//MempoolMinFee: valueFromAmount(mempool.GetMinFee(maxMempool)),		// todo realise
+		Size:          len(blockchain.GMemPool.PoolData),
+		Bytes:         blockchain.GMemPool.TotalTxSize,
+		Usage:         blockchain.GMemPool.GetCacheUsage(),
+		MaxMempool:    maxMempool,
+		MempoolMinFee: utils.Amount(minFee.GetFeePerK()).ToBTC(),
 	}
 
-	return ret, nil
+	return ret
 }
 
 func valueFromAmount(sizeLimit int64) string {
@@ -541,7 +582,16 @@ func valueFromAmount(sizeLimit int64) string {
 }
 
 func handleGetRawMempool(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	c := cmd.(*btcjson.GetRawMempoolCmd)
+	pool := blockchain.GMemPool
+	pool.RLock()
+	defer pool.RUnlock()
+
+	entries := make(map[*mempool.TxEntry]struct{}, len(pool.PoolData))
+	for _, entry := range pool.PoolData {
+		entries[entry] = struct{}{}
+	}
+	return mempoolEntriesToJSON(pool, entries, *c.Verbose), nil
 }
 
 func handleGetTxOut(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -3,8 +3,12 @@ package rpc
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/astaxie/beego/logs"
 	"github.com/btcboost/copernicus/blockchain"
@@ -17,18 +21,55 @@ import (
 	"gopkg.in/fatih/set.v0"
 )
 
+const (
+	// gbtRegenerateSeconds is the number of seconds that must pass before
+	// a new template is generated when the previous block hash has not
+	// changed and there have been changes to the available transactions
+	// in the memory pool.
+	gbtRegenerateSeconds = 5
+)
+
+// The timings of the long polling requests, they are variables so that they
+// can be shortened by the tests.
+var (
+	// gbtLongPollTxWait is how long a long polling request waits at least
+	// before it is answered because of new transactions in the mempool.
+	gbtLongPollTxWait = time.Minute
+
+	// gbtLongPollCheckInterval is how often a long polling request checks
+	// the mempool for new transactions.
+	gbtLongPollCheckInterval = 10 * time.Second
+
+	// gbtLongPollTimeout is the longest a long polling request is held
+	// before it is answered with the current template.
+	gbtLongPollTimeout = 10 * time.Minute
+)
+
+// longPollState returns the hash of the chain tip, nil without a tip, and
+// the mempool sequence, which a long polling request compares with those of
+// its template.  The tests replace it to move the tip while a request waits.
+var longPollState = func() (*utils.Hash, uint64) {
+	txUpdate := blockchain.GMemPool.GetTransactionsUpdated()
+	tip := blockchain.GChainActive.Tip()
+	if tip == nil {
+		return nil, txUpdate
+	}
+	return tip.GetBlockHash(), txUpdate
+}
+
 var miningHandlers = map[string]commandHandler{
-	"getnetworkhashps":      handleGetNetWorkhashPS,
-	"getmininginfo":         handleGetMiningInfo,
-	"prioritisetransaction": handlePrioritisetransaction,
-	"getblocktemplate":      handleGetBlockTemplate, // completed
-	"submitblock":           handleSubmitBlock,
-	"generate":              handleGenerate,
-	"generatetoaddress":     handleGeneratetoaddress,
-	"estimatefee":           handleEstimatefee,
-	"estimatepriority":      handleEstimatepriority,
-	"estimatesmartfee":      handleEstimatesmartfee,
-	"estimatesmartpriority": handleEstimatesmartpriority,
+	"getnetworkhashps":       handleGetNetWorkhashPS,
+	"getmininginfo":          handleGetMiningInfo,
+	"prioritisetransaction":  handlePrioritisetransaction,
+	"getblocktemplate":       handleGetBlockTemplate, // completed
+	"submitblock":            handleSubmitBlock,
+	"generate":               handleGenerate,
+	"generatetoaddress":      handleGeneratetoaddress,
+	"setcoinbasecommitments": handleSetCoinbaseCommitments,
+	"estimatefee":            handleEstimatefee,
+	"estimatepriority":       handleEstimatepriority,
+	"estimatesmartfee":       handleEstimatesmartfee,
+	"estimatesmartpriority":  handleEstimatesmartpriority,
 }
 
 func handleGetNetWorkhashPS(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -112,40 +153,78 @@ func handleGetMiningInfo(s *Server, cmd interface{}, closeChan <-chan struct{})
 	return &result, nil
 }
 
-// priority transaction currently disabled
 func handlePrioritisetransaction(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+	hash, err := utils.GetHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+	if err := blockchain.GMemPool.PrioritiseTransaction(*hash, c.PriorityDelta, c.FeeDelta); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return true, nil
+}
+
+// gbtWorkState houses state that is used in between multiple RPC invocations to
+// getblocktemplate.  Templates are cached per chain tip and mempool sequence,
+// so concurrent miners share a single CreateNewBlock call.
+type gbtWorkState struct {
+	sync.Mutex
+	lastTxUpdate  uint64
+	lastGenerated time.Time
+	prevHash      *utils.Hash
+	indexPrev     *core.BlockIndex
+	template      *mining.BlockTemplate
+
+	// newTemplate creates a block template on top of the chain tip paying
+	// to coinbaseScript.
+	newTemplate func(coinbaseScript []byte) *mining.BlockTemplate
+}
+
+// newGbtWorkState returns a new instance of a gbtWorkState with all internal
+// fields initialized and ready to use.
+func newGbtWorkState() *gbtWorkState {
+	return &gbtWorkState{
+		newTemplate: func(coinbaseScript []byte) *mining.BlockTemplate {
+			return mining.NewBlockAssembler(msg.ActiveNetParams).CreateNewBlock(coinbaseScript)
+		},
+	}
+}
+
+// invalidate drops the cached template so the next request creates a new one.
+// It is used when the caller knows the chain or the mempool changed, such as
+// after a block was generated or submitted.
+func (state *gbtWorkState) invalidate() {
+	state.Lock()
+	state.template = nil
+	state.prevHash = nil
+	state.indexPrev = nil
+	state.Unlock()
 }
 
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
 // changed or the transactions in the memory pool have been updated and it has
 // been long enough since the last template was generated.  Otherwise, the
-// timestamp for the existing block template is updated (and possibly the
-// difficulty on testnet per the consesus rules).  Finally, if the
-// useCoinbaseValue flag is false and the existing block template does not
-// already contain a valid payment address, the block template will be updated
-// with a randomly selected payment address from the list of configured
-// addresses.
+// timestamp for the existing block template is updated.
 //
 // This function MUST be called with the state locked.
-/*
-func (state *gbtWorkState) updateBlockTemplate(s *Server, useCoinbaseValue bool) error {
-	generator := s.cfg.Generator
-	lastTxUpdate := generator.TxSource().LastUpdated()
-	if lastTxUpdate.IsZero() {
-		lastTxUpdate = time.Now()
+func (state *gbtWorkState) updateBlockTemplate() error {
+	lastTxUpdate := blockchain.GMemPool.GetTransactionsUpdated()
+	tip := blockchain.GChainActive.Tip()
+	if tip == nil {
+		return internalRPCError("No chain tip to build a template on", "")
 	}
+	latestHash := tip.GetBlockHash()
 
 	// Generate a new block template when the current best block has
 	// changed or the transactions in the memory pool have been updated and
-	// it has been at least gbtRegenerateSecond since the last template was
+	// it has been at least gbtRegenerateSeconds since the last template was
 	// generated.
-	var msgBlock *wire.MsgBlock
-	var targetDifficulty string
-	latestHash := &s.cfg.Chain.BestSnapshot().Hash
-	template := state.template
-	if template == nil || state.prevHash == nil ||
+	if state.template == nil || state.prevHash == nil ||
 		!state.prevHash.IsEqual(latestHash) ||
 		(state.lastTxUpdate != lastTxUpdate &&
 			time.Now().After(state.lastGenerated.Add(time.Second*
@@ -155,35 +234,22 @@ func (state *gbtWorkState) updateBlockTemplate(s *Server, useCoinbaseValue bool)
 		// against so any errors below cause the next invocation to try
 		// again.
 		state.prevHash = nil
-
-		// Choose a payment address at random if the caller requests a
-		// full coinbase as opposed to only the pertinent details needed
-		// to create their own coinbase.
-		var payAddr btcutil.Address
-		if !useCoinbaseValue {
-			payAddr = cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
-		}
+		state.indexPrev = nil
 
 		// Create a new block template that has a coinbase which anyone
 		// can redeem.  This is only acceptable because the returned
 		// block template doesn't include the coinbase, so the caller
 		// will ultimately create their own coinbase which pays to the
 		// appropriate address(es).
-		blkTemplate, err := generator.NewBlockTemplate(payAddr)
-		if err != nil {
-			return internalRPCError("Failed to create new block "+
-				"template: "+err.Error(), "")
+		scriptDummy := core.Script{}
+		scriptDummy.PushOpCode(core.OP_TRUE)
+		template := state.newTemplate(scriptDummy.GetScriptByte())
+		if template == nil {
+			return &btcjson.RPCError{
+				Code:    btcjson.ErrUnDefined,
+				Message: "Out of memory",
+			}
 		}
-		template = blkTemplate
-		msgBlock = template.Block
-		targetDifficulty = fmt.Sprintf("%064x",
-			blockchain.CompactToBig(msgBlock.Header.Bits))
-
-		// Get the minimum allowed timestamp for the block based on the
-		// median timestamp of the last several blocks per the chain
-		// consensus rules.
-		best := s.cfg.Chain.BestSnapshot()
-		minTimestamp := mining.MinimumMedianTime(best)
 
 		// Update work state to ensure another block template isn't
 		// generated until needed.
@@ -191,92 +257,105 @@ func (state *gbtWorkState) updateBlockTemplate(s *Server, useCoinbaseValue bool)
 		state.lastGenerated = time.Now()
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
-		state.minTimestamp = minTimestamp
-
-		logs.Debugf("Generated block template (timestamp %v, "+
-			"target %s, merkle root %s)",
-			msgBlock.Header.Timestamp, targetDifficulty,
-			msgBlock.Header.MerkleRoot)
+		state.indexPrev = tip
 
-		// Notify any clients that are long polling about the new
-		// template.
-		state.notifyLongPollers(latestHash, lastTxUpdate)
-	} else {
-		// At this point, there is a saved block template and another
-		// request for a template was made, but either the available
-		// transactions haven't change or it hasn't been long enough to
-		// trigger a new block template to be generated.  So, update the
-		// existing block template.
-
-		// When the caller requires a full coinbase as opposed to only
-		// the pertinent details needed to create their own coinbase,
-		// add a payment address to the output of the coinbase of the
-		// template if it doesn't already have one.  Since this requires
-		// mining addresses to be specified via the config, an error is
-		// returned if none have been specified.
-		if !useCoinbaseValue && !template.ValidPayAddress {
-			// Choose a payment address at random.
-			payToAddr := cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
-
-			// Update the block coinbase output of the template to
-			// pay to the randomly selected payment address.
-			pkScript, err := txscript.PayToAddrScript(payToAddr)
-			if err != nil {
-				context := "Failed to create pay-to-addr script"
-				return internalRPCError(err.Error(), context)
-			}
-			template.Block.Transactions[0].TxOut[0].PkScript = pkScript
-			template.ValidPayAddress = true
+		logs.Debug("Generated block template (timestamp %d, target %08x, "+
+			"merkle root %s)", template.Block.BlockHeader.Time,
+			template.Block.BlockHeader.Bits,
+			template.Block.BlockHeader.MerkleRoot.ToString())
+		return nil
+	}
 
-			// Update the merkle root.
-			block := btcutil.NewBlock(template.Block)
-			merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
-			template.Block.Header.MerkleRoot = *merkles[len(merkles)-1]
-		}
+	// At this point, there is a saved block template and another request
+	// for a template was made, but either the available transactions
+	// haven't changed or it hasn't been long enough to trigger a new block
+	// template to be generated.  So, update the time of the existing one.
+	block := state.template.Block
+	block.UpdateTime(state.indexPrev)
+	block.BlockHeader.Nonce = 0
 
-		// Set locals for convenience.
-		msgBlock = template.Block
-		targetDifficulty = fmt.Sprintf("%064x",
-			blockchain.CompactToBig(msgBlock.Header.Bits))
+	return nil
+}
 
-		// Update the time of the block template to the current time
-		// while accounting for the median time of the past several
-		// blocks per the chain consensus rules.
-		generator.UpdateBlockTime(msgBlock)
-		msgBlock.Header.Nonce = 0
+// templateID returns the long poll id of the template built on prevHash
+// with the mempool at sequence lastTxUpdate.
+func templateID(prevHash *utils.Hash, lastTxUpdate uint64) string {
+	return fmt.Sprintf("%s%d", prevHash.ToString(), lastTxUpdate)
+}
 
-		logs.Debugf("Updated block template (timestamp %v, "+
-			"target %s)", msgBlock.Header.Timestamp,
-			targetDifficulty)
+// decodeTemplateID decodes an ID that is used to uniquely identify a block
+// template.  This is mainly used as a mechanism to track when to update
+// clients that are using long polling for block templates.  The ID consists of
+// the previous block hash for the associated template and the mempool sequence
+// the template was generated at.
+func decodeTemplateID(templateID string) (*utils.Hash, uint64, error) {
+	if len(templateID) <= 64 {
+		return nil, 0, errors.New("invalid longpollid format")
 	}
-
-	return nil
+	prevHash, err := utils.GetHashFromStr(templateID[:64])
+	if err != nil {
+		return nil, 0, errors.New("invalid longpollid format")
+	}
+	lastTxUpdate, err := strconv.ParseUint(templateID[64:], 10, 64)
+	if err != nil {
+		return nil, 0, errors.New("invalid longpollid format")
+	}
+	return prevHash, lastTxUpdate, nil
 }
-*/
 
-// global variable in package rpc
-var (
-	transactionsUpdatedLast uint64
-	indexPrev               *core.BlockIndex
-	start                   int64
-	blocktemplate           *mining.BlockTemplate
-)
+// waitLongPoll blocks a long polling getblocktemplate request until the
+// template it holds is outdated.  That is the case as soon as the chain tip
+// is no longer prevHash, or when the mempool changed since lastTxUpdate and
+// the client has been waiting for at least gbtLongPollTxWait.  After
+// gbtLongPollTimeout the request is answered in any case.
+func waitLongPoll(prevHash *utils.Hash, lastTxUpdate uint64, closeChan <-chan struct{}) error {
+	start := time.Now()
+	timeout := time.NewTimer(gbtLongPollTimeout)
+	defer timeout.Stop()
+	txCheck := time.NewTicker(gbtLongPollCheckInterval)
+	defer txCheck.Stop()
+
+	for {
+		// Fetch the notification channel before looking at the tip so a
+		// block connected in between is not missed.
+		tipChanged := blockchain.TipChanged()
+		tipHash, txUpdate := longPollState()
+		if tipHash == nil || !tipHash.IsEqual(prevHash) {
+			return nil
+		}
+		if txUpdate != lastTxUpdate && time.Since(start) >= gbtLongPollTxWait {
+			return nil
+		}
+
+		select {
+		case <-tipChanged:
+		case <-txCheck.C:
+		case <-timeout.C:
+			return nil
+		case <-closeChan:
+			return ErrClientQuit
+		}
+	}
+}
 
 func handleGetBlockTemplate(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// See https://en.bitcoin.it/wiki/BIP_0022 and
 	// https://en.bitcoin.it/wiki/BIP_0023 for more details.
 	c := cmd.(*btcjson.GetBlockTemplateCmd)
 	request := c.Request
+	if request == nil {
+		request = &btcjson.TemplateRequest{}
+	}
 
 	// Set the default mode and override it if supplied.
 	mode := "template"
-	if request != nil && request.Mode != "" {
+	if request.Mode != "" {
 		mode = request.Mode
 	}
 
 	switch mode {
 	case "template":
-		return handleGetBlockTemplateRequest(request, closeChan)
+		return handleGetBlockTemplateRequest(s, request, closeChan)
 	case "proposal":
 		return handleGetBlockTemplateProposal(request)
 	}
@@ -287,7 +366,7 @@ func handleGetBlockTemplate(s *Server, cmd interface{}, closeChan <-chan struct{
 	}
 }
 
-func handleGetBlockTemplateRequest(request *btcjson.TemplateRequest, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplateRequest(s *Server, request *btcjson.TemplateRequest, closeChan <-chan struct{}) (interface{}, error) {
 	var maxVersionVb uint32
 	setClientRules := set.New()
 	if len(request.Rules) > 0 { // todo check
@@ -299,6 +378,36 @@ func handleGetBlockTemplateRequest(request *btcjson.TemplateRequest, closeChan <
 		maxVersionVb = request.MaxVersion
 	}
 
+	// The coinbase value is returned unless the client only supports a
+	// coinbase transaction provided by the server, which pays to the
+	// configured coinbase payouts or to a mining address.
+	var hasCoinbaseValue, hasCoinbaseTxn bool
+	for _, capability := range request.Capabilities {
+		switch capability {
+		case "coinbasetxn":
+			hasCoinbaseTxn = true
+		case "coinbasevalue":
+			hasCoinbaseValue = true
+		}
+	}
+	var coinbaseScript []byte
+	if hasCoinbaseTxn && !hasCoinbaseValue {
+		if len(mining.CoinbasePayouts()) == 0 {
+			coinbaseScript = s.cfg.CPUMiner.CoinbaseScript()
+			if coinbaseScript == nil {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInternal.Code,
+					Message: "A coinbase transaction has been requested, " +
+						"but the server has not been configured with " +
+						"any payment addresses via --miningaddr or --coinbasepayout",
+				}
+			}
+		} else {
+			// the coinbase of the template pays to the payouts already
+			coinbaseScript = []byte{}
+		}
+	}
+
 	// todo handle connMan exception
 	if blockchain.IsInitialBlockDownload() {
 		return nil, &btcjson.RPCError{
@@ -310,52 +419,43 @@ func handleGetBlockTemplateRequest(request *btcjson.TemplateRequest, closeChan <
 	if request.LongPollID != "" {
 		// Wait to respond until either the best block changes, OR a minute has
 		// passed and there are more transactions
-		//var hashWatchedChain utils.Hash
-		//checktxtime := time.Now()
-		//transactionsUpdatedLastLP := 0
-		// todo complete
-	}
-
-	if indexPrev != core.ActiveChain.Tip() ||
-		blockchain.GMemPool.TransactionsUpdated != transactionsUpdatedLast &&
-			utils.GetMockTime()-start > 5 {
-
-		// Clear pindexPrev so future calls make a new block, despite any
-		// failures from here on
-		indexPrev = nil
-		// Store the pindexBest used before CreateNewBlock, to avoid races
-		transactionsUpdatedLast = blockchain.GMemPool.TransactionsUpdated
-		indexPrevNew := blockchain.GChainActive.Tip()
-		start = utils.GetMockTime()
-
-		// Create new block
-		scriptDummy := core.Script{}
-		scriptDummy.PushOpCode(core.OP_TRUE)
-		ba := mining.NewBlockAssembler(msg.ActiveNetParams)
-		blocktemplate = ba.CreateNewBlock()
-		if blocktemplate == nil {
+		prevHash, lastTxUpdate, err := decodeTemplateID(request.LongPollID)
+		if err != nil {
 			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrUnDefined,
-				Message: "Out of memory",
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
 			}
 		}
-
-		// Need to update only after we know CreateNewBlock succeeded
-		indexPrev = indexPrevNew
+		if err := waitLongPoll(prevHash, lastTxUpdate, closeChan); err != nil {
+			return nil, err
+		}
 	}
-	block := blocktemplate.Block
-	block.UpdateTime(indexPrev)
-	block.BlockHeader.Nonce = 0
 
-	return blockTemplateResult(blocktemplate, setClientRules, maxVersionVb, transactionsUpdatedLast)
+	state := s.gbtWorkState
+	state.Lock()
+	defer state.Unlock()
+
+	if err := state.updateBlockTemplate(); err != nil {
+		return nil, err
+	}
+	return state.blockTemplateResult(setClientRules, maxVersionVb, request.ShowStrategy, coinbaseScript)
 }
 
 // blockTemplateResult returns the current block template associated with the
 // state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
 // and returned to the caller.
 //
+// The strategy which selected each transaction is reported when showStrategy
+// is set.  A nil coinbaseScript returns the coinbase value, otherwise the
+// coinbase transaction of the template is returned, paying to coinbaseScript
+// or, when it is empty, keeping the outputs of the template.
+//
 // This function MUST be called with the state locked.
-func blockTemplateResult(bt *mining.BlockTemplate, s *set.Set, maxVersionVb uint32, transactionsUpdatedLast uint64) (*btcjson.GetBlockTemplateResult, error) {
+func (state *gbtWorkState) blockTemplateResult(s *set.Set, maxVersionVb uint32, showStrategy bool,
+	coinbaseScript []byte) (*btcjson.GetBlockTemplateResult, error) {
+
+	bt := state.template
+	indexPrev := state.indexPrev
 	setTxIndex := make(map[utils.Hash]int)
 	var i int
 	transactions := make([]btcjson.GetBlockTemplateResultTx, 0, len(bt.Block.Txs))
@@ -386,8 +486,11 @@ func blockTemplateResult(bt *mining.BlockTemplate, s *set.Set, maxVersionVb uint
 		entry.Depends = deps
 
 		indexInTemplate := i - 1
-		entry.Fee = int64(blocktemplate.TxFees[indexInTemplate])
-		entry.SigOps = int64(blocktemplate.TxSigOpsCount[indexInTemplate])
+		entry.Fee = int64(bt.TxFees[indexInTemplate])
+		entry.SigOps = int64(bt.TxSigOpsCount[indexInTemplate])
+		if showStrategy {
+			entry.Strategy = bt.TxStrategies[indexInTemplate]
+		}
 
 		transactions = append(transactions, entry)
 	}
@@ -450,19 +553,17 @@ func blockTemplateResult(bt *mining.BlockTemplate, s *set.Set, maxVersionVb uint
 		mutable = append(mutable, "version/force")
 	}
 
-	return &btcjson.GetBlockTemplateResult{
-		Capabilities:  []string{"proposal"},
-		Version:       bt.Block.BlockHeader.Version,
-		Rules:         rules,
-		VbAvailable:   vbAvailable,
-		VbRequired:    0,
-		PreviousHash:  bt.Block.Hash.ToString(),
-		Transactions:  transactions,
-		CoinbaseAux:   &btcjson.GetBlockTemplateResultAux{Flags: mining.CoinbaseFlag},
-		CoinbaseValue: &bt.Block.Txs[0].Outs[0].Value,
+	reply := &btcjson.GetBlockTemplateResult{
+		Capabilities: []string{"proposal"},
+		Version:      bt.Block.BlockHeader.Version,
+		Rules:        rules,
+		VbAvailable:  vbAvailable,
+		VbRequired:   0,
+		PreviousHash: state.prevHash.ToString(),
+		Transactions: transactions,
+		CoinbaseAux:  &btcjson.GetBlockTemplateResultAux{Flags: hex.EncodeToString([]byte(mining.CoinbaseFlag()))},
 
-		// todo debug LongPollID(different from btcd)
-		LongPollID: core.ActiveChain.Tip().GetBlockHash().ToString() + fmt.Sprintf("%d", transactionsUpdatedLast),
+		LongPollID: templateID(state.prevHash, state.lastTxUpdate),
 		Target:     blockchain.CompactToBig(bt.Block.BlockHeader.Bits).String(),
 		MinTime:    indexPrev.GetMedianTimePast() + 1,
 		Mutable:    mutable,
@@ -473,7 +574,33 @@ func blockTemplateResult(bt *mining.BlockTemplate, s *set.Set, maxVersionVb uint
 		CurTime:    int64(bt.Block.BlockHeader.Time),
 		Bits:       fmt.Sprintf("%08x", bt.Block.BlockHeader.Bits),
 		Height:     int64(indexPrev.Height) + 1,
-	}, nil
+	}
+
+	if coinbaseScript == nil {
+		coinbaseValue := bt.Block.Txs[0].GetValueOut()
+		reply.CoinbaseValue = &coinbaseValue
+		return reply, nil
+	}
+
+	coinbaseTx := bt.Block.Txs[0].Copy()
+	if len(coinbaseScript) > 0 {
+		coinbaseTx.Outs[0].Script = core.NewScriptRaw(coinbaseScript)
+		coinbaseTx.Hash = utils.HashZero
+	}
+	dataBuf := bytes.NewBuffer(nil)
+	if err := coinbaseTx.Serialize(dataBuf); err != nil {
+		return nil, internalRPCError("Failed to serialize coinbase transaction: "+err.Error(), "")
+	}
+	coinbaseHash := coinbaseTx.TxHash()
+	reply.CoinbaseTxn = &btcjson.GetBlockTemplateResultTx{
+		Data:    hex.EncodeToString(dataBuf.Bytes()),
+		TxID:    coinbaseHash.ToString(),
+		Hash:    coinbaseHash.ToString(),
+		Depends: []int{},
+		Fee:     int64(bt.TxFees[0]),
+		SigOps:  int64(bt.TxSigOpsCount[0]),
+	}
+	return reply, nil
 }
 
 func getVbName(pos consensus.DeploymentPos) string {
@@ -615,57 +742,113 @@ func handleSubmitBlock(s *Server, cmd interface{}, closeChan <-chan struct{}) (i
 
 	// Process this block using the same rules as blocks coming from other
 	// nodes.  This will in turn relay it to the network like normal.
-	//_, err = s.cfg.SyncMgr.SubmitBlock(block, blockchain.BFNone)       // TODO
-	if err != nil {
-		return fmt.Sprintf("rejected: %s", err.Error()), nil
+	accepted := blockchain.ProcessNewBlock(msg.ActiveNetParams, block, true, nil)
+
+	// The block may have changed the tip and taken transactions out of the
+	// mempool even when it was not accepted as the new best block, so the
+	// cached template can't be trusted either way.
+	s.gbtWorkState.invalidate()
+	if !accepted {
+		return "rejected", nil
 	}
 
-	logs.Info("Accepted block %s via submitblock", block.Hash)
+	blockHash, _ := block.BlockHeader.GetHash()
+	logs.Info("Accepted block %s via submitblock", blockHash.ToString())
 
 	return nil, nil
 }
 
-func handleGenerate(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	//c := cmd.(*btcjson.GenerateCmd)
-	//
-	//var maxTries uint64
-	//maxTries = 1000000
-	//if c.MaxTries != 0 {
-	//	maxTries = c.MaxTries
-	//}
-
-	//core.Script{}
-	/*	// Respond with an error if the client is requesting 0 blocks to be generated.
-		if c.NumBlocks == 0 {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInternal.Code,
-				Message: "Please request a nonzero number of blocks to generate.",
-			}
-		}
+// handleSetCoinbaseCommitments implements the setcoinbasecommitments command.
+func handleSetCoinbaseCommitments(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetCoinbaseCommitmentsCmd)
 
-		// Create a reply
-		reply := make([]string, c.NumBlocks)
-
-		blockHashes, err := s.cfg.CPUMiner.GenerateNBlocks(c.NumBlocks)
+	commitments := make([][]byte, 0, len(c.Commitments))
+	for _, str := range c.Commitments {
+		data, err := hex.DecodeString(str)
 		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInternal.Code,
-				Message: err.Error(),
-			}
+			return nil, rpcDecodeHexError(str)
 		}
-
-		// Mine the correct number of blocks, assigning the hex representation of the
-		// hash of each one to its place in the reply.
-		for i, hash := range blockHashes {
-			reply[i] = hash.String()
+		commitments = append(commitments, data)
+	}
+	if err := mining.SetCoinbaseCommitments(commitments); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
 		}
+	}
 
-		return reply, nil*/
+	// Templates built before don't carry the new commitments.
+	s.gbtWorkState.invalidate()
 	return nil, nil
 }
 
+// handleGenerate implements the generate command.
+func handleGenerate(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GenerateCmd)
+
+	coinbaseScript := s.cfg.CPUMiner.CoinbaseScript()
+	if coinbaseScript == nil && len(mining.CoinbasePayouts()) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "No payment addresses specified via --miningaddr",
+		}
+	}
+
+	return generateBlocks(s, c.NumBlocks, coinbaseScript, *c.MaxTries)
+}
+
+// handleGeneratetoaddress implements the generatetoaddress command.
 func handleGeneratetoaddress(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+
+	addr, err := core.AddressFromString(c.Address)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Error: Invalid address",
+		}
+	}
+	coinbaseScript, err := addr.ScriptPubKey()
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Error: " + err.Error(),
+		}
+	}
+
+	return generateBlocks(s, c.NumBlocks, coinbaseScript, *c.MaxTries)
+}
+
+// generateBlocks mines numBlocks blocks paying to coinbaseScript with the
+// server's CPU miner and returns the hex encoded hashes of the blocks found.
+func generateBlocks(s *Server, numBlocks uint32, coinbaseScript []byte, maxTries uint64) (interface{}, error) {
+	// Respond with an error if the network does not mine blocks on demand.
+	if !msg.ActiveNetParams.MineBlocksOnDemands {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMethodNotFound.Code,
+			Message: "No support for `generate` on the current network, " + msg.ActiveNetParams.Name,
+		}
+	}
+
+	blockHashes, err := s.cfg.CPUMiner.GenerateNBlocks(numBlocks, coinbaseScript, maxTries)
+	if len(blockHashes) > 0 {
+		s.gbtWorkState.invalidate()
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	// Mine the correct number of blocks, assigning the hex representation of the
+	// hash of each one to its place in the reply.
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.ToString()
+	}
+
+	return reply, nil
 }
 
 func handleEstimatefee(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
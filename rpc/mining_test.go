@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mining"
+	"github.com/btcboost/copernicus/utils"
+)
+
+func TestTemplateID(t *testing.T) {
+	hash, err := utils.GetHashFromStr(restTestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint64{0, 1, 12345, math.MaxUint64} {
+		id := templateID(hash, seq)
+		prevHash, lastTxUpdate, err := decodeTemplateID(id)
+		if err != nil {
+			t.Errorf("%s: %v", id, err)
+			continue
+		}
+		if !prevHash.IsEqual(hash) || lastTxUpdate != seq {
+			t.Errorf("%s decoded to %s, %d", id, prevHash.ToString(), lastTxUpdate)
+		}
+	}
+
+	malformed := []string{
+		"",
+		restTestHash,
+		restTestHash[:63] + "1",
+		strings.Repeat("z", 64) + "1",
+		restTestHash + "x",
+		restTestHash + "-1",
+		restTestHash + "18446744073709551616",
+	}
+	for _, id := range malformed {
+		if _, _, err := decodeTemplateID(id); err == nil {
+			t.Errorf("malformed longpollid %q accepted", id)
+		}
+	}
+}
+
+// setTestTip makes a block index of height with a hash ending in b the tip of
+// the active chain.
+func setTestTip(height int, b byte) *core.BlockIndex {
+	index := core.NewBlockIndex(&core.BlockHeader{Time: uint32(time.Now().Unix())})
+	index.Height = height
+	index.BlockHash[0] = b
+	blockchain.GChainActive.SetTip(index)
+	return index
+}
+
+// bumpMempool simulates a change of the transactions in the mempool.
+func bumpMempool() {
+	blockchain.GMemPool.Lock()
+	blockchain.GMemPool.TransactionsUpdated++
+	blockchain.GMemPool.Unlock()
+}
+
+// saveMiningState saves the chain tip and the mempool sequence and returns a
+// function restoring them.
+func saveMiningState() func() {
+	tip := blockchain.GChainActive.Tip()
+	seq := blockchain.GMemPool.GetTransactionsUpdated()
+	return func() {
+		blockchain.GChainActive.SetTip(tip)
+		blockchain.GMemPool.Lock()
+		blockchain.GMemPool.TransactionsUpdated = seq
+		blockchain.GMemPool.Unlock()
+	}
+}
+
+func TestUpdateBlockTemplate(t *testing.T) {
+	defer saveMiningState()()
+
+	generated := 0
+	state := newGbtWorkState()
+	state.newTemplate = func(coinbaseScript []byte) *mining.BlockTemplate {
+		generated++
+		return &mining.BlockTemplate{Block: core.NewBlock()}
+	}
+	update := func() {
+		state.Lock()
+		defer state.Unlock()
+		if err := state.updateBlockTemplate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blockchain.GChainActive.SetTip(nil)
+	state.Lock()
+	if err := state.updateBlockTemplate(); err == nil {
+		t.Error("template created without a chain tip")
+	}
+	state.Unlock()
+
+	tip := setTestTip(0, 1)
+	update()
+	update()
+	if generated != 1 {
+		t.Fatalf("%d templates generated for an unchanged tip and mempool", generated)
+	}
+	if state.indexPrev != tip || !state.prevHash.IsEqual(tip.GetBlockHash()) {
+		t.Errorf("template built on %v, want %v", state.indexPrev, tip)
+	}
+
+	// A mempool change is only picked up gbtRegenerateSeconds after the
+	// last template.
+	bumpMempool()
+	update()
+	if generated != 1 {
+		t.Error("template regenerated right after the previous one")
+	}
+	state.lastGenerated = state.lastGenerated.Add(-(gbtRegenerateSeconds + 1) * time.Second)
+	update()
+	if generated != 2 {
+		t.Error("template not regenerated after a mempool change")
+	}
+	if state.lastTxUpdate != blockchain.GMemPool.GetTransactionsUpdated() {
+		t.Errorf("template of mempool sequence %d", state.lastTxUpdate)
+	}
+
+	// A new tip gives a new template at once.
+	tip = setTestTip(1, 2)
+	update()
+	if generated != 3 || state.indexPrev != tip {
+		t.Error("template not regenerated after a tip change")
+	}
+
+	state.invalidate()
+	update()
+	if generated != 4 {
+		t.Error("template not regenerated after invalidate")
+	}
+}
+
+// withLongPollTimings shortens the long polling timings for a test and
+// returns a function restoring them.
+func withLongPollTimings(txWait, checkInterval, timeout time.Duration) func() {
+	savedTxWait, savedCheckInterval, savedTimeout := gbtLongPollTxWait,
+		gbtLongPollCheckInterval, gbtLongPollTimeout
+	gbtLongPollTxWait, gbtLongPollCheckInterval, gbtLongPollTimeout = txWait, checkInterval, timeout
+	return func() {
+		gbtLongPollTxWait, gbtLongPollCheckInterval, gbtLongPollTimeout = savedTxWait,
+			savedCheckInterval, savedTimeout
+	}
+}
+
+// testLongPollState is the chain tip and mempool sequence seen by the long
+// polling requests of a test.
+type testLongPollState struct {
+	sync.Mutex
+	tip      utils.Hash
+	txUpdate uint64
+}
+
+// useTestLongPollState makes the long polling requests see a tip ending in b
+// and returns a function restoring the state they see.
+func useTestLongPollState(b byte) (*testLongPollState, func()) {
+	state := &testLongPollState{}
+	state.tip[0] = b
+	saved := longPollState
+	longPollState = func() (*utils.Hash, uint64) {
+		state.Lock()
+		defer state.Unlock()
+		tip := state.tip
+		return &tip, state.txUpdate
+	}
+	return state, func() {
+		longPollState = saved
+	}
+}
+
+// setTip makes the tip end in b.
+func (state *testLongPollState) setTip(b byte) {
+	state.Lock()
+	state.tip[0] = b
+	state.Unlock()
+}
+
+// bumpMempool simulates a change of the transactions in the mempool.
+func (state *testLongPollState) bumpMempool() {
+	state.Lock()
+	state.txUpdate++
+	state.Unlock()
+}
+
+// waitLongPollAsync runs waitLongPoll for the current tip and mempool and
+// returns a channel receiving its result.
+func (state *testLongPollState) waitLongPollAsync(closeChan <-chan struct{}) <-chan error {
+	prevHash, lastTxUpdate := longPollState()
+	done := make(chan error, 1)
+	go func() {
+		done <- waitLongPoll(prevHash, lastTxUpdate, closeChan)
+	}()
+	return done
+}
+
+// expectLongPoll fails the test when done doesn't deliver want within wait.
+func expectLongPoll(t *testing.T, name string, done <-chan error, want error, wait time.Duration) {
+	select {
+	case err := <-done:
+		if err != want {
+			t.Errorf("%s: long poll returned %v, want %v", name, err, want)
+		}
+	case <-time.After(wait):
+		t.Errorf("%s: long poll not answered", name)
+	}
+}
+
+// expectLongPollWaiting fails the test when done delivers within wait.
+func expectLongPollWaiting(t *testing.T, name string, done <-chan error, wait time.Duration) {
+	select {
+	case err := <-done:
+		t.Errorf("%s: long poll answered early with %v", name, err)
+	case <-time.After(wait):
+	}
+}
+
+func TestWaitLongPoll(t *testing.T) {
+	defer withLongPollTimings(200*time.Millisecond, 10*time.Millisecond, time.Minute)()
+	state, restore := useTestLongPollState(1)
+	defer restore()
+
+	// An outdated template is answered at once.
+	stale, lastTxUpdate := longPollState()
+	state.setTip(2)
+	if err := waitLongPoll(stale, lastTxUpdate, nil); err != nil {
+		t.Errorf("long poll on a stale tip: %v", err)
+	}
+
+	// A new tip wakes the request.
+	done := state.waitLongPollAsync(nil)
+	expectLongPollWaiting(t, "tip", done, 50*time.Millisecond)
+	state.setTip(3)
+	expectLongPoll(t, "tip", done, nil, time.Second)
+
+	// A mempool change wakes it only after gbtLongPollTxWait.
+	start := time.Now()
+	done = state.waitLongPollAsync(nil)
+	state.bumpMempool()
+	expectLongPoll(t, "mempool", done, nil, time.Second)
+	if waited := time.Since(start); waited < gbtLongPollTxWait {
+		t.Errorf("mempool change answered after %v, want %v", waited, gbtLongPollTxWait)
+	}
+
+	// A client going away ends the request.
+	closeChan := make(chan struct{})
+	done = state.waitLongPollAsync(closeChan)
+	expectLongPollWaiting(t, "quit", done, 50*time.Millisecond)
+	close(closeChan)
+	expectLongPoll(t, "quit", done, ErrClientQuit, time.Second)
+
+	// Nothing changing, the request is answered after gbtLongPollTimeout.
+	gbtLongPollTimeout = 100 * time.Millisecond
+	done = state.waitLongPollAsync(nil)
+	expectLongPoll(t, "timeout", done, nil, time.Second)
+}
@@ -1,5 +1,16 @@
 package rpc
 
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/conf"
+	"github.com/btcboost/copernicus/net/network"
+	"github.com/btcboost/copernicus/net/p2p"
+)
+
 var netHandlers = map[string]commandHandler{
 	"getconnectioncount": handleGetConnectionCount,
 	"ping":               handlePing,
@@ -13,6 +24,8 @@ var netHandlers = map[string]commandHandler{
 	"listbanned":         handleListbanned,
 	"clearbanned":        handleClearbanned,
 	"setnetworkactive":   handleSetnetworkactive,
+	"getnodeaddresses":   handleGetNodeAddresses,
+	"addpeeraddress":     handleAddPeerAddress,
 }
 
 func handleGetConnectionCount(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -36,45 +49,50 @@ func handlePing(s *Server, cmd interface{}, closeChan <-chan struct{}) (interfac
 }
 
 func handleGetPeerInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/*
-		peers := s.cfg.ConnMgr.ConnectedPeers()
-		syncPeerID := s.cfg.SyncMgr.SyncPeerID()
-		infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
-		for _, p := range peers {
-			statsSnap := p.ToPeer().StatsSnapshot()
-			info := &btcjson.GetPeerInfoResult{
-				ID:             statsSnap.ID,
-				Addr:           statsSnap.Addr,
-				AddrLocal:      p.ToPeer().LocalAddr().String(),
-				Services:       fmt.Sprintf("%08d", uint64(statsSnap.Services)),
-				RelayTxes:      !p.IsTxRelayDisabled(),
-				LastSend:       statsSnap.LastSend.Unix(),
-				LastRecv:       statsSnap.LastRecv.Unix(),
-				BytesSent:      statsSnap.BytesSent,
-				BytesRecv:      statsSnap.BytesRecv,
-				ConnTime:       statsSnap.ConnTime.Unix(),
-				PingTime:       float64(statsSnap.LastPingMicros),
-				TimeOffset:     statsSnap.TimeOffset,
-				Version:        statsSnap.Version,
-				SubVer:         statsSnap.UserAgent,
-				Inbound:        statsSnap.Inbound,
-				StartingHeight: statsSnap.StartingHeight,
-				CurrentHeight:  statsSnap.LastBlock,
-				BanScore:       int32(p.BanScore()),
-				FeeFilter:      p.FeeFilter(),
-				SyncNode:       statsSnap.ID == syncPeerID,
-			}
-			if p.ToPeer().LastPingNonce() != 0 {
-				wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
-				// We actually want microseconds.
-				info.PingWait = wait / 1000
-			}
-			infos = append(infos, info)
+	peers := s.cfg.ConnMgr.ConnectedPeers()
+	var syncPeerID int32
+	if s.cfg.SyncMgr != nil {
+		syncPeerID = s.cfg.SyncMgr.SyncPeerID()
+	}
+	infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
+	for _, p := range peers {
+		statsSnap := p.ToPeer().StatsSnapshot()
+		info := &btcjson.GetPeerInfoResult{
+			ID:             statsSnap.ID,
+			Addr:           statsSnap.Addr,
+			Services:       fmt.Sprintf("%08d", uint64(statsSnap.Services)),
+			RelayTxes:      !p.IsTxRelayDisabled(),
+			LastSend:       statsSnap.LastSend.Unix(),
+			LastRecv:       statsSnap.LastRecv.Unix(),
+			BytesSent:      statsSnap.BytesSent,
+			BytesRecv:      statsSnap.BytesRecv,
+			ConnTime:       statsSnap.ConnTime.Unix(),
+			PingTime:       float64(statsSnap.LastPingMicros),
+			TimeOffset:     statsSnap.TimeOffset,
+			Version:        statsSnap.Version,
+			SubVer:         statsSnap.UserAgent,
+			Inbound:        statsSnap.Inbound,
+			StartingHeight: statsSnap.StartingHeight,
+			CurrentHeight:  statsSnap.LastBlock,
+			BanScore:       int32(p.BanScore()),
+			FeeFilter:      p.FeeFilter(),
+			SyncNode:       statsSnap.ID == syncPeerID,
+			MappedAS:       p.MappedAS(),
+			ConnectionType: p.ConnectionType(),
+			Permissions:    p.Permissions(),
 		}
-		return infos, nil
-	*/
-
-	return nil, nil
+		info.BytesSentPerMsg, info.BytesRecvPerMsg = p.BytesPerMessage()
+		if localAddr := p.ToPeer().LocalAddr(); localAddr != nil {
+			info.AddrLocal = localAddr.String()
+		}
+		if statsSnap.LastPingNonce != 0 {
+			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
+			// We actually want microseconds.
+			info.PingWait = wait / 1000
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
 }
 
 func handleAddNode(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -207,35 +225,182 @@ func handleGetAddedNodeInfo(s *Server, cmd interface{}, closeChan <-chan struct{
 	return nil, nil
 }
 
+// handleGetNetTotals implements the getnettotals command.
 func handleGetNetTotals(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/*
-			totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
-			reply := &btcjson.GetNetTotalsResult{
-				TotalBytesRecv: totalBytesRecv,
-				TotalBytesSent: totalBytesSent,
-				TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
-			}
-		}
-	*/
-	return nil, nil
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+	totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
+	uploadTarget := s.cfg.ConnMgr.UploadTarget()
+	evictionStats := s.cfg.ConnMgr.EvictionStats()
+	reply := &btcjson.GetNetTotalsResult{
+		TotalBytesRecv: totalBytesRecv,
+		TotalBytesSent: totalBytesSent,
+		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		UploadTarget: btcjson.UploadTargetResult{
+			Timeframe:             int64(uploadTarget.Timeframe / time.Second),
+			Target:                uploadTarget.Target,
+			TargetReached:         uploadTarget.TargetReached,
+			ServeHistoricalBlocks: uploadTarget.ServeHistoricalBlocks,
+			BytesLeftInCycle:      uploadTarget.BytesLeftInCycle,
+			TimeLeftInCycle:       int64(uploadTarget.TimeLeftInCycle / time.Second),
+		},
+		InboundEvicted:  evictionStats.Evicted,
+		InboundRejected: evictionStats.Rejected,
+	}
+	return reply, nil
 }
 
 func handleGetnetworkinfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return nil, nil
 }
 
+// errP2PDisabled is returned by the commands which need the peer-to-peer
+// functionality when it isn't available.
+var errP2PDisabled = &btcjson.RPCError{
+	Code:    btcjson.ErrRPCClientP2PDisabled,
+	Message: "Error: Peer-to-peer functionality missing or disabled",
+}
+
 func handleSetban(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetBanCmd)
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+
+	subnet, err := p2p.ParseSubnet(c.SubNet)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+			Message: "Error: Invalid IP/Subnet",
+		}
+	}
+
+	switch c.Command {
+	case btcjson.SBAdd:
+		if s.cfg.ConnMgr.IsBanned(subnet) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientNodeAlreadyAdded,
+				Message: "Error: IP/Subnet already banned",
+			}
+		}
+
+		// A ban time of 0 bans for the default duration, an absolute ban
+		// time is the unix time the ban ends at.
+		banUntil := time.Now().Add(conf.AppConf.BanDuration)
+		if c.BanTime != nil && *c.BanTime > 0 {
+			if c.Absolute != nil && *c.Absolute {
+				banUntil = time.Unix(*c.BanTime, 0)
+			} else {
+				banUntil = time.Now().Add(time.Duration(*c.BanTime) * time.Second)
+			}
+		}
+		if err := s.cfg.ConnMgr.SetBan(subnet, banUntil); err != nil {
+			return nil, internalRPCError(err.Error(), "Failed to ban "+subnet.String())
+		}
+
+	case btcjson.SBRemove:
+		if err := s.cfg.ConnMgr.Unban(subnet); err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+				Message: "Error: Unban failed. Requested address/subnet was not previously banned.",
+			}
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	// no data returned unless an error.
 	return nil, nil
 }
 
 func handleListbanned(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return nil, nil
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+
+	entries := s.cfg.ConnMgr.ListBanned()
+	results := make([]*btcjson.ListBannedResult, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, &btcjson.ListBannedResult{
+			Address:     entry.Subnet.String(),
+			BannedUntil: entry.BanUntil.Unix(),
+			BanCreated:  entry.CreateTime.Unix(),
+			BanReason:   entry.Reason.String(),
+		})
+	}
+	return results, nil
 }
 
 func handleClearbanned(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+
+	if err := s.cfg.ConnMgr.ClearBanned(); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to clear the bans")
+	}
 	return nil, nil
 }
 
+func handleGetNodeAddresses(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetNodeAddressesCmd)
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+
+	count := int32(1)
+	if c.Count != nil {
+		count = *c.Count
+	}
+	if count < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Address count out of range",
+		}
+	}
+
+	// A count of 0 returns all the addresses the selection is made of.
+	addresses := s.cfg.ConnMgr.NodeAddresses()
+	if count > 0 && int(count) < len(addresses) {
+		addresses = addresses[:count]
+	}
+	results := make([]*btcjson.GetNodeAddressesResult, 0, len(addresses))
+	for _, address := range addresses {
+		results = append(results, &btcjson.GetNodeAddressesResult{
+			Time:     address.Timestamp.Unix(),
+			Services: uint64(address.ServicesFlag),
+			Address:  address.IPString(),
+			Port:     address.Port,
+		})
+	}
+	return results, nil
+}
+
+func handleAddPeerAddress(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.AddPeerAddressCmd)
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
+
+	ip := net.ParseIP(c.Address)
+	if ip == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid IP address: " + c.Address,
+		}
+	}
+	address := network.NewPeerAddressIPPort(p2p.DefaultServices, ip, c.Port)
+	tried := c.Tried != nil && *c.Tried
+	return &btcjson.AddPeerAddressResult{
+		Success: s.cfg.ConnMgr.AddPeerAddress(address, tried),
+	}, nil
+}
+
 func handleSetnetworkactive(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return nil, nil
 }
@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/net/p2p"
+)
+
+// testConnManager is a connection manager answering the traffic statistics,
+// the other methods are not implemented.
+type testConnManager struct {
+	ServerConnManager
+	uploadTarget  p2p.UploadTargetStats
+	evictionStats p2p.EvictionStats
+}
+
+func (cm *testConnManager) NetTotals() (uint64, uint64) {
+	return 1000, 2000
+}
+
+func (cm *testConnManager) UploadTarget() p2p.UploadTargetStats {
+	return cm.uploadTarget
+}
+
+func (cm *testConnManager) EvictionStats() p2p.EvictionStats {
+	return cm.evictionStats
+}
+
+func TestGetNetTotals(t *testing.T) {
+	if _, err := handleGetNetTotals(&Server{}, &btcjson.GetNetTotalsCmd{}, nil); err != errP2PDisabled {
+		t.Errorf("getnettotals without the peer-to-peer network: %v", err)
+	}
+
+	connMgr := &testConnManager{
+		uploadTarget: p2p.UploadTargetStats{
+			Timeframe:        24 * time.Hour,
+			Target:           5000,
+			BytesLeftInCycle: 3000,
+			TimeLeftInCycle:  time.Hour,
+		},
+		evictionStats: p2p.EvictionStats{Evicted: 3, Rejected: 2},
+	}
+	s := &Server{cfg: ServerConfig{ConnMgr: connMgr}}
+	reply, err := handleGetNetTotals(s, &btcjson.GetNetTotalsCmd{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := reply.(*btcjson.GetNetTotalsResult)
+	if totals.TotalBytesRecv != 1000 || totals.TotalBytesSent != 2000 {
+		t.Errorf("%d bytes received and %d sent", totals.TotalBytesRecv, totals.TotalBytesSent)
+	}
+	if totals.UploadTarget.Timeframe != 86400 || totals.UploadTarget.Target != 5000 ||
+		totals.UploadTarget.BytesLeftInCycle != 3000 || totals.UploadTarget.TimeLeftInCycle != 3600 {
+		t.Errorf("upload target %+v", totals.UploadTarget)
+	}
+	if totals.InboundEvicted != 3 || totals.InboundRejected != 2 {
+		t.Errorf("%d inbound peers evicted and %d rejected, want 3 and 2",
+			totals.InboundEvicted, totals.InboundRejected)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 
+	"github.com/astaxie/beego/logs"
 	"github.com/btcboost/copernicus/blockchain"
 	"github.com/btcboost/copernicus/btcjson"
 	"github.com/btcboost/copernicus/core"
@@ -415,9 +416,14 @@ func handleDecodeScript(s *Server, cmd interface{}, closeChan <-chan struct{}) (
 	return nil, nil
 }
 
+// handleSendRawTransaction submits the transaction to the node, which relays
+// it along the Dandelion stem when enabled, and announces it to all the peers
+// otherwise.
 func handleSendRawTransaction(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/* c := cmd.(*btcjson.SendRawTransactionCmd)
-	// Deserialize and send off to tx relay
+	c := cmd.(*btcjson.SendRawTransactionCmd)
+	if s.cfg.ConnMgr == nil {
+		return nil, errP2PDisabled
+	}
 	hexStr := c.HexTx
 	if len(hexStr)%2 != 0 {
 		hexStr = "0" + hexStr
@@ -426,71 +432,23 @@ func handleSendRawTransaction(s *Server, cmd interface{}, closeChan <-chan struc
 	if err != nil {
 		return nil, rpcDecodeHexError(hexStr)
 	}
-	var msgTx msg.TxMessage
-	err = msgTx.BitcoinParse(bytes.NewReader(serializedTx),0)
+	tx, err := core.DeserializeTx(bytes.NewReader(serializedTx))
 	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
 			Message: "TX decode failed: " + err.Error(),
 		}
 	}
-
-	// Use 0 for the tag to represent local node.
-	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(msgTx.Tx, false, false, 0)
-	blockchain.
-	if err != nil {
-		// When the error is a rule error, it means the transaction was
-		// simply rejected as opposed to something actually going wrong,
-		// so log it as such.  Otherwise, something really did go wrong,
-		// so log it as an actual error.  In both cases, a JSON-RPC
-		// error is returned to the client with the deserialization
-		// error code (to match bitcoind behavior).
-		if _, ok := err.(mempool.RuleError); ok {
-			logs.Debug("Rejected transaction %v: %v", tx.Hash(),
-				err)
-		} else {
-			logs.Error("Failed to process transaction %v: %v",
-				tx.Hash(), err)
-		}
+	txHash := tx.TxHash()
+	if err := s.cfg.ConnMgr.SubmitTransaction(tx); err != nil {
+		logs.Debug("Rejected transaction %s: %v", txHash.ToString(), err)
 		return nil, &btcjson.RPCError{
-			Code:    btcjson.ErrRPCDeserialization,
+			Code:    btcjson.ErrRPCVerify,
 			Message: "TX rejected: " + err.Error(),
 		}
 	}
-
-	// When the transaction was accepted it should be the first item in the
-	// returned array of accepted transactions.  The only way this will not
-	// be true is if the API for ProcessTransaction changes and this code is
-	// not properly updated, but ensure the condition holds as a safeguard.
-	//
-	// Also, since an error is being returned to the caller, ensure the
-	// transaction is removed from the memory pool.
-	if len(acceptedTxs) == 0 || !acceptedTxs[0].Tx.Hash().IsEqual(tx.Hash()) {
-		s.cfg.TxMemPool.RemoveTransaction(tx, true)
-
-		errStr := fmt.Sprintf("transaction %v is not in accepted list",
-			tx.Hash())
-		return nil, internalRPCError(errStr, "")
-	}
-
-	// Generate and relay inventory vectors for all newly accepted
-	// transactions into the memory pool due to the original being
-	// accepted.
-	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
-
-	// Notify both websocket and getblocktemplate long poll clients of all
-	// newly accepted transactions.
-	s.NotifyNewTransactions(acceptedTxs)
-
-	// Keep track of all the sendrawtransaction request txns so that they
-	// can be rebroadcast if they don't make their way into a block.
-	txD := acceptedTxs[0]
-	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
-	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
-
-	return tx.Hash().String(), nil*/
-	return nil, nil
-} //Todo
+	return txHash.ToString(), nil
+}
 
 func handleSignRawTransaction(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return nil, nil
@@ -0,0 +1,540 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/blockchain"
+	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/mempool"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+	"github.com/btcboost/copernicus/utxo"
+)
+
+const (
+	// restMaxHeaders is the maximum number of headers returned by a
+	// single headers query.
+	restMaxHeaders = 2000
+
+	// restMaxGetUTXOsOutpoints is the maximum number of outpoints a single
+	// getutxos query may ask for.
+	restMaxGetUTXOsOutpoints = 15
+
+	// restReadTimeout is the time a client has to send its request.
+	restReadTimeout = 10 * time.Second
+)
+
+// restFormat is the encoding of a REST reply, selected by the extension of
+// the requested resource.
+type restFormat int
+
+const (
+	restFormatBinary restFormat = iota
+	restFormatHex
+	restFormatJSON
+)
+
+var restFormats = map[string]restFormat{
+	"bin":  restFormatBinary,
+	"hex":  restFormatHex,
+	"json": restFormatJSON,
+}
+
+// restAvailableFormats is appended to errors about unknown formats.
+const restAvailableFormats = ".bin, .hex, .json"
+
+// restHandler serves the resource named by param, which is the request path
+// with the endpoint prefix and the format extension removed.
+type restHandler func(w http.ResponseWriter, param string, format restFormat)
+
+// restEndpoints maps the path prefixes of the REST interface to their
+// handlers.  The first matching prefix wins, so longer prefixes come first.
+var restEndpoints = []struct {
+	prefix  string
+	handler restHandler
+}{
+	{"/rest/block/notxdetails/", restBlockNoTxDetails},
+	{"/rest/block/", restBlockExtended},
+	{"/rest/tx/", restTx},
+	{"/rest/headers/", restHeaders},
+	{"/rest/chaininfo", restChainInfo},
+	{"/rest/mempool/info", restMempoolInfo},
+	{"/rest/mempool/contents", restMempoolContents},
+	{"/rest/getutxos", restGetUTXOs},
+}
+
+// RestServer serves public chain data over unauthenticated HTTP, following
+// the REST interface of Bitcoin Core.  It never changes the state of the
+// node and is only started when enabled with --rest.
+type RestServer struct {
+	started  int32
+	shutdown int32
+	addr     string
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// NewRestServer returns a REST server which will listen on addr.
+func NewRestServer(addr string) *RestServer {
+	return &RestServer{addr: addr}
+}
+
+// Start begins accepting REST requests.
+func (s *RestServer) Start() error {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for REST requests on %s: %v", s.addr, err)
+	}
+	s.listener = listener
+
+	restServeMux := http.NewServeMux()
+	restServeMux.HandleFunc("/rest/", serveRest)
+	httpServer := &http.Server{
+		Handler:     restServeMux,
+		ReadTimeout: restReadTimeout,
+	}
+
+	s.wg.Add(1)
+	go func() {
+		logs.Info("REST server listening on %s", listener.Addr())
+		httpServer.Serve(listener)
+		logs.Trace("REST listener done for %s", listener.Addr())
+		s.wg.Done()
+	}()
+	return nil
+}
+
+// Stop closes the listener and waits for the server to finish.
+func (s *RestServer) Stop() error {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		logs.Info("REST server is already in the process of shutting down")
+		return nil
+	}
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil {
+			logs.Error("Problem shutting down REST server: %v", err)
+			return err
+		}
+	}
+	s.wg.Wait()
+	logs.Info("REST server shutdown complete")
+	return nil
+}
+
+// serveRest dispatches a request to the handler of its endpoint.
+func serveRest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		restError(w, http.StatusMethodNotAllowed, "Only GET requests are supported")
+		return
+	}
+
+	for _, endpoint := range restEndpoints {
+		if !strings.HasPrefix(r.URL.Path, endpoint.prefix) {
+			continue
+		}
+		param, format, ok := parseDataFormat(r.URL.Path[len(endpoint.prefix):])
+		if !ok {
+			restError(w, http.StatusNotFound, "output format not found (available: "+
+				restAvailableFormats+")")
+			return
+		}
+		endpoint.handler(w, param, format)
+		return
+	}
+	restError(w, http.StatusNotFound, "not found")
+}
+
+// parseDataFormat splits the format extension off the requested resource.
+func parseDataFormat(resource string) (string, restFormat, bool) {
+	pos := strings.LastIndexByte(resource, '.')
+	if pos < 0 {
+		return resource, 0, false
+	}
+	format, ok := restFormats[resource[pos+1:]]
+	return resource[:pos], format, ok
+}
+
+// restError replies with a plain text error message.
+func restError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	fmt.Fprint(w, message+"\r\n")
+}
+
+// restReply writes a reply in the requested format.  Binary and hex replies
+// are made of the serialized data, JSON replies of the marshalled result.
+func restReply(w http.ResponseWriter, format restFormat, data []byte, result interface{}) {
+	switch format {
+	case restFormatBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+
+	case restFormatHex:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, hex.EncodeToString(data)+"\n")
+
+	case restFormatJSON:
+		reply, err := json.Marshal(result)
+		if err != nil {
+			restError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(reply, '\n'))
+	}
+}
+
+// restRPCError replies with the message of an error returned by the RPC
+// helpers the REST handlers share.
+func restRPCError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if rpcErr, ok := err.(*btcjson.RPCError); ok {
+		switch rpcErr.Code {
+		case btcjson.ErrRPCBlockNotFound:
+			status = http.StatusNotFound
+		}
+		restError(w, status, rpcErr.Message)
+		return
+	}
+	restError(w, status, err.Error())
+}
+
+func restBlockExtended(w http.ResponseWriter, param string, format restFormat) {
+	restBlock(w, param, format, true)
+}
+
+func restBlockNoTxDetails(w http.ResponseWriter, param string, format restFormat) {
+	restBlock(w, param, format, false)
+}
+
+// restBlock serves /rest/block/<hash> and /rest/block/notxdetails/<hash>.
+func restBlock(w http.ResponseWriter, param string, format restFormat, txDetails bool) {
+	hash, err := utils.GetHashFromStr(param)
+	if err != nil {
+		restError(w, http.StatusBadRequest, "Invalid hash: "+param)
+		return
+	}
+
+	blockIndex := blockchain.GChainActive.FetchBlockIndexByHash(hash)
+	if blockIndex == nil {
+		restError(w, http.StatusNotFound, param+" not found")
+		return
+	}
+	if blockchain.GHavePruned && blockIndex.Status&core.BlockHaveData == 0 {
+		restError(w, http.StatusNotFound, param+" not available (pruned data)")
+		return
+	}
+	block, err := readBlock(blockIndex)
+	if err != nil {
+		restRPCError(w, err)
+		return
+	}
+
+	if format == restFormatJSON {
+		result, err := blockToJSON(block, blockIndex, txDetails)
+		if err != nil {
+			restRPCError(w, err)
+			return
+		}
+		restReply(w, format, nil, result)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	restReply(w, format, buf.Bytes(), nil)
+}
+
+// restTx serves /rest/tx/<txid>.
+func restTx(w http.ResponseWriter, param string, format restFormat) {
+	hash, err := utils.GetHashFromStr(param)
+	if err != nil {
+		restError(w, http.StatusBadRequest, "Invalid hash: "+param)
+		return
+	}
+
+	tx, hashBlock, ok := GetTransaction(hash, true)
+	if !ok {
+		restError(w, http.StatusNotFound, param+" not found")
+		return
+	}
+
+	if format == restFormatJSON {
+		// transactions in the mempool have no block
+		if hashBlock == nil {
+			hashBlock = &utils.HashZero
+		}
+		result, err := createTxRawResult(tx, hashBlock, msg.ActiveNetParams)
+		if err != nil {
+			restRPCError(w, err)
+			return
+		}
+		restReply(w, format, nil, result)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	restReply(w, format, buf.Bytes(), nil)
+}
+
+// restHeaders serves /rest/headers/<count>/<hash>, the headers of up to
+// count blocks of the active chain starting with hash.
+func restHeaders(w http.ResponseWriter, param string, format restFormat) {
+	path := strings.Split(param, "/")
+	if len(path) != 2 {
+		restError(w, http.StatusBadRequest, "No header count specified. Use "+
+			"/rest/headers/<count>/<hash>.<ext>.")
+		return
+	}
+
+	count, err := strconv.Atoi(path[0])
+	if err != nil || count < 1 || count > restMaxHeaders {
+		restError(w, http.StatusBadRequest, fmt.Sprintf("Header count out of "+
+			"range: %s", path[0]))
+		return
+	}
+	hash, err := utils.GetHashFromStr(path[1])
+	if err != nil {
+		restError(w, http.StatusBadRequest, "Invalid hash: "+path[1])
+		return
+	}
+
+	headers := make([]*core.BlockIndex, 0, count)
+	blockIndex := blockchain.GChainActive.FetchBlockIndexByHash(hash)
+	for blockIndex != nil && blockchain.GChainActive.Contains(blockIndex) {
+		headers = append(headers, blockIndex)
+		if len(headers) == count {
+			break
+		}
+		blockIndex = blockchain.GChainActive.Next(blockIndex)
+	}
+
+	if format == restFormatJSON {
+		result := make([]*btcjson.GetBlockHeaderVerboseResult, 0, len(headers))
+		for _, header := range headers {
+			result = append(result, blockHeaderToJSON(header))
+		}
+		restReply(w, format, nil, result)
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, header := range headers {
+		if err := header.Header.Serialize(&buf); err != nil {
+			restError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	restReply(w, format, buf.Bytes(), nil)
+}
+
+// restChainInfo serves /rest/chaininfo, which is only available as JSON.
+func restChainInfo(w http.ResponseWriter, param string, format restFormat) {
+	if param != "" || format != restFormatJSON {
+		restError(w, http.StatusNotFound, "output format not found (available: json)")
+		return
+	}
+	restReply(w, format, nil, getChainInfo())
+}
+
+// restMempoolInfo serves /rest/mempool/info, which is only available as JSON.
+func restMempoolInfo(w http.ResponseWriter, param string, format restFormat) {
+	if param != "" || format != restFormatJSON {
+		restError(w, http.StatusNotFound, "output format not found (available: json)")
+		return
+	}
+	restReply(w, format, nil, getMempoolInfo())
+}
+
+// restMempoolContents serves /rest/mempool/contents, the verbose entries of
+// every mempool transaction.  It is only available as JSON.
+func restMempoolContents(w http.ResponseWriter, param string, format restFormat) {
+	if param != "" || format != restFormatJSON {
+		restError(w, http.StatusNotFound, "output format not found (available: json)")
+		return
+	}
+
+	pool := blockchain.GMemPool
+	pool.RLock()
+	entries := make(map[*mempool.TxEntry]struct{}, len(pool.PoolData))
+	for _, entry := range pool.PoolData {
+		entries[entry] = struct{}{}
+	}
+	result := mempoolEntriesToJSON(pool, entries, true)
+	pool.RUnlock()
+
+	restReply(w, format, nil, result)
+}
+
+// restGetUTXOs serves /rest/getutxos[/checkmempool]/<txid>-<n>/..., which
+// reports which of the given outpoints are unspent along with their outputs.
+// With checkmempool, outputs created by mempool transactions count as
+// unspent and outputs spent by them as spent.
+func restGetUTXOs(w http.ResponseWriter, param string, format restFormat) {
+	path := strings.Split(strings.TrimPrefix(param, "/"), "/")
+	checkMempool := false
+	if len(path) > 0 && path[0] == "checkmempool" {
+		checkMempool = true
+		path = path[1:]
+	}
+	if len(path) == 0 || path[0] == "" {
+		restError(w, http.StatusBadRequest, "Error: empty request")
+		return
+	}
+	if len(path) > restMaxGetUTXOsOutpoints {
+		restError(w, http.StatusBadRequest, fmt.Sprintf("Error: max outpoints "+
+			"exceeded (max: %d, tried: %d)", restMaxGetUTXOsOutpoints, len(path)))
+		return
+	}
+
+	outPoints := make([]core.OutPoint, 0, len(path))
+	for _, str := range path {
+		fields := strings.Split(str, "-")
+		if len(fields) != 2 {
+			restError(w, http.StatusBadRequest, "Parse error")
+			return
+		}
+		hash, err := utils.GetHashFromStr(fields[0])
+		if err != nil {
+			restError(w, http.StatusBadRequest, "Parse error")
+			return
+		}
+		index, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			restError(w, http.StatusBadRequest, "Parse error")
+			return
+		}
+		outPoints = append(outPoints, core.OutPoint{Hash: *hash, Index: uint32(index)})
+	}
+
+	hits := make([]bool, len(outPoints))
+	coins := make([]*utxo.Coin, 0, len(outPoints))
+	pool := blockchain.GMemPool
+	for i := range outPoints {
+		coin := lookupUTXO(pool, &outPoints[i], checkMempool)
+		if coin != nil {
+			hits[i] = true
+			coins = append(coins, coin)
+		}
+	}
+
+	height := int32(blockchain.GChainActive.Height())
+	tipHash := utils.HashZero
+	if tip := blockchain.GChainActive.Tip(); tip != nil {
+		tipHash = *tip.GetBlockHash()
+	}
+
+	if format == restFormatJSON {
+		result := &btcjson.GetUTXOsResult{
+			ChainHeight:  height,
+			ChainTipHash: tipHash.ToString(),
+			UTXOs:        make([]btcjson.UTXOResult, 0, len(coins)),
+		}
+		bitmap := make([]byte, len(hits))
+		for i, hit := range hits {
+			bitmap[i] = '0'
+			if hit {
+				bitmap[i] = '1'
+			}
+		}
+		result.Bitmap = string(bitmap)
+		for _, coin := range coins {
+			result.UTXOs = append(result.UTXOs, btcjson.UTXOResult{
+				Height:       coin.GetHeight(),
+				Value:        utils.Amount(coin.TxOut.Value).ToBTC(),
+				ScriptPubKey: ScriptPubKeyToJSON(coin.TxOut.Script, true),
+			})
+		}
+		restReply(w, format, nil, result)
+		return
+	}
+
+	data, err := serializeUTXOs(height, &tipHash, hits, coins)
+	if err != nil {
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	restReply(w, format, data, nil)
+}
+
+// lookupUTXO returns the unspent coin of outPoint, or nil if there is none.
+func lookupUTXO(pool *mempool.TxMempool, outPoint *core.OutPoint, checkMempool bool) *utxo.Coin {
+	if checkMempool {
+		pool.RLock()
+		_, spent := pool.NextTx[*outPoint]
+		pool.RUnlock()
+		if spent {
+			return nil
+		}
+		if coin := pool.GetCoin(outPoint); coin != nil {
+			return coin
+		}
+	}
+
+	coin := new(utxo.Coin)
+	if !blockchain.GCoinsTip.GetCoin(outPoint, coin) || coin.IsSpent() {
+		return nil
+	}
+	return coin
+}
+
+// serializeUTXOs encodes a getutxos reply the way Bitcoin Core does: the
+// chain height and tip, the hit bitmap with one bit per outpoint and the
+// unspent outputs, each preceded by a (zero) version and its height.
+func serializeUTXOs(height int32, tipHash *utils.Hash, hits []bool, coins []*utxo.Coin) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, height); err != nil {
+		return nil, err
+	}
+	tipHash.Serialize(&buf)
+
+	bitmap := make([]byte, (len(hits)+7)/8)
+	for i, hit := range hits {
+		if hit {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	if err := utils.WriteVarBytes(&buf, bitmap); err != nil {
+		return nil, err
+	}
+
+	if err := utils.WriteVarInt(&buf, uint64(len(coins))); err != nil {
+		return nil, err
+	}
+	for _, coin := range coins {
+		if err := binary.Write(&buf, binary.LittleEndian, uint32(0)); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, binary.LittleEndian, coin.GetHeight()); err != nil {
+			return nil, err
+		}
+		if err := coin.TxOut.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,178 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btcboost/copernicus/btcjson"
+	"github.com/btcboost/copernicus/core"
+	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/utils"
+	"github.com/btcboost/copernicus/utxo"
+)
+
+const restTestHash = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+
+func TestParseDataFormat(t *testing.T) {
+	tests := []struct {
+		resource string
+		param    string
+		format   restFormat
+		ok       bool
+	}{
+		{restTestHash + ".bin", restTestHash, restFormatBinary, true},
+		{restTestHash + ".hex", restTestHash, restFormatHex, true},
+		{"5/" + restTestHash + ".json", "5/" + restTestHash, restFormatJSON, true},
+		{".json", "", restFormatJSON, true},
+		{restTestHash, restTestHash, 0, false},
+		{restTestHash + ".xml", restTestHash, 0, false},
+		{restTestHash + ".JSON", restTestHash, 0, false},
+	}
+	for _, test := range tests {
+		param, format, ok := parseDataFormat(test.resource)
+		if ok != test.ok || (ok && (param != test.param || format != test.format)) {
+			t.Errorf("%s: got %q, %d, %v", test.resource, param, format, ok)
+		}
+	}
+}
+
+// restGet returns the reply of the REST interface to a request of path.
+func restGet(method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	serveRest(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestServeRestErrors(t *testing.T) {
+	outPoints := make([]string, restMaxGetUTXOsOutpoints+1)
+	for i := range outPoints {
+		outPoints[i] = restTestHash + "-0"
+	}
+	tests := []struct {
+		method string
+		path   string
+		status int
+		reply  string
+	}{
+		{"POST", "/rest/chaininfo.json", http.StatusMethodNotAllowed, "Only GET"},
+		{"GET", "/rest/unknown.json", http.StatusNotFound, "not found"},
+
+		// The formats.
+		{"GET", "/rest/block/" + restTestHash, http.StatusNotFound, "output format not found"},
+		{"GET", "/rest/tx/" + restTestHash + ".xml", http.StatusNotFound, "output format not found"},
+		{"GET", "/rest/chaininfo.bin", http.StatusNotFound, "available: json"},
+		{"GET", "/rest/mempool/info.hex", http.StatusNotFound, "available: json"},
+		{"GET", "/rest/mempool/contents.bin", http.StatusNotFound, "available: json"},
+
+		// The hashes.
+		{"GET", "/rest/block/zz.bin", http.StatusBadRequest, "Invalid hash: zz"},
+		{"GET", "/rest/block/notxdetails/zz.json", http.StatusBadRequest, "Invalid hash: zz"},
+		{"GET", "/rest/tx/" + restTestHash[1:] + "x.hex", http.StatusBadRequest, "Invalid hash"},
+		{"GET", "/rest/headers/5/zz.bin", http.StatusBadRequest, "Invalid hash: zz"},
+		{"GET", "/rest/block/" + restTestHash + ".bin", http.StatusNotFound, restTestHash + " not found"},
+		{"GET", "/rest/block/notxdetails/" + restTestHash + ".json", http.StatusNotFound, "not found"},
+
+		// The size limits.
+		{"GET", "/rest/headers/" + restTestHash + ".bin", http.StatusBadRequest, "No header count"},
+		{"GET", "/rest/headers/0/" + restTestHash + ".bin", http.StatusBadRequest, "out of range: 0"},
+		{"GET", "/rest/headers/2001/" + restTestHash + ".json", http.StatusBadRequest, "out of range: 2001"},
+		{"GET", "/rest/headers/x/" + restTestHash + ".hex", http.StatusBadRequest, "out of range: x"},
+		{"GET", "/rest/getutxos.json", http.StatusBadRequest, "empty request"},
+		{"GET", "/rest/getutxos/checkmempool.bin", http.StatusBadRequest, "empty request"},
+		{"GET", "/rest/getutxos/" + strings.Join(outPoints, "/") + ".json", http.StatusBadRequest,
+			"max outpoints exceeded (max: 15, tried: 16)"},
+		{"GET", "/rest/getutxos/" + restTestHash + ".bin", http.StatusBadRequest, "Parse error"},
+		{"GET", "/rest/getutxos/zz-0.bin", http.StatusBadRequest, "Parse error"},
+		{"GET", "/rest/getutxos/" + restTestHash + "-x.hex", http.StatusBadRequest, "Parse error"},
+	}
+	for _, test := range tests {
+		w := restGet(test.method, test.path)
+		if w.Code != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+		if !strings.Contains(w.Body.String(), test.reply) {
+			t.Errorf("%s %s: reply %q, want %q", test.method, test.path, w.Body.String(), test.reply)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "text/plain" {
+			t.Errorf("%s %s: content type %s", test.method, test.path, contentType)
+		}
+	}
+}
+
+func TestServeRestFormats(t *testing.T) {
+	// No block of the chain follows an unknown hash, so every format gets
+	// an empty list of headers.
+	tests := []struct {
+		path        string
+		contentType string
+		reply       string
+	}{
+		{"/rest/headers/2000/" + restTestHash + ".bin", "application/octet-stream", ""},
+		{"/rest/headers/1/" + restTestHash + ".hex", "text/plain", "\n"},
+		{"/rest/headers/1/" + restTestHash + ".json", "application/json", "[]\n"},
+	}
+	for _, test := range tests {
+		w := restGet("GET", test.path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", test.path, w.Code, w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("%s: content type %s, want %s", test.path, contentType, test.contentType)
+		}
+		if w.Body.String() != test.reply {
+			t.Errorf("%s: reply %q, want %q", test.path, w.Body.String(), test.reply)
+		}
+	}
+
+	w := restGet("GET", "/rest/chaininfo.json")
+	var chainInfo btcjson.GetBlockChainInfoResult
+	if err := json.Unmarshal(w.Body.Bytes(), &chainInfo); err != nil {
+		t.Fatalf("chaininfo: %v: %s", err, w.Body.String())
+	}
+	if chainInfo.Chain != msg.ActiveNetParams.Name {
+		t.Errorf("chaininfo of %s, want %s", chainInfo.Chain, msg.ActiveNetParams.Name)
+	}
+
+	w = restGet("GET", "/rest/mempool/info.json")
+	var mempoolInfo btcjson.GetMempoolInfoResult
+	if err := json.Unmarshal(w.Body.Bytes(), &mempoolInfo); err != nil {
+		t.Fatalf("mempool info: %v: %s", err, w.Body.String())
+	}
+	if mempoolInfo.MaxMempool <= 0 {
+		t.Errorf("mempool info without a size limit: %s", w.Body.String())
+	}
+}
+
+func TestSerializeUTXOs(t *testing.T) {
+	tipHash, err := utils.GetHashFromStr(restTestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := core.NewTxOut(5000, []byte{core.OP_TRUE})
+	coins := []*utxo.Coin{utxo.NewCoin(out, 7, false)}
+	// Nine outpoints need two bytes of bitmap, the first and the ninth hit.
+	hits := []bool{true, false, false, false, false, false, false, false, true}
+	data, err := serializeUTXOs(100, tipHash, hits, coins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	binary.Write(&want, binary.LittleEndian, int32(100))
+	tipHash.Serialize(&want)
+	want.Write([]byte{0x02, 0x01, 0x01})
+	want.WriteByte(0x01)
+	binary.Write(&want, binary.LittleEndian, uint32(0))
+	binary.Write(&want, binary.LittleEndian, uint32(7))
+	if err := out.Serialize(&want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want.Bytes()) {
+		t.Errorf("serialized %x, want %x", data, want.Bytes())
+	}
+}
@@ -1,19 +1,114 @@
 package rpc
 
 import (
+	"net"
+	"time"
+
+	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/mempool"
 	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/network"
+	"github.com/btcboost/copernicus/net/p2p"
 )
 
+// rpcPeer provides a peer for use with the RPC server and implements the
+// ServerPeer interface.
+type rpcPeer struct {
+	serverPeer  *p2p.ServerPeer
+	peerManager *p2p.PeerManager
+}
+
+// Ensure rpcPeer implements the ServerPeer interface.
+var _ ServerPeer = (*rpcPeer)(nil)
+
+// ToPeer returns the underlying peer instance.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) ToPeer() *p2p.Peer {
+	return p.serverPeer.Peer
+}
+
+// IsTxRelayDisabled returns whether or not the peer has disabled transaction
+// relay.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) IsTxRelayDisabled() bool {
+	return p.serverPeer.RelayTxDisabled()
+}
+
+// BanScore returns the current integer value that represents how close the
+// peer is to being banned.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) BanScore() uint32 {
+	return p.serverPeer.BanScore()
+}
+
+// FeeFilter returns the requested current minimum fee rate for which
+// transactions should be announced.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) FeeFilter() int64 {
+	return p.serverPeer.FeeFilter()
+}
+
+// MappedAS returns the autonomous system announcing the address of the peer
+// according to the asmap, or 0 when it isn't mapped.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) MappedAS() uint32 {
+	address := p.serverPeer.GetNetAddress()
+	if address == nil {
+		return 0
+	}
+	return p.peerManager.MappedAS(address)
+}
+
+// ConnectionType returns the type of the connection to the peer.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) ConnectionType() string {
+	return p.serverPeer.ConnectionType()
+}
+
+// Permissions returns the names of the permissions of the peer.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) Permissions() []string {
+	return p.serverPeer.Permissions().Strings()
+}
+
+// BytesPerMessage returns the bytes sent to and received from the peer, by
+// message command.
+//
+// This function is safe for concurrent access and is part of the ServerPeer
+// interface implementation.
+func (p *rpcPeer) BytesPerMessage() (map[string]uint64, map[string]uint64) {
+	return p.serverPeer.BytesPerMessage()
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
-	//server *server
+	peerManager *p2p.PeerManager
 }
 
 // Ensure rpcConnManager implements the rpcserverConnManager interface.
 var _ ServerConnManager = &rpcConnManager{}
 
+// NewConnManager returns the connection manager of the RPC server backed by
+// peerManager.
+func NewConnManager(peerManager *p2p.PeerManager) ServerConnManager {
+	return &rpcConnManager{peerManager: peerManager}
+}
+
 // Connect adds the provided address as a new outbound peer.  The permanent flag
 // indicates whether or not to make the peer persistent and reconnect if the
 // connection is lost.  Attempting to connect to an already existing peer will
@@ -106,26 +201,39 @@ func (cm *rpcConnManager) ConnectedCount() int32 {
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
 func (cm *rpcConnManager) NetTotals() (uint64, uint64) {
-	//return cm.server.NetTotals()   Todo
-	return 0, 0
+	return cm.peerManager.NetTotals()
+}
+
+// UploadTarget returns the state of the upload target.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) UploadTarget() p2p.UploadTargetStats {
+	return cm.peerManager.UploadTarget()
+}
+
+// EvictionStats returns the counts of the inbound peers evicted and rejected.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) EvictionStats() p2p.EvictionStats {
+	return cm.peerManager.EvictionStats()
 }
 
 // ConnectedPeers returns an array consisting of all connected peers.
 //
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
-/*func (cm *rpcConnManager) ConnectedPeers() []rpcserverPeer {
-	replyChan := make(chan []*serverPeer)
-	cm.server.query <- getPeersMsg{reply: replyChan}
-	serverPeers := <-replyChan
+func (cm *rpcConnManager) ConnectedPeers() []ServerPeer {
+	serverPeers := cm.peerManager.ConnectedPeers()
 
 	// Convert to RPC server peers.
-	peers := make([]rpcserverPeer, 0, len(serverPeers))
+	peers := make([]ServerPeer, 0, len(serverPeers))
 	for _, sp := range serverPeers {
-		peers = append(peers, (*rpcPeer)(sp))
+		peers = append(peers, &rpcPeer{serverPeer: sp, peerManager: cm.peerManager})
 	}
 	return peers
-}*/ // Todo
+}
 
 // PersistentPeers returns an array consisting of all the added persistent
 // peers.
@@ -168,3 +276,69 @@ func (cm *rpcConnManager) AddRebroadcastInventory(iv *msg.InventoryVector, data
 func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxEntry) { // todo btcd: *mempool.TxDesc
 	//cm.server.relayTransactions(txns)       // Todo
 }
+
+// SubmitTransaction submits a transaction of the node itself, which is relayed
+// along the Dandelion stem when enabled.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) SubmitTransaction(tx *core.Tx) error {
+	return cm.peerManager.SubmitTransaction(tx)
+}
+
+// SetBan bans the subnet until banUntil and disconnects the peers in it.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) SetBan(subnet *net.IPNet, banUntil time.Time) error {
+	return cm.peerManager.Ban(subnet, banUntil)
+}
+
+// Unban lifts the ban of the subnet.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) Unban(subnet *net.IPNet) error {
+	return cm.peerManager.Unban(subnet)
+}
+
+// IsBanned returns whether the subnet itself is banned.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) IsBanned(subnet *net.IPNet) bool {
+	return cm.peerManager.IsSubnetBanned(subnet)
+}
+
+// ListBanned returns the current bans.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ListBanned() []*p2p.BanEntry {
+	return cm.peerManager.ListBanned()
+}
+
+// ClearBanned lifts all the bans.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ClearBanned() error {
+	return cm.peerManager.ClearBanned()
+}
+
+// NodeAddresses returns a random selection of the known peer addresses.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) NodeAddresses() []*network.PeerAddress {
+	return cm.peerManager.NodeAddresses()
+}
+
+// AddPeerAddress adds the address to the known peer addresses, as tried when
+// tried is set, and returns whether it is known.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) AddPeerAddress(address *network.PeerAddress, tried bool) bool {
+	return cm.peerManager.AddPeerAddress(address, tried)
+}
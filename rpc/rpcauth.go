@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/btcboost/copernicus/conf"
+)
+
+const (
+	// cookieAuthUser is the user name of the credentials stored in the
+	// cookie file.
+	cookieAuthUser = "__cookie__"
+
+	// defaultCookieFile is the name of the cookie file in the data directory.
+	defaultCookieFile = ".cookie"
+)
+
+// rpcLimited is the set of methods a limited user may call.  It only holds
+// methods which do not change the state of the node.
+var rpcLimited = map[string]struct{}{
+	"createmultisig":         {},
+	"createrawtransaction":   {},
+	"decoderawtransaction":   {},
+	"decodescript":           {},
+	"echo":                   {},
+	"estimatefee":            {},
+	"estimatepriority":       {},
+	"estimatesmartfee":       {},
+	"estimatesmartpriority":  {},
+	"getaddednodeinfo":       {},
+	"getbestblockhash":       {},
+	"getblock":               {},
+	"getblockchaininfo":      {},
+	"getblockcount":          {},
+	"getblockhash":           {},
+	"getblockheader":         {},
+	"getchaintips":           {},
+	"getconnectioncount":     {},
+	"getdifficulty":          {},
+	"getexcessiveblock":      {},
+	"getinfo":                {},
+	"getmempoolancestors":    {},
+	"getmempooldescendants":  {},
+	"getmempoolentry":        {},
+	"getmempoolfeehistogram": {},
+	"getmempoolinfo":         {},
+	"getmininginfo":          {},
+	"getnettotals":           {},
+	"getnetworkhashps":       {},
+	"getnetworkinfo":         {},
+	"getnodeaddresses":       {},
+	"getpeerinfo":            {},
+	"getrawmempool":          {},
+	"getrawtransaction":      {},
+	"gettxout":               {},
+	"gettxoutproof":          {},
+	"gettxoutsetinfo":        {},
+	"help":                   {},
+	"listbanned":             {},
+	"validateaddress":        {},
+	"verifymessage":          {},
+	"verifytxoutproof":       {},
+	"waitforblock":           {},
+	"waitforblockheight":     {},
+	"waitfornewblock":        {},
+}
+
+// rpcUser is an authenticated RPC user.
+type rpcUser struct {
+	name    string
+	isAdmin bool
+}
+
+// rpcAuthEntry is a credential given with the rpcauth option.  The password
+// is not stored, only the HMAC-SHA256 of it keyed with the salt.
+type rpcAuthEntry struct {
+	salt string
+	hash []byte
+}
+
+// matches returns whether pass is the password of the entry.
+func (e *rpcAuthEntry) matches(pass string) bool {
+	mac := hmac.New(sha256.New, []byte(e.salt))
+	mac.Write([]byte(pass))
+	return hmac.Equal(mac.Sum(nil), e.hash)
+}
+
+// parseRPCAuth parses rpcauth options of the form <user>:<salt>$<hash>, with
+// the hash being the hex encoded HMAC-SHA256 of the password keyed with the
+// salt.  A user may have several entries.
+func parseRPCAuth(options []string) (map[string][]rpcAuthEntry, error) {
+	entries := make(map[string][]rpcAuthEntry)
+	for _, option := range options {
+		fields := strings.SplitN(option, ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid rpcauth '%s': expected <user>:<salt>$<hash>", option)
+		}
+		saltHash := strings.SplitN(fields[1], "$", 2)
+		if len(saltHash) != 2 || saltHash[0] == "" {
+			return nil, fmt.Errorf("invalid rpcauth for user %s: expected <salt>$<hash>", fields[0])
+		}
+		hash, err := hex.DecodeString(saltHash[1])
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid rpcauth hash for user %s", fields[0])
+		}
+		entries[fields[0]] = append(entries[fields[0]], rpcAuthEntry{salt: saltHash[0], hash: hash})
+	}
+	return entries, nil
+}
+
+// rpcPermissions restricts the methods a user may call.  A nil whitelist
+// allows every method which is not blacklisted.
+type rpcPermissions struct {
+	whitelist map[string]struct{}
+	blacklist map[string]struct{}
+}
+
+// parseRPCPermissions parses rpcwhitelist and rpcblacklist options of the
+// form <user>:<method>,<method>.  Several options for the same user add up.
+func parseRPCPermissions(whitelists, blacklists []string) (map[string]*rpcPermissions, error) {
+	permissions := make(map[string]*rpcPermissions)
+	parse := func(option string, whitelist bool) error {
+		fields := strings.SplitN(option, ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return fmt.Errorf("invalid RPC method list '%s': expected <user>:<method>,<method>", option)
+		}
+		perms, ok := permissions[fields[0]]
+		if !ok {
+			perms = &rpcPermissions{}
+			permissions[fields[0]] = perms
+		}
+		methods := &perms.blacklist
+		if whitelist {
+			methods = &perms.whitelist
+		}
+		if *methods == nil {
+			*methods = make(map[string]struct{})
+		}
+		for _, method := range strings.Split(fields[1], ",") {
+			method = strings.ToLower(strings.TrimSpace(method))
+			if method != "" {
+				(*methods)[method] = struct{}{}
+			}
+		}
+		return nil
+	}
+
+	for _, option := range whitelists {
+		if err := parse(option, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, option := range blacklists {
+		if err := parse(option, false); err != nil {
+			return nil, err
+		}
+	}
+	return permissions, nil
+}
+
+// authorized returns whether user may call method.  Limited users are
+// restricted to rpcLimited and every user to their configured method lists.
+func (s *Server) authorized(user *rpcUser, method string) bool {
+	if !user.isAdmin {
+		if _, ok := rpcLimited[method]; !ok {
+			return false
+		}
+	}
+
+	perms, ok := s.permissions[user.name]
+	if !ok {
+		return true
+	}
+	if _, ok := perms.blacklist[method]; ok {
+		return false
+	}
+	if perms.whitelist != nil {
+		if _, ok := perms.whitelist[method]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// cookieFilePath returns the path of the RPC cookie file.
+func cookieFilePath() string {
+	if conf.AppConf.RPCCookieFile != "" {
+		return conf.AppConf.RPCCookieFile
+	}
+	return filepath.Join(conf.AppConf.DataDir, defaultCookieFile)
+}
+
+// generateAuthCookie creates random credentials for the cookie user, writes
+// them to the cookie file readable only by the owner and returns the
+// Authorization header value they produce.
+func generateAuthCookie() (string, error) {
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", err
+	}
+	login := cookieAuthUser + ":" + hex.EncodeToString(secret[:])
+
+	path := cookieFilePath()
+	if err := ioutil.WriteFile(path, []byte(login), 0600); err != nil {
+		return "", fmt.Errorf("unable to write RPC cookie file %s: %v", path, err)
+	}
+	logs.Info("Generated RPC authentication cookie %s", path)
+	return login, nil
+}
+
+// deleteAuthCookie removes the cookie file.
+func deleteAuthCookie() {
+	if err := os.Remove(cookieFilePath()); err != nil && !os.IsNotExist(err) {
+		logs.Warn("Unable to remove RPC cookie file: %v", err)
+	}
+}
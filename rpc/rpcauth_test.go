@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/btcboost/copernicus/conf"
+)
+
+// rpcAuthOption returns the rpcauth option of user with password pass salted
+// with salt.
+func rpcAuthOption(user, salt, pass string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(pass))
+	return user + ":" + salt + "$" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseRPCAuth(t *testing.T) {
+	valid := rpcAuthOption("alice", "cb77f0957de88ff388cf817ddbc7273", "secret")
+	tests := []struct {
+		options []string
+		valid   bool
+	}{
+		{nil, true},
+		{[]string{valid}, true},
+		{[]string{valid, rpcAuthOption("alice", "salt2", "other")}, true},
+		{[]string{"alice"}, false},
+		{[]string{":salt$" + strings.Repeat("00", sha256.Size)}, false},
+		{[]string{"alice:salt"}, false},
+		{[]string{"alice:$" + strings.Repeat("00", sha256.Size)}, false},
+		{[]string{"alice:salt$zz"}, false},
+		{[]string{"alice:salt$" + strings.Repeat("00", sha256.Size-1)}, false},
+		{[]string{valid, "bob:salt$00"}, false},
+	}
+	for i, test := range tests {
+		entries, err := parseRPCAuth(test.options)
+		if test.valid != (err == nil) {
+			t.Errorf("test %d: %v: error %v", i, test.options, err)
+			continue
+		}
+		if test.valid && len(entries["alice"]) != len(test.options) {
+			t.Errorf("test %d: %d entries for alice, want %d", i, len(entries["alice"]), len(test.options))
+		}
+	}
+}
+
+func TestCheckAuthRPCAuth(t *testing.T) {
+	entries, err := parseRPCAuth([]string{
+		rpcAuthOption("alice", "salt1", "secret"),
+		rpcAuthOption("alice", "salt2", "backup"),
+		rpcAuthOption("bob", "salt3", "hunter2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{authEntries: entries}
+
+	tests := []struct {
+		user  string
+		pass  string
+		valid bool
+	}{
+		{"alice", "secret", true},
+		{"alice", "backup", true},
+		{"bob", "hunter2", true},
+		{"alice", "hunter2", false},
+		{"bob", "secret", false},
+		{"alice", "", false},
+		{"carol", "secret", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.SetBasicAuth(test.user, test.pass)
+		user, err := s.checkAuth(r, true)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s:%s authenticated", test.user, test.pass)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s:%s: %v", test.user, test.pass, err)
+			continue
+		}
+		if user.name != test.user || !user.isAdmin {
+			t.Errorf("%s:%s authenticated as %+v", test.user, test.pass, user)
+		}
+	}
+
+	// A missing Authorization header is only refused when it is required.
+	r := httptest.NewRequest("POST", "/", nil)
+	if _, err := s.checkAuth(r, true); err == nil {
+		t.Error("missing credentials accepted")
+	}
+	if user, err := s.checkAuth(r, false); user != nil || err != nil {
+		t.Errorf("optional credentials gave %v, %v", user, err)
+	}
+}
+
+func TestGenerateAuthCookie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpcauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedConf := conf.AppConf
+	defer func() { conf.AppConf = savedConf }()
+	conf.AppConf = &conf.AppConfig{RPCCookieFile: filepath.Join(dir, "cookie")}
+
+	login, err := generateAuthCookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(login, ":", 2)
+	if len(fields) != 2 || fields[0] != cookieAuthUser {
+		t.Fatalf("cookie login %q", login)
+	}
+	if secret, err := hex.DecodeString(fields[1]); err != nil || len(secret) != 32 {
+		t.Errorf("cookie secret %q isn't 32 hex encoded bytes", fields[1])
+	}
+	content, err := ioutil.ReadFile(conf.AppConf.RPCCookieFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != login {
+		t.Errorf("cookie file holds %q, want %q", content, login)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(conf.AppConf.RPCCookieFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("cookie file mode %o, want 600", perm)
+		}
+	}
+
+	// Every start gets new credentials.
+	again, err := generateAuthCookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == login {
+		t.Error("the same cookie was generated twice")
+	}
+
+	deleteAuthCookie()
+	if _, err := os.Stat(conf.AppConf.RPCCookieFile); !os.IsNotExist(err) {
+		t.Errorf("cookie file not removed: %v", err)
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	permissions, err := parseRPCPermissions(
+		[]string{"alice:getblockcount, GetBestBlockHash", "alice:stop", "carol:getinfo,stop"},
+		[]string{"bob:stop,setban", "carol:stop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{permissions: permissions}
+
+	tests := []struct {
+		user    rpcUser
+		method  string
+		allowed bool
+	}{
+		// Admins without method lists may call anything.
+		{rpcUser{"admin", true}, "stop", true},
+		{rpcUser{"admin", true}, "getblockcount", true},
+		// Limited users are restricted to the methods not changing state.
+		{rpcUser{"limited", false}, "getblockcount", true},
+		{rpcUser{"limited", false}, "stop", false},
+		{rpcUser{"limited", false}, "setban", false},
+		// A whitelist allows only its methods.
+		{rpcUser{"alice", true}, "getblockcount", true},
+		{rpcUser{"alice", true}, "getbestblockhash", true},
+		{rpcUser{"alice", true}, "stop", true},
+		{rpcUser{"alice", true}, "getblock", false},
+		{rpcUser{"alice", false}, "stop", false},
+		// A blacklist denies its methods only.
+		{rpcUser{"bob", true}, "stop", false},
+		{rpcUser{"bob", true}, "setban", false},
+		{rpcUser{"bob", true}, "getblock", true},
+		// The blacklist wins over the whitelist.
+		{rpcUser{"carol", true}, "getinfo", true},
+		{rpcUser{"carol", true}, "stop", false},
+		{rpcUser{"carol", true}, "getblock", false},
+	}
+	for _, test := range tests {
+		user := test.user
+		if allowed := s.authorized(&user, test.method); allowed != test.allowed {
+			t.Errorf("%s (admin %v) calling %s: allowed %v, want %v", user.name, user.isAdmin,
+				test.method, allowed, test.allowed)
+		}
+	}
+
+	invalid := [][]string{{"getinfo"}, {":getinfo"}}
+	for _, whitelist := range invalid {
+		if _, err := parseRPCPermissions(whitelist, nil); err == nil {
+			t.Errorf("method list %v accepted", whitelist)
+		}
+	}
+}
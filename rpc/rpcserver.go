@@ -1,11 +1,11 @@
 package rpc
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,6 +27,8 @@ import (
 	"github.com/btcboost/copernicus/core"
 	"github.com/btcboost/copernicus/mining"
 	"github.com/btcboost/copernicus/net/msg"
+	"github.com/btcboost/copernicus/net/network"
+	"github.com/btcboost/copernicus/net/p2p"
 	"github.com/btcboost/copernicus/utils"
 )
 
@@ -46,14 +48,6 @@ var (
 		"time", "transactions/add", "prevblock", "coinbase/append",
 	}
 
-	// gbtCoinbaseAux describes additional data that miners should include
-	// in the coinbase signature script.  It is declared here to avoid the
-	// overhead of creating a new object on every invocation for constant
-	// data.
-	gbtCoinbaseAux = &btcjson.GetBlockTemplateResultAux{
-		Flags: hex.EncodeToString([]byte(mining.CoinbaseFlag)),
-	}
-
 	// gbtCapabilities describes additional capabilities returned with a
 	// block template generated by the getblocktemplate RPC.    It is
 	// declared here to avoid the overhead of creating the slice on every
@@ -70,6 +64,10 @@ var (
 		Message: "Command unimplemented",
 	}
 
+	// ErrClientQuit describes the error where a client connection is
+	// terminated before a long running request could be answered.
+	ErrClientQuit = errors.New("client quit")
+
 	// ErrRPCNoWallet is an error returned to RPC clients when the provided
 	// command is recognized as a wallet command.
 	ErrRPCNoWallet = &btcjson.RPCError{
@@ -176,18 +174,22 @@ func handleStop(s *Server, cmd interface{}, closeChan <-chan struct{}) (interfac
 
 // Server provides a concurrent safe RPC server to a chain server.
 type Server struct {
-	started      int32
-	shutdown     int32
-	cfg          ServerConfig
-	authsha      [sha256.Size]byte
-	limitauthsha [sha256.Size]byte
-	numClients   int32
-	statusLines  map[int]string
-	statusLock   sync.RWMutex
-	wg           sync.WaitGroup
-	//gbtWorkState           *gbtWorkState
+	started                int32
+	shutdown               int32
+	cfg                    ServerConfig
+	authsha                [sha256.Size]byte
+	limitauthsha           [sha256.Size]byte
+	cookieauthsha          [sha256.Size]byte
+	authEntries            map[string][]rpcAuthEntry
+	permissions            map[string]*rpcPermissions
+	numClients             int32
+	statusLines            map[int]string
+	statusLock             sync.RWMutex
+	wg                     sync.WaitGroup
+	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
+	requestSem             chan struct{}
 	quit                   chan int
 }
 
@@ -262,6 +264,7 @@ func (s *Server) Stop() error {
 	}
 	close(s.quit)
 	s.wg.Wait()
+	deleteAuthCookie()
 	logs.Info("RPC server shutdown complete")
 	return nil
 }
@@ -278,9 +281,9 @@ func (s *Server) RequestedProcessShutdown() <-chan struct{} {
 //
 // This function is safe for concurrent access.
 func (s *Server) limitConnections(w http.ResponseWriter, remoteAddr string) bool {
-	if int(atomic.LoadInt32(&s.numClients)+1) > conf.CFG.RPCMaxClients {
+	if int(atomic.LoadInt32(&s.numClients)+1) > conf.AppConf.RPCMaxClients {
 		logs.Info("Max RPC clients exceeded [%d] - "+
-			"disconnecting client %s", conf.CFG.RPCMaxClients,
+			"disconnecting client %s", conf.AppConf.RPCMaxClients,
 			remoteAddr)
 		http.Error(w, "503 Too busy.  Try again later.",
 			http.StatusServiceUnavailable)
@@ -307,16 +310,16 @@ func (s *Server) decrementClients() {
 	atomic.AddInt32(&s.numClients, -1)
 }
 
-func (s *Server) checkAuth(r *http.Request, require bool) (bool, bool, error) {
+func (s *Server) checkAuth(r *http.Request, require bool) (*rpcUser, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			logs.Warn("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return nil, errors.New("auth failure")
 		}
 
-		return false, false, nil
+		return nil, nil
 	}
 
 	authsha := sha256.Sum256([]byte(authhdr[0]))
@@ -325,18 +328,33 @@ func (s *Server) checkAuth(r *http.Request, require bool) (bool, bool, error) {
 	// are probably expected to have a higher volume of calls
 	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
 	if limitcmp == 1 {
-		return true, false, nil
+		return &rpcUser{name: conf.AppConf.RPCLimitUser, isAdmin: false}, nil
 	}
 
 	// Check for admin-level auth
 	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
 	if cmp == 1 {
-		return true, true, nil
+		return &rpcUser{name: conf.AppConf.RPCUser, isAdmin: true}, nil
+	}
+
+	// Check for the credentials of the cookie file
+	cookiecmp := subtle.ConstantTimeCompare(authsha[:], s.cookieauthsha[:])
+	if cookiecmp == 1 {
+		return &rpcUser{name: cookieAuthUser, isAdmin: true}, nil
+	}
+
+	// Check for the salted credentials of the rpcauth users
+	if user, pass, ok := r.BasicAuth(); ok {
+		for _, entry := range s.authEntries[user] {
+			if entry.matches(pass) {
+				return &rpcUser{name: user, isAdmin: true}, nil
+			}
+		}
 	}
 
-	// Request's auth doesn't match either user
+	// Request's auth doesn't match any user
 	logs.Warn("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return nil, errors.New("auth failure")
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
@@ -351,10 +369,9 @@ type parsedRPCCmd struct {
 
 func (s *Server) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}) (interface{}, error) {
 	handler, ok := rpcHandlers[cmd.method]
-	if ok {
-		goto handled
+	if !ok {
+		return nil, btcjson.ErrRPCMethodNotFound
 	}
-handled:
 
 	return handler(s, cmd.cmd, closeChan)
 }
@@ -388,8 +405,9 @@ func parseCmd(request *btcjson.Request) *parsedRPCCmd {
 
 // createMarshalledReply returns a new marshalled JSON-RPC response given the
 // passed parameters.  It will automatically convert errors that are not of
-// the type *btcjson.RPCError to the appropriate type as needed.
-func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, error) {
+// the type *btcjson.RPCError to the appropriate type as needed.  Requests made
+// with JSON-RPC 2.0 get a 2.0 response.
+func createMarshalledReply(rpcVersion string, id, result interface{}, replyErr error) ([]byte, error) {
 	var jsonErr *btcjson.RPCError
 	if replyErr != nil {
 		if jErr, ok := replyErr.(*btcjson.RPCError); ok {
@@ -399,11 +417,134 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 		}
 	}
 
+	if rpcVersion == "2.0" {
+		return btcjson.MarshalResponse2(id, result, jsonErr)
+	}
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
+// processRequest parses and executes a single JSON-RPC request and returns
+// the marshalled reply, or nil when the request is a notification.
+func (s *Server) processRequest(body []byte, user *rpcUser, closeChan <-chan struct{}) []byte {
+	var request btcjson.Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+		return s.marshalReply(request.Jsonrpc, nil, nil, jsonErr)
+	}
+
+	return s.executeRequest(&request, user, closeChan)
+}
+
+// processBatch executes every request of a JSON-RPC batch concurrently, with
+// at most RPCMaxConcurrentReqs requests of all batches running at once, and
+// returns the marshalled array of replies.  Nil is returned when the batch
+// only consists of notifications.
+func (s *Server) processBatch(body []byte, user *rpcUser, closeChan <-chan struct{}) []byte {
+	var rawRequests []json.RawMessage
+	if err := json.Unmarshal(body, &rawRequests); err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+		return s.marshalReply("2.0", nil, nil, jsonErr)
+	}
+	if len(rawRequests) == 0 {
+		return s.marshalReply("2.0", nil, nil, btcjson.ErrRPCInvalidRequest)
+	}
+
+	replies := make([][]byte, len(rawRequests))
+	var wg sync.WaitGroup
+	for i, rawRequest := range rawRequests {
+		wg.Add(1)
+		s.requestSem <- struct{}{}
+		go func(i int, rawRequest json.RawMessage) {
+			defer func() {
+				<-s.requestSem
+				wg.Done()
+			}()
+
+			var request btcjson.Request
+			if err := json.Unmarshal(rawRequest, &request); err != nil {
+				replies[i] = s.marshalReply("2.0", nil, nil,
+					btcjson.ErrRPCInvalidRequest)
+				return
+			}
+			replies[i] = s.executeRequest(&request, user, closeChan)
+		}(i, rawRequest)
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	for _, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(reply)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// executeRequest runs the command of a parsed JSON-RPC request and returns the
+// marshalled reply, or nil when the request is a notification.
+func (s *Server) executeRequest(request *btcjson.Request, user *rpcUser, closeChan <-chan struct{}) []byte {
+	// Notifications are executed like any other request, but nothing is
+	// sent back for them.  Bitcoind replies to 1.0 requests without an id
+	// though, so keep doing that when quirks are requested.
+	notification := request.IsNotification() &&
+		!(conf.AppConf.RPCQuirks && request.Jsonrpc == "")
+
+	// Check if the user may call the method and set error if unauthorized
+	var result interface{}
+	var jsonErr error
+	if !s.authorized(user, request.Method) {
+		logs.Warn("RPC user %s is not authorized to call %s",
+			user.name, request.Method)
+		jsonErr = &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParams.Code,
+			Message: "user not authorized for this method",
+		}
+	} else {
+		// Attempt to parse the JSON-RPC request into a known concrete
+		// command.
+		parsedCmd := parseCmd(request)
+		if parsedCmd.err != nil {
+			jsonErr = parsedCmd.err
+		} else {
+			result, jsonErr = s.standardCmdResult(parsedCmd, closeChan)
+		}
+	}
+	if notification {
+		return nil
+	}
+
+	return s.marshalReply(request.Jsonrpc, request.ID, result, jsonErr)
+}
+
+// marshalReply marshals a JSON-RPC reply, logging and returning nil when that
+// fails.
+func (s *Server) marshalReply(rpcVersion string, id, result interface{}, replyErr error) []byte {
+	reply, err := createMarshalledReply(rpcVersion, id, result, replyErr)
+	if err != nil {
+		logs.Error("Failed to marshal reply: %v", err)
+		return nil
+	}
+	return reply
+}
+
 // jsonRPCRead handles reading and responding to RPC messages.
-func (s *Server) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
+func (s *Server) jsonRPCRead(w http.ResponseWriter, r *http.Request, user *rpcUser) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
@@ -444,62 +585,32 @@ func (s *Server) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin boo
 	defer buf.Flush()
 	//conn.SetReadDeadline(timeZeroVal)
 
-	// Attempt to parse the raw body into a JSON-RPC request.
-	var responseID interface{}
-	var jsonErr error
-	var result interface{}
-	var request btcjson.Request
-	if err := json.Unmarshal(body, &request); err != nil {
-		jsonErr = &btcjson.RPCError{
-			Code:    btcjson.ErrRPCParse.Code,
-			Message: "Failed to parse request: " + err.Error(),
+	// Setup a close notifier.  Since the connection is hijacked,
+	// the CloseNotifer on the ResponseWriter is not available.
+	closeChan := make(chan struct{}, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		if err != nil {
+			close(closeChan)
 		}
+	}()
+
+	// Process the body as a batch when it holds an array of requests, and
+	// as a single request otherwise.
+	var msg []byte
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		msg = s.processBatch(body, user, closeChan)
+	} else {
+		msg = s.processRequest(body, user, closeChan)
 	}
-	if jsonErr == nil {
-		if request.ID == nil && !(conf.CFG.RPCQuirks && request.Jsonrpc == "") {
-			return
-		}
-
-		// The parse was at least successful enough to have an ID so
-		// set it for the response.
-		responseID = request.ID
 
-		// Setup a close notifier.  Since the connection is hijacked,
-		// the CloseNotifer on the ResponseWriter is not available.
-		closeChan := make(chan struct{}, 1)
-		go func() {
-			_, err := conn.Read(make([]byte, 1))
-			if err != nil {
-				close(closeChan)
-			}
-		}()
-
-		// Check if the user is limited and set error if method unauthorized
-		//if !isAdmin {
-		//	if _, ok := rpcLimited[request.Method]; !ok {
-		//		jsonErr = &btcjson.RPCError{
-		//			Code:    btcjson.ErrRPCInvalidParams.Code,
-		//			Message: "limited user not authorized for this method",
-		//		}
-		//	}
-		//}
-
-		if jsonErr == nil {
-			// Attempt to parse the JSON-RPC request into a known concrete
-			// command.
-			parsedCmd := parseCmd(&request)
-			if parsedCmd.err != nil {
-				jsonErr = parsedCmd.err
-			} else {
-				result, jsonErr = s.standardCmdResult(parsedCmd, closeChan)
-			}
+	// Nothing is returned for notifications.
+	if msg == nil {
+		err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusNoContent, buf)
+		if err != nil {
+			logs.Error(err)
 		}
-	}
-
-	// Marshal the response.
-	msg, err := createMarshalledReply(responseID, result, jsonErr)
-	if err != nil {
-		logs.Error("Failed to marshal reply: %v", err)
 		return
 	}
 
@@ -553,14 +664,14 @@ func (s *Server) Start() {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		user, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, user)
 	})
 
 	// todo open
@@ -606,7 +717,7 @@ func GenCertPair(certFile, keyFile string) error {
 // concurrent access.
 type ServerPeer interface {
 	// ToPeer returns the underlying peer instance.
-	//ToPeer() *peer.Peer		// todo open
+	ToPeer() *p2p.Peer
 
 	// IsTxRelayDisabled returns whether or not the peer has disabled
 	// transaction relay.
@@ -619,6 +730,20 @@ type ServerPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// MappedAS returns the autonomous system announcing the address of the
+	// peer according to the asmap, or 0 when it isn't mapped.
+	MappedAS() uint32
+
+	// ConnectionType returns the type of the connection to the peer.
+	ConnectionType() string
+
+	// Permissions returns the names of the permissions of the peer.
+	Permissions() []string
+
+	// BytesPerMessage returns the bytes sent to and received from the
+	// peer, by message command.
+	BytesPerMessage() (sent map[string]uint64, received map[string]uint64)
 }
 
 // ServerConnManager represents a connection manager for use with the RPC
@@ -661,8 +786,15 @@ type ServerConnManager interface {
 	// network for all peers.
 	NetTotals() (uint64, uint64)
 
+	// UploadTarget returns the state of the upload target.
+	UploadTarget() p2p.UploadTargetStats
+
+	// EvictionStats returns the counts of the inbound peers evicted and
+	// rejected.
+	EvictionStats() p2p.EvictionStats
+
 	// ConnectedPeers returns an array consisting of all connected peers.
-	//ConnectedPeers() []ServerPeer      // Todo
+	ConnectedPeers() []ServerPeer
 
 	// PersistentPeers returns an array consisting of all the persistent
 	// peers.
@@ -680,6 +812,35 @@ type ServerConnManager interface {
 	// RelayTransactions generates and relays inventory vectors for all of
 	// the passed transactions to all connected peers.
 	//RelayTransactions(txns []*mempool.TxDesc)    // todo open btcd: *mempool.TxDesc
+
+	// SubmitTransaction submits a transaction of the node itself, which is
+	// relayed along the Dandelion stem when enabled.
+	SubmitTransaction(tx *core.Tx) error
+
+	// SetBan bans the subnet until banUntil and disconnects the peers in
+	// it.
+	SetBan(subnet *net.IPNet, banUntil time.Time) error
+
+	// Unban lifts the ban of the subnet.  Attempting to unban a subnet
+	// which isn't banned itself will return an error.
+	Unban(subnet *net.IPNet) error
+
+	// IsBanned returns whether the subnet itself is banned.
+	IsBanned(subnet *net.IPNet) bool
+
+	// ListBanned returns the current bans.
+	ListBanned() []*p2p.BanEntry
+
+	// ClearBanned lifts all the bans.
+	ClearBanned() error
+
+	// NodeAddresses returns a random selection of the known peer
+	// addresses.
+	NodeAddresses() []*network.PeerAddress
+
+	// AddPeerAddress adds the address to the known peer addresses, as
+	// tried when tried is set, and returns whether it is known.
+	AddPeerAddress(address *network.PeerAddress, tried bool) bool
 }
 
 // ServerSyncManager represents a sync manager for use with the RPC server.
@@ -730,6 +891,9 @@ type ServerConfig struct {
 	// SyncMgr defines the sync manager for the RPC server to use.
 	SyncMgr ServerSyncManager
 
+	// CPUMiner solves blocks using the CPU for the generate commands.
+	CPUMiner *mining.CPUMiner
+
 	// These fields allow the RPC server to interface with the local block
 	// chain data and state.
 	//TimeSource blockchain.MedianTimeSource    	// todo open
@@ -761,18 +925,18 @@ func SetupRPCListeners() ([]net.Listener, error) {
 	// Setup TLS if not disabled.
 	listenFunc := net.Listen
 	// todo open
-	if !conf.CFG.DisableTLS {
+	if !conf.AppConf.DisableTLS {
 		// Generate the TLS cert and key file if both don't already
 		// exist.
 
-		if !fileExists(conf.CFG.RPCKey) && !fileExists(conf.CFG.RPCCert) {
-			err := GenCertPair(conf.CFG.RPCCert, conf.CFG.RPCKey)
+		if !fileExists(conf.AppConf.RPCKey) && !fileExists(conf.AppConf.RPCCert) {
+			err := GenCertPair(conf.AppConf.RPCCert, conf.AppConf.RPCKey)
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		keypair, err := tls.LoadX509KeyPair(conf.CFG.RPCCert, conf.CFG.RPCKey)
+		keypair, err := tls.LoadX509KeyPair(conf.AppConf.RPCCert, conf.AppConf.RPCKey)
 		if err != nil {
 			return nil, err
 		}
@@ -788,7 +952,7 @@ func SetupRPCListeners() ([]net.Listener, error) {
 		}
 	}
 
-	netAddrs, err := parseListeners(conf.CFG.RPCListeners)
+	netAddrs, err := parseListeners(conf.AppConf.RPCListeners)
 	if err != nil {
 		return nil, err
 	}
@@ -882,27 +1046,51 @@ func (a simpleAddr) Network() string {
 // Ensure simpleAddr implements the net.Addr interface.
 var _ net.Addr = simpleAddr{}
 
+// maxConcurrentReqs returns the number of batched requests which may be
+// processed at the same time.
+func maxConcurrentReqs() int {
+	if conf.AppConf.RPCMaxConcurrentReqs < 1 {
+		return 1
+	}
+	return conf.AppConf.RPCMaxConcurrentReqs
+}
+
 // NewServer returns a new instance of the Server struct.
 func NewServer(config *ServerConfig) (*Server, error) {
 	rpc := Server{
-		cfg:         *config,
-		statusLines: make(map[int]string),
-		//gbtWorkState:           newGbtWorkState(config.TimeSource), // todo open
+		cfg:                    *config,
+		statusLines:            make(map[int]string),
+		gbtWorkState:           newGbtWorkState(),
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
-		quit: make(chan int),
+		requestSem:             make(chan struct{}, maxConcurrentReqs()),
+		quit:                   make(chan int),
 	}
-	if conf.CFG.RPCUser != "" && conf.CFG.RPCPass != "" {
-		fmt.Println("rpcuser", conf.CFG.RPCUser)
-		login := conf.CFG.RPCUser + ":" + conf.CFG.RPCPass
+	if conf.AppConf.RPCUser != "" && conf.AppConf.RPCPass != "" {
+		fmt.Println("rpcuser", conf.AppConf.RPCUser)
+		login := conf.AppConf.RPCUser + ":" + conf.AppConf.RPCPass
 		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.authsha = sha256.Sum256([]byte(auth))
 	}
-	if conf.CFG.RPCLimitUser != "" && conf.CFG.RPCLimitPass != "" {
-		login := conf.CFG.RPCLimitUser + ":" + conf.CFG.RPCLimitPass
+	if conf.AppConf.RPCLimitUser != "" && conf.AppConf.RPCLimitPass != "" {
+		login := conf.AppConf.RPCLimitUser + ":" + conf.AppConf.RPCLimitPass
 		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.limitauthsha = sha256.Sum256([]byte(auth))
 	}
+	cookie, err := generateAuthCookie()
+	if err != nil {
+		return nil, err
+	}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(cookie))
+	rpc.cookieauthsha = sha256.Sum256([]byte(auth))
+	rpc.authEntries, err = parseRPCAuth(conf.AppConf.RPCAuth)
+	if err != nil {
+		return nil, err
+	}
+	rpc.permissions, err = parseRPCPermissions(conf.AppConf.RPCWhitelist, conf.AppConf.RPCBlacklist)
+	if err != nil {
+		return nil, err
+	}
 	//rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)  // todo open
 
 	return &rpc, nil
@@ -40,6 +40,18 @@ var helpDescsEnUS = map[string]string{
 	"node-target":        "Either the IP address and port of the peer to operate on, or a valid peer ID.",
 	"node-connectsubcmd": "'perm' to make the connected peer a permanent one, 'temp' to try a single connect to a peer",
 
+	// AddPeerAddressCmd help.
+	"addpeeraddress--synopsis": "Adds an address to the table of known peer addresses, as if the peer advertised itself.",
+	"addpeeraddress-address":   "The IP address of the peer",
+	"addpeeraddress-port":      "The port of the peer",
+	"addpeeraddress-tried":     "Whether to add the address to the tried addresses, as if a connection to it succeeded",
+
+	// AddPeerAddressResult help.
+	"addpeeraddressresult-success": "Whether the address is in the table, unroutable addresses are never added",
+
+	// ClearBannedCmd help.
+	"clearbanned--synopsis": "Lifts the bans of all the IP addresses and subnets.",
+
 	// TransactionInput help.
 	"transactioninput-txid": "The hash of the input transaction",
 	"transactioninput-vout": "The specific output of the input transaction to redeem",
@@ -119,8 +131,17 @@ var helpDescsEnUS = map[string]string{
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
 	"generate-numblocks": "Number of blocks to generate",
+	"generate-maxtries":  "How many iterations to try",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GenerateToAddressCmd help
+	"generatetoaddress--synopsis": "Mines a set number of blocks to the given address and returns a JSON\n" +
+		" array of their hashes.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address to send the newly generated coins to",
+	"generatetoaddress-maxtries":  "How many iterations to try",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -231,8 +252,6 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
 	"getblockverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
-	"getblockverboseresult-strippedsize":      "The size of the block without witness data",
-	"getblockverboseresult-weight":            "The weight of the block",
 
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
@@ -275,14 +294,16 @@ var helpDescsEnUS = map[string]string{
 	"templaterequest-target":       "The desired target for the block template (this parameter is ignored)",
 	"templaterequest-data":         "Hex-encoded block data (only for mode=proposal)",
 	"templaterequest-workid":       "The server provided workid if provided in block template (not applicable)",
+	"templaterequest-showstrategy": "Report the selection strategy which chose each transaction",
 
 	// GetBlockTemplateResultTx help.
-	"getblocktemplateresulttx-data":    "Hex-encoded transaction data (byte-for-byte)",
-	"getblocktemplateresulttx-hash":    "Hex-encoded transaction hash (little endian if treated as a 256-bit number)",
-	"getblocktemplateresulttx-depends": "Other transactions before this one (by 1-based index in the 'transactions'  list) that must be present in the final block if this one is",
-	"getblocktemplateresulttx-fee":     "Difference in value between transaction inputs and outputs (in Satoshi)",
-	"getblocktemplateresulttx-sigops":  "Total number of signature operations as counted for purposes of block limits",
-	"getblocktemplateresulttx-weight":  "The weight of the transaction",
+	"getblocktemplateresulttx-data":     "Hex-encoded transaction data (byte-for-byte)",
+	"getblocktemplateresulttx-hash":     "Hex-encoded transaction hash (little endian if treated as a 256-bit number)",
+	"getblocktemplateresulttx-depends":  "Other transactions before this one (by 1-based index in the 'transactions'  list) that must be present in the final block if this one is",
+	"getblocktemplateresulttx-fee":      "Difference in value between transaction inputs and outputs (in Satoshi)",
+	"getblocktemplateresulttx-sigops":   "Total number of signature operations as counted for purposes of block limits",
+	"getblocktemplateresulttx-weight":   "The weight of the transaction",
+	"getblocktemplateresulttx-strategy": "The selection strategy which chose the transaction (only with showstrategy)",
 
 	// GetBlockTemplateResultAux help.
 	"getblocktemplateresultaux-flags": "Hex-encoded byte-for-byte data to include in the coinbase signature script",
@@ -382,6 +403,49 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":   "Returns all the in-mempool ancestors of the transaction.",
+	"getmempoolancestors-txid":        "The transaction id, which must be in the mempool",
+	"getmempoolancestors-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0": "verbose=false",
+	"getmempoolancestors--condition1": "verbose=true",
+	"getmempoolancestors--result0":    "Array of the ancestors' transaction hashes",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":   "Returns all the in-mempool descendants of the transaction.",
+	"getmempooldescendants-txid":        "The transaction id, which must be in the mempool",
+	"getmempooldescendants-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0": "verbose=false",
+	"getmempooldescendants--condition1": "verbose=true",
+	"getmempooldescendants--result0":    "Array of the descendants' transaction hashes",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns the mempool data of the transaction.",
+	"getmempoolentry-txid":      "The transaction id, which must be in the mempool",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-size":             "Transaction size in bytes",
+	"getmempoolentryresult-fee":              "Transaction fee in bitcoins",
+	"getmempoolentryresult-modifiedfee":      "Transaction fee with the fee delta of prioritisetransaction, in bitcoins",
+	"getmempoolentryresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":           "Block height when transaction entered the pool",
+	"getmempoolentryresult-startingpriority": "Priority when transaction entered the pool",
+	"getmempoolentryresult-currentpriority":  "Current priority",
+	"getmempoolentryresult-descendantcount":  "Number of in-mempool descendant transactions (including this one)",
+	"getmempoolentryresult-descendantsize":   "Size of in-mempool descendants (including this one)",
+	"getmempoolentryresult-descendantfees":   "Modified fees of in-mempool descendants (including this one), in bitcoins",
+	"getmempoolentryresult-ancestorcount":    "Number of in-mempool ancestor transactions (including this one)",
+	"getmempoolentryresult-ancestorsize":     "Size of in-mempool ancestors (including this one)",
+	"getmempoolentryresult-ancestorfees":     "Modified fees of in-mempool ancestors (including this one), in bitcoins",
+	"getmempoolentryresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
+
+	// GetMempoolFeeHistogramCmd help.
+	"getmempoolfeehistogram--synopsis": "Returns the size of the mempool transactions grouped by fee rate, in descending fee rate order.",
+
+	// GetMempoolFeeHistogramResult help.
+	"getmempoolfeehistogramresult-feerate": "The lowest fee rate of the bucket in satoshis per byte",
+	"getmempoolfeehistogramresult-size":    "Sum size in bytes of the transactions in the bucket",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
@@ -412,50 +476,80 @@ var helpDescsEnUS = map[string]string{
 	"getnetworkhashps-height":    "Perform estimate ending with this height or -1 for current best chain block height",
 	"getnetworkhashps--result0":  "Estimated hashes per second",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Accepts the transaction into mined blocks at a higher (or lower) priority.\n" +
+		"The deltas are accumulated, and kept for the transaction not in the memory pool yet.",
+	"prioritisetransaction-txid":          "The transaction id",
+	"prioritisetransaction-prioritydelta": "The priority to add or subtract",
+	"prioritisetransaction-feedelta":      "The fee value (in satoshis) to add (or subtract, if negative), which only affects the selection and eviction, not the actual fee paid",
+	"prioritisetransaction--result0":      "Returns true",
+
 	// GetNetTotalsCmd help.
 	"getnettotals--synopsis": "Returns a JSON object containing network traffic statistics.",
 
 	// GetNetTotalsResult help.
-	"getnettotalsresult-totalbytesrecv": "Total bytes received",
-	"getnettotalsresult-totalbytessent": "Total bytes sent",
-	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-totalbytesrecv":  "Total bytes received",
+	"getnettotalsresult-totalbytessent":  "Total bytes sent",
+	"getnettotalsresult-timemillis":      "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-uploadtarget":    "The upload target set with -maxuploadtarget",
+	"getnettotalsresult-inboundevicted":  "Number of inbound peers evicted to make room for new ones",
+	"getnettotalsresult-inboundrejected": "Number of new inbound peers rejected because no peer could be evicted",
+
+	// UploadTargetResult help.
+	"uploadtargetresult-timeframe":               "The length of the cycle of the target in seconds",
+	"uploadtargetresult-target":                  "The target in bytes per cycle, 0 when there is none",
+	"uploadtargetresult-target_reached":          "Whether the target is reached",
+	"uploadtargetresult-serve_historical_blocks": "Whether historical blocks are still served to the peers without the download permission",
+	"uploadtargetresult-bytes_left_in_cycle":     "The bytes left to send in the current cycle",
+	"uploadtargetresult-time_left_in_cycle":      "The seconds left in the current cycle",
+
+	// GetNodeAddressesCmd help.
+	"getnodeaddresses--synopsis": "Returns known addresses which can be used to find new peers, picked at random the way they are sent to peers asking for addresses.",
+	"getnodeaddresses-count":     "The number of addresses to return, 0 for all those of the selection",
+
+	// GetNodeAddressesResult help.
+	"getnodeaddressesresult-time":     "The time the address was last seen in seconds since 1 Jan 1970 GMT",
+	"getnodeaddressesresult-services": "The services offered by the peer",
+	"getnodeaddressesresult-address":  "The IP address or onion host of the peer",
+	"getnodeaddressesresult-port":     "The port of the peer",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":                       "A unique node ID",
+	"getpeerinforesult-addr":                     "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":                "Local address",
+	"getpeerinforesult-services":                 "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":                "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":                 "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":                 "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":                "Total bytes sent",
+	"getpeerinforesult-bytesrecv":                "Total bytes received",
+	"getpeerinforesult-conntime":                 "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":               "The time offset of the peer",
+	"getpeerinforesult-pingtime":                 "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":                 "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":                  "The protocol version of the peer",
+	"getpeerinforesult-subver":                   "The user agent of the peer",
+	"getpeerinforesult-inbound":                  "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-startingheight":           "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":            "The current height of the peer",
+	"getpeerinforesult-banscore":                 "The ban score",
+	"getpeerinforesult-feefilter":                "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":                 "Whether or not the peer is the sync peer",
+	"getpeerinforesult-mapped_as":                "The autonomous system announcing the address of the peer according to the asmap, omitted when it isn't mapped",
+	"getpeerinforesult-connection_type":          "The type of the connection: inbound, outbound-full-relay, block-relay-only, feeler or manual",
+	"getpeerinforesult-permissions":              "The permissions given to the peer by the whitelists and the whitebinds: noban, relay, forcerelay, mempool, download or addr",
+	"getpeerinforesult-bytessent_per_msg":        "The bytes sent to the peer by message command",
+	"getpeerinforesult-bytessent_per_msg--key":   "command",
+	"getpeerinforesult-bytessent_per_msg--value": "The bytes sent in the messages of the command",
+	"getpeerinforesult-bytessent_per_msg--desc":  "The bytes sent, messages which couldn't be decoded are counted as *other*",
+	"getpeerinforesult-bytesrecv_per_msg":        "The bytes received from the peer by message command",
+	"getpeerinforesult-bytesrecv_per_msg--key":   "command",
+	"getpeerinforesult-bytesrecv_per_msg--value": "The bytes received in the messages of the command",
+	"getpeerinforesult-bytesrecv_per_msg--desc":  "The bytes received, messages which couldn't be decoded are counted as *other*",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
-	// GetRawMempoolVerboseResult help.
-	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
-	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
-	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
-	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
-	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
-	"getrawmempoolverboseresult-currentpriority":  "Current priority",
-	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
-	"getrawmempoolverboseresult-vsize":            "The virtual size of a transaction",
-
 	// GetRawMempoolCmd help.
 	"getrawmempool--synopsis":   "Returns information about all of the transactions currently in the memory pool.",
 	"getrawmempool-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
@@ -493,6 +587,15 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":      "The banned IP address or subnet",
+	"listbannedresult-banned_until": "The time the ban ends in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_created":  "The time the ban was made in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_reason":   "Why the address was banned, 'node misbehaving' or 'manually added'",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
@@ -520,6 +623,18 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-allowhighfees": "Whether or not to allow insanely high fees (btcd does not yet implement this parameter, so it has no effect)",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Attempts to add or remove an IP address or subnet from the banned list.\n" +
+		"Peers in a newly banned subnet are disconnected, peers with the noban permission are never banned.",
+	"setban-subnet":   "The IP address or the subnet in CIDR notation, such as 192.168.0.0/24, to operate on",
+	"setban-command":  "'add' to ban the IP address or subnet, 'remove' to lift its ban",
+	"setban-bantime":  "The number of seconds the ban lasts, 0 for the --banduration of the server",
+	"setban-absolute": "Whether bantime is the time the ban ends in seconds since 1 Jan 1970 GMT",
+
+	// SetCoinbaseCommitmentsCmd help.
+	"setcoinbasecommitments--synopsis":   "Sets the data the coinbase of new blocks commits to, each in an OP_RETURN output.\nAn empty list removes the commitments.",
+	"setcoinbasecommitments-commitments": "The hex-encoded data to commit to, up to 80 bytes each",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -653,47 +768,59 @@ var helpDescsEnUS = map[string]string{
 // This information is used to generate the help.  Each result type must be a
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
-	"addnode":               nil,
-	"createrawtransaction":  {(*string)(nil)},
-	"debuglevel":            {(*string)(nil), (*string)(nil)},
-	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
-	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
-	"generate":              {(*[]string)(nil)},
-	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
-	"getbestblockhash":      {(*string)(nil)},
-	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
-	"getblockcount":         {(*int64)(nil)},
-	"getblockhash":          {(*string)(nil)},
-	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
-	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
-	"getblockchaininfo":     {(*btcjson.GetBlockChainInfoResult)(nil)},
-	"getconnectioncount":    {(*int32)(nil)},
-	"getcurrentnet":         {(*uint32)(nil)},
-	"getdifficulty":         {(*float64)(nil)},
-	"getgenerate":           {(*bool)(nil)},
-	"gethashespersec":       {(*float64)(nil)},
-	"getheaders":            {(*[]string)(nil)},
-	"getinfo":               {(*btcjson.InfoChainResult)(nil)},
-	"getmempoolinfo":        {(*btcjson.GetMempoolInfoResult)(nil)},
-	"getmininginfo":         {(*btcjson.GetMiningInfoResult)(nil)},
-	"getnettotals":          {(*btcjson.GetNetTotalsResult)(nil)},
-	"getnetworkhashps":      {(*int64)(nil)},
-	"getpeerinfo":           {(*[]btcjson.GetPeerInfoResult)(nil)},
-	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
-	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
-	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
-	"node":                  nil,
-	"help":                  {(*string)(nil), (*string)(nil)},
-	"ping":                  nil,
-	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
-	"sendrawtransaction":    {(*string)(nil)},
-	"setgenerate":           nil,
-	"stop":                  {(*string)(nil)},
-	"submitblock":           {nil, (*string)(nil)},
-	"uptime":                {(*int64)(nil)},
-	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":           {(*bool)(nil)},
-	"verifymessage":         {(*bool)(nil)},
+	"addnode":                nil,
+	"addpeeraddress":         {(*btcjson.AddPeerAddressResult)(nil)},
+	"clearbanned":            nil,
+	"createrawtransaction":   {(*string)(nil)},
+	"debuglevel":             {(*string)(nil), (*string)(nil)},
+	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
+	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
+	"generate":               {(*[]string)(nil)},
+	"generatetoaddress":      {(*[]string)(nil)},
+	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getbestblockhash":       {(*string)(nil)},
+	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
+	"getblockcount":          {(*int64)(nil)},
+	"getblockhash":           {(*string)(nil)},
+	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getblockchaininfo":      {(*btcjson.GetBlockChainInfoResult)(nil)},
+	"getconnectioncount":     {(*int32)(nil)},
+	"getcurrentnet":          {(*uint32)(nil)},
+	"getdifficulty":          {(*float64)(nil)},
+	"getgenerate":            {(*bool)(nil)},
+	"gethashespersec":        {(*float64)(nil)},
+	"getheaders":             {(*[]string)(nil)},
+	"getinfo":                {(*btcjson.InfoChainResult)(nil)},
+	"getmempoolancestors":    {(*[]string)(nil), (*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempooldescendants":  {(*[]string)(nil), (*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempoolentry":        {(*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempoolfeehistogram": {(*[]btcjson.GetMempoolFeeHistogramResult)(nil)},
+	"getmempoolinfo":         {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmininginfo":          {(*btcjson.GetMiningInfoResult)(nil)},
+	"getnettotals":           {(*btcjson.GetNetTotalsResult)(nil)},
+	"getnetworkhashps":       {(*int64)(nil)},
+	"getnodeaddresses":       {(*[]btcjson.GetNodeAddressesResult)(nil)},
+	"getpeerinfo":            {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetMempoolEntryResult)(nil)},
+	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
+	"listbanned":             {(*[]btcjson.ListBannedResult)(nil)},
+	"node":                   nil,
+	"help":                   {(*string)(nil), (*string)(nil)},
+	"ping":                   nil,
+	"prioritisetransaction":  {(*bool)(nil)},
+	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
+	"sendrawtransaction":     {(*string)(nil)},
+	"setban":                 nil,
+	"setcoinbasecommitments": nil,
+	"setgenerate":            nil,
+	"stop":                   {(*string)(nil)},
+	"submitblock":            {nil, (*string)(nil)},
+	"uptime":                 {(*int64)(nil)},
+	"validateaddress":        {(*btcjson.ValidateAddressChainResult)(nil)},
+	"verifychain":            {(*bool)(nil)},
+	"verifymessage":          {(*bool)(nil)},
 }
 
 // helpCacher provides a concurrent safe type that provides help and usage for
@@ -0,0 +1,924 @@
+package rpcclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// FutureGetBestBlockHashResult is a future promise to deliver the result of a
+// GetBestBlockHashAsync RPC invocation (or an applicable error).
+type FutureGetBestBlockHashResult chan *response
+
+// Receive waits for the response promised by the future and returns the hash
+// of the best block in the longest block chain.
+func (r FutureGetBestBlockHashResult) Receive() (string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return "", err
+	}
+
+	var hash string
+	if err := json.Unmarshal(res, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetBestBlockHashAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetBestBlockHash for the blocking version and more details.
+func (c *Client) GetBestBlockHashAsync() FutureGetBestBlockHashResult {
+	cmd := btcjson.NewGetBestBlockHashCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetBestBlockHash returns the hash of the best block in the longest block
+// chain.
+func (c *Client) GetBestBlockHash() (string, error) {
+	return c.GetBestBlockHashAsync().Receive()
+}
+
+// FutureGetBestBlockResult is a future promise to deliver the result of a
+// GetBestBlockAsync RPC invocation (or an applicable error).
+type FutureGetBestBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns the hash
+// and height of the block in the longest (best) chain.
+func (r FutureGetBestBlockResult) Receive() (string, int32, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var bestBlock btcjson.GetBestBlockResult
+	if err := json.Unmarshal(res, &bestBlock); err != nil {
+		return "", 0, err
+	}
+	return bestBlock.Hash, bestBlock.Height, nil
+}
+
+// GetBestBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBestBlock for the blocking version and more details.
+func (c *Client) GetBestBlockAsync() FutureGetBestBlockResult {
+	cmd := btcjson.NewGetBestBlockCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetBestBlock returns the hash and height of the block in the longest (best)
+// chain.
+func (c *Client) GetBestBlock() (string, int32, error) {
+	return c.GetBestBlockAsync().Receive()
+}
+
+// FutureGetBlockResult is a future promise to deliver the result of a
+// GetBlockAsync RPC invocation (or an applicable error).
+type FutureGetBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns the raw
+// block requested from the server given its hash.
+func (r FutureGetBlockResult) Receive() ([]byte, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var blockHex string
+	if err := json.Unmarshal(res, &blockHex); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(blockHex)
+}
+
+// GetBlockRawAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlockRaw for the blocking version and more details.
+func (c *Client) GetBlockRawAsync(blockHash string) FutureGetBlockResult {
+	cmd := btcjson.NewGetBlockCmd(blockHash, btcjson.Bool(false), nil)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockRaw returns the serialized block from the server given its hash.
+//
+// See GetBlock to retrieve a data structure with information about the block
+// instead.
+func (c *Client) GetBlockRaw(blockHash string) ([]byte, error) {
+	return c.GetBlockRawAsync(blockHash).Receive()
+}
+
+// FutureGetBlockVerboseResult is a future promise to deliver the result of a
+// GetBlockAsync or GetBlockVerboseTxAsync RPC invocation (or an applicable
+// error).
+type FutureGetBlockVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns the data
+// structure from the server with information about the requested block.
+func (r FutureGetBlockVerboseResult) Receive() (*btcjson.GetBlockVerboseResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var blockResult btcjson.GetBlockVerboseResult
+	if err := json.Unmarshal(res, &blockResult); err != nil {
+		return nil, err
+	}
+	return &blockResult, nil
+}
+
+// GetBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlock for the blocking version and more details.
+func (c *Client) GetBlockAsync(blockHash string) FutureGetBlockVerboseResult {
+	cmd := btcjson.NewGetBlockCmd(blockHash, btcjson.Bool(true), nil)
+	return c.sendCmd(cmd)
+}
+
+// GetBlock returns a data structure from the server with information about a
+// block given its hash, listing the hashes of its transactions.
+//
+// See GetBlockVerboseTx to retrieve the transactions in detail, and
+// GetBlockRaw to retrieve the serialized block.
+func (c *Client) GetBlock(blockHash string) (*btcjson.GetBlockVerboseResult, error) {
+	return c.GetBlockAsync(blockHash).Receive()
+}
+
+// GetBlockVerboseTxAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetBlockVerboseTx for the blocking version and more details.
+func (c *Client) GetBlockVerboseTxAsync(blockHash string) FutureGetBlockVerboseResult {
+	cmd := btcjson.NewGetBlockCmd(blockHash, btcjson.Bool(true), btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetBlockVerboseTx returns a data structure from the server with information
+// about a block and its transactions given its hash.
+func (c *Client) GetBlockVerboseTx(blockHash string) (*btcjson.GetBlockVerboseResult, error) {
+	return c.GetBlockVerboseTxAsync(blockHash).Receive()
+}
+
+// FutureGetBlockCountResult is a future promise to deliver the result of a
+// GetBlockCountAsync RPC invocation (or an applicable error).
+type FutureGetBlockCountResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// number of blocks in the longest block chain.
+func (r FutureGetBlockCountResult) Receive() (int64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := json.Unmarshal(res, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetBlockCountAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlockCount for the blocking version and more details.
+func (c *Client) GetBlockCountAsync() FutureGetBlockCountResult {
+	cmd := btcjson.NewGetBlockCountCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetBlockCount returns the number of blocks in the longest block chain.
+func (c *Client) GetBlockCount() (int64, error) {
+	return c.GetBlockCountAsync().Receive()
+}
+
+// FutureGetBlockChainInfoResult is a future promise to deliver the result of
+// a GetBlockChainInfoAsync RPC invocation (or an applicable error).
+type FutureGetBlockChainInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// information about the current state of the block chain.
+func (r FutureGetBlockChainInfoResult) Receive() (*btcjson.GetBlockChainInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainInfo btcjson.GetBlockChainInfoResult
+	if err := json.Unmarshal(res, &chainInfo); err != nil {
+		return nil, err
+	}
+	return &chainInfo, nil
+}
+
+// GetBlockChainInfoAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetBlockChainInfo for the blocking version and more details.
+func (c *Client) GetBlockChainInfoAsync() FutureGetBlockChainInfoResult {
+	cmd := btcjson.NewGetBlockChainInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetBlockChainInfo returns information related to the processing state of
+// various chain-specific details such as the current difficulty from the tip
+// of the main chain.
+func (c *Client) GetBlockChainInfo() (*btcjson.GetBlockChainInfoResult, error) {
+	return c.GetBlockChainInfoAsync().Receive()
+}
+
+// FutureGetBlockHashResult is a future promise to deliver the result of a
+// GetBlockHashAsync RPC invocation (or an applicable error).
+type FutureGetBlockHashResult chan *response
+
+// Receive waits for the response promised by the future and returns the hash
+// of the block in the best block chain at the given height.
+func (r FutureGetBlockHashResult) Receive() (string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return "", err
+	}
+
+	var hash string
+	if err := json.Unmarshal(res, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetBlockHashAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlockHash for the blocking version and more details.
+func (c *Client) GetBlockHashAsync(blockHeight int) FutureGetBlockHashResult {
+	cmd := btcjson.NewGetBlockHashCmd(blockHeight)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockHash returns the hash of the block in the best block chain at the
+// given height.
+func (c *Client) GetBlockHash(blockHeight int) (string, error) {
+	return c.GetBlockHashAsync(blockHeight).Receive()
+}
+
+// FutureGetBlockHeaderResult is a future promise to deliver the result of a
+// GetBlockHeaderRawAsync RPC invocation (or an applicable error).
+type FutureGetBlockHeaderResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// serialized block header requested from the server given its hash.
+func (r FutureGetBlockHeaderResult) Receive() ([]byte, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var headerHex string
+	if err := json.Unmarshal(res, &headerHex); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(headerHex)
+}
+
+// GetBlockHeaderRawAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetBlockHeaderRaw for the blocking version and more details.
+func (c *Client) GetBlockHeaderRawAsync(blockHash string) FutureGetBlockHeaderResult {
+	cmd := btcjson.NewGetBlockHeaderCmd(blockHash, btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetBlockHeaderRaw returns the serialized block header from the server given
+// its hash.
+func (c *Client) GetBlockHeaderRaw(blockHash string) ([]byte, error) {
+	return c.GetBlockHeaderRawAsync(blockHash).Receive()
+}
+
+// FutureGetBlockHeaderVerboseResult is a future promise to deliver the result
+// of a GetBlockHeaderAsync RPC invocation (or an applicable error).
+type FutureGetBlockHeaderVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns the data
+// structure of the block header requested from the server given its hash.
+func (r FutureGetBlockHeaderVerboseResult) Receive() (*btcjson.GetBlockHeaderVerboseResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header btcjson.GetBlockHeaderVerboseResult
+	if err := json.Unmarshal(res, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// GetBlockHeaderAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetBlockHeader for the blocking version and more details.
+func (c *Client) GetBlockHeaderAsync(blockHash string) FutureGetBlockHeaderVerboseResult {
+	cmd := btcjson.NewGetBlockHeaderCmd(blockHash, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetBlockHeader returns a data structure with information about the block
+// header from the server given its hash.
+func (c *Client) GetBlockHeader(blockHash string) (*btcjson.GetBlockHeaderVerboseResult, error) {
+	return c.GetBlockHeaderAsync(blockHash).Receive()
+}
+
+// FutureGetChainTipsResult is a future promise to deliver the result of a
+// GetChainTipsAsync RPC invocation (or an applicable error).
+type FutureGetChainTipsResult chan *response
+
+// Receive waits for the response promised by the future and returns the tips
+// of all the known branches of the block tree.
+func (r FutureGetChainTipsResult) Receive() ([]btcjson.GetChainTipsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []btcjson.GetChainTipsResult
+	if err := json.Unmarshal(res, &tips); err != nil {
+		return nil, err
+	}
+	return tips, nil
+}
+
+// GetChainTipsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetChainTips for the blocking version and more details.
+func (c *Client) GetChainTipsAsync() FutureGetChainTipsResult {
+	cmd := btcjson.NewGetChainTipsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetChainTips returns the tips of all the known branches of the block tree,
+// the main chain included.
+func (c *Client) GetChainTips() ([]btcjson.GetChainTipsResult, error) {
+	return c.GetChainTipsAsync().Receive()
+}
+
+// FutureGetDifficultyResult is a future promise to deliver the result of a
+// GetDifficultyAsync RPC invocation (or an applicable error).
+type FutureGetDifficultyResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// proof-of-work difficulty as a multiple of the minimum difficulty.
+func (r FutureGetDifficultyResult) Receive() (float64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var difficulty float64
+	if err := json.Unmarshal(res, &difficulty); err != nil {
+		return 0, err
+	}
+	return difficulty, nil
+}
+
+// GetDifficultyAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDifficulty for the blocking version and more details.
+func (c *Client) GetDifficultyAsync() FutureGetDifficultyResult {
+	cmd := btcjson.NewGetDifficultyCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetDifficulty returns the proof-of-work difficulty as a multiple of the
+// minimum difficulty.
+func (c *Client) GetDifficulty() (float64, error) {
+	return c.GetDifficultyAsync().Receive()
+}
+
+// FutureGetHeadersResult is a future promise to deliver the result of a
+// GetHeadersAsync RPC invocation (or an applicable error).
+type FutureGetHeadersResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// serialized block headers requested.
+func (r FutureGetHeadersResult) Receive() ([][]byte, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var headersHex []string
+	if err := json.Unmarshal(res, &headersHex); err != nil {
+		return nil, err
+	}
+	headers := make([][]byte, len(headersHex))
+	for i, headerHex := range headersHex {
+		headers[i], err = hex.DecodeString(headerHex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return headers, nil
+}
+
+// GetHeadersAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetHeaders for the blocking version and more details.
+func (c *Client) GetHeadersAsync(blockLocators []string, hashStop string) FutureGetHeadersResult {
+	cmd := btcjson.NewGetHeadersCmd(blockLocators, hashStop)
+	return c.sendCmd(cmd)
+}
+
+// GetHeaders returns the serialized headers of the main chain blocks following
+// the first known block of the locators, up to hashStop.
+func (c *Client) GetHeaders(blockLocators []string, hashStop string) ([][]byte, error) {
+	return c.GetHeadersAsync(blockLocators, hashStop).Receive()
+}
+
+// FutureGetMempoolEntryResult is a future promise to deliver the result of a
+// GetMempoolEntryAsync RPC invocation (or an applicable error).
+type FutureGetMempoolEntryResult chan *response
+
+// Receive waits for the response promised by the future and returns a data
+// structure with information about the transaction in the memory pool.
+func (r FutureGetMempoolEntryResult) Receive() (*btcjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry btcjson.GetMempoolEntryResult
+	if err := json.Unmarshal(res, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetMempoolEntryAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetMempoolEntry for the blocking version and more details.
+func (c *Client) GetMempoolEntryAsync(txHash string) FutureGetMempoolEntryResult {
+	cmd := btcjson.NewGetMempoolEntryCmd(txHash)
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolEntry returns a data structure with information about the
+// transaction in the memory pool given its hash.
+func (c *Client) GetMempoolEntry(txHash string) (*btcjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolEntryAsync(txHash).Receive()
+}
+
+// FutureTxHashesResult is a future promise to deliver a list of transaction
+// hashes, the result of a GetRawMempoolAsync, GetMempoolAncestorsAsync or
+// GetMempoolDescendantsAsync RPC invocation (or an applicable error).
+type FutureTxHashesResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// transaction hashes.
+func (r FutureTxHashesResult) Receive() ([]string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var txHashes []string
+	if err := json.Unmarshal(res, &txHashes); err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+// FutureMempoolEntriesResult is a future promise to deliver the mempool
+// entries by transaction hash, the result of a GetRawMempoolVerboseAsync,
+// GetMempoolAncestorsVerboseAsync or GetMempoolDescendantsVerboseAsync RPC
+// invocation (or an applicable error).
+type FutureMempoolEntriesResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// entries by transaction hash.
+func (r FutureMempoolEntriesResult) Receive() (map[string]*btcjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]*btcjson.GetMempoolEntryResult
+	if err := json.Unmarshal(res, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetRawMempoolAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetRawMempool for the blocking version and more details.
+func (c *Client) GetRawMempoolAsync() FutureTxHashesResult {
+	cmd := btcjson.NewGetRawMempoolCmd(btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetRawMempool returns the hashes of all transactions in the memory pool.
+//
+// See GetRawMempoolVerbose to retrieve data structures with information about
+// the transactions instead.
+func (c *Client) GetRawMempool() ([]string, error) {
+	return c.GetRawMempoolAsync().Receive()
+}
+
+// GetRawMempoolVerboseAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetRawMempoolVerbose for the blocking version and more details.
+func (c *Client) GetRawMempoolVerboseAsync() FutureMempoolEntriesResult {
+	cmd := btcjson.NewGetRawMempoolCmd(btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetRawMempoolVerbose returns a map of transaction hashes to an associated
+// data structure with information about the transaction for all transactions
+// in the memory pool.
+func (c *Client) GetRawMempoolVerbose() (map[string]*btcjson.GetMempoolEntryResult, error) {
+	return c.GetRawMempoolVerboseAsync().Receive()
+}
+
+// GetMempoolAncestorsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestors for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsAsync(txHash string) FutureTxHashesResult {
+	cmd := btcjson.NewGetMempoolAncestorsCmd(txHash, btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestors returns the hashes of the in-mempool ancestors of the
+// transaction given its hash.
+func (c *Client) GetMempoolAncestors(txHash string) ([]string, error) {
+	return c.GetMempoolAncestorsAsync(txHash).Receive()
+}
+
+// GetMempoolAncestorsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the
+// Receive function on the returned instance.
+//
+// See GetMempoolAncestorsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsVerboseAsync(txHash string) FutureMempoolEntriesResult {
+	cmd := btcjson.NewGetMempoolAncestorsCmd(txHash, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestorsVerbose returns the in-mempool ancestors of the
+// transaction given its hash, by transaction hash.
+func (c *Client) GetMempoolAncestorsVerbose(txHash string) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolAncestorsVerboseAsync(txHash).Receive()
+}
+
+// GetMempoolDescendantsAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendants for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsAsync(txHash string) FutureTxHashesResult {
+	cmd := btcjson.NewGetMempoolDescendantsCmd(txHash, btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendants returns the hashes of the in-mempool descendants of
+// the transaction given its hash.
+func (c *Client) GetMempoolDescendants(txHash string) ([]string, error) {
+	return c.GetMempoolDescendantsAsync(txHash).Receive()
+}
+
+// GetMempoolDescendantsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the
+// Receive function on the returned instance.
+//
+// See GetMempoolDescendantsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsVerboseAsync(txHash string) FutureMempoolEntriesResult {
+	cmd := btcjson.NewGetMempoolDescendantsCmd(txHash, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendantsVerbose returns the in-mempool descendants of the
+// transaction given its hash, by transaction hash.
+func (c *Client) GetMempoolDescendantsVerbose(txHash string) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolDescendantsVerboseAsync(txHash).Receive()
+}
+
+// FutureGetMempoolFeeHistogramResult is a future promise to deliver the
+// result of a GetMempoolFeeHistogramAsync RPC invocation (or an applicable
+// error).
+type FutureGetMempoolFeeHistogramResult chan *response
+
+// Receive waits for the response promised by the future and returns the fee
+// rate histogram of the memory pool.
+func (r FutureGetMempoolFeeHistogramResult) Receive() ([]btcjson.GetMempoolFeeHistogramResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var histogram []btcjson.GetMempoolFeeHistogramResult
+	if err := json.Unmarshal(res, &histogram); err != nil {
+		return nil, err
+	}
+	return histogram, nil
+}
+
+// GetMempoolFeeHistogramAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolFeeHistogram for the blocking version and more details.
+func (c *Client) GetMempoolFeeHistogramAsync() FutureGetMempoolFeeHistogramResult {
+	cmd := btcjson.NewGetMempoolFeeHistogramCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolFeeHistogram returns the fee rate histogram of the memory pool.
+func (c *Client) GetMempoolFeeHistogram() ([]btcjson.GetMempoolFeeHistogramResult, error) {
+	return c.GetMempoolFeeHistogramAsync().Receive()
+}
+
+// FutureGetMempoolInfoResult is a future promise to deliver the result of a
+// GetMempoolInfoAsync RPC invocation (or an applicable error).
+type FutureGetMempoolInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// state of the memory pool.
+func (r FutureGetMempoolInfoResult) Receive() (*btcjson.GetMempoolInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info btcjson.GetMempoolInfoResult
+	if err := json.Unmarshal(res, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetMempoolInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetMempoolInfo for the blocking version and more details.
+func (c *Client) GetMempoolInfoAsync() FutureGetMempoolInfoResult {
+	cmd := btcjson.NewGetMempoolInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolInfo returns the size and limits of the memory pool.
+func (c *Client) GetMempoolInfo() (*btcjson.GetMempoolInfoResult, error) {
+	return c.GetMempoolInfoAsync().Receive()
+}
+
+// FutureGetTxOutResult is a future promise to deliver the result of a
+// GetTxOutAsync RPC invocation (or an applicable error).
+type FutureGetTxOutResult chan *response
+
+// Receive waits for the response promised by the future and returns a
+// transaction output, or nil when it is spent or unknown.
+func (r FutureGetTxOutResult) Receive() (*btcjson.GetTxOutResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The server answers null for outputs not in the utxo set.
+	if len(res) == 0 || string(res) == "null" {
+		return nil, nil
+	}
+
+	var txOutInfo btcjson.GetTxOutResult
+	if err := json.Unmarshal(res, &txOutInfo); err != nil {
+		return nil, err
+	}
+	return &txOutInfo, nil
+}
+
+// GetTxOutAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOut for the blocking version and more details.
+func (c *Client) GetTxOutAsync(txHash string, index uint32, mempool bool) FutureGetTxOutResult {
+	cmd := btcjson.NewGetTxOutCmd(txHash, index, &mempool)
+	return c.sendCmd(cmd)
+}
+
+// GetTxOut returns the transaction output info if it's unspent and nil
+// otherwise.  mempool tells whether the spends and outputs of the
+// transactions in the memory pool are accounted for.
+func (c *Client) GetTxOut(txHash string, index uint32, mempool bool) (*btcjson.GetTxOutResult, error) {
+	return c.GetTxOutAsync(txHash, index, mempool).Receive()
+}
+
+// FutureGetTxOutSetInfoResult is a future promise to deliver the result of a
+// GetTxOutSetInfoAsync RPC invocation (or an applicable error).
+type FutureGetTxOutSetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the unspent transaction output set.
+func (r FutureGetTxOutSetInfoResult) Receive() (*btcjson.GetTxOutSetInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info btcjson.GetTxOutSetInfoResult
+	if err := json.Unmarshal(res, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetTxOutSetInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetTxOutSetInfo for the blocking version and more details.
+func (c *Client) GetTxOutSetInfoAsync() FutureGetTxOutSetInfoResult {
+	cmd := btcjson.NewGetTxOutSetInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutSetInfo returns the statistics of the unspent transaction output
+// set.
+func (c *Client) GetTxOutSetInfo() (*btcjson.GetTxOutSetInfoResult, error) {
+	return c.GetTxOutSetInfoAsync().Receive()
+}
+
+// FutureBlockCommandResult is a future promise to deliver the result of a
+// command on a block without result, such as an InvalidateBlockAsync,
+// ReconsiderBlockAsync or PreciousBlockAsync RPC invocation (or an applicable
+// error).
+type FutureBlockCommandResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the command failed.
+func (r FutureBlockCommandResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// InvalidateBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See InvalidateBlock for the blocking version and more details.
+func (c *Client) InvalidateBlockAsync(blockHash string) FutureBlockCommandResult {
+	cmd := btcjson.NewInvalidateBlockCmd(blockHash)
+	return c.sendCmd(cmd)
+}
+
+// InvalidateBlock marks the block as invalid, as well as its descendants.
+func (c *Client) InvalidateBlock(blockHash string) error {
+	return c.InvalidateBlockAsync(blockHash).Receive()
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash string) FutureBlockCommandResult {
+	cmd := btcjson.NewReconsiderBlockCmd(blockHash)
+	return c.sendCmd(cmd)
+}
+
+// ReconsiderBlock removes the invalidity status of the block and its
+// descendants, undoing an InvalidateBlock.
+func (c *Client) ReconsiderBlock(blockHash string) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
+// PreciousBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See PreciousBlock for the blocking version and more details.
+func (c *Client) PreciousBlockAsync(blockHash string) FutureBlockCommandResult {
+	cmd := btcjson.NewPreciousBlockCmd(blockHash)
+	return c.sendCmd(cmd)
+}
+
+// PreciousBlock treats the block as if it were received before the other
+// blocks with the same amount of work.
+func (c *Client) PreciousBlock(blockHash string) error {
+	return c.PreciousBlockAsync(blockHash).Receive()
+}
+
+// FutureVerifyChainResult is a future promise to deliver the result of a
+// VerifyChainAsync, VerifyChainLevelAsync, or VerifyChainBlocksAsync RPC
+// invocation (or an applicable error).
+type FutureVerifyChainResult chan *response
+
+// Receive waits for the response promised by the future and returns whether
+// or not the chain verified based on the check level and number of blocks
+// to verify specified in the original call.
+func (r FutureVerifyChainResult) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var verified bool
+	if err := json.Unmarshal(res, &verified); err != nil {
+		return false, err
+	}
+	return verified, nil
+}
+
+// VerifyChainAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See VerifyChain for the blocking version and more details.
+func (c *Client) VerifyChainAsync() FutureVerifyChainResult {
+	cmd := btcjson.NewVerifyChainCmd(nil, nil)
+	return c.sendCmd(cmd)
+}
+
+// VerifyChain requests the server to verify the block chain database using
+// the default check level and number of blocks to verify.
+//
+// See VerifyChainLevel and VerifyChainBlocks to override the defaults.
+func (c *Client) VerifyChain() (bool, error) {
+	return c.VerifyChainAsync().Receive()
+}
+
+// VerifyChainLevelAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See VerifyChainLevel for the blocking version and more details.
+func (c *Client) VerifyChainLevelAsync(checkLevel int32) FutureVerifyChainResult {
+	cmd := btcjson.NewVerifyChainCmd(&checkLevel, nil)
+	return c.sendCmd(cmd)
+}
+
+// VerifyChainLevel requests the server to verify the block chain database
+// using the passed check level and default number of blocks to verify.
+//
+// The check level controls how thorough the verification is with higher
+// numbers increasing the amount of checks done as consequently how long the
+// verification takes.
+//
+// See VerifyChain to use the default check level and VerifyChainBlocks to
+// override the number of blocks to verify.
+func (c *Client) VerifyChainLevel(checkLevel int32) (bool, error) {
+	return c.VerifyChainLevelAsync(checkLevel).Receive()
+}
+
+// VerifyChainBlocksAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See VerifyChainBlocks for the blocking version and more details.
+func (c *Client) VerifyChainBlocksAsync(checkLevel, numBlocks int32) FutureVerifyChainResult {
+	cmd := btcjson.NewVerifyChainCmd(&checkLevel, &numBlocks)
+	return c.sendCmd(cmd)
+}
+
+// VerifyChainBlocks requests the server to verify the block chain database
+// using the passed check level and number of blocks to verify.
+//
+// The check level controls how thorough the verification is with higher
+// numbers increasing the amount of checks done as consequently how long the
+// verification takes.
+//
+// The number of blocks refers to the number of blocks from the end of the
+// current longest chain.
+//
+// See VerifyChain and VerifyChainLevel to use defaults.
+func (c *Client) VerifyChainBlocks(checkLevel, numBlocks int32) (bool, error) {
+	return c.VerifyChainBlocksAsync(checkLevel, numBlocks).Receive()
+}
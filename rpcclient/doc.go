@@ -0,0 +1,64 @@
+/*
+Package rpcclient implements a JSON-RPC client for the node, built on the
+command and result types of the btcjson package.
+
+# Overview
+
+A Client is created with New from a ConnConfig naming the server and the way
+to authenticate with it: a user and password, or the cookie file the node
+writes its generated credentials to.  TLS is used unless disabled, trusting
+the certificates of the configuration or else the system roots.
+
+Each RPC is provided in a synchronous (blocking) and an asynchronous form.
+The asynchronous form, suffixed with Async, returns a future whose Receive
+method waits for the result:
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:       "localhost:8334",
+		CookiePath: "/path/to/datadir/.cookie",
+		MaxRetries: 5,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	blockCount := client.GetBlockCountAsync()
+	bestHash, err := client.GetBestBlockHash()
+	...
+	count, err := blockCount.Receive()
+
+# Connections
+
+The requests of a client are sent over a pool of HTTP connections kept alive
+between them.  ConnConfig.MaxConnections bounds both the number of requests
+in flight and the number of idle connections.  Requests for which no
+connection to the server could be opened, or which the server answers as
+unavailable, are retried up to ConnConfig.MaxRetries times with an exponential
+backoff.  Requests which may have reached the server, such as when the
+connection broke while waiting for the reply, are never retried, so that
+calls like sendrawtransaction or submitblock are not executed twice.
+
+# Batches
+
+Batch returns a client queueing the requests made with the asynchronous
+methods until Send posts them all at once as a JSON-RPC batch:
+
+	batch := client.Batch()
+	hashFuture := batch.GetBlockHashAsync(100)
+	infoFuture := batch.GetBlockChainInfoAsync()
+	if err := batch.Send(); err != nil {
+		return err
+	}
+	hash, err := hashFuture.Receive()
+
+# Errors
+
+Errors returned by the server are of type *btcjson.RPCError, holding the
+code of the error.  The other errors come from the transport, or are
+ErrInvalidAuth when the server refuses the credentials.
+
+Commands without a dedicated method, such as those added to the server after
+this package, can be sent with RawRequest.
+*/
+package rpcclient
@@ -0,0 +1,565 @@
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+const (
+	// DefaultMaxConnections is the number of requests a client has in
+	// flight at most, and the number of idle connections it keeps open to
+	// the server, unless configured otherwise.
+	DefaultMaxConnections = 4
+
+	// DefaultRetryBackoff is the time waited before the first retry of a
+	// request which did not reach the server.  It doubles with each retry.
+	DefaultRetryBackoff = 250 * time.Millisecond
+
+	// DefaultMaxRetryBackoff is the longest time waited between two
+	// retries of a request.
+	DefaultMaxRetryBackoff = 30 * time.Second
+
+	// cookieAuthUser is the user name of the credentials the node stores in
+	// its cookie file.
+	cookieAuthUser = "__cookie__"
+)
+
+var (
+	// ErrInvalidAuth is returned when the server rejects the credentials
+	// of the client.
+	ErrInvalidAuth = errors.New("authentication failure")
+
+	// ErrClientShutdown is returned by the requests of a client which is
+	// shut down, or is being shut down.
+	ErrClientShutdown = errors.New("the client has been shutdown")
+
+	// ErrEmptyBatch is returned by Send when no request was queued in the
+	// batch.
+	ErrEmptyBatch = errors.New("no requests in the batch")
+)
+
+// ConnConfig describes the connection configuration parameters for the
+// client.
+type ConnConfig struct {
+	// Host is the host and port of the RPC server, for example
+	// localhost:8334.
+	Host string
+
+	// User and Pass are the credentials of the RPC server.  When User is
+	// empty, the credentials are read from CookiePath instead.
+	User string
+	Pass string
+
+	// CookiePath is the path of the cookie file the node writes its
+	// generated credentials to.  It is read again for each request so that
+	// the client follows the new credentials of a restarted node.
+	CookiePath string
+
+	// DisableTLS specifies whether transport layer security should be
+	// disabled.  It is recommended to always use TLS if the RPC server
+	// supports it as otherwise your username and password is sent across
+	// the wire in cleartext.
+	DisableTLS bool
+
+	// Certificates are the bytes for a PEM-encoded certificate chain used
+	// for the TLS connection.  The system roots are used when empty.
+	Certificates []byte
+
+	// InsecureSkipVerify skips the verification of the certificate of the
+	// server.  Only use it for tests.
+	InsecureSkipVerify bool
+
+	// Dial, when set, opens the connections to the server, for example
+	// through a proxy.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// MaxConnections is the number of requests the client has in flight at
+	// most, and the number of idle connections it keeps open to reuse
+	// them.  DefaultMaxConnections is used when zero.
+	MaxConnections int
+
+	// MaxRetries is the number of times a request is retried when it did
+	// not reach the server or the server was unavailable.  Requests are not
+	// retried when zero.
+	MaxRetries int
+
+	// RetryBackoff is the time waited before the first retry, doubling
+	// with each retry up to MaxRetryBackoff.  DefaultRetryBackoff and
+	// DefaultMaxRetryBackoff are used when zero.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// Timeout is the time limit of each HTTP request, none when zero.
+	// Mind that getblocktemplate long polls wait for a new template for
+	// as long as it takes.
+	Timeout time.Duration
+}
+
+// jsonRequest holds information about a json request that is used to
+// properly detect, interpret, and deliver a reply to it.
+type jsonRequest struct {
+	id             uint64
+	method         string
+	cmd            interface{}
+	marshalledJSON []byte
+	responseChan   chan *response
+}
+
+// response is the raw bytes of a JSON-RPC result, or the error if the
+// response error object was non-null.
+type response struct {
+	result []byte
+	err    error
+}
+
+// rawResponse is a partially-unmarshaled JSON-RPC response.  For this to be
+// valid (according to JSON-RPC 1.0 spec), ID may not be nil.
+type rawResponse struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+	ID     *uint64           `json:"id"`
+}
+
+// result checks whether the unmarshaled response contains a non-nil error,
+// returning an unmarshaled btcjson.RPCError (or an unmarshaling error) if so.
+// If the response is not an error, the raw bytes of the request are
+// returned for further unmashaling into specific result types.
+func (r rawResponse) result() ([]byte, error) {
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return r.Result, nil
+}
+
+// Client represents a Bitcoin RPC client which allows easy access to the
+// various RPC methods available on a Bitcoin RPC server.  Each of the
+// wrapper functions handle the details of converting the passed and return
+// types to and from the underlying JSON types which are required for the
+// JSON-RPC invocations.
+//
+// The client provides each RPC in both synchronous (blocking) and
+// asynchronous (non-blocking) forms.  The asynchronous forms are based on
+// the concept of futures where they return an instance of a type that
+// promises to deliver the result of the invocation at some future time.
+// Invoking the Receive method on the returned future will block until the
+// result is available if it's not already.
+//
+// HTTP connections to the server are pooled and shared by all the requests
+// of a client and of its batches.
+type Client struct {
+	id uint64 // atomic, so must stay 64-bit aligned
+
+	config     *ConnConfig
+	url        string
+	httpClient *http.Client
+
+	// sem limits the number of requests in flight.
+	sem chan struct{}
+
+	// batch is set on the clients returned by Batch, which queue their
+	// requests in batchList until Send.
+	batch     bool
+	batchLock sync.Mutex
+	batchList []*jsonRequest
+
+	// ctx is canceled on shutdown, which aborts the requests in flight.
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       *sync.WaitGroup
+}
+
+// New creates a new RPC client based on the provided connection
+// configuration details.
+func New(config *ConnConfig) (*Client, error) {
+	if config.Host == "" {
+		return nil, errors.New("no RPC server host configured")
+	}
+	if config.User == "" && config.CookiePath == "" {
+		return nil, errors.New("neither RPC credentials nor a cookie file configured")
+	}
+
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if !config.DisableTLS {
+		scheme = "https"
+		tlsConfig = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+		if len(config.Certificates) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(config.Certificates) {
+				return nil, errors.New("no valid certificate in the configured certificates")
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	maxConns := config.MaxConnections
+	if maxConns <= 0 {
+		maxConns = DefaultMaxConnections
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        maxConns,
+		MaxIdleConnsPerHost: maxConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	dial := (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).Dial
+	if config.Dial != nil {
+		transport.Proxy = nil
+		dial = config.Dial
+	}
+	transport.Dial = func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return nil, &dialError{err}
+		}
+		return conn, nil
+	}
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	client := &Client{
+		config: config,
+		url:    scheme + "://" + config.Host,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		sem:      make(chan struct{}, maxConns),
+		ctx:      ctx,
+		shutdown: shutdown,
+		wg:       new(sync.WaitGroup),
+	}
+	return client, nil
+}
+
+// NextID returns the next id to be used when sending a JSON-RPC message.
+// This ID allows responses to be associated with particular requests per
+// the JSON-RPC specification.  Typically the consumer of the client does not
+// need to call this function, however, if a custom request is being created
+// and used this function should be used to ensure the ID is unique amongst
+// all requests being made.
+func (c *Client) NextID() uint64 {
+	return atomic.AddUint64(&c.id, 1)
+}
+
+// Batch returns a client which queues the requests made through it, instead
+// of sending them right away, until Send sends them all to the server in a
+// single JSON-RPC batch.  The batch shares the connections of c.
+//
+// Only the asynchronous forms of the RPCs are of use on a batch: their
+// futures deliver the results once Send has been called, so that the
+// synchronous forms would block forever.  Shutting down a batch shuts down
+// the client it was made from, and conversely.
+func (c *Client) Batch() *Client {
+	return &Client{
+		config:     c.config,
+		url:        c.url,
+		httpClient: c.httpClient,
+		sem:        c.sem,
+		batch:      true,
+		ctx:        c.ctx,
+		shutdown:   c.shutdown,
+		wg:         c.wg,
+	}
+}
+
+// Send sends the requests queued in the batch to the server and delivers
+// the responses to their futures.  The error returned is the one of the
+// batch as a whole, which is delivered to all its futures as well; the
+// errors of the individual requests are delivered by their futures only.
+func (c *Client) Send() error {
+	if !c.batch {
+		return errors.New("send is only valid on a batch client")
+	}
+	c.batchLock.Lock()
+	requests := c.batchList
+	c.batchList = nil
+	c.batchLock.Unlock()
+	if len(requests) == 0 {
+		return ErrEmptyBatch
+	}
+
+	marshalled := make([][]byte, len(requests))
+	for i, jReq := range requests {
+		marshalled[i] = jReq.marshalledJSON
+	}
+	body := make([]byte, 0, 2+len(requests))
+	body = append(body, '[')
+	body = append(body, bytes.Join(marshalled, []byte{','})...)
+	body = append(body, ']')
+
+	fail := func(err error) error {
+		for _, jReq := range requests {
+			jReq.responseChan <- &response{err: err}
+		}
+		return err
+	}
+
+	respBytes, err := c.post(body)
+	if err != nil {
+		return fail(err)
+	}
+
+	// A server failing the batch as a whole answers with a single
+	// response instead of an array.
+	var responses []rawResponse
+	if err := json.Unmarshal(respBytes, &responses); err != nil {
+		var resp rawResponse
+		if json.Unmarshal(respBytes, &resp) == nil && resp.Error != nil {
+			return fail(resp.Error)
+		}
+		return fail(fmt.Errorf("status code: %d, response: %q", http.StatusOK, string(respBytes)))
+	}
+
+	byID := make(map[uint64]rawResponse, len(responses))
+	for _, resp := range responses {
+		if resp.ID != nil {
+			byID[*resp.ID] = resp
+		}
+	}
+	for _, jReq := range requests {
+		resp, ok := byID[jReq.id]
+		if !ok {
+			jReq.responseChan <- &response{err: fmt.Errorf("no response to the batched %s request", jReq.method)}
+			continue
+		}
+		result, err := resp.result()
+		jReq.responseChan <- &response{result: result, err: err}
+	}
+	return nil
+}
+
+// Shutdown shuts down the client: the requests in flight and the future
+// ones fail with ErrClientShutdown.
+func (c *Client) Shutdown() {
+	c.shutdown()
+}
+
+// WaitForShutdown blocks until the requests in flight returned after a
+// Shutdown, and closes the idle connections.
+func (c *Client) WaitForShutdown() {
+	c.wg.Wait()
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// newFutureError returns a new future result channel that already has the
+// passed error waiting on the channel with the reply set to nil.  This is
+// useful to easily return errors from the various Async functions.
+func newFutureError(err error) chan *response {
+	responseChan := make(chan *response, 1)
+	responseChan <- &response{err: err}
+	return responseChan
+}
+
+// receiveFuture receives from the passed futureResult channel to extract a
+// reply or any errors.  The examined errors include an error in the
+// futureResult and the error in the reply from the server.  This will block
+// until the result is available on the passed channel.
+func receiveFuture(f chan *response) ([]byte, error) {
+	// Wait for a response on the returned channel.
+	r := <-f
+	return r.result, r.err
+}
+
+// sendCmd sends the passed command to the associated server and returns a
+// response channel on which the reply will be delivered at some point in the
+// future.  It handles both marshalling the command and queueing it in the
+// batch of a batch client.
+func (c *Client) sendCmd(cmd interface{}) chan *response {
+	method, err := btcjson.CmdMethod(cmd)
+	if err != nil {
+		return newFutureError(err)
+	}
+	id := c.NextID()
+	marshalledJSON, err := btcjson.MarshalCmd(id, cmd)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	return c.sendRequest(&jsonRequest{
+		id:             id,
+		method:         method,
+		cmd:            cmd,
+		marshalledJSON: marshalledJSON,
+		responseChan:   make(chan *response, 1),
+	})
+}
+
+// sendRequest sends the marshalled request to the server, or queues it in
+// the batch of a batch client, and returns its response channel.
+func (c *Client) sendRequest(jReq *jsonRequest) chan *response {
+	if c.ctx.Err() != nil {
+		return newFutureError(ErrClientShutdown)
+	}
+
+	responseChan := jReq.responseChan
+	if c.batch {
+		c.batchLock.Lock()
+		c.batchList = append(c.batchList, jReq)
+		c.batchLock.Unlock()
+		return responseChan
+	}
+
+	c.wg.Add(1)
+	go c.handleRequest(jReq)
+	return responseChan
+}
+
+// handleRequest posts the request to the server and delivers the response
+// to its future.
+func (c *Client) handleRequest(jReq *jsonRequest) {
+	defer c.wg.Done()
+
+	respBytes, err := c.post(jReq.marshalledJSON)
+	if err != nil {
+		jReq.responseChan <- &response{err: err}
+		return
+	}
+	var resp rawResponse
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		err = fmt.Errorf("status code: %d, response: %q", http.StatusOK, string(respBytes))
+		jReq.responseChan <- &response{err: err}
+		return
+	}
+	result, err := resp.result()
+	jReq.responseChan <- &response{result: result, err: err}
+}
+
+// post sends body to the server, retrying with backoff as configured while
+// the server cannot be reached, and returns the body of the JSON-RPC
+// response.
+func (c *Client) post(body []byte) ([]byte, error) {
+	backoff := c.config.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	maxBackoff := c.config.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		respBytes, retry, err := c.postOnce(body)
+		if err == nil || !retry || attempt >= c.config.MaxRetries {
+			return respBytes, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return nil, ErrClientShutdown
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// dialError is the error of a connection to the server which could not be
+// opened, so that no request was sent on it.
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string {
+	return e.err.Error()
+}
+
+// postOnce sends body to the server once.  retry tells whether the request
+// failed before the server processed it, so that it is safe to send it again:
+// no connection to the server could be opened, or the server answered it was
+// unavailable.  Requests which failed after they were sent, such as on a
+// broken connection, are not retried as the server may have executed them.
+func (c *Client) postOnce(body []byte) (respBytes []byte, retry bool, err error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-c.ctx.Done():
+		return nil, false, ErrClientShutdown
+	}
+	defer func() { <-c.sem }()
+
+	user, pass, err := c.credentials()
+	if err != nil {
+		// The node may be restarting and not have written its cookie
+		// yet.
+		return nil, true, err
+	}
+
+	httpRequest, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	httpRequest = httpRequest.WithContext(c.ctx)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.SetBasicAuth(user, pass)
+
+	httpResponse, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		if c.ctx.Err() != nil {
+			return nil, false, ErrClientShutdown
+		}
+		urlErr, ok := err.(*url.Error)
+		if !ok {
+			return nil, false, err
+		}
+		_, dialFailed := urlErr.Err.(*dialError)
+		return nil, dialFailed, err
+	}
+	respBytes, err = ioutil.ReadAll(httpResponse.Body)
+	httpResponse.Body.Close()
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading json reply: %v", err)
+	}
+
+	switch {
+	case httpResponse.StatusCode == http.StatusUnauthorized:
+		return nil, false, ErrInvalidAuth
+	case httpResponse.StatusCode == http.StatusServiceUnavailable:
+		return nil, true, fmt.Errorf("%d %s", httpResponse.StatusCode,
+			http.StatusText(httpResponse.StatusCode))
+	case httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300:
+		// Servers may answer JSON-RPC errors with an error status, so
+		// only responses without a JSON body fail here.
+		if len(respBytes) == 0 || !json.Valid(respBytes) {
+			return nil, false, fmt.Errorf("status code: %d, response: %q",
+				httpResponse.StatusCode, string(respBytes))
+		}
+	}
+	return respBytes, false, nil
+}
+
+// credentials returns the user and password to authenticate with: the
+// configured ones, or else the ones of the cookie file.
+func (c *Client) credentials() (string, string, error) {
+	if c.config.User != "" {
+		return c.config.User, c.config.Pass, nil
+	}
+	cookie, err := ioutil.ReadFile(c.config.CookiePath)
+	if err != nil {
+		return "", "", err
+	}
+	login := strings.TrimSpace(string(cookie))
+	i := strings.IndexByte(login, ':')
+	if i < 0 || login[:i] != cookieAuthUser {
+		return "", "", fmt.Errorf("malformed cookie file %s", c.config.CookiePath)
+	}
+	return login[:i], login[i+1:], nil
+}
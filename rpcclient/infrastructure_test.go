@@ -0,0 +1,311 @@
+package rpcclient
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// testHandler answers JSON-RPC requests, single or batched, with the result
+// or error handle returns for their command.
+func testHandler(t *testing.T, user, pass string, handle func(cmd interface{}) (interface{}, *btcjson.RPCError)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != pass {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		answer := func(raw json.RawMessage) json.RawMessage {
+			var req btcjson.Request
+			if err := json.Unmarshal(raw, &req); err != nil {
+				t.Errorf("unable to parse request %s: %v", raw, err)
+				return nil
+			}
+			cmd, err := btcjson.UnmarshalCmd(&req)
+			if err != nil {
+				t.Errorf("unable to parse command %s: %v", raw, err)
+				return nil
+			}
+			result, rpcErr := handle(cmd)
+			resp, err := btcjson.MarshalResponse(req.ID, result, rpcErr)
+			if err != nil {
+				t.Error(err)
+			}
+			return resp
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(body, &batch); err != nil {
+				t.Error(err)
+				return
+			}
+			responses := make([]json.RawMessage, len(batch))
+			for i, raw := range batch {
+				responses[i] = answer(raw)
+			}
+			resp, _ := json.Marshal(responses)
+			w.Write(resp)
+			return
+		}
+		w.Write(answer(body))
+	}
+}
+
+// chainHandler answers a few chain queries about a chain of 100 blocks.
+func chainHandler(cmd interface{}) (interface{}, *btcjson.RPCError) {
+	switch c := cmd.(type) {
+	case *btcjson.GetBlockCountCmd:
+		return 100, nil
+	case *btcjson.GetBestBlockHashCmd:
+		return "00000000000000000000000000000000000000000000000000000000000000aa", nil
+	case *btcjson.GetBlockCmd:
+		if c.Verbose == nil || !*c.Verbose {
+			return "0100", nil
+		}
+		return &btcjson.GetBlockVerboseResult{Hash: c.Hash, Height: 100, Tx: []string{"aa"}}, nil
+	}
+	return nil, btcjson.NewRPCError(btcjson.ErrRPCMethodNotFound.Code, "Method not found")
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, config ConnConfig) *Client {
+	config.Host = strings.TrimPrefix(strings.TrimPrefix(server.URL, "http://"), "https://")
+	if config.User == "" && config.CookiePath == "" {
+		config.User, config.Pass = "user", "pass"
+	}
+	if !strings.HasPrefix(server.URL, "https://") {
+		config.DisableTLS = true
+	}
+	client, err := New(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestTypedCalls(t *testing.T) {
+	server := httptest.NewServer(testHandler(t, "user", "pass", chainHandler))
+	defer server.Close()
+	client := newTestClient(t, server, ConnConfig{})
+	defer client.Shutdown()
+
+	count, err := client.GetBlockCount()
+	if err != nil || count != 100 {
+		t.Errorf("GetBlockCount: %d, %v", count, err)
+	}
+	block, err := client.GetBlock("ab")
+	if err != nil || block.Hash != "ab" || block.Height != 100 {
+		t.Errorf("GetBlock: %+v, %v", block, err)
+	}
+	raw, err := client.GetBlockRaw("ab")
+	if err != nil || len(raw) != 2 || raw[0] != 1 {
+		t.Errorf("GetBlockRaw: %x, %v", raw, err)
+	}
+
+	// The asynchronous calls complete in any order.
+	countFuture := client.GetBlockCountAsync()
+	hashFuture := client.GetBestBlockHashAsync()
+	if hash, err := hashFuture.Receive(); err != nil || !strings.HasSuffix(hash, "aa") {
+		t.Errorf("GetBestBlockHashAsync: %s, %v", hash, err)
+	}
+	if count, err := countFuture.Receive(); err != nil || count != 100 {
+		t.Errorf("GetBlockCountAsync: %d, %v", count, err)
+	}
+
+	// Server errors are returned as they are.
+	_, err = client.GetMempoolInfo()
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok || rpcErr.Code != btcjson.ErrRPCMethodNotFound.Code {
+		t.Errorf("GetMempoolInfo: %v, want a method not found error", err)
+	}
+
+	res, err := client.RawRequest("getblockcount", nil)
+	if err != nil || string(res) != "100" {
+		t.Errorf("RawRequest: %s, %v", res, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var posts int32
+	handler := testHandler(t, "user", "pass", chainHandler)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		handler(w, r)
+	}))
+	defer server.Close()
+	client := newTestClient(t, server, ConnConfig{})
+	defer client.Shutdown()
+
+	batch := client.Batch()
+	if err := batch.Send(); err != ErrEmptyBatch {
+		t.Errorf("empty batch sent: %v", err)
+	}
+	countFuture := batch.GetBlockCountAsync()
+	blockFuture := batch.GetBlockAsync("cd")
+	infoFuture := batch.GetMempoolInfoAsync()
+	if err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&posts); n != 1 {
+		t.Errorf("batch sent in %d requests", n)
+	}
+
+	if count, err := countFuture.Receive(); err != nil || count != 100 {
+		t.Errorf("GetBlockCountAsync: %d, %v", count, err)
+	}
+	if block, err := blockFuture.Receive(); err != nil || block.Hash != "cd" {
+		t.Errorf("GetBlockAsync: %+v, %v", block, err)
+	}
+	if _, err := infoFuture.Receive(); err == nil {
+		t.Error("the error of a batched request was not delivered")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var failures int32 = 2
+	handler := testHandler(t, "user", "pass", chainHandler)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server, ConnConfig{})
+	if _, err := client.GetBlockCount(); err == nil {
+		t.Error("request without retries succeeded on an unavailable server")
+	}
+	client.Shutdown()
+
+	atomic.StoreInt32(&failures, 2)
+	client = newTestClient(t, server, ConnConfig{MaxRetries: 3, RetryBackoff: time.Millisecond})
+	defer client.Shutdown()
+	if count, err := client.GetBlockCount(); err != nil || count != 100 {
+		t.Errorf("GetBlockCount with retries: %d, %v", count, err)
+	}
+}
+
+func TestRetryOnlyUnsent(t *testing.T) {
+	handler := testHandler(t, "user", "pass", chainHandler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Connections which can't be opened are retried.
+	var dials int32
+	dial := func(network, addr string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) <= 2 {
+			return nil, errors.New("connection refused")
+		}
+		return net.Dial(network, addr)
+	}
+	client := newTestClient(t, server, ConnConfig{Dial: dial, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	if count, err := client.GetBlockCount(); err != nil || count != 100 {
+		t.Errorf("GetBlockCount after failed dials: %d, %v", count, err)
+	}
+	client.Shutdown()
+
+	// A request whose connection breaks after it was sent may have been
+	// executed, so it is not sent again.
+	var posts int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	defer broken.Close()
+	client = newTestClient(t, broken, ConnConfig{MaxRetries: 3, RetryBackoff: time.Millisecond})
+	defer client.Shutdown()
+	if _, err := client.SendRawTransaction([]byte{0x00}, false); err == nil {
+		t.Error("request on a broken connection succeeded")
+	}
+	if n := atomic.LoadInt32(&posts); n != 1 {
+		t.Errorf("request sent %d times", n)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	handler := testHandler(t, cookieAuthUser, "secret", chainHandler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := newTestClient(t, server, ConnConfig{User: "user", Pass: "wrong", MaxRetries: 3})
+	if _, err := client.GetBlockCount(); err != ErrInvalidAuth {
+		t.Errorf("wrong credentials: %v, want %v", err, ErrInvalidAuth)
+	}
+	client.Shutdown()
+
+	dir, err := ioutil.TempDir("", "rpcclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookiePath := filepath.Join(dir, ".cookie")
+	if err := ioutil.WriteFile(cookiePath, []byte(cookieAuthUser+":secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(t, server, ConnConfig{CookiePath: cookiePath})
+	defer client.Shutdown()
+	if count, err := client.GetBlockCount(); err != nil || count != 100 {
+		t.Errorf("cookie authentication: %d, %v", count, err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(testHandler(t, "user", "pass", chainHandler))
+	defer server.Close()
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	client := newTestClient(t, server, ConnConfig{})
+	if _, err := client.GetBlockCount(); err == nil {
+		t.Error("untrusted certificate accepted")
+	}
+	client.Shutdown()
+
+	client = newTestClient(t, server, ConnConfig{Certificates: cert})
+	defer client.Shutdown()
+	if count, err := client.GetBlockCount(); err != nil || count != 100 {
+		t.Errorf("GetBlockCount over TLS: %d, %v", count, err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newTestClient(t, server, ConnConfig{})
+	future := client.GetBlockCountAsync()
+	client.Shutdown()
+	if _, err := future.Receive(); err != ErrClientShutdown {
+		t.Errorf("request in flight: %v, want %v", err, ErrClientShutdown)
+	}
+	if _, err := client.GetBlockCount(); err != ErrClientShutdown {
+		t.Errorf("request after shutdown: %v, want %v", err, ErrClientShutdown)
+	}
+	client.WaitForShutdown()
+}
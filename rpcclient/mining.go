@@ -0,0 +1,503 @@
+package rpcclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// FutureGenerateResult is a future promise to deliver the result of a
+// GenerateAsync or GenerateToAddressAsync RPC invocation (or an applicable
+// error).
+type FutureGenerateResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// hashes of the blocks generated by the call.
+func (r FutureGenerateResult) Receive() ([]string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var blockHashes []string
+	if err := json.Unmarshal(res, &blockHashes); err != nil {
+		return nil, err
+	}
+	return blockHashes, nil
+}
+
+// GenerateAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See Generate for the blocking version and more details.
+func (c *Client) GenerateAsync(numBlocks uint32) FutureGenerateResult {
+	cmd := btcjson.NewGenerateCmd(numBlocks, nil)
+	return c.sendCmd(cmd)
+}
+
+// Generate generates numBlocks blocks to the mining address of the node and
+// returns their hashes.
+func (c *Client) Generate(numBlocks uint32) ([]string, error) {
+	return c.GenerateAsync(numBlocks).Receive()
+}
+
+// GenerateToAddressAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GenerateToAddress for the blocking version and more details.
+func (c *Client) GenerateToAddressAsync(numBlocks uint32, address string, maxTries *uint64) FutureGenerateResult {
+	cmd := btcjson.NewGenerateToAddressCmd(numBlocks, address, maxTries)
+	return c.sendCmd(cmd)
+}
+
+// GenerateToAddress generates numBlocks blocks paying to address and returns
+// their hashes.  maxTries bounds the number of nonces tried per block, the
+// server default is used when nil.
+func (c *Client) GenerateToAddress(numBlocks uint32, address string, maxTries *uint64) ([]string, error) {
+	return c.GenerateToAddressAsync(numBlocks, address, maxTries).Receive()
+}
+
+// FutureGetGenerateResult is a future promise to deliver the result of a
+// GetGenerateAsync RPC invocation (or an applicable error).
+type FutureGetGenerateResult chan *response
+
+// Receive waits for the response promised by the future and returns true if
+// the server is set to mine, otherwise false.
+func (r FutureGetGenerateResult) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var result bool
+	if err := json.Unmarshal(res, &result); err != nil {
+		return false, err
+	}
+	return result, nil
+}
+
+// GetGenerateAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetGenerate for the blocking version and more details.
+func (c *Client) GetGenerateAsync() FutureGetGenerateResult {
+	cmd := btcjson.NewGetGenerateCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetGenerate returns true if the server is set to mine, otherwise false.
+func (c *Client) GetGenerate() (bool, error) {
+	return c.GetGenerateAsync().Receive()
+}
+
+// FutureSetGenerateResult is a future promise to deliver the result of a
+// SetGenerateAsync RPC invocation (or an applicable error).
+type FutureSetGenerateResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if any occurred when setting the server to generate coins (mine) or not.
+func (r FutureSetGenerateResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SetGenerateAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SetGenerate for the blocking version and more details.
+func (c *Client) SetGenerateAsync(enable bool, numCPUs int) FutureSetGenerateResult {
+	cmd := btcjson.NewSetGenerateCmd(enable, &numCPUs)
+	return c.sendCmd(cmd)
+}
+
+// SetGenerate sets the server to generate coins (mine) or not.
+func (c *Client) SetGenerate(enable bool, numCPUs int) error {
+	return c.SetGenerateAsync(enable, numCPUs).Receive()
+}
+
+// FutureGetHashesPerSecResult is a future promise to deliver the result of a
+// GetHashesPerSecAsync RPC invocation (or an applicable error).
+type FutureGetHashesPerSecResult chan *response
+
+// Receive waits for the response promised by the future and returns a recent
+// hashes per second performance measurement while generating coins (mining).
+// Zero is returned if the server is not mining.
+func (r FutureGetHashesPerSecResult) Receive() (float64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var result float64
+	if err := json.Unmarshal(res, &result); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// GetHashesPerSecAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetHashesPerSec for the blocking version and more details.
+func (c *Client) GetHashesPerSecAsync() FutureGetHashesPerSecResult {
+	cmd := btcjson.NewGetHashesPerSecCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetHashesPerSec returns a recent hashes per second performance measurement
+// while generating coins (mining).  Zero is returned if the server is not
+// mining.
+func (c *Client) GetHashesPerSec() (float64, error) {
+	return c.GetHashesPerSecAsync().Receive()
+}
+
+// FutureGetMiningInfoResult is a future promise to deliver the result of a
+// GetMiningInfoAsync RPC invocation (or an applicable error).
+type FutureGetMiningInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the mining
+// information.
+func (r FutureGetMiningInfoResult) Receive() (*btcjson.GetMiningInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var infoResult btcjson.GetMiningInfoResult
+	if err := json.Unmarshal(res, &infoResult); err != nil {
+		return nil, err
+	}
+	return &infoResult, nil
+}
+
+// GetMiningInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetMiningInfo for the blocking version and more details.
+func (c *Client) GetMiningInfoAsync() FutureGetMiningInfoResult {
+	cmd := btcjson.NewGetMiningInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetMiningInfo returns mining information.
+func (c *Client) GetMiningInfo() (*btcjson.GetMiningInfoResult, error) {
+	return c.GetMiningInfoAsync().Receive()
+}
+
+// FutureGetNetworkHashPS is a future promise to deliver the result of a
+// GetNetworkHashPSAsync RPC invocation (or an applicable error).
+type FutureGetNetworkHashPS chan *response
+
+// Receive waits for the response promised by the future and returns the
+// estimated network hashes per second for the block heights provided by the
+// parameters.
+func (r FutureGetNetworkHashPS) Receive() (int64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return -1, err
+	}
+
+	var result int64
+	if err := json.Unmarshal(res, &result); err != nil {
+		return -1, err
+	}
+	return result, nil
+}
+
+// GetNetworkHashPSAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetNetworkHashPS for the blocking version and more details.
+func (c *Client) GetNetworkHashPSAsync() FutureGetNetworkHashPS {
+	cmd := btcjson.NewGetNetworkHashPSCmd(nil, nil)
+	return c.sendCmd(cmd)
+}
+
+// GetNetworkHashPS returns the estimated network hashes per second using the
+// default number of blocks and the most recent block height.
+//
+// See GetNetworkHashPS2 to override the number of blocks to use and
+// GetNetworkHashPS3 to override the height at which to calculate the estimate.
+func (c *Client) GetNetworkHashPS() (int64, error) {
+	return c.GetNetworkHashPSAsync().Receive()
+}
+
+// GetNetworkHashPS2Async returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetNetworkHashPS2 for the blocking version and more details.
+func (c *Client) GetNetworkHashPS2Async(blocks int) FutureGetNetworkHashPS {
+	cmd := btcjson.NewGetNetworkHashPSCmd(&blocks, nil)
+	return c.sendCmd(cmd)
+}
+
+// GetNetworkHashPS2 returns the estimated network hashes per second for the
+// specified previous number of blocks working backwards from the most recent
+// block height.  The blocks parameter can also be -1 in which case the number
+// of blocks since the last difficulty change will be used.
+//
+// See GetNetworkHashPS to use defaults and GetNetworkHashPS3 to override the
+// height at which to calculate the estimate.
+func (c *Client) GetNetworkHashPS2(blocks int) (int64, error) {
+	return c.GetNetworkHashPS2Async(blocks).Receive()
+}
+
+// GetNetworkHashPS3Async returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetNetworkHashPS3 for the blocking version and more details.
+func (c *Client) GetNetworkHashPS3Async(blocks, height int) FutureGetNetworkHashPS {
+	cmd := btcjson.NewGetNetworkHashPSCmd(&blocks, &height)
+	return c.sendCmd(cmd)
+}
+
+// GetNetworkHashPS3 returns the estimated network hashes per second for the
+// specified previous number of blocks working backwards from the specified
+// block height.  The blocks parameter can also be -1 in which case the number
+// of blocks since the last difficulty change will be used.
+//
+// See GetNetworkHashPS and GetNetworkHashPS2 to use defaults.
+func (c *Client) GetNetworkHashPS3(blocks, height int) (int64, error) {
+	return c.GetNetworkHashPS3Async(blocks, height).Receive()
+}
+
+// FutureGetBlockTemplateResult is a future promise to deliver the result of a
+// GetBlockTemplateAsync RPC invocation (or an applicable error).
+type FutureGetBlockTemplateResult chan *response
+
+// Receive waits for the response promised by the future and returns the block
+// template.
+func (r FutureGetBlockTemplateResult) Receive() (*btcjson.GetBlockTemplateResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var template btcjson.GetBlockTemplateResult
+	if err := json.Unmarshal(res, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetBlockTemplateAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetBlockTemplate for the blocking version and more details.
+func (c *Client) GetBlockTemplateAsync(request *btcjson.TemplateRequest) FutureGetBlockTemplateResult {
+	cmd := btcjson.NewGetBlockTemplateCmd(request)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockTemplate returns a block template to mine on as described by
+// BIP 22 and BIP 23.  A request with a long poll id blocks until the template
+// changes, mind the Timeout of the connection configuration.
+//
+// See GetBlockTemplateProposal to submit a block proposal instead.
+func (c *Client) GetBlockTemplate(request *btcjson.TemplateRequest) (*btcjson.GetBlockTemplateResult, error) {
+	return c.GetBlockTemplateAsync(request).Receive()
+}
+
+// FutureSubmitBlockResult is a future promise to deliver the result of a
+// SubmitBlockAsync or GetBlockTemplateProposalAsync RPC invocation (or an
+// applicable error).
+type FutureSubmitBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block was rejected, holding the reason of the rejection.
+func (r FutureSubmitBlockResult) Receive() error {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return err
+	}
+
+	if string(res) != "null" && len(res) != 0 {
+		var result string
+		if err := json.Unmarshal(res, &result); err != nil {
+			return err
+		}
+		if result != "" {
+			return errors.New(result)
+		}
+	}
+	return nil
+}
+
+// GetBlockTemplateProposalAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetBlockTemplateProposal for the blocking version and more details.
+func (c *Client) GetBlockTemplateProposalAsync(block []byte) FutureSubmitBlockResult {
+	cmd := btcjson.NewGetBlockTemplateCmd(&btcjson.TemplateRequest{
+		Mode: "proposal",
+		Data: hex.EncodeToString(block),
+	})
+	return c.sendCmd(cmd)
+}
+
+// GetBlockTemplateProposal checks the serialized block as a block proposal of
+// BIP 23, returning the reason it would be rejected for as an error.
+func (c *Client) GetBlockTemplateProposal(block []byte) error {
+	return c.GetBlockTemplateProposalAsync(block).Receive()
+}
+
+// SubmitBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SubmitBlock for the blocking version and more details.
+func (c *Client) SubmitBlockAsync(block []byte, options *btcjson.SubmitBlockOptions) FutureSubmitBlockResult {
+	cmd := btcjson.NewSubmitBlockCmd(hex.EncodeToString(block), options)
+	return c.sendCmd(cmd)
+}
+
+// SubmitBlock attempts to submit the serialized block to the network,
+// returning the reason it was rejected for as an error.
+func (c *Client) SubmitBlock(block []byte, options *btcjson.SubmitBlockOptions) error {
+	return c.SubmitBlockAsync(block, options).Receive()
+}
+
+// FutureGetWork is a future promise to deliver the result of a
+// GetWorkAsync RPC invocation (or an applicable error).
+type FutureGetWork chan *response
+
+// Receive waits for the response promised by the future and returns the hash
+// data to work on.
+func (r FutureGetWork) Receive() (*btcjson.GetWorkResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.GetWorkResult
+	if err := json.Unmarshal(res, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetWorkAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetWork for the blocking version and more details.
+func (c *Client) GetWorkAsync() FutureGetWork {
+	cmd := btcjson.NewGetWorkCmd(nil)
+	return c.sendCmd(cmd)
+}
+
+// GetWork returns hash data to work on.
+//
+// See GetWorkSubmit to submit the found solution.
+func (c *Client) GetWork() (*btcjson.GetWorkResult, error) {
+	return c.GetWorkAsync().Receive()
+}
+
+// FutureGetWorkSubmit is a future promise to deliver the result of a
+// GetWorkSubmitAsync RPC invocation (or an applicable error).
+type FutureGetWorkSubmit chan *response
+
+// Receive waits for the response promised by the future and returns whether
+// or not the submitted block header was accepted.
+func (r FutureGetWorkSubmit) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var accepted bool
+	if err := json.Unmarshal(res, &accepted); err != nil {
+		return false, err
+	}
+	return accepted, nil
+}
+
+// GetWorkSubmitAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetWorkSubmit for the blocking version and more details.
+func (c *Client) GetWorkSubmitAsync(data string) FutureGetWorkSubmit {
+	cmd := btcjson.NewGetWorkCmd(&data)
+	return c.sendCmd(cmd)
+}
+
+// GetWorkSubmit submits a block header which is a solution to previously
+// requested data and returns whether or not the solution was accepted.
+//
+// See GetWork to request data to work on.
+func (c *Client) GetWorkSubmit(data string) (bool, error) {
+	return c.GetWorkSubmitAsync(data).Receive()
+}
+
+// FuturePrioritiseTransactionResult is a future promise to deliver the result
+// of a PrioritiseTransactionAsync RPC invocation (or an applicable error).
+type FuturePrioritiseTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the priority of the transaction could not be changed.
+func (r FuturePrioritiseTransactionResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PrioritiseTransactionAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See PrioritiseTransaction for the blocking version and more details.
+func (c *Client) PrioritiseTransactionAsync(txID string, priorityDelta float64, feeDelta int64) FuturePrioritiseTransactionResult {
+	cmd := btcjson.NewPrioritiseTransactionCmd(txID, priorityDelta, feeDelta)
+	return c.sendCmd(cmd)
+}
+
+// PrioritiseTransaction changes the priority and the fee, in satoshis, the
+// transaction is selected into blocks with by the given deltas.
+func (c *Client) PrioritiseTransaction(txID string, priorityDelta float64, feeDelta int64) error {
+	return c.PrioritiseTransactionAsync(txID, priorityDelta, feeDelta).Receive()
+}
+
+// FutureSetCoinbaseCommitmentsResult is a future promise to deliver the
+// result of a SetCoinbaseCommitmentsAsync RPC invocation (or an applicable
+// error).
+type FutureSetCoinbaseCommitmentsResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the commitments were refused.
+func (r FutureSetCoinbaseCommitmentsResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SetCoinbaseCommitmentsAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See SetCoinbaseCommitments for the blocking version and more details.
+func (c *Client) SetCoinbaseCommitmentsAsync(commitments [][]byte) FutureSetCoinbaseCommitmentsResult {
+	hexCommitments := make([]string, len(commitments))
+	for i, commitment := range commitments {
+		hexCommitments[i] = hex.EncodeToString(commitment)
+	}
+	cmd := btcjson.NewSetCoinbaseCommitmentsCmd(hexCommitments)
+	return c.sendCmd(cmd)
+}
+
+// SetCoinbaseCommitments sets the data committed to in OP_RETURN outputs of
+// the coinbase of the blocks the node builds, replacing the previous ones.
+func (c *Client) SetCoinbaseCommitments(commitments [][]byte) error {
+	return c.SetCoinbaseCommitmentsAsync(commitments).Receive()
+}
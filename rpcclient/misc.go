@@ -0,0 +1,318 @@
+package rpcclient
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// FutureGetInfoResult is a future promise to deliver the result of a
+// GetInfoAsync RPC invocation (or an applicable error).
+type FutureGetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the info
+// provided by the server.
+func (r FutureGetInfoResult) Receive() (*btcjson.InfoChainResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var infoRes btcjson.InfoChainResult
+	if err := json.Unmarshal(res, &infoRes); err != nil {
+		return nil, err
+	}
+	return &infoRes, nil
+}
+
+// GetInfoAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetInfo for the blocking version and more details.
+func (c *Client) GetInfoAsync() FutureGetInfoResult {
+	cmd := btcjson.NewGetInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetInfo returns miscellaneous info regarding the RPC server.  The returned
+// info object may be void of wallet information if the remote server does
+// not include wallet functionality.
+func (c *Client) GetInfo() (*btcjson.InfoChainResult, error) {
+	return c.GetInfoAsync().Receive()
+}
+
+// FutureGetCurrentNetResult is a future promise to deliver the result of a
+// GetCurrentNetAsync RPC invocation (or an applicable error).
+type FutureGetCurrentNetResult chan *response
+
+// Receive waits for the response promised by the future and returns the magic
+// of the network the server is running on.
+func (r FutureGetCurrentNetResult) Receive() (uint32, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var net uint32
+	if err := json.Unmarshal(res, &net); err != nil {
+		return 0, err
+	}
+	return net, nil
+}
+
+// GetCurrentNetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetCurrentNet for the blocking version and more details.
+func (c *Client) GetCurrentNetAsync() FutureGetCurrentNetResult {
+	cmd := btcjson.NewGetCurrentNetCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetCurrentNet returns the magic of the network the server is running on.
+func (c *Client) GetCurrentNet() (uint32, error) {
+	return c.GetCurrentNetAsync().Receive()
+}
+
+// FutureHelpResult is a future promise to deliver the result of a HelpAsync
+// RPC invocation (or an applicable error).
+type FutureHelpResult chan *response
+
+// Receive waits for the response promised by the future and returns the help
+// text.
+func (r FutureHelpResult) Receive() (string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return "", err
+	}
+
+	var help string
+	if err := json.Unmarshal(res, &help); err != nil {
+		return "", err
+	}
+	return help, nil
+}
+
+// HelpAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See Help for the blocking version and more details.
+func (c *Client) HelpAsync(command string) FutureHelpResult {
+	var method *string
+	if command != "" {
+		method = &command
+	}
+	cmd := btcjson.NewHelpCmd(method)
+	return c.sendCmd(cmd)
+}
+
+// Help returns the help of the command, or the usage of all the commands when
+// command is empty.
+func (c *Client) Help(command string) (string, error) {
+	return c.HelpAsync(command).Receive()
+}
+
+// FutureStopResult is a future promise to deliver the result of a StopAsync
+// RPC invocation (or an applicable error).
+type FutureStopResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the server refused to stop.
+func (r FutureStopResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// StopAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See Stop for the blocking version and more details.
+func (c *Client) StopAsync() FutureStopResult {
+	cmd := btcjson.NewStopCmd()
+	return c.sendCmd(cmd)
+}
+
+// Stop shuts down the server.
+func (c *Client) Stop() error {
+	return c.StopAsync().Receive()
+}
+
+// FutureUptimeResult is a future promise to deliver the result of an
+// UptimeAsync RPC invocation (or an applicable error).
+type FutureUptimeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// number of seconds the server has been running.
+func (r FutureUptimeResult) Receive() (int64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var uptime int64
+	if err := json.Unmarshal(res, &uptime); err != nil {
+		return 0, err
+	}
+	return uptime, nil
+}
+
+// UptimeAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See Uptime for the blocking version and more details.
+func (c *Client) UptimeAsync() FutureUptimeResult {
+	cmd := btcjson.NewUptimeCmd()
+	return c.sendCmd(cmd)
+}
+
+// Uptime returns the number of seconds the server has been running.
+func (c *Client) Uptime() (int64, error) {
+	return c.UptimeAsync().Receive()
+}
+
+// FutureValidateAddressResult is a future promise to deliver the result of a
+// ValidateAddressAsync RPC invocation (or an applicable error).
+type FutureValidateAddressResult chan *response
+
+// Receive waits for the response promised by the future and returns information
+// about the given bitcoin address.
+func (r FutureValidateAddressResult) Receive() (*btcjson.ValidateAddressChainResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrResult btcjson.ValidateAddressChainResult
+	if err := json.Unmarshal(res, &addrResult); err != nil {
+		return nil, err
+	}
+	return &addrResult, nil
+}
+
+// ValidateAddressAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See ValidateAddress for the blocking version and more details.
+func (c *Client) ValidateAddressAsync(address string) FutureValidateAddressResult {
+	cmd := btcjson.NewValidateAddressCmd(address)
+	return c.sendCmd(cmd)
+}
+
+// ValidateAddress returns information about the given bitcoin address.
+func (c *Client) ValidateAddress(address string) (*btcjson.ValidateAddressChainResult, error) {
+	return c.ValidateAddressAsync(address).Receive()
+}
+
+// FutureVerifyMessageResult is a future promise to deliver the result of a
+// VerifyMessageAsync RPC invocation (or an applicable error).
+type FutureVerifyMessageResult chan *response
+
+// Receive waits for the response promised by the future and returns whether or
+// not the message was successfully verified.
+func (r FutureVerifyMessageResult) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var verified bool
+	if err := json.Unmarshal(res, &verified); err != nil {
+		return false, err
+	}
+	return verified, nil
+}
+
+// VerifyMessageAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See VerifyMessage for the blocking version and more details.
+func (c *Client) VerifyMessageAsync(address, signature, message string) FutureVerifyMessageResult {
+	cmd := btcjson.NewVerifyMessageCmd(address, signature, message)
+	return c.sendCmd(cmd)
+}
+
+// VerifyMessage verifies a signed message.
+func (c *Client) VerifyMessage(address, signature, message string) (bool, error) {
+	return c.VerifyMessageAsync(address, signature, message).Receive()
+}
+
+// FutureRawResult is a future promise to deliver the result of a RawRequest
+// RPC invocation (or an applicable error).
+type FutureRawResult chan *response
+
+// Receive waits for the response promised by the future and returns the raw
+// response, or an error if the request was unsuccessful.
+func (r FutureRawResult) Receive() (json.RawMessage, error) {
+	return receiveFuture(r)
+}
+
+// RawRequestAsync returns an instance of a type that can be used to get the
+// result of a custom RPC request at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See RawRequest for the blocking version and more details.
+func (c *Client) RawRequestAsync(method string, params []json.RawMessage) FutureRawResult {
+	// Method may not be empty.
+	if method == "" {
+		return newFutureError(errors.New("no method"))
+	}
+
+	// Marshal parameters as "[]" instead of "null" when no parameters
+	// are passed.
+	if params == nil {
+		params = []json.RawMessage{}
+	}
+
+	id := c.NextID()
+	rawRequest := &btcjson.Request{
+		Jsonrpc: "1.0",
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	}
+	marshalledJSON, err := json.Marshal(rawRequest)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	return c.sendRequest(&jsonRequest{
+		id:             id,
+		method:         method,
+		cmd:            rawRequest,
+		marshalledJSON: marshalledJSON,
+		responseChan:   make(chan *response, 1),
+	})
+}
+
+// RawRequest allows the caller to send a raw or custom request to the server,
+// such as one of the commands btcjson has no type for.  This method may be
+// used to send and receive requests and responses for requests that are not
+// handled by this client package, or to proxy partially unmarshaled requests
+// to another JSON-RPC server if a request cannot be handled directly.
+func (c *Client) RawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	return c.RawRequestAsync(method, params).Receive()
+}
+
+// SendCmdAsync returns an instance of a type that can be used to get the
+// result of the command at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See SendCmd for the blocking version and more details.
+func (c *Client) SendCmdAsync(cmd interface{}) FutureRawResult {
+	return c.sendCmd(cmd)
+}
+
+// SendCmd sends a command of a type registered with btcjson and returns its
+// raw result.  It serves the generic tools which build their commands with
+// btcjson.NewCmd, such as btcctl.
+func (c *Client) SendCmd(cmd interface{}) (json.RawMessage, error) {
+	return c.SendCmdAsync(cmd).Receive()
+}
@@ -0,0 +1,479 @@
+package rpcclient
+
+import (
+	"encoding/json"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// FutureAddNodeResult is a future promise to deliver the result of an
+// AddNodeAsync RPC invocation (or an applicable error).
+type FutureAddNodeResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if any occurred when performing the specified command.
+func (r FutureAddNodeResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// AddNodeAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See AddNode for the blocking version and more details.
+func (c *Client) AddNodeAsync(host string, command btcjson.AddNodeSubCmd) FutureAddNodeResult {
+	cmd := btcjson.NewAddNodeCmd(host, command)
+	return c.sendCmd(cmd)
+}
+
+// AddNode attempts to perform the passed command on the passed persistent peer.
+// For example, it can be used to add or a remove a persistent peer, or to do
+// a one time connection to a peer.
+//
+// It may not be used to remove non-persistent peers.
+func (c *Client) AddNode(host string, command btcjson.AddNodeSubCmd) error {
+	return c.AddNodeAsync(host, command).Receive()
+}
+
+// FutureNodeResult is a future promise to deliver the result of a NodeAsync
+// RPC invocation (or an applicable error).
+type FutureNodeResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if any occurred when performing the specified command.
+func (r FutureNodeResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NodeAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See Node for the blocking version and more details.
+func (c *Client) NodeAsync(command btcjson.NodeSubCmd, host string,
+	connectSubCmd *string) FutureNodeResult {
+	cmd := btcjson.NewNodeCmd(command, host, connectSubCmd)
+	return c.sendCmd(cmd)
+}
+
+// Node attempts to perform the passed node command on the host.
+// For example, it can be used to add or a remove a persistent peer, or to do
+// connect or disconnect a non-persistent one.
+//
+// The connectSubCmd should be set either "perm" or "temp", depending on
+// whether we are targeting a persistent or non-persistent peer.  Passing nil
+// will cause the default value to be used, which currently is "temp".
+func (c *Client) Node(command btcjson.NodeSubCmd, host string,
+	connectSubCmd *string) error {
+	return c.NodeAsync(command, host, connectSubCmd).Receive()
+}
+
+// FutureGetAddedNodeInfoResult is a future promise to deliver the result of a
+// GetAddedNodeInfoAsync RPC invocation (or an applicable error).
+type FutureGetAddedNodeInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about manually added (persistent) peers.
+func (r FutureGetAddedNodeInfoResult) Receive() ([]btcjson.GetAddedNodeInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeInfo []btcjson.GetAddedNodeInfoResult
+	if err := json.Unmarshal(res, &nodeInfo); err != nil {
+		return nil, err
+	}
+	return nodeInfo, nil
+}
+
+// GetAddedNodeInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetAddedNodeInfo for the blocking version and more details.
+func (c *Client) GetAddedNodeInfoAsync(peer string) FutureGetAddedNodeInfoResult {
+	var node *string
+	if peer != "" {
+		node = &peer
+	}
+	cmd := btcjson.NewGetAddedNodeInfoCmd(true, node)
+	return c.sendCmd(cmd)
+}
+
+// GetAddedNodeInfo returns information about manually added (persistent)
+// peers, all of them when peer is empty.
+//
+// See GetAddedNodeInfoNoDNS to retrieve only a list of the added (persistent)
+// peers.
+func (c *Client) GetAddedNodeInfo(peer string) ([]btcjson.GetAddedNodeInfoResult, error) {
+	return c.GetAddedNodeInfoAsync(peer).Receive()
+}
+
+// FutureGetAddedNodeInfoNoDNSResult is a future promise to deliver the result
+// of a GetAddedNodeInfoNoDNSAsync RPC invocation (or an applicable error).
+type FutureGetAddedNodeInfoNoDNSResult chan *response
+
+// Receive waits for the response promised by the future and returns a list of
+// manually added (persistent) peers.
+func (r FutureGetAddedNodeInfoNoDNSResult) Receive() ([]string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	if err := json.Unmarshal(res, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// GetAddedNodeInfoNoDNSAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetAddedNodeInfoNoDNS for the blocking version and more details.
+func (c *Client) GetAddedNodeInfoNoDNSAsync(peer string) FutureGetAddedNodeInfoNoDNSResult {
+	var node *string
+	if peer != "" {
+		node = &peer
+	}
+	cmd := btcjson.NewGetAddedNodeInfoCmd(false, node)
+	return c.sendCmd(cmd)
+}
+
+// GetAddedNodeInfoNoDNS returns a list of manually added (persistent) peers,
+// all of them when peer is empty.  This works by setting the dns flag to
+// false in the underlying RPC.
+//
+// See GetAddedNodeInfo to obtain more information about each added node.
+func (c *Client) GetAddedNodeInfoNoDNS(peer string) ([]string, error) {
+	return c.GetAddedNodeInfoNoDNSAsync(peer).Receive()
+}
+
+// FutureGetConnectionCountResult is a future promise to deliver the result
+// of a GetConnectionCountAsync RPC invocation (or an applicable error).
+type FutureGetConnectionCountResult chan *response
+
+// Receive waits for the response promised by the future and returns the number
+// of active connections to other peers.
+func (r FutureGetConnectionCountResult) Receive() (int64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := json.Unmarshal(res, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetConnectionCountAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetConnectionCount for the blocking version and more details.
+func (c *Client) GetConnectionCountAsync() FutureGetConnectionCountResult {
+	cmd := btcjson.NewGetConnectionCountCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetConnectionCount returns the number of active connections to other peers.
+func (c *Client) GetConnectionCount() (int64, error) {
+	return c.GetConnectionCountAsync().Receive()
+}
+
+// FuturePingResult is a future promise to deliver the result of a PingAsync RPC
+// invocation (or an applicable error).
+type FuturePingResult chan *response
+
+// Receive waits for the response promised by the future and returns the result
+// of queueing a ping to be sent to each connected peer.
+func (r FuturePingResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PingAsync returns an instance of a type that can be used to get the result of
+// the RPC at some future time by invoking the Receive function on the returned
+// instance.
+//
+// See Ping for the blocking version and more details.
+func (c *Client) PingAsync() FuturePingResult {
+	cmd := btcjson.NewPingCmd()
+	return c.sendCmd(cmd)
+}
+
+// Ping queues a ping to be sent to each connected peer.
+//
+// Use the GetPeerInfo function and examine the PingTime and PingWait fields to
+// access the ping times.
+func (c *Client) Ping() error {
+	return c.PingAsync().Receive()
+}
+
+// FutureGetPeerInfoResult is a future promise to deliver the result of a
+// GetPeerInfoAsync RPC invocation (or an applicable error).
+type FutureGetPeerInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns data about
+// each connected network peer.
+func (r FutureGetPeerInfoResult) Receive() ([]btcjson.GetPeerInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var peerInfo []btcjson.GetPeerInfoResult
+	if err := json.Unmarshal(res, &peerInfo); err != nil {
+		return nil, err
+	}
+	return peerInfo, nil
+}
+
+// GetPeerInfoAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetPeerInfo for the blocking version and more details.
+func (c *Client) GetPeerInfoAsync() FutureGetPeerInfoResult {
+	cmd := btcjson.NewGetPeerInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetPeerInfo returns data about each connected network peer.
+func (c *Client) GetPeerInfo() ([]btcjson.GetPeerInfoResult, error) {
+	return c.GetPeerInfoAsync().Receive()
+}
+
+// FutureGetNetTotalsResult is a future promise to deliver the result of a
+// GetNetTotalsAsync RPC invocation (or an applicable error).
+type FutureGetNetTotalsResult chan *response
+
+// Receive waits for the response promised by the future and returns network
+// traffic statistics.
+func (r FutureGetNetTotalsResult) Receive() (*btcjson.GetNetTotalsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var totals btcjson.GetNetTotalsResult
+	if err := json.Unmarshal(res, &totals); err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// GetNetTotalsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetNetTotals for the blocking version and more details.
+func (c *Client) GetNetTotalsAsync() FutureGetNetTotalsResult {
+	cmd := btcjson.NewGetNetTotalsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetNetTotals returns network traffic statistics.
+func (c *Client) GetNetTotals() (*btcjson.GetNetTotalsResult, error) {
+	return c.GetNetTotalsAsync().Receive()
+}
+
+// FutureGetNetworkInfoResult is a future promise to deliver the result of a
+// GetNetworkInfoAsync RPC invocation (or an applicable error).
+type FutureGetNetworkInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the state
+// of the peer-to-peer networking of the node.
+func (r FutureGetNetworkInfoResult) Receive() (*btcjson.GetNetworkInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info btcjson.GetNetworkInfoResult
+	if err := json.Unmarshal(res, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetNetworkInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetNetworkInfo for the blocking version and more details.
+func (c *Client) GetNetworkInfoAsync() FutureGetNetworkInfoResult {
+	cmd := btcjson.NewGetNetworkInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetNetworkInfo returns the state of the peer-to-peer networking of the
+// node.
+func (c *Client) GetNetworkInfo() (*btcjson.GetNetworkInfoResult, error) {
+	return c.GetNetworkInfoAsync().Receive()
+}
+
+// FutureSetBanResult is a future promise to deliver the result of a
+// SetBanAsync RPC invocation (or an applicable error).
+type FutureSetBanResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if any occurred when performing the specified command.
+func (r FutureSetBanResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SetBanAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SetBan for the blocking version and more details.
+func (c *Client) SetBanAsync(subNet string, command btcjson.SetBanSubCmd, banTime *int64, absolute *bool) FutureSetBanResult {
+	cmd := btcjson.NewSetBanCmd(subNet, command, banTime, absolute)
+	return c.sendCmd(cmd)
+}
+
+// SetBan bans an IP address or a subnet, or lifts its ban.  The ban lasts
+// banTime seconds, or until the unix time banTime when absolute is set.
+// Passing nil for them bans for the default ban duration of the server.
+func (c *Client) SetBan(subNet string, command btcjson.SetBanSubCmd, banTime *int64, absolute *bool) error {
+	return c.SetBanAsync(subNet, command, banTime, absolute).Receive()
+}
+
+// FutureListBannedResult is a future promise to deliver the result of a
+// ListBannedAsync RPC invocation (or an applicable error).
+type FutureListBannedResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// banned IP addresses and subnets.
+func (r FutureListBannedResult) Receive() ([]btcjson.ListBannedResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var banned []btcjson.ListBannedResult
+	if err := json.Unmarshal(res, &banned); err != nil {
+		return nil, err
+	}
+	return banned, nil
+}
+
+// ListBannedAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ListBanned for the blocking version and more details.
+func (c *Client) ListBannedAsync() FutureListBannedResult {
+	cmd := btcjson.NewListBannedCmd()
+	return c.sendCmd(cmd)
+}
+
+// ListBanned returns the banned IP addresses and subnets.
+func (c *Client) ListBanned() ([]btcjson.ListBannedResult, error) {
+	return c.ListBannedAsync().Receive()
+}
+
+// FutureClearBannedResult is a future promise to deliver the result of a
+// ClearBannedAsync RPC invocation (or an applicable error).
+type FutureClearBannedResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if any occurred when performing the specified command.
+func (r FutureClearBannedResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// ClearBannedAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ClearBanned for the blocking version and more details.
+func (c *Client) ClearBannedAsync() FutureClearBannedResult {
+	cmd := btcjson.NewClearBannedCmd()
+	return c.sendCmd(cmd)
+}
+
+// ClearBanned lifts all the bans.
+func (c *Client) ClearBanned() error {
+	return c.ClearBannedAsync().Receive()
+}
+
+// FutureGetNodeAddressesResult is a future promise to deliver the result of a
+// GetNodeAddressesAsync RPC invocation (or an applicable error).
+type FutureGetNodeAddressesResult chan *response
+
+// Receive waits for the response promised by the future and returns known
+// peer addresses.
+func (r FutureGetNodeAddressesResult) Receive() ([]btcjson.GetNodeAddressesResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []btcjson.GetNodeAddressesResult
+	if err := json.Unmarshal(res, &addresses); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetNodeAddressesAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetNodeAddresses for the blocking version and more details.
+func (c *Client) GetNodeAddressesAsync(count *int32) FutureGetNodeAddressesResult {
+	cmd := btcjson.NewGetNodeAddressesCmd(count)
+	return c.sendCmd(cmd)
+}
+
+// GetNodeAddresses returns up to count known peer addresses picked at random,
+// all those of the selection for 0.  Passing nil returns one address.
+func (c *Client) GetNodeAddresses(count *int32) ([]btcjson.GetNodeAddressesResult, error) {
+	return c.GetNodeAddressesAsync(count).Receive()
+}
+
+// FutureAddPeerAddressResult is a future promise to deliver the result of an
+// AddPeerAddressAsync RPC invocation (or an applicable error).
+type FutureAddPeerAddressResult chan *response
+
+// Receive waits for the response promised by the future and returns whether
+// the address is in the address table.
+func (r FutureAddPeerAddressResult) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var result btcjson.AddPeerAddressResult
+	if err := json.Unmarshal(res, &result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// AddPeerAddressAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See AddPeerAddress for the blocking version and more details.
+func (c *Client) AddPeerAddressAsync(address string, port uint16, tried *bool) FutureAddPeerAddressResult {
+	cmd := btcjson.NewAddPeerAddressCmd(address, port, tried)
+	return c.sendCmd(cmd)
+}
+
+// AddPeerAddress adds an address to the table of known peer addresses, as a
+// tried address when tried is set, and returns whether it is in the table.
+func (c *Client) AddPeerAddress(address string, port uint16, tried *bool) (bool, error) {
+	return c.AddPeerAddressAsync(address, port, tried).Receive()
+}
@@ -0,0 +1,376 @@
+package rpcclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/btcboost/copernicus/btcjson"
+)
+
+// FutureHexResult is a future promise to deliver a hex-encoded result, such
+// as the one of a CreateRawTransactionAsync, GetRawTransactionAsync or
+// GetTxOutProofAsync RPC invocation (or an applicable error).
+type FutureHexResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// decoded bytes of the result.
+func (r FutureHexResult) Receive() ([]byte, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var resultHex string
+	if err := json.Unmarshal(res, &resultHex); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(resultHex)
+}
+
+// CreateRawTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See CreateRawTransaction for the blocking version and more details.
+func (c *Client) CreateRawTransactionAsync(inputs []btcjson.TransactionInput,
+	amounts map[string]float64, lockTime *int64) FutureHexResult {
+
+	cmd := btcjson.NewCreateRawTransactionCmd(inputs, amounts, lockTime)
+	return c.sendCmd(cmd)
+}
+
+// CreateRawTransaction returns a new serialized transaction spending the
+// provided inputs and sending to the provided addresses, the amounts being in
+// BTC.
+func (c *Client) CreateRawTransaction(inputs []btcjson.TransactionInput,
+	amounts map[string]float64, lockTime *int64) ([]byte, error) {
+
+	return c.CreateRawTransactionAsync(inputs, amounts, lockTime).Receive()
+}
+
+// FutureDecodeRawTransactionResult is a future promise to deliver the result
+// of a DecodeRawTransactionAsync RPC invocation (or an applicable error).
+type FutureDecodeRawTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about a transaction given its serialized bytes.
+func (r FutureDecodeRawTransactionResult) Receive() (*btcjson.TxRawDecodeResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var decodeRawTxResult btcjson.TxRawDecodeResult
+	if err := json.Unmarshal(res, &decodeRawTxResult); err != nil {
+		return nil, err
+	}
+	return &decodeRawTxResult, nil
+}
+
+// DecodeRawTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See DecodeRawTransaction for the blocking version and more details.
+func (c *Client) DecodeRawTransactionAsync(serializedTx []byte) FutureDecodeRawTransactionResult {
+	txHex := hex.EncodeToString(serializedTx)
+	cmd := btcjson.NewDecodeRawTransactionCmd(txHex)
+	return c.sendCmd(cmd)
+}
+
+// DecodeRawTransaction returns information about a transaction given its
+// serialized bytes.
+func (c *Client) DecodeRawTransaction(serializedTx []byte) (*btcjson.TxRawDecodeResult, error) {
+	return c.DecodeRawTransactionAsync(serializedTx).Receive()
+}
+
+// FutureDecodeScriptResult is a future promise to deliver the result
+// of a DecodeScriptAsync RPC invocation (or an applicable error).
+type FutureDecodeScriptResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about a script given its serialized bytes.
+func (r FutureDecodeScriptResult) Receive() (*btcjson.DecodeScriptResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var decodeScriptResult btcjson.DecodeScriptResult
+	if err := json.Unmarshal(res, &decodeScriptResult); err != nil {
+		return nil, err
+	}
+	return &decodeScriptResult, nil
+}
+
+// DecodeScriptAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See DecodeScript for the blocking version and more details.
+func (c *Client) DecodeScriptAsync(serializedScript []byte) FutureDecodeScriptResult {
+	scriptHex := hex.EncodeToString(serializedScript)
+	cmd := btcjson.NewDecodeScriptCmd(scriptHex)
+	return c.sendCmd(cmd)
+}
+
+// DecodeScript returns information about a script given its serialized bytes.
+func (c *Client) DecodeScript(serializedScript []byte) (*btcjson.DecodeScriptResult, error) {
+	return c.DecodeScriptAsync(serializedScript).Receive()
+}
+
+// GetRawTransactionAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetRawTransaction for the blocking version and more details.
+func (c *Client) GetRawTransactionAsync(txHash string) FutureHexResult {
+	cmd := btcjson.NewGetRawTransactionCmd(txHash, btcjson.Int(0))
+	return c.sendCmd(cmd)
+}
+
+// GetRawTransaction returns the serialized transaction given its hash.
+//
+// See GetRawTransactionVerbose to obtain additional information about the
+// transaction.
+func (c *Client) GetRawTransaction(txHash string) ([]byte, error) {
+	return c.GetRawTransactionAsync(txHash).Receive()
+}
+
+// FutureGetRawTransactionVerboseResult is a future promise to deliver the
+// result of a GetRawTransactionVerboseAsync RPC invocation (or an applicable
+// error).
+type FutureGetRawTransactionVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about a transaction given its hash.
+func (r FutureGetRawTransactionVerboseResult) Receive() (*btcjson.TxRawResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawTxResult btcjson.TxRawResult
+	if err := json.Unmarshal(res, &rawTxResult); err != nil {
+		return nil, err
+	}
+	return &rawTxResult, nil
+}
+
+// GetRawTransactionVerboseAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetRawTransactionVerbose for the blocking version and more details.
+func (c *Client) GetRawTransactionVerboseAsync(txHash string) FutureGetRawTransactionVerboseResult {
+	cmd := btcjson.NewGetRawTransactionCmd(txHash, btcjson.Int(1))
+	return c.sendCmd(cmd)
+}
+
+// GetRawTransactionVerbose returns information about a transaction given
+// its hash.
+//
+// See GetRawTransaction to obtain only the serialized transaction.
+func (c *Client) GetRawTransactionVerbose(txHash string) (*btcjson.TxRawResult, error) {
+	return c.GetRawTransactionVerboseAsync(txHash).Receive()
+}
+
+// FutureSendRawTransactionResult is a future promise to deliver the result
+// of a SendRawTransactionAsync RPC invocation (or an applicable error).
+type FutureSendRawTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// hash of the transaction sent to the network.
+func (r FutureSendRawTransactionResult) Receive() (string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return "", err
+	}
+
+	var txHash string
+	if err := json.Unmarshal(res, &txHash); err != nil {
+		return "", err
+	}
+	return txHash, nil
+}
+
+// SendRawTransactionAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See SendRawTransaction for the blocking version and more details.
+func (c *Client) SendRawTransactionAsync(serializedTx []byte, allowHighFees bool) FutureSendRawTransactionResult {
+	txHex := hex.EncodeToString(serializedTx)
+	cmd := btcjson.NewSendRawTransactionCmd(txHex, &allowHighFees)
+	return c.sendCmd(cmd)
+}
+
+// SendRawTransaction submits the serialized transaction to the server which
+// will then relay it to the network, and returns its hash.
+func (c *Client) SendRawTransaction(serializedTx []byte, allowHighFees bool) (string, error) {
+	return c.SendRawTransactionAsync(serializedTx, allowHighFees).Receive()
+}
+
+// FutureSearchRawTransactionsResult is a future promise to deliver the result
+// of the SearchRawTransactionsAsync RPC invocation (or an applicable error).
+type FutureSearchRawTransactionsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// found raw transactions.
+func (r FutureSearchRawTransactionsResult) Receive() ([][]byte, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var txsHex []string
+	if err := json.Unmarshal(res, &txsHex); err != nil {
+		return nil, err
+	}
+	txs := make([][]byte, len(txsHex))
+	for i, txHex := range txsHex {
+		txs[i], err = hex.DecodeString(txHex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+// SearchRawTransactionsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See SearchRawTransactions for the blocking version and more details.
+func (c *Client) SearchRawTransactionsAsync(address string, skip, count int,
+	reverse bool, filterAddrs []string) FutureSearchRawTransactionsResult {
+
+	verbose := btcjson.Int(0)
+	cmd := btcjson.NewSearchRawTransactionsCmd(address, verbose, &skip, &count,
+		nil, &reverse, &filterAddrs)
+	return c.sendCmd(cmd)
+}
+
+// SearchRawTransactions returns the serialized transactions which involve the
+// passed address.
+//
+// NOTE: Chain servers do not typically provide this capability unless it has
+// specifically been enabled.
+//
+// See SearchRawTransactionsVerbose to retrieve a list of data structures with
+// information about the transactions instead of the transactions themselves.
+func (c *Client) SearchRawTransactions(address string, skip, count int,
+	reverse bool, filterAddrs []string) ([][]byte, error) {
+
+	return c.SearchRawTransactionsAsync(address, skip, count, reverse,
+		filterAddrs).Receive()
+}
+
+// FutureSearchRawTransactionsVerboseResult is a future promise to deliver the
+// result of the SearchRawTransactionsVerboseAsync RPC invocation (or an
+// applicable error).
+type FutureSearchRawTransactionsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// found raw transactions.
+func (r FutureSearchRawTransactionsVerboseResult) Receive() ([]*btcjson.SearchRawTransactionsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*btcjson.SearchRawTransactionsResult
+	if err := json.Unmarshal(res, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SearchRawTransactionsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See SearchRawTransactionsVerbose for the blocking version and more details.
+func (c *Client) SearchRawTransactionsVerboseAsync(address string, skip,
+	count int, includePrevOut, reverse bool, filterAddrs []string) FutureSearchRawTransactionsVerboseResult {
+
+	verbose := btcjson.Int(1)
+	var prevOut *int
+	if includePrevOut {
+		prevOut = btcjson.Int(1)
+	}
+	cmd := btcjson.NewSearchRawTransactionsCmd(address, verbose, &skip, &count,
+		prevOut, &reverse, &filterAddrs)
+	return c.sendCmd(cmd)
+}
+
+// SearchRawTransactionsVerbose returns a list of data structures that describe
+// transactions which involve the passed address.
+//
+// NOTE: Chain servers do not typically provide this capability unless it has
+// specifically been enabled.
+//
+// See SearchRawTransactions to retrieve a list of raw transactions instead.
+func (c *Client) SearchRawTransactionsVerbose(address string, skip,
+	count int, includePrevOut, reverse bool, filterAddrs []string) ([]*btcjson.SearchRawTransactionsResult, error) {
+
+	return c.SearchRawTransactionsVerboseAsync(address, skip, count,
+		includePrevOut, reverse, filterAddrs).Receive()
+}
+
+// GetTxOutProofAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutProof for the blocking version and more details.
+func (c *Client) GetTxOutProofAsync(txIDs []string, blockHash string) FutureHexResult {
+	var hash *string
+	if blockHash != "" {
+		hash = &blockHash
+	}
+	cmd := btcjson.NewGetTxOutProofCmd(txIDs, hash)
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutProof returns the serialized merkle block proving the transactions
+// were included in a block.  blockHash may be empty when the transactions
+// are found without it.
+func (c *Client) GetTxOutProof(txIDs []string, blockHash string) ([]byte, error) {
+	return c.GetTxOutProofAsync(txIDs, blockHash).Receive()
+}
+
+// FutureVerifyTxOutProofResult is a future promise to deliver the result of a
+// VerifyTxOutProofAsync RPC invocation (or an applicable error).
+type FutureVerifyTxOutProofResult chan *response
+
+// Receive waits for the response promised by the future and returns the ids
+// of the transactions the proof commits to.
+func (r FutureVerifyTxOutProofResult) Receive() ([]string, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var txIDs []string
+	if err := json.Unmarshal(res, &txIDs); err != nil {
+		return nil, err
+	}
+	return txIDs, nil
+}
+
+// VerifyTxOutProofAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See VerifyTxOutProof for the blocking version and more details.
+func (c *Client) VerifyTxOutProofAsync(proof []byte) FutureVerifyTxOutProofResult {
+	cmd := btcjson.NewVerifyTxOutProofCmd(hex.EncodeToString(proof))
+	return c.sendCmd(cmd)
+}
+
+// VerifyTxOutProof verifies the serialized merkle block proof and returns
+// the ids of the transactions it commits to, which are empty when the block
+// is not in the best chain.
+func (c *Client) VerifyTxOutProof(proof []byte) ([]string, error) {
+	return c.VerifyTxOutProofAsync(proof).Receive()
+}
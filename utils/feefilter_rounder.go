@@ -68,7 +68,7 @@ func (feeFilterRounder *FeeFilterRounder) Round(currentMinFee int64) int64 {
 	if index != 0 && feeFilterRounder.insecureRand.Rand32()%3 != 0 {
 		index--
 	}
-	if index == len(list) && list[index] < float64(currentMinFee) {
+	if index == len(list) {
 		index--
 	}
 	return int64(list[index])